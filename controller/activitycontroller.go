@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+func (ctrl *controller) activityInit(e *echo.Echo) {
+	e.GET("/activity", ctrl.activityList, ctrl.authMiddleware)
+}
+
+// activityList renders the activity feed of the owner page by page,
+// optionally restricted to one item type (?type=company|invoice|note).
+func (ctrl *controller) activityList(c echo.Context) error {
+	m := ctrl.defaultResponseMap(c, "Aktivität")
+	ownerID := c.Get("ownerid").(uint)
+	userID := c.Get("uid").(uint)
+
+	const perPage = 25
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	itemType := c.QueryParam("type")
+	if !slices.Contains(model.ActivityItemTypes, itemType) {
+		itemType = ""
+	}
+
+	user, err := ctrl.model.GetUserByID(userID)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Laden des Benutzers")
+	}
+	// One item more than shown tells whether there is a next page.
+	hydr, err := ctrl.model.LoadActivityPaged(ownerID, perPage+1, (page-1)*perPage, itemType)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Laden der Änderungen")
+	}
+	hasNext := len(hydr.Heads) > perPage
+	if hasNext {
+		hydr.Heads = hydr.Heads[:perPage]
+	}
+
+	buildURL := func(p int) string {
+		params := url.Values{}
+		params.Set("page", strconv.Itoa(p))
+		if itemType != "" {
+			params.Set("type", itemType)
+		}
+		return "/activity?" + params.Encode()
+	}
+
+	m["changes"] = activityChanges(hydr, user.FullName)
+	m["page"] = page
+	m["hasPrev"] = page > 1
+	m["hasNext"] = hasNext
+	if page > 1 {
+		m["prevURL"] = buildURL(page - 1)
+	}
+	if hasNext {
+		m["nextURL"] = buildURL(page + 1)
+	}
+	m["filterType"] = itemType
+	return c.Render(http.StatusOK, "activity.html", m)
+}
+
+// activityChanges turns the hydrated activity feed into the entries shown
+// on the homepage and the activity page, newest first.
+func activityChanges(hydr *model.ActivityHydration, who string) []lastChanges {
+	changelog := make([]lastChanges, 0, len(hydr.Heads))
+
+	for _, h := range hydr.Heads {
+		switch h.ItemType {
+		case "company":
+			if c0, ok := hydr.Companies[h.ItemID]; ok {
+				coLink := safeLink(
+					fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name)),
+					c0.Name,
+				)
+				changelog = append(changelog, lastChanges{
+					Who:  who,
+					What: template.HTML(fmt.Sprintf(`hat die Firma %s angelegt`, coLink)),
+					When: c0.CreatedAt,
+				})
+			}
+		case "invoice":
+			if iv, ok := hydr.Invoices[h.ItemID]; ok {
+				c0 := hydr.Companies[iv.CompanyID]
+				invLink := safeLink(fmt.Sprintf("/invoice/detail/%d", iv.ID), iv.Number)
+				var coLink template.HTML
+				if c0.ID != 0 {
+					coLink = safeLink(fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name)), c0.Name)
+				} else {
+					coLink = template.HTML(escape(fmt.Sprintf("Firma #%d", iv.CompanyID)))
+				}
+				changelog = append(changelog, lastChanges{
+					Who:  who,
+					What: template.HTML(fmt.Sprintf(`hat die Rechnung %s (Firma %s) erstellt`, invLink, coLink)),
+					When: iv.CreatedAt,
+				})
+			}
+		case "note":
+			n, ok := hydr.Notes[h.ItemID]
+			if !ok {
+				continue // note might have been deleted
+			}
+
+			// short, safe excerpt
+			body := snippet(n.Body, 140)
+			bodyEsc := escape(body)
+
+			switch n.ParentType {
+			case model.ParentTypeCompany:
+				if c0, ok := hydr.Companies[n.ParentID]; ok {
+					target := safeLink(
+						fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name)),
+						c0.Name,
+					)
+					changelog = append(changelog, lastChanges{
+						Who: who,
+						What: template.HTML(fmt.Sprintf(
+							`hat eine Notiz zu %s erstellt: <span class="text-slate-600 italic">%s</span>`,
+							target, bodyEsc,
+						)),
+						When: n.CreatedAt,
+					})
+				} else {
+					// Fallback if company not available anymore
+					changelog = append(changelog, lastChanges{
+						Who: who,
+						What: template.HTML(fmt.Sprintf(
+							`hat eine Notiz zu Firma #%d erstellt: <span class="text-slate-600 italic">%s</span>`,
+							n.ParentID, bodyEsc,
+						)),
+						When: n.CreatedAt,
+					})
+				}
+
+			case model.ParentTypePerson:
+				if p, ok := hydr.People[n.ParentID]; ok {
+					target := safeLink(
+						fmt.Sprintf("/person/%d/%s", p.ID, url.PathEscape(p.Name)),
+						p.Name,
+					)
+					changelog = append(changelog, lastChanges{
+						Who: who,
+						What: template.HTML(fmt.Sprintf(
+							`hat eine Notiz zu %s erstellt: <span class="text-slate-600 italic">%s</span>`,
+							target, bodyEsc,
+						)),
+						When: n.CreatedAt,
+					})
+				} else {
+					changelog = append(changelog, lastChanges{
+						Who: who,
+						What: template.HTML(fmt.Sprintf(
+							`hat eine Notiz zu Person #%d erstellt: <span class="text-slate-600 italic">%s</span>`,
+							n.ParentID, bodyEsc,
+						)),
+						When: n.CreatedAt,
+					})
+				}
+
+			default:
+				// Unknown parent type (should not happen)
+				changelog = append(changelog, lastChanges{
+					Who: who,
+					What: template.HTML(fmt.Sprintf(
+						`hat eine Notiz erstellt: <span class="text-slate-600 italic">%s</span>`,
+						bodyEsc,
+					)),
+					When: n.CreatedAt,
+				})
+			}
+		}
+	}
+
+	// Heads are likely sorted already; enforce stability just in case.
+	sort.SliceStable(changelog, func(i, j int) bool { return changelog[i].When.After(changelog[j].When) })
+	return changelog
+}
@@ -32,7 +32,7 @@ func (ctrl *controller) adminInit(e *echo.Echo) {
 // adminMiddleware ensures only privileged users can access /admin.
 func (ctrl *controller) adminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		if b, ok := c.Get("is_admin").(bool); ok && b {
+		if role, _ := c.Get("role").(string); role == model.RoleAdmin {
 			return next(c)
 		}
 		return echo.NewHTTPError(http.StatusForbidden, "Not found")
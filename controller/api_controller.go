@@ -34,7 +34,10 @@ type APIInvoice struct {
 	ID               uint                 `json:"id" xml:"id,attr"`
 	Number           string               `json:"number" xml:"number"`
 	Status           string               `json:"status" xml:"status"`
+	DocumentType     string               `json:"document_type" xml:"document_type"`
+	ReferencedNumber string               `json:"referenced_invoice_number,omitempty" xml:"referenced_invoice_number,omitempty"`
 	Currency         string               `json:"currency" xml:"currency"`
+	ExchangeRate     string               `json:"exchange_rate,omitempty" xml:"exchange_rate,omitempty"`
 	NetTotal         string               `json:"net_total" xml:"net_total"`
 	GrossTotal       string               `json:"gross_total" xml:"gross_total"`
 	Date             time.Time            `json:"date" xml:"date"`
@@ -55,6 +58,12 @@ type APIInvoice struct {
 	IssuedAt         *time.Time           `json:"issued_at,omitempty" xml:"issued_at,omitempty"`
 	PaidAt           *time.Time           `json:"paid_at,omitempty" xml:"paid_at,omitempty"`
 	VoidedAt         *time.Time           `json:"voided_at,omitempty" xml:"voided_at,omitempty"`
+	ZugferdProfile   string               `json:"zugferd_profile,omitempty" xml:"zugferd_profile,omitempty"`
+	SkontoPercent    string               `json:"skonto_percent,omitempty" xml:"skonto_percent,omitempty"`
+	SkontoDays       int                  `json:"skonto_days,omitempty" xml:"skonto_days,omitempty"`
+	PaymentReference string               `json:"payment_reference,omitempty" xml:"payment_reference,omitempty"`
+	PriceDecimals    int                  `json:"price_decimals,omitempty" xml:"price_decimals,omitempty"`
+	RoundingMode     string               `json:"rounding_mode,omitempty" xml:"rounding_mode,omitempty"`
 	CreatedAt        time.Time            `json:"created_at" xml:"created_at"`
 	UpdatedAt        time.Time            `json:"updated_at" xml:"updated_at"`
 	InvoicePositions []APIInvoicePosition `json:"invoice_positions,omitempty" xml:"invoice_positions>position,omitempty"`
@@ -62,15 +71,17 @@ type APIInvoice struct {
 }
 
 type APIInvoicePosition struct {
-	ID         uint   `json:"id" xml:"id"`
-	Position   int    `json:"position" xml:"position"`
-	UnitCode   string `json:"unit_code" xml:"unit_code"`
-	Text       string `json:"text" xml:"text"`
-	Quantity   string `json:"quantity" xml:"quantity"`
-	TaxRate    string `json:"tax_rate" xml:"tax_rate"`
-	NetPrice   string `json:"net_price" xml:"net_price"`
-	GrossPrice string `json:"gross_price" xml:"gross_price"`
-	LineTotal  string `json:"line_total" xml:"line_total"`
+	ID              uint   `json:"id" xml:"id"`
+	Position        int    `json:"position" xml:"position"`
+	UnitCode        string `json:"unit_code" xml:"unit_code"`
+	Text            string `json:"text" xml:"text"`
+	Quantity        string `json:"quantity" xml:"quantity"`
+	TaxRate         string `json:"tax_rate" xml:"tax_rate"`
+	NetPrice        string `json:"net_price" xml:"net_price"`
+	GrossPrice      string `json:"gross_price" xml:"gross_price"`
+	LineTotal       string `json:"line_total" xml:"line_total"`
+	DiscountPercent string `json:"discount_percent,omitempty" xml:"discount_percent,omitempty"`
+	CostPrice       string `json:"cost_price,omitempty" xml:"cost_price,omitempty"`
 }
 
 type APITaxAmount struct {
@@ -79,9 +90,14 @@ type APITaxAmount struct {
 }
 
 type APIInvoiceList struct {
-	XMLName    struct{}     `json:"-" xml:"invoices"`
-	Items      []APIInvoice `json:"items" xml:"invoice"`
-	NextCursor string       `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+	XMLName struct{}     `json:"-" xml:"invoices"`
+	Items   []APIInvoice `json:"items" xml:"invoice"`
+	Total   int64        `json:"total" xml:"total,attr"`
+	Limit   int          `json:"limit" xml:"limit,attr"`
+	Offset  int          `json:"offset" xml:"offset,attr"`
+	// NextCursor is the offset of the next page for clients of the former
+	// cursor paging; empty on the last page. Deprecated: use offset.
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
 }
 
 type ExportInvoices struct {
@@ -60,6 +60,8 @@ type customerListQuery struct {
 	Tags   []string `query:"tags"`
 	Limit  int      `query:"limit"`
 	Offset int      `query:"offset"`
+	// IncludeArchived also lists archived customers.
+	IncludeArchived bool `query:"include_archived"`
 }
 
 // apiCustomerList handles GET /api/v1/customers
@@ -83,6 +85,7 @@ func (ctrl *controller) apiCustomerList(c echo.Context) error {
 		Tags:   q.Tags,
 		Limit:  q.Limit,
 		Offset: q.Offset,
+		IncludeArchived: q.IncludeArchived,
 	})
 	if err != nil {
 		return respond(c, http.StatusInternalServerError, apiError("db_error", "could not load customers"))
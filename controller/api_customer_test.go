@@ -25,6 +25,10 @@ func setupTestAPI(t *testing.T) (*echo.Echo, *model.Store) {
 	api.GET("/customers", ctrl.apiCustomerList)
 	api.GET("/customers/:id", ctrl.apiCustomerGet)
 	api.POST("/customers", ctrl.apiCustomerCreate)
+	api.GET("/invoices", ctrl.apiInvoiceList)
+	api.GET("/invoices/:id", ctrl.apiInvoiceGet)
+	api.POST("/invoices", ctrl.apiInvoiceCreate)
+	api.GET("/stats/revenue", ctrl.apiStatsRevenue)
 
 	return e, store
 }
@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
 )
 
@@ -24,7 +27,8 @@ func (ctrl *controller) apiCheckCustomerNumber(c echo.Context) error {
 			excludeID = uint(v)
 		}
 	}
-	ok, msg, err := ctrl.model.CheckCustomerNumber(c.Request().Context(), num, excludeID)
+	ownerID := c.Get("ownerid").(uint)
+	ok, msg, err := ctrl.model.CheckCustomerNumber(c.Request().Context(), ownerID, num, excludeID)
 	if err != nil {
 		// Keep a generic message for the client; log server-side details elsewhere if needed.
 		return c.JSON(http.StatusInternalServerError, echo.Map{
@@ -38,3 +42,38 @@ func (ctrl *controller) apiCheckCustomerNumber(c echo.Context) error {
 		"message": msg,
 	})
 }
+
+// settingsCustomerNumberPreview formats the next customer number for the
+// prefix, width and counter currently entered in the settings form. Nothing
+// is saved.
+func (ctrl *controller) settingsCustomerNumberPreview(c echo.Context) error {
+	bad := func(msg string) error {
+		return c.JSON(http.StatusBadRequest, echo.Map{"ok": false, "message": msg})
+	}
+	width, counter := 0, int64(0)
+	if v := strings.TrimSpace(c.QueryParam("width")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return bad("Breite muss eine Zahl sein")
+		}
+		width = n
+	}
+	if v := strings.TrimSpace(c.QueryParam("counter")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return bad("Zähler muss eine Zahl sein")
+		}
+		counter = n
+	}
+	if width < 0 || width > model.MaxCustomerNumberWidth {
+		return bad(fmt.Sprintf("Breite muss zwischen 0 und %d liegen", model.MaxCustomerNumberWidth))
+	}
+	if counter < 0 {
+		return bad("Zähler darf nicht negativ sein")
+	}
+	preview, err := model.PreviewCustomerNumber(c.QueryParam("prefix"), width, counter)
+	if err != nil {
+		return bad(err.Error())
+	}
+	return c.JSON(http.StatusOK, echo.Map{"ok": true, "preview": preview})
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSettingsCustomerNumberPreview(t *testing.T) {
+	e := echo.New()
+	ctrl := &controller{}
+	e.GET("/preview", ctrl.settingsCustomerNumberPreview)
+
+	tests := []struct {
+		query   string
+		code    int
+		preview string
+	}{
+		{"prefix=K-&width=5&counter=41", http.StatusOK, "K-00042"},
+		{"prefix=&width=0&counter=0", http.StatusOK, "1"},
+		{"prefix=C&width=12&counter=", http.StatusOK, "C000000000001"},
+		{"prefix=K-&width=13&counter=1", http.StatusBadRequest, ""},
+		{"prefix=K-&width=-1&counter=1", http.StatusBadRequest, ""},
+		{"prefix=K-&width=5&counter=-1", http.StatusBadRequest, ""},
+		{"prefix=K-&width=x&counter=1", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/preview?"+tt.query, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.query, rec.Code, tt.code)
+			continue
+		}
+		var body struct {
+			OK      bool   `json:"ok"`
+			Preview string `json:"preview"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if body.OK != (tt.code == http.StatusOK) || body.Preview != tt.preview {
+			t.Errorf("%s: got %+v, want preview %q", tt.query, body, tt.preview)
+		}
+	}
+}
@@ -1,22 +1,29 @@
 // controller/api_init.go
 package controller
 
-import "github.com/labstack/echo/v4"
+import (
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
 
 func (ctrl *controller) apiInit(e *echo.Echo) {
 	api := e.Group("/api/v1")
 	api.Use(ctrl.APIKeyAuthMiddleware())
 
 	// Token-Management
-	api.POST("/tokens", ctrl.apiCreateToken)
-	api.DELETE("/tokens/:id", ctrl.apiRevokeToken)
+	api.POST("/tokens", ctrl.apiCreateToken, requireScope(model.ScopeTokensWrite))
+	api.DELETE("/tokens/:id", ctrl.apiRevokeToken, requireScope(model.ScopeTokensWrite))
 
 	// Invoices
-	api.GET("/invoices", ctrl.apiInvoiceList)
-	api.GET("/invoices/:id", ctrl.apiInvoiceGet)
+	api.GET("/invoices", ctrl.apiInvoiceList, requireScope(model.ScopeInvoicesRead))
+	api.GET("/invoices/:id", ctrl.apiInvoiceGet, requireScope(model.ScopeInvoicesRead))
+	api.POST("/invoices", ctrl.apiInvoiceCreate, requireScope(model.ScopeInvoicesWrite))
 
 	// Customers
-	api.GET("/customers", ctrl.apiCustomerList)
-	api.GET("/customers/:id", ctrl.apiCustomerGet)
-	api.POST("/customers", ctrl.apiCustomerCreate)
+	api.GET("/customers", ctrl.apiCustomerList, requireScope(model.ScopeCustomersRead))
+	api.GET("/customers/:id", ctrl.apiCustomerGet, requireScope(model.ScopeCustomersRead))
+	api.POST("/customers", ctrl.apiCustomerCreate, requireScope(model.ScopeCustomersWrite))
+
+	// Statistics
+	api.GET("/stats/revenue", ctrl.apiStatsRevenue, requireScope(model.ScopeStatsRead))
 }
@@ -2,60 +2,131 @@
 package controller
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
-	"gorm.io/gorm"
+	"github.com/shopspring/decimal"
 )
 
 type invoiceListQuery struct {
-	Status    string `query:"status"`
-	CompanyID uint   `query:"company_id"`
-	Limit     int    `query:"limit"`
-	Cursor    string `query:"cursor"`
-	Sort      string `query:"sort"`
+	Status       string `query:"status"`
+	CompanyID    uint   `query:"company_id"`
+	PeriodField  string `query:"period_field"`  // "date" (default) or "due"
+	DateFrom     string `query:"date_from"`     // 2006-01-02
+	DateTo       string `query:"date_to"`       // 2006-01-02, inclusive
+	UpdatedSince string `query:"updated_since"` // RFC 3339
+	Sort         string `query:"sort"`
+	Limit        int    `query:"limit"`
+	Offset       int    `query:"offset"`
+	Cursor       string `query:"cursor"` // deprecated: offset as string, see APIInvoiceList.NextCursor
 }
 
+// apiInvoiceList handles GET /api/v1/invoices. It uses the same filters as the
+// web invoice list; updated_since allows clients to sync incrementally.
 func (ctrl *controller) apiInvoiceList(c echo.Context) error {
 	ownerID := apiOwnerID(c)
 	var q invoiceListQuery
 	if err := c.Bind(&q); err != nil {
 		return respond(c, http.StatusBadRequest, apiError("bad_query", "invalid query params"))
 	}
-	invs, next, err := ctrl.model.ListInvoices(ownerID, model.InvoiceListQuery{
-		Status:    q.Status,
-		CompanyID: q.CompanyID,
-		Limit:     q.Limit,
-		Cursor:    q.Cursor,
-		Sort:      q.Sort,
-	})
+
+	var statuses []model.InvoiceStatus
+	switch st := model.InvoiceStatus(strings.ToLower(q.Status)); st {
+	case "":
+	case "open":
+		statuses = []model.InvoiceStatus{model.InvoiceStatusIssued}
+	case model.InvoiceStatusDraft, model.InvoiceStatusIssued, model.InvoiceStatusPaid, model.InvoiceStatusVoided:
+		statuses = []model.InvoiceStatus{st}
+	default:
+		return respond(c, http.StatusBadRequest, apiError("bad_query", "invalid status"))
+	}
+
+	var companyID *uint
+	if q.CompanyID != 0 {
+		companyID = &q.CompanyID
+	}
+
+	var updatedSince *time.Time
+	if q.UpdatedSince != "" {
+		t, err := time.Parse(time.RFC3339, q.UpdatedSince)
+		if err != nil {
+			return respond(c, http.StatusBadRequest, apiError("bad_query", "updated_since must be RFC 3339"))
+		}
+		updatedSince = &t
+	}
+
+	periodField := "date"
+	if strings.ToLower(q.PeriodField) == "due" {
+		periodField = "due"
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	if q.Limit > 200 {
+		q.Limit = 200
+	}
+	if q.Cursor != "" && q.Offset == 0 {
+		if n, err := strconv.Atoi(q.Cursor); err == nil {
+			q.Offset = n
+		}
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	order := invoiceListOrder(q.Sort)
+	if q.Sort == "created_desc" { // sort order of the former cursor paging
+		order = "created_at desc, id desc"
+	}
+
+	invs, total, err := ctrl.model.FindInvoices(
+		ownerID,
+		statuses,
+		companyID,
+		"",
+		periodField,
+		parseListDate(q.DateFrom),
+		parseListDate(q.DateTo),
+		updatedSince,
+		q.Limit,
+		q.Offset,
+		order,
+	)
 	if err != nil {
 		return respond(c, http.StatusInternalServerError, apiError("db_error", "could not load invoices"))
 	}
 
 	items := make([]APIInvoice, len(invs))
-	for i, v := range invs {
-		items[i] = APIInvoice{
-			ID:             v.ID,
-			Number:         v.Number,
-			Status:         string(v.Status),
-			Currency:       v.Currency,
-			NetTotal:       v.NetTotal.String(),
-			GrossTotal:     v.GrossTotal.String(),
-			Date:           v.Date,
-			DueDate:        v.DueDate,
-			OccurrenceDate: v.OccurrenceDate,
-			CompanyID:      v.CompanyID,
-			CreatedAt:      v.CreatedAt,
-			UpdatedAt:      v.UpdatedAt,
-		}
+	for i := range invs {
+		items[i] = ctrl.toAPIInvoice(&invs[i])
+	}
+	list := APIInvoiceList{
+		Items:  items,
+		Total:  total,
+		Limit:  q.Limit,
+		Offset: q.Offset,
+	}
+	if next := q.Offset + len(items); int64(next) < total {
+		list.NextCursor = strconv.Itoa(next)
 	}
-	return respond(c, http.StatusOK, APIInvoiceList{Items: items, NextCursor: next})
+	return respond(c, http.StatusOK, list)
 }
 
+// apiInvoiceGet handles GET /api/v1/invoices/:id
 func (ctrl *controller) apiInvoiceGet(c echo.Context) error {
 	ownerID := apiOwnerID(c)
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -64,72 +135,240 @@ func (ctrl *controller) apiInvoiceGet(c echo.Context) error {
 	}
 	inv, err := ctrl.model.LoadInvoice(uint(id), ownerID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, model.ErrInvoiceNotFound) {
 			return respond(c, http.StatusNotFound, apiError("not_found", "invoice not found"))
 		}
 		return respond(c, http.StatusInternalServerError, apiError("db_error", "could not load invoice"))
 	}
 
-	// Ensure totals and tax amounts are up to date based on positions
-	inv.RecomputeTotals()
-
-	positions := make([]APIInvoicePosition, len(inv.InvoicePositions))
-	for i, p := range inv.InvoicePositions {
-		positions[i] = APIInvoicePosition{
-			ID:         p.ID,
-			Position:   p.Position,
-			UnitCode:   p.UnitCode,
-			Text:       p.Text,
-			Quantity:   p.Quantity.String(),
-			TaxRate:    p.TaxRate.String(),
-			NetPrice:   p.NetPrice.String(),
-			GrossPrice: p.GrossPrice.String(),
-			LineTotal:  p.LineTotal.String(),
+	// Tax amounts per rate are not stored; the totals of issued invoices are.
+	inv.RecomputeTaxAmounts()
+	out := ctrl.toAPIInvoice(inv)
+
+	// Add ETag for caching
+	c.Response().Header().Set("ETag",
+		`W/"inv-`+strconv.FormatUint(uint64(inv.ID), 10)+
+			`-`+strconv.FormatInt(inv.UpdatedAt.Unix(), 10)+`"`)
+
+	return respond(c, http.StatusOK, out)
+}
+
+// maxAPIInvoiceBody limits the request body of POST /api/v1/invoices.
+const maxAPIInvoiceBody = 1 << 20
+
+// apiInvoiceCreate handles POST /api/v1/invoices. The body has the shape of
+// APIInvoice; server managed fields (id, status, counter, totals, timestamps)
+// and the fields carried for the full export (discounts, cost prices, skonto,
+// payment reference, price decimals, rounding mode, ZUGFeRD profile) are
+// ignored and the invoice is created as a draft.
+//
+// Clients may send an Idempotency-Key header so that retries do not create
+// duplicates. The first request with a key stores its response; a repeated
+// request with the same key and the same body within 24 hours gets that
+// response again (with the header Idempotent-Replayed: true) and creates
+// nothing. Reusing a key with a different body, or while the first request is
+// still being processed, is answered with 409 Conflict. Failed requests do not
+// consume the key.
+func (ctrl *controller) apiInvoiceCreate(c echo.Context) error {
+	ownerID := apiOwnerID(c)
+
+	raw, err := io.ReadAll(io.LimitReader(c.Request().Body, maxAPIInvoiceBody+1))
+	if err != nil {
+		return respond(c, http.StatusBadRequest, apiError("bad_request", "cannot read request body"))
+	}
+	if len(raw) > maxAPIInvoiceBody {
+		return respond(c, http.StatusRequestEntityTooLarge, apiError("too_large", "request body too large"))
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(raw))
+
+	var input APIInvoice
+	if err := c.Bind(&input); err != nil {
+		return respond(c, http.StatusBadRequest, apiError("bad_request", "invalid request body"))
+	}
+	inv, err := ctrl.invoiceFromAPI(&input, ownerID)
+	if err != nil {
+		return respond(c, http.StatusBadRequest, apiError("validation_error", err.Error()))
+	}
+
+	var idem *model.IdempotencyKey
+	if key := strings.TrimSpace(c.Request().Header.Get("Idempotency-Key")); key != "" {
+		if len(key) > 255 {
+			return respond(c, http.StatusBadRequest, apiError("bad_request", "Idempotency-Key too long"))
+		}
+		sum := sha256.Sum256(raw)
+		hash := hex.EncodeToString(sum[:])
+		rec, created, err := ctrl.model.ReserveIdempotencyKey(ownerID, key, hash)
+		if err != nil {
+			return respond(c, http.StatusInternalServerError, apiError("db_error", "could not check idempotency key"))
+		}
+		if !created {
+			switch {
+			case rec.RequestHash != hash:
+				return respond(c, http.StatusConflict, apiError("idempotency_key_reused", "Idempotency-Key was already used for a different request"))
+			case rec.StatusCode == 0:
+				return respond(c, http.StatusConflict, apiError("request_in_progress", "a request with this Idempotency-Key is still being processed"))
+			}
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			return c.Blob(rec.StatusCode, rec.ContentType, rec.Response)
 		}
+		idem = rec
 	}
 
-	taxAmounts := make([]APITaxAmount, len(inv.TaxAmounts))
-	for i, t := range inv.TaxAmounts {
-		taxAmounts[i] = APITaxAmount{
-			Rate:   t.Rate.String(),
-			Amount: t.Amount.String(),
+	var uid uint
+	if p, ok := c.Get(string(ctxUserID)).(*uint); ok && p != nil {
+		uid = *p
+	}
+	if err := ctrl.model.AsUser(uid).SaveInvoice(inv, ownerID); err != nil {
+		if idem != nil {
+			_ = ctrl.model.ReleaseIdempotencyKey(idem.ID)
 		}
+		return respond(c, http.StatusInternalServerError, apiError("db_error", "could not create invoice"))
 	}
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionCreate, model.AuditEntityInvoice, inv.ID, inv.Number)
 
-	out := APIInvoice{
-		ID:               inv.ID,
-		Number:           inv.Number,
-		Status:           string(inv.Status),
-		Currency:         inv.Currency,
-		NetTotal:         inv.NetTotal.String(),
-		GrossTotal:       inv.GrossTotal.String(),
-		Date:             inv.Date,
-		DueDate:          inv.DueDate,
-		CompanyID:        inv.CompanyID,
-		ContactInvoice:   inv.ContactInvoice,
-		Counter:          inv.Counter,
-		ExemptionReason:  inv.ExemptionReason,
-		Footer:           inv.Footer,
-		Opening:          inv.Opening,
-		OccurrenceDate:   inv.OccurrenceDate,
-		OrderNumber:      inv.OrderNumber,
-		BuyerReference:   inv.BuyerReference,
-		SupplierNumber:   inv.SupplierNumber,
-		TaxNumber:        inv.TaxNumber,
-		TaxType:          inv.TaxType,
-		TemplateID:       inv.TemplateID,
-		IssuedAt:         inv.IssuedAt,
-		PaidAt:           inv.PaidAt,
-		VoidedAt:         inv.VoidedAt,
-		CreatedAt:        inv.CreatedAt,
-		UpdatedAt:        inv.UpdatedAt,
-		InvoicePositions: positions,
-		TaxAmounts:       taxAmounts,
-	}
-	// optional: ETag for caching
-	c.Response().Header().Set("ETag",
-		`W/"inv-`+strconv.FormatUint(uint64(inv.ID), 10)+
-			`-`+strconv.FormatInt(inv.UpdatedAt.Unix(), 10)+`"`)
+	// Reload so that the response carries the computed totals.
+	if saved, err := ctrl.model.LoadInvoice(inv.ID, ownerID); err == nil {
+		inv = saved
+	}
+	out := ctrl.toAPIInvoice(inv)
 
-	return respond(c, http.StatusOK, out)
+	var body []byte
+	contentType := echo.MIMEApplicationJSON
+	if wantsXML(c) {
+		contentType = echo.MIMEApplicationXMLCharsetUTF8
+		body, err = xml.Marshal(out)
+	} else {
+		body, err = json.Marshal(out)
+	}
+	if err != nil {
+		return respond(c, http.StatusInternalServerError, apiError("encode_error", "could not encode invoice"))
+	}
+	if idem != nil {
+		// The invoice exists, so the client gets it even if the response
+		// cannot be stored for replays.
+		if err := ctrl.model.CompleteIdempotencyKey(idem.ID, http.StatusCreated, contentType, body); err != nil {
+			slog.Error("store idempotency key failed", "invoice_id", inv.ID, "err", err)
+		}
+	}
+
+	c.Response().Header().Set("Location", "/api/v1/invoices/"+strconv.FormatUint(uint64(inv.ID), 10))
+	return c.Blob(http.StatusCreated, contentType, body)
+}
+
+// invoiceFromAPI validates the input of apiInvoiceCreate and turns it into a
+// draft invoice. Missing dates and texts are taken from the customer and the
+// settings, like a new invoice in the web interface.
+func (ctrl *controller) invoiceFromAPI(in *APIInvoice, ownerID uint) (*model.Invoice, error) {
+	if in.CompanyID == 0 {
+		return nil, errors.New("company_id is required")
+	}
+	company, err := ctrl.model.LoadCompany(in.CompanyID, ownerID)
+	if err != nil {
+		return nil, errors.New("unknown company_id")
+	}
+	settings, err := ctrl.model.LoadSettings(ownerID)
+	if err != nil {
+		return nil, errors.New("cannot load settings")
+	}
+	if len(in.InvoicePositions) == 0 {
+		return nil, errors.New("at least one invoice position is required")
+	}
+
+	docType := model.DocumentType(in.DocumentType)
+	if docType != "" && docType != model.DocumentTypeInvoice && docType != model.DocumentTypeCreditNote {
+		return nil, fmt.Errorf("invalid document_type %q", in.DocumentType)
+	}
+
+	inv := &model.Invoice{
+		OwnerID:         ownerID,
+		CompanyID:       company.ID,
+		Status:          model.InvoiceStatusDraft,
+		DocumentType:    docType,
+		Number:          strings.TrimSpace(in.Number),
+		Date:            in.Date,
+		OccurrenceDate:  in.OccurrenceDate,
+		DueDate:         in.DueDate,
+		Currency:        strings.TrimSpace(in.Currency),
+		ContactInvoice:  strings.TrimSpace(in.ContactInvoice),
+		Opening:         in.Opening,
+		Footer:          in.Footer,
+		OrderNumber:     strings.TrimSpace(in.OrderNumber),
+		BuyerReference:  strings.TrimSpace(in.BuyerReference),
+		SupplierNumber:  strings.TrimSpace(in.SupplierNumber),
+		TaxNumber:       strings.TrimSpace(in.TaxNumber),
+		TaxType:         strings.TrimSpace(in.TaxType),
+		ExemptionReason: strings.TrimSpace(in.ExemptionReason),
+		TemplateID:      in.TemplateID,
+	}
+	if inv.IsCreditNote() {
+		inv.ReferencedInvoiceNumber = strings.TrimSpace(in.ReferencedNumber)
+	}
+	if inv.Date.IsZero() {
+		inv.Date = time.Now()
+	}
+	if inv.OccurrenceDate.IsZero() {
+		inv.OccurrenceDate = inv.Date
+	}
+	if inv.DueDate.IsZero() {
+		inv.DueDate = model.ComputeDueDate(inv.Date, company, settings)
+	}
+	if inv.Currency == "" {
+		inv.Currency = cmp.Or(company.InvoiceCurrency, "EUR")
+	}
+	if inv.TaxType == "" {
+		inv.TaxType = company.InvoiceTaxType
+	}
+	if inv.ContactInvoice == "" {
+		inv.ContactInvoice = company.ContactInvoice
+	}
+	if inv.SupplierNumber == "" {
+		inv.SupplierNumber = company.SupplierNumber
+	}
+	if inv.Opening == "" {
+		inv.Opening = company.InvoiceOpening
+	}
+	if inv.Footer == "" {
+		inv.Footer = company.InvoiceFooter
+	}
+	if inv.ExemptionReason == "" {
+		inv.ExemptionReason = company.InvoiceExemptionReason
+	}
+	if inv.Number == "" {
+		// Like the form, suggest the next counter; issuing the invoice
+		// replaces the suggested number with the one for the allocated counter.
+		counter, err := ctrl.model.GetMaxCounter(company.ID, company.UsesLocalCounter(settings), ownerID)
+		if err != nil {
+			return nil, errors.New("cannot load invoice counter")
+		}
+		inv.Counter = counter + 1
+		inv.Number = model.FormatInvoiceNumber(settings.InvoiceNumberTemplate, company.CustomerNumber, int(inv.Counter), inv.Date)
+	}
+
+	priceDecimals := model.NormalizePriceDecimals(settings.PriceDecimals)
+	for i, p := range in.InvoicePositions {
+		pos := model.InvoicePosition{
+			OwnerID:  ownerID,
+			Position: i + 1,
+			UnitCode: strings.TrimSpace(p.UnitCode),
+			Text:     strings.TrimSpace(p.Text),
+		}
+		if pos.Text == "" {
+			return nil, fmt.Errorf("position %d: text is required", i+1)
+		}
+		if pos.Quantity, err = decimal.NewFromString(p.Quantity); err != nil || pos.Quantity.IsZero() {
+			return nil, fmt.Errorf("position %d: invalid quantity %q", i+1, p.Quantity)
+		}
+		if pos.NetPrice, err = decimal.NewFromString(p.NetPrice); err != nil {
+			return nil, fmt.Errorf("position %d: invalid net_price %q", i+1, p.NetPrice)
+		}
+		pos.NetPrice = pos.NetPrice.Round(int32(priceDecimals))
+		if pos.TaxRate, err = decimal.NewFromString(p.TaxRate); err != nil ||
+			pos.TaxRate.IsNegative() || pos.TaxRate.GreaterThan(decimal.NewFromInt(100)) {
+			return nil, fmt.Errorf("position %d: invalid tax_rate %q", i+1, p.TaxRate)
+		}
+		pos.GrossPrice = pos.NetPrice.Copy()
+		pos.LineTotal = pos.DiscountedLineTotal(priceDecimals)
+		inv.InvoicePositions = append(inv.InvoicePositions, pos)
+	}
+	return inv, nil
 }
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+func apiInvoiceGetRequest(t *testing.T, e *echo.Echo, id uint, ownerID uint) *httptest.ResponseRecorder {
+	t.Helper()
+	path := "/api/v1/invoices/" + strconv.FormatUint(uint64(id), 10)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	setOwnerContext(c, ownerID)
+
+	e.Router().Find(http.MethodGet, path, c)
+	if err := c.Handler()(c); err != nil {
+		t.Fatalf("Handler error: %v", err)
+	}
+	return rec
+}
+
+func TestAPIInvoiceGet(t *testing.T) {
+	e, store := setupTestAPI(t)
+
+	rows, _, err := store.FindInvoices(fixtures.DefaultOwnerID, nil, nil, "", "date", nil, nil, nil, 1, 0, "id asc")
+	if err != nil || len(rows) == 0 {
+		t.Fatalf("no seeded invoice: %v", err)
+	}
+	inv := rows[0]
+
+	rec := apiInvoiceGetRequest(t, e, inv.ID, fixtures.DefaultOwnerID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var result APIInvoice
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("JSON unmarshal error: %v", err)
+	}
+	if result.Number != inv.Number {
+		t.Errorf("Number = %q, want %q", result.Number, inv.Number)
+	}
+	if len(result.InvoicePositions) != len(fixtures.SamplePositions()) {
+		t.Errorf("InvoicePositions = %d, want %d", len(result.InvoicePositions), len(fixtures.SamplePositions()))
+	}
+	if len(result.TaxAmounts) == 0 {
+		t.Error("TaxAmounts should not be empty")
+	}
+	if result.DocumentType == "" {
+		t.Error("DocumentType should be set")
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Error("ETag header should be set")
+	}
+}
+
+func TestAPIInvoiceGet_NotFound(t *testing.T) {
+	e, store := setupTestAPI(t)
+
+	rec := apiInvoiceGetRequest(t, e, 9999, fixtures.DefaultOwnerID)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// An invoice of another owner must look exactly like a missing one.
+	rows, _, err := store.FindInvoices(fixtures.DefaultOwnerID, nil, nil, "", "date", nil, nil, nil, 1, 0, "id asc")
+	if err != nil || len(rows) == 0 {
+		t.Fatalf("no seeded invoice: %v", err)
+	}
+	rec = apiInvoiceGetRequest(t, e, rows[0].ID, fixtures.DefaultOwnerID+1)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("other owner: Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func apiInvoiceListRequest(t *testing.T, e *echo.Echo, query url.Values) (*httptest.ResponseRecorder, APIInvoiceList) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/invoices?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	setOwnerContext(c, fixtures.DefaultOwnerID)
+
+	e.Router().Find(http.MethodGet, "/api/v1/invoices", c)
+	if err := c.Handler()(c); err != nil {
+		t.Fatalf("Handler error: %v", err)
+	}
+	var result APIInvoiceList
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("JSON unmarshal error: %v", err)
+		}
+	}
+	return rec, result
+}
+
+func TestAPIInvoiceList(t *testing.T) {
+	e, store := setupTestAPI(t)
+
+	companies, _ := store.LoadAllCompanies(fixtures.DefaultOwnerID)
+	for i := 0; i < 3; i++ {
+		inv := fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(companies[0].ID),
+			fixtures.WithInvoiceNumber("RE-"+strconv.Itoa(i)),
+			fixtures.WithInvoiceStatus(model.InvoiceStatusPaid),
+		)
+		if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+	}
+
+	rec, result := apiInvoiceListRequest(t, e, url.Values{"limit": {"2"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if result.Total != 4 || len(result.Items) != 2 || result.Limit != 2 {
+		t.Errorf("total/items/limit = %d/%d/%d, want 4/2/2", result.Total, len(result.Items), result.Limit)
+	}
+
+	if result.NextCursor != "2" {
+		t.Errorf("next_cursor = %q, want 2", result.NextCursor)
+	}
+
+	_, result = apiInvoiceListRequest(t, e, url.Values{"limit": {"2"}, "offset": {"2"}})
+	if len(result.Items) != 2 || result.Offset != 2 {
+		t.Errorf("second page: items/offset = %d/%d, want 2/2", len(result.Items), result.Offset)
+	}
+
+	// Former cursor paging keeps working.
+	_, result = apiInvoiceListRequest(t, e, url.Values{"limit": {"2"}, "cursor": {"2"}})
+	if len(result.Items) != 2 || result.Offset != 2 || result.NextCursor != "" {
+		t.Errorf("cursor page: items/offset/next = %d/%d/%q, want 2/2/empty", len(result.Items), result.Offset, result.NextCursor)
+	}
+
+	_, result = apiInvoiceListRequest(t, e, url.Values{"status": {"paid"}})
+	if result.Total != 3 {
+		t.Errorf("status=paid: total = %d, want 3", result.Total)
+	}
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	_, result = apiInvoiceListRequest(t, e, url.Values{"updated_since": {future}})
+	if result.Total != 0 {
+		t.Errorf("updated_since in the future: total = %d, want 0", result.Total)
+	}
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	_, result = apiInvoiceListRequest(t, e, url.Values{"updated_since": {past}})
+	if result.Total != 4 {
+		t.Errorf("updated_since in the past: total = %d, want 4", result.Total)
+	}
+
+	for _, bad := range []url.Values{{"status": {"bogus"}}, {"updated_since": {"yesterday"}}} {
+		if rec, _ := apiInvoiceListRequest(t, e, bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: Status = %d, want %d", bad, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func apiInvoiceCreateRequest(t *testing.T, e *echo.Echo, body, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/invoices", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	setOwnerContext(c, fixtures.DefaultOwnerID)
+
+	e.Router().Find(http.MethodPost, "/api/v1/invoices", c)
+	if err := c.Handler()(c); err != nil {
+		t.Fatalf("Handler error: %v", err)
+	}
+	return rec
+}
+
+func TestAPIInvoiceCreate_Idempotent(t *testing.T) {
+	e, store := setupTestAPI(t)
+	companies, _ := store.LoadAllCompanies(fixtures.DefaultOwnerID)
+	countInvoices := func() int64 {
+		_, total, err := store.FindInvoices(fixtures.DefaultOwnerID, nil, nil, "", "date", nil, nil, nil, 1, 0, "id asc")
+		if err != nil {
+			t.Fatalf("FindInvoices failed: %v", err)
+		}
+		return total
+	}
+	before := countInvoices()
+
+	body := `{"company_id": ` + strconv.FormatUint(uint64(companies[0].ID), 10) + `,
+		"invoice_positions": [{"text": "Beratung", "unit_code": "HUR", "quantity": "2", "net_price": "100", "tax_rate": "19"}]}`
+
+	rec := apiInvoiceCreateRequest(t, e, body, "key-1")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var created APIInvoice
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("JSON unmarshal error: %v", err)
+	}
+	if created.Status != string(model.InvoiceStatusDraft) || created.GrossTotal != "238" {
+		t.Errorf("status/gross = %s/%s, want draft/238", created.Status, created.GrossTotal)
+	}
+
+	// A retry returns the original response and creates nothing.
+	retry := apiInvoiceCreateRequest(t, e, body, "key-1")
+	if retry.Code != http.StatusCreated || retry.Body.String() != rec.Body.String() {
+		t.Errorf("retry: Status = %d, body changed = %v", retry.Code, retry.Body.String() != rec.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry should be marked as replayed")
+	}
+	if got := countInvoices(); got != before+1 {
+		t.Errorf("invoices = %d, want %d", got, before+1)
+	}
+
+	// Same key, different body.
+	other := strings.Replace(body, `"2"`, `"3"`, 1)
+	if rec := apiInvoiceCreateRequest(t, e, other, "key-1"); rec.Code != http.StatusConflict {
+		t.Errorf("reused key: Status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	// Without a key every request creates an invoice.
+	apiInvoiceCreateRequest(t, e, body, "")
+	if got := countInvoices(); got != before+2 {
+		t.Errorf("invoices = %d, want %d", got, before+2)
+	}
+}
+
+func TestAPIInvoiceCreate_Validation(t *testing.T) {
+	e, store := setupTestAPI(t)
+	companies, _ := store.LoadAllCompanies(fixtures.DefaultOwnerID)
+	cid := strconv.FormatUint(uint64(companies[0].ID), 10)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no company", `{"invoice_positions": [{"text": "x", "quantity": "1", "net_price": "1", "tax_rate": "19"}]}`},
+		{"unknown company", `{"company_id": 9999, "invoice_positions": [{"text": "x", "quantity": "1", "net_price": "1", "tax_rate": "19"}]}`},
+		{"no positions", `{"company_id": ` + cid + `}`},
+		{"bad quantity", `{"company_id": ` + cid + `, "invoice_positions": [{"text": "x", "quantity": "eins", "net_price": "1", "tax_rate": "19"}]}`},
+		{"bad tax rate", `{"company_id": ` + cid + `, "invoice_positions": [{"text": "x", "quantity": "1", "net_price": "1", "tax_rate": "190"}]}`},
+		{"missing text", `{"company_id": ` + cid + `, "invoice_positions": [{"quantity": "1", "net_price": "1", "tax_rate": "19"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiInvoiceCreateRequest(t, e, tt.body, "key-"+tt.name)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
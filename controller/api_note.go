@@ -13,4 +13,5 @@ type APINote struct {
 	Body       string    `json:"body" xml:"body"`
 	Tags       string    `json:"tags" xml:"tags"`
 	EditedAt   time.Time `json:"edited_at" xml:"edited_at"`
+	Pinned     bool      `json:"pinned" xml:"pinned"`
 }
@@ -21,6 +21,29 @@ type APISettings struct {
 	CustomerNumberPrefix  string `xml:"customer_number_prefix"`
 	CustomerNumberWidth   int    `xml:"customer_number_width"`
 	CustomerNumberCounter int64  `xml:"customer_number_counter"`
+
+	InvoicePhone               string `xml:"invoice_phone,omitempty"`
+	PDFEngine                  string `xml:"pdf_engine,omitempty"`
+	ReminderFee                string `xml:"reminder_fee,omitempty"`
+	RoundingMode               string `xml:"rounding_mode,omitempty"`
+	DefaultPaymentTermDays     int    `xml:"default_payment_term_days,omitempty"`
+	Locale                     string `xml:"locale,omitempty"`
+	PaymentReferenceTemplate   string `xml:"payment_reference_template,omitempty"`
+	CustomerNumberMode         string `xml:"customer_number_mode,omitempty"`
+	BaseCurrency               string `xml:"base_currency,omitempty"`
+	PriceDecimals              int    `xml:"price_decimals,omitempty"`
+	DeliveryNoteNumberTemplate string `xml:"delivery_note_number_template,omitempty"`
+	DeliveryNoteCounter        int64  `xml:"delivery_note_counter,omitempty"`
+	InvoiceFilenameTemplate    string `xml:"invoice_filename_template,omitempty"`
+	DatevConsultantNumber      string `xml:"datev_consultant_number,omitempty"`
+	DatevClientNumber          string `xml:"datev_client_number,omitempty"`
+	DatevAccountLength         int    `xml:"datev_account_length,omitempty"`
+	DatevDebtorAccount         string `xml:"datev_debtor_account,omitempty"`
+	DatevAccounts              string `xml:"datev_accounts,omitempty"`
+	TaxNoteAEDE                string `xml:"tax_note_ae_de,omitempty"`
+	TaxNoteAEEN                string `xml:"tax_note_ae_en,omitempty"`
+	TaxNoteKDE                 string `xml:"tax_note_k_de,omitempty"`
+	TaxNoteKEN                 string `xml:"tax_note_k_en,omitempty"`
 }
 
 type ExportSettings struct {
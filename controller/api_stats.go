@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+// ---- DTOs for statistics ----
+type APIRevenueMonth struct {
+	Month int    `json:"month" xml:"month,attr"`
+	Net   string `json:"net" xml:"net"`
+	Gross string `json:"gross" xml:"gross"`
+}
+
+type APIRevenue struct {
+	XMLName struct{}          `json:"-" xml:"revenue"`
+	Year    int               `json:"year" xml:"year,attr"`
+	Net     string            `json:"net" xml:"net"`
+	Gross   string            `json:"gross" xml:"gross"`
+	Months  []APIRevenueMonth `json:"months" xml:"month"`
+}
+
+// apiStatsRevenue handles GET /api/v1/stats/revenue?year=YYYY. It returns
+// the monthly net and gross sums of issued and paid invoices; year defaults
+// to the current year.
+func (ctrl *controller) apiStatsRevenue(c echo.Context) error {
+	ownerID := apiOwnerID(c)
+	year := time.Now().Year()
+	if s := c.QueryParam("year"); s != "" {
+		y, err := strconv.Atoi(s)
+		if err != nil || y < 1900 || y > 9999 {
+			return respond(c, http.StatusBadRequest, apiError("bad_query", "invalid year"))
+		}
+		year = y
+	}
+
+	months, err := ctrl.model.RevenueByMonth(ownerID, year)
+	if err != nil {
+		return respond(c, http.StatusInternalServerError, apiError("db_error", "could not load revenue"))
+	}
+	out := APIRevenue{Year: year, Months: make([]APIRevenueMonth, len(months))}
+	net, gross := decimal.Zero, decimal.Zero
+	for i, m := range months {
+		net = net.Add(m.Net)
+		gross = gross.Add(m.Gross)
+		out.Months[i] = APIRevenueMonth{Month: int(m.Month), Net: m.Net.StringFixed(2), Gross: m.Gross.StringFixed(2)}
+	}
+	out.Net = net.StringFixed(2)
+	out.Gross = gross.StringFixed(2)
+	return respond(c, http.StatusOK, out)
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+)
+
+func TestAPIStatsRevenue(t *testing.T) {
+	e, _ := setupTestAPI(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		setOwnerContext(c, fixtures.DefaultOwnerID)
+		e.Router().Find(http.MethodGet, "/api/v1/stats/revenue", c)
+		if err := c.Handler()(c); err != nil {
+			t.Fatalf("Handler error: %v", err)
+		}
+		return rec
+	}
+
+	rec := get("/api/v1/stats/revenue?year=2025")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var result APIRevenue
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("JSON unmarshal error: %v", err)
+	}
+	if result.Year != 2025 || len(result.Months) != 12 {
+		t.Errorf("got year %d with %d months, want 2025 with 12", result.Year, len(result.Months))
+	}
+	// The seeded invoice is a draft and does not count.
+	if result.Gross != "0.00" {
+		t.Errorf("Gross = %q, want 0.00", result.Gross)
+	}
+
+	if rec := get("/api/v1/stats/revenue?year=abc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid year: Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -2,16 +2,20 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 type createTokenReq struct {
 	Name      string     `json:"name"`
-	Scope     string     `json:"scope"`
+	Scope     string     `json:"scope"` // comma-separated; empty = the scopes of the calling token (all for legacy tokens)
 	ExpiresAt *time.Time `json:"expires_at"`
 }
 type createTokenResp struct {
@@ -26,7 +30,28 @@ func (ctrl *controller) apiCreateToken(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, apiError("bad_request", "invalid payload"))
 	}
 	ownerID := apiOwnerID(c)
-	token, rec, err := ctrl.model.CreateAPIToken(ownerID, nil, req.Name, req.Scope, req.ExpiresAt)
+	caller := apiToken(c)
+	scopes := req.Scope
+	if strings.TrimSpace(scopes) == "" {
+		scopes = caller.Scopes
+		if caller.ScopeList() == nil {
+			scopes = strings.Join(model.APIScopes, ",")
+		}
+	}
+	scopes, err := model.NormalizeAPIScopes(scopes)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, apiError("bad_request", err.Error()))
+	}
+	// A token cannot hand out more than it has itself.
+	for _, sc := range (model.APIToken{Scopes: scopes}).ScopeList() {
+		if !caller.HasScope(sc) {
+			return c.JSON(http.StatusForbidden, apiError("insufficient_scope", "Token lacks scope "+sc))
+		}
+	}
+	token, rec, err := ctrl.model.CreateAPIToken(ownerID, nil, req.Name, scopes, req.ExpiresAt)
+	if errors.Is(err, model.ErrNoScope) {
+		return c.JSON(http.StatusBadRequest, apiError("bad_request", err.Error()))
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, apiError("db_error", "could not create token"))
 	}
@@ -40,6 +65,17 @@ func (ctrl *controller) apiRevokeToken(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, apiError("bad_request", "invalid id"))
 	}
+	target, err := ctrl.model.LoadAPIToken(uint(id), apiOwnerID(c))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, apiError("not_found", "token not found"))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, apiError("db_error", "could not load token"))
+	}
+	// Like on creation: a token may only revoke tokens it could have created.
+	if !apiToken(c).Covers(*target) {
+		return c.JSON(http.StatusForbidden, apiError("insufficient_scope", "Token lacks the scopes of the token to revoke"))
+	}
 	if err := ctrl.model.RevokeAPIToken(apiOwnerID(c), uint(id)); err != nil {
 		return c.JSON(http.StatusInternalServerError, apiError("db_error", "could not revoke token"))
 	}
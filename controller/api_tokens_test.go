@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	e := echo.New()
+	ctrl := &controller{model: store}
+	ctrl.apiInit(e)
+
+	readOnly, _, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "reporting", "invoices:read, customers:read", nil)
+	if err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	full, fullRec, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "full", strings.Join(model.APIScopes, ","), nil)
+	if err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+
+	do := func(token, method, path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"read customers", readOnly, http.MethodGet, "/api/v1/customers", "", http.StatusOK},
+		{"read invoices", readOnly, http.MethodGet, "/api/v1/invoices", "", http.StatusOK},
+		{"no stats scope", readOnly, http.MethodGet, "/api/v1/stats/revenue", "", http.StatusForbidden},
+		{"no write scope", readOnly, http.MethodPost, "/api/v1/customers", `{"name":"X"}`, http.StatusForbidden},
+		{"no token scope", readOnly, http.MethodPost, "/api/v1/tokens", `{"name":"X"}`, http.StatusForbidden},
+		{"full token", full, http.MethodGet, "/api/v1/stats/revenue", "", http.StatusOK},
+		{"unknown scope", full, http.MethodPost, "/api/v1/tokens", `{"name":"X","scope":"admin"}`, http.StatusBadRequest},
+		{"empty scope", full, http.MethodPost, "/api/v1/tokens", `{"name":"X","scope":" , "}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := do(tt.token, tt.method, tt.path, tt.body); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// Tokens cannot create tokens with more scopes than they have.
+	manager, _, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "manager", "tokens:write,invoices:read", nil)
+	if err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	if got := do(manager, http.MethodPost, "/api/v1/tokens", `{"name":"X","scope":"invoices:write"}`); got != http.StatusForbidden {
+		t.Errorf("escalation: status %d, want %d", got, http.StatusForbidden)
+	}
+	if got := do(manager, http.MethodPost, "/api/v1/tokens", `{"name":"X","scope":"invoices:read"}`); got != http.StatusCreated {
+		t.Errorf("narrower token: status %d, want %d", got, http.StatusCreated)
+	}
+
+	// ... and cannot revoke tokens with more scopes than they have.
+	_, narrowRec, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "narrow", model.ScopeInvoicesRead, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	if got := do(manager, http.MethodDelete, fmt.Sprintf("/api/v1/tokens/%d", fullRec.ID), ""); got != http.StatusForbidden {
+		t.Errorf("revoke broader token: status %d, want %d", got, http.StatusForbidden)
+	}
+	if got := do(manager, http.MethodDelete, fmt.Sprintf("/api/v1/tokens/%d", narrowRec.ID), ""); got != http.StatusNoContent {
+		t.Errorf("revoke narrower token: status %d, want %d", got, http.StatusNoContent)
+	}
+	if got := do(full, http.MethodGet, "/api/v1/customers", ""); got != http.StatusOK {
+		t.Errorf("full token after failed revoke: status %d, want %d", got, http.StatusOK)
+	}
+
+	tokens, _, err := store.ListAPITokensByOwner(fixtures.DefaultOwnerID, 10, "")
+	if err != nil {
+		t.Fatalf("ListAPITokensByOwner failed: %v", err)
+	}
+	for _, tok := range tokens {
+		if tok.Name == "reporting" && tok.Scopes != model.ScopeCustomersRead+","+model.ScopeInvoicesRead {
+			t.Errorf("scopes not normalized: %q", tok.Scopes)
+		}
+	}
+}
+
+func TestAPITokenExpired(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	e := echo.New()
+	ctrl := &controller{model: store}
+	ctrl.apiInit(e)
+
+	past := time.Now().Add(-time.Hour)
+	token, _, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "old", model.ScopeCustomersRead, &past)
+	if err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/customers", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "token_expired") {
+		t.Errorf("expired token: status %d, body %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCompanyDataExport(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	store.Config.XMLDir = t.TempDir()
+	ctrl := &controller{model: store}
+	owner := fixtures.DefaultOwnerID
+
+	// A second company of the same owner with its own contact, note and
+	// invoice must not show up in the export of data.Company.
+	other := fixtures.Company(fixtures.WithCompanyName("Fremdfirma AG"))
+	if err := store.SaveCompany(other, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	otherPerson := fixtures.Person(fixtures.WithPersonName("Erika Fremd"), fixtures.WithPersonCompanyID(int(other.ID)))
+	if err := store.SavePerson(otherPerson, owner, nil); err != nil {
+		t.Fatalf("SavePerson failed: %v", err)
+	}
+	otherInvoice := fixtures.Invoice(fixtures.WithInvoiceCompanyID(other.ID), fixtures.WithInvoiceNumber("RE-FREMD-1"))
+	if err := store.SaveInvoice(otherInvoice, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	for _, n := range []*model.Note{
+		{OwnerID: owner, AuthorID: owner, ParentType: model.ParentTypeCompany, ParentID: data.Company.ID, Title: "Eigene Notiz", Body: "x"},
+		{OwnerID: owner, AuthorID: owner, ParentType: model.ParentTypeCompany, ParentID: other.ID, Title: "Fremde Notiz", Body: "x"},
+	} {
+		if err := store.CreateNote(n); err != nil {
+			t.Fatalf("CreateNote failed: %v", err)
+		}
+	}
+	dir := filepath.Join(store.Config.XMLDir, fmt.Sprintf("owner%d", owner))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint{data.Invoice.ID, otherInvoice.ID} {
+		for _, ext := range []string{"pdf", "xml"} {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.%s", id, ext)), []byte(ext), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	export := func(companyID uint, ownerID uint) (*httptest.ResponseRecorder, error) {
+		e := echo.New()
+		id := fmt.Sprint(companyID)
+		req := httptest.NewRequest(http.MethodGet, "/company/"+id+"/export", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		c.Set("ownerid", ownerID)
+		return rec, ctrl.companyDataExport(c)
+	}
+
+	rec, err := export(data.Company.ID, owner)
+	if err != nil {
+		t.Fatalf("companyDataExport error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a ZIP: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	want := []string{
+		"customers.xml", "persons.xml", "invoices.xml",
+		fmt.Sprintf("invoices/pdf/%d.pdf", data.Invoice.ID),
+		fmt.Sprintf("invoices/xml/%d.xml", data.Invoice.ID),
+	}
+	for _, name := range want {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s in export", name)
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("export has %d files, want %d", len(files), len(want))
+	}
+	for name, content := range files {
+		for _, leak := range []string{"Fremdfirma", "Erika Fremd", "RE-FREMD-1", "Fremde Notiz", fmt.Sprintf("/%d.", otherInvoice.ID)} {
+			if strings.Contains(name, leak) || strings.Contains(content, leak) {
+				t.Errorf("%s contains %q of the other company", name, leak)
+			}
+		}
+	}
+	for name, needle := range map[string]string{
+		"customers.xml": "Eigene Notiz",
+		"persons.xml":   data.Person.Name,
+		"invoices.xml":  data.Invoice.Number,
+	} {
+		if !strings.Contains(files[name], needle) {
+			t.Errorf("%s does not contain %q", name, needle)
+		}
+	}
+
+	// Companies of other owners are not found.
+	if _, err := export(data.Company.ID, owner+1); err == nil {
+		t.Error("expected an error exporting a company of another owner")
+	}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+// companyImportColumns are the CSV columns understood by the company import.
+// Only name is required.
+var companyImportColumns = []string{"name", "address1", "zip", "city", "country", "vat_id", "customer_number"}
+
+// parseCompanyCSV reads companies from a CSV file with a header row.
+// The separator may be ';' or ','; unknown columns are ignored and empty
+// lines are skipped.
+func parseCompanyCSV(r io.Reader) ([]model.CompanyImportRow, error) {
+	br := bufio.NewReader(r)
+	// Strip a UTF-8 BOM as written by spreadsheet programs.
+	if b, err := br.Peek(3); err == nil && string(b) == "\xef\xbb\xbf" {
+		_, _ = br.Discard(3)
+	}
+	all, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	firstLine, _, _ := strings.Cut(string(all), "\n")
+	sep := ';'
+	if !strings.Contains(firstLine, ";") && strings.Contains(firstLine, ",") {
+		sep = ','
+	}
+
+	cr := csv.NewReader(strings.NewReader(string(all)))
+	cr.Comma = sep
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv parse error: %w", err)
+	}
+	idx := make(map[string]int, len(header))
+	for i, h := range header {
+		idx[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := idx["name"]; !ok {
+		return nil, fmt.Errorf("csv header must contain at least: name")
+	}
+
+	var rows []model.CompanyImportRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv parse error: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(col string) string {
+			i, ok := idx[col]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		isEmpty := true
+		for _, col := range companyImportColumns {
+			if get(col) != "" {
+				isEmpty = false
+				break
+			}
+		}
+		if isEmpty {
+			continue
+		}
+		rows = append(rows, model.CompanyImportRow{
+			Line:           line,
+			Name:           get("name"),
+			Address1:       get("address1"),
+			Zip:            get("zip"),
+			City:           get("city"),
+			Country:        get("country"),
+			VATID:          get("vat_id"),
+			CustomerNumber: get("customer_number"),
+		})
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("csv has no data rows")
+	}
+	return rows, nil
+}
+
+// companyImport shows the upload form (GET) and imports the uploaded CSV
+// file (POST). The result page lists the outcome for every row.
+func (ctrl *controller) companyImport(c echo.Context) error {
+	m := ctrl.defaultResponseMap(c, "Firmen importieren")
+	m["columns"] = companyImportColumns
+	if c.Request().Method == http.MethodGet {
+		return c.Render(http.StatusOK, "companyimport.html", m)
+	}
+
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return ErrInvalid(err, "Bitte eine CSV-Datei auswählen")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return ErrInvalid(err, "Datei kann nicht gelesen werden")
+	}
+	defer f.Close()
+
+	rows, err := parseCompanyCSV(f)
+	if err != nil {
+		return ErrInvalid(err, "Die CSV-Datei kann nicht gelesen werden: "+err.Error())
+	}
+
+	results, err := ctrl.model.ImportCompanies(ownerID, rows)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Import der Firmen")
+	}
+
+	counts := map[model.CompanyImportStatus]int{}
+	for _, r := range results {
+		counts[r.Status]++
+		if r.Status == model.CompanyImportCreated {
+			ctrl.model.LogAudit(ownerID, uid, model.AuditActionCreate, model.AuditEntityCompany, r.CompanyID, r.Name)
+		}
+	}
+	m["results"] = results
+	m["created"] = counts[model.CompanyImportCreated]
+	m["skipped"] = counts[model.CompanyImportSkipped]
+	m["failed"] = counts[model.CompanyImportError]
+	return c.Render(http.StatusOK, "companyimport.html", m)
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"container/list"
+
+	"github.com/billingcat/crm/model"
+)
+
+// companyNameCacheSize bounds the number of company names kept while
+// streaming an export.
+const companyNameCacheSize = 1024
+
+// companyNameCache resolves company IDs to names for one owner, keeping the
+// most recently used names in a bounded LRU so exports of large tenants do not
+// hold every company in memory.
+type companyNameCache struct {
+	store   *model.Store
+	ownerID uint
+	size    int
+	order   *list.List // front = most recently used; values are *companyNameEntry
+	entries map[uint]*list.Element
+}
+
+type companyNameEntry struct {
+	id   uint
+	name string
+}
+
+func newCompanyNameCache(store *model.Store, ownerID uint, size int) *companyNameCache {
+	return &companyNameCache{
+		store:   store,
+		ownerID: ownerID,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[uint]*list.Element, size),
+	}
+}
+
+// name returns the company name for id, or "" for 0 and unknown companies.
+func (cc *companyNameCache) name(id uint) (string, error) {
+	if id == 0 {
+		return "", nil
+	}
+	if el, ok := cc.entries[id]; ok {
+		cc.order.MoveToFront(el)
+		return el.Value.(*companyNameEntry).name, nil
+	}
+	names, err := cc.store.CompanyNamesByIDs(cc.ownerID, []uint{id})
+	if err != nil {
+		return "", err
+	}
+	cc.entries[id] = cc.order.PushFront(&companyNameEntry{id: id, name: names[id]})
+	if cc.order.Len() > cc.size {
+		oldest := cc.order.Back()
+		cc.order.Remove(oldest)
+		delete(cc.entries, oldest.Value.(*companyNameEntry).id)
+	}
+	return names[id], nil
+}
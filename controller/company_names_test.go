@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+)
+
+func TestCompanyNameCache(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	other := fixtures.Company(fixtures.WithCompanyName("Other GmbH"))
+	if err := store.SaveCompany(other, fixtures.DefaultOwnerID, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	cc := newCompanyNameCache(store, fixtures.DefaultOwnerID, 1)
+	for _, tt := range []struct {
+		id   uint
+		want string
+	}{
+		{data.Company.ID, data.Company.Name},
+		{other.ID, "Other GmbH"},
+		{data.Company.ID, data.Company.Name}, // evicted and loaded again
+		{0, ""},
+		{9999, ""},
+	} {
+		got, err := cc.name(tt.id)
+		if err != nil {
+			t.Fatalf("name(%d) failed: %v", tt.id, err)
+		}
+		if got != tt.want {
+			t.Errorf("name(%d) = %q, want %q", tt.id, got, tt.want)
+		}
+		if cc.order.Len() > 1 {
+			t.Errorf("cache holds %d entries, want at most 1", cc.order.Len())
+		}
+	}
+}
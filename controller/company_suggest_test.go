@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCompanySuggest(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+	owner := fixtures.DefaultOwnerID
+
+	for i := range companySuggestLimit + 5 {
+		co := fixtures.Company(fixtures.WithCompanyName(fmt.Sprintf("Vorschlag %02d GmbH", i)))
+		if err := store.SaveCompany(co, owner, nil); err != nil {
+			t.Fatalf("SaveCompany failed: %v", err)
+		}
+	}
+	archived := fixtures.Company(fixtures.WithCompanyName("Archiv Vorschlag KG"))
+	if err := store.SaveCompany(archived, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	if err := store.ArchiveCompany(archived.ID, owner); err != nil {
+		t.Fatalf("ArchiveCompany failed: %v", err)
+	}
+	foreign := fixtures.Company(fixtures.WithCompanyName("Fremder Vorschlag AG"), fixtures.WithCompanyOwnerID(owner+1))
+	if err := store.SaveCompany(foreign, owner+1, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	suggest := func(q string) []struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+	} {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/company/suggest?q="+q, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("ownerid", owner)
+		if err := ctrl.companySuggest(c); err != nil {
+			t.Fatalf("companySuggest(%q) failed: %v", q, err)
+		}
+		var got []struct {
+			ID   uint   `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return got
+	}
+
+	got := suggest("vorschlag")
+	if len(got) != companySuggestLimit {
+		t.Fatalf("got %d suggestions, want %d", len(got), companySuggestLimit)
+	}
+	if got[0].Name != "Vorschlag 00 GmbH" {
+		t.Errorf("first suggestion = %q, want Vorschlag 00 GmbH", got[0].Name)
+	}
+	for _, s := range got {
+		if s.ID == archived.ID || s.ID == foreign.ID {
+			t.Errorf("unexpected suggestion %q", s.Name)
+		}
+	}
+	if got := suggest("fremder"); len(got) != 0 {
+		t.Errorf("company of another owner suggested: %v", got)
+	}
+	if got := suggest(""); got == nil || len(got) != 0 {
+		t.Errorf("empty query = %v, want []", got)
+	}
+}
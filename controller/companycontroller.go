@@ -5,17 +5,21 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/billingcat/crm/model"
 	"github.com/go-playground/form/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/shopspring/decimal"
 	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
 func (ctrl *controller) companyInit(e *echo.Echo) {
@@ -27,17 +31,27 @@ func (ctrl *controller) companyInit(e *echo.Echo) {
 	g.POST("/edit/:id", ctrl.upsertCompany)
 	g.GET("/list", ctrl.companylist)
 	g.GET("/list/export", ctrl.companyExport)
+	g.GET("/import", ctrl.companyImport)
+	g.GET("/suggest", ctrl.companySuggest)
+	g.POST("/import", ctrl.companyImport)
 	g.GET("/:id/:name", ctrl.companydetail)
 	g.GET("/:id", ctrl.companydetail)
 	g.POST("/:id/tags", ctrl.companyTagsUpdate)
+	g.POST("/bulk-tags", ctrl.companyBulkTags)
+	g.POST("/:id/archive", ctrl.companyArchive)
+	g.POST("/:id/unarchive", ctrl.companyArchive)
+	g.POST("/:id/drafts/delete", ctrl.companyDraftsDelete)
+	g.GET("/:id/statement", ctrl.companyStatement)
+	g.GET("/:id/export", ctrl.companyDataExport)
 }
 
 // ---- Form-Types ----
 
 type contactInfoForm struct {
-	Type  string `form:"type"`  // phone | fax | email | website | linkedin | twitter | github | other
-	Label string `form:"label"` // Bezeichnung (z.B. Büro, Support)
-	Value string `form:"value"` // eigentliche Nummer/URL/E-Mail
+	Type    string `form:"type"`    // phone | fax | email | website | linkedin | twitter | github | other
+	Label   string `form:"label"`   // Bezeichnung (z.B. Büro, Support)
+	Value   string `form:"value"`   // eigentliche Nummer/URL/E-Mail
+	Primary bool   `form:"primary"` // Haupteintrag seines Typs
 }
 
 type companyForm struct {
@@ -60,6 +74,9 @@ type companyForm struct {
 	InvoiceTaxType         string            `form:"invoicetaxtype"`
 	InvoiceFooter          string            `form:"invoicefooter"`
 	InvoiceExemptionReason string            `form:"invoiceexemptionreason"`
+	EInvoiceProfile        string            `form:"einvoiceprofile"`
+	PaymentTermDays        string            `form:"paymenttermdays"`
+	UseLocalCounter        bool              `form:"uselocalcounter"`
 	Tags                   []string          `form:"tags"` // multiple inputs
 	EmailSubjectInvoice    string            `form:"email_subject_invoice"`
 	EmailBodyInvoice       string            `form:"email_body_invoice"`
@@ -87,7 +104,7 @@ func (ctrl *controller) upsertCompany(c echo.Context) error {
 			m["cancel"] = "/"
 
 			ctx := c.Request().Context()
-			suggestion, err := ctrl.model.SuggestNextCustomerNumber(ctx)
+			suggestion, err := ctrl.model.SuggestNextCustomerNumber(ctx, ownerID)
 			if err != nil {
 				if errors.Is(err, model.ErrNoSettingsRow) {
 					AddFlash(c, "info", "Bitte richte zunächst die Grundeinstellungen ein, bevor du Firmen anlegst.")
@@ -103,6 +120,8 @@ func (ctrl *controller) upsertCompany(c echo.Context) error {
 			m["company"] = model.Company{
 				CustomerNumber: suggestion,
 			}
+			// No suggestion means freeform customer numbers: entered by hand.
+			m["customerNumberRequired"] = suggestion == ""
 			return c.Render(http.StatusOK, "companyedit.html", m)
 		}
 
@@ -159,7 +178,7 @@ func (ctrl *controller) upsertCompany(c echo.Context) error {
 
 		// Customer number rules
 		desired := strings.TrimSpace(comp.CustomerNumber)
-		if err := ctrl.handleCustomerNumber(c.Request().Context(), dbCompany, desired, isNew); err != nil {
+		if err := ctrl.handleCustomerNumber(c.Request().Context(), ownerID, dbCompany, desired, isNew); err != nil {
 			return err // already wrapped with ErrInvalid inside
 		}
 
@@ -219,6 +238,16 @@ func applyFormToCompany(dst *model.Company, src companyForm) {
 	dst.InvoiceTaxType = strings.TrimSpace(src.InvoiceTaxType)
 	dst.InvoiceFooter = strings.TrimSpace(src.InvoiceFooter)
 	dst.InvoiceExemptionReason = strings.TrimSpace(src.InvoiceExemptionReason)
+	dst.EInvoiceProfile = model.EInvoiceProfileZUGFeRD
+	if model.EInvoiceProfile(strings.TrimSpace(src.EInvoiceProfile)) == model.EInvoiceProfileXRechnung {
+		dst.EInvoiceProfile = model.EInvoiceProfileXRechnung
+	}
+	// Empty or invalid input means "use the default from the settings".
+	dst.DefaultPaymentTermDays = 0
+	if days, err := strconv.Atoi(strings.TrimSpace(src.PaymentTermDays)); err == nil && days > 0 {
+		dst.DefaultPaymentTermDays = days
+	}
+	dst.UseLocalCounter = src.UseLocalCounter
 	// CustomerNumber is handled separately (business rules).
 }
 
@@ -236,6 +265,7 @@ func buildContactInfos(items []contactInfoForm, ownerID uint, parentType model.P
 			Type:       t,
 			Label:      l,
 			Value:      v,
+			IsPrimary:  ci.Primary,
 			OwnerID:    ownerID,
 			ParentType: parentType,
 		})
@@ -245,21 +275,24 @@ func buildContactInfos(items []contactInfoForm, ownerID uint, parentType model.P
 
 // handleCustomerNumber encapsulates the "new vs. edit" customer number rules,
 // including availability checks and counter lifting.
-func (ctrl *controller) handleCustomerNumber(ctx context.Context, dbCompany *model.Company, desired string, isNew bool) error {
+func (ctrl *controller) handleCustomerNumber(ctx context.Context, ownerID uint, dbCompany *model.Company, desired string, isNew bool) error {
 	switch {
 	case isNew:
 		// New company:
 		// - Empty => allocate via NextCustomerNumberTx
 		// - Non-empty => must be free and may lift counter
 		if desired == "" {
-			num, _, allocErr := ctrl.model.NextCustomerNumberTx(ctx)
+			num, _, allocErr := ctrl.model.NextCustomerNumberTx(ctx, ownerID)
+			if errors.Is(allocErr, model.ErrCustomerNumberFreeform) {
+				return ErrInvalid(allocErr, "Bitte eine Kundennummer eingeben")
+			}
 			if allocErr != nil {
 				return ErrInvalid(allocErr, "Kundennummer konnte nicht automatisch vergeben werden")
 			}
 			dbCompany.CustomerNumber = num
 			return nil
 		}
-		ok, msg, chkErr := ctrl.model.CheckCustomerNumber(ctx, desired, 0 /* exclude none on new */)
+		ok, msg, chkErr := ctrl.model.CheckCustomerNumber(ctx, ownerID, desired, 0 /* exclude none on new */)
 		if chkErr != nil {
 			return ErrInvalid(chkErr, "Fehler bei der Kundennummernprüfung")
 		}
@@ -269,7 +302,7 @@ func (ctrl *controller) handleCustomerNumber(ctx context.Context, dbCompany *mod
 			}
 			return ErrInvalid(fmt.Errorf("customer number taken"), msg)
 		}
-		if liftErr := ctrl.model.MaybeLiftCustomerCounterFor(ctx, desired); liftErr != nil {
+		if liftErr := ctrl.model.MaybeLiftCustomerCounterFor(ctx, ownerID, desired); liftErr != nil {
 			return ErrInvalid(liftErr, "Konnte Zählerstand nicht anheben")
 		}
 		dbCompany.CustomerNumber = desired
@@ -282,7 +315,7 @@ func (ctrl *controller) handleCustomerNumber(ctx context.Context, dbCompany *mod
 		if desired == "" || desired == dbCompany.CustomerNumber {
 			return nil
 		}
-		ok, msg, chkErr := ctrl.model.CheckCustomerNumber(ctx, desired, dbCompany.ID)
+		ok, msg, chkErr := ctrl.model.CheckCustomerNumber(ctx, ownerID, desired, dbCompany.ID)
 		if chkErr != nil {
 			return ErrInvalid(chkErr, "Fehler bei der Kundennummernprüfung")
 		}
@@ -292,7 +325,7 @@ func (ctrl *controller) handleCustomerNumber(ctx context.Context, dbCompany *mod
 			}
 			return ErrInvalid(fmt.Errorf("customer number taken"), msg)
 		}
-		if liftErr := ctrl.model.MaybeLiftCustomerCounterFor(ctx, desired); liftErr != nil {
+		if liftErr := ctrl.model.MaybeLiftCustomerCounterFor(ctx, ownerID, desired); liftErr != nil {
 			return ErrInvalid(liftErr, "Konnte Zählerstand nicht anheben")
 		}
 		dbCompany.CustomerNumber = desired
@@ -333,6 +366,13 @@ func (ctrl *controller) companydetail(c echo.Context) error {
 	m["title"] = companyDB.Name
 	m["ExistingTags"] = tagNames
 	m["noteparenttype"] = model.ParentTypeCompany
+	drafts := 0
+	for _, inv := range companyDB.Invoices {
+		if inv.Status == model.InvoiceStatusDraft {
+			drafts++
+		}
+	}
+	m["draftcount"] = drafts
 
 	ctrl.model.TouchRecentView(ownerID, model.EntityCompany, companyDB.ID)
 
@@ -384,6 +424,201 @@ func (ctrl *controller) companyTagsUpdate(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/company/%d", companyID))
 }
 
+// POST /company/:id/archive and /company/:id/unarchive
+func (ctrl *controller) companyArchive(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+	companyID, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "invalid company ID")
+	}
+	archive := strings.HasSuffix(c.Path(), "/archive")
+	if archive {
+		err = ctrl.model.ArchiveCompany(companyID, ownerID)
+	} else {
+		err = ctrl.model.UnarchiveCompany(companyID, ownerID)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Fehler beim Archivieren")
+	}
+	summary := "archiviert"
+	if !archive {
+		summary = "aus dem Archiv geholt"
+	}
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityCompany, companyID, summary)
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/company/%d", companyID))
+}
+
+// POST /company/:id/drafts/delete
+// Moves all draft invoices of the company to the trash. Issued invoices are
+// left alone.
+func (ctrl *controller) companyDraftsDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+	companyID, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "invalid company ID")
+	}
+	if _, err := ctrl.model.LoadCompany(companyID, ownerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Kann Firma nicht laden")
+	}
+	n, err := ctrl.model.AsUser(uid).DeleteDraftInvoicesForCompany(ownerID, companyID)
+	if err != nil {
+		if errors.Is(err, model.ErrInvoiceNotDraft) {
+			_ = AddFlash(c, "error", "Eine der Rechnungen wurde inzwischen gestellt. Es wurde nichts gelöscht.")
+			return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/company/%d", companyID))
+		}
+		return ErrInvalid(err, "Kann Entwürfe nicht löschen")
+	}
+	if n > 0 {
+		ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityCompany, companyID, fmt.Sprintf("%d Rechnungsentwürfe gelöscht", n))
+	}
+	_ = AddFlash(c, "success", fmt.Sprintf("%d Entwürfe in den Papierkorb verschoben.", n))
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/company/%d", companyID))
+}
+
+// GET /company/:id/statement?from=YYYY-MM-DD&to=YYYY-MM-DD&format=pdf|csv
+// Serves the account statement of a company. The period defaults to the
+// current year up to today.
+func (ctrl *controller) companyStatement(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerID := c.Get("ownerid").(uint)
+	companyID, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "invalid company ID")
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+	to := now
+	if t := parseListDate(c.QueryParam("from")); t != nil {
+		from = *t
+	}
+	if t := parseListDate(c.QueryParam("to")); t != nil {
+		to = *t
+	}
+	if to.Before(from) {
+		return ErrInvalid(fmt.Errorf("statement period ends before it starts"), "Das Enddatum liegt vor dem Anfangsdatum")
+	}
+
+	st, err := ctrl.model.BuildCompanyStatement(ownerID, companyID, from, to)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Fehler beim Erstellen des Kontoauszugs")
+	}
+	basename := fmt.Sprintf("kontoauszug-%d-%s-%s", companyID, st.From.Format("20060102"), st.To.Format("20060102"))
+
+	if c.QueryParam("format") == "csv" {
+		loc := ctrl.ownerExportLocale(ownerID)
+		header := []string{loc.text("Datum", "Date"), loc.text("Beleg", "Document"), loc.text("Vorgang", "Description"), loc.text("Betrag", "Amount"), loc.text("Saldo", "Balance")}
+		// Statements in a foreign currency get the amounts converted to the
+		// base currency in extra columns.
+		converted := st.BaseCurrency != "" && st.BaseCurrency != st.Currency
+		if converted {
+			header = append(header, loc.text("Betrag", "Amount")+" ("+st.BaseCurrency+")", loc.text("Saldo", "Balance")+" ("+st.BaseCurrency+")")
+		}
+		records := make([][]string, 0, len(st.Entries)+2)
+		opening := []string{loc.date(st.From), "", loc.text("Anfangssaldo", "Opening balance"), "", loc.amount(st.OpeningBalance)}
+		if converted {
+			opening = append(opening, "", loc.amount(st.OpeningBalanceBase))
+		}
+		records = append(records, opening)
+		baseBalance := st.OpeningBalanceBase
+		for _, e := range st.Entries {
+			rec := []string{
+				loc.date(e.Date),
+				e.Number,
+				e.Text,
+				loc.amount(e.Amount),
+				loc.amount(e.Balance),
+			}
+			if converted {
+				baseBalance = baseBalance.Add(e.BaseAmount)
+				rec = append(rec, loc.amount(e.BaseAmount), loc.amount(baseBalance))
+			}
+			records = append(records, rec)
+		}
+		closing := []string{loc.date(st.To), "", loc.text("Endsaldo", "Closing balance"), "", loc.amount(st.ClosingBalance)}
+		if converted {
+			closing = append(closing, "", loc.amount(st.ClosingBalanceBase))
+		}
+		records = append(records, closing)
+		return writeCSVDownload(c, loc, basename+".csv", header, records)
+	}
+
+	pdfPath := filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", ownerID), fmt.Sprintf("statement-%d.pdf", companyID))
+	if err = ensureDir(filepath.Dir(pdfPath)); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für die PDF-Datei")
+	}
+	if err = ctrl.model.CreateStatementPDF(st, ownerID, pdfPath, logger); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Kontoauszugs")
+	}
+	return c.Attachment(pdfPath, basename+".pdf")
+}
+
+// POST /company/bulk-tags
+// Adds one tag to several companies (JSON or form: ids, tag) and reports how
+// many companies were newly tagged.
+func (ctrl *controller) companyBulkTags(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+
+	var payload struct {
+		IDs []uint `json:"ids" form:"ids"`
+		Tag string `json:"tag" form:"tag"`
+	}
+	if err := c.Bind(&payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+	tag := strings.TrimSpace(payload.Tag)
+	if tag == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "tag is required")
+	}
+	if len(payload.IDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "no companies selected")
+	}
+
+	added, err := ctrl.model.AddTagToCompanies(ownerID, payload.IDs, tag)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Zuweisen des Tags")
+	}
+	return c.JSON(http.StatusOK, echo.Map{"tag": tag, "added": added})
+}
+
+// companySuggestLimit caps the answer of companySuggest.
+const companySuggestLimit = 20
+
+// GET /company/suggest?q=...
+// companySuggest returns the owner's active companies whose name contains q
+// as JSON [{id, name}], for the company typeahead in the person form.
+func (ctrl *controller) companySuggest(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	type suggestion struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+	}
+	out := []suggestion{}
+	q := strings.TrimSpace(c.QueryParam("q"))
+	if q == "" {
+		return c.JSON(http.StatusOK, out)
+	}
+	companies, err := ctrl.model.SuggestCompanies(q, ownerID, companySuggestLimit)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Suchen der Firmen")
+	}
+	for _, co := range companies {
+		out = append(out, suggestion{ID: co.ID, Name: co.Name})
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
 func (ctrl *controller) companylist(c echo.Context) error {
 	ownerID := c.Get("ownerid").(uint)
 
@@ -392,6 +627,7 @@ func (ctrl *controller) companylist(c echo.Context) error {
 	tags := c.QueryParams()["tags"] // multiple tags
 	mode := strings.ToLower(strings.TrimSpace(c.QueryParam("mode")))
 	modeAND := (mode == "and")
+	includeArchived := c.QueryParam("include_archived") == "1"
 
 	// Pagination
 	const defaultPageSize = 25
@@ -399,7 +635,7 @@ func (ctrl *controller) companylist(c echo.Context) error {
 	if page <= 0 {
 		page = 1
 	}
-	ps, _ := strconv.Atoi(c.QueryParam("ps"))
+	ps, _ := strconv.Atoi(ctrl.listParam(c, "ps", model.PrefCompanyPageSize, pageSizeUpTo(200)))
 	if ps <= 0 {
 		ps = defaultPageSize
 	}
@@ -412,11 +648,12 @@ func (ctrl *controller) companylist(c echo.Context) error {
 	}
 
 	res, err := ctrl.model.SearchCompaniesByTags(ownerID, model.CompanyListFilters{
-		Query:   q,
-		Tags:    normalizeSliceInput(tags),
-		ModeAND: modeAND,
-		Limit:   ps,
-		Offset:  offset,
+		Query:           q,
+		Tags:            normalizeSliceInput(tags),
+		ModeAND:         modeAND,
+		IncludeArchived: includeArchived,
+		Limit:           ps,
+		Offset:          offset,
 	})
 	if err != nil {
 		return ErrInvalid(err, "Fehler beim Laden der Firmenliste")
@@ -429,6 +666,7 @@ func (ctrl *controller) companylist(c echo.Context) error {
 	m["q"] = q
 	m["selectedTags"] = normalizeSliceInput(tags)
 	m["modeAND"] = modeAND
+	m["includeArchived"] = includeArchived
 	m["tagCounts"] = allTags
 	m["companies"] = res.Companies
 	m["page"] = int64(page)
@@ -494,9 +732,10 @@ func (ctrl *controller) companyExport(c echo.Context) error {
 
 	// Fetch ALL filtered companies (ignores pagination)
 	res, err := ctrl.model.ListAllCompaniesByTags(ownerID, model.CompanyListFilters{
-		Query:   q,
-		Tags:    tags,
-		ModeAND: modeAND,
+		Query:           q,
+		Tags:            tags,
+		ModeAND:         modeAND,
+		IncludeArchived: c.QueryParam("include_archived") == "1",
 	})
 	if err != nil {
 		return ErrInvalid(err, "Fehler beim Laden der Firmen für den Export")
@@ -516,54 +755,53 @@ func (ctrl *controller) companyExport(c echo.Context) error {
 		filename = fmt.Sprintf("firmen-filter-%s", stamp)
 	}
 
+	loc := ctrl.ownerExportLocale(ownerID)
 	switch format {
 	case "excel", "xlsx", "xls":
-		return exportCompaniesExcel(c, filename+".xlsx", res, tagMap)
+		return exportCompaniesExcel(c, loc, filename+".xlsx", res, tagMap)
 	default:
-		return exportCompaniesCSV(c, filename+".csv", res, tagMap)
+		return exportCompaniesCSV(c, loc, filename+".csv", res, tagMap)
 	}
 }
 
-func exportCompaniesCSV(c echo.Context, filename string, rows []model.Company, tagMap map[uint][]model.Tag) error {
-	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
-	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
-
-	w := csv.NewWriter(c.Response())
-	defer w.Flush()
-
-	// Header
-	_ = w.Write([]string{"ID", "Name", "City", "Country", "Tags"})
-
+func exportCompaniesCSV(c echo.Context, loc exportLocale, filename string, rows []model.Company, tagMap map[uint][]model.Tag) error {
+	header := companyExportHeader(loc)
+	records := make([][]string, 0, len(rows))
 	for _, cmp := range rows {
-		// Build tag string "A; B; C"
-		var names []string
-		if ts, ok := tagMap[cmp.ID]; ok {
-			for _, t := range ts {
-				names = append(names, t.Name)
-			}
-		}
-		sort.Strings(names)
-		tagStr := strings.Join(names, "; ")
-
-		_ = w.Write([]string{
+		records = append(records, []string{
 			fmt.Sprintf("%d", cmp.ID),
 			strings.TrimSpace(cmp.Name),
 			strings.TrimSpace(cmp.Zip + " " + cmp.City),
 			strings.TrimSpace(cmp.Country),
-			tagStr,
+			companyTagString(tagMap[cmp.ID]),
 		})
 	}
-	return nil
+	return writeCSVDownload(c, loc, filename, header, records)
+}
+
+// companyExportHeader returns the column names of the company export.
+func companyExportHeader(loc exportLocale) []string {
+	return []string{"ID", "Name", loc.text("Ort", "City"), loc.text("Land", "Country"), "Tags"}
+}
+
+// companyTagString joins the tag names sorted, as "A; B; C".
+func companyTagString(ts []model.Tag) string {
+	names := make([]string, 0, len(ts))
+	for _, t := range ts {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "; ")
 }
 
-func exportCompaniesExcel(c echo.Context, filename string, rows []model.Company, tagMap map[uint][]model.Tag) error {
+func exportCompaniesExcel(c echo.Context, loc exportLocale, filename string, rows []model.Company, tagMap map[uint][]model.Tag) error {
 	f := excelize.NewFile()
 	defer f.Close()
 
 	sheet := f.GetSheetName(0)
 
 	// Header
-	header := []string{"ID", "Name", "City", "Country", "Tags"}
+	header := companyExportHeader(loc)
 	for i, h := range header {
 		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
 		_ = f.SetCellValue(sheet, cell, h)
@@ -577,14 +815,7 @@ func exportCompaniesExcel(c echo.Context, filename string, rows []model.Company,
 	// Rows
 	for r, cmp := range rows {
 		row := r + 2
-		var names []string
-		if ts, ok := tagMap[cmp.ID]; ok {
-			for _, t := range ts {
-				names = append(names, t.Name)
-			}
-		}
-		sort.Strings(names)
-		tagStr := strings.Join(names, "; ")
+		tagStr := companyTagString(tagMap[cmp.ID])
 		_ = f.SetCellValue(sheet, cell(row, 1), cmp.ID)
 		_ = f.SetCellValue(sheet, cell(row, 2), cmp.Name)
 		_ = f.SetCellValue(sheet, cell(row, 3), fmt.Sprintf("%s %s", cmp.Zip, cmp.City))
@@ -614,3 +845,53 @@ func cell(row, col int) string {
 	addr, _ := excelize.CoordinatesToCellName(col, row)
 	return addr
 }
+
+// writeCSVDownload sends header and rows as a CSV attachment, see
+// streamCSVDownload.
+func writeCSVDownload(c echo.Context, loc exportLocale, filename string, header []string, rows [][]string) error {
+	return streamCSVDownload(c, loc, filename, header, func(write func([]string) error) error {
+		for _, row := range rows {
+			if err := write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// streamCSVDownload sends a CSV attachment whose rows are produced by each,
+// so large exports need not be held in memory. It uses the delimiter of loc
+// and writes a UTF-8 BOM where the locale needs one. Invalid UTF-8 in a field
+// is dropped.
+func streamCSVDownload(c echo.Context, loc exportLocale, filename string, header []string, each func(write func([]string) error) error) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+
+	res.WriteHeader(http.StatusOK)
+	if loc.bom {
+		if _, err := res.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+			return err
+		}
+	}
+
+	w := csv.NewWriter(res)
+	w.Comma = loc.comma
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	err := each(func(row []string) error {
+		// Ensure all fields are valid UTF-8 (defensive).
+		for i := range row {
+			if !utf8.ValidString(row[i]) {
+				row[i] = strings.ToValidUTF8(row[i], "")
+			}
+		}
+		return w.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
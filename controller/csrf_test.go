@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestCSRF_DeleteRoutes(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	e := echo.New()
+	e.Pre(middleware.MethodOverrideWithConfig(middleware.MethodOverrideConfig{
+		Getter: middleware.MethodFromForm("_method"),
+	}))
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	e.Use(csrfMiddleware(false))
+	ctrl := &controller{model: store}
+	ctrl.invoiceInit(e)
+	ctrl.personInit(e)
+
+	e.GET("/signin", func(c echo.Context) error {
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = td.User.ID
+		sw.Values()["ownerid"] = td.User.OwnerID
+		sw.Values()[sessionVersionKey] = uint(0)
+		return sw.Save()
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin", nil))
+	cookies := rec.Result().Cookies()
+	var token string
+	for _, ck := range cookies {
+		if ck.Name == "csrf" {
+			token = ck.Value
+		}
+	}
+	if token == "" {
+		t.Fatal("no csrf cookie set")
+	}
+
+	// The invoice detail page posts a form with _method=DELETE.
+	deleteInvoice := func(form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/invoice/delete/%d", td.Invoice.ID), strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// The person form sends a DELETE request with the token in a header.
+	deletePerson := func(header string) int {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/person/delete/%d", td.Person.ID), nil)
+		if header != "" {
+			req.Header.Set("X-CSRF-Token", header)
+		}
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := deleteInvoice(url.Values{"_method": {"DELETE"}}); code != http.StatusForbidden {
+		t.Errorf("invoice without token: status %d, want 403", code)
+	}
+	if code := deleteInvoice(url.Values{"_method": {"DELETE"}, "csrf": {"wrong"}}); code != http.StatusForbidden {
+		t.Errorf("invoice with wrong token: status %d, want 403", code)
+	}
+	if code := deletePerson(""); code != http.StatusForbidden {
+		t.Errorf("person without token: status %d, want 403", code)
+	}
+	if _, err := store.LoadInvoice(td.Invoice.ID, td.User.OwnerID); err != nil {
+		t.Fatalf("invoice deleted without valid token: %v", err)
+	}
+	if _, err := store.LoadPerson(td.Person.ID, td.User.OwnerID); err != nil {
+		t.Fatalf("person deleted without valid token: %v", err)
+	}
+
+	if code := deleteInvoice(url.Values{"_method": {"DELETE"}, "csrf": {token}}); code != http.StatusSeeOther {
+		t.Errorf("invoice with token: status %d, want 303", code)
+	}
+	if _, err := store.LoadInvoice(td.Invoice.ID, td.User.OwnerID); err == nil {
+		t.Error("invoice not deleted with valid token")
+	}
+	if code := deletePerson(token); code != http.StatusOK {
+		t.Errorf("person with token: status %d, want 200", code)
+	}
+}
@@ -2,56 +2,62 @@ package controller
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
 )
 
 func (ctrl *controller) emailTemplatesInit(e *echo.Echo) {
-	g := e.Group("/email-templates")
+	g := e.Group("/settings/email-templates")
 	g.Use(ctrl.authMiddleware)
 	g.GET("", ctrl.emailTemplatesList)
 	g.GET("/edit/:kind", ctrl.emailTemplateEdit)
 	g.POST("/edit/:kind", ctrl.emailTemplateSave)
+	g.POST("/preview/:kind", ctrl.emailTemplatePreview) // live preview with sample data
+
+	// Old addresses, kept for bookmarks.
+	e.GET("/email-templates", func(c echo.Context) error {
+		return c.Redirect(http.StatusMovedPermanently, "/settings/email-templates")
+	})
+	e.GET("/email-templates/edit/:kind", func(c echo.Context) error {
+		return c.Redirect(http.StatusMovedPermanently, "/settings/email-templates/edit/"+url.PathEscape(c.Param("kind")))
+	})
 }
 
 // emailTemplateKindInfo describes a configurable mail kind for the UI.
 type emailTemplateKindInfo struct {
-	Kind             model.EmailTemplateKind
+	model.EmailKind
 	Title            string
 	Description      string
-	DefaultSubject   string
-	DefaultBody      string
-	Placeholders     []emailTemplatePlaceholder
 	HasCustomization bool
 }
 
-type emailTemplatePlaceholder struct {
-	Name string
-	Desc string
-}
-
 // emailTemplateKinds returns the list of known mail kinds shown in the UI.
-// Add new entries here when a new mail kind becomes configurable.
+// Add new entries here when a new mail kind becomes configurable. Signup
+// mails are not listed: they are sent before a tenant exists.
 func emailTemplateKinds() []emailTemplateKindInfo {
-	return []emailTemplateKindInfo{
+	kinds := []emailTemplateKindInfo{
+		{
+			EmailKind:   model.EmailKind{Kind: model.EmailTemplateKindInvoice},
+			Title:       "Rechnung",
+			Description: "Vorbefüllter Mail-Text für „Rechnung per E-Mail senden“ auf der Rechnungs-Detailseite. Eine Firma kann ihn auf ihrer Bearbeitungsseite überschreiben.",
+		},
 		{
-			Kind:           model.EmailTemplateKindInvoice,
-			Title:          "Rechnung",
-			Description:    "Vorbefüllter Mail-Text für „Rechnung per E-Mail senden“ auf der Rechnungs-Detailseite.",
-			DefaultSubject: model.DefaultInvoiceMailSubject,
-			DefaultBody:    model.DefaultInvoiceMailBody,
-			Placeholders:   invoicePlaceholders(),
+			EmailKind:   model.EmailKind{Kind: model.EmailTemplateKindPasswordReset},
+			Title:       "Passwort zurücksetzen",
+			Description: "Mail mit dem Link zum Zurücksetzen des Passworts.",
+		},
+		{
+			EmailKind:   model.EmailKind{Kind: model.EmailTemplateKindTeamInvitation},
+			Title:       "Team-Einladung",
+			Description: "Mail an neue Teammitglieder mit dem Link zum Anlegen des Zugangs.",
 		},
 	}
-}
-
-func invoicePlaceholders() []emailTemplatePlaceholder {
-	out := make([]emailTemplatePlaceholder, 0, len(model.InvoiceMailPlaceholders))
-	for _, p := range model.InvoiceMailPlaceholders {
-		out = append(out, emailTemplatePlaceholder{Name: p.Name, Desc: p.Desc})
+	for i := range kinds {
+		kinds[i].EmailKind, _ = model.LookupEmailKind(kinds[i].Kind)
 	}
-	return out
+	return kinds
 }
 
 func findEmailTemplateKind(kind string) (emailTemplateKindInfo, bool) {
@@ -126,5 +132,19 @@ func (ctrl *controller) emailTemplateSave(c echo.Context) error {
 		return ErrInvalid(err, "Kann E-Mail-Vorlage nicht speichern")
 	}
 	_ = AddFlash(c, "success", "E-Mail-Vorlage gespeichert.")
-	return c.Redirect(http.StatusSeeOther, "/email-templates")
+	return c.Redirect(http.StatusSeeOther, "/settings/email-templates")
+}
+
+// emailTemplatePreview renders the subject and body currently entered in the
+// editor with sample data. Nothing is saved.
+func (ctrl *controller) emailTemplatePreview(c echo.Context) error {
+	info, ok := findEmailTemplateKind(c.Param("kind"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, echo.Map{"ok": false, "message": "Unbekannte Vorlage"})
+	}
+	subject, body, err := model.RenderEmailPreview(info.Kind, c.FormValue("subject"), c.FormValue("body"))
+	if err != nil {
+		return c.JSON(http.StatusOK, echo.Map{"ok": false, "message": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"ok": true, "subject": subject, "body": body})
 }
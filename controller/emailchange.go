@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+const emailChangeTTL = 60 * time.Minute
+
+// settingsEmail shows the form to change the account email (GET) and sends
+// the confirmation link to the new address (POST). The answer is the same
+// whether the address is free or not, so the form cannot be used to probe
+// for accounts.
+func (ctrl *controller) settingsEmail(c echo.Context) error {
+	uid := c.Get("uid").(uint)
+	u, err := ctrl.model.GetUserByID(uid)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load user")
+	}
+	if c.Request().Method == http.MethodGet {
+		m := ctrl.defaultResponseMap(c, "E-Mail-Adresse ändern")
+		m["user"] = u
+		return c.Render(http.StatusOK, "settings_email.html", m)
+	}
+
+	logger := c.Get("logger").(*slog.Logger)
+	newEmail := model.NormalizeEmail(c.FormValue("email"))
+	if !strings.Contains(newEmail, "@") {
+		_ = AddFlash(c, "error", "Bitte eine gültige E-Mail-Adresse angeben.")
+		return c.Redirect(http.StatusSeeOther, "/settings/email")
+	}
+	if newEmail == u.Email {
+		_ = AddFlash(c, "info", "Das ist bereits deine E-Mail-Adresse.")
+		return c.Redirect(http.StatusSeeOther, "/settings/email")
+	}
+
+	neutral := func() error {
+		_ = AddFlash(c, "info", "Wir haben eine E-Mail an "+newEmail+" gesendet. Bitte bestätige die Änderung über den Link darin.")
+		return c.Redirect(http.StatusSeeOther, "/settings/profile")
+	}
+
+	taken, err := ctrl.model.EmailInUse(newEmail, u.ID)
+	if err != nil {
+		logger.Error("cannot check email", "error", err)
+		return neutral()
+	}
+	if taken {
+		body := "Someone tried to move a billingcat account to this address, but it already belongs to an account. If this was you, sign in with this address instead."
+		_ = ctrl.sendEmail(newEmail, "Email change on billingcat", body)
+		return neutral()
+	}
+
+	token, tokenHash, err := generateRandomToken()
+	if err != nil {
+		logger.Error("cannot generate email change token", "error", err)
+		return neutral()
+	}
+	if err := ctrl.model.RequestEmailChange(u.ID, newEmail, tokenHash, emailChangeTTL); err != nil {
+		logger.Error("cannot store email change", "error", err)
+		return neutral()
+	}
+	confirmURL := fmt.Sprintf("%s://%s/email/confirm?token=%s", c.Scheme(), c.Request().Host, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Please confirm the new email address of your billingcat account:\n\n%s\n\nThe link is valid for 60 minutes. If you did not request this, you can ignore this message.",
+		confirmURL,
+	)
+	_ = ctrl.sendEmail(newEmail, "Confirm your new email address", body)
+	return neutral()
+}
+
+// confirmEmailChange opens the link from the confirmation mail. It does not
+// need a session, the link may be opened on another device.
+func (ctrl *controller) confirmEmailChange(c echo.Context) error {
+	sum := sha256.Sum256([]byte(c.QueryParam("token")))
+	u, err := ctrl.model.ConfirmEmailChange(sum[:])
+	switch {
+	case errors.Is(err, model.ErrEmailTaken):
+		_ = AddFlash(c, "error", "Diese E-Mail-Adresse wird inzwischen von einem anderen Konto verwendet. Die Änderung wurde verworfen.")
+		return c.Redirect(http.StatusSeeOther, "/settings/profile")
+	case err != nil:
+		_ = AddFlash(c, "error", "Der Link ist ungültig oder abgelaufen.")
+		return c.Redirect(http.StatusSeeOther, "/settings/profile")
+	}
+
+	// Tell the old address, in case the change was not wanted.
+	body := fmt.Sprintf("The email address of your billingcat account was changed to %s. If this was not you, contact support.", u.Email)
+	_ = ctrl.sendEmail(u.PendingEmail, "Your email address was changed", body)
+
+	_ = AddFlash(c, "success", "Deine E-Mail-Adresse wurde geändert.")
+	return c.Redirect(http.StatusSeeOther, "/settings/profile")
+}
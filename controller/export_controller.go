@@ -4,13 +4,17 @@ import (
 	"archive/zip"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 func (ctrl *controller) exportInvoicesXML(ctx context.Context, zw *zip.Writer, ownerID uint) error {
@@ -34,8 +38,8 @@ func (ctrl *controller) exportInvoicesXML(ctx context.Context, zw *zip.Writer, o
 	for i := range invs {
 		inv := &invs[i]
 
-		// Ensure totals and tax amounts are in sync with positions
-		inv.RecomputeTotals()
+		// Tax amounts per rate are not stored; the totals of issued invoices are.
+		inv.RecomputeTaxAmounts()
 
 		apiInv := ctrl.toAPIInvoice(inv)
 		export.Invoices = append(export.Invoices, apiInv)
@@ -69,6 +73,12 @@ func (ctrl *controller) toAPIInvoice(inv *model.Invoice) APIInvoice {
 			GrossPrice: p.GrossPrice.String(),
 			LineTotal:  p.LineTotal.String(),
 		}
+		if !p.DiscountPercent.IsZero() {
+			positions[i].DiscountPercent = p.DiscountPercent.String()
+		}
+		if !p.CostPrice.IsZero() {
+			positions[i].CostPrice = p.CostPrice.String()
+		}
 	}
 
 	taxAmounts := make([]APITaxAmount, len(inv.TaxAmounts))
@@ -79,11 +89,19 @@ func (ctrl *controller) toAPIInvoice(inv *model.Invoice) APIInvoice {
 		}
 	}
 
+	var skonto string
+	if !inv.SkontoPercent.IsZero() {
+		skonto = inv.SkontoPercent.String()
+	}
+
 	return APIInvoice{
 		ID:               inv.ID,
 		Number:           inv.Number,
 		Status:           string(inv.Status),
+		DocumentType:     string(inv.DocumentType),
+		ReferencedNumber: inv.ReferencedInvoiceNumber,
 		Currency:         inv.Currency,
+		ExchangeRate:     inv.ExchangeRate.String(),
 		NetTotal:         inv.NetTotal.String(),
 		GrossTotal:       inv.GrossTotal.String(),
 		Date:             inv.Date,
@@ -104,6 +122,12 @@ func (ctrl *controller) toAPIInvoice(inv *model.Invoice) APIInvoice {
 		IssuedAt:         inv.IssuedAt,
 		PaidAt:           inv.PaidAt,
 		VoidedAt:         inv.VoidedAt,
+		ZugferdProfile:   string(inv.ZugferdProfile),
+		SkontoPercent:    skonto,
+		SkontoDays:       inv.SkontoDays,
+		PaymentReference: inv.PaymentReference,
+		PriceDecimals:    inv.PriceDecimals,
+		RoundingMode:     string(inv.RoundingMode),
 		CreatedAt:        inv.CreatedAt,
 		UpdatedAt:        inv.UpdatedAt,
 		InvoicePositions: positions,
@@ -181,6 +205,7 @@ func (ctrl *controller) toAPINote(n *model.Note) APINote {
 		Body:       n.Body,
 		Tags:       n.Tags,
 		EditedAt:   n.EditedAt,
+		Pinned:     n.Pinned,
 	}
 }
 
@@ -300,6 +325,29 @@ func (ctrl *controller) toAPISettings(s *model.Settings) APISettings {
 		CustomerNumberPrefix:  s.CustomerNumberPrefix,
 		CustomerNumberWidth:   s.CustomerNumberWidth,
 		CustomerNumberCounter: s.CustomerNumberCounter,
+
+		InvoicePhone:               s.InvoicePhone,
+		PDFEngine:                  s.PDFEngine,
+		ReminderFee:                s.ReminderFee.String(),
+		RoundingMode:               s.RoundingMode,
+		DefaultPaymentTermDays:     s.DefaultPaymentTermDays,
+		Locale:                     s.Locale,
+		PaymentReferenceTemplate:   s.PaymentReferenceTemplate,
+		CustomerNumberMode:         s.CustomerNumberMode,
+		BaseCurrency:               s.BaseCurrency,
+		PriceDecimals:              s.PriceDecimals,
+		DeliveryNoteNumberTemplate: s.DeliveryNoteNumberTemplate,
+		DeliveryNoteCounter:        s.DeliveryNoteCounter,
+		InvoiceFilenameTemplate:    s.InvoiceFilenameTemplate,
+		DatevConsultantNumber:      s.DatevConsultantNumber,
+		DatevClientNumber:          s.DatevClientNumber,
+		DatevAccountLength:         s.DatevAccountLength,
+		DatevDebtorAccount:         s.DatevDebtorAccount,
+		DatevAccounts:              s.DatevAccounts,
+		TaxNoteAEDE:                s.TaxNoteAEDE,
+		TaxNoteAEEN:                s.TaxNoteAEEN,
+		TaxNoteKDE:                 s.TaxNoteKDE,
+		TaxNoteKEN:                 s.TaxNoteKEN,
 	}
 }
 
@@ -572,3 +620,102 @@ func (ctrl *controller) exportInvoiceFiles(zw *zip.Writer, ownerID uint) error {
 
 	return nil
 }
+
+// companyDataExport handles GET /company/:id/export. It sends a ZIP with all
+// data of one company, e.g. for a GDPR request: the company with its contact
+// infos and notes (customers.xml), its contacts (persons.xml), its invoices
+// (invoices.xml) and their PDF and XML files. The layout follows the full
+// export of the settings page, limited to that company.
+func (ctrl *controller) companyDataExport(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	ctx := c.Request().Context()
+	companyID, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "invalid company ID")
+	}
+
+	// Load everything before the response starts, so that errors still
+	// get a proper status code.
+	company, err := ctrl.model.LoadCompanyForExportCtx(ctx, companyID, ownerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Kann Firma nicht laden")
+	}
+	persons, err := ctrl.model.ListCompanyPersonsForExportCtx(ctx, companyID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Kontakte nicht laden")
+	}
+	invs, err := ctrl.model.ListCompanyInvoicesForExport(companyID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Rechnungen nicht laden")
+	}
+
+	customers := ExportCustomers{Version: "1", Customers: []APICustomer{ctrl.toAPICustomer(company)}}
+	people := ExportPersons{Version: "1", Persons: make([]APIPerson, 0, len(persons))}
+	for i := range persons {
+		people.Persons = append(people.Persons, ctrl.toAPIPerson(&persons[i]))
+	}
+	invoices := ExportInvoices{Version: "1", Invoices: make([]APIInvoice, 0, len(invs))}
+	for i := range invs {
+		invs[i].RecomputeTaxAmounts()
+		invoices.Invoices = append(invoices.Invoices, ctrl.toAPIInvoice(&invs[i]))
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(
+		echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="billingcat-kunde-%d.zip"`, company.ID),
+	)
+	res.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(res)
+	defer zw.Close()
+
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"customers.xml", customers},
+		{"persons.xml", people},
+		{"invoices.xml", invoices},
+	} {
+		if err := writeZipXML(zw, f.name, f.v); err != nil {
+			c.Logger().Errorf("company export: %v", err)
+			return err
+		}
+	}
+
+	// Only the files of the company's invoices, never a directory listing.
+	baseDir := filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", ownerID))
+	for _, inv := range invs {
+		for _, ext := range []string{"pdf", "xml"} {
+			name := fmt.Sprintf("%d.%s", inv.ID, ext)
+			zipPath := filepath.ToSlash(filepath.Join("invoices", ext, name))
+			if err := ctrl.addFileToZip(zw, filepath.Join(baseDir, name), zipPath); err != nil {
+				c.Logger().Errorf("company export: add %s: %v", name, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeZipXML writes v as indented XML to a new file name in the ZIP.
+func writeZipXML(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot create %s in ZIP: %w", name, err)
+	}
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("cannot encode %s: %w", name, err)
+	}
+	if err := enc.Flush(); err != nil {
+		return fmt.Errorf("cannot flush %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+// exportLocale describes how CSV and XLSX exports are formatted for one of the
+// locales in model.Settings.Locale.
+type exportLocale struct {
+	english    bool   // header and status language
+	comma      rune   // CSV delimiter
+	decimalSep string // decimal separator for amounts in CSV
+	dateLayout string // Go time layout for dates in CSV
+	bom        bool   // write a UTF-8 BOM (needed by German Excel to detect UTF-8)
+}
+
+// exportLocaleFor returns the export format for a locale string. Unknown
+// locales get the German format.
+func exportLocaleFor(locale string) exportLocale {
+	if model.NormalizeLocale(locale) == model.LocaleEN {
+		return exportLocale{english: true, comma: ',', decimalSep: ".", dateLayout: "01/02/2006"}
+	}
+	return exportLocale{comma: ';', decimalSep: ",", dateLayout: "02.01.2006", bom: true}
+}
+
+// ownerExportLocale loads the export locale from the owner's settings.
+func (ctrl *controller) ownerExportLocale(ownerID uint) exportLocale {
+	settings, err := ctrl.model.LoadSettings(ownerID)
+	if err != nil {
+		return exportLocaleFor(model.LocaleDE)
+	}
+	return exportLocaleFor(settings.Locale)
+}
+
+// text picks the German or the English variant.
+func (l exportLocale) text(de, en string) string {
+	if l.english {
+		return en
+	}
+	return de
+}
+
+func (l exportLocale) amount(d decimal.Decimal) string {
+	return strings.Replace(d.StringFixed(2), ".", l.decimalSep, 1)
+}
+
+func (l exportLocale) date(t time.Time) string {
+	return t.Format(l.dateLayout)
+}
+
+// invoiceStatus is the status label of an invoice list row, like
+// invoiceListStatusDE but in the export language.
+func (l exportLocale) invoiceStatus(inv *model.Invoice) string {
+	if !l.english {
+		return invoiceListStatusDE(inv)
+	}
+	var status string
+	switch inv.Status {
+	case model.InvoiceStatusDraft:
+		status = "Draft"
+	case model.InvoiceStatusIssued:
+		status = "Issued"
+	case model.InvoiceStatusPaid:
+		status = "Paid"
+	case model.InvoiceStatusVoided:
+		status = "Voided"
+	default:
+		status = string(inv.Status)
+	}
+	if inv.IsCreditNote() {
+		return "Credit note (" + status + ")"
+	}
+	return status
+}
+
+// currencySymbol returns the symbol used in XLSX number formats for an
+// ISO 4217 code; codes without a common symbol are returned unchanged.
+func currencySymbol(code string) string {
+	switch strings.ToUpper(code) {
+	case "", "EUR":
+		return "€"
+	case "USD":
+		return "$"
+	case "GBP":
+		return "£"
+	case "JPY":
+		return "¥"
+	default:
+		return strings.ToUpper(code)
+	}
+}
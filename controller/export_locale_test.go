@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteCSVDownloadLocale(t *testing.T) {
+	date := time.Date(2025, time.December, 31, 0, 0, 0, 0, time.UTC)
+	amount := decimal.RequireFromString("1234.5")
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"de-DE", "\xef\xbb\xbfDatum;Betrag\n31.12.2025;1234,50\n"},
+		{"en-US", "Date,Amount\n12/31/2025,1234.50\n"},
+		{"", "\xef\xbb\xbfDatum;Betrag\n31.12.2025;1234,50\n"}, // unknown -> German
+	}
+	for _, tt := range tests {
+		loc := exportLocaleFor(tt.locale)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+		header := []string{loc.text("Datum", "Date"), loc.text("Betrag", "Amount")}
+		rows := [][]string{{loc.date(date), loc.amount(amount)}}
+		if err := writeCSVDownload(c, loc, "test.csv", header, rows); err != nil {
+			t.Fatalf("%q: writeCSVDownload failed: %v", tt.locale, err)
+		}
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
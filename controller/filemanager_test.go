@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/labstack/echo/v4"
+)
+
+func TestFilemanagerUpload_Types(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	store.Config.Basedir = t.TempDir()
+	ctrl := &controller{model: store}
+	dir := filepath.Join(store.Config.Basedir, "assets", "userassets", fmt.Sprintf("owner%d", fixtures.DefaultOwnerID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	exe := []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00")
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		status  int // 0 = accepted
+	}{
+		{"tool.exe", exe, http.StatusUnsupportedMediaType},
+		{"briefbogen.pdf", exe, http.StatusUnsupportedMediaType}, // renamed executable
+		{"invoice.css", []byte("body { color: red }"), 0},
+		{"briefbogen.pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			fw, err := mw.CreateFormFile("files", tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(tc.content)
+			mw.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/filemanager/upload", &body)
+			req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.Set("ownerid", fixtures.DefaultOwnerID)
+
+			err = ctrl.filemanagerUploadHandler(c)
+			_, statErr := os.Stat(filepath.Join(dir, tc.name))
+			if tc.status == 0 {
+				if err != nil || rec.Code != http.StatusSeeOther {
+					t.Fatalf("upload: err = %v, status %d, want redirect", err, rec.Code)
+				}
+				if statErr != nil {
+					t.Errorf("file not stored: %v", statErr)
+				}
+				return
+			}
+			var he *echo.HTTPError
+			if !errors.As(err, &he) || he.Code != tc.status {
+				t.Fatalf("upload: err = %v, want %d", err, tc.status)
+			}
+			if statErr == nil {
+				t.Errorf("rejected file was stored")
+			}
+		})
+	}
+}
+
+func TestFilemanager_PathTraversal(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	store.Config.Basedir = t.TempDir()
+	ctrl := &controller{model: store}
+	secret := filepath.Join(store.Config.Basedir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{"../../../secret.txt", "a/../../../../secret.txt", "/etc/passwd"} {
+		e := echo.New()
+		var he *echo.HTTPError
+		if !strings.HasPrefix(rel, "/") { // the download route strips the leading slash
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/filemanager/download/x", nil), httptest.NewRecorder())
+			c.SetParamNames("*")
+			c.SetParamValues(rel)
+			c.Set("ownerid", fixtures.DefaultOwnerID)
+			if err := ctrl.filemanagerDownloadHandler(c); !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+				t.Errorf("download %q: err = %v, want 400", rel, err)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/filemanager/delete", strings.NewReader(url.Values{"path": {rel}}.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("ownerid", fixtures.DefaultOwnerID)
+		if err := ctrl.filemanagerDeleteHandler(c); !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+			t.Errorf("delete %q: err = %v, want 400", rel, err)
+		}
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("file outside the assets was touched: %v", err)
+	}
+}
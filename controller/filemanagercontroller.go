@@ -4,20 +4,23 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 func (ctrl *controller) fileManagerInit(e *echo.Echo) {
 	g := e.Group("/filemanager")
 	g.Use(ctrl.authMiddleware)
 	g.GET("", ctrl.filemanagerList)
-	g.POST("/upload", ctrl.filemanagerUploadHandler)
+	g.POST("/upload", ctrl.filemanagerUploadHandler, middleware.BodyLimit(bodyLimitFileManager))
 	g.POST("/delete", ctrl.filemanagerDeleteHandler)
 	g.GET("/download/*", ctrl.filemanagerDownloadHandler) // z.B. /download/foo.txt
 
@@ -25,6 +28,15 @@ func (ctrl *controller) fileManagerInit(e *echo.Echo) {
 
 const maxQuota = 5 * 1024 * 1024 // 5 MB
 
+// Request body limits of the upload routes. The global BodyLimit set in
+// NewController applies to all other requests. The limits leave room for the
+// multipart overhead on top of the sizes checked in the handlers.
+const (
+	bodyLimitFileManager = "6M"  // maxQuota
+	bodyLimitAttachment  = "11M" // model.MaxInvoiceAttachmentsSize
+	bodyLimitImport      = "5M"  // CSV and XML position lists
+)
+
 type FileRow struct {
 	Name      string
 	Size      int64
@@ -66,19 +78,16 @@ func humanSize(bytes int64) string {
 		float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// safeJoin ensures that path is INSIDE baseDir (prevents path traversal).
+// safeJoin returns the path of name inside base, see model.SafeRelPath.
+// Unsafe names yield a 400 error.
 func safeJoin(base, name string) (string, error) {
-	clean := filepath.Clean("/" + name) // neutralizes sequences like "../"
-	rel := strings.TrimPrefix(clean, "/")
-	full := filepath.Join(base, rel)
-	// Ensure that full is under base:
-	baseAbs, _ := filepath.Abs(base)
-	fullAbs, _ := filepath.Abs(full)
-	if !strings.HasPrefix(fullAbs, baseAbs+string(os.PathSeparator)) && fullAbs != baseAbs {
+	full, err := model.SafeRelPath(base, name)
+	if err != nil {
 		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid path")
 	}
 	return full, nil
 }
+
 func (ctrl *controller) filemanagerList(c echo.Context) error {
 	m := ctrl.defaultResponseMap(c, "Dateimanager")
 	m["action"] = "/filemanager"
@@ -113,6 +122,7 @@ func (ctrl *controller) filemanagerList(c echo.Context) error {
 
 	m["Files"] = rows
 	m["CurrDir"] = dirPath
+	m["accept"] = model.UserAssetExtensions()
 
 	return c.Render(http.StatusOK, "filemanager.html", m)
 }
@@ -145,6 +155,13 @@ func (ctrl *controller) filemanagerUploadHandler(c echo.Context) error {
 				float64(used)/1024/1024, float64(maxQuota)/1024/1024))
 	}
 
+	// Check all files before the first one is written.
+	for _, fh := range files {
+		if err := checkUserAssetUpload(fh); err != nil {
+			return err
+		}
+	}
+
 	for _, fh := range files {
 		// Harden filename
 		filename := filepath.Base(fh.Filename)
@@ -176,6 +193,23 @@ func (ctrl *controller) filemanagerUploadHandler(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, "/filemanager")
 }
 
+// checkUserAssetUpload rejects uploads to the file manager whose extension or
+// content is not allowed by model.UserAssetTypes.
+func checkUserAssetUpload(fh *multipart.FileHeader) error {
+	src, err := fh.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	if err := model.CheckUserAssetType(filepath.Base(fh.Filename), head[:n]); err != nil {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Dateityp von %q nicht erlaubt. Erlaubt sind: %s", filepath.Base(fh.Filename), model.UserAssetExtensions()))
+	}
+	return nil
+}
+
 func (ctrl *controller) filemanagerDeleteHandler(c echo.Context) error {
 	path := c.FormValue("path") // relative path from UI
 	baseDir := filepath.Join(ctrl.model.Config.Basedir, "assets", "userassets", fmt.Sprintf("owner%d", c.Get("ownerid")))
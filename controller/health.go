@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readyTimeout bounds the database check of /readyz.
+const readyTimeout = 2 * time.Second
+
+// healthInit registers the probes for container orchestration and the
+// metrics. They need no login, get no session cookie and are left out of the
+// access log.
+func (ctrl *controller) healthInit(e *echo.Echo) {
+	e.GET("/healthz", ctrl.healthz)
+	e.GET("/readyz", ctrl.readyz)
+	e.GET("/metrics", ctrl.metrics)
+}
+
+// isProbe reports whether path is one of the endpoints registered by
+// healthInit.
+func isProbe(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/metrics"
+}
+
+// GET /healthz
+// Reports that the process is up. It does not touch the database.
+func (ctrl *controller) healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
+
+// GET /readyz
+// Reports whether the database is reachable. It answers 503 if not.
+func (ctrl *controller) readyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readyTimeout)
+	defer cancel()
+	if err := ctrl.model.Ping(ctx); err != nil {
+		if logger, ok := c.Get("logger").(*slog.Logger); ok {
+			logger.Error("readiness check failed", "error", err)
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"status": "unavailable", "error": "database unreachable"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
+
+// GET /metrics
+// Reports the state of the render queue in the Prometheus text format. The
+// numbers cover all owners; nothing owner specific is exposed.
+func (ctrl *controller) metrics(c echo.Context) error {
+	st := ctrl.model.RenderQueueStats()
+	var b strings.Builder
+	writeMetric(&b, "billingcat_render_queue_depth", "gauge", "Invoice render jobs waiting for a worker.", int64(st.Queued))
+	writeMetric(&b, "billingcat_render_jobs_running", "gauge", "Invoice render jobs being rendered or waiting for a retry.", st.Running)
+	writeMetric(&b, "billingcat_render_jobs_failed_total", "counter", "Invoice render jobs given up after all retries.", st.Failed)
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// writeMetric writes one metric with its HELP and TYPE lines to b.
+func writeMetric(b *strings.Builder, name, kind, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
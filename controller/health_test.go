@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestReadyz(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		store  *model.Store
+		before func()
+		status int
+	}{
+		{"reachable", fixtures.NewTestStore(t), func() {}, http.StatusOK},
+		{"closed", model.NewStoreFromDB(db, nil), func() { sqlDB.Close() }, http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.before()
+			ctrl := &controller{model: tc.store}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+			if err := ctrl.readyz(c); err != nil {
+				t.Fatalf("readyz error: %v", err)
+			}
+			if rec.Code != tc.status {
+				t.Errorf("status = %d, want %d", rec.Code, tc.status)
+			}
+			if !strings.Contains(rec.Header().Get(echo.HeaderContentType), "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", rec.Header().Get(echo.HeaderContentType))
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctrl := &controller{model: fixtures.NewTestStore(t)}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/metrics", nil), rec)
+	if err := ctrl.metrics(c); err != nil {
+		t.Fatalf("metrics error: %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE billingcat_render_queue_depth gauge\nbillingcat_render_queue_depth 0\n",
+		"billingcat_render_jobs_failed_total 0\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("body misses %q:\n%s", want, rec.Body.String())
+		}
+	}
+}
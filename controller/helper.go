@@ -1,40 +1,77 @@
 package controller
 
 import (
+	"encoding/base64"
 	"fmt"
 
 	"github.com/mailjet/mailjet-apiv3-go"
 )
 
+// emailAttachment is a file sent along with an email.
+type emailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
 func (ctrl *controller) sendEmail(to string, subject string, body string) error {
-	// when in production, send real email, else just log to console
-	if ctrl.model.Config.Mode == "production" {
-		return ctrl.sendRealEmail(to, subject, body)
+	return ctrl.sendEmailWithAttachments(to, "", subject, body)
+}
+
+// sendEmailWithAttachments sends an email with optional attachments. A
+// non-empty replyTo sets the Reply-To header, so customers answering an
+// invoice mail reach the owner instead of the app address. The transport is
+// chosen by mailTransport; without SMTP server and outside production the
+// mail is only logged to the console.
+func (ctrl *controller) sendEmailWithAttachments(to, replyTo, subject, body string, attachments ...emailAttachment) error {
+	switch ctrl.mailTransport() {
+	case "smtp":
+		if err := ctrl.sendSMTPEmail(to, replyTo, subject, body, attachments); err != nil {
+			return ErrInvalid(err, "Fehler beim Senden der E-Mail")
+		}
+		return nil
+	case "mailjet":
+		return ctrl.sendRealEmail(to, replyTo, subject, body, attachments)
 	}
 	fmt.Println("Sending email to", to, "with subject", subject, "and body", body)
+	for _, a := range attachments {
+		fmt.Println("  attachment", a.Filename, a.ContentType, len(a.Data), "bytes")
+	}
 	return nil
 }
 
-func (ctrl *controller) sendRealEmail(to string, subject string, body string) error {
+func (ctrl *controller) sendRealEmail(to, replyTo, subject, body string, attachments []emailAttachment) error {
 	mj := mailjet.NewMailjetClient(ctrl.model.Config.MailAPIKey, ctrl.model.Config.MailSecret)
 
-	messagesInfo := []mailjet.InfoMessagesV31{
-		{
-			From: &mailjet.RecipientV31{
-				Email: "app@billingcat.de",
-				Name:  "billingcat app",
-			},
-			To: &mailjet.RecipientsV31{
-				mailjet.RecipientV31{
-					Email: to,
-				},
+	msg := mailjet.InfoMessagesV31{
+		From: &mailjet.RecipientV31{
+			Email: "app@billingcat.de",
+			Name:  "billingcat app",
+		},
+		To: &mailjet.RecipientsV31{
+			mailjet.RecipientV31{
+				Email: to,
 			},
-			Subject:  subject,
-			TextPart: body,
 		},
+		Subject:  subject,
+		TextPart: body,
+	}
+	if replyTo != "" {
+		msg.ReplyTo = &mailjet.RecipientV31{Email: replyTo}
+	}
+	if len(attachments) > 0 {
+		atts := make(mailjet.AttachmentsV31, 0, len(attachments))
+		for _, a := range attachments {
+			atts = append(atts, mailjet.AttachmentV31{
+				ContentType:   a.ContentType,
+				Filename:      a.Filename,
+				Base64Content: base64.StdEncoding.EncodeToString(a.Data),
+			})
+		}
+		msg.Attachments = &atts
 	}
 
-	messages := mailjet.MessagesV31{Info: messagesInfo}
+	messages := mailjet.MessagesV31{Info: []mailjet.InfoMessagesV31{msg}}
 	if _, err := mj.SendMailV31(&messages); err != nil {
 		return ErrInvalid(err, "Fehler beim Senden der E-Mail")
 	}
@@ -285,11 +285,9 @@ func charsetReader(charset string, input io.Reader) (io.Reader, error) {
 // It parses CSV or XML via importpositions.ParsePositions and returns
 // the normalized JSON structure ({version:1, positions:[...]}).
 func (ctrl *controller) importPositionsAPI(c echo.Context) error {
-	// Optional: Limit the size early (Echo also allows global BodyLimit middleware)
-	// c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, 25<<20)
-
-	// Parse form (Echo does this lazily, but FormFile needs it ready)
-	if err := c.Request().ParseMultipartForm(25 << 20); err != nil {
+	// The body size is limited by the route (bodyLimitImport), so the form
+	// can be parsed in memory.
+	if err := c.Request().ParseMultipartForm(5 << 20); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "multipart error: "+err.Error())
 	}
 
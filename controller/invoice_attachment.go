@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// invoiceAttachmentInit wires the routes for supporting files of an invoice.
+func (ctrl *controller) invoiceAttachmentInit(e *echo.Echo) {
+	g := e.Group("/invoice/attachment")
+	g.Use(ctrl.authMiddleware)
+	g.POST("/:id", ctrl.invoiceAttachmentUpload, middleware.BodyLimit(bodyLimitAttachment))
+	g.GET("/download/:aid", ctrl.invoiceAttachmentDownload)
+	g.POST("/delete/:aid", ctrl.invoiceAttachmentDelete)
+}
+
+// getAttachmentDirForInvoice returns the directory holding the attachments of
+// an invoice, next to the generated XML and PDF files.
+func (ctrl *controller) getAttachmentDirForInvoice(inv *model.Invoice) string {
+	return filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", inv.OwnerID), "attachments", fmt.Sprintf("%d", inv.ID))
+}
+
+// detectAttachmentMIME determines the MIME type from the file content. The
+// client supplied Content-Type is not trusted. CSV files cannot be told apart
+// from plain text by content, so the extension decides for those.
+func detectAttachmentMIME(head []byte, filename string) string {
+	mt, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if mt == "text/plain" && strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return "text/csv"
+	}
+	return mt
+}
+
+// invoiceAttachmentUpload stores an uploaded file (form field "file") with a
+// draft invoice. Issued invoices are immutable, so their attachments are too.
+func (ctrl *controller) invoiceAttachmentUpload(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	inv, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if inv.Status != model.InvoiceStatusDraft {
+		return echo.NewHTTPError(http.StatusForbidden, "attachments can only be changed on drafts")
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Keine Datei hochgeladen")
+	}
+	if fh.Size > model.MaxInvoiceAttachmentsSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Die Datei ist zu groß")
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer src.Close()
+
+	filename := filepath.Base(fh.Filename)
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	mimeType := detectAttachmentMIME(head[:n], filename)
+	if !model.AllowedAttachmentMIMETypes[mimeType] {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Dateityp nicht erlaubt (PDF, PNG, JPEG, TXT, CSV)")
+	}
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	dir := ctrl.getAttachmentDirForInvoice(inv)
+	if err = ensureDir(dir); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für Anhänge")
+	}
+	// Prefix with a timestamp so uploads with the same name do not collide.
+	dstPath, err := safeJoin(dir, fmt.Sprintf("%d-%s", time.Now().UnixNano(), filename))
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	size, err := io.Copy(dst, src)
+	dst.Close()
+	if err != nil {
+		os.Remove(dstPath)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	att := &model.InvoiceAttachment{
+		InvoiceID: inv.ID,
+		OwnerID:   ownerID,
+		Filename:  filename,
+		Path:      dstPath,
+		MIME:      mimeType,
+		Size:      size,
+	}
+	if err = ctrl.model.AddInvoiceAttachment(att); err != nil {
+		os.Remove(dstPath)
+		if errors.Is(err, model.ErrAttachmentTooLarge) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Anhänge dürfen insgesamt höchstens %d MB groß sein", model.MaxInvoiceAttachmentsSize>>20))
+		}
+		if errors.Is(err, model.ErrAttachmentType) {
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Dateityp nicht erlaubt")
+		}
+		return ErrInvalid(err, "Anhang konnte nicht gespeichert werden")
+	}
+
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, inv.ID, "Anhang "+filename)
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", inv.ID))
+}
+
+// invoiceAttachmentDownload serves an attachment under its original name.
+func (ctrl *controller) invoiceAttachmentDownload(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	aid, err := parseUintParam(c, "aid")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid attachment id")
+	}
+	att, err := ctrl.model.LoadInvoiceAttachment(aid, ownerID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Anhang nicht gefunden")
+	}
+	return c.Attachment(att.Path, att.Filename)
+}
+
+// invoiceAttachmentDelete removes an attachment from a draft invoice.
+func (ctrl *controller) invoiceAttachmentDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	aid, err := parseUintParam(c, "aid")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid attachment id")
+	}
+	att, err := ctrl.model.LoadInvoiceAttachment(aid, ownerID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Anhang nicht gefunden")
+	}
+	inv, err := ctrl.model.LoadInvoice(att.InvoiceID, ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if inv.Status != model.InvoiceStatusDraft {
+		return echo.NewHTTPError(http.StatusForbidden, "attachments can only be changed on drafts")
+	}
+	if err = ctrl.model.DeleteInvoiceAttachment(aid, ownerID); err != nil {
+		return ErrInvalid(err, "Anhang konnte nicht gelöscht werden")
+	}
+
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionDelete, model.AuditEntityInvoice, inv.ID, "Anhang "+att.Filename)
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", inv.ID))
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"archive/zip"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPDFExportInvoices caps the number of invoices in one PDF export. Missing
+// PDFs are generated while the ZIP is written, which takes a moment each.
+const maxPDFExportInvoices = 500
+
+// invoiceExportPDF handles GET /invoices/export-pdf. It sends a ZIP with the
+// PDFs of all invoices matching the filters of the invoice list (status,
+// company_id, q, period_field, date_from, date_to), named after the owner's
+// filename template. Missing PDFs are generated first. The ZIP is written to
+// the response file by file and never held in memory as a whole.
+func (ctrl *controller) invoiceExportPDF(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	logger := c.Get("logger").(*slog.Logger)
+
+	_, statuses := invoiceListStatuses(strings.ToLower(c.QueryParam("status")))
+	var companyID *uint
+	if cid := c.QueryParam("company_id"); cid != "" {
+		if v, err := strconv.ParseUint(cid, 10, 64); err == nil {
+			tmp := uint(v)
+			companyID = &tmp
+		}
+	}
+	periodField := strings.ToLower(c.QueryParam("period_field"))
+	if periodField != "due" {
+		periodField = "date"
+	}
+
+	// Select before the response starts, so that errors still get a proper
+	// status code.
+	rows, total, err := ctrl.model.FindInvoices(
+		ownerID,
+		statuses,
+		companyID,
+		strings.TrimSpace(c.QueryParam("q")),
+		periodField,
+		parseListDate(c.QueryParam("date_from")),
+		parseListDate(c.QueryParam("date_to")),
+		nil,
+		maxPDFExportInvoices,
+		0,
+		"date asc, id asc",
+	)
+	if err != nil {
+		return ErrInvalid(err, "Kann Rechnungen nicht laden")
+	}
+	if total > maxPDFExportInvoices {
+		return ErrInvalid(fmt.Errorf("pdf export: %d invoices, limit %d", total, maxPDFExportInvoices),
+			fmt.Sprintf("Zu viele Rechnungen (%d) für einen Export, höchstens %d. Bitte den Zeitraum einschränken.", total, maxPDFExportInvoices))
+	}
+
+	var template string
+	if settings, err := ctrl.model.LoadSettings(ownerID); err == nil {
+		template = settings.InvoiceFilenameTemplate
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(
+		echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="invoices_%s.zip"`, time.Now().Format("2006-01-02")),
+	)
+	res.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(res)
+	defer zw.Close()
+
+	ctx := c.Request().Context()
+	used := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err // client gone, stop generating
+		}
+		inv, err := ctrl.model.LoadInvoiceWithTemplate(row.ID, ownerID)
+		if err != nil {
+			logger.Error("pdf export: load invoice", "invoice_id", row.ID, "error", err)
+			return err
+		}
+		pdfPath, err := ctrl.ensureInvoicePDF(inv, ownerID, false, logger)
+		if err != nil {
+			logger.Error("pdf export: create pdf", "invoice_id", inv.ID, "error", err)
+			return err
+		}
+		name := pdfExportName(model.InvoiceFilename(template, inv, &row.Company), inv.ID, used)
+		if err := ctrl.addFileToZip(zw, pdfPath, name); err != nil {
+			logger.Error("pdf export: add pdf", "invoice_id", inv.ID, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// pdfExportName returns the file name of an invoice's PDF in the export:
+// base (see model.InvoiceFilename) with ".pdf", or with the invoice ID
+// appended if the name is taken already. used records the names handed out
+// so far.
+func pdfExportName(base string, id uint, used map[string]bool) string {
+	name := base + ".pdf"
+	if used[name] {
+		name = fmt.Sprintf("%s-%d.pdf", base, id)
+	}
+	used[name] = true
+	return name
+}
+
+// currentPDFExportURL returns the PDF export URL for the filters of the
+// invoice list at u. Paging and sorting do not apply to the export.
+func currentPDFExportURL(u *url.URL) string {
+	q := u.Query()
+	for _, k := range []string{"format", "page", "page_size", "sort"} {
+		q.Del(k)
+	}
+	return (&url.URL{Path: "/invoices/export-pdf", RawQuery: q.Encode()}).RequestURI()
+}
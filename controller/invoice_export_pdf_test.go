@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+func TestInvoiceExportPDF(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	store.Config.XMLDir = t.TempDir()
+	ctrl := &controller{model: store}
+	owner := fixtures.DefaultOwnerID
+
+	issued := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber("RE/2025/1"),
+		fixtures.WithInvoiceStatus(model.InvoiceStatusIssued))
+	if err := store.SaveInvoice(issued, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	// An existing PDF of an issued invoice is re-used as is.
+	dir := filepath.Join(store.Config.XMLDir, fmt.Sprintf("owner%d", owner))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.pdf", issued.ID)), []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(query string) map[string][]byte {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/invoices/export-pdf?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("ownerid", owner)
+		c.Set("logger", slog.New(slog.NewTextHandler(io.Discard, nil)))
+		if err := ctrl.invoiceExportPDF(c); err != nil {
+			t.Fatalf("invoiceExportPDF(%s) error: %v", query, err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if err != nil {
+			t.Fatalf("response is not a ZIP: %v", err)
+		}
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name], _ = io.ReadAll(rc)
+			rc.Close()
+		}
+		return files
+	}
+
+	files := export("status=issued")
+	if len(files) != 1 || string(files["RE-2025-1.pdf"]) != "cached" {
+		t.Errorf("status=issued: files = %v, want RE-2025-1.pdf with the cached PDF", keys(files))
+	}
+
+	// The draft has no PDF yet, it is generated.
+	files = export("status=draft")
+	name := data.Invoice.Number + ".pdf"
+	if len(files) != 1 || !bytes.HasPrefix(files[name], []byte("%PDF-")) {
+		t.Errorf("status=draft: files = %v, want a generated %s", keys(files), name)
+	}
+}
+
+func TestPDFExportName(t *testing.T) {
+	used := map[string]bool{}
+	for _, tc := range []struct {
+		base string
+		id   uint
+		want string
+	}{
+		{"RE-1", 1, "RE-1.pdf"},
+		{"RE-1", 2, "RE-1-2.pdf"},
+		{"RE-2", 3, "RE-2.pdf"},
+	} {
+		if got := pdfExportName(tc.base, tc.id, used); got != tc.want {
+			t.Errorf("pdfExportName(%q, %d) = %q, want %q", tc.base, tc.id, got, tc.want)
+		}
+	}
+}
+
+func keys(m map[string][]byte) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+// invoicePositionsResponse is the answer of the position endpoints: the
+// positions of the draft and its recomputed totals.
+type invoicePositionsResponse struct {
+	Positions  []positionJSON  `json:"positions"`
+	TaxAmounts []taxAmountJSON `json:"tax_amounts"`
+	NetTotal   decimal.Decimal `json:"net_total"`
+	GrossTotal decimal.Decimal `json:"gross_total"`
+}
+
+type positionJSON struct {
+	Position        int             `json:"position"`
+	Text            string          `json:"text"`
+	Quantity        decimal.Decimal `json:"quantity"`
+	Unit            string          `json:"unit"`
+	NetPrice        decimal.Decimal `json:"net_price"`
+	TaxRate         decimal.Decimal `json:"tax_rate"`
+	DiscountPercent decimal.Decimal `json:"discount_percent"`
+	LineTotal       decimal.Decimal `json:"line_total"`
+}
+
+type taxAmountJSON struct {
+	Rate   decimal.Decimal `json:"rate"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// POST /invoice/:id/position
+// Appends one line (form fields as in the invoice form: menge, einzelpreis,
+// einheit, leistungstext, steuersatz, rabatt, einkaufspreis) to a draft. The
+// cost price is only taken from users who may manage the team.
+func (ctrl *controller) invoicePositionAdd(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "Ungültige Rechnungs-ID")
+	}
+	var ip invoicepos
+	if err := c.Bind(&ip); err != nil {
+		return ErrInvalid(err, "Ungültige Position")
+	}
+	pos, err := parseInvoicePos(ip, ctrl.model.LoadPriceDecimals(ownerID))
+	if err != nil {
+		return ErrInvalid(err, "Ungültige Position")
+	}
+	if !ctrl.canManageTeam(c) {
+		pos.CostPrice = decimal.Zero
+	}
+	n, err := ctrl.model.AsUser(uid).AddInvoicePosition(id, ownerID, pos)
+	if err != nil {
+		return invoicePositionError(err)
+	}
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, id, fmt.Sprintf("Position %d hinzugefügt", n))
+	return ctrl.invoicePositionsResult(c, id, ownerID)
+}
+
+// DELETE /invoice/:id/position/:pos
+// Removes the line with the position number pos from a draft. The following
+// lines move up one position.
+func (ctrl *controller) invoicePositionDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "Ungültige Rechnungs-ID")
+	}
+	pos, err := strconv.Atoi(c.Param("pos"))
+	if err != nil {
+		return ErrInvalid(err, "Ungültige Position")
+	}
+	if err := ctrl.model.AsUser(uid).DeleteInvoicePosition(id, ownerID, pos); err != nil {
+		return invoicePositionError(err)
+	}
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, id, fmt.Sprintf("Position %d gelöscht", pos))
+	return ctrl.invoicePositionsResult(c, id, ownerID)
+}
+
+// invoicePositionsResult answers a position change: AJAX requests get the
+// positions and totals as JSON, others are sent back to the edit form.
+func (ctrl *controller) invoicePositionsResult(c echo.Context, id, ownerID uint) error {
+	if c.Request().Header.Get("HX-Request") == "" && c.Request().Header.Get("X-Requested-With") != "XMLHttpRequest" {
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/edit/%d", id))
+	}
+	inv, err := ctrl.model.LoadInvoice(id, ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	resp := invoicePositionsResponse{
+		Positions:  make([]positionJSON, 0, len(inv.InvoicePositions)),
+		TaxAmounts: make([]taxAmountJSON, 0, len(inv.TaxAmounts)),
+		NetTotal:   inv.NetTotal,
+		GrossTotal: inv.GrossTotal,
+	}
+	for _, p := range inv.InvoicePositions {
+		resp.Positions = append(resp.Positions, positionJSON{
+			Position:        p.Position,
+			Text:            p.Text,
+			Quantity:        p.Quantity,
+			Unit:            p.UnitCode,
+			NetPrice:        p.NetPrice,
+			TaxRate:         p.TaxRate,
+			DiscountPercent: p.DiscountPercent,
+			LineTotal:       p.LineTotal,
+		})
+	}
+	for _, t := range inv.TaxAmounts {
+		resp.TaxAmounts = append(resp.TaxAmounts, taxAmountJSON{Rate: t.Rate, Amount: t.Amount})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// invoicePositionError maps the errors of the position changes to responses.
+// Issued invoices are refused like in invoiceEdit.
+func invoicePositionError(err error) error {
+	switch {
+	case errors.Is(err, model.ErrInvoiceNotDraft):
+		return echo.NewHTTPError(http.StatusForbidden, "invoice is not editable after issuing")
+	case errors.Is(err, model.ErrInvoiceNotFound), errors.Is(err, model.ErrInvoicePositionNotFound):
+		return ErrNotFound(err)
+	}
+	return ErrInvalid(err, "Kann Position nicht speichern")
+}
@@ -1,34 +1,28 @@
 package controller
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/billingcat/crm/model"
 	"github.com/xuri/excelize/v2"
 
 	"github.com/go-playground/form/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/shopspring/decimal"
 )
 
 var (
-	commaperiod            = strings.NewReplacer(",", ".")
-	customerNumberReplacer = regexp.MustCompile(`%CN%`)
-	counterReplacer        = regexp.MustCompile(`%(0?)(\d*)C%`)
-	year4Replacer          = regexp.MustCompile(`%YYYY%`)
-	year2Replacer          = regexp.MustCompile(`%YY%`)
+	commaperiod = strings.NewReplacer(",", ".")
 )
 
 // invoiceInit wires all invoice routes.
@@ -41,26 +35,44 @@ func (ctrl *controller) invoiceInit(e *echo.Echo) {
 	g.POST("/new", ctrl.invoiceNew)
 	g.GET("/detail/:id", ctrl.invoiceDetail)
 	g.DELETE("/delete/:id", ctrl.invoiceDelete)
+	g.POST("/restore/:id", ctrl.invoiceRestore)
 	g.GET("/duplicate/:id", ctrl.invoiceDuplicate)
+	g.GET("/creditnote/:id", ctrl.invoiceCreditNote)
 	g.GET("/edit/:id", ctrl.invoiceEdit)
 	g.POST("/edit/:id", ctrl.invoiceEdit)
-	g.GET("/zugferd/validate/:id", ctrl.invoiceZUGFeRDValidateRedirect)
+	g.POST("/zugferd/validate/:id", ctrl.invoiceZUGFeRDValidateRedirect)
 	g.GET("/zugferdxml/:id", ctrl.invoiceZUGFeRDXML)
 	g.GET("/zugferdpdf/:id", ctrl.invoiceZUGFeRDPDF)
+	g.GET("/preview/:id", ctrl.invoicePreviewPDF)
+	g.GET("/xrechnung/:id", ctrl.invoiceXRechnung)
+	g.POST("/reminder/:id", ctrl.invoiceReminderCreate)
+	g.GET("/reminder/:id", ctrl.invoiceReminderPDF)
+	g.POST("/render/:id", ctrl.invoiceRenderRetry)
+	g.POST("/deliverynote/:id", ctrl.invoiceDeliveryNoteCreate)
+	g.GET("/deliverynote/:id/:note", ctrl.invoiceDeliveryNotePDF)
+	g.POST("/send/:id", ctrl.invoiceSend)
 	g.POST("/status/:id", ctrl.invoiceStatusChange)
-	g.POST("/import-positions", ctrl.importPositionsAPI)
+	g.POST("/payment/:id", ctrl.invoicePaymentAdd)
+	g.POST("/import-positions", ctrl.importPositionsAPI, middleware.BodyLimit(bodyLimitImport))
+	g.POST("/:id/position", ctrl.invoicePositionAdd)
+	g.DELETE("/:id/position/:pos", ctrl.invoicePositionDelete)
 	lg := e.Group("/invoices", ctrl.authMiddleware)
 	lg.GET("", ctrl.invoiceList)
+	lg.GET("/trash", ctrl.invoiceTrash)
+	lg.POST("/bulk-status", ctrl.invoiceBulkStatus)
+	lg.GET("/export-pdf", ctrl.invoiceExportPDF)
 }
 
 // invoicepos has one invoice line
 type invoicepos struct {
 	Menge         string `form:"menge"`
 	Einzelpreis   string `form:"einzelpreis"`
-	Gesamtpreis   string `form:"gesamtpreis"`
 	Einheit       string `form:"einheit"`
 	Leistungstext string `form:"leistungstext"`
 	Steuersatz    string `form:"steuersatz"`
+	Rabatt        string `form:"rabatt"`
+	Einkaufspreis string `form:"einkaufspreis"` // optional cost per unit
+	PosID         uint   `form:"posid"`         // stored position the line was loaded from, 0 for new lines
 }
 
 type invoice struct {
@@ -71,7 +83,9 @@ type invoice struct {
 	Counter                uint         `form:"counter"`
 	Currency               string       `form:"currency"`
 	Date                   time.Time    `form:"date"`
+	DocumentType           string       `form:"documenttype"`
 	DueDate                time.Time    `form:"duedate"`
+	ExchangeRate           string       `form:"exchangerate"`
 	Empfaenger             string       `form:"empfaenger"`
 	Fusszeile              string       `form:"fusszeile"`
 	InvoiceExemptionReason string       `form:"invoiceexemptionreason"`
@@ -80,12 +94,22 @@ type invoice struct {
 	Invoicepos             []invoicepos `form:"invoicepos"`
 	Leistungsdatum         time.Time    `form:"occurrencedate"`
 	OrderNumber            string       `form:"ordernumber"`
+	ReferencedInvoice      string       `form:"referencedinvoice"`
+	SkontoDays             string       `form:"skontodays"`
+	SkontoPercent          string       `form:"skontopercent"`
 	SupplierNumber         string       `form:"suppliernumber"`
 	Taxtype                string       `form:"taxtype"`
 	VATID                  string       `form:"ustid"`
+	ZugferdProfile         string       `form:"zugferdprofile"`
 }
 
-func bindInvoice(c echo.Context) (*model.Invoice, error) {
+// bindInvoice reads the invoice form. Unit prices are rounded to
+// priceDecimals and the line totals are computed from them, see
+// model.Settings.PriceDecimals. If storedCosts is not nil, the submitted cost
+// prices are ignored and each line gets the cost price of the stored position
+// named by its posid field; this is used for users who may not see cost
+// prices.
+func bindInvoice(c echo.Context, priceDecimals int, storedCosts map[uint]decimal.Decimal) (*model.Invoice, error) {
 	ownerID := c.Get("ownerid").(uint)
 	i := invoice{}
 	dec := form.NewDecoder()
@@ -120,30 +144,48 @@ func bindInvoice(c echo.Context) (*model.Invoice, error) {
 		CompanyID:       i.CompanyID,
 		ExemptionReason: i.InvoiceExemptionReason,
 		OwnerID:         ownerID,
+		DocumentType:    model.DocumentType(i.DocumentType),
+		ZugferdProfile:  model.ZugferdProfile(i.ZugferdProfile),
 	}
 	mi.ID = i.InvoiceID
+	if v := strings.TrimSpace(i.SkontoPercent); v != "" {
+		if mi.SkontoPercent, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			return nil, err
+		}
+	}
+	if v := strings.TrimSpace(i.SkontoDays); v != "" {
+		if mi.SkontoDays, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if mi.SkontoPercent.IsNegative() || mi.SkontoPercent.GreaterThanOrEqual(decimal.NewFromInt(100)) || mi.SkontoDays < 0 {
+		return nil, fmt.Errorf("invalid skonto %s%% / %d days", mi.SkontoPercent, mi.SkontoDays)
+	}
+	// Empty means the invoice is in the base currency.
+	mi.ExchangeRate = decimal.NewFromInt(1)
+	if v := strings.TrimSpace(i.ExchangeRate); v != "" {
+		if mi.ExchangeRate, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			return nil, err
+		}
+		if !mi.ExchangeRate.IsPositive() {
+			return nil, fmt.Errorf("invalid exchange rate %s", mi.ExchangeRate)
+		}
+	}
+	if mi.IsCreditNote() {
+		mi.ReferencedInvoiceNumber = strings.TrimSpace(i.ReferencedInvoice)
+	}
 
 	for _, ip := range i.Invoicepos {
 		if ip.Menge != "0" && ip.Menge != "" {
 			counter++
-			mip := model.InvoicePosition{
-				Position: counter,
-				UnitCode: ip.Einheit,
-				Text:     ip.Leistungstext,
-			}
-			if mip.NetPrice, err = decimal.NewFromString(commaperiod.Replace(ip.Einzelpreis)); err != nil {
-				return nil, err
-			}
-			mip.GrossPrice = mip.NetPrice.Copy()
-			if mip.Quantity, err = decimal.NewFromString(commaperiod.Replace(ip.Menge)); err != nil {
-				return nil, err
-			}
-			if mip.TaxRate, err = decimal.NewFromString(commaperiod.Replace(ip.Steuersatz)); err != nil {
+			mip, err := parseInvoicePos(ip, priceDecimals)
+			if err != nil {
 				return nil, err
 			}
-			if mip.LineTotal, err = decimal.NewFromString(commaperiod.Replace(ip.Gesamtpreis)); err != nil {
-				return nil, err
+			if storedCosts != nil {
+				mip.CostPrice = storedCosts[ip.PosID]
 			}
+			mip.Position = counter
 			mip.OwnerID = ownerID
 			mi.InvoicePositions = append(mi.InvoicePositions, mip)
 		}
@@ -162,33 +204,50 @@ func bindInvoice(c echo.Context) (*model.Invoice, error) {
 	return mi, nil
 }
 
-func formatInvoiceNumber(in string, customernumber string, counter int) string {
-	// Replace customer number
-	in = customerNumberReplacer.ReplaceAllLiteralString(in, customernumber)
-
-	// Replace year placeholders
-	now := time.Now()
-	year := now.Year()
-	in = year4Replacer.ReplaceAllLiteralString(in, fmt.Sprintf("%04d", year))
-	in = year2Replacer.ReplaceAllLiteralString(in, fmt.Sprintf("%02d", year%100))
-
-	// Replace counter (supports %C% and %0nC%)
-	if counterReplacer.MatchString(in) {
-		x := counterReplacer.FindAllStringSubmatch(in, -1)
-		for _, m := range x {
-			var formatted string
-			if m[2] == "" { // no width → just %d
-				formatted = fmt.Sprintf("%d", counter)
-			} else if m[1] == "0" {
-				formatted = fmt.Sprintf("%0"+m[2]+"d", counter)
-			} else {
-				// width given but no leading zero → %d
-				formatted = fmt.Sprintf("%d", counter)
-			}
-			in = counterReplacer.ReplaceAllString(in, formatted)
+// parseInvoicePos reads one line of the invoice form. The unit price is
+// rounded to priceDecimals and the line total is computed from it. Position
+// and owner are left to the caller.
+func parseInvoicePos(ip invoicepos, priceDecimals int) (model.InvoicePosition, error) {
+	var err error
+	mip := model.InvoicePosition{
+		UnitCode: ip.Einheit,
+		Text:     ip.Leistungstext,
+	}
+	if mip.NetPrice, err = decimal.NewFromString(commaperiod.Replace(ip.Einzelpreis)); err != nil {
+		return mip, err
+	}
+	mip.NetPrice = mip.NetPrice.Round(int32(priceDecimals))
+	mip.GrossPrice = mip.NetPrice.Copy()
+	if mip.Quantity, err = decimal.NewFromString(commaperiod.Replace(ip.Menge)); err != nil {
+		return mip, err
+	}
+	if mip.TaxRate, err = decimal.NewFromString(commaperiod.Replace(ip.Steuersatz)); err != nil {
+		return mip, err
+	}
+	if v := strings.TrimSpace(ip.Rabatt); v != "" {
+		if mip.DiscountPercent, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			return mip, err
+		}
+		if mip.DiscountPercent.IsNegative() || mip.DiscountPercent.GreaterThan(decimal.NewFromInt(100)) {
+			return mip, fmt.Errorf("invalid discount %s%%", mip.DiscountPercent)
 		}
 	}
-	return in
+	if v := strings.TrimSpace(ip.Einkaufspreis); v != "" {
+		if mip.CostPrice, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			return mip, err
+		}
+		if mip.CostPrice.IsNegative() {
+			return mip, fmt.Errorf("invalid cost price %s", mip.CostPrice)
+		}
+	}
+	mip.LineTotal = mip.DiscountedLineTotal(priceDecimals)
+	return mip, nil
+}
+
+// formatInvoiceNumber renders the number template for the form. The final
+// number of an invoice is allocated when it is issued.
+func formatInvoiceNumber(in string, customernumber string, counter int, date time.Time) string {
+	return model.FormatInvoiceNumber(in, customernumber, counter, date)
 }
 
 func (ctrl *controller) invoiceNew(c echo.Context) error {
@@ -207,26 +266,42 @@ func (ctrl *controller) invoiceNew(c echo.Context) error {
 		if err != nil {
 			return ErrInvalid(fmt.Errorf("cannot find company with id %v and ownerid %v", companyID, ownerID), "Kann Firma nicht laden")
 		}
+		if company.ArchivedAt != nil {
+			return ErrInvalid(fmt.Errorf("company %d is archived", company.ID), "Die Firma ist archiviert")
+		}
 
-		counter, err := ctrl.model.GetMaxCounter(company.ID, s.UseLocalCounter, ownerID)
+		counter, err := ctrl.model.GetMaxCounter(company.ID, company.UsesLocalCounter(s), ownerID)
 		if err != nil {
 			return ErrInvalid(err, "Fehler beim Laden des Zählers")
 		}
 
+		now := time.Now()
 		inv := model.Invoice{
 			Counter:          counter + 1,
-			Date:             time.Now(),
-			OccurrenceDate:   time.Now(),
-			DueDate:          time.Now().Add(14 * 24 * time.Hour),
+			Date:             now,
+			OccurrenceDate:   now,
+			DueDate:          model.ComputeDueDate(now, company, s),
 			SupplierNumber:   company.SupplierNumber,
 			ContactInvoice:   company.ContactInvoice,
 			Opening:          company.InvoiceOpening,
 			Footer:           company.InvoiceFooter,
 			InvoicePositions: []model.InvoicePosition{{Position: 1, TaxRate: company.DefaultTaxRate}},
-			Number:           formatInvoiceNumber(s.InvoiceNumberTemplate, company.CustomerNumber, int(counter+1)),
+			Number:           formatInvoiceNumber(s.InvoiceNumberTemplate, company.CustomerNumber, int(counter+1), now),
 			ExemptionReason:  company.InvoiceExemptionReason,
 			TaxType:          company.InvoiceTaxType,
 		}
+		// Without a tax category on the company, suggest one from the
+		// countries of seller and buyer. The user can still change it.
+		if inv.TaxType == "" {
+			taxType, rate := model.SuggestTaxTypeAndRate(s.CountryCode, company.Country, company.VATID != "")
+			inv.TaxType = taxType
+			if taxType != "S" || company.DefaultTaxRate.IsZero() {
+				inv.InvoicePositions[0].TaxRate = rate
+			}
+			if taxType == "AE" && inv.ExemptionReason == "" {
+				inv.ExemptionReason = model.TaxCategoryLabel(taxType)
+			}
+		}
 
 		letterheads, err := ctrl.model.ListLetterheadTemplates(ownerID)
 		if err != nil {
@@ -240,8 +315,11 @@ func (ctrl *controller) invoiceNew(c echo.Context) error {
 		}
 
 		m["title"] = "Neue Rechnung anlegen"
+		m["showcost"] = ctrl.canManageTeam(c)
 		m["invoice"] = inv
 		m["company"] = company
+		m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
+		m["pricedecimals"] = ctrl.model.LoadPriceDecimals(ownerID)
 		m["submit"] = "Rechnung erstellen"
 		m["action"] = "/invoice/new"
 		m["cancel"] = fmt.Sprintf("/company/%s", companyID)
@@ -250,29 +328,43 @@ func (ctrl *controller) invoiceNew(c echo.Context) error {
 		return c.Render(http.StatusOK, "invoiceedit.html", m)
 
 	case http.MethodPost:
-		mi, err := bindInvoice(c) // s.u. anpassen
+		var storedCosts map[uint]decimal.Decimal
+		if !ctrl.canManageTeam(c) {
+			storedCosts = map[uint]decimal.Decimal{}
+		}
+		mi, err := bindInvoice(c, ctrl.model.LoadPriceDecimals(ownerID), storedCosts)
 		if err != nil {
 			return ErrInvalid(err, "Fehler beim Verarbeiten der Eingabedaten")
 		}
 
-		if err = ctrl.model.SaveInvoice(mi, ownerID); err != nil {
+		if err = ctrl.model.AsUser(c.Get("uid").(uint)).SaveInvoice(mi, ownerID); err != nil {
 			return ErrInvalid(err, "Fehler beim Speichern der Rechnung")
 		}
 
 		uid := c.Get("uid").(uint)
 		ctrl.model.LogAudit(ownerID, uid, model.AuditActionCreate, model.AuditEntityInvoice, mi.ID, mi.Number)
+		ctrl.revalidateInvoice(mi.ID, ownerID)
 
 		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", mi.ID))
 	}
 	return nil
 }
 
+// invoiceLoadError maps an error from LoadInvoice to the response: 404 for an
+// unknown invoice, 400 for everything else.
+func invoiceLoadError(err error) error {
+	if errors.Is(err, model.ErrInvoiceNotFound) {
+		return ErrNotFound(err)
+	}
+	return ErrInvalid(err, "Kann Rechnung nicht laden")
+}
+
 func (ctrl *controller) invoiceDelete(c echo.Context) error {
 	paramInvoiceID := c.Param("id")
 	ownerID := c.Get("ownerid").(uint)
 	inv, err := ctrl.model.LoadInvoice(paramInvoiceID, ownerID)
 	if err != nil {
-		return ErrInvalid(err, "Kann Rechnung nicht laden")
+		return invoiceLoadError(err)
 	}
 	if inv.Status != model.InvoiceStatusDraft {
 		return echo.NewHTTPError(http.StatusForbidden, "invoice cannot be deleted after issuing")
@@ -281,7 +373,9 @@ func (ctrl *controller) invoiceDelete(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to delete this invoice")
 	}
 	companyid := inv.CompanyID
-	err = ctrl.model.DeleteInvoice(inv, ownerID)
+	// Attachments stay with the invoice in the trash; they are removed when
+	// the trash is purged.
+	err = ctrl.model.AsUser(c.Get("uid").(uint)).DeleteInvoice(inv, ownerID)
 	if err != nil {
 		return ErrInvalid(err, "Kann Rechnung nicht löschen")
 	}
@@ -292,54 +386,32 @@ func (ctrl *controller) invoiceDelete(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/company/%d", companyid))
 }
 
-// putProblemsInSession stores a slice of problems in the session under a
-// namespaced key (per invoiceID). Data is marshaled as JSON so it can be
-// serialized safely into the cookie. Be aware of cookie size limits (~4KB).
-func putProblemsInSession(c echo.Context, invoiceID uint, problems []model.InvoiceProblem) error {
-	sw, err := LoadSession(c)
-	if err != nil {
-		return err
-	}
-	key := fmt.Sprintf("problems:%d", invoiceID)
-
-	b, err := json.Marshal(problems)
+// invoiceTrash lists the deleted invoices that can still be restored.
+func (ctrl *controller) invoiceTrash(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	m := ctrl.defaultResponseMap(c, "Papierkorb")
+	invs, err := ctrl.model.ListDeletedInvoices(ownerID)
 	if err != nil {
-		return err
-	}
-	sw.Values()[key] = string(b)
-
-	if err := sw.Save(); err != nil {
-		return ErrInvalid(err, "error saving session")
+		return ErrInvalid(err, "Kann Papierkorb nicht laden")
 	}
-	return nil
+	m["invoices"] = invs
+	m["retentionDays"] = int(model.InvoiceTrashRetention.Hours() / 24)
+	return c.Render(http.StatusOK, "invoicetrash.html", m)
 }
 
-// popProblemsFromSession retrieves problems for a given invoiceID (if present)
-// and removes the key from the session. The session is saved afterwards with
-// the correct cookie options (so "remember me" stays intact).
-func popProblemsFromSession(c echo.Context, invoiceID uint) (any, bool) {
-	sw, err := LoadSession(c)
+// invoiceRestore takes an invoice out of the trash.
+func (ctrl *controller) invoiceRestore(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+	id, err := parseUintParam(c, "id")
 	if err != nil {
-		return nil, false
-	}
-	key := fmt.Sprintf("problems:%d", invoiceID)
-
-	v, ok := sw.Values()[key]
-	if !ok {
-		return nil, false
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid invoice id")
 	}
-
-	// Delete key and save the session (keeps remember-me settings intact).
-	delete(sw.Values(), key)
-	_ = sw.Save() // error is non-critical for returning the data
-
-	// Try to unmarshal if the stored value is JSON string.
-	if s, ok := v.(string); ok {
-		var out []model.InvoiceProblem
-		_ = json.Unmarshal([]byte(s), &out)
-		return out, true
+	if err = ctrl.model.AsUser(uid).RestoreInvoice(id, ownerID); err != nil {
+		return invoiceLoadError(err)
 	}
-	return v, true
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, id, "Aus dem Papierkorb wiederhergestellt")
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", id))
 }
 
 func (ctrl *controller) buildInvoiceMailtoLink(ownerID uint, i *model.Invoice, cpy *model.Company) string {
@@ -360,7 +432,7 @@ func (ctrl *controller) invoiceDetail(c echo.Context) error {
 	ownerID := c.Get("ownerid").(uint)
 	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
 	if err != nil {
-		return ErrInvalid(err, "Kann Rechnung nicht laden")
+		return invoiceLoadError(err)
 	}
 	var cpy *model.Company
 	if cpy, err = ctrl.model.LoadCompany(i.CompanyID, ownerID); err != nil {
@@ -369,7 +441,38 @@ func (ctrl *controller) invoiceDetail(c echo.Context) error {
 	m["title"] = "Rechnung " + i.Number
 	m["invoice"] = i
 	m["company"] = cpy
+	m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
 	m["mailtoLink"] = ctrl.buildInvoiceMailtoLink(ownerID, i, cpy)
+	// cost and margin are internal, only the account owner sees them
+	if ctrl.canManageTeam(c) {
+		m["cost"] = model.InvoiceCost(i)
+		m["margin"] = model.InvoiceMargin(i)
+	}
+
+	payments, err := ctrl.model.ListPayments(i.ID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Zahlungen nicht laden")
+	}
+	m["payments"] = payments
+	m["outstanding"] = i.GrossTotal.Sub(model.PaymentsTotal(payments))
+
+	attachments, err := ctrl.model.ListInvoiceAttachments(i.ID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Anhänge nicht laden")
+	}
+	m["attachments"] = attachments
+
+	deliveryNotes, err := ctrl.model.ListDeliveryNotes(i.ID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Lieferscheine nicht laden")
+	}
+	m["deliverynotes"] = deliveryNotes
+
+	events, err := ctrl.model.ListInvoiceEvents(i.ID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Verlauf nicht laden")
+	}
+	m["events"] = events
 
 	// --- Letterhead info for view ---
 	type letterheadVM struct {
@@ -401,10 +504,17 @@ func (ctrl *controller) invoiceDetail(c echo.Context) error {
 	}
 
 	m["letterhead"] = lh
-	// NEW: pick up problems from session (set by redirect handler)
-	if v, ok := popProblemsFromSession(c, i.ID); ok {
-		if arr, ok2 := v.([]model.InvoiceProblem); ok2 && len(arr) > 0 {
-			m["Problems"] = arr
+	// Last ZUGFeRD check. It is run again on save, on issue and by "Rechnung
+	// prüfen", not here; a result older than the invoice is marked stale.
+	validation, err := ctrl.model.LoadInvoiceValidation(i, ownerID)
+	if err != nil {
+		c.Get("logger").(*slog.Logger).Error("cannot load validation result", "invoice_id", i.ID, "err", err)
+	}
+	if validation != nil {
+		m["ValidatedAt"] = validation.ValidatedAt
+		m["ValidationStale"] = validation.Stale
+		if problems := validation.Problems(); len(problems) > 0 {
+			m["Problems"] = problems
 		} else {
 			m["ValidationOK"] = true
 		}
@@ -418,7 +528,7 @@ func (ctrl *controller) invoiceDuplicate(c echo.Context) error {
 	ownerID := c.Get("ownerid").(uint)
 	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
 	if err != nil {
-		return ErrInvalid(err, "Kann Rechnung nicht laden")
+		return invoiceLoadError(err)
 	}
 	if i.OwnerID != ownerID {
 		return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to duplicate this invoice")
@@ -428,31 +538,34 @@ func (ctrl *controller) invoiceDuplicate(c echo.Context) error {
 	// Set ID to 0, update date to today, update counter and number
 	i.ID = 0
 	i.Date = time.Now()
-	i.DueDate = time.Now().AddDate(0, 0, 14) // +14 days
 	i.OccurrenceDate = time.Now()
 
 	s, err := ctrl.model.LoadSettings(ownerID)
 	if err != nil {
 		return ErrInvalid(err, "Fehler beim Laden der Einstellungen")
 	}
-	counter, err := ctrl.model.GetMaxCounter(i.CompanyID, s.UseLocalCounter, ownerID)
-	if err != nil {
-		return ErrInvalid(err, "Fehler beim Ermitteln des Zählers")
-	}
-	i.Counter = counter + 1
 	company, err := ctrl.model.LoadCompany(i.CompanyID, ownerID)
 	if err != nil {
 		return ErrInvalid(err, "Kann Firma nicht laden")
 	}
-	i.Number = formatInvoiceNumber(s.InvoiceNumberTemplate, company.CustomerNumber, int(i.Counter))
+	counter, err := ctrl.model.GetMaxCounter(i.CompanyID, company.UsesLocalCounter(s), ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Ermitteln des Zählers")
+	}
+	i.Counter = counter + 1
+	i.Number = formatInvoiceNumber(s.InvoiceNumberTemplate, company.CustomerNumber, int(i.Counter), i.Date)
+	i.DueDate = model.ComputeDueDate(i.Date, company, s)
 	// update all invoice positions: set ID to 0
 	for idx := range i.InvoicePositions {
 		i.InvoicePositions[idx].ID = 0
 	}
 
 	m["title"] = "Neue Rechnung anlegen"
+	m["showcost"] = ctrl.canManageTeam(c)
 	m["invoice"] = i
 	m["company"] = company
+	m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
+	m["pricedecimals"] = ctrl.model.LoadPriceDecimals(ownerID)
 	m["submit"] = "Rechnung erstellen"
 	m["action"] = "/invoice/new"
 	m["cancel"] = fmt.Sprintf("/company/%d", i.CompanyID)
@@ -460,12 +573,75 @@ func (ctrl *controller) invoiceDuplicate(c echo.Context) error {
 	return c.Render(http.StatusOK, "invoiceedit.html", m)
 }
 
+// invoiceCreditNote prefills the invoice form with a credit note (type code
+// 381) for an issued invoice. Quantities and line totals are negated and the
+// original invoice number is kept as reference.
+func (ctrl *controller) invoiceCreditNote(c echo.Context) error {
+	m := ctrl.defaultResponseMap(c, "Gutschrift erstellen")
+	ownerID := c.Get("ownerid").(uint)
+	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if i.IsCreditNote() {
+		return echo.NewHTTPError(http.StatusBadRequest, "a credit note cannot be credited again")
+	}
+	if i.Status != model.InvoiceStatusIssued && i.Status != model.InvoiceStatusPaid {
+		return echo.NewHTTPError(http.StatusForbidden, "credit notes can only be created for issued invoices")
+	}
+
+	s, err := ctrl.model.LoadSettings(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Laden der Einstellungen")
+	}
+	company, err := ctrl.model.LoadCompany(i.CompanyID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Firma nicht laden")
+	}
+	counter, err := ctrl.model.GetMaxCounter(i.CompanyID, company.UsesLocalCounter(s), ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Ermitteln des Zählers")
+	}
+
+	cn := *i
+	cn.ID = 0
+	cn.Status = model.InvoiceStatusDraft
+	cn.IssuedAt, cn.PaidAt, cn.VoidedAt = nil, nil, nil
+	cn.DocumentType = model.DocumentTypeCreditNote
+	cn.ReferencedInvoiceNumber = i.Number
+	cn.Date = time.Now()
+	cn.DueDate = time.Now()
+	cn.SkontoPercent, cn.SkontoDays = decimal.Zero, 0
+	cn.Counter = counter + 1
+	cn.Number = formatInvoiceNumber(s.InvoiceNumberTemplate, company.CustomerNumber, int(cn.Counter), cn.Date)
+	cn.InvoicePositions = make([]model.InvoicePosition, len(i.InvoicePositions))
+	for idx, p := range i.InvoicePositions {
+		p.ID = 0
+		p.Quantity = p.Quantity.Neg()
+		p.LineTotal = p.LineTotal.Neg()
+		cn.InvoicePositions[idx] = p
+	}
+	cn.RecomputeTotals()
+
+	m["title"] = "Gutschrift zu Rechnung " + i.Number
+	m["showcost"] = ctrl.canManageTeam(c)
+	m["invoice"] = cn
+	m["company"] = company
+	m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
+	m["pricedecimals"] = ctrl.model.LoadPriceDecimals(ownerID)
+	m["submit"] = "Gutschrift erstellen"
+	m["action"] = "/invoice/new"
+	m["cancel"] = fmt.Sprintf("/invoice/detail/%d", i.ID)
+
+	return c.Render(http.StatusOK, "invoiceedit.html", m)
+}
+
 func (ctrl *controller) invoiceEdit(c echo.Context) error {
 	m := ctrl.defaultResponseMap(c, "Rechnung bearbeiten")
 	ownerID := c.Get("ownerid").(uint)
 	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
 	if err != nil {
-		return ErrInvalid(err, "Kann Rechnung nicht laden")
+		return invoiceLoadError(err)
 	}
 	if i.Status != model.InvoiceStatusDraft {
 		return echo.NewHTTPError(http.StatusForbidden, "invoice is not editable after issuing")
@@ -487,29 +663,61 @@ func (ctrl *controller) invoiceEdit(c echo.Context) error {
 		m["selectedTemplateID"] = sel
 		m["letterheads"] = letterheads
 		m["title"] = "Rechnung " + i.Number
+		m["showcost"] = ctrl.canManageTeam(c)
 		m["invoice"] = i
 		m["company"] = cpy
+		m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
+		m["pricedecimals"] = ctrl.model.LoadPriceDecimals(ownerID)
 		m["submit"] = "Rechnung speichern"
 		m["action"] = "/invoice/edit/" + c.Param("id")
 		m["cancel"] = "/invoice/detail/" + c.Param("id")
 		return c.Render(http.StatusOK, "invoiceedit.html", m)
 	case http.MethodPost:
-		mi, err := bindInvoice(c)
+		// Cost prices are hidden from users who may not manage the team;
+		// their form keeps the stored ones.
+		var storedCosts map[uint]decimal.Decimal
+		if !ctrl.canManageTeam(c) {
+			storedCosts = make(map[uint]decimal.Decimal, len(i.InvoicePositions))
+			for _, p := range i.InvoicePositions {
+				storedCosts[p.ID] = p.CostPrice
+			}
+		}
+		mi, err := bindInvoice(c, ctrl.model.LoadPriceDecimals(ownerID), storedCosts)
 		if err != nil {
 			return ErrInvalid(err, "Fehler beim Verarbeiten der Eingabedaten")
 		}
-		if err = ctrl.model.UpdateInvoice(mi, ownerID); err != nil {
+		mi.ID = i.ID // the invoice checked above, not the one named in the form
+		if err = ctrl.model.AsUser(c.Get("uid").(uint)).UpdateInvoice(mi, ownerID); err != nil {
+			if errors.Is(err, model.ErrInvoiceNotDraft) {
+				return echo.NewHTTPError(http.StatusForbidden, "invoice is not editable after issuing")
+			}
 			return ErrInvalid(err, "Fehler beim Speichern der Rechnung")
 		}
 
 		uid := c.Get("uid").(uint)
 		ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, mi.ID, mi.Number)
+		ctrl.revalidateInvoice(mi.ID, ownerID)
 
 		return c.Redirect(http.StatusSeeOther, "/invoice/detail/"+c.Param("id"))
 	}
 	return nil
 }
 
+// invoiceDownloadName returns the file name of a download of inv: the
+// owner's filename template (see model.InvoiceFilename) followed by suffix,
+// e.g. ".pdf".
+func (ctrl *controller) invoiceDownloadName(inv *model.Invoice, ownerID uint, suffix string) string {
+	var template string
+	if settings, err := ctrl.model.LoadSettings(ownerID); err == nil {
+		template = settings.InvoiceFilenameTemplate
+	}
+	company, err := ctrl.model.LoadCompany(inv.CompanyID, ownerID)
+	if err != nil {
+		company = nil // the template's company placeholders stay empty
+	}
+	return model.InvoiceFilename(template, inv, company) + suffix
+}
+
 // getXMLPathForInvoice returns the full path where the XML for the invoice is stored
 func (ctrl *controller) getXMLPathForInvoice(inv *model.Invoice) string {
 	ownerXMLPath := filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", inv.OwnerID))
@@ -517,32 +725,56 @@ func (ctrl *controller) getXMLPathForInvoice(inv *model.Invoice) string {
 	return filepath.Join(ownerXMLPath, fmt.Sprintf("%d.xml", inv.ID))
 }
 
-// getPDFPathForInvoice returns the full path where the PDF for the invoice is stored
+// getPDFPathForInvoice returns the full path where the PDF for the invoice is
+// stored. Drafts carry a watermark and are written to a file of their own, so
+// the cached PDF of an issued invoice is never a watermarked draft.
 func (ctrl *controller) getPDFPathForInvoice(inv *model.Invoice) string {
-	return filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", inv.OwnerID), fmt.Sprintf("%d.pdf", inv.ID))
+	if inv.Status == model.InvoiceStatusDraft {
+		return ctrl.invoiceFilePath(inv, "-draft.pdf")
+	}
+	return ctrl.invoiceFilePath(inv, ".pdf")
+}
+
+// getPlainPDFPathForInvoice returns the path of the PDF variant without
+// letterhead, so it does not overwrite the branded PDF.
+func (ctrl *controller) getPlainPDFPathForInvoice(inv *model.Invoice) string {
+	if inv.Status == model.InvoiceStatusDraft {
+		return ctrl.invoiceFilePath(inv, "-plain-draft.pdf")
+	}
+	return ctrl.invoiceFilePath(inv, "-plain.pdf")
+}
+
+// invoiceFilePath returns the path of a generated file of the invoice: the
+// invoice ID followed by suffix in the owner's directory.
+func (ctrl *controller) invoiceFilePath(inv *model.Invoice, suffix string) string {
+	return filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", inv.OwnerID), fmt.Sprintf("%d%s", inv.ID, suffix))
 }
 
-// Validate, stash problems in session, then redirect to /invoice/detail/:id.
-// This yields a clean URL while keeping the messages.
+// getXRechnungPathForInvoice returns the path of the standalone XRechnung file.
+func (ctrl *controller) getXRechnungPathForInvoice(inv *model.Invoice) string {
+	return ctrl.invoiceFilePath(inv, "-xrechnung.xml")
+}
+
+// invoiceZUGFeRDValidateRedirect validates the invoice ("Rechnung prüfen"),
+// which stores the result, and redirects to /invoice/detail/:id where it is
+// shown.
 func (ctrl *controller) invoiceZUGFeRDValidateRedirect(c echo.Context) error {
 	ownerID := c.Get("ownerid").(uint)
-	inv, einvoiceProblems, err := ctrl.model.LoadAndVerifyInvoice(c.Param("id"), ownerID)
+	inv, _, err := ctrl.model.LoadAndVerifyInvoice(c.Param("id"), ownerID)
 	if err != nil {
 		return ErrInvalid(err, "Kann Rechnung nicht validieren")
 	}
+	// 303: GET after POST
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", inv.ID))
+}
 
-	var problems []model.InvoiceProblem
-	for _, v := range einvoiceProblems {
-		problems = append(problems, model.InvoiceProblem{
-			Level:   "error",
-			Message: v.Rule + ": " + v.Text,
-		})
-	}
-	if err := putProblemsInSession(c, inv.ID, problems); err != nil {
-		return ErrInvalid(err, "Fehler beim Speichern der Validierung")
+// revalidateInvoice validates the invoice after it was saved or issued and
+// stores the result shown on the detail page. Errors are logged only: a
+// failed check must not fail the change itself.
+func (ctrl *controller) revalidateInvoice(invoiceID, ownerID uint) {
+	if _, _, err := ctrl.model.LoadAndVerifyInvoice(invoiceID, ownerID); err != nil {
+		slog.Error("invoice validation failed", "invoice_id", invoiceID, "err", err)
 	}
-	// 303: safe redirect after GET
-	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", inv.ID))
 }
 
 // invoiceZUGFeRDXML always generates/serves the XML, regardless of validation results.
@@ -554,11 +786,11 @@ func (ctrl *controller) invoiceZUGFeRDXML(c echo.Context) error {
 	// Load invoice WITHOUT validation – validation lives on /zugferd/validate
 	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
 	if err != nil {
-		return ErrInvalid(err, "Kann Rechnung nicht laden")
+		return invoiceLoadError(err)
 	}
 
 	outPath := ctrl.getXMLPathForInvoice(i)
-	userFilename := fmt.Sprintf("%s.xml", i.Number)
+	userFilename := ctrl.invoiceDownloadName(i, ownerID, ".xml")
 
 	// When not draft, re-use existing file if present
 	if i.Status != model.InvoiceStatusDraft {
@@ -581,6 +813,39 @@ func (ctrl *controller) invoiceZUGFeRDXML(c echo.Context) error {
 	return c.Attachment(outPath, userFilename)
 }
 
+// invoiceXRechnung generates/serves the standalone XRechnung file (CII) with
+// the invoice's buyer reference as Leitweg-ID. Like the ZUGFeRD XML it is
+// served regardless of validation results and re-used for non-drafts.
+func (ctrl *controller) invoiceXRechnung(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	logger := c.Get("logger").(*slog.Logger)
+
+	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+
+	outPath := ctrl.getXRechnungPathForInvoice(i)
+	userFilename := ctrl.invoiceDownloadName(i, ownerID, "-xrechnung.xml")
+
+	if i.Status != model.InvoiceStatusDraft {
+		if _, err = os.Stat(outPath); err == nil {
+			logger.Info("re-using existing xrechnung", "invoice_id", i.ID, "path", outPath)
+			return c.Attachment(outPath, userFilename)
+		}
+		logger.Info("xrechnung not found, re-creating", "invoice_id", i.ID, "path", outPath)
+	}
+
+	if err = ensureDir(filepath.Dir(outPath)); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für die XML-Datei")
+	}
+	if err = ctrl.model.WriteXRechnungXML(i, ownerID, outPath); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen der XRechnung")
+	}
+
+	return c.Attachment(outPath, userFilename)
+}
+
 func ensureDir(dirName string) error {
 	err := os.MkdirAll(dirName, 0755)
 	if err != nil {
@@ -591,7 +856,7 @@ func ensureDir(dirName string) error {
 
 // invoiceZUGFeRDPDF now ALWAYS generates/serves the PDF, regardless of validation results.
 // If the invoice is not a draft and a PDF already exists, it is re-used.
-// It (re)creates the XML first because the PDF builder usually embeds/consumes it.
+// With ?plain=1 the PDF is rendered without letterhead (cached separately).
 func (ctrl *controller) invoiceZUGFeRDPDF(c echo.Context) error {
 	logger := c.Get("logger").(*slog.Logger)
 	ownerid := c.Get("ownerid").(uint)
@@ -599,43 +864,312 @@ func (ctrl *controller) invoiceZUGFeRDPDF(c echo.Context) error {
 	// Load invoice WITHOUT validation – validation lives on /zugferd/validate
 	i, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerid)
 	if err != nil {
-		return ErrInvalid(err, "Kann Rechnung nicht laden")
+		return invoiceLoadError(err)
+	}
+
+	pdfname := ctrl.invoiceDownloadName(i, ownerid, ".pdf")
+	pdfPath, err := ctrl.ensureInvoicePDF(i, ownerid, c.QueryParam("plain") == "1", logger)
+	if err != nil {
+		return err
+	}
+	return c.Attachment(pdfPath, pdfname)
+}
+
+// invoicePreviewPDF serves the same PDF as invoiceZUGFeRDPDF inline, so the
+// browser shows it in a tab instead of offering a download. ?plain=1 works as
+// there.
+func (ctrl *controller) invoicePreviewPDF(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerid := c.Get("ownerid").(uint)
+
+	i, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerid)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	pdfPath, err := ctrl.ensureInvoicePDF(i, ownerid, c.QueryParam("plain") == "1", logger)
+	if err != nil {
+		return err
 	}
+	return c.Inline(pdfPath, ctrl.invoiceDownloadName(i, ownerid, ".pdf"))
+}
 
-	pdfname := fmt.Sprintf("%s.pdf", i.Number)
+// ensureInvoicePDF returns the path of the invoice PDF, (re)creating it when
+// necessary. For non-drafts an existing PDF is re-used. It (re)creates the XML
+// first because the PDF builder usually embeds/consumes it. plain selects the
+// variant without letterhead.
+func (ctrl *controller) ensureInvoicePDF(i *model.Invoice, ownerid uint, plain bool, logger *slog.Logger) (string, error) {
+	pdfPathFor := ctrl.getPDFPathForInvoice
+	if plain {
+		pdfPathFor = ctrl.getPlainPDFPathForInvoice
+	}
 
 	// When not draft, re-use existing file if present
 	if i.Status != model.InvoiceStatusDraft {
-		pdfPath := ctrl.getPDFPathForInvoice(i)
-		if _, err = os.Stat(pdfPath); err == nil {
+		pdfPath := pdfPathFor(i)
+		if _, err := os.Stat(pdfPath); err == nil {
 			logger.Info("re-using existing zugferd pdf", "invoice_id", i.ID, "path", pdfPath)
-			return c.Attachment(pdfPath, pdfname)
+			return pdfPath, nil
 		}
 		logger.Info("zugferd pdf not found, re-creating", "invoice_id", i.ID, "path", pdfPath)
 	}
 
 	// Ensure XML exists/refresh it
 	xmlPath := ctrl.getXMLPathForInvoice(i)
-	if err = ensureDir(filepath.Dir(xmlPath)); err != nil {
-		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für die XML-Datei")
+	if err := ensureDir(filepath.Dir(xmlPath)); err != nil {
+		return "", ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für die XML-Datei")
 	}
-	if err = ctrl.model.WriteZUGFeRDXML(i, ownerid, xmlPath); err != nil {
-		return ErrInvalid(err, "Fehler beim Erstellen der ZUGFeRD XML")
+	if err := ctrl.model.WriteZUGFeRDXML(i, ownerid, xmlPath); err != nil {
+		return "", ErrInvalid(err, "Fehler beim Erstellen der ZUGFeRD XML")
 	}
 
 	// Derive PDF path and ensure user dir exists (as before)
-	pdfPath := ctrl.getPDFPathForInvoice(i)
+	pdfPath := pdfPathFor(i)
 	userdir := filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("user%d", ownerid))
-	if err = ensureDir(userdir); err != nil {
-		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für den Benutzer")
+	if err := ensureDir(userdir); err != nil {
+		return "", ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für den Benutzer")
 	}
 
 	// Generate PDF even if there would be validation problems
-	if err = ctrl.model.CreateZUGFeRDPDF(i, ownerid, xmlPath, pdfPath, logger); err != nil {
-		return ErrInvalid(err, "Fehler beim Erstellen der ZUGFeRD PDF")
+	var err error
+	if plain {
+		err = ctrl.model.CreatePlainZUGFeRDPDF(i, ownerid, xmlPath, pdfPath, logger)
+	} else {
+		err = ctrl.model.CreateZUGFeRDPDF(i, ownerid, xmlPath, pdfPath, logger)
+	}
+	if err != nil {
+		return "", ErrInvalid(err, "Fehler beim Erstellen der ZUGFeRD PDF")
+	}
+	if !plain && i.RenderError != "" {
+		if err := ctrl.model.SetInvoiceRenderError(i.ID, ownerid, ""); err != nil {
+			logger.Error("cannot clear render error", "invoice_id", i.ID, "error", err)
+		}
 	}
+	return pdfPath, nil
+}
 
-	return c.Attachment(pdfPath, pdfname)
+// invoiceSend emails the invoice PDF to the company's invoice address. The
+// subject and body come from the configured invoice mail template (see
+// RenderInvoiceMail). Drafts are not sent.
+func (ctrl *controller) invoiceSend(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerID := c.Get("ownerid").(uint)
+
+	i, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if i.Status == model.InvoiceStatusDraft {
+		return echo.NewHTTPError(http.StatusBadRequest, "Entwürfe können nicht versendet werden")
+	}
+	cpy, err := ctrl.model.LoadCompany(i.CompanyID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Firma nicht laden")
+	}
+	to := strings.TrimSpace(cpy.InvoiceEmail)
+	if to == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Für diese Firma ist keine Rechnungs-E-Mail-Adresse hinterlegt")
+	}
+
+	pdfPath, err := ctrl.ensureInvoicePDF(i, ownerID, false, logger)
+	if err != nil {
+		return err
+	}
+	pdfData, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return ErrInvalid(err, "Kann PDF nicht lesen")
+	}
+
+	subject, body, err := ctrl.model.RenderInvoiceMail(ownerID, i, cpy)
+	if err != nil {
+		// Rendering falls back to the default texts; the error is only logged.
+		logger.Error("loading invoice mail template failed", "invoice_id", i.ID, "err", err)
+	}
+	replyTo := ""
+	if settings, err := ctrl.model.LoadSettings(ownerID); err == nil {
+		replyTo = settings.InvoiceEMail
+	}
+
+	attachment := emailAttachment{
+		Filename:    ctrl.invoiceDownloadName(i, ownerID, ".pdf"),
+		ContentType: "application/pdf",
+		Data:        pdfData,
+	}
+	if err = ctrl.sendEmailWithAttachments(to, replyTo, subject, body, attachment); err != nil {
+		return err
+	}
+
+	if err = ctrl.model.MarkInvoiceSent(i.ID, ownerID, time.Now()); err != nil {
+		return ErrInvalid(err, "Versand konnte nicht gespeichert werden")
+	}
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, i.ID, "Versand an "+to)
+
+	_ = AddFlash(c, "success", "Rechnung wurde an "+to+" gesendet.")
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", i.ID))
+}
+
+// getReminderPDFPathForInvoice returns the path of the reminder PDF for the
+// given reminder level. Each level gets its own file.
+func (ctrl *controller) getReminderPDFPathForInvoice(inv *model.Invoice, level int) string {
+	return filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", inv.OwnerID), fmt.Sprintf("%d-reminder%d.pdf", inv.ID, level))
+}
+
+// invoiceReminderCreate raises the reminder level of an overdue invoice,
+// renders the dunning letter for the new level and redirects to its PDF. The
+// invoice itself (totals, XML, invoice PDF) is not changed.
+func (ctrl *controller) invoiceReminderCreate(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerID := c.Get("ownerid").(uint)
+
+	i, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+
+	now := time.Now()
+	level, err := ctrl.model.RecordReminder(i.ID, ownerID, now)
+	if err != nil {
+		return ErrInvalid(err, "Für diese Rechnung kann keine Mahnung erstellt werden")
+	}
+	i.ReminderLevel = level
+	if err = ctrl.createReminderPDF(i, ownerID, now, logger); err != nil {
+		return err
+	}
+
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, i.ID, model.ReminderTitle(level)+" "+i.Number)
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/reminder/%d", i.ID))
+}
+
+// invoiceReminderPDF serves the dunning letter of the invoice's current
+// reminder level. It never raises the level (see invoiceReminderCreate); a
+// missing file is rendered again.
+func (ctrl *controller) invoiceReminderPDF(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerID := c.Get("ownerid").(uint)
+
+	i, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if i.ReminderLevel == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Für diese Rechnung gibt es noch keine Mahnung")
+	}
+
+	pdfPath := ctrl.getReminderPDFPathForInvoice(i, i.ReminderLevel)
+	if _, err := os.Stat(pdfPath); err != nil {
+		if err = ctrl.createReminderPDF(i, ownerID, time.Now(), logger); err != nil {
+			return err
+		}
+	}
+	return c.Attachment(pdfPath, ctrl.invoiceDownloadName(i, ownerID, fmt.Sprintf("-mahnung%d.pdf", i.ReminderLevel)))
+}
+
+// createReminderPDF renders the dunning letter of inv at its ReminderLevel to
+// the path of getReminderPDFPathForInvoice.
+func (ctrl *controller) createReminderPDF(i *model.Invoice, ownerID uint, asOf time.Time, logger *slog.Logger) error {
+	pdfPath := ctrl.getReminderPDFPathForInvoice(i, i.ReminderLevel)
+	if err := ensureDir(filepath.Dir(pdfPath)); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für die PDF-Datei")
+	}
+	if err := ctrl.model.CreateReminderPDF(i, ownerID, asOf, pdfPath, logger); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen der Mahnung")
+	}
+	return nil
+}
+
+// invoiceDeliveryNoteCreate numbers a new delivery note for the invoice
+// (form: deliverydate, invoiceref) and redirects to its PDF. Totals and
+// XML of the invoice are not touched.
+func (ctrl *controller) invoiceDeliveryNoteCreate(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	i, err := ctrl.model.LoadInvoice(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if i.IsCreditNote() || i.Status == model.InvoiceStatusVoided {
+		return echo.NewHTTPError(http.StatusBadRequest, "no delivery notes for credit notes or voided invoices")
+	}
+	deliveryDate := time.Now()
+	if s := strings.TrimSpace(c.FormValue("deliverydate")); s != "" {
+		if deliveryDate, err = time.Parse("2006-01-02", s); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Ungültiges Lieferdatum")
+		}
+	}
+	note, err := ctrl.model.CreateDeliveryNote(i, ownerID, deliveryDate, c.FormValue("invoiceref") == "true")
+	if err != nil {
+		return ErrInvalid(err, "Lieferschein konnte nicht angelegt werden")
+	}
+
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, i.ID, "Lieferschein "+note.Number)
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/deliverynote/%d/%d", i.ID, note.ID))
+}
+
+// invoiceDeliveryNotePDF renders a stored delivery note of the invoice as
+// PDF. The file is created anew on each request, so it follows later
+// changes of the letterhead.
+func (ctrl *controller) invoiceDeliveryNotePDF(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerID := c.Get("ownerid").(uint)
+
+	i, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	noteID, err := parseUintParam(c, "note")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid delivery note id")
+	}
+	note, err := ctrl.model.LoadDeliveryNote(noteID, ownerID)
+	if err != nil {
+		return ErrNotFound(err)
+	}
+	if note.InvoiceID != i.ID {
+		return ErrNotFound(fmt.Errorf("delivery note %d does not belong to invoice %d", noteID, i.ID))
+	}
+
+	pdfPath := filepath.Join(ctrl.model.Config.XMLDir, fmt.Sprintf("owner%d", ownerID), fmt.Sprintf("%d-deliverynote%d.pdf", i.ID, note.ID))
+	if err = ensureDir(filepath.Dir(pdfPath)); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Verzeichnisses für die PDF-Datei")
+	}
+	if err = ctrl.model.CreateDeliveryNotePDF(i, note, ownerID, pdfPath, logger); err != nil {
+		return ErrInvalid(err, "Fehler beim Erstellen des Lieferscheins")
+	}
+	return c.Attachment(pdfPath, fmt.Sprintf("lieferschein-%s.pdf", note.Number))
+}
+
+// invoicePaymentAdd records a (partial) payment for an issued invoice. The
+// invoice is marked paid by the model once the outstanding balance is zero.
+func (ctrl *controller) invoicePaymentAdd(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	invoiceID, err := parseUintParam(c, "id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid invoice id")
+	}
+
+	amount, err := decimal.NewFromString(commaperiod.Replace(strings.TrimSpace(c.FormValue("amount"))))
+	if err != nil || !amount.IsPositive() {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültiger Betrag")
+	}
+	date := time.Now()
+	if s := strings.TrimSpace(c.FormValue("date")); s != "" {
+		if date, err = time.Parse("2006-01-02", s); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Ungültiges Datum")
+		}
+	}
+	note := strings.TrimSpace(c.FormValue("note"))
+
+	if _, err := ctrl.model.AsUser(c.Get("uid").(uint)).AddPayment(invoiceID, ownerID, amount, date, note); err != nil {
+		return ErrInvalid(err, "Zahlung konnte nicht gespeichert werden")
+	}
+
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionUpdate, model.AuditEntityInvoice, invoiceID, "Zahlung "+amount.StringFixed(2))
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", invoiceID))
 }
 
 func (ctrl *controller) invoiceStatusChange(c echo.Context) error {
@@ -665,22 +1199,8 @@ func (ctrl *controller) invoiceStatusChange(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid status value")
 	}
 
-	now := time.Now()
-
-	// execute transition
-	switch dest {
-	case model.InvoiceStatusIssued:
-		err = ctrl.model.MarkInvoiceIssued(invoiceID, ownerID, now)
-	case model.InvoiceStatusPaid:
-		err = ctrl.model.MarkInvoicePaid(invoiceID, ownerID, now)
-	case model.InvoiceStatusVoided:
-		err = ctrl.model.VoidInvoice(invoiceID, ownerID, now)
-	case model.InvoiceStatusDraft:
-		err = ctrl.model.MarkInvoiceDraft(invoiceID, ownerID, now)
-	default:
-		return echo.NewHTTPError(http.StatusBadRequest, "unsupported transition")
-	}
-	if err != nil {
+	force := c.FormValue("force") == "1" || c.FormValue("force") == "true"
+	if err = ctrl.applyInvoiceStatus(invoiceID, ownerID, c.Get("uid").(uint), dest, force, time.Now()); err != nil {
 		// Give the user a clear message (e.g., "paid invoices cannot be voided")
 		slog.Error("invoice status change failed", "invoice_id", invoiceID, "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -697,19 +1217,7 @@ func (ctrl *controller) invoiceStatusChange(c echo.Context) error {
 	}
 
 	// Render PDF and XML in background; errors are logged only.
-	go func() {
-		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-		xmlPath := ctrl.getXMLPathForInvoice(inv)
-		if err = ctrl.model.WriteZUGFeRDXML(inv, ownerID, xmlPath); err != nil {
-			logger.Error("creating zugferd xml failed", "invoice_id", invoiceID, "err", err)
-			return
-		}
-		pdfPath := ctrl.getPDFPathForInvoice(inv)
-		if err = ctrl.model.CreateZUGFeRDPDF(inv, ownerID, xmlPath, pdfPath, logger); err != nil {
-			logger.Error("creating zugferd pdf failed", "invoice_id", invoiceID, "err", err)
-			return
-		}
-	}()
+	ctrl.queueInvoiceRender(inv.ID, ownerID)
 
 	type resp struct {
 		Status   string  `json:"status"`
@@ -732,6 +1240,176 @@ func (ctrl *controller) invoiceStatusChange(c echo.Context) error {
 	})
 }
 
+// applyInvoiceStatus runs the transition of one invoice to dest. The
+// transition rules live in the model (changeInvoiceStatus); uid is recorded
+// in the invoice history. Issuing is refused while the settings lack data
+// every e-invoice needs; an issued invoice is validated again.
+func (ctrl *controller) applyInvoiceStatus(invoiceID, ownerID, uid uint, dest model.InvoiceStatus, force bool, now time.Time) error {
+	store := ctrl.model.AsUser(uid)
+	switch dest {
+	case model.InvoiceStatusIssued:
+		inv, err := ctrl.model.LoadInvoice(invoiceID, ownerID)
+		if err != nil {
+			return err
+		}
+		settings, err := ctrl.model.LoadSettingsForCurrency(ownerID, inv.Currency)
+		if err != nil {
+			return err
+		}
+		if missing := model.ValidateSettingsForInvoicing(settings); len(missing) > 0 {
+			return fmt.Errorf("Die Rechnung kann nicht gestellt werden, in den Einstellungen fehlt: %s", strings.Join(missing, ", "))
+		}
+		if err := store.MarkInvoiceIssued(invoiceID, ownerID, now); err != nil {
+			return err
+		}
+		ctrl.revalidateInvoice(invoiceID, ownerID)
+		return nil
+	case model.InvoiceStatusPaid:
+		return store.MarkInvoicePaid(invoiceID, ownerID, now)
+	case model.InvoiceStatusVoided:
+		return store.VoidInvoice(invoiceID, ownerID, now, force)
+	case model.InvoiceStatusDraft:
+		return store.MarkInvoiceDraft(invoiceID, ownerID, now)
+	}
+	return fmt.Errorf("unsupported transition to %q", dest)
+}
+
+// renderedInvoiceSuffixes are the files of an invoice besides the XML that
+// are rendered on demand and dropped after a status change.
+var renderedInvoiceSuffixes = []string{".pdf", "-plain.pdf", "-draft.pdf", "-plain-draft.pdf", "-xrechnung.xml"}
+
+// regenerateInvoiceFiles renders the XML and PDF of inv after a status
+// change and removes the files rendered before. It runs in the render queue,
+// which retries it on errors.
+func (ctrl *controller) regenerateInvoiceFiles(inv *model.Invoice, ownerID uint) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	xmlPath := ctrl.getXMLPathForInvoice(inv)
+	if err := ctrl.model.WriteZUGFeRDXML(inv, ownerID, xmlPath); err != nil {
+		return fmt.Errorf("creating zugferd xml: %w", err)
+	}
+	// Drop everything rendered before the status change. The plain variant,
+	// the XRechnung and draft PDFs (with watermark) are rendered on demand.
+	for _, suffix := range renderedInvoiceSuffixes {
+		_ = os.Remove(ctrl.invoiceFilePath(inv, suffix))
+	}
+	if inv.Status == model.InvoiceStatusDraft {
+		return nil
+	}
+	pdfPath := ctrl.getPDFPathForInvoice(inv)
+	if err := ctrl.model.CreateZUGFeRDPDF(inv, ownerID, xmlPath, pdfPath, logger); err != nil {
+		return fmt.Errorf("creating zugferd pdf: %w", err)
+	}
+	return nil
+}
+
+// renderInvoiceJob is the worker function of the render queue (see
+// model.StartRenderWorkers). The invoice is loaded when the job runs, so the
+// files match its latest state.
+func (ctrl *controller) renderInvoiceJob(job model.RenderJob) error {
+	inv, err := ctrl.model.LoadInvoiceWithTemplate(job.InvoiceID, job.OwnerID)
+	if err != nil {
+		return err
+	}
+	return ctrl.regenerateInvoiceFiles(inv, job.OwnerID)
+}
+
+// invoiceRenderRetry handles POST /invoice/render/:id, the retry button shown
+// when the background rendering failed (see model.Invoice.RenderError). It
+// renders XML and PDF again right away.
+func (ctrl *controller) invoiceRenderRetry(c echo.Context) error {
+	logger := c.Get("logger").(*slog.Logger)
+	ownerID := c.Get("ownerid").(uint)
+	inv, err := ctrl.model.LoadInvoiceWithTemplate(c.Param("id"), ownerID)
+	if err != nil {
+		return invoiceLoadError(err)
+	}
+	if inv.Status == model.InvoiceStatusDraft {
+		return echo.NewHTTPError(http.StatusBadRequest, "Entwürfe werden beim Herunterladen erzeugt")
+	}
+	msg := ""
+	if err := ctrl.regenerateInvoiceFiles(inv, ownerID); err != nil {
+		logger.Error("render invoice failed", "invoice_id", inv.ID, "error", err)
+		msg = err.Error()
+		_ = AddFlash(c, "error", "PDF konnte nicht erzeugt werden.")
+	} else {
+		_ = AddFlash(c, "success", "PDF wurde erzeugt.")
+	}
+	if err := ctrl.model.SetInvoiceRenderError(inv.ID, ownerID, msg); err != nil {
+		logger.Error("cannot store render error", "invoice_id", inv.ID, "error", err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/detail/%d", inv.ID))
+}
+
+// queueInvoiceRender schedules the regeneration of an invoice's XML and PDF.
+// If the queue is full, the old files are removed, so that the next download
+// renders them.
+func (ctrl *controller) queueInvoiceRender(invoiceID, ownerID uint) {
+	err := ctrl.model.EnqueueInvoiceRender(invoiceID, ownerID)
+	if err == nil {
+		return
+	}
+	slog.Warn("cannot queue invoice rendering", "invoice_id", invoiceID, "err", err)
+	inv := &model.Invoice{OwnerID: ownerID}
+	inv.ID = invoiceID
+	for _, suffix := range append([]string{".xml"}, renderedInvoiceSuffixes...) {
+		_ = os.Remove(ctrl.invoiceFilePath(inv, suffix))
+	}
+}
+
+// invoiceBulkStatus changes the status of several invoices at once. Each
+// invoice is transitioned on its own; failures (e.g. an already paid invoice)
+// are reported per invoice and do not abort the batch. XML and PDF of newly
+// issued invoices are regenerated in the background.
+func (ctrl *controller) invoiceBulkStatus(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+
+	var payload struct {
+		IDs    []uint `json:"ids" form:"ids"`
+		Status string `json:"status" form:"status"`
+		Force  bool   `json:"force" form:"force"`
+	}
+	if err := c.Bind(&payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+	dest, ok := toInvoiceStatus(payload.Status)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status value")
+	}
+	if len(payload.IDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "no invoices selected")
+	}
+
+	type failure struct {
+		ID    uint   `json:"id"`
+		Error string `json:"error"`
+	}
+	type resp struct {
+		Status    string    `json:"status"`
+		Succeeded []uint    `json:"succeeded"`
+		Failed    []failure `json:"failed"`
+	}
+	out := resp{Status: string(dest), Succeeded: []uint{}, Failed: []failure{}}
+
+	now := time.Now()
+	for _, id := range payload.IDs {
+		if err := ctrl.applyInvoiceStatus(id, ownerID, uid, dest, payload.Force, now); err != nil {
+			slog.Error("bulk invoice status change failed", "invoice_id", id, "err", err)
+			out.Failed = append(out.Failed, failure{ID: id, Error: err.Error()})
+			continue
+		}
+		out.Succeeded = append(out.Succeeded, id)
+		ctrl.model.LogAudit(ownerID, uid, model.AuditActionStatus, model.AuditEntityInvoice, id, "Status → "+string(dest))
+
+		if dest != model.InvoiceStatusIssued {
+			continue
+		}
+		ctrl.queueInvoiceRender(id, ownerID)
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
 // helper: sanitize / map string -> model.InvoiceStatus
 func toInvoiceStatus(s string) (model.InvoiceStatus, bool) {
 	switch strings.ToLower(strings.TrimSpace(s)) {
@@ -748,6 +1426,153 @@ func toInvoiceStatus(s string) (model.InvoiceStatus, bool) {
 	}
 }
 
+// invoiceListStatusDE is the status label used in the invoice list and its
+// exports. Credit notes get a "Gutschrift" prefix so they stand out.
+func invoiceListStatusDE(inv *model.Invoice) string {
+	if inv.IsCreditNote() {
+		return "Gutschrift (" + invoiceStatusDE(inv.Status) + ")"
+	}
+	return invoiceStatusDE(inv.Status)
+}
+
+// invoiceListCSV streams all invoices matching filters as CSV in the owner's
+// export locale.
+func (ctrl *controller) invoiceListCSV(c echo.Context, ownerID uint, filters model.InvoiceFilters) error {
+	filename := "invoices_" + time.Now().Format("2006-01-02") + ".csv"
+	loc := ctrl.ownerExportLocale(ownerID)
+	names := newCompanyNameCache(ctrl.model, ownerID, companyNameCacheSize)
+
+	return streamCSVDownload(c, loc, filename, invoiceExportHeader(loc), func(write func([]string) error) error {
+		return ctrl.model.StreamInvoices(ownerID, filters, func(r model.Invoice) error {
+			company, err := names.name(r.CompanyID) // empty if 0/unknown
+			if err != nil {
+				return err
+			}
+			return write([]string{
+				r.Number,
+				company,
+				loc.date(r.Date),
+				loc.date(r.DueDate),
+				loc.invoiceStatus(&r),
+				loc.amount(r.NetTotal),
+				loc.amount(r.GrossTotal),
+			})
+		})
+	})
+}
+
+// invoiceListXLSX streams all invoices matching filters into an Excel sheet.
+// Money cells show the symbol of the invoice's currency.
+func (ctrl *controller) invoiceListXLSX(c echo.Context, ownerID uint, filters model.InvoiceFilters) error {
+	loc := ctrl.ownerExportLocale(ownerID)
+	names := newCompanyNameCache(ctrl.model, ownerID, companyNameCacheSize)
+
+	// Build XLSX using excelize (streaming).
+	f := excelize.NewFile()
+	defer f.Close()
+	const sheet = "Invoices"
+	_ = f.SetSheetName("Sheet1", sheet)
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	// Header row (row 1)
+	var header []any
+	for _, h := range invoiceExportHeader(loc) {
+		header = append(header, h)
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	// Each currency gets its own number format.
+	moneyStyles := make(map[string]int)
+	moneyStyle := func(currency string) int {
+		sym := currencySymbol(currency)
+		if id, ok := moneyStyles[sym]; ok {
+			return id
+		}
+		numFmt := `#,##0.00 "` + sym + `"`
+		if loc.english {
+			numFmt = `"` + sym + `"#,##0.00`
+		}
+		id, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &numFmt})
+		moneyStyles[sym] = id
+		return id
+	}
+
+	// Write data rows starting at row 2
+	rowIdx := 2
+	err = ctrl.model.StreamInvoices(ownerID, filters, func(r model.Invoice) error {
+		company, err := names.name(r.CompanyID) // empty if 0/unknown
+		if err != nil {
+			return err
+		}
+
+		// Convert decimals to float64 for real numeric cells in Excel.
+		// NOTE: Rounded to 2 decimals to match display/CSV.
+		money := moneyStyle(r.Currency)
+		row := []any{
+			r.Number,              // A
+			company,               // B
+			r.Date,                // C (as time.Time, will be styled as date)
+			r.DueDate,             // D (as time.Time)
+			loc.invoiceStatus(&r), // E
+			excelize.Cell{StyleID: money, Value: r.NetTotal.Round(2).InexactFloat64()},   // F (numeric)
+			excelize.Cell{StyleID: money, Value: r.GrossTotal.Round(2).InexactFloat64()}, // G (numeric)
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, rowIdx)
+		rowIdx++
+		return sw.SetRow(cell, row)
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "query_failed_all"})
+	}
+
+	// Flush streaming content
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	// Column widths (nice-to-have)
+	_ = f.SetColWidth(sheet, "A", "A", 14) // No.
+	_ = f.SetColWidth(sheet, "B", "B", 28) // Company
+	_ = f.SetColWidth(sheet, "C", "D", 14) // Date, Due
+	_ = f.SetColWidth(sheet, "E", "E", 16) // Status
+	_ = f.SetColWidth(sheet, "F", "G", 14) // Net, Gross
+
+	// Date format applied per column (affects Numbers/Excel display);
+	// NumFmt 14 ~ date. Money cells carry their own style (see above).
+	dateStyle, _ := f.NewStyle(&excelize.Style{NumFmt: 14})
+	_ = f.SetColStyle(sheet, "C:D", dateStyle)
+
+	// Prepare download response headers.
+	filename := "invoices_" + time.Now().Format("2006-01-02") + ".xlsx"
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	res.WriteHeader(http.StatusOK)
+
+	// Stream the XLSX directly to the HTTP response.
+	_, err = f.WriteTo(res)
+	return err
+}
+
+// invoiceExportHeader returns the column names of the invoice list export.
+func invoiceExportHeader(loc exportLocale) []string {
+	return []string{
+		loc.text("Nr.", "No."),
+		loc.text("Firma", "Company"),
+		loc.text("Datum", "Date"),
+		loc.text("Fällig", "Due"),
+		"Status",
+		loc.text("Netto", "Net"),
+		loc.text("Brutto", "Gross"),
+	}
+}
+
 // Mappe Status auf deutsche Labels (wie dein Template-Filter `invoiceStatus`)
 func invoiceStatusDE(s model.InvoiceStatus) string {
 	switch strings.ToLower(string(s)) {
@@ -782,34 +1607,66 @@ func currentExcelURL(u *url.URL) string {
 	return u2.RequestURI()
 }
 
-func (ctrl *controller) invoiceList(c echo.Context) error {
-	ownerID := c.Get("ownerid").(uint)
-	title := "Rechnungen"
-	status := strings.ToLower(c.QueryParam("status"))
-	format := strings.ToLower(c.QueryParam("format"))
+// parseListDate parses a date filter given as 2006-01-02 or 02.01.2006.
+// Empty or invalid input yields nil (no filter).
+func parseListDate(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return &t
+	}
+	if t, err := time.Parse("02.01.2006", s); err == nil {
+		return &t
+	}
+	return nil
+}
 
-	// --- Status mapping (affects title and DB filter) ---
-	var statuses []model.InvoiceStatus
+// invoiceListOrder maps the sort parameter of the invoice list to an ORDER BY
+// clause. The default is newest first.
+func invoiceListOrder(sort string) string {
+	switch strings.ToLower(sort) {
+	case "date_asc":
+		return "date asc, id asc"
+	case "due_asc":
+		return "due_date asc, id asc"
+	case "due_desc":
+		return "due_date desc, id desc"
+	case "total_asc":
+		return "gross_total asc, id asc"
+	case "total_desc":
+		return "gross_total desc, id desc"
+	}
+	return "date desc, id desc"
+}
+
+// invoiceListStatuses maps the status parameter of the invoice list to the
+// page title and the statuses to filter by. An unknown status means all
+// invoices (no filter).
+func invoiceListStatuses(status string) (string, []model.InvoiceStatus) {
 	switch status {
 	case "open":
-		title = "Offene Rechnungen"
-		statuses = []model.InvoiceStatus{model.InvoiceStatusIssued}
+		return "Offene Rechnungen", []model.InvoiceStatus{model.InvoiceStatusIssued}
 	case "draft":
-		title = "Entwürfe"
-		statuses = []model.InvoiceStatus{model.InvoiceStatusDraft}
+		return "Entwürfe", []model.InvoiceStatus{model.InvoiceStatusDraft}
 	case "issued":
-		title = "Ausgestellte Rechnungen"
-		statuses = []model.InvoiceStatus{model.InvoiceStatusIssued}
+		return "Ausgestellte Rechnungen", []model.InvoiceStatus{model.InvoiceStatusIssued}
 	case "paid":
-		title = "Bezahlte Rechnungen"
-		statuses = []model.InvoiceStatus{model.InvoiceStatusPaid}
+		return "Bezahlte Rechnungen", []model.InvoiceStatus{model.InvoiceStatusPaid}
 	case "voided":
-		title = "Stornierte Rechnungen"
-		statuses = []model.InvoiceStatus{model.InvoiceStatusVoided}
+		return "Stornierte Rechnungen", []model.InvoiceStatus{model.InvoiceStatusVoided}
 	default:
-		title = "Alle Rechnungen"
-		// no status filter
+		return "Alle Rechnungen", nil
 	}
+}
+
+func (ctrl *controller) invoiceList(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	status := strings.ToLower(c.QueryParam("status"))
+	format := strings.ToLower(c.QueryParam("format"))
+
+	// --- Status mapping (affects title and DB filter) ---
+	title, statuses := invoiceListStatuses(status)
 
 	// --- Optional company filter ---
 	var companyID *uint
@@ -820,60 +1677,58 @@ func (ctrl *controller) invoiceList(c echo.Context) error {
 		}
 	}
 
+	// --- Optional free-text search on invoice and order number ---
+	search := strings.TrimSpace(c.QueryParam("q"))
+
 	// --- Period field & date range parsing ---
 	periodField := strings.ToLower(c.QueryParam("period_field"))
 	if periodField != "due" {
 		periodField = "date"
 	}
-	parseDate := func(s string) *time.Time {
-		if s == "" {
-			return nil
-		}
-		if t, err := time.Parse("2006-01-02", s); err == nil {
-			return &t
-		}
-		if t, err := time.Parse("02.01.2006", s); err == nil {
-			return &t
-		}
-		return nil
-	}
-	dateFrom := parseDate(c.QueryParam("date_from"))
-	dateTo := parseDate(c.QueryParam("date_to"))
+	dateFrom := parseListDate(c.QueryParam("date_from"))
+	dateTo := parseListDate(c.QueryParam("date_to"))
 
-	// --- Sorting ---
-	order := "date desc, id desc"
-	switch strings.ToLower(c.QueryParam("sort")) {
-	case "date_asc":
-		order = "date asc, id asc"
-	case "due_asc":
-		order = "due_date asc, id asc"
-	case "due_desc":
-		order = "due_date desc, id desc"
-	case "total_asc":
-		order = "gross_total asc, id asc"
-	case "total_desc":
-		order = "gross_total desc, id desc"
-	}
+	// --- Sorting (remembered per user, like the page size) ---
+	order := invoiceListOrder(ctrl.listParam(c, "sort", model.PrefInvoiceSort, validInvoiceSort))
 
 	// --- Pagination ---
 	page, _ := strconv.Atoi(c.QueryParam("page"))
 	if page < 1 {
 		page = 1
 	}
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	pageSize, _ := strconv.Atoi(ctrl.listParam(c, "page_size", model.PrefInvoicePageSize, pageSizeUpTo(200)))
 	if pageSize < 1 || pageSize > 200 {
 		pageSize = 50
 	}
 	offset := (page - 1) * pageSize
 
+	// --- CSV / XLSX output (exports ALL matching rows regardless of current page) ---
+	if format == "csv" || format == "xlsx" || format == "excel" {
+		filters := model.InvoiceFilters{
+			Statuses:  statuses,
+			CompanyID: companyID,
+			Search:    search,
+			Field:     periodField,
+			From:      dateFrom,
+			To:        dateTo,
+			Order:     order,
+		}
+		if format == "csv" {
+			return ctrl.invoiceListCSV(c, ownerID, filters)
+		}
+		return ctrl.invoiceListXLSX(c, ownerID, filters)
+	}
+
 	// --- Fetch rows using the existing repository method ---
 	rows, total, err := ctrl.model.FindInvoices(
 		ownerID,
 		statuses,
 		companyID,
+		search,
 		periodField,
 		dateFrom,
 		dateTo,
+		nil,
 		pageSize,
 		offset,
 		order,
@@ -882,222 +1737,6 @@ func (ctrl *controller) invoiceList(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "query_failed"})
 	}
 
-	// --- CSV output (exports ALL matching rows regardless of current page) ---
-	if format == "csv" {
-		// If the first paginated query didn't fetch everything, re-fetch all rows.
-		if int(total) > len(rows) {
-			// Safety cap: avoid excessive memory usage by capping to a reasonable upper bound.
-			const hardCap = 500_000
-			want := int(total)
-			if want > hardCap {
-				want = hardCap
-			}
-
-			allRows, _, err := ctrl.model.FindInvoices(
-				ownerID,
-				statuses,
-				companyID,
-				periodField,
-				dateFrom,
-				dateTo,
-				want, // pageSize = total (capped)
-				0,    // offset = 0 (from the beginning)
-				order,
-			)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "query_failed_all"})
-			}
-			rows = allRows
-		}
-
-		// Collect distinct company IDs from ALL rows to avoid N+1 queries.
-		idset := make(map[uint]struct{})
-		for _, r := range rows {
-			if r.CompanyID != 0 {
-				idset[r.CompanyID] = struct{}{}
-			}
-		}
-		ids := make([]uint, 0, len(idset))
-		for id := range idset {
-			ids = append(ids, id)
-		}
-
-		// Bulk lookup of company names (must exist in your model).
-		companyNames, err := ctrl.model.CompanyNamesByIDs(ownerID, ids)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "companies_lookup_failed"})
-		}
-
-		// Prepare download response headers.
-		filename := "invoices_" + time.Now().Format("yyyy-mm-dd") + ".csv" // will be adjusted below
-		// Use Go time layout for YYYY-MM-DD
-		filename = "invoices_" + time.Now().Format("2006-01-02") + ".csv"
-
-		res := c.Response()
-		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
-		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
-
-		// Write UTF-8 BOM for Excel compatibility.
-		res.WriteHeader(http.StatusOK)
-		if _, err := res.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
-			return err
-		}
-
-		// Create CSV writer. Use semicolon as delimiter (common for DE locale).
-		w := csv.NewWriter(res)
-		w.Comma = ';'
-
-		// Header row: exactly the columns you display in the list.
-		if err := w.Write([]string{"Nr.", "Firma", "Datum", "Fällig", "Status", "Netto", "Brutto"}); err != nil {
-			return err
-		}
-
-		// Data rows.
-		for _, r := range rows {
-			company := companyNames[r.CompanyID] // empty if 0/unknown
-			row := []string{
-				r.Number,
-				company,
-				r.Date.Format("02.01.2006"),
-				r.DueDate.Format("02.01.2006"),
-				invoiceStatusDE(r.Status),
-				r.NetTotal.StringFixed(2),
-				r.GrossTotal.StringFixed(2),
-			}
-
-			// Ensure all fields are valid UTF-8 (defensive).
-			for i := range row {
-				if !utf8.ValidString(row[i]) {
-					row[i] = strings.ToValidUTF8(row[i], "")
-				}
-			}
-
-			if err := w.Write(row); err != nil {
-				return err
-			}
-		}
-
-		w.Flush()
-		return w.Error()
-	} else if format == "xlsx" || format == "excel" {
-		// If the first paginated query didn't fetch everything, re-fetch all rows.
-		if int(total) > len(rows) {
-			// Safety cap: avoid excessive memory usage by capping to a reasonable upper bound.
-			const hardCap = 500_000
-			want := int(total)
-			if want > hardCap {
-				want = hardCap
-			}
-			allRows, _, err := ctrl.model.FindInvoices(
-				ownerID,
-				statuses,
-				companyID,
-				periodField,
-				dateFrom,
-				dateTo,
-				want, // pageSize = total (capped)
-				0,    // offset = 0 (from the beginning)
-				order,
-			)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "query_failed_all"})
-			}
-			rows = allRows
-		}
-
-		// Collect distinct company IDs from ALL rows to avoid N+1 queries.
-		idset := make(map[uint]struct{})
-		for _, r := range rows {
-			if r.CompanyID != 0 {
-				idset[r.CompanyID] = struct{}{}
-			}
-		}
-		ids := make([]uint, 0, len(idset))
-		for id := range idset {
-			ids = append(ids, id)
-		}
-
-		// Bulk lookup of company names (must exist in your model).
-		companyNames, err := ctrl.model.CompanyNamesByIDs(ownerID, ids)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "companies_lookup_failed"})
-		}
-
-		// Prepare download response headers.
-		filename := "invoices_" + time.Now().Format("2006-01-02") + ".xlsx"
-		res := c.Response()
-		res.Header().Set(echo.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
-		res.WriteHeader(http.StatusOK)
-
-		// Build XLSX using excelize (streaming).
-		f := excelize.NewFile()
-		const sheet = "Invoices"
-		_ = f.SetSheetName("Sheet1", sheet)
-
-		sw, err := f.NewStreamWriter(sheet)
-		if err != nil {
-			return err
-		}
-
-		// Header row (row 1)
-		header := []any{"No.", "Company", "Date", "Due", "Status", "Net", "Gross"}
-		if err := sw.SetRow("A1", header); err != nil {
-			return err
-		}
-
-		// Write data rows starting at row 2
-		rowIdx := 2
-		for _, r := range rows {
-			company := companyNames[r.CompanyID] // empty if 0/unknown
-
-			// Convert decimals to float64 for real numeric cells in Excel.
-			// NOTE: Rounded to 2 decimals to match display/CSV.
-			netF64 := r.NetTotal.Round(2).InexactFloat64()
-			grossF64 := r.GrossTotal.Round(2).InexactFloat64()
-
-			row := []any{
-				r.Number,                  // A
-				company,                   // B
-				r.Date,                    // C (as time.Time, will be styled as date)
-				r.DueDate,                 // D (as time.Time)
-				invoiceStatusDE(r.Status), // E
-				netF64,                    // F (numeric)
-				grossF64,                  // G (numeric)
-			}
-
-			cell, _ := excelize.CoordinatesToCellName(1, rowIdx)
-			if err := sw.SetRow(cell, row); err != nil {
-				return err
-			}
-			rowIdx++
-		}
-
-		// Flush streaming content
-		if err := sw.Flush(); err != nil {
-			return err
-		}
-
-		// Column widths (nice-to-have)
-		_ = f.SetColWidth(sheet, "A", "A", 14) // No.
-		_ = f.SetColWidth(sheet, "B", "B", 28) // Company
-		_ = f.SetColWidth(sheet, "C", "D", 14) // Date, Due
-		_ = f.SetColWidth(sheet, "E", "E", 16) // Status
-		_ = f.SetColWidth(sheet, "F", "G", 14) // Net, Gross
-
-		// Styles: date and number formats applied per column (affect Numbers/Excel display)
-		// NumFmt 14 ~ date, NumFmt 2 ~ "0.00"
-		dateStyle, _ := f.NewStyle(&excelize.Style{NumFmt: 14})
-		moneyStyle, _ := f.NewStyle(&excelize.Style{NumFmt: 2})
-
-		_ = f.SetColStyle(sheet, "C:D", dateStyle)  // Dates
-		_ = f.SetColStyle(sheet, "F:G", moneyStyle) // Money with 2 decimals
-
-		// Stream the XLSX directly to the HTTP response.
-		_, err = f.WriteTo(res)
-		return err
-	}
-
 	var sumNet decimal.Decimal
 	var sumGross decimal.Decimal
 
@@ -1107,6 +1746,8 @@ func (ctrl *controller) invoiceList(c echo.Context) error {
 	}
 
 	// --- JSON output ---
+	// Amounts are decimal strings in the invoice currency, rounded to cents
+	// like in the HTML list ("123.45"). They are never cut to whole units.
 	if format == "json" || strings.Contains(c.Request().Header.Get("Accept"), "application/json") {
 		type item struct {
 			ID         uint                `json:"id"`
@@ -1115,7 +1756,10 @@ func (ctrl *controller) invoiceList(c echo.Context) error {
 			Date       string              `json:"date"`
 			DueDate    string              `json:"due_date"`
 			Status     model.InvoiceStatus `json:"status"`
-			GrossTotal int64               `json:"gross_total"`
+			Type       model.DocumentType  `json:"document_type"`
+			Currency   string              `json:"currency"`
+			NetTotal   string              `json:"net_total"`
+			GrossTotal string              `json:"gross_total"`
 		}
 		out := make([]item, 0, len(rows))
 		for _, r := range rows {
@@ -1126,7 +1770,10 @@ func (ctrl *controller) invoiceList(c echo.Context) error {
 				Date:       r.Date.Format("02.01.2006"),
 				DueDate:    r.DueDate.Format("02.01.2006"),
 				Status:     r.Status,
-				GrossTotal: r.GrossTotal.IntPart(),
+				Type:       r.DocumentType,
+				Currency:   r.Currency,
+				NetTotal:   r.NetTotal.StringFixed(2),
+				GrossTotal: r.GrossTotal.StringFixed(2),
 			})
 		}
 		return c.JSON(http.StatusOK, map[string]any{
@@ -1142,9 +1789,12 @@ func (ctrl *controller) invoiceList(c echo.Context) error {
 	m["total"] = total
 	m["page"] = page
 	m["page_size"] = pageSize
+	m["q"] = search
+	m["status"] = status
 	m["isViewActive"] = (status == "open")
 	m["exportURL"] = currentCSVURL(c.Request().URL)
 	m["exportURLExcel"] = currentExcelURL(c.Request().URL)
+	m["exportURLPDF"] = currentPDFExportURL(c.Request().URL)
 
 	return c.Render(http.StatusOK, "invoicelist.html", m)
 }
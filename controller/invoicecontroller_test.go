@@ -2,14 +2,28 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 )
 
 func TestFormatInvoiceNumber(t *testing.T) {
-	now := time.Now()
-	year := now.Year()
+	date := time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)
+	year := date.Year()
 	yy := fmt.Sprintf("%02d", year%100)
 	yyyy := fmt.Sprintf("%04d", year)
 
@@ -111,7 +125,7 @@ func TestFormatInvoiceNumber(t *testing.T) {
 	for _, tc := range tests {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			got := formatInvoiceNumber(tc.in, tc.cn, tc.counter)
+			got := formatInvoiceNumber(tc.in, tc.cn, tc.counter, date)
 			if got != tc.want {
 				t.Fatalf("formatInvoiceNumber(%q, %q, %d) = %q, want %q",
 					tc.in, tc.cn, tc.counter, got, tc.want)
@@ -125,6 +139,540 @@ func BenchmarkFormatInvoiceNumber(b *testing.B) {
 	in := "RE-%YYYY%-%CN%-%06C%"
 	cn := "4711"
 	for i := 0; i < b.N; i++ {
-		_ = formatInvoiceNumber(in, cn, 123)
+		_ = formatInvoiceNumber(in, cn, 123, time.Now())
+	}
+}
+
+// The number follows the invoice date, not the day it is written: a
+// December invoice numbered on January 2nd keeps the old year.
+func TestFormatInvoiceNumber_YearBoundary(t *testing.T) {
+	tpl := "RE-%YYYY%-%YY%%MM%-%04C%"
+	december := time.Date(2024, time.December, 31, 23, 30, 0, 0, time.UTC)
+	january := time.Date(2025, time.January, 2, 8, 0, 0, 0, time.UTC)
+
+	if got, want := formatInvoiceNumber(tpl, "", 17, december), "RE-2024-2412-0017"; got != want {
+		t.Errorf("December invoice: got %q, want %q", got, want)
+	}
+	if got, want := formatInvoiceNumber(tpl, "", 18, january), "RE-2025-2501-0018"; got != want {
+		t.Errorf("January invoice: got %q, want %q", got, want)
+	}
+
+	// Issuing a backdated invoice with the number the editor suggested for
+	// today stores the number for the invoice date.
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	data.Settings.InvoiceNumberTemplate = "RE-%YYYY%-%04C%"
+	if err := store.SaveSettings(data.Settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceDate(december),
+		fixtures.WithInvoiceNumber(formatInvoiceNumber(data.Settings.InvoiceNumberTemplate, "", 2, time.Now())),
+	)
+	inv.Counter = 2
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if want := fmt.Sprintf("RE-2024-%04d", issued.Counter); issued.Number != want {
+		t.Errorf("backdated invoice number = %q, want %q", issued.Number, want)
+	}
+}
+
+func TestInvoiceBulkStatus(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+
+	issued := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(issued, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(issued.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	paid := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(paid, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(paid.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if err := store.MarkInvoicePaid(paid.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoicePaid failed: %v", err)
+	}
+
+	// The seeded invoice is a draft and cannot be marked paid, the paid one
+	// is final.
+	body := fmt.Sprintf(`{"ids":[%d,%d,%d],"status":"paid"}`, issued.ID, data.Invoice.ID, paid.ID)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/invoices/bulk-status", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("ownerid", fixtures.DefaultOwnerID)
+	c.Set("uid", fixtures.DefaultOwnerID)
+
+	if err := ctrl.invoiceBulkStatus(c); err != nil {
+		t.Fatalf("invoiceBulkStatus error: %v", err)
+	}
+	var result struct {
+		Succeeded []uint `json:"succeeded"`
+		Failed    []struct {
+			ID uint `json:"id"`
+		} `json:"failed"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("JSON unmarshal error: %v", err)
+	}
+	if len(result.Succeeded) != 1 || result.Succeeded[0] != issued.ID {
+		t.Errorf("Succeeded = %v, want [%d]", result.Succeeded, issued.ID)
+	}
+	if len(result.Failed) != 2 || result.Failed[0].ID != data.Invoice.ID || result.Failed[1].ID != paid.ID {
+		t.Errorf("Failed = %v, want invoices %d and %d", result.Failed, data.Invoice.ID, paid.ID)
+	}
+	entity := model.AuditEntityInvoice
+	logs, _, err := store.ListAuditLogs(fixtures.DefaultOwnerID, model.AuditLogFilter{EntityType: &entity}, 0, 10)
+	if err != nil {
+		t.Fatalf("ListAuditLogs failed: %v", err)
+	}
+	if len(logs) != 1 || logs[0].EntityID != issued.ID {
+		t.Errorf("audit entries = %v, want one for invoice %d", logs, issued.ID)
+	}
+
+	loaded, _ := store.LoadInvoice(issued.ID, fixtures.DefaultOwnerID)
+	if loaded.Status != model.InvoiceStatusPaid {
+		t.Errorf("Status = %q, want %q", loaded.Status, model.InvoiceStatusPaid)
+	}
+}
+
+func TestInvoiceDelete_NotFound(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+
+	for _, tc := range []struct {
+		name    string
+		id      string
+		ownerID uint
+	}{
+		{"unknown id", "999999", fixtures.DefaultOwnerID},
+		{"other owner", fmt.Sprint(data.Invoice.ID), fixtures.DefaultOwnerID + 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/invoice/delete/"+tc.id, nil)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetParamNames("id")
+			c.SetParamValues(tc.id)
+			c.Set("ownerid", tc.ownerID)
+			c.Set("uid", tc.ownerID)
+
+			var ae *appError
+			if err := ctrl.invoiceDelete(c); !errors.As(err, &ae) || ae.Status != http.StatusNotFound {
+				t.Fatalf("invoiceDelete error = %v, want 404", err)
+			}
+			if ae.Code != "NOT_FOUND" {
+				t.Errorf("Code = %q, want NOT_FOUND", ae.Code)
+			}
+		})
+	}
+}
+
+func TestApplyInvoiceStatus_IncompleteSettings(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	// The settings form leaves the bank columns alone, so the settings
+	// without a bank account have to exist before seeding.
+	if err := store.SaveSettings(fixtures.Settings(fixtures.WithSettingsBank("", "", ""))); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+	owner := fixtures.DefaultOwnerID
+
+	settings := data.Settings
+	settings.VATID = ""
+	settings.TAXNumber = ""
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	err := ctrl.applyInvoiceStatus(data.Invoice.ID, owner, owner, model.InvoiceStatusIssued, false, time.Now())
+	if err == nil {
+		t.Fatal("expected error when issuing with incomplete settings")
+	}
+	for _, want := range []string{"IBAN", "USt-IdNr. oder Steuernummer"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	inv, _ := store.LoadInvoice(data.Invoice.ID, owner)
+	if inv.Status != model.InvoiceStatusDraft {
+		t.Errorf("Status = %q, want draft", inv.Status)
+	}
+
+	settings.TAXNumber = "123/456/78901"
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	if err := store.SaveBankAccount(&model.BankAccount{OwnerID: owner, IBAN: "DE89370400440532013000", Currency: "EUR"}); err != nil {
+		t.Fatalf("SaveBankAccount failed: %v", err)
+	}
+	if err := ctrl.applyInvoiceStatus(data.Invoice.ID, owner, owner, model.InvoiceStatusIssued, false, time.Now()); err != nil {
+		t.Errorf("issuing with complete settings failed: %v", err)
+	}
+
+	// Issuing validates the invoice again.
+	inv, _ = store.LoadInvoice(data.Invoice.ID, owner)
+	v, err := store.LoadInvoiceValidation(inv, owner)
+	if err != nil || v == nil || v.Stale {
+		t.Errorf("validation after issue: got %+v, %v; want a fresh result", v, err)
+	}
+}
+
+func TestInvoicePreviewPDF(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	store.Config.XMLDir = t.TempDir()
+	ctrl := &controller{model: store}
+
+	id := fmt.Sprint(data.Invoice.ID)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/invoice/preview/"+id, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	c.Set("ownerid", fixtures.DefaultOwnerID)
+	c.Set("logger", slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := ctrl.invoicePreviewPDF(c); err != nil {
+		t.Fatalf("invoicePreviewPDF error: %v", err)
+	}
+	if got := rec.Header().Get(echo.HeaderContentDisposition); !strings.HasPrefix(got, "inline;") || !strings.Contains(got, data.Invoice.Number+".pdf") {
+		t.Errorf("Content-Disposition = %q, want inline with the invoice number", got)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("body is not a PDF")
+	}
+}
+
+func TestEnsureInvoicePDF_DraftWatermarkNotCached(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	store.Config.XMLDir = t.TempDir()
+	ctrl := &controller{model: store}
+	owner := fixtures.DefaultOwnerID
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	watermarks := func(path string) int {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read pdf: %v", err)
+		}
+		return fixtures.PDFWatermarks(t, b)
+	}
+
+	inv, err := store.LoadInvoiceWithTemplate(data.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoiceWithTemplate failed: %v", err)
+	}
+	draftPath, err := ctrl.ensureInvoicePDF(inv, owner, false, logger)
+	if err != nil {
+		t.Fatalf("ensureInvoicePDF (draft) failed: %v", err)
+	}
+	if watermarks(draftPath) == 0 {
+		t.Errorf("draft PDF has no watermark")
+	}
+
+	if err := store.MarkInvoiceIssued(inv.ID, owner, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	inv, err = store.LoadInvoiceWithTemplate(data.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoiceWithTemplate failed: %v", err)
+	}
+	pdfPath, err := ctrl.ensureInvoicePDF(inv, owner, false, logger)
+	if err != nil {
+		t.Fatalf("ensureInvoicePDF (issued) failed: %v", err)
+	}
+	if pdfPath == draftPath {
+		t.Fatalf("issued invoice re-uses the draft PDF %s", draftPath)
+	}
+	if n := watermarks(pdfPath); n != 0 {
+		t.Errorf("issued PDF has %d watermarks", n)
+	}
+
+	// The status change drops the draft file and renders the cached PDF anew.
+	ctrl.regenerateInvoiceFiles(inv, owner)
+	if _, err := os.Stat(draftPath); !os.IsNotExist(err) {
+		t.Errorf("draft PDF still exists after issuing: %v", err)
+	}
+	if n := watermarks(pdfPath); n != 0 {
+		t.Errorf("regenerated PDF has %d watermarks", n)
+	}
+	if cached, err := ctrl.ensureInvoicePDF(inv, owner, false, logger); err != nil || cached != pdfPath {
+		t.Errorf("ensureInvoicePDF = %q, %v; want cached %q", cached, err, pdfPath)
+	}
+}
+
+func TestBindInvoice_PriceDecimals(t *testing.T) {
+	form := url.Values{}
+	form.Set("invoicepos[0].menge", "100000")
+	form.Set("invoicepos[0].einzelpreis", "0,0125")
+	form.Set("invoicepos[0].steuersatz", "19")
+
+	for _, tc := range []struct {
+		decimals  int
+		netPrice  string
+		lineTotal string
+	}{
+		{2, "0.01", "1000"},
+		{4, "0.0125", "1250"},
+	} {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/invoice/new", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("ownerid", fixtures.DefaultOwnerID)
+
+		mi, err := bindInvoice(c, tc.decimals, nil)
+		if err != nil {
+			t.Fatalf("bindInvoice(%d): %v", tc.decimals, err)
+		}
+		if len(mi.InvoicePositions) != 1 {
+			t.Fatalf("got %d positions, want 1", len(mi.InvoicePositions))
+		}
+		pos := mi.InvoicePositions[0]
+		if want := decimal.RequireFromString(tc.netPrice); !pos.NetPrice.Equal(want) {
+			t.Errorf("decimals %d: NetPrice = %s, want %s", tc.decimals, pos.NetPrice, want)
+		}
+		if want := decimal.RequireFromString(tc.lineTotal); !pos.LineTotal.Equal(want) {
+			t.Errorf("decimals %d: LineTotal = %s, want %s", tc.decimals, pos.LineTotal, want)
+		}
+	}
+}
+
+func TestInvoicePositionAdd(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+
+	post := func(id uint) (*httptest.ResponseRecorder, error) {
+		form := url.Values{}
+		form.Set("menge", "2")
+		form.Set("einzelpreis", "50,00")
+		form.Set("steuersatz", "7")
+		form.Set("leistungstext", "Support")
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/invoice/%d/position", id), strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set("HX-Request", "true")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(id))
+		c.Set("ownerid", fixtures.DefaultOwnerID)
+		c.Set("uid", fixtures.DefaultOwnerID)
+		return rec, ctrl.invoicePositionAdd(c)
+	}
+
+	before, err := store.LoadInvoice(data.Invoice.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	rec, err := post(data.Invoice.ID)
+	if err != nil {
+		t.Fatalf("invoicePositionAdd error: %v", err)
+	}
+	var result struct {
+		Positions []struct {
+			Position int    `json:"position"`
+			Text     string `json:"text"`
+		} `json:"positions"`
+		NetTotal decimal.Decimal `json:"net_total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("JSON unmarshal error: %v", err)
+	}
+	if n := len(result.Positions); n != len(before.InvoicePositions)+1 {
+		t.Fatalf("got %d positions, want %d", n, len(before.InvoicePositions)+1)
+	}
+	if last := result.Positions[len(result.Positions)-1]; last.Text != "Support" || last.Position != len(result.Positions) {
+		t.Errorf("last position = %+v, want Support at %d", last, len(result.Positions))
+	}
+	if want := before.NetTotal.Add(decimal.NewFromInt(100)); !result.NetTotal.Equal(want) {
+		t.Errorf("net_total = %s, want %s", result.NetTotal, want)
+	}
+
+	if err := store.MarkInvoiceIssued(data.Invoice.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	var he *echo.HTTPError
+	if _, err := post(data.Invoice.ID); !errors.As(err, &he) || he.Code != http.StatusForbidden {
+		t.Errorf("add to issued invoice: error = %v, want 403", err)
+	}
+}
+
+func TestInvoiceEdit_MemberKeepsCostPrice(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+	member := &model.User{Email: "member@example.com", Password: "-", OwnerID: data.User.ID, Role: model.RoleMember}
+	if err := store.CreateUser(member); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	positions := fixtures.SamplePositions()[:1]
+	positions[0].CostPrice = decimal.NewFromInt(80)
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(positions...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	stored, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+
+	// The member's form has no cost price field; a submitted one is ignored.
+	form := url.Values{}
+	form.Set("companyid", fmt.Sprint(data.Company.ID))
+	form.Set("invoicenumber", stored.Number)
+	form.Set("invoicepos[0].posid", fmt.Sprint(stored.InvoicePositions[0].ID))
+	form.Set("invoicepos[0].menge", "8")
+	form.Set("invoicepos[0].einzelpreis", "120")
+	form.Set("invoicepos[0].steuersatz", "19")
+	form.Set("invoicepos[0].einkaufspreis", "1")
+	form.Set("invoicepos[1].menge", "1")
+	form.Set("invoicepos[1].einzelpreis", "50")
+	form.Set("invoicepos[1].steuersatz", "19")
+	form.Set("invoicepos[1].einkaufspreis", "40")
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/invoice/edit/%d", inv.ID), strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(inv.ID))
+	c.Set("ownerid", fixtures.DefaultOwnerID)
+	c.Set("uid", member.ID)
+	if err := ctrl.invoiceEdit(c); err != nil {
+		t.Fatalf("invoiceEdit error: %v", err)
+	}
+
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if len(loaded.InvoicePositions) != 2 {
+		t.Fatalf("got %d positions, want 2", len(loaded.InvoicePositions))
+	}
+	if got := loaded.InvoicePositions[0].CostPrice; !got.Equal(decimal.NewFromInt(80)) {
+		t.Errorf("stored position: CostPrice = %s, want 80", got)
+	}
+	if got := loaded.InvoicePositions[1].CostPrice; !got.IsZero() {
+		t.Errorf("new position: CostPrice = %s, want 0", got)
+	}
+}
+
+func TestInvoiceListJSON_DecimalTotals(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+
+	// 103.74 net + 19.71 tax = 123.45 gross
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.Position(1, "Beratung", 1, 103.74, 19)),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/invoices?status=issued&format=json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("ownerid", fixtures.DefaultOwnerID)
+	c.Set("uid", fixtures.DefaultOwnerID)
+	c.Set("logger", slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := ctrl.invoiceList(c); err != nil {
+		t.Fatalf("invoiceList error: %v", err)
+	}
+	var result struct {
+		Items []struct {
+			ID         uint   `json:"id"`
+			NetTotal   string `json:"net_total"`
+			GrossTotal string `json:"gross_total"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("JSON unmarshal error: %v (%s)", err, rec.Body.String())
+	}
+	if len(result.Items) != 1 || result.Items[0].ID != inv.ID {
+		t.Fatalf("items = %+v, want invoice %d", result.Items, inv.ID)
+	}
+	if got := result.Items[0]; got.NetTotal != "103.74" || got.GrossTotal != "123.45" {
+		t.Errorf("net/gross = %s/%s, want 103.74/123.45", got.NetTotal, got.GrossTotal)
+	}
+}
+
+func TestInvoiceReminderPDF_GetDoesNotRaiseLevel(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	ctrl := &controller{model: store}
+
+	past := time.Now().AddDate(0, 0, -30)
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceDate(past),
+		fixtures.WithInvoiceDueDate(past.AddDate(0, 0, 14)),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, past); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	for range 2 {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/invoice/reminder/x", nil), httptest.NewRecorder())
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(inv.ID))
+		c.Set("ownerid", fixtures.DefaultOwnerID)
+		c.Set("uid", fixtures.DefaultOwnerID)
+		c.Set("logger", slog.New(slog.NewTextHandler(io.Discard, nil)))
+		var he *echo.HTTPError
+		if err := ctrl.invoiceReminderPDF(c); !errors.As(err, &he) || he.Code != http.StatusNotFound {
+			t.Fatalf("invoiceReminderPDF error = %v, want 404 without reminder", err)
+		}
+	}
+	got, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if got.ReminderLevel != 0 {
+		t.Errorf("ReminderLevel = %d after GET, want 0", got.ReminderLevel)
 	}
 }
@@ -36,6 +36,19 @@ func (ctrl *controller) letterheadList(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Could not load letterheads")
 	}
+	// Render previews that are missing, e.g. after they moved to the owner's
+	// uploads directory (best-effort).
+	for i := range list {
+		tpl := &list[i]
+		if tpl.PreviewPage1URL != "" {
+			continue
+		}
+		if _, _, url1, url2, err := ctrl.ensureLetterheadPreviews(ownerID, tpl); err == nil {
+			if ctrl.model.UpdateLetterheadPreviewURLs(tpl.ID, ownerID, url1, url2) == nil {
+				tpl.PreviewPage1URL, tpl.PreviewPage2URL = url1, url2
+			}
+		}
+	}
 
 	m := ctrl.defaultResponseMap(c, "Letterheads")
 	m["Templates"] = list
@@ -236,8 +249,7 @@ func (ctrl *controller) letterheadDelete(c echo.Context) error {
 
 	// 2) Remove preview files under /uploads (best-effort)
 	previewsDir := filepath.Join(
-		ctrl.uploadsDir(), "letterhead",
-		fmt.Sprintf("owner%d", ownerID),
+		ctrl.ownerUploadsDir(ownerID), "letterhead",
 		fmt.Sprintf("%d", id),
 	)
 	_ = os.RemoveAll(previewsDir)
@@ -62,7 +62,8 @@ func (ctrl *controller) mustBeOwnerOfTemplate(paramName string) echo.MiddlewareF
 			if !ok || ownerID == 0 {
 				return echo.NewHTTPError(http.StatusUnauthorized, "not authenticated")
 			}
-			isAdmin, _ := c.Get("is_admin").(bool)
+			role, _ := c.Get("role").(string)
+			isAdmin := role == model.RoleAdmin
 
 			idStr := c.Param(paramName)
 			idU64, err := strconv.ParseUint(idStr, 10, 64)
@@ -73,7 +74,7 @@ func (ctrl *controller) mustBeOwnerOfTemplate(paramName string) echo.MiddlewareF
 
 			// Call model-layer access function (no raw DB calls in controller).
 			var tpl *model.LetterheadTemplate
-			if tpl, err = ctrl.model.LoadLetterheadTemplateForAccess(tplID, ownerID, isAdmin); err != nil {
+			if tpl, err = ctrl.model.LoadLetterheadTemplateForAccess(tplID, ownerID, role); err != nil {
 				if err == gorm.ErrRecordNotFound {
 					return echo.NewHTTPError(http.StatusNotFound, "template not found")
 				}
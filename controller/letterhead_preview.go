@@ -37,9 +37,8 @@ func (ctrl *controller) ensureLetterheadPreviews(ownerID uint, tpl *model.Letter
 
 	// Previews are generated into the uploads directory.
 	outDir := filepath.Join(
-		ctrl.uploadsDir(),
+		ctrl.ownerUploadsDir(ownerID),
 		"letterhead",
-		fmt.Sprintf("owner%d", ownerID),
 		fmt.Sprintf("%d", tpl.ID),
 	)
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
@@ -54,13 +53,13 @@ func (ctrl *controller) ensureLetterheadPreviews(ownerID uint, tpl *model.Letter
 		return 0, 0, "", "", errors.New("no preview generated")
 	}
 
-	url1, err := ctrl.uploadsAbsToURL(pngs[0])
+	url1, err := ctrl.uploadsAbsToURL(ownerID, pngs[0])
 	if err != nil {
 		return 0, 0, "", "", err
 	}
 	var url2 string
 	if len(pngs) > 1 {
-		url2, err = ctrl.uploadsAbsToURL(pngs[1])
+		url2, err = ctrl.uploadsAbsToURL(ownerID, pngs[1])
 		if err != nil {
 			return 0, 0, "", "", err
 		}
@@ -49,8 +49,41 @@ func cookieOptions(maxAge int, cfg CookieCfg) *sessions.Options {
 	return opts
 }
 
+// sessionVersionKey holds the user's SessionVersion from login time. Sessions
+// from before the key existed count as version 0.
+const sessionVersionKey = "sessionversion"
+
+// lastSeenKey holds the unix time of the last authenticated request. Sessions
+// idle for longer than Config.IdleTimeoutMinutes end, with or without
+// remember me.
+const lastSeenKey = "last_seen"
+
+// sessionIdle reports whether a session last seen at lastSeen has been idle
+// longer than the configured timeout. Sessions from before the key existed
+// (lastSeen 0) are not idle.
+func (ctrl *controller) sessionIdle(lastSeen int64, now time.Time) bool {
+	idle := time.Duration(ctrl.model.Config.IdleTimeoutMinutes) * time.Minute
+	if idle <= 0 || lastSeen == 0 {
+		return false
+	}
+	return now.Sub(time.Unix(lastSeen, 0)) > idle
+}
+
+// sessionCookieSet reports whether the response already sets the session
+// cookie.
+func sessionCookieSet(c echo.Context) bool {
+	for _, v := range c.Response().Header().Values(echo.HeaderSetCookie) {
+		if strings.HasPrefix(v, "session=") {
+			return true
+		}
+	}
+	return false
+}
+
 // authMiddleware ensures a user is authenticated before accessing protected routes.
 // It reads uid/ownerid from the session; on failure it redirects to /login.
+// Sessions whose version no longer matches the user's SessionVersion (see
+// RevokeUserAccessImmediate) or whose user is gone are cleared.
 func (ctrl *controller) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		sw, err := LoadSession(c)
@@ -67,6 +100,22 @@ func (ctrl *controller) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if !ok || uid == 0 {
 			return c.Redirect(http.StatusSeeOther, "/login")
 		}
+		sessVersion, _ := sw.Values()[sessionVersionKey].(uint)
+		version, role, err := ctrl.model.UserSessionState(uid)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("cannot load session version: %w", err))
+		}
+		if err != nil || version != sessVersion {
+			_ = ClearSession(c)
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+		now := time.Now()
+		lastSeen, _ := sw.Values()[lastSeenKey].(int64)
+		if ctrl.sessionIdle(lastSeen, now) {
+			_ = ClearSession(c)
+			_ = AddFlash(c, "info", "Your session expired due to inactivity. Please sign in again.")
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
 		c.Set("uid", uid)
 
 		if v, exists := sw.Values()["ownerid"]; exists {
@@ -79,10 +128,19 @@ func (ctrl *controller) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.Redirect(http.StatusSeeOther, "/login")
 		}
 
-		// Simple admin flag example.
-		if uid == 1 {
+		c.Set("role", role)
+		if role == model.RoleAdmin {
 			c.Set("is_admin", true)
 		}
+
+		// Handlers that save the session store last_seen with it; otherwise
+		// the session is saved just before the response is written.
+		sw.Values()[lastSeenKey] = now.Unix()
+		c.Response().Before(func() {
+			if !sessionCookieSet(c) {
+				_ = sw.Save()
+			}
+		})
 		return next(c)
 	}
 }
@@ -104,6 +162,7 @@ func (ctrl *controller) login(c echo.Context) error {
 	// Authenticate (do not leak whether the user exists).
 	user, err := ctrl.model.AuthenticateUser(email, password)
 	if err != nil || user == nil {
+		ctrl.recordLoginEvent(c, nil, email, false)
 		if err := AddFlash(c, "error", "Login failed. Please check your input."); err != nil {
 			return ErrInvalid(err, "error while saving the session")
 		}
@@ -112,6 +171,7 @@ func (ctrl *controller) login(c echo.Context) error {
 
 	// Optional: require verified email.
 	if user.Verified == false {
+		ctrl.recordLoginEvent(c, user, email, false)
 		_ = AddFlash(c, "info", "Please confirm your email first. We've sent you instructions if needed.")
 		return c.Redirect(http.StatusSeeOther, "/login")
 	}
@@ -130,12 +190,15 @@ func (ctrl *controller) login(c echo.Context) error {
 		return user.ID // fallback for legacy data
 	}()
 	sw.Values()["persist"] = remember // this controls remember-me behavior
+	sw.Values()[sessionVersionKey] = user.SessionVersion
+	sw.Values()[lastSeenKey] = time.Now().Unix()
 
 	if err := sw.Save(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
 	_ = ctrl.model.TouchLastLogin(user) // best-effort
+	ctrl.recordLoginEvent(c, user, email, true)
 
 	loginOwnerID := user.OwnerID
 	if loginOwnerID == 0 {
@@ -146,6 +209,33 @@ func (ctrl *controller) login(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, "/")
 }
 
+// recordLoginEvent stores a login attempt with the client's address (best
+// effort). For failed attempts user may be nil; the event is then attributed
+// to the account with that email, if any, so its owner sees the attempt.
+func (ctrl *controller) recordLoginEvent(c echo.Context, user *model.User, email string, success bool) {
+	if user == nil {
+		user, _ = ctrl.model.GetUserByEMail(email)
+	}
+	ev := &model.LoginEvent{
+		Email:     email,
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		Success:   success,
+	}
+	if user != nil {
+		ev.UserID = user.ID
+		ev.OwnerID = user.OwnerID
+		if ev.OwnerID == 0 {
+			ev.OwnerID = user.ID // legacy data
+		}
+	}
+	if err := ctrl.model.RecordLoginEvent(ev); err != nil {
+		if logger, ok := c.Get("logger").(*slog.Logger); ok {
+			logger.Error("cannot record login event", "error", err)
+		}
+	}
+}
+
 // logout clears the session and deletes the cookie.
 // We bypass SessionWriter here to force MaxAge = -1 (cookie deletion) regardless of "persist".
 func (ctrl *controller) logout(c echo.Context) error {
@@ -157,6 +247,9 @@ func (ctrl *controller) logout(c echo.Context) error {
 	delete(sess.Values, "ownerid")
 	delete(sess.Values, "csrf")
 	delete(sess.Values, "persist")
+	delete(sess.Values, sessionVersionKey)
+	delete(sess.Values, sudoUIDKey)
+	delete(sess.Values, sudoExpKey)
 
 	// Force-delete the cookie for all browsers (including Safari).
 	if sess.Options == nil {
@@ -227,11 +320,20 @@ func (ctrl *controller) handlePasswordResetRequest(c echo.Context) error {
 	// Build absolute reset URL like: https://host/password/reset/<token>
 	resetURL := fmt.Sprintf("%s://%s/password/reset/%s", c.Scheme(), c.Request().Host, url.PathEscape(token))
 
-	body := fmt.Sprintf(
-		"Click the link to reset your password:\n\n%s\n\nThe link is valid for 60 minutes.",
-		resetURL,
-	)
-	_ = ctrl.sendEmail(email, "Reset your password", body)
+	subject, body, err := ctrl.model.RenderEmail(user.OwnerID, model.EmailTemplateKindPasswordReset, model.PasswordResetMailData{
+		Name:         user.FullName,
+		Email:        user.Email,
+		Link:         resetURL,
+		ValidMinutes: 60,
+	})
+	if err != nil {
+		logger.Error("cannot load password reset template", "error", err)
+	}
+	// The response stays the same, it must not reveal whether the account
+	// exists.
+	if err := ctrl.sendEmail(email, subject, body); err != nil {
+		logger.Error("cannot send password reset mail", "error", err)
+	}
 
 	return genericResponse()
 }
@@ -406,11 +508,13 @@ func (ctrl *controller) register(c echo.Context) error {
 	verifyURL := fmt.Sprintf("%s://%s/verify?token=%s", c.Scheme(), c.Request().Host, url.QueryEscape(signupToken))
 	_ = tokenHash // currently unused, kept for future hardening.
 
-	body := fmt.Sprintf(
-		"Please confirm your email for billingcat:\n\n%s\n\nThe link is valid for 30 minutes. If you did not request this, you can ignore this message.",
-		verifyURL,
-	)
-	_ = ctrl.sendEmail(email, "Confirm your email", body)
+	// There is no tenant yet, so the built-in texts are used.
+	subject, body, _ := ctrl.model.RenderEmail(0, model.EmailTemplateKindSignup, model.SignupMailData{
+		Email:        email,
+		Link:         verifyURL,
+		ValidMinutes: 30,
+	})
+	_ = ctrl.sendEmail(email, subject, body)
 
 	return neutral()
 }
@@ -531,6 +635,16 @@ func (ctrl *controller) handleSetPasswordSubmit(c echo.Context) error {
 		_ = AddFlash(c, "error", "Internal error. Please try again.")
 		return c.Redirect(http.StatusSeeOther, "/set-password")
 	}
+	// Usually done on signup already; accounts created before that have no
+	// row. Team members share the settings of the account owner.
+	ownerID := u.OwnerID
+	if ownerID == 0 {
+		ownerID = u.ID
+	}
+	if _, err := ctrl.model.EnsureSettings(ownerID); err != nil {
+		_ = AddFlash(c, "error", "Internal error. Please try again.")
+		return c.Redirect(http.StatusSeeOther, "/set-password")
+	}
 
 	// Clear the gate keys.
 	delete(sw.Values(), gateUIDKey)
@@ -538,7 +652,9 @@ func (ctrl *controller) handleSetPasswordSubmit(c echo.Context) error {
 
 	// Establish a normal signed-in session. No remember-me here (unless you add a checkbox).
 	sw.Values()["uid"] = u.ID
-	sw.Values()["ownerid"] = u.ID
+	sw.Values()["ownerid"] = ownerID
+	sw.Values()[sessionVersionKey] = u.SessionVersion
+	sw.Values()[lastSeenKey] = time.Now().Unix()
 	// NOTE: do not set "persist" here unless your form has a remember-me checkbox.
 
 	if err := sw.Save(); err != nil {
@@ -547,5 +663,6 @@ func (ctrl *controller) handleSetPasswordSubmit(c echo.Context) error {
 
 	_ = AddFlash(c, "success", "Your password has been set. Welcome!")
 	_ = ctrl.model.TouchLastLogin(u)
+	ctrl.recordLoginEvent(c, u, u.Email, true)
 	return c.Redirect(http.StatusSeeOther, "/")
 }
@@ -0,0 +1,409 @@
+package controller
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuthMiddleware_SessionVersion(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+
+	// /signin stands in for the login handler: it stores what login stores.
+	e.GET("/signin", func(c echo.Context) error {
+		u, err := store.GetUserByID(td.User.ID)
+		if err != nil {
+			return err
+		}
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = u.ID
+		sw.Values()["ownerid"] = u.OwnerID
+		sw.Values()[sessionVersionKey] = u.SessionVersion
+		return sw.Save()
+	})
+	e.GET("/protected", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, ctrl.authMiddleware)
+
+	signin := func() []*http.Cookie {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin", nil))
+		return rec.Result().Cookies()
+	}
+	get := func(cookies []*http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cookies := signin()
+	if code := get(cookies); code != http.StatusOK {
+		t.Fatalf("fresh session: status %d, want 200", code)
+	}
+	if err := store.RevokeUserAccessImmediate(context.Background(), td.User.ID); err != nil {
+		t.Fatalf("RevokeUserAccessImmediate failed: %v", err)
+	}
+	if code := get(cookies); code != http.StatusSeeOther {
+		t.Errorf("revoked session: status %d, want redirect to /login", code)
+	}
+	if code := get(signin()); code != http.StatusOK {
+		t.Errorf("new session after revocation: status %d, want 200", code)
+	}
+}
+
+func TestAuthMiddleware_IdleTimeout(t *testing.T) {
+	gob.Register(Flash{}) // done by the server setup in web.go
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	store.Config = &model.Config{IdleTimeoutMinutes: 30}
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+
+	// /signin?idle=<minutes> stores a session last seen that long ago.
+	e.GET("/signin", func(c echo.Context) error {
+		var minutes int
+		fmt.Sscan(c.QueryParam("idle"), &minutes)
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = td.User.ID
+		sw.Values()["ownerid"] = td.User.OwnerID
+		sw.Values()["persist"] = true
+		sw.Values()[sessionVersionKey] = uint(0)
+		sw.Values()[lastSeenKey] = time.Now().Add(-time.Duration(minutes) * time.Minute).Unix()
+		return sw.Save()
+	})
+	e.GET("/protected", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, ctrl.authMiddleware)
+
+	get := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	signin := func(idle string) []*http.Cookie {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin?idle="+idle, nil))
+		return rec.Result().Cookies()
+	}
+
+	// An active session is refreshed, so it stays valid after the request.
+	rec := get(signin("20"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("active session: status %d, want 200", rec.Code)
+	}
+	if rec = get(rec.Result().Cookies()); rec.Code != http.StatusOK {
+		t.Errorf("refreshed session: status %d, want 200", rec.Code)
+	}
+
+	// Remember me does not protect against the idle timeout.
+	if rec := get(signin("31")); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("idle session: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	store.Config.IdleTimeoutMinutes = 0
+	if rec := get(signin("600")); rec.Code != http.StatusOK {
+		t.Errorf("disabled timeout: status %d, want 200", rec.Code)
+	}
+}
+
+func TestAuthMiddleware_AdminRole(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+
+	e.GET("/signin", func(c echo.Context) error {
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = td.User.ID
+		sw.Values()["ownerid"] = td.User.OwnerID
+		sw.Values()[sessionVersionKey] = uint(0)
+		return sw.Save()
+	})
+	e.GET("/admin-only", func(c echo.Context) error {
+		if isAdmin, _ := c.Get("is_admin").(bool); !isAdmin {
+			t.Errorf("is_admin not set for admin")
+		}
+		return c.NoContent(http.StatusOK)
+	}, ctrl.authMiddleware, ctrl.adminMiddleware)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin", nil))
+	cookies := rec.Result().Cookies()
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/admin-only", nil)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The first user is no longer an admin just because of its ID.
+	if td.User.ID != 1 || td.User.Role != model.RoleOwner {
+		t.Fatalf("seed user: id %d, role %q", td.User.ID, td.User.Role)
+	}
+	if code := get(); code != http.StatusForbidden {
+		t.Errorf("owner: status %d, want 403", code)
+	}
+	td.User.Role = model.RoleAdmin
+	if err := store.UpdateUser(td.User); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("admin: status %d, want 200", code)
+	}
+}
+
+func TestSettingsLogoutOthers(t *testing.T) {
+	gob.Register(Flash{}) // done by the server setup in web.go
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+
+	e.GET("/signin", func(c echo.Context) error {
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = td.User.ID
+		sw.Values()["ownerid"] = td.User.OwnerID
+		sw.Values()[sessionVersionKey] = uint(0)
+		return sw.Save()
+	})
+	e.GET("/protected", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, ctrl.authMiddleware)
+	e.POST("/settings/logout-others", ctrl.settingsLogoutOthers, ctrl.authMiddleware)
+
+	do := func(method, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	here := do(http.MethodGet, "/signin", nil).Result().Cookies()
+	elsewhere := do(http.MethodGet, "/signin", nil).Result().Cookies()
+
+	rec := do(http.MethodPost, "/settings/logout-others", here)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/settings/profile" {
+		t.Fatalf("logout-others: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	here = rec.Result().Cookies()
+
+	if code := do(http.MethodGet, "/protected", here).Code; code != http.StatusOK {
+		t.Errorf("current session: status %d, want 200", code)
+	}
+	if code := do(http.MethodGet, "/protected", elsewhere).Code; code != http.StatusSeeOther {
+		t.Errorf("other session: status %d, want redirect to /login", code)
+	}
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	gob.Register(Flash{})
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	if err := store.SetPassword(td.User, "secret-pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateUser(td.User); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+
+	e.GET("/signin", func(c echo.Context) error {
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = td.User.ID
+		sw.Values()["ownerid"] = td.User.OwnerID
+		return sw.Save()
+	})
+	e.POST("/sensitive", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, ctrl.authMiddleware, ctrl.requireRecentAuth)
+	e.POST("/settings/confirm-password", ctrl.settingsConfirmPassword, ctrl.authMiddleware)
+
+	var cookies []*http.Cookie
+	do := func(method, path, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set("Referer", "http://example.com/settings/profile")
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if got := rec.Result().Cookies(); len(got) > 0 {
+			cookies = got
+		}
+		return rec
+	}
+	do(http.MethodGet, "/signin", "")
+
+	rec := do(http.MethodPost, "/sensitive", "")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/settings/confirm-password?next=%2Fsettings%2Fprofile" {
+		t.Fatalf("without sudo: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = do(http.MethodPost, "/settings/confirm-password", "password=wrong&next=/settings/profile")
+	if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "/settings/confirm-password") {
+		t.Errorf("wrong password: location %q", loc)
+	}
+	if code := do(http.MethodPost, "/sensitive", "").Code; code != http.StatusSeeOther {
+		t.Errorf("wrong password must not open the sudo window: status %d", code)
+	}
+	rec = do(http.MethodPost, "/settings/confirm-password", "password=secret-pass&next=//evil.example")
+	if loc := rec.Header().Get("Location"); loc != "/" {
+		t.Errorf("foreign next accepted: location %q", loc)
+	}
+	if code := do(http.MethodPost, "/sensitive", "").Code; code != http.StatusOK {
+		t.Errorf("within sudo window: status %d, want 200", code)
+	}
+}
+
+func TestLoginRecordsEvents(t *testing.T) {
+	gob.Register(Flash{}) // done by the server setup in web.go
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	if err := store.SetPassword(td.User, "right-password"); err != nil {
+		t.Fatal(err)
+	}
+	td.User.Verified = true
+	if err := store.UpdateUser(td.User); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+	e.POST("/login", ctrl.login)
+
+	login := func(email, password string) {
+		form := url.Values{"email": {email}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set("User-Agent", "test-agent")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	login(td.User.Email, "wrong-password")
+	login("nobody@example.com", "wrong-password")
+	login(td.User.Email, "right-password")
+
+	events, err := store.ListLoginEvents(td.User.ID, 20)
+	if err != nil {
+		t.Fatalf("ListLoginEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events for the user, want 2", len(events))
+	}
+	if !events[0].Success || events[1].Success {
+		t.Errorf("success flags: newest %v, older %v", events[0].Success, events[1].Success)
+	}
+	if events[1].Email != td.User.Email || events[1].UserAgent != "test-agent" || events[1].OwnerID != td.User.OwnerID {
+		t.Errorf("failed attempt recorded as %+v", events[1])
+	}
+
+	unknown, err := store.ListLoginEvents(0, 20)
+	if err != nil {
+		t.Fatalf("ListLoginEvents failed: %v", err)
+	}
+	if len(unknown) != 1 || unknown[0].Email != "nobody@example.com" || unknown[0].Success {
+		t.Errorf("attempt for unknown address: %+v", unknown)
+	}
+	for _, ev := range append(events, unknown...) {
+		if strings.Contains(fmt.Sprintf("%+v", ev), "password") {
+			t.Errorf("event contains the password: %+v", ev)
+		}
+	}
+}
+
+func TestSetPassword_TeamMember(t *testing.T) {
+	gob.Register(Flash{}) // done by the server setup in web.go
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	member := &model.User{Email: "member@example.com", Password: "-", OwnerID: td.User.ID, Role: model.RoleMember}
+	if err := store.CreateUser(member); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+
+	// /verified stands in for the verification link: it opens the gate.
+	e.GET("/verified", func(c echo.Context) error {
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["pw_setup_uid"] = member.ID
+		sw.Values()["pw_setup_exp"] = time.Now().Add(time.Minute).Unix()
+		return sw.Save()
+	})
+	e.POST("/set-password", ctrl.handleSetPasswordSubmit)
+	var ownerID any
+	e.GET("/whoami", func(c echo.Context) error {
+		ownerID = c.Get("ownerid")
+		return c.NoContent(http.StatusOK)
+	}, ctrl.authMiddleware)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/verified", nil))
+	form := url.Values{"password": {"new-secret"}, "confirmPassword": {"new-secret"}}
+	req := httptest.NewRequest(http.MethodPost, "/set-password", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	for _, ck := range rec.Result().Cookies() {
+		req.AddCookie(ck)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("set-password: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// The member works in the owner's account; no settings of its own.
+	req = httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	for _, ck := range rec.Result().Cookies() {
+		req.AddCookie(ck)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	if ownerID != td.User.ID {
+		t.Errorf("session owner = %v, want %d", ownerID, td.User.ID)
+	}
+	if s, err := store.LoadSettings(member.ID); err == nil && s.ID != 0 {
+		t.Errorf("settings created for the member (ID %d)", s.ID)
+	}
+}
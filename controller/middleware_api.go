@@ -2,9 +2,12 @@
 package controller
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
 )
 
@@ -28,18 +31,48 @@ func (ctrl *controller) APIKeyAuthMiddleware() echo.MiddlewareFunc {
 				return c.JSON(http.StatusUnauthorized, apiError("bad_token", "Use Bearer or Api-Key"))
 			}
 			rec, err := ctrl.model.ValidateAPIToken(parts[1])
+			if errors.Is(err, model.ErrTokenExpired) {
+				return c.JSON(http.StatusUnauthorized, apiError("token_expired", "Token has expired"))
+			}
 			if err != nil {
 				return c.JSON(http.StatusUnauthorized, apiError("unauthorized", "Unauthorized"))
 			}
 
+			// Best-effort: a failed write must not fail the request.
+			if err := ctrl.model.TouchAPIToken(rec); err != nil {
+				if logger, ok := c.Get("logger").(*slog.Logger); ok {
+					logger.Warn("update api token last use", "token_id", rec.ID, "error", err)
+				}
+			}
+
 			c.Set(string(ctxOwnerID), rec.OwnerID)
 			c.Set(string(ctxUserID), rec.UserID) // kann nil sein
-			c.Set(string(ctxScopes), rec.Scope)
+			c.Set(string(ctxScopes), rec.Scopes)
 			return next(c)
 		}
 	}
 }
 
+// requireScope rejects requests whose token lacks scope with 403. It runs
+// after APIKeyAuthMiddleware.
+func requireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !apiToken(c).HasScope(scope) {
+				return c.JSON(http.StatusForbidden, apiError("insufficient_scope", "Token lacks scope "+scope))
+			}
+			return next(c)
+		}
+	}
+}
+
+// apiToken returns the authenticated token as far as the handlers need it
+// (its scopes).
+func apiToken(c echo.Context) model.APIToken {
+	scopes, _ := c.Get(string(ctxScopes)).(string)
+	return model.APIToken{Scopes: scopes}
+}
+
 // small getters
 func apiOwnerID(c echo.Context) uint {
 	if v, ok := c.Get(string(ctxOwnerID)).(uint); ok {
@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"github.com/billingcat/crm/model"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 func (ctrl *controller) noteInit(e *echo.Echo) {
@@ -17,6 +20,24 @@ func (ctrl *controller) noteInit(e *echo.Echo) {
 	g.Use(ctrl.authMiddleware)
 	g.POST("/create", ctrl.CreateNote)
 	g.POST("/update/:id", ctrl.UpdateNote)
+	g.POST("/pin/:id", ctrl.PinNote)
+	g.POST("/delete/:id", ctrl.DeleteNote)
+	g.POST("/restore/:id", ctrl.RestoreNote)
+	g.POST("/reminder/:id/done", ctrl.NoteReminderDone)
+}
+
+// parseRemindAt parses the date of the reminder input; an empty value means
+// no reminder.
+func parseRemindAt(s string) (*time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 func (ctrl *controller) CreateNote(c echo.Context) error {
@@ -31,6 +52,11 @@ func (ctrl *controller) CreateNote(c echo.Context) error {
 	n.OwnerID = ownerID
 	n.AuthorID = userid
 	n.EditedAt = time.Now()
+	remindAt, err := parseRemindAt(c.FormValue("remind_at"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültiges Erinnerungsdatum")
+	}
+	n.RemindAt = remindAt
 
 	if err := ctrl.model.CreateNote(&n); err != nil {
 		return ErrInvalid(err, "Note konnte nicht gespeichert werden")
@@ -63,6 +89,10 @@ func (ctrl *controller) UpdateNote(c echo.Context) error {
 	if err := c.Bind(&form); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Ungültige Eingaben")
 	}
+	remindAt, err := parseRemindAt(c.FormValue("remind_at"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültiges Erinnerungsdatum")
+	}
 
 	n, err := ctrl.model.UpdateNoteContentAsAuthor(ownerID, authorID, noteID, form.Title, form.Body, form.Tags)
 	if err != nil {
@@ -71,9 +101,178 @@ func (ctrl *controller) UpdateNote(c echo.Context) error {
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Notiz konnte nicht aktualisiert werden")
 	}
+	if err = ctrl.model.SetNoteReminder(n.ID, ownerID, remindAt); err != nil {
+		return ErrInvalid(err, "Erinnerung konnte nicht gespeichert werden")
+	}
 
 	ctrl.model.LogAudit(ownerID, authorID, model.AuditActionUpdate, model.AuditEntityNote, n.ID, n.Title)
+	return noteParentRedirect(c, n)
+}
+
+// PinNote pins (pinned=1) or unpins a note of the current user.
+func (ctrl *controller) PinNote(c echo.Context) error {
+	authorID := c.Get("uid").(uint)
+	ownerID := c.Get("ownerid").(uint)
+	noteID, err := parseUintParam(c, "id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültige ID")
+	}
+
+	pinned := c.FormValue("pinned") == "1"
+	if err = ctrl.model.SetNotePinned(noteID, ownerID, authorID, pinned); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusForbidden, "Keine Berechtigung")
+		}
+		return ErrInvalid(err, "Notiz konnte nicht gespeichert werden")
+	}
+	n, err := ctrl.model.GetNoteByID(noteID, ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Notiz nicht gefunden")
+	}
+	return noteParentRedirect(c, n)
+}
+
+// DeleteNote soft-deletes a note of the current user and offers to undo it
+// with a flash on the parent's detail page.
+func (ctrl *controller) DeleteNote(c echo.Context) error {
+	authorID := c.Get("uid").(uint)
+	ownerID := c.Get("ownerid").(uint)
+	noteID, err := parseUintParam(c, "id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültige ID")
+	}
+
+	n, err := ctrl.model.GetNoteByID(noteID, ownerID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Notiz nicht gefunden")
+	}
+	if err = ctrl.model.DeleteNote(noteID, ownerID, authorID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusForbidden, "Keine Berechtigung")
+		}
+		return ErrInvalid(err, "Notiz konnte nicht gelöscht werden")
+	}
+	ctrl.model.LogAudit(ownerID, authorID, model.AuditActionDelete, model.AuditEntityNote, n.ID, n.Title)
+
+	sw, err := LoadSession(c)
+	if err != nil {
+		return ErrInvalid(err, "error loading session")
+	}
+	sw.AddFlash(Flash{
+		Kind:        "info",
+		Message:     "Notiz gelöscht.",
+		ActionURL:   fmt.Sprintf("/notes/restore/%d", n.ID),
+		ActionLabel: "Rückgängig",
+	})
+	if err = sw.Save(); err != nil {
+		return ErrInvalid(err, "error saving session")
+	}
+	return noteParentRedirect(c, n)
+}
+
+// RestoreNote undoes DeleteNote within model.NoteUndoWindow.
+func (ctrl *controller) RestoreNote(c echo.Context) error {
+	authorID := c.Get("uid").(uint)
+	ownerID := c.Get("ownerid").(uint)
+	noteID, err := parseUintParam(c, "id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültige ID")
+	}
+
+	n, err := ctrl.model.RestoreNote(noteID, ownerID, authorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Die Notiz kann nicht mehr wiederhergestellt werden")
+	}
+	if err != nil {
+		return ErrInvalid(err, "Notiz konnte nicht wiederhergestellt werden")
+	}
+	ctrl.model.LogAudit(ownerID, authorID, model.AuditActionUpdate, model.AuditEntityNote, n.ID, "Wiederhergestellt")
+	_ = AddFlash(c, "success", "Notiz wiederhergestellt.")
+	return noteParentRedirect(c, n)
+}
+
+// NoteReminderDone removes the reminder of a note and returns to the
+// dashboard, where due reminders are listed.
+func (ctrl *controller) NoteReminderDone(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	noteID, err := parseUintParam(c, "id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Ungültige ID")
+	}
+	if err = ctrl.model.SetNoteReminder(noteID, ownerID, nil); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Notiz nicht gefunden")
+		}
+		return ErrInvalid(err, "Erinnerung konnte nicht gespeichert werden")
+	}
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// dueReminder is a due note reminder as listed on the dashboard.
+type dueReminder struct {
+	NoteID     uint
+	Title      string
+	Body       string
+	RemindAt   time.Time
+	ParentName string
+	ParentURL  string
+}
+
+// dueReminders loads the due reminders of the owner together with the names
+// of and links to the notes' parents.
+func (ctrl *controller) dueReminders(ownerID uint, now time.Time) ([]dueReminder, error) {
+	notes, err := ctrl.model.DueReminders(ownerID, now)
+	if err != nil || len(notes) == 0 {
+		return nil, err
+	}
+	var companyIDs, personIDs []uint
+	for _, n := range notes {
+		switch n.ParentType {
+		case model.ParentTypeCompany:
+			companyIDs = append(companyIDs, n.ParentID)
+		case model.ParentTypePerson:
+			personIDs = append(personIDs, n.ParentID)
+		}
+	}
+	companies, err := ctrl.model.CompaniesByIDs(ownerID, companyIDs)
+	if err != nil {
+		return nil, err
+	}
+	people, err := ctrl.model.PeopleByIDs(ownerID, personIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]dueReminder, 0, len(notes))
+	for _, n := range notes {
+		r := dueReminder{
+			NoteID:   n.ID,
+			Title:    n.Title,
+			Body:     snippet(n.Body, 140),
+			RemindAt: *n.RemindAt,
+		}
+		switch n.ParentType {
+		case model.ParentTypeCompany:
+			if c0, ok := companies[n.ParentID]; ok {
+				r.ParentName = c0.Name
+				r.ParentURL = fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name))
+			}
+		case model.ParentTypePerson:
+			if p, ok := people[n.ParentID]; ok {
+				r.ParentName = p.Name
+				r.ParentURL = fmt.Sprintf("/person/%d/%s", p.ID, url.PathEscape(p.Name))
+			}
+		}
+		if r.ParentURL == "" {
+			continue // parent deleted
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
 
+// noteParentRedirect redirects to the detail page of the note's parent.
+func noteParentRedirect(c echo.Context, n *model.Note) error {
 	switch n.ParentType {
 	case model.ParentTypeCompany:
 		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/company/%d", n.ParentID))
@@ -3,31 +3,72 @@ package controller
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
 )
 
-// base directory for public uploads (Echo: e.Static("/uploads", "uploads")).
+// uploadsInit registers GET /uploads/*, which serves generated files such
+// as letterhead previews to the logged in owner.
+func (ctrl *controller) uploadsInit(e *echo.Echo) {
+	e.GET("/uploads/*", ctrl.uploadsServe, ctrl.authMiddleware)
+}
+
+// base directory for generated uploads, one subdirectory per owner (see
+// ownerUploadsDir).
 // We assume ctrl.cfg.BaseDir is the project root where the "uploads" folder is located.
 func (ctrl *controller) uploadsDir() string {
 	return filepath.Join(ctrl.model.Config.Basedir, "uploads")
 }
 
-// uploadsAbsToURL changes an absolute path (under uploadsDir) into a public URL
-// /uploads/<rel>.
-func (ctrl *controller) uploadsAbsToURL(abs string) (string, error) {
-	root := ctrl.uploadsDir()
+// ownerUploadsDir returns the directory of the owner's files below
+// uploadsDir. /uploads/<rel> of a logged in user maps to <rel> in here.
+func (ctrl *controller) ownerUploadsDir(ownerID uint) string {
+	return filepath.Join(ctrl.uploadsDir(), fmt.Sprintf("owner%d", ownerID))
+}
+
+// uploadsAbsToURL changes an absolute path (under the owner's uploads
+// directory) into the URL /uploads/<rel>. The URL does not contain the owner,
+// it is resolved against the owner of the session.
+func (ctrl *controller) uploadsAbsToURL(ownerID uint, abs string) (string, error) {
+	root := ctrl.ownerUploadsDir(ownerID)
 	rootAbs, _ := filepath.Abs(root)
 	absFile, _ := filepath.Abs(abs)
 
 	// Safety: absFile muss unter uploads liegen
-	if !strings.HasPrefix(absFile, rootAbs+string(os.PathSeparator)) && absFile != rootAbs {
+	if !strings.HasPrefix(absFile, rootAbs+string(os.PathSeparator)) {
 		return "", errors.New("file not under uploads root")
 	}
-	rel, err := filepath.Rel(root, absFile)
+	rel, err := filepath.Rel(rootAbs, absFile)
 	if err != nil {
 		return "", err
 	}
 	return "/uploads/" + filepath.ToSlash(rel), nil
 }
+
+// uploadsServe handles GET /uploads/*. It serves files from the current
+// owner's uploads directory only. Unsafe paths, directories and missing files
+// all get a 404, so that nothing outside the owner's directory can be told
+// apart from a file that does not exist.
+func (ctrl *controller) uploadsServe(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	rel, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+	abs, err := model.SafeRelPath(ctrl.ownerUploadsDir(ownerID), rel)
+	if err != nil {
+		return echo.ErrNotFound
+	}
+	fi, err := os.Stat(abs)
+	if err != nil || !fi.Mode().IsRegular() {
+		return echo.ErrNotFound
+	}
+	c.Response().Header().Set("Cache-Control", "private")
+	return c.File(abs)
+}
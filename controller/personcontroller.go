@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 
@@ -31,6 +30,8 @@ func (ctrl *controller) personInit(e *echo.Echo) {
 	g.POST("/:id/tags", ctrl.personTagsUpdate)
 	g.POST("/:id/depart", ctrl.personDepart)
 	g.POST("/:id/reactivate", ctrl.personReactivate)
+	g.GET("/duplicates", ctrl.personDuplicates)
+	g.POST("/merge", ctrl.personMerge)
 }
 
 // personForm models the HTML form payload for creating/updating a person.
@@ -46,7 +47,7 @@ type personForm struct {
 
 // personnew serves both GET (render form) and POST (create person).
 // GET /person/new           → blank form
-// GET /person/new/:company  → pre-filter companies list to the given company
+// GET /person/new/:company  → form with the given company preselected
 // POST /person/new          → create person and redirect to its detail page
 func (ctrl *controller) personnew(c echo.Context) error {
 	m := ctrl.defaultResponseMap(c, "Create New Contact")
@@ -54,27 +55,16 @@ func (ctrl *controller) personnew(c echo.Context) error {
 
 	switch c.Request().Method {
 	case http.MethodGet:
-		// If a company id is provided, load just that company; otherwise list all companies.
-		var companies []*model.Company
+		// A company id preselects that company; otherwise the company is
+		// picked with the typeahead (see companySuggest).
 		companyID := c.Param("company")
 		if companyID != "" {
 			cmpy, err := ctrl.model.LoadCompany(companyID, ownerID)
 			if err != nil {
 				return ErrInvalid(err, "Error loading company")
 			}
-			companies = []*model.Company{cmpy}
-		} else {
-			var err error
-			companies, err = ctrl.model.LoadAllCompanies(ownerID)
-			if err != nil {
-				return ErrInvalid(err, "Error loading companies")
-			}
-			// Sort alphabetically (case-insensitive) for a predictable dropdown order.
-			sort.Slice(companies, func(i, j int) bool {
-				return strings.ToLower(companies[i].Name) < strings.ToLower(companies[j].Name)
-			})
+			m["company"] = cmpy
 		}
-		m["companies"] = companies
 		m["persondetail"] = &model.Person{}
 		m["action"] = "/person/new"
 		m["submit"] = "Create Contact"
@@ -98,6 +88,13 @@ func (ctrl *controller) personnew(c echo.Context) error {
 			return ErrInvalid(err, "Error decoding form data")
 		}
 
+		// The company comes from the typeahead: make sure it is the owner's.
+		if pf.Firma != 0 {
+			if _, err := ctrl.model.LoadCompany(pf.Firma, ownerID); err != nil {
+				return ErrInvalid(err, "Error loading company")
+			}
+		}
+
 		personDB := model.Person{
 			Name:      strings.TrimSpace(pf.Name),
 			EMail:     strings.TrimSpace(pf.Email),
@@ -121,6 +118,7 @@ func (ctrl *controller) personnew(c echo.Context) error {
 				Type:       ci.Type,
 				Label:      ci.Label,
 				Value:      ci.Value,
+				IsPrimary:  ci.Primary,
 				OwnerID:    ownerID,
 				ParentType: model.ParentTypePerson, // safer than a magic string
 				// ParentID is set by SavePerson after create
@@ -152,6 +150,7 @@ func (ctrl *controller) deletePersonWithID(c echo.Context) error {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrInvalid(err, "Contact not found")
 		}
+		return ErrInvalid(err, "Error loading contact")
 	}
 	if personDB.OwnerID != ownerID {
 		return echo.ErrForbidden
@@ -236,7 +235,9 @@ func (ctrl *controller) personedit(c echo.Context) error {
 		m["submit"] = "Save"
 		m["showremove"] = true
 		m["persondetail"] = personDB
-		m["companies"] = []*model.Company{&personDB.Company} // keep denormalized company for templates
+		if personDB.CompanyID != 0 {
+			m["company"] = &personDB.Company // preset of the company typeahead
+		}
 		m["companyid"] = personDB.CompanyID
 		m["prefillTags"] = tagNames // template can JSON-encode this into Alpine state
 
@@ -268,11 +269,14 @@ func (ctrl *controller) personedit(c echo.Context) error {
 		dbPerson.CompanyID = pf.Firma
 
 		// (Optional) keep denormalized company on struct to avoid nil derefs in templates
-		company, err := ctrl.model.LoadCompany(pf.Firma, ownerID)
-		if err != nil {
-			return ErrInvalid(err, "Error loading company")
+		dbPerson.Company = model.Company{}
+		if pf.Firma != 0 {
+			company, err := ctrl.model.LoadCompany(pf.Firma, ownerID)
+			if err != nil {
+				return ErrInvalid(err, "Error loading company")
+			}
+			dbPerson.Company = *company
 		}
-		dbPerson.Company = *company
 
 		// Replace ContactInfos on save: collect provided set (model layer performs delete/insert)
 		dbPerson.ContactInfos = []model.ContactInfo{}
@@ -290,6 +294,7 @@ func (ctrl *controller) personedit(c echo.Context) error {
 				Type:       ci.Type,
 				Label:      ci.Label,
 				Value:      ci.Value,
+				IsPrimary:  ci.Primary,
 				OwnerID:    ownerID,
 				ParentType: model.ParentTypePerson, // polymorphic discriminator
 				// ParentID is set during save
@@ -393,3 +398,52 @@ func (ctrl *controller) personReactivate(c echo.Context) error {
 
 	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/person/%d", personID))
 }
+
+// personDuplicates lists people of the same company sharing an e-mail address.
+//
+// GET /person/duplicates
+func (ctrl *controller) personDuplicates(c echo.Context) error {
+	m := ctrl.defaultResponseMap(c, "Doppelte Kontakte")
+	ownerID := c.Get("ownerid").(uint)
+
+	groups, err := ctrl.model.FindDuplicatePersons(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Suchen doppelter Kontakte")
+	}
+	m["groups"] = groups
+	return c.Render(http.StatusOK, "personduplicates.html", m)
+}
+
+// personMerge merges the person "merge" into the person "keep".
+//
+// POST /person/merge
+func (ctrl *controller) personMerge(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+
+	keepID, err := strconv.ParseUint(c.FormValue("keep"), 10, 64)
+	if err != nil {
+		return ErrInvalid(err, "Invalid person ID")
+	}
+	mergeID, err := strconv.ParseUint(c.FormValue("merge"), 10, 64)
+	if err != nil {
+		return ErrInvalid(err, "Invalid person ID")
+	}
+
+	merged, err := ctrl.model.LoadPerson(uint(mergeID), ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Contact not found")
+	}
+	if err := ctrl.model.MergePersons(ownerID, uint(keepID), uint(mergeID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalid(err, "Contact not found")
+		}
+		return ErrInvalid(err, "Kontakte konnten nicht zusammengeführt werden")
+	}
+
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionDelete, model.AuditEntityPerson, merged.ID,
+		fmt.Sprintf("%s zusammengeführt mit #%d", merged.Name, keepID))
+	_ = AddFlash(c, "success", fmt.Sprintf("%s wurde zusammengeführt.", merged.Name))
+
+	return c.Redirect(http.StatusSeeOther, "/person/duplicates")
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func (ctrl *controller) productsInit(e *echo.Echo) {
+	g := e.Group("/products")
+	g.Use(ctrl.authMiddleware)
+	g.GET("", ctrl.productsList)
+	g.POST("", ctrl.productSave) // create or update a product
+	g.POST("/:id/delete", ctrl.productDelete)
+	g.GET("/suggest", ctrl.productsSuggest)
+}
+
+// productUnits are the unit codes offered for products, in the order of the
+// invoice editor.
+var productUnits = []struct{ Code, Label string }{
+	{"C62", "Stück"},
+	{"LS", "pauschal"},
+	{"HUR", "Stunden"},
+	{"DAY", "Tage"},
+	{"WEE", "Wochen"},
+	{"MON", "Monate"},
+}
+
+// GET /products
+// productsList shows the product catalog with a form for new products.
+func (ctrl *controller) productsList(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	products, err := ctrl.model.ListProducts(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Produkte nicht laden")
+	}
+	m := ctrl.defaultResponseMap(c, "Produkte")
+	m["products"] = products
+	m["units"] = productUnits
+	return c.Render(http.StatusOK, "products.html", m)
+}
+
+// POST /products
+// productSave creates (no id) or updates a product and returns to the list.
+func (ctrl *controller) productSave(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	var f struct {
+		ID       uint   `form:"id"`
+		Name     string `form:"name"`
+		Unit     string `form:"unit"`
+		NetPrice string `form:"netprice"`
+		TaxRate  string `form:"taxrate"`
+	}
+	if err := c.Bind(&f); err != nil {
+		return ErrInvalid(err, "Error processing form data")
+	}
+	p := &model.Product{
+		ID:          f.ID,
+		OwnerID:     ownerID,
+		Name:        f.Name,
+		DefaultUnit: f.Unit,
+	}
+	var err error
+	if v := strings.TrimSpace(f.NetPrice); v != "" {
+		if p.DefaultNetPrice, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			_ = AddFlash(c, "error", "Ungültiger Preis: "+v)
+			return c.Redirect(http.StatusSeeOther, "/products")
+		}
+	}
+	if v := strings.TrimSpace(f.TaxRate); v != "" {
+		if p.DefaultTaxRate, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			_ = AddFlash(c, "error", "Ungültiger Steuersatz: "+v)
+			return c.Redirect(http.StatusSeeOther, "/products")
+		}
+	}
+	if err := ctrl.model.SaveProduct(p); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		_ = AddFlash(c, "error", "Produkt konnte nicht gespeichert werden: "+err.Error())
+		return c.Redirect(http.StatusSeeOther, "/products")
+	}
+	_ = AddFlash(c, "success", "Produkt gespeichert.")
+	return c.Redirect(http.StatusSeeOther, "/products")
+}
+
+// POST /products/:id/delete
+func (ctrl *controller) productDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "Ungültige ID")
+	}
+	if err := ctrl.model.DeleteProduct(id, ownerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Kann Produkt nicht löschen")
+	}
+	_ = AddFlash(c, "success", "Produkt gelöscht.")
+	return c.Redirect(http.StatusSeeOther, "/products")
+}
+
+// productSuggestion is one entry of GET /products/suggest, with the values
+// the invoice editor copies into a position.
+type productSuggestion struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Unit     string `json:"unit"`
+	NetPrice string `json:"netprice"`
+	TaxRate  string `json:"taxrate"`
+}
+
+// GET /products/suggest?q=...
+func (ctrl *controller) productsSuggest(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	limit := 10
+	if s := strings.TrimSpace(c.QueryParam("limit")); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			limit = n
+		}
+	}
+	products, err := ctrl.model.SuggestProducts(ownerID, c.QueryParam("q"), limit)
+	if err != nil {
+		return ErrInvalid(err, "failed to query products")
+	}
+	out := make([]productSuggestion, len(products))
+	for i, p := range products {
+		out[i] = productSuggestion{
+			ID:       p.ID,
+			Name:     p.Name,
+			Unit:     p.DefaultUnit,
+			NetPrice: p.DefaultNetPrice.String(),
+			TaxRate:  p.DefaultTaxRate.String(),
+		}
+	}
+	return c.JSON(http.StatusOK, out)
+}
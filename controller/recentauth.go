@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Sudo gate: after re-entering the password, sensitive actions are allowed
+// for sudoWindow without asking again. Stored like the pw_setup gate.
+const (
+	sudoUIDKey = "sudo_uid"
+	sudoExpKey = "sudo_exp" // unix seconds
+	sudoWindow = 10 * time.Minute
+)
+
+// requireRecentAuth lets the request through if the user confirmed the
+// password within sudoWindow. Otherwise it sends the user to the password
+// prompt, which returns to the page the request came from (GET requests: the
+// page itself). The original POST is not replayed, the user submits it again.
+func (ctrl *controller) requireRecentAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		uid, _ := c.Get("uid").(uint)
+		sw, err := LoadSession(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		sudoUID, okUID := sw.Values()[sudoUIDKey].(uint)
+		exp, okExp := sw.Values()[sudoExpKey].(int64)
+		if okUID && okExp && sudoUID == uid && time.Now().Unix() <= exp {
+			return next(c)
+		}
+
+		back := c.Request().URL.RequestURI()
+		if c.Request().Method != http.MethodGet {
+			back = localReferer(c, "/")
+		}
+		_ = AddFlash(c, "info", "Bitte bestätige zuerst dein Passwort.")
+		return c.Redirect(http.StatusSeeOther, "/settings/confirm-password?next="+url.QueryEscape(back))
+	}
+}
+
+// settingsConfirmPassword shows the password prompt (GET) and opens the sudo
+// window on success (POST).
+func (ctrl *controller) settingsConfirmPassword(c echo.Context) error {
+	next := safeNext(c.QueryParam("next"))
+	if c.Request().Method == http.MethodGet {
+		m := ctrl.defaultResponseMap(c, "Passwort bestätigen")
+		m["next"] = next
+		return c.Render(http.StatusOK, "confirm_password.html", m)
+	}
+
+	next = safeNext(c.FormValue("next"))
+	uid := c.Get("uid").(uint)
+	err := ctrl.model.VerifyUserPassword(uid, c.FormValue("password"))
+	if errors.Is(err, model.ErrInvalidPassword) {
+		_ = AddFlash(c, "error", "Passwort falsch.")
+		return c.Redirect(http.StatusSeeOther, "/settings/confirm-password?next="+url.QueryEscape(next))
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot verify password")
+	}
+
+	sw, err := LoadSession(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	sw.Values()[sudoUIDKey] = uid
+	sw.Values()[sudoExpKey] = time.Now().Add(sudoWindow).Unix()
+	if err := sw.Save(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.Redirect(http.StatusSeeOther, next)
+}
+
+// localReferer returns the path of the Referer header if it points to this
+// site, else fallback.
+func localReferer(c echo.Context, fallback string) string {
+	ref, err := url.Parse(c.Request().Referer())
+	if err != nil || ref.Path == "" || (ref.Host != "" && ref.Host != c.Request().Host) {
+		return fallback
+	}
+	return safeNext(ref.RequestURI())
+}
+
+// safeNext only accepts local paths as redirect target (no "//host" or
+// "/\host" tricks).
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"github.com/xuri/excelize/v2"
+)
+
+// reportsInit wires the /reports routes. Reports show internal figures such
+// as cost and margin, so they are limited to the account owner.
+func (ctrl *controller) reportsInit(e *echo.Echo) {
+	g := e.Group("/reports", ctrl.authMiddleware, ctrl.requireTeamManager)
+	g.GET("/margins", ctrl.reportMargins)
+	g.GET("/tax", ctrl.reportTax)
+	g.GET("/datev", ctrl.reportDatev)
+}
+
+// marginRow is one month of the margin report.
+type marginRow struct {
+	Label string
+	model.MonthlyMargin
+}
+
+// reportMargins shows revenue, cost and margin per month of a year
+// (?year=2025, default: the current year) in the base currency.
+func (ctrl *controller) reportMargins(c echo.Context) error {
+	m := ctrl.defaultResponseMap(c, "Margen")
+	ownerID := c.Get("ownerid").(uint)
+
+	year := time.Now().Year()
+	if y, err := strconv.Atoi(c.QueryParam("year")); err == nil && y > 1900 && y < 3000 {
+		year = y
+	}
+	months, err := ctrl.model.MarginsByMonth(ownerID, year)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Berechnen der Margen")
+	}
+	rows := make([]marginRow, len(months))
+	total := model.MonthlyMargin{}
+	for i, mm := range months {
+		rows[i] = marginRow{Label: monthAbbrevDE[mm.Month-1], MonthlyMargin: mm}
+		total.Revenue = total.Revenue.Add(mm.Revenue)
+		total.Cost = total.Cost.Add(mm.Cost)
+		total.Margin = total.Margin.Add(mm.Margin)
+	}
+
+	m["year"] = year
+	m["prevyear"] = year - 1
+	m["nextyear"] = year + 1
+	m["months"] = rows
+	m["total"] = total
+	m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
+	return c.Render(http.StatusOK, "reports_margins.html", m)
+}
+
+// taxReportPeriod returns the first day of quarter (1–4) of year and the
+// first day after it. Quarter 0 is the whole year.
+func taxReportPeriod(year, quarter int) (from, to time.Time) {
+	if quarter < 1 || quarter > 4 {
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(1, 0, 0)
+	}
+	from = time.Date(year, time.Month(3*quarter-2), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 3, 0)
+}
+
+// reportTax shows net amounts and tax per tax category and rate of a quarter
+// (?year=2025&quarter=2; quarter 0 or missing: the whole year) for the VAT
+// return. With ?format=csv or ?format=xlsx the report is downloaded.
+func (ctrl *controller) reportTax(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+
+	year := time.Now().Year()
+	if y, err := strconv.Atoi(c.QueryParam("year")); err == nil && y > 1900 && y < 3000 {
+		year = y
+	}
+	quarter, _ := strconv.Atoi(c.QueryParam("quarter"))
+	if quarter < 0 || quarter > 4 {
+		quarter = 0
+	}
+	from, to := taxReportPeriod(year, quarter)
+	rows, err := ctrl.model.TaxReport(ownerID, from, to)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Berechnen der Steuerübersicht")
+	}
+	label := strconv.Itoa(year)
+	if quarter > 0 {
+		label = fmt.Sprintf("Q%d %d", quarter, year)
+	}
+
+	switch strings.ToLower(c.QueryParam("format")) {
+	case "csv":
+		return ctrl.reportTaxCSV(c, ownerID, taxReportFilename(year, quarter)+".csv", rows)
+	case "xlsx", "excel":
+		return ctrl.reportTaxXLSX(c, ownerID, taxReportFilename(year, quarter)+".xlsx", rows)
+	}
+
+	total := model.TaxReportRow{}
+	for _, r := range rows {
+		total.Net = total.Net.Add(r.Net)
+		total.Tax = total.Tax.Add(r.Tax)
+	}
+	m := ctrl.defaultResponseMap(c, "Steuerübersicht")
+	m["year"] = year
+	m["quarter"] = quarter
+	m["period"] = label
+	m["quarters"] = []int{1, 2, 3, 4}
+	m["prevyear"] = year - 1
+	m["nextyear"] = year + 1
+	m["rows"] = rows
+	m["total"] = total
+	m["basecurrency"] = ctrl.model.LoadBaseCurrency(ownerID)
+	return c.Render(http.StatusOK, "reports_tax.html", m)
+}
+
+// taxReportFilename returns the download name without extension, e.g.
+// "steuern_2025-Q2".
+func taxReportFilename(year, quarter int) string {
+	if quarter > 0 {
+		return fmt.Sprintf("steuern_%d-Q%d", year, quarter)
+	}
+	return fmt.Sprintf("steuern_%d", year)
+}
+
+// taxReportHeader returns the column names of the tax report export.
+func taxReportHeader(loc exportLocale) []string {
+	return []string{
+		loc.text("Kategorie", "Category"),
+		loc.text("Bezeichnung", "Description"),
+		loc.text("Steuersatz", "Tax rate"),
+		loc.text("Netto", "Net"),
+		loc.text("Steuer", "Tax"),
+		loc.text("Rechnungen", "Invoices"),
+	}
+}
+
+func (ctrl *controller) reportTaxCSV(c echo.Context, ownerID uint, filename string, rows []model.TaxReportRow) error {
+	loc := ctrl.ownerExportLocale(ownerID)
+	records := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		records = append(records, []string{
+			r.Category,
+			model.TaxCategoryLabel(r.Category),
+			strings.Replace(r.Rate.String(), ".", loc.decimalSep, 1),
+			loc.amount(r.Net),
+			loc.amount(r.Tax),
+			strconv.Itoa(r.Invoices),
+		})
+	}
+	return writeCSVDownload(c, loc, filename, taxReportHeader(loc), records)
+}
+
+func (ctrl *controller) reportTaxXLSX(c echo.Context, ownerID uint, filename string, rows []model.TaxReportRow) error {
+	loc := ctrl.ownerExportLocale(ownerID)
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+
+	for i, h := range taxReportHeader(loc) {
+		_ = f.SetCellValue(sheet, cell(1, i+1), h)
+	}
+	bold, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	_ = f.SetCellStyle(sheet, "A1", "F1", bold)
+	money, _ := f.NewStyle(&excelize.Style{NumFmt: 4}) // #,##0.00
+
+	for i, r := range rows {
+		row := i + 2
+		_ = f.SetCellValue(sheet, cell(row, 1), r.Category)
+		_ = f.SetCellValue(sheet, cell(row, 2), model.TaxCategoryLabel(r.Category))
+		_ = f.SetCellValue(sheet, cell(row, 3), r.Rate.InexactFloat64())
+		_ = f.SetCellValue(sheet, cell(row, 4), r.Net.InexactFloat64())
+		_ = f.SetCellValue(sheet, cell(row, 5), r.Tax.InexactFloat64())
+		_ = f.SetCellValue(sheet, cell(row, 6), r.Invoices)
+	}
+	if len(rows) > 0 {
+		_ = f.SetCellStyle(sheet, cell(2, 4), cell(len(rows)+1, 5), money)
+	}
+	_ = f.SetColWidth(sheet, "A", "A", 10)
+	_ = f.SetColWidth(sheet, "B", "B", 44)
+	_ = f.SetColWidth(sheet, "C", "F", 14)
+
+	c.Response().Header().Set(echo.HeaderContentType,
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return f.Write(c.Response())
+}
+
+// reportDatev downloads the issued and paid invoices from ?from= to ?to=
+// (both YYYY-MM-DD, inclusive) as a DATEV booking batch. Without a period,
+// or when the DATEV numbers are missing in the settings, it shows the form.
+func (ctrl *controller) reportDatev(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	m := ctrl.defaultResponseMap(c, "DATEV-Export")
+
+	now := time.Now()
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := firstOfMonth.AddDate(0, -1, 0) // default: the previous month
+	to := firstOfMonth.AddDate(0, 0, -1)
+	m["from"] = from
+	m["to"] = to
+
+	settings, err := ctrl.model.LoadSettings(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Einstellungen nicht laden")
+	}
+	settingsMissing := settings.DatevConsultantNumber == "" || settings.DatevClientNumber == ""
+	m["settingsmissing"] = settingsMissing
+
+	qFrom, qTo := parseListDate(c.QueryParam("from")), parseListDate(c.QueryParam("to"))
+	if qFrom == nil || qTo == nil || settingsMissing {
+		return c.Render(http.StatusOK, "reports_datev.html", m)
+	}
+	from, to = *qFrom, *qTo
+	m["from"], m["to"] = from, to
+	if to.Before(from) {
+		m["error"] = "Das Enddatum liegt vor dem Anfangsdatum."
+		return c.Render(http.StatusOK, "reports_datev.html", m)
+	}
+	if to.Year() != from.Year() {
+		// A booking batch must not span fiscal years; the fiscal year is
+		// taken to be the calendar year.
+		m["error"] = "Der Zeitraum muss innerhalb eines Kalenderjahres liegen."
+		return c.Render(http.StatusOK, "reports_datev.html", m)
+	}
+
+	bookings, err := ctrl.model.DatevBookings(ownerID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		if errors.Is(err, model.ErrDatevAccountMissing) {
+			m["error"] = "Für eine Rechnung fehlt das Erlöskonto: " + err.Error()
+			return c.Render(http.StatusOK, "reports_datev.html", m)
+		}
+		return ErrInvalid(err, "Fehler beim DATEV-Export")
+	}
+	header := model.DatevHeader{
+		Created:          now,
+		ConsultantNumber: settings.DatevConsultantNumber,
+		ClientNumber:     settings.DatevClientNumber,
+		FiscalYearStart:  time.Date(from.Year(), time.January, 1, 0, 0, 0, 0, time.UTC),
+		AccountLength:    cmp.Or(settings.DatevAccountLength, 4),
+		From:             from,
+		To:               to,
+		Label:            "Ausgangsrechnungen",
+		Currency:         cmp.Or(settings.BaseCurrency, "EUR"),
+	}
+
+	filename := fmt.Sprintf("EXTF_Buchungsstapel_%s_%s.csv", from.Format("20060102"), to.Format("20060102"))
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=windows-1252")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	res.WriteHeader(http.StatusOK)
+	return model.WriteDatevCSV(res, header, bookings)
+}
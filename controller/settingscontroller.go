@@ -2,6 +2,8 @@ package controller
 
 import (
 	"archive/zip"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -11,6 +13,8 @@ import (
 	"github.com/billingcat/crm/model"
 
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
 // settingsForm mirrors the profile/settings HTML form fields.
@@ -19,6 +23,7 @@ type settingsForm struct {
 	Companyname     string `form:"companyname"`
 	Contactperson   string `form:"contactperson"`
 	Ownemail        string `form:"ownemail"`
+	Ownphone        string `form:"ownphone"`
 	Address1        string `form:"address1"`
 	Address2        string `form:"address2"`
 	ZIP             string `form:"zip"`
@@ -27,14 +32,30 @@ type settingsForm struct {
 	VAT             string `form:"vat"`
 	TaxNo           string `form:"taxno"`
 	Invoicetemplate string `form:"invoicetemplate"`
-	Uselocalcounter bool   `form:"uselocalcounter"` // comes as "true"/"false"
-	Bankname        string `form:"bankname"`
-	Bankiban        string `form:"bankiban"`
-	Bankbic         string `form:"bankbic"`
-	CustomerPrefix  string `form:"custprefix"`  // e.g. "K-"
-	CustomerWidth   int    `form:"custwidth"`   // e.g. 5
-	CustomerCounter int64  `form:"custcounter"` // e.g. 1000
-	PDFEngine       string `form:"pdfengine"`   // "auto" | "speedata" | "boxesandglue"
+	DeliveryNoteTpl string `form:"deliverynotetemplate"` // empty means model default
+	Uselocalcounter bool   `form:"uselocalcounter"`      // comes as "true"/"false"
+	CustomerPrefix  string `form:"custprefix"`           // e.g. "K-"
+	CustomerWidth   int    `form:"custwidth"`            // e.g. 5
+	CustomerCounter int64  `form:"custcounter"`          // e.g. 1000
+	PDFEngine       string `form:"pdfengine"`            // "auto" | "speedata" | "boxesandglue"
+	RoundingMode    string `form:"roundingmode"`         // "total" | "line"
+	ReminderFee     string `form:"reminderfee"`          // e.g. "5,00"
+	PaymentTermDays int    `form:"paymenttermdays"`      // 0 = default (14 days)
+	Locale          string `form:"locale"`               // "de-DE" | "en-US"
+	PaymentRef      string `form:"paymentreference"`     // e.g. "RF%NR%"
+	FilenameTpl     string `form:"filenametemplate"`     // e.g. "Rechnung_%NR%"
+	CustomerMode    string `form:"custmode"`             // "numeric" | "freeform"
+	BaseCurrency    string `form:"basecurrency"`         // e.g. "EUR"
+	PriceDecimals   int    `form:"pricedecimals"`        // 2..4
+	DatevConsultant string `form:"datevconsultant"`      // Beraternummer
+	DatevClient     string `form:"datevclient"`          // Mandantennummer
+	DatevAccountLen int    `form:"datevaccountlength"`   // 4..8
+	DatevDebtor     string `form:"datevdebtor"`          // collective debtor account
+	DatevAccounts   string `form:"datevaccounts"`        // see model.ParseDatevAccounts
+	TaxNoteAEDE     string `form:"taxnoteaede"`          // empty means model default
+	TaxNoteAEEN     string `form:"taxnoteaeen"`
+	TaxNoteKDE      string `form:"taxnotekde"`
+	TaxNoteKEN      string `form:"taxnoteken"`
 }
 
 func (ctrl *controller) settingsInit(e *echo.Echo) {
@@ -46,12 +67,31 @@ func (ctrl *controller) settingsInit(e *echo.Echo) {
 	g.GET("/profile/delete-confirm", ctrl.settingsDeleteConfirm) // show password confirm page
 	g.POST("/profile/delete-confirm", ctrl.settingsDeleteDo)     // verify password, soft-delete
 	g.GET("/goodbye", ctrl.goodbye)                              // optional farewell page
-	g.POST("/tokens/create", ctrl.settingsTokenCreate)           // create a new API token
+	g.POST("/logout-others", ctrl.settingsLogoutOthers)          // end all other sessions
+	g.GET("/email", ctrl.settingsEmail, ctrl.requireRecentAuth)  // change the account email
+	g.POST("/email", ctrl.settingsEmail, ctrl.requireRecentAuth)
+	g.POST("/email/test", ctrl.settingsEmailTest)            // send a test mail to the own address
+	g.GET("/confirm-password", ctrl.settingsConfirmPassword) // password prompt for requireRecentAuth
+	g.POST("/confirm-password", ctrl.settingsConfirmPassword)
+	g.POST("/tokens/create", ctrl.settingsTokenCreate, ctrl.requireRecentAuth) // create a new API token
 	g.GET("/tokens/create", ctrl.settingsTokenCreate)
 	g.POST("/tokens/revoke/:id", ctrl.settingsTokenRevoke) // revoke an existing token
 	g.GET("/export/xml", ctrl.settingsExportXML)           // export data as XML
-	g.GET("", ctrl.settingslist)
-	g.POST("", ctrl.settingslist)
+
+	// Owner-wide settings, only for users who may manage the team.
+	g.GET("", ctrl.settingslist, ctrl.requireTeamManager)
+	g.POST("", ctrl.settingslist, ctrl.requireTeamManager)
+	g.GET("/customernumber/preview", ctrl.settingsCustomerNumberPreview, ctrl.requireTeamManager) // live preview in the settings form
+	g.GET("/team", ctrl.settingsTeam, ctrl.requireTeamManager)                                    // users of the owner and invitations
+	g.POST("/team/invite", ctrl.settingsTeamInvite, ctrl.requireTeamManager)
+	g.POST("/team/invitations/:id/delete", ctrl.settingsTeamInvitationDelete, ctrl.requireTeamManager)
+	g.POST("/bankaccounts", ctrl.settingsBankAccountSave, ctrl.requireTeamManager) // create or update a bank account
+	g.POST("/bankaccounts/:id/delete", ctrl.settingsBankAccountDelete, ctrl.requireTeamManager)
+	g.GET("/webhooks", ctrl.settingsWebhooks, ctrl.requireTeamManager) // webhooks for invoice status changes
+	g.POST("/webhooks", ctrl.settingsWebhookSave, ctrl.requireTeamManager)
+	g.POST("/webhooks/:id/delete", ctrl.settingsWebhookDelete, ctrl.requireTeamManager)
+	g.GET("/import", ctrl.settingsImportArchive, ctrl.requireTeamManager) // restore an export ZIP
+	g.POST("/import", ctrl.settingsImportArchive, ctrl.requireTeamManager)
 }
 
 // controller/views.go
@@ -83,6 +123,20 @@ func (ctrl *controller) settingslist(c echo.Context) error {
 			return ErrInvalid(err, "Error loading settings")
 		}
 		m["settings"] = settings
+		accounts, err := ctrl.model.ListBankAccounts(ownerID)
+		if err != nil {
+			return ErrInvalid(err, "Error loading bank accounts")
+		}
+		m["bankaccounts"] = accounts
+		m["newbankaccount"] = model.BankAccount{Currency: "EUR"}
+		m["datevdefaultdebtor"] = model.DefaultDatevDebtorAccount
+		m["datevdefaultaccounts"] = model.DefaultDatevAccounts
+		m["taxnotedefaults"] = map[string]string{
+			"AEDE": model.DefaultTaxNote("AE", "de"),
+			"AEEN": model.DefaultTaxNote("AE", "en"),
+			"KDE":  model.DefaultTaxNote("K", "de"),
+			"KEN":  model.DefaultTaxNote("K", "en"),
+		}
 		return c.Render(http.StatusOK, "settingslist.html", m)
 
 	case http.MethodPost:
@@ -106,27 +160,92 @@ func (ctrl *controller) settingslist(c echo.Context) error {
 			pdfEngine = string(model.PDFEngineAuto)
 		}
 
+		roundingMode := string(model.RoundingModeTotal)
+		if f.RoundingMode == string(model.RoundingModeLine) {
+			roundingMode = string(model.RoundingModeLine)
+		}
+
+		reminderFee := decimal.Zero
+		if fee := strings.TrimSpace(f.ReminderFee); fee != "" {
+			var err error
+			if reminderFee, err = decimal.NewFromString(commaperiod.Replace(fee)); err != nil || reminderFee.IsNegative() {
+				return ErrInvalid(fmt.Errorf("invalid reminder fee %q", fee), "Ungültige Mahngebühr")
+			}
+		}
+
+		customerMode := model.CustomerNumberNumeric
+		if f.CustomerMode == model.CustomerNumberFreeform {
+			customerMode = model.CustomerNumberFreeform
+		}
+
+		baseCurrency := strings.ToUpper(strings.TrimSpace(f.BaseCurrency))
+		if baseCurrency == "" {
+			baseCurrency = "EUR"
+		}
+		if !isCurrencyCode(baseCurrency) {
+			return ErrInvalid(fmt.Errorf("invalid base currency %q", f.BaseCurrency), "Ungültige Basiswährung")
+		}
+
+		datevAccountLength := f.DatevAccountLen
+		if datevAccountLength < 4 || datevAccountLength > 8 {
+			datevAccountLength = 4
+		}
+		datevConsultant := strings.TrimSpace(f.DatevConsultant)
+		datevClient := strings.TrimSpace(f.DatevClient)
+		datevDebtor := strings.TrimSpace(f.DatevDebtor)
+		for _, v := range []string{datevConsultant, datevClient, datevDebtor} {
+			if strings.Trim(v, "0123456789") != "" {
+				return ErrInvalid(fmt.Errorf("invalid DATEV number %q", v), "DATEV-Nummern und -Konten dürfen nur Ziffern enthalten")
+			}
+		}
+		datevAccounts := strings.TrimSpace(strings.ReplaceAll(f.DatevAccounts, "\r\n", "\n"))
+		if _, err := model.ParseDatevAccounts(datevAccounts); err != nil {
+			return ErrInvalid(err, "Ungültige DATEV-Kontenzuordnung: "+err.Error())
+		}
+
+		paymentTermDays := f.PaymentTermDays
+		if paymentTermDays < 0 {
+			paymentTermDays = 0
+		}
+
 		dbSettings := &model.Settings{
-			OwnerID:               ownerID,
-			CompanyName:           f.Companyname,
-			InvoiceContact:        f.Contactperson,
-			InvoiceEMail:          f.Ownemail,
-			Address1:              f.Address1,
-			Address2:              f.Address2,
-			ZIP:                   f.ZIP,
-			City:                  f.City,
-			CountryCode:           f.CountryCode,
-			VATID:                 f.VAT,
-			TAXNumber:             f.TaxNo,
-			InvoiceNumberTemplate: f.Invoicetemplate,
-			UseLocalCounter:       f.Uselocalcounter,
-			BankName:              f.Bankname,
-			BankIBAN:              f.Bankiban,
-			BankBIC:               f.Bankbic,
-			CustomerNumberPrefix:  f.CustomerPrefix,
-			CustomerNumberWidth:   f.CustomerWidth,
-			CustomerNumberCounter: f.CustomerCounter,
-			PDFEngine:             pdfEngine,
+			OwnerID:                    ownerID,
+			CompanyName:                f.Companyname,
+			InvoiceContact:             f.Contactperson,
+			InvoiceEMail:               f.Ownemail,
+			InvoicePhone:               f.Ownphone,
+			Address1:                   f.Address1,
+			Address2:                   f.Address2,
+			ZIP:                        f.ZIP,
+			City:                       f.City,
+			CountryCode:                f.CountryCode,
+			VATID:                      f.VAT,
+			TAXNumber:                  f.TaxNo,
+			InvoiceNumberTemplate:      f.Invoicetemplate,
+			DeliveryNoteNumberTemplate: strings.TrimSpace(f.DeliveryNoteTpl),
+			UseLocalCounter:            f.Uselocalcounter,
+			CustomerNumberPrefix:       f.CustomerPrefix,
+			CustomerNumberWidth:        f.CustomerWidth,
+			CustomerNumberCounter:      f.CustomerCounter,
+			PDFEngine:                  pdfEngine,
+			ReminderFee:                reminderFee,
+			RoundingMode:               roundingMode,
+			DefaultPaymentTermDays:     paymentTermDays,
+			Locale:                     model.NormalizeLocale(f.Locale),
+			PaymentReferenceTemplate:   strings.TrimSpace(f.PaymentRef),
+			InvoiceFilenameTemplate:    strings.TrimSpace(f.FilenameTpl),
+			CustomerNumberMode:         customerMode,
+			BaseCurrency:               baseCurrency,
+			PriceDecimals:              model.NormalizePriceDecimals(f.PriceDecimals),
+			DatevConsultantNumber:      datevConsultant,
+			DatevClientNumber:          datevClient,
+			DatevAccountLength:         datevAccountLength,
+			DatevDebtorAccount:         datevDebtor,
+			DatevAccounts:              datevAccounts,
+			TaxNoteAEDE:                strings.TrimSpace(f.TaxNoteAEDE),
+			TaxNoteAEEN:                strings.TrimSpace(f.TaxNoteAEEN),
+			TaxNoteKDE:                 strings.TrimSpace(f.TaxNoteKDE),
+			TaxNoteKEN:                 strings.TrimSpace(f.TaxNoteKEN),
 		}
 
 		if err := ctrl.model.SaveSettings(dbSettings); err != nil {
@@ -138,6 +257,68 @@ func (ctrl *controller) settingslist(c echo.Context) error {
 	return nil
 }
 
+// bankAccountForm is one row of the bank account list on the settings page.
+// ID 0 creates a new account.
+type bankAccountForm struct {
+	ID        uint   `form:"id"`
+	Label     string `form:"label"`
+	Name      string `form:"name"`
+	IBAN      string `form:"iban"`
+	BIC       string `form:"bic"`
+	Currency  string `form:"currency"`
+	IsDefault bool   `form:"isdefault"`
+}
+
+// settingsBankAccountSave creates or updates a bank account and returns to
+// the settings page.
+func (ctrl *controller) settingsBankAccountSave(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	f := new(bankAccountForm)
+	if err := c.Bind(f); err != nil {
+		return ErrInvalid(err, "Error processing form data")
+	}
+	if strings.TrimSpace(f.IBAN) == "" {
+		_ = AddFlash(c, "error", "Bitte eine IBAN angeben.")
+		return c.Redirect(http.StatusSeeOther, "/settings")
+	}
+	acc := &model.BankAccount{
+		ID:        f.ID,
+		OwnerID:   ownerID,
+		Label:     f.Label,
+		Name:      f.Name,
+		IBAN:      f.IBAN,
+		BIC:       f.BIC,
+		Currency:  f.Currency,
+		IsDefault: f.IsDefault,
+	}
+	if err := ctrl.model.SaveBankAccount(acc); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Kann Bankverbindung nicht speichern")
+	}
+	_ = AddFlash(c, "success", "Bankverbindung gespeichert.")
+	return c.Redirect(http.StatusSeeOther, "/settings")
+}
+
+// settingsBankAccountDelete removes a bank account and returns to the
+// settings page.
+func (ctrl *controller) settingsBankAccountDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "Ungültige ID")
+	}
+	if err := ctrl.model.DeleteBankAccount(id, ownerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Kann Bankverbindung nicht löschen")
+	}
+	_ = AddFlash(c, "success", "Bankverbindung gelöscht.")
+	return c.Redirect(http.StatusSeeOther, "/settings")
+}
+
 // showProfile renders the user profile page, including the list of API tokens
 // belonging to the user's owner/tenant.
 func (ctrl *controller) showProfile(c echo.Context) error {
@@ -154,9 +335,16 @@ func (ctrl *controller) showProfile(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load api tokens")
 	}
 
+	logins, err := ctrl.model.ListLoginEvents(u.ID, 20)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load login events")
+	}
+
 	m := ctrl.defaultResponseMap(c, "Profile")
 	m["user"] = u
 	m["tokens"] = tokens
+	m["logins"] = logins
+	m["apiscopes"] = apiScopeChoices
 	// m["newToken"] may optionally be set by the create handler
 	return c.Render(http.StatusOK, "profile.html", m)
 }
@@ -180,6 +368,67 @@ func (ctrl *controller) updateProfile(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, "/settings/profile")
 }
 
+// apiScopeChoices are the scope checkboxes of the token form.
+var apiScopeChoices = []struct {
+	Scope string
+	Label string
+}{
+	{model.ScopeCustomersRead, "Kunden lesen"},
+	{model.ScopeCustomersWrite, "Kunden anlegen"},
+	{model.ScopeInvoicesRead, "Rechnungen lesen"},
+	{model.ScopeInvoicesWrite, "Rechnungen anlegen"},
+	{model.ScopeStatsRead, "Statistiken lesen"},
+	{model.ScopeTokensWrite, "Tokens verwalten"},
+}
+
+// settingsLogoutOthers ends all sessions of the current user except this one
+// by bumping the session version and re-stamping this session with the new
+// version.
+func (ctrl *controller) settingsLogoutOthers(c echo.Context) error {
+	uid := c.Get("uid").(uint)
+	version, err := ctrl.model.BumpSessionVersion(uid)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot end sessions")
+	}
+	sw, err := LoadSession(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	sw.Values()[sessionVersionKey] = version
+	sw.AddFlash(Flash{Kind: "success", Message: "Alle anderen Sitzungen wurden beendet. Andere Geräte und Browser müssen sich neu anmelden, dieser Browser bleibt angemeldet."})
+	if err := sw.Save(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/settings/profile")
+}
+
+// settingsEmailTest sends a test mail to the current user and reports the
+// result as flash on the profile page.
+func (ctrl *controller) settingsEmailTest(c echo.Context) error {
+	uid := c.Get("uid").(uint)
+	logger := c.Get("logger").(*slog.Logger)
+	u, err := ctrl.model.GetUserByID(uid)
+	if err != nil {
+		return ErrInvalid(err, "Benutzer nicht gefunden")
+	}
+	body := "Diese E-Mail wurde über die Einstellungen von billingcat verschickt, um den E-Mail-Versand zu testen."
+	if err := ctrl.sendEmail(u.Email, "Test-E-Mail von billingcat", body); err != nil {
+		logger.Error("test mail failed", "error", err)
+		var ae *appError
+		if errors.As(err, &ae) {
+			err = ae.Err
+		}
+		_ = AddFlash(c, "error", "Die Test-E-Mail konnte nicht gesendet werden: "+err.Error())
+		return c.Redirect(http.StatusSeeOther, "/settings/profile")
+	}
+	if ctrl.mailTransport() == "log" {
+		_ = AddFlash(c, "info", "Es ist kein Mailserver eingerichtet, die Test-E-Mail wurde nur protokolliert.")
+	} else {
+		_ = AddFlash(c, "success", "Die Test-E-Mail wurde an "+u.Email+" gesendet.")
+	}
+	return c.Redirect(http.StatusSeeOther, "/settings/profile")
+}
+
 // settingsTokenCreate creates a new API token for the current user’s owner.
 // Returns the plaintext token directly on the profile page (no redirect),
 // because it can only be shown once.
@@ -196,9 +445,28 @@ func (ctrl *controller) settingsTokenCreate(c echo.Context) error {
 	}
 
 	name := strings.TrimSpace(c.FormValue("name"))
-	// MVP: no scopes/expiry yet
+	form, err := c.FormParams()
+	if err != nil {
+		return ErrInvalid(err, "Error processing form data")
+	}
+	scopes := form["scopes"]
+	if len(scopes) == 0 {
+		_ = AddFlash(c, "error", "Bitte mindestens eine Berechtigung auswählen.")
+		return c.Redirect(http.StatusSeeOther, "/settings/profile")
+	}
 	var expiresAt *time.Time
-	plain, _, err := ctrl.model.CreateAPIToken(u.OwnerID, &u.ID, name, "", expiresAt)
+	if days, err := strconv.Atoi(strings.TrimSpace(c.FormValue("expiresdays"))); err == nil && days > 0 {
+		t := time.Now().AddDate(0, 0, days)
+		expiresAt = &t
+	}
+	plain, _, err := ctrl.model.CreateAPIToken(u.OwnerID, &u.ID, name, strings.Join(scopes, ","), expiresAt)
+	if errors.Is(err, model.ErrUnknownScope) {
+		return ErrInvalid(err, "Unbekannte Berechtigung")
+	}
+	if errors.Is(err, model.ErrNoScope) {
+		_ = AddFlash(c, "error", "Bitte mindestens eine Berechtigung auswählen.")
+		return c.Redirect(http.StatusSeeOther, "/settings/profile")
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "cannot create api token")
 	}
@@ -209,10 +477,17 @@ func (ctrl *controller) settingsTokenCreate(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load api tokens")
 	}
 
+	logins, err := ctrl.model.ListLoginEvents(u.ID, 20)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load login events")
+	}
+
 	// Important: no redirect — show the plaintext token immediately
 	m := ctrl.defaultResponseMap(c, "Profile")
 	m["user"] = u
 	m["tokens"] = tokens
+	m["logins"] = logins
+	m["apiscopes"] = apiScopeChoices
 	m["newToken"] = plain // shown once in the template
 	return c.Render(http.StatusOK, "profile.html", m)
 }
@@ -379,3 +654,49 @@ func (ctrl *controller) settingsExportXML(c echo.Context) error {
 
 	return nil
 }
+
+// settingsImportArchive shows the upload form (GET) and imports a ZIP
+// written by settingsExportXML into the current owner (POST). With the
+// dry run checkbox set only the report of what would be created is shown.
+func (ctrl *controller) settingsImportArchive(c echo.Context) error {
+	m := ctrl.defaultResponseMap(c, "Datenimport")
+	if c.Request().Method == http.MethodGet {
+		return c.Render(http.StatusOK, "tenantimport.html", m)
+	}
+	ownerID := c.Get("ownerid").(uint)
+
+	fh, err := c.FormFile("archive")
+	if err != nil {
+		return ErrInvalid(err, "Bitte eine ZIP-Datei auswählen")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return ErrInvalid(err, "Datei kann nicht gelesen werden")
+	}
+	defer f.Close()
+	zr, err := zip.NewReader(f, fh.Size)
+	if err != nil {
+		return ErrInvalid(err, "Die Datei ist kein gültiges ZIP-Archiv")
+	}
+
+	report, err := ctrl.model.ImportTenantArchive(ownerID, zr, c.FormValue("dryrun") != "")
+	if err != nil {
+		return ErrInvalid(err, "Import fehlgeschlagen: "+err.Error())
+	}
+	m["report"] = report
+	return c.Render(http.StatusOK, "tenantimport.html", m)
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code (three
+// upper-case letters).
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSettingsRoutes_TeamMemberForbidden(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	member := &model.User{Email: "member@example.com", Password: "-", OwnerID: td.User.ID, Role: model.RoleMember}
+	if err := store.CreateUser(member); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))))
+	ctrl := &controller{model: store}
+	ctrl.settingsInit(e)
+
+	// /signin stands in for the login handler of the member.
+	e.GET("/signin", func(c echo.Context) error {
+		sw, err := LoadSession(c)
+		if err != nil {
+			return err
+		}
+		sw.Values()["uid"] = member.ID
+		sw.Values()["ownerid"] = td.User.ID
+		sw.Values()[sessionVersionKey] = member.SessionVersion
+		return sw.Save()
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin", nil))
+	cookies := rec.Result().Cookies()
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/settings"},
+		{http.MethodPost, "/settings"},
+		{http.MethodPost, "/settings/bankaccounts"},
+		{http.MethodPost, "/settings/bankaccounts/1/delete"},
+		{http.MethodGet, "/settings/webhooks"},
+		{http.MethodPost, "/settings/webhooks"},
+		{http.MethodPost, "/settings/webhooks/1/delete"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want 403", tc.method, tc.path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+)
+
+// defaultMailFrom is the sender when the configuration does not name one.
+const defaultMailFrom = "billingcat app <app@billingcat.de>"
+
+// mailTransport names the way sendEmail delivers mails: "smtp" when an SMTP
+// server is configured, "mailjet" in production mode without SMTP, "log"
+// (print to the console only) otherwise.
+func (ctrl *controller) mailTransport() string {
+	switch {
+	case ctrl.model.Config.SMTP.Configured():
+		return "smtp"
+	case ctrl.model.Config.Mode == "production":
+		return "mailjet"
+	default:
+		return "log"
+	}
+}
+
+// sendSMTPEmail sends a mail through the configured SMTP server.
+func (ctrl *controller) sendSMTPEmail(to, replyTo, subject, body string, attachments []emailAttachment) error {
+	cfg := ctrl.model.Config.SMTP
+	from := cfg.From
+	if from == "" {
+		from = defaultMailFrom
+	}
+	msg, err := buildMailMessage(from, to, replyTo, subject, body, attachments, time.Now())
+	if err != nil {
+		return err
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	toAddr, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+	return sendSMTP(cfg, fromAddr.Address, toAddr.Address, msg)
+}
+
+// sendSMTP delivers msg to one recipient. Depending on cfg.TLS the
+// connection uses implicit TLS, must be upgraded with STARTTLS, or stays
+// unencrypted.
+func sendSMTP(cfg model.SMTPConfig, from, to string, msg []byte) error {
+	mode := strings.ToLower(strings.TrimSpace(cfg.TLS))
+	if mode == "" {
+		mode = "starttls"
+	}
+	port := cfg.Port
+	if port == 0 {
+		switch mode {
+		case "tls":
+			port = 465
+		case "none":
+			port = 25
+		default:
+			port = 587
+		}
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+
+	var conn net.Conn
+	var err error
+	switch mode {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case "starttls", "none":
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("smtp: unknown TLS mode %q", cfg.TLS)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp: connect to %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if mode == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp: server does not support STARTTLS")
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+	}
+	if cfg.User != "" {
+		if err = c.Auth(smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return fmt.Errorf("smtp: sender %s: %w", from, err)
+	}
+	if err = c.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp: recipient %s: %w", to, err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		return fmt.Errorf("smtp: write message: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMailMessage renders a plain text mail (RFC 5322) with optional
+// attachments as multipart/mixed.
+func buildMailMessage(from, to, replyTo, subject, body string, attachments []emailAttachment, now time.Time) ([]byte, error) {
+	for _, h := range []string{from, to, replyTo, subject} {
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, errors.New("mail header contains a line break")
+		}
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := fromAddr.Address[strings.LastIndex(fromAddr.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", fromAddr.String())
+	header("To", to)
+	if replyTo != "" {
+		header("Reply-To", replyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain))
+	header("MIME-Version", "1.0")
+
+	if len(attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(part, body); err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		ct := a.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(ct, map[string]string{"name": a.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(a.Data)
+		for len(enc) > 76 {
+			fmt.Fprintf(part, "%s\r\n", enc[:76])
+			enc = enc[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", enc)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable writes s quoted-printable encoded with CRLF line
+// endings.
+func writeQuotedPrintable(w io.Writer, s string) error {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
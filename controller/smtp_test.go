@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/model"
+)
+
+func TestBuildMailMessage(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	msg, err := buildMailMessage("billingcat <app@example.com>", "kunde@example.org", "chef@example.com",
+		"Rechnung Nr. 2025-1 – März", "Hallo,\nanbei die Rechnung.", []emailAttachment{
+			{Filename: "2025-1.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte("%PDF"), 50)},
+		}, now)
+	if err != nil {
+		t.Fatalf("buildMailMessage failed: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("cannot parse message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if subject != "Rechnung Nr. 2025-1 – März" {
+		t.Errorf("subject = %q", subject)
+	}
+	if got := m.Header.Get("Reply-To"); got != "chef@example.com" {
+		t.Errorf("Reply-To = %q", got)
+	}
+	if !strings.HasSuffix(m.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Message-ID = %q", m.Header.Get("Message-ID"))
+	}
+
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	text, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(text) // multipart decodes quoted-printable
+	if string(b) != "Hallo,\r\nanbei die Rechnung." {
+		t.Errorf("text part = %q", b)
+	}
+	att, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if att.FileName() != "2025-1.pdf" || att.Header.Get("Content-Transfer-Encoding") != "base64" {
+		t.Errorf("attachment header = %v", att.Header)
+	}
+
+	if _, err := buildMailMessage("app@example.com", "a@example.org\r\nBcc: x@example.org", "", "Hi", "", nil, now); err == nil {
+		t.Errorf("expected error for header injection")
+	}
+}
+
+// TestSendSMTP talks to a minimal SMTP server without TLS and auth.
+func TestSendSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 test ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 test")
+			case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+				data.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				received <- data.String()
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	cfg := model.SMTPConfig{Host: host, Port: portNum, TLS: "none"}
+	if err := sendSMTP(cfg, "app@example.com", "kunde@example.org", []byte("Subject: Test\r\n\r\nHallo\r\n")); err != nil {
+		t.Fatalf("sendSMTP failed: %v", err)
+	}
+	select {
+	case got := <-received:
+		for _, want := range []string{"MAIL FROM:<app@example.com>", "RCPT TO:<kunde@example.org>", "Subject: Test\r\n"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("session lacks %q:\n%s", want, got)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+
+	if err := sendSMTP(model.SMTPConfig{Host: host, Port: cfg.Port, TLS: "ssl"}, "a@example.com", "b@example.com", nil); err == nil {
+		t.Errorf("expected error for unknown TLS mode")
+	}
+}
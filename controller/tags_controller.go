@@ -1,19 +1,59 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/billingcat/crm/model"
 	"github.com/labstack/echo/v4"
 )
 
 func (ctrl *controller) tagsInit(e *echo.Echo) {
 	g := e.Group("/tags")
 	g.Use(ctrl.authMiddleware)
-	g.GET("", ctrl.tagsSuggest)
+	g.GET("", ctrl.tagsOverview)
+	g.GET("/suggest", ctrl.tagsSuggest)
+	g.POST("/rename", ctrl.tagsRename)
 }
 
+// tagCloudEntry is a tag with the font size class for the tag cloud.
+type tagCloudEntry struct {
+	model.TagUsage
+	SizeClass string
+}
+
+var tagCloudSizes = []string{"text-sm", "text-base", "text-lg", "text-xl", "text-2xl"}
+
+// GET /tags
+// Overview of all tags in use on companies and persons.
+func (ctrl *controller) tagsOverview(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	usage, err := ctrl.model.TagUsageCounts(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Laden der Tags")
+	}
+
+	// usage is ordered by total, so the first entry is the most used tag.
+	cloud := make([]tagCloudEntry, len(usage))
+	for i, u := range usage {
+		step := int(u.Total * int64(len(tagCloudSizes)-1) / usage[0].Total)
+		cloud[i] = tagCloudEntry{TagUsage: u, SizeClass: tagCloudSizes[step]}
+	}
+	sort.Slice(cloud, func(i, j int) bool {
+		return strings.ToLower(cloud[i].Name) < strings.ToLower(cloud[j].Name)
+	})
+
+	m := ctrl.defaultResponseMap(c, "Tags")
+	m["right"] = "customers"
+	m["tags"] = usage
+	m["cloud"] = cloud
+	return c.Render(http.StatusOK, "tags.html", m)
+}
+
+// GET /tags/suggest?q=...
 func (ctrl *controller) tagsSuggest(c echo.Context) error {
 	ownerID := c.Get("ownerid").(uint)
 	q := strings.TrimSpace(c.QueryParam("q"))
@@ -30,3 +70,32 @@ func (ctrl *controller) tagsSuggest(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, names)
 }
+
+// POST /tags/rename
+// Renames a tag (form or JSON: old, new) on all companies and persons. If a
+// tag named "new" exists already, both are merged.
+func (ctrl *controller) tagsRename(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	var payload struct {
+		Old string `json:"old" form:"old"`
+		New string `json:"new" form:"new"`
+	}
+	if err := c.Bind(&payload); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+	if strings.TrimSpace(payload.Old) == "" || strings.TrimSpace(payload.New) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "old and new name required")
+	}
+
+	if err := ctrl.model.RenameTag(ownerID, payload.Old, payload.New); err != nil {
+		if errors.Is(err, model.ErrTagNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "tag not found")
+		}
+		return ErrInvalid(err, "Fehler beim Umbenennen des Tags")
+	}
+
+	if c.Request().Header.Get("HX-Request") != "" || c.Request().Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+	}
+	return c.Redirect(http.StatusSeeOther, "/company/list")
+}
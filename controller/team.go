@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+)
+
+const teamInvitationTTL = 7 * 24 * time.Hour
+
+// requireTeamManager lets only users through who may manage the team of
+// their owner. Must run after authMiddleware.
+func (ctrl *controller) requireTeamManager(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		u, err := ctrl.model.GetUserByID(c.Get("uid").(uint))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "cannot load user")
+		}
+		if !u.CanManageTeam() {
+			return echo.NewHTTPError(http.StatusForbidden, "only the account owner can manage the team")
+		}
+		return next(c)
+	}
+}
+
+// canManageTeam reports whether the current user may manage the team of
+// their owner. It also decides who sees internal figures like cost prices.
+func (ctrl *controller) canManageTeam(c echo.Context) bool {
+	u, err := ctrl.model.GetUserByID(c.Get("uid").(uint))
+	return err == nil && u.CanManageTeam()
+}
+
+// settingsTeam lists the users sharing the owner and the open invitations.
+func (ctrl *controller) settingsTeam(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	members, err := ctrl.model.ListTeamMembers(ownerID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load team")
+	}
+	invitations, err := ctrl.model.ListOpenTeamInvitations(ownerID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot load invitations")
+	}
+	m := ctrl.defaultResponseMap(c, "Team")
+	m["members"] = members
+	m["invitations"] = invitations
+	m["now"] = time.Now()
+	return c.Render(http.StatusOK, "settings_team.html", m)
+}
+
+// settingsTeamInvite sends an invitation link to the given address.
+func (ctrl *controller) settingsTeamInvite(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	uid := c.Get("uid").(uint)
+	logger := c.Get("logger").(*slog.Logger)
+
+	email := model.NormalizeEmail(c.FormValue("email"))
+	if !strings.Contains(email, "@") {
+		_ = AddFlash(c, "error", "Bitte eine gültige E-Mail-Adresse angeben.")
+		return c.Redirect(http.StatusSeeOther, "/settings/team")
+	}
+	taken, err := ctrl.model.EmailInUse(email, 0)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot check email")
+	}
+	if taken {
+		_ = AddFlash(c, "error", "Für diese E-Mail-Adresse gibt es bereits ein Konto.")
+		return c.Redirect(http.StatusSeeOther, "/settings/team")
+	}
+
+	token, tokenHash, err := generateRandomToken()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot generate token")
+	}
+	if _, err := ctrl.model.CreateTeamInvitation(ownerID, uid, email, tokenHash, teamInvitationTTL); err != nil {
+		logger.Error("cannot store team invitation", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot store invitation")
+	}
+
+	inviter := ""
+	if u, err := ctrl.model.GetUserByID(uid); err == nil {
+		inviter = u.FullName
+		if inviter == "" {
+			inviter = u.Email
+		}
+	}
+	joinURL := fmt.Sprintf("%s://%s/team/join?token=%s", c.Scheme(), c.Request().Host, url.QueryEscape(token))
+	subject, body, err := ctrl.model.RenderEmail(ownerID, model.EmailTemplateKindTeamInvitation, model.TeamInvitationMailData{
+		Inviter:   inviter,
+		Link:      joinURL,
+		ValidDays: int(teamInvitationTTL / (24 * time.Hour)),
+	})
+	if err != nil {
+		logger.Error("cannot load team invitation template", "error", err)
+	}
+	if err := ctrl.sendEmail(email, subject, body); err != nil {
+		logger.Error("cannot send team invitation", "error", err)
+		_ = AddFlash(c, "error", "Die Einladung wurde gespeichert, die E-Mail konnte aber nicht versendet werden.")
+		return c.Redirect(http.StatusSeeOther, "/settings/team")
+	}
+	_ = AddFlash(c, "success", "Einladung an "+email+" versendet.")
+	return c.Redirect(http.StatusSeeOther, "/settings/team")
+}
+
+// settingsTeamInvitationDelete withdraws an open invitation.
+func (ctrl *controller) settingsTeamInvitationDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return ErrInvalid(err, "invalid invitation id")
+	}
+	if err := ctrl.model.DeleteTeamInvitation(uint(id), ownerID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "invitation not found")
+	}
+	_ = AddFlash(c, "success", "Einladung zurückgezogen.")
+	return c.Redirect(http.StatusSeeOther, "/settings/team")
+}
+
+// teamJoin shows (GET) and processes (POST) the form behind the invitation
+// link. The new user gets the owner of the inviting user and can log in
+// afterwards.
+func (ctrl *controller) teamJoin(c echo.Context) error {
+	token := c.FormValue("token")
+	sum := sha256.Sum256([]byte(token))
+	inv, err := ctrl.model.FindTeamInvitation(sum[:])
+	if err != nil {
+		_ = AddFlash(c, "error", "Die Einladung ist ungültig oder abgelaufen.")
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	if c.Request().Method == http.MethodGet {
+		m := ctrl.defaultResponseMap(c, "Team beitreten")
+		m["token"] = token
+		m["email"] = inv.Email
+		return c.Render(http.StatusOK, "team_join.html", m)
+	}
+
+	fullName := strings.TrimSpace(c.FormValue("fullname"))
+	pass := c.FormValue("password")
+	if pass == "" || pass != c.FormValue("confirmPassword") {
+		_ = AddFlash(c, "error", "Bitte prüfe deine Eingabe (die Passwörter stimmen nicht überein).")
+		return c.Redirect(http.StatusSeeOther, "/team/join?token="+url.QueryEscape(token))
+	}
+	_, err = ctrl.model.AcceptTeamInvitation(sum[:], fullName, pass)
+	switch {
+	case errors.Is(err, model.ErrEmailTaken):
+		_ = AddFlash(c, "error", "Für diese E-Mail-Adresse gibt es bereits ein Konto.")
+		return c.Redirect(http.StatusSeeOther, "/login")
+	case errors.Is(err, model.ErrInvitationInvalid):
+		_ = AddFlash(c, "error", "Die Einladung ist ungültig oder abgelaufen.")
+		return c.Redirect(http.StatusSeeOther, "/login")
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, "cannot create account")
+	}
+	_ = AddFlash(c, "success", "Dein Konto wurde angelegt. Du kannst dich jetzt anmelden.")
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
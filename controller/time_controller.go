@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func (ctrl *controller) timeInit(e *echo.Echo) {
+	g := e.Group("/time")
+	g.Use(ctrl.authMiddleware)
+	g.GET("", ctrl.timeList)
+	g.POST("", ctrl.timeSave) // create or update a time entry
+	g.POST("/:id/delete", ctrl.timeDelete)
+	g.POST("/invoice", ctrl.timeInvoice)
+}
+
+// timeListURL returns the list URL, filtered by company when id is not 0.
+func timeListURL(companyID uint) string {
+	if companyID == 0 {
+		return "/time"
+	}
+	return fmt.Sprintf("/time?company=%d", companyID)
+}
+
+// GET /time?company=...
+// timeList shows the time entries, optionally of one company only, with a
+// form for new entries. With a company filter the unbilled entries can be
+// selected for a new invoice.
+func (ctrl *controller) timeList(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	var companyID uint
+	if s := c.QueryParam("company"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return ErrInvalid(err, "Ungültige Firma")
+		}
+		companyID = uint(id)
+	}
+	entries, err := ctrl.model.ListTimeEntries(ownerID, companyID, false)
+	if err != nil {
+		return ErrInvalid(err, "Kann Zeiten nicht laden")
+	}
+	allCompanies, err := ctrl.model.LoadAllCompanies(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Firmen nicht laden")
+	}
+	companyNames := make(map[uint]string, len(allCompanies))
+	var companies []*model.Company
+	for _, co := range allCompanies {
+		companyNames[co.ID] = co.Name
+		if co.ArchivedAt == nil {
+			companies = append(companies, co)
+		}
+	}
+	unbilled := 0
+	for _, e := range entries {
+		if !e.Billed {
+			unbilled++
+		}
+	}
+
+	m := ctrl.defaultResponseMap(c, "Zeiterfassung")
+	m["entries"] = entries
+	m["companies"] = companies
+	m["companynames"] = companyNames
+	m["companyid"] = companyID
+	m["unbilled"] = unbilled
+	m["today"] = time.Now()
+	return c.Render(http.StatusOK, "time.html", m)
+}
+
+// POST /time
+// timeSave creates (no id) or updates an unbilled time entry and returns to
+// the list of the entry's company.
+func (ctrl *controller) timeSave(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	var f struct {
+		ID          uint   `form:"id"`
+		CompanyID   uint   `form:"companyid"`
+		Date        string `form:"date"`
+		Hours       string `form:"hours"`
+		HourlyRate  string `form:"hourlyrate"`
+		Description string `form:"description"`
+	}
+	if err := c.Bind(&f); err != nil {
+		return ErrInvalid(err, "Error processing form data")
+	}
+	back := timeListURL(f.CompanyID)
+	t := &model.TimeEntry{
+		ID:          f.ID,
+		OwnerID:     ownerID,
+		CompanyID:   f.CompanyID,
+		Description: f.Description,
+	}
+	var err error
+	if t.Date, err = time.Parse("2006-01-02", strings.TrimSpace(f.Date)); err != nil {
+		_ = AddFlash(c, "error", "Ungültiges Datum: "+f.Date)
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+	if t.Hours, err = decimal.NewFromString(commaperiod.Replace(strings.TrimSpace(f.Hours))); err != nil {
+		_ = AddFlash(c, "error", "Ungültige Stundenzahl: "+f.Hours)
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+	if v := strings.TrimSpace(f.HourlyRate); v != "" {
+		if t.HourlyRate, err = decimal.NewFromString(commaperiod.Replace(v)); err != nil {
+			_ = AddFlash(c, "error", "Ungültiger Stundensatz: "+v)
+			return c.Redirect(http.StatusSeeOther, back)
+		}
+	}
+	if err := ctrl.model.SaveTimeEntry(t); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		if errors.Is(err, model.ErrTimeEntryBilled) {
+			_ = AddFlash(c, "error", "Abgerechnete Zeiten können nicht mehr geändert werden.")
+			return c.Redirect(http.StatusSeeOther, back)
+		}
+		_ = AddFlash(c, "error", "Zeit konnte nicht gespeichert werden: "+err.Error())
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+	_ = AddFlash(c, "success", "Zeit gespeichert.")
+	return c.Redirect(http.StatusSeeOther, back)
+}
+
+// POST /time/:id/delete
+func (ctrl *controller) timeDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "Ungültige ID")
+	}
+	back := timeListURL(0)
+	if cid, err := strconv.ParseUint(c.FormValue("companyid"), 10, 64); err == nil {
+		back = timeListURL(uint(cid))
+	}
+	if err := ctrl.model.DeleteTimeEntry(id, ownerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		if errors.Is(err, model.ErrTimeEntryBilled) {
+			_ = AddFlash(c, "error", "Abgerechnete Zeiten können nicht gelöscht werden.")
+			return c.Redirect(http.StatusSeeOther, back)
+		}
+		return ErrInvalid(err, "Kann Zeit nicht löschen")
+	}
+	_ = AddFlash(c, "success", "Zeit gelöscht.")
+	return c.Redirect(http.StatusSeeOther, back)
+}
+
+// POST /time/invoice
+// timeInvoice creates a draft invoice from the selected unbilled entries
+// (form: companyid, ids) and opens it in the editor.
+func (ctrl *controller) timeInvoice(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	var f struct {
+		CompanyID uint   `form:"companyid"`
+		IDs       []uint `form:"ids"`
+	}
+	if err := c.Bind(&f); err != nil {
+		return ErrInvalid(err, "Error processing form data")
+	}
+	back := timeListURL(f.CompanyID)
+	if len(f.IDs) == 0 {
+		_ = AddFlash(c, "error", "Bitte mindestens eine Zeit auswählen.")
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+	inv, err := ctrl.model.AsUser(c.Get("uid").(uint)).BuildInvoiceFromTimeEntries(ownerID, f.CompanyID, f.IDs)
+	if err != nil {
+		if errors.Is(err, model.ErrTimeEntryBilled) {
+			_ = AddFlash(c, "error", "Einige der gewählten Zeiten wurden bereits abgerechnet.")
+			return c.Redirect(http.StatusSeeOther, back)
+		}
+		return ErrInvalid(err, "Rechnung konnte nicht erstellt werden")
+	}
+
+	uid := c.Get("uid").(uint)
+	ctrl.model.LogAudit(ownerID, uid, model.AuditActionCreate, model.AuditEntityInvoice, inv.ID, inv.Number)
+
+	_ = AddFlash(c, "success", "Rechnungsentwurf aus Zeiten erstellt.")
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoice/edit/%d", inv.ID))
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// headerTraceparent is the W3C Trace Context header sent by the gateway.
+const headerTraceparent = "traceparent"
+
+// traceContext is the content of a traceparent header
+// (https://www.w3.org/TR/trace-context/), extended by the span of this
+// request.
+type traceContext struct {
+	TraceID  string // 32 hex digits, shared by all services of a trace
+	ParentID string // span of the caller
+	SpanID   string // span of this request
+	Flags    string // 2 hex digits, e.g. "01" = sampled
+}
+
+// parseTraceparent reads a traceparent header of the form
+// "00-<trace-id>-<parent-id>-<flags>" and starts a new span for this request.
+// ok is false if the header is missing or malformed, or uses the invalid
+// version ff or all-zero IDs. Unknown future versions are read like version 00,
+// as the specification asks.
+func parseTraceparent(h string) (tc traceContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 {
+		return tc, false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return tc, false
+	}
+	if !isLowerHex(traceID, 32) || !isLowerHex(parentID, 16) || !isLowerHex(flags, 2) {
+		return tc, false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return tc, false
+	}
+	return traceContext{TraceID: traceID, ParentID: parentID, SpanID: newSpanID(), Flags: flags}, true
+}
+
+// String returns the traceparent header that names this request's span as
+// the parent, for the response and for outgoing calls.
+func (tc traceContext) String() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+// isLowerHex reports whether s consists of n lowercase hex digits.
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newSpanID returns a random, non-zero span ID of 16 hex digits.
+func newSpanID() string {
+	var b [8]byte
+	for {
+		_, _ = rand.Read(b[:])
+		if b != [8]byte{} {
+			return hex.EncodeToString(b[:])
+		}
+	}
+}
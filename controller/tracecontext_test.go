@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	for _, tc := range []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"valid", "00-" + traceID + "-" + parentID + "-01", true},
+		{"not sampled", "00-" + traceID + "-" + parentID + "-00", true},
+		{"future version with extra field", "01-" + traceID + "-" + parentID + "-01-xyz", true},
+		{"empty", "", false},
+		{"version 00 with extra field", "00-" + traceID + "-" + parentID + "-01-xyz", false},
+		{"invalid version", "ff-" + traceID + "-" + parentID + "-01", false},
+		{"uppercase", "00-" + strings.ToUpper(traceID) + "-" + parentID + "-01", false},
+		{"short trace id", "00-4bf92f3577b34da6-" + parentID + "-01", false},
+		{"zero trace id", "00-" + strings.Repeat("0", 32) + "-" + parentID + "-01", false},
+		{"zero parent id", "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", false},
+		{"garbage", "hello", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseTraceparent(tc.header)
+			if ok != tc.ok {
+				t.Fatalf("parseTraceparent(%q) ok = %v, want %v", tc.header, ok, tc.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.TraceID != traceID || got.ParentID != parentID {
+				t.Errorf("trace/parent = %s/%s, want %s/%s", got.TraceID, got.ParentID, traceID, parentID)
+			}
+			if !isLowerHex(got.SpanID, 16) || got.SpanID == parentID {
+				t.Errorf("SpanID = %q, want a new span", got.SpanID)
+			}
+			if want := "00-" + traceID + "-" + got.SpanID + "-" + got.Flags; got.String() != want {
+				t.Errorf("String() = %q, want %q", got.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/labstack/echo/v4"
+)
+
+func TestUploadsServe_PerOwner(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	store.Config.Basedir = t.TempDir()
+	ctrl := &controller{model: store}
+	other := fixtures.DefaultOwnerID + 1
+	for owner, body := range map[uint]string{fixtures.DefaultOwnerID: "own", other: "foreign"} {
+		dir := filepath.Join(ctrl.ownerUploadsDir(owner), "letterhead", "1")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "page-1.png"), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := ctrl.uploadsAbsToURL(fixtures.DefaultOwnerID, filepath.Join(ctrl.ownerUploadsDir(fixtures.DefaultOwnerID), "letterhead", "1", "page-1.png"))
+	if err != nil || u != "/uploads/letterhead/1/page-1.png" {
+		t.Fatalf("uploadsAbsToURL = %q, %v", u, err)
+	}
+
+	for _, tc := range []struct {
+		rel    string
+		status int
+	}{
+		{"letterhead/1/page-1.png", http.StatusOK},
+		{"letterhead/1", http.StatusNotFound},
+		{"letterhead/2/page-1.png", http.StatusNotFound},
+		{"../owner2/letterhead/1/page-1.png", http.StatusNotFound},
+		{"..%2fowner2/letterhead/1/page-1.png", http.StatusNotFound},
+		{"owner2/letterhead/1/page-1.png", http.StatusNotFound},
+		{"letterhead/owner2/1/page-1.png", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/uploads/x", nil), rec)
+		c.SetParamNames("*")
+		c.SetParamValues(tc.rel)
+		c.Set("ownerid", fixtures.DefaultOwnerID)
+		err := ctrl.uploadsServe(c)
+		status := rec.Code
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+		} else if err != nil {
+			t.Fatalf("%s: %v", tc.rel, err)
+		}
+		if status != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.rel, status, tc.status)
+		}
+		if status == http.StatusOK && rec.Body.String() != "own" {
+			t.Errorf("%s: body = %q, want the owner's file", tc.rel, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// listParam returns the query parameter param of a list page. A valid value
+// is remembered as the user's preference key; without the parameter the
+// remembered value is returned, so that page size and sort order survive
+// navigation. Invalid values are returned unchanged (the caller falls back
+// to its default) but not stored.
+func (ctrl *controller) listParam(c echo.Context, param, key string, valid func(string) bool) string {
+	ownerID, _ := c.Get("ownerid").(uint)
+	uid, _ := c.Get("uid").(uint)
+	v := c.QueryParam(param)
+	if ownerID == 0 || uid == 0 {
+		return v
+	}
+	logger, _ := c.Get("logger").(*slog.Logger)
+	if v == "" {
+		stored, err := ctrl.model.GetUserPref(ownerID, uid, key)
+		if err != nil && logger != nil {
+			logger.Warn("cannot load user preference", "key", key, "error", err)
+		}
+		return stored
+	}
+	if valid(v) {
+		if err := ctrl.model.SetUserPref(ownerID, uid, key, v); err != nil && logger != nil {
+			logger.Warn("cannot save user preference", "key", key, "error", err)
+		}
+	}
+	return v
+}
+
+// pageSizeUpTo returns a validator for listParam that accepts page sizes
+// from 1 to max.
+func pageSizeUpTo(max int) func(string) bool {
+	return func(s string) bool {
+		n, err := strconv.Atoi(s)
+		return err == nil && n >= 1 && n <= max
+	}
+}
+
+// validInvoiceSort reports whether s is a sort order of the invoice list.
+func validInvoiceSort(s string) bool {
+	switch s {
+	case "date_desc", "date_asc", "due_asc", "due_desc", "total_asc", "total_desc":
+		return true
+	}
+	return false
+}
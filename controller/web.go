@@ -13,7 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path"
-	"sort"
+	"slices"
 	"strings"
 	"time"
 
@@ -35,6 +35,11 @@ import (
 type Flash struct {
 	Kind    string // "success" | "error" | "warning" | "info"
 	Message string
+
+	// Optional button next to the message, e.g. to undo a deletion. It is
+	// submitted as POST to ActionURL.
+	ActionURL   string
+	ActionLabel string
 }
 
 // FlashLoader pulls flash messages from the session (and clears them),
@@ -42,7 +47,7 @@ type Flash struct {
 func FlashLoader(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		path := c.Request().URL.Path
-		if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/uploads/") {
+		if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/uploads/") || isProbe(path) {
 			return next(c)
 		}
 		sw, err := LoadSession(c)
@@ -185,6 +190,39 @@ type lastChanges struct {
 	When time.Time
 }
 
+// revenueBar is one month of the revenue chart on the homepage. Percent is
+// the bar height relative to the best month.
+type revenueBar struct {
+	Label   string
+	Net     decimal.Decimal
+	Gross   decimal.Decimal
+	Percent int
+}
+
+var monthAbbrevDE = [...]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"}
+
+// revenueBars turns the monthly revenue into bars for the homepage chart.
+// It returns nil if there was no revenue at all.
+func revenueBars(months []model.MonthlyRevenue) []revenueBar {
+	maxNet := decimal.Zero
+	for _, m := range months {
+		if m.Net.GreaterThan(maxNet) {
+			maxNet = m.Net
+		}
+	}
+	if maxNet.IsZero() {
+		return nil
+	}
+	bars := make([]revenueBar, len(months))
+	for i, m := range months {
+		bars[i] = revenueBar{Label: monthAbbrevDE[m.Month-1], Net: m.Net, Gross: m.Gross}
+		if m.Net.IsPositive() {
+			bars[i].Percent = int(m.Net.Mul(decimal.NewFromInt(100)).Div(maxNet).IntPart())
+		}
+	}
+	return bars
+}
+
 // Safe HTML helpers for templates.
 func escape(s string) string { return html.EscapeString(s) }
 func safeLink(href, text string) template.HTML {
@@ -219,124 +257,28 @@ func (ctrl *controller) root(c echo.Context) error {
 		return ErrInvalid(err, "Fehler beim Laden der Änderungen")
 	}
 
-	changelog := make([]lastChanges, 0, len(hydr.Heads))
-
-	for _, h := range hydr.Heads {
-		switch h.ItemType {
-		case "company":
-			if c0, ok := hydr.Companies[h.ItemID]; ok {
-				coLink := safeLink(
-					fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name)),
-					c0.Name,
-				)
-				changelog = append(changelog, lastChanges{
-					Who:  owner.FullName,
-					What: template.HTML(fmt.Sprintf(`hat die Firma %s angelegt`, coLink)),
-					When: c0.CreatedAt,
-				})
-			}
-		case "invoice":
-			if iv, ok := hydr.Invoices[h.ItemID]; ok {
-				c0 := hydr.Companies[iv.CompanyID]
-				invLink := safeLink(fmt.Sprintf("/invoice/detail/%d", iv.ID), iv.Number)
-				var coLink template.HTML
-				if c0.ID != 0 {
-					coLink = safeLink(fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name)), c0.Name)
-				} else {
-					coLink = template.HTML(escape(fmt.Sprintf("Firma #%d", iv.CompanyID)))
-				}
-				changelog = append(changelog, lastChanges{
-					Who:  owner.FullName,
-					What: template.HTML(fmt.Sprintf(`hat die Rechnung %s (Firma %s) erstellt`, invLink, coLink)),
-					When: iv.CreatedAt,
-				})
-			}
-		case "note":
-			n, ok := hydr.Notes[h.ItemID]
-			if !ok {
-				continue // note might have been deleted
-			}
-
-			// short, safe excerpt
-			body := snippet(n.Body, 140)
-			bodyEsc := escape(body)
-
-			switch n.ParentType {
-			case model.ParentTypeCompany:
-				if c0, ok := hydr.Companies[n.ParentID]; ok {
-					target := safeLink(
-						fmt.Sprintf("/company/%d/%s", c0.ID, url.PathEscape(c0.Name)),
-						c0.Name,
-					)
-					changelog = append(changelog, lastChanges{
-						Who: owner.FullName,
-						What: template.HTML(fmt.Sprintf(
-							`hat eine Notiz zu %s erstellt: <span class="text-slate-600 italic">%s</span>`,
-							target, bodyEsc,
-						)),
-						When: n.CreatedAt,
-					})
-				} else {
-					// Fallback if company not available anymore
-					changelog = append(changelog, lastChanges{
-						Who: owner.FullName,
-						What: template.HTML(fmt.Sprintf(
-							`hat eine Notiz zu Firma #%d erstellt: <span class="text-slate-600 italic">%s</span>`,
-							n.ParentID, bodyEsc,
-						)),
-						When: n.CreatedAt,
-					})
-				}
-
-			case model.ParentTypePerson:
-				if p, ok := hydr.People[n.ParentID]; ok {
-					target := safeLink(
-						fmt.Sprintf("/person/%d/%s", p.ID, url.PathEscape(p.Name)),
-						p.Name,
-					)
-					changelog = append(changelog, lastChanges{
-						Who: owner.FullName,
-						What: template.HTML(fmt.Sprintf(
-							`hat eine Notiz zu %s erstellt: <span class="text-slate-600 italic">%s</span>`,
-							target, bodyEsc,
-						)),
-						When: n.CreatedAt,
-					})
-				} else {
-					changelog = append(changelog, lastChanges{
-						Who: owner.FullName,
-						What: template.HTML(fmt.Sprintf(
-							`hat eine Notiz zu Person #%d erstellt: <span class="text-slate-600 italic">%s</span>`,
-							n.ParentID, bodyEsc,
-						)),
-						When: n.CreatedAt,
-					})
-				}
-
-			default:
-				// Unknown parent type (should not happen)
-				changelog = append(changelog, lastChanges{
-					Who: owner.FullName,
-					What: template.HTML(fmt.Sprintf(
-						`hat eine Notiz erstellt: <span class="text-slate-600 italic">%s</span>`,
-						bodyEsc,
-					)),
-					When: n.CreatedAt,
-				})
-			}
-		}
-	}
-
-	// Heads are likely sorted already; enforce stability just in case.
-	sort.SliceStable(changelog, func(i, j int) bool { return changelog[i].When.After(changelog[j].When) })
+	changelog := activityChanges(hydr, owner.FullName)
 	if len(hydr.Companies) == 0 {
 		m["nocompanies"] = true
 	}
 	m["lastchanges"] = changelog
+	if reminders, err := ctrl.dueReminders(ownerID.(uint), time.Now()); err == nil {
+		m["reminders"] = reminders
+	}
+
+	year := time.Now().Year()
+	if months, err := ctrl.model.RevenueByMonth(ownerID.(uint), year); err == nil {
+		m["revenue"] = revenueBars(months)
+		m["revenueyear"] = year
+		m["showmargins"] = owner.CanManageTeam()
+	}
 	return c.Render(http.StatusOK, "main.html", m)
 }
 
 // search handles a small full-text search across companies and people.
+// Companies are searched by name; the optional query parameter fields (comma
+// separated, see model.CompanySearchFields) selects other columns, e.g.
+// fields=name,city,vat_id.
 func (ctrl *controller) search(c echo.Context) error {
 	var err error
 	ownerID := c.Get("ownerid").(uint)
@@ -362,7 +304,20 @@ func (ctrl *controller) search(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Search query cannot be empty")
 	}
 
-	companies, err := ctrl.model.FindAllCompaniesWithText(str, ownerID)
+	var fields []string
+	for _, f := range strings.Split(c.QueryParam("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			if !slices.Contains(model.CompanySearchFields, f) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Unknown search field: "+f)
+			}
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		fields = []string{"name"}
+	}
+
+	companies, err := ctrl.model.FindCompaniesAdvanced(str, ownerID, fields)
 	if err != nil {
 		return ErrInvalid(err, "Fehler beim Suchen der Firmen")
 	}
@@ -370,31 +325,73 @@ func (ctrl *controller) search(c echo.Context) error {
 	if err != nil {
 		return ErrInvalid(err, "Fehler beim Suchen der Kontakte")
 	}
+	contactMatches, err := ctrl.model.FindByContactInfo(ownerID, str)
+	if err != nil {
+		return ErrInvalid(err, "Fehler beim Suchen der Kontaktdaten")
+	}
 
+	// Source tells the client why an entry matched: "name" for a match on
+	// the name, "contactinfo" for a phone number, e-mail address etc. and
+	// the column for the other company fields ("city", "zip", "vat_id"). The
+	// matching value is then in Detail.
 	type searchResult struct {
 		Text   string `json:"text"`
 		Action string `json:"action"`
+		Source string `json:"source"`
+		Detail string `json:"detail,omitempty"`
 	}
 
-	searchResults := make([]searchResult, 0, len(companies)+len(people))
+	searchResults := make([]searchResult, 0, len(companies)+len(people)+len(contactMatches))
+	found := make(map[string]bool)
 
 	for _, company := range companies {
-		searchResults = append(searchResults, searchResult{
-			Text:   company.Name,
-			Action: fmt.Sprintf("/company/%d/%s", company.ID, url.PathEscape(company.Name)),
-		})
+		action := fmt.Sprintf("/company/%d/%s", company.ID, url.PathEscape(company.Name))
+		found[action] = true
+		res := searchResult{Text: company.Name, Action: action, Source: "name"}
+		if field, value := company.SearchMatch(str, fields); field != "" && field != "name" {
+			res.Source = field
+			res.Detail = value
+		}
+		searchResults = append(searchResults, res)
 	}
 
 	for _, person := range people {
+		action := fmt.Sprintf("/person/%d/%s", person.ID, url.PathEscape(person.Name))
+		found[action] = true
 		searchResults = append(searchResults, searchResult{
 			Text:   person.Name,
-			Action: fmt.Sprintf("/person/%d/%s", person.ID, url.PathEscape(person.Name)),
+			Action: action,
+			Source: "name",
+		})
+	}
+
+	for _, m := range contactMatches {
+		action := fmt.Sprintf("/%s/%d/%s", m.ParentType, m.ParentID, url.PathEscape(m.Name))
+		if found[action] {
+			continue
+		}
+		searchResults = append(searchResults, searchResult{
+			Text:   m.Name,
+			Action: action,
+			Source: "contactinfo",
+			Detail: m.Value,
 		})
 	}
 
 	return c.JSON(http.StatusOK, searchResults)
 }
 
+// POST /recent/clear
+// recentClear empties the "Zuletzt angesehen" list and returns to the page
+// the request came from.
+func (ctrl *controller) recentClear(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	if err := ctrl.model.ClearRecentItems(ownerID); err != nil {
+		return ErrInvalid(err, "Kann Verlauf nicht löschen")
+	}
+	return c.Redirect(http.StatusSeeOther, localReferer(c, "/"))
+}
+
 // NewController wires routes, middleware, renderer, and starts the server.
 func NewController(s *model.Store) error {
 	// Environment-driven logger: Dev=Text+Debug, Prod=JSON+Info
@@ -408,6 +405,10 @@ func NewController(s *model.Store) error {
 	// Register types used in gorilla/sessions (e.g., Flash) to avoid gob errors.
 	gob.Register(Flash{})
 	ctrl := controller{model: s}
+	s.StartRenderWorkers(s.Config.RenderWorkers, ctrl.renderInvoiceJob)
+	if err := s.ResumeWebhookDeliveries(); err != nil {
+		logger.Error("resume webhook deliveries", "error", err)
+	}
 
 	// Template functions available in views.
 	var templateFunc = template.FuncMap{
@@ -431,6 +432,16 @@ func NewController(s *model.Store) error {
 			return "unbekannt"
 		},
 		"rounddecimal": func(in decimal.Decimal) string { return in.Round(2).StringFixed(2) },
+		// roundprice shows a unit price with the owner's price decimals, see
+		// model.Settings.PriceDecimals.
+		"roundprice": func(in decimal.Decimal, decimals int) string {
+			n := int32(model.NormalizePriceDecimals(decimals))
+			return in.Round(n).StringFixed(n)
+		},
+		// primaryEmail / primaryPhone return the main contact info of a
+		// company or person (or nil), see model.Person.PrimaryEmail.
+		"primaryEmail": func(in interface{ PrimaryEmail() *model.ContactInfo }) *model.ContactInfo { return in.PrimaryEmail() },
+		"primaryPhone": func(in interface{ PrimaryPhone() *model.ContactInfo }) *model.ContactInfo { return in.PrimaryPhone() },
 		"invoiceStatus": func(in model.InvoiceStatus) string {
 			status := map[model.InvoiceStatus]string{
 				model.InvoiceStatusDraft:  "Entwurf",
@@ -555,9 +566,15 @@ func NewController(s *model.Store) error {
 			res := c.Response()
 			rid := res.Header().Get(echo.HeaderXRequestID)
 
-			reqLogger := slog.With(
-				"request_id", rid,
-			).WithGroup("http").With(
+			// Join the caller's trace if the gateway sent a traceparent
+			// header; the request ID is always logged.
+			ids := []any{"request_id", rid}
+			if tc, ok := parseTraceparent(req.Header.Get(headerTraceparent)); ok {
+				res.Header().Set(headerTraceparent, tc.String())
+				ids = append(ids, "trace_id", tc.TraceID, "span_id", tc.SpanID, "parent_span_id", tc.ParentID)
+			}
+
+			reqLogger := slog.With(ids...).WithGroup("http").With(
 				"method", req.Method,
 				"path", req.URL.Path,
 				"remote_ip", c.RealIP(),
@@ -710,38 +727,15 @@ func NewController(s *model.Store) error {
 	}
 
 	// CSRF protection. Cookie is Lax and Secure in prod.
-	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
-		TokenLength:    32,
-		TokenLookup:    "form:csrf,header:X-CSRF-Token",
-		CookieName:     "csrf",
-		CookiePath:     "/",
-		CookieHTTPOnly: true,
-		CookieSameSite: http.SameSiteLaxMode,
-		CookieSecure:   s.Config.Mode == "production",
-		Skipper: func(c echo.Context) bool {
-			// Static assets don't need CSRF and shouldn't have Set-Cookie set on them.
-			path := c.Request().URL.Path
-			if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/uploads/") {
-				return true
-			}
-			// allow POSTs to these endpoints without CSRF (e.g., public forms)
-			if c.Request().Method == http.MethodPost {
-				if strings.HasPrefix(c.Path(), "/password/reset") {
-					return true
-				}
-				if strings.HasPrefix(c.Path(), "/login") {
-					return true
-				}
-			}
-			return false
-		},
-	}))
+	e.Use(csrfMiddleware(s.Config.Mode == "production"))
 
 	e.Renderer = tmpl
 
 	// --- Routes
+	ctrl.healthInit(e)
 	e.GET("/", ctrl.root, ctrl.authMiddleware)
 	e.GET("/search", ctrl.search, ctrl.authMiddleware)
+	e.POST("/recent/clear", ctrl.recentClear, ctrl.authMiddleware)
 
 	e.GET("/login", ctrl.login)
 	e.POST("/login", ctrl.login)
@@ -750,6 +744,9 @@ func NewController(s *model.Store) error {
 	e.GET("/register", ctrl.register)
 	e.POST("/register", ctrl.register)
 	e.GET("/verify", ctrl.verifyEmail)
+	e.GET("/email/confirm", ctrl.confirmEmailChange)
+	e.GET("/team/join", ctrl.teamJoin)
+	e.POST("/team/join", ctrl.teamJoin)
 
 	e.GET("/set-password", ctrl.showSetPasswordForm)
 	e.POST("/set-password", ctrl.handleSetPasswordSubmit)
@@ -760,16 +757,21 @@ func NewController(s *model.Store) error {
 	e.POST("/password/reset", ctrl.handlePasswordResetRequest)
 
 	e.Static("/static", "static")
-	e.Static("/uploads", "uploads")
+	ctrl.uploadsInit(e)
 	// Feature modules
 	ctrl.invoiceInit(e)
+	ctrl.invoiceAttachmentInit(e)
 	ctrl.companyInit(e)
 	ctrl.personInit(e)
 	ctrl.tagsInit(e)
+	ctrl.productsInit(e)
+	ctrl.timeInit(e)
 	ctrl.settingsInit(e)
 	ctrl.emailTemplatesInit(e)
 	ctrl.fileManagerInit(e)
 	ctrl.noteInit(e)
+	ctrl.activityInit(e)
+	ctrl.reportsInit(e)
 	ctrl.adminInit(e)
 	ctrl.apiInit(e)
 	ctrl.letterheadInit(e)
@@ -825,7 +827,7 @@ func httpStatusToCode(status int) string {
 // shouldSkipAccessLog filters out noise from the access log (static assets, etc.).
 func shouldSkipAccessLog(c echo.Context) bool {
 	p := c.Request().URL.Path
-	if strings.HasPrefix(p, "/static/") || strings.HasPrefix(p, "/assets/") {
+	if strings.HasPrefix(p, "/static/") || strings.HasPrefix(p, "/assets/") || isProbe(p) {
 		return true
 	}
 	switch p {
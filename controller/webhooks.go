@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/billingcat/crm/model"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// webhookEventLabels are the German names of the webhook events.
+var webhookEventLabels = map[string]string{
+	model.WebhookEventInvoiceIssued: "Rechnung gestellt",
+	model.WebhookEventInvoicePaid:   "Rechnung bezahlt",
+	model.WebhookEventInvoiceVoided: "Rechnung storniert",
+}
+
+// settingsWebhooks lists the webhooks of the owner with their latest
+// deliveries.
+func (ctrl *controller) settingsWebhooks(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	hooks, err := ctrl.model.ListWebhooks(ownerID)
+	if err != nil {
+		return ErrInvalid(err, "Kann Webhooks nicht laden")
+	}
+	deliveries, err := ctrl.model.ListWebhookDeliveries(ownerID, 20)
+	if err != nil {
+		return ErrInvalid(err, "Kann Webhook-Zustellungen nicht laden")
+	}
+	urls := make(map[uint]string, len(hooks))
+	for _, h := range hooks {
+		urls[h.ID] = h.URL
+	}
+	m := ctrl.defaultResponseMap(c, "Webhooks")
+	m["webhooks"] = hooks
+	m["deliveries"] = deliveries
+	m["webhookurls"] = urls
+	m["events"] = model.WebhookEvents
+	m["eventlabels"] = webhookEventLabels
+	return c.Render(http.StatusOK, "settings_webhooks.html", m)
+}
+
+// settingsWebhookSave creates or updates a webhook. An empty secret keeps
+// the stored one; new webhooks get a generated secret.
+func (ctrl *controller) settingsWebhookSave(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	var f struct {
+		ID     uint     `form:"id"`
+		URL    string   `form:"url"`
+		Secret string   `form:"secret"`
+		Events []string `form:"events"`
+	}
+	if err := c.Bind(&f); err != nil {
+		return ErrInvalid(err, "Error processing form data")
+	}
+	if len(f.Events) == 0 {
+		_ = AddFlash(c, "error", "Bitte mindestens ein Ereignis auswählen.")
+		return c.Redirect(http.StatusSeeOther, "/settings/webhooks")
+	}
+	w := &model.Webhook{
+		ID:      f.ID,
+		OwnerID: ownerID,
+		URL:     f.URL,
+		Secret:  f.Secret,
+		Events:  model.JoinTags(f.Events),
+	}
+	if w.ID != 0 && strings.TrimSpace(w.Secret) == "" {
+		existing, err := ctrl.model.LoadWebhook(w.ID, ownerID)
+		if err != nil {
+			return ErrNotFound(err)
+		}
+		w.Secret = existing.Secret
+	}
+	if err := ctrl.model.SaveWebhook(w); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		_ = AddFlash(c, "error", "Webhook konnte nicht gespeichert werden: "+err.Error())
+		return c.Redirect(http.StatusSeeOther, "/settings/webhooks")
+	}
+	_ = AddFlash(c, "success", "Webhook gespeichert.")
+	return c.Redirect(http.StatusSeeOther, "/settings/webhooks")
+}
+
+// settingsWebhookDelete removes a webhook together with its deliveries.
+func (ctrl *controller) settingsWebhookDelete(c echo.Context) error {
+	ownerID := c.Get("ownerid").(uint)
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return ErrInvalid(err, "Ungültige ID")
+	}
+	if err := ctrl.model.DeleteWebhook(id, ownerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound(err)
+		}
+		return ErrInvalid(err, "Kann Webhook nicht löschen")
+	}
+	_ = AddFlash(c, "success", "Webhook gelöscht.")
+	return c.Redirect(http.StatusSeeOther, "/settings/webhooks")
+}
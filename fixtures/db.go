@@ -1,6 +1,7 @@
 package fixtures
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/billingcat/crm/model"
@@ -20,9 +21,42 @@ func NewTestStore(t *testing.T) *model.Store {
 	if err != nil {
 		t.Fatalf("failed to open test database: %v", err)
 	}
+	// Every connection to ":memory:" opens its own empty database, so tests
+	// that use goroutines must share a single connection.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return migrateTestStore(t, db)
+}
+
+// NewFileTestStore creates a SQLite database file in a temporary directory,
+// opened like the server opens its database (see model.SQLiteDSN). Unlike
+// NewTestStore it uses several connections, so tests of concurrent
+// transactions see real locking.
+func NewFileTestStore(t *testing.T) *model.Store {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(model.SQLiteDSN(filepath.Join(t.TempDir(), "test.db"))), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return migrateTestStore(t, db)
+}
+
+func migrateTestStore(t *testing.T, db *gorm.DB) *model.Store {
+	t.Helper()
 
 	// Auto-migrate all models
-	err = db.AutoMigrate(
+	err := db.AutoMigrate(
 		&model.User{},
 		&model.Company{},
 		&model.Person{},
@@ -39,8 +73,23 @@ func NewTestStore(t *testing.T) *model.Store {
 		&model.LetterheadTemplate{},
 		&model.PlacedRegion{},
 		&model.Invitation{},
+		&model.TeamInvitation{},
 		&model.AuditLog{},
+		&model.LoginEvent{},
 		&model.EmailTemplate{},
+		&model.Payment{},
+		&model.InvoiceAttachment{},
+		&model.InvoiceEvent{},
+		&model.IdempotencyKey{},
+		&model.InvoiceValidation{},
+		&model.BankAccount{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
+		&model.Product{},
+		&model.DeliveryNote{},
+		&model.TimeEntry{},
+		&model.UserPreference{},
+		&model.InvoiceCounter{},
 	)
 	if err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
@@ -0,0 +1,31 @@
+package fixtures
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+// PDFWatermarks counts the watermark artifacts in the deflated content
+// streams of a PDF, i.e. the pages stamped with the draft watermark.
+func PDFWatermarks(t *testing.T, data []byte) int {
+	t.Helper()
+	n := 0
+	for rest := data; ; {
+		i := bytes.Index(rest, []byte("stream\n"))
+		if i < 0 {
+			return n
+		}
+		rest = rest[i+len("stream\n"):]
+		end := bytes.Index(rest, []byte("endstream"))
+		if end < 0 {
+			return n
+		}
+		if r, err := zlib.NewReader(bytes.NewReader(rest[:end])); err == nil {
+			content, _ := io.ReadAll(r)
+			n += bytes.Count(content, []byte("/Subtype /Watermark"))
+		}
+		rest = rest[end+len("endstream"):]
+	}
+}
@@ -96,6 +96,10 @@ func WithCompanyTaxType(taxType string) CompanyOption {
 	return func(c *model.Company) { c.InvoiceTaxType = taxType }
 }
 
+func WithCompanyEInvoiceProfile(profile model.EInvoiceProfile) CompanyOption {
+	return func(c *model.Company) { c.EInvoiceProfile = profile }
+}
+
 // IntraComCompany returns a company configured for intra-community supply (reverse charge)
 func IntraComCompany(opts ...CompanyOption) *model.Company {
 	c := Company(
@@ -305,6 +309,10 @@ func WithSettingsCustomerNumberFormat(prefix string, width int) SettingsOption {
 	}
 }
 
+func WithSettingsNumberTemplate(tpl string) SettingsOption {
+	return func(s *model.Settings) { s.InvoiceNumberTemplate = tpl }
+}
+
 // --- Note ---
 
 type NoteOption func(*model.Note)
@@ -3,8 +3,10 @@ module github.com/billingcat/crm
 go 1.25.0
 
 require (
+	github.com/beevik/etree v1.6.0
 	github.com/biter777/countries v1.7.5
 	github.com/boxesandglue/bagme v0.0.12
+	github.com/boxesandglue/boxesandglue v0.2.38
 	github.com/gen2brain/go-fitz v1.24.15
 	github.com/glebarez/sqlite v1.11.0
 	github.com/go-playground/form/v4 v4.2.1
@@ -24,6 +26,7 @@ require (
 	github.com/xuri/excelize/v2 v2.9.1
 	github.com/yuin/goldmark v1.8.2
 	golang.org/x/crypto v0.54.0
+	golang.org/x/text v0.40.0
 	gorm.io/driver/postgres v1.6.0
 	gorm.io/gorm v1.25.12
 )
@@ -31,9 +34,7 @@ require (
 require (
 	github.com/PuerkitoBio/goquery v1.12.0 // indirect
 	github.com/andybalholm/cascadia v1.3.4 // indirect
-	github.com/beevik/etree v1.6.0 // indirect
 	github.com/boxesandglue/baseline-pdf v1.1.18 // indirect
-	github.com/boxesandglue/boxesandglue v0.2.38 // indirect
 	github.com/boxesandglue/csshtml v0.0.14 // indirect
 	github.com/boxesandglue/gofpdi v1.0.24 // indirect
 	github.com/boxesandglue/htmlbag v0.0.37 // indirect
@@ -75,7 +76,6 @@ require (
 	golang.org/x/net v0.57.0 // indirect
 	golang.org/x/sync v0.22.0 // indirect
 	golang.org/x/sys v0.47.0 // indirect
-	golang.org/x/text v0.40.0 // indirect
 	golang.org/x/time v0.8.0 // indirect
 	modernc.org/libc v1.22.5 // indirect
 	modernc.org/mathutil v1.5.0 // indirect
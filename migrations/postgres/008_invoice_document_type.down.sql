@@ -0,0 +1,2 @@
+ALTER TABLE invoices DROP COLUMN referenced_invoice_number;
+ALTER TABLE invoices DROP COLUMN document_type;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    invoice_id  BIGINT NOT NULL,
+    owner_id    BIGINT NOT NULL,
+    amount      TEXT NOT NULL,
+    date        TIMESTAMPTZ NOT NULL,
+    note        TEXT
+);
+
+CREATE INDEX idx_payments_invoice_id ON payments(invoice_id);
+CREATE INDEX idx_payments_owner_id ON payments(owner_id);
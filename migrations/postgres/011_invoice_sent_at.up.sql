@@ -0,0 +1,2 @@
+-- Remember when an invoice was emailed to the customer
+ALTER TABLE invoices ADD COLUMN sent_at timestamp with time zone;
@@ -0,0 +1,2 @@
+ALTER TABLE settings DROP COLUMN invoice_phone;
+ALTER TABLE companies DROP COLUMN einvoice_profile;
@@ -0,0 +1,3 @@
+-- Per-company e-invoice format (ZUGFeRD or XRechnung) and seller phone for XRechnung
+ALTER TABLE companies ADD COLUMN einvoice_profile TEXT NOT NULL DEFAULT 'zugferd';
+ALTER TABLE settings ADD COLUMN invoice_phone TEXT;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS invoice_attachments (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    invoice_id  BIGINT NOT NULL,
+    owner_id    BIGINT NOT NULL,
+    filename    TEXT NOT NULL,
+    path        TEXT NOT NULL,
+    mime        TEXT NOT NULL,
+    size        BIGINT NOT NULL
+);
+
+CREATE INDEX idx_invoice_attachments_invoice_id ON invoice_attachments(invoice_id);
+CREATE INDEX idx_invoice_attachments_owner_id ON invoice_attachments(owner_id);
@@ -0,0 +1,2 @@
+ALTER TABLE companies DROP COLUMN default_payment_term_days;
+ALTER TABLE settings DROP COLUMN default_payment_term_days;
@@ -0,0 +1,3 @@
+-- Default payment term in days (0 = fall back to settings, then 14 days)
+ALTER TABLE settings ADD COLUMN default_payment_term_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE companies ADD COLUMN default_payment_term_days INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invoice_events (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    invoice_id  BIGINT NOT NULL,
+    owner_id    BIGINT NOT NULL,
+    user_id     BIGINT NOT NULL DEFAULT 0,
+    kind        TEXT NOT NULL,
+    detail      TEXT
+);
+
+CREATE INDEX idx_invoice_events_invoice_id ON invoice_events(invoice_id);
+CREATE INDEX idx_invoice_events_owner_id ON invoice_events(owner_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_companies_archived_at;
+ALTER TABLE companies DROP COLUMN archived_at;
@@ -0,0 +1,3 @@
+-- Archived companies are hidden from the customer list
+ALTER TABLE companies ADD COLUMN archived_at TIMESTAMPTZ;
+CREATE INDEX idx_companies_archived_at ON companies(archived_at);
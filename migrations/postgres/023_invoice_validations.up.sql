@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invoice_validations (
+    id            BIGSERIAL PRIMARY KEY,
+    invoice_id    BIGINT NOT NULL,
+    owner_id      BIGINT NOT NULL,
+    validated_at  TIMESTAMPTZ NOT NULL,
+    problems_json TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_invoice_validations_invoice ON invoice_validations(invoice_id);
+CREATE INDEX idx_invoice_validations_owner_id ON invoice_validations(owner_id);
@@ -0,0 +1,20 @@
+-- Several bank accounts per owner; the account in settings becomes the default
+CREATE TABLE IF NOT EXISTS bank_accounts (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    owner_id   BIGINT NOT NULL,
+    label      VARCHAR(100),
+    iban       VARCHAR(34) NOT NULL,
+    bic        VARCHAR(11),
+    name       VARCHAR(200),
+    currency   VARCHAR(3),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_bank_accounts_owner_id ON bank_accounts(owner_id);
+
+INSERT INTO bank_accounts (created_at, updated_at, owner_id, label, iban, bic, name, currency, is_default)
+SELECT NOW(), NOW(), owner_id, 'Hauptkonto', bank_iban, COALESCE(bank_bic, ''), COALESCE(bank_name, ''), 'EUR', TRUE
+FROM settings
+WHERE deleted_at IS NULL AND COALESCE(bank_iban, '') <> '';
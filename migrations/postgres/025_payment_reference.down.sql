@@ -0,0 +1,2 @@
+ALTER TABLE invoices DROP COLUMN payment_reference;
+ALTER TABLE settings DROP COLUMN payment_reference_template;
@@ -0,0 +1,2 @@
+-- Session version: bumping it ends all cookie sessions of the user
+ALTER TABLE users ADD COLUMN session_version BIGINT NOT NULL DEFAULT 0;
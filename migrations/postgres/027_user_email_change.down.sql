@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN email_change_expiry;
+ALTER TABLE users DROP COLUMN email_change_token;
+ALTER TABLE users DROP COLUMN pending_email;
@@ -0,0 +1,4 @@
+-- Pending email change: new address, token hash and expiry until confirmed
+ALTER TABLE users ADD COLUMN pending_email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN email_change_token BYTEA;
+ALTER TABLE users ADD COLUMN email_change_expiry TIMESTAMPTZ;
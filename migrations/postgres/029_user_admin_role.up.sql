@@ -0,0 +1,2 @@
+-- The site administrator used to be hard-coded as the user with ID 1.
+UPDATE users SET role = 'admin' WHERE id = 1;
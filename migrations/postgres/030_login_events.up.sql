@@ -0,0 +1,14 @@
+-- Login attempts for the security overview on the profile page
+CREATE TABLE IF NOT EXISTS login_events (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    user_id    BIGINT NOT NULL DEFAULT 0,
+    owner_id   BIGINT NOT NULL DEFAULT 0,
+    email      TEXT NOT NULL DEFAULT '',
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    success    BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_login_events_created_at ON login_events(created_at);
+CREATE INDEX idx_login_events_user_id ON login_events(user_id);
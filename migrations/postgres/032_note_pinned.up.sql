@@ -0,0 +1,2 @@
+-- Pinned notes are listed first on their parent's page
+ALTER TABLE notes ADD COLUMN pinned boolean NOT NULL DEFAULT false;
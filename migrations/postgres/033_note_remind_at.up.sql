@@ -0,0 +1,3 @@
+-- Notes can carry a follow-up date shown on the dashboard once due
+ALTER TABLE notes ADD COLUMN remind_at TIMESTAMPTZ;
+CREATE INDEX idx_notes_owner_remind_at ON notes(owner_id, remind_at);
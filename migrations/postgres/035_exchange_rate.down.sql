@@ -0,0 +1,2 @@
+ALTER TABLE settings DROP COLUMN base_currency;
+ALTER TABLE invoices DROP COLUMN exchange_rate;
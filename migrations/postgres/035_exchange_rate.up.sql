@@ -0,0 +1,3 @@
+-- Exchange rate of an invoice to the owner's base currency, for reporting
+ALTER TABLE invoices ADD COLUMN exchange_rate TEXT NOT NULL DEFAULT '1';
+ALTER TABLE settings ADD COLUMN base_currency TEXT NOT NULL DEFAULT 'EUR';
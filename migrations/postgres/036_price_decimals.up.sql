@@ -0,0 +1,2 @@
+-- Number of decimals of unit prices on invoice lines (2-4)
+ALTER TABLE settings ADD COLUMN price_decimals INTEGER NOT NULL DEFAULT 2;
@@ -0,0 +1 @@
+ALTER TABLE invoicepositions DROP COLUMN cost_price;
@@ -0,0 +1,2 @@
+-- Internal cost per unit of an invoice line, for margin reports
+ALTER TABLE invoicepositions ADD COLUMN cost_price TEXT NOT NULL DEFAULT '0';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS delivery_notes;
+ALTER TABLE settings DROP COLUMN delivery_note_counter;
+ALTER TABLE settings DROP COLUMN delivery_note_number_template;
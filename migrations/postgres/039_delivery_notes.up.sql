@@ -0,0 +1,16 @@
+-- Delivery notes (Lieferscheine) created from invoices, numbered by their own counter
+ALTER TABLE settings ADD COLUMN delivery_note_number_template TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN delivery_note_counter BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS delivery_notes (
+    id                  BIGSERIAL PRIMARY KEY,
+    created_at          TIMESTAMPTZ NOT NULL,
+    owner_id            BIGINT NOT NULL,
+    invoice_id          BIGINT NOT NULL,
+    number              TEXT NOT NULL,
+    delivery_date       TIMESTAMPTZ NOT NULL,
+    show_invoice_number BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_delivery_notes_owner_id ON delivery_notes(owner_id);
+CREATE INDEX idx_delivery_notes_invoice_id ON delivery_notes(invoice_id);
@@ -0,0 +1,17 @@
+-- Billable hours that can be turned into invoice positions
+CREATE TABLE IF NOT EXISTS time_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    owner_id    BIGINT NOT NULL,
+    company_id  BIGINT NOT NULL,
+    date        TIMESTAMPTZ NOT NULL,
+    hours       TEXT NOT NULL DEFAULT '0',
+    description TEXT NOT NULL DEFAULT '',
+    hourly_rate TEXT NOT NULL DEFAULT '0',
+    billed      BOOLEAN NOT NULL DEFAULT FALSE,
+    invoice_id  BIGINT
+);
+
+CREATE INDEX idx_time_entries_owner_id ON time_entries(owner_id);
+CREATE INDEX idx_time_entries_company_id ON time_entries(company_id);
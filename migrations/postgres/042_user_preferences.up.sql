@@ -0,0 +1,12 @@
+-- UI choices of a user (page sizes, sort order) kept across requests
+CREATE TABLE IF NOT EXISTS user_preferences (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    owner_id   BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    key        TEXT NOT NULL,
+    value      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX idx_user_pref ON user_preferences(owner_id, user_id, key);
@@ -0,0 +1,5 @@
+ALTER TABLE settings DROP COLUMN datev_accounts;
+ALTER TABLE settings DROP COLUMN datev_debtor_account;
+ALTER TABLE settings DROP COLUMN datev_account_length;
+ALTER TABLE settings DROP COLUMN datev_client_number;
+ALTER TABLE settings DROP COLUMN datev_consultant_number;
@@ -0,0 +1 @@
+ALTER TABLE invoices DROP COLUMN zugferd_profile;
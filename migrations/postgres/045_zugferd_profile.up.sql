@@ -0,0 +1,2 @@
+-- ZUGFeRD conformance level per invoice
+ALTER TABLE invoices ADD COLUMN zugferd_profile TEXT NOT NULL DEFAULT 'en16931';
@@ -0,0 +1 @@
+ALTER TABLE settings DROP COLUMN invoice_filename_template;
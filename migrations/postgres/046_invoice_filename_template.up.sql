@@ -0,0 +1,2 @@
+-- Template for the file names of invoice downloads
+ALTER TABLE settings ADD COLUMN invoice_filename_template TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+-- Nothing to undo: cleared preview URLs are rendered again on demand.
@@ -0,0 +1,3 @@
+-- Unit price decimals of an invoice, frozen when it is issued
+ALTER TABLE invoices ADD COLUMN price_decimals INTEGER NOT NULL DEFAULT 2;
+UPDATE invoices SET price_decimals = COALESCE((SELECT s.price_decimals FROM settings s WHERE s.owner_id = invoices.owner_id ORDER BY s.id LIMIT 1), 2);
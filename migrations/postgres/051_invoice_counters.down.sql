@@ -0,0 +1,2 @@
+ALTER TABLE invoices DROP COLUMN counter_allocated;
+DROP TABLE IF EXISTS invoice_counters;
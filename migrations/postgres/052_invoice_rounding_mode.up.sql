@@ -0,0 +1,3 @@
+-- Rounding mode of an invoice, frozen when it is issued
+ALTER TABLE invoices ADD COLUMN rounding_mode TEXT NOT NULL DEFAULT 'total';
+UPDATE invoices SET rounding_mode = COALESCE((SELECT s.rounding_mode FROM settings s WHERE s.owner_id = invoices.owner_id ORDER BY s.id LIMIT 1), 'total');
@@ -0,0 +1,3 @@
+-- Distinguish invoices (380) from credit notes (381)
+ALTER TABLE invoices ADD COLUMN document_type TEXT NOT NULL DEFAULT 'invoice';
+ALTER TABLE invoices ADD COLUMN referenced_invoice_number TEXT;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    invoice_id  INTEGER NOT NULL,
+    owner_id    INTEGER NOT NULL,
+    amount      TEXT NOT NULL,
+    date        DATETIME NOT NULL,
+    note        TEXT
+);
+
+CREATE INDEX idx_payments_invoice_id ON payments(invoice_id);
+CREATE INDEX idx_payments_owner_id ON payments(owner_id);
@@ -0,0 +1,2 @@
+ALTER TABLE invoices DROP COLUMN reminder_level;
+ALTER TABLE settings DROP COLUMN reminder_fee;
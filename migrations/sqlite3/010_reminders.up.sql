@@ -0,0 +1,3 @@
+-- Payment reminders: reminder level per invoice, reminder fee per owner
+ALTER TABLE invoices ADD COLUMN reminder_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE settings ADD COLUMN reminder_fee TEXT NOT NULL DEFAULT '0';
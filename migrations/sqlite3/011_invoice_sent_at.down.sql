@@ -0,0 +1 @@
+ALTER TABLE invoices DROP COLUMN sent_at;
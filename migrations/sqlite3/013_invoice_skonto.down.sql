@@ -0,0 +1,2 @@
+ALTER TABLE invoices DROP COLUMN skonto_days;
+ALTER TABLE invoices DROP COLUMN skonto_percent;
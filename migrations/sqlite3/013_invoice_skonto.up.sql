@@ -0,0 +1,3 @@
+-- Early-payment discount (Skonto) per invoice
+ALTER TABLE invoices ADD COLUMN skonto_percent TEXT NOT NULL DEFAULT '0';
+ALTER TABLE invoices ADD COLUMN skonto_days INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE invoicepositions DROP COLUMN discount_percent;
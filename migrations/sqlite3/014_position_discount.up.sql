@@ -0,0 +1,2 @@
+-- Per-line discount on invoice positions
+ALTER TABLE invoicepositions ADD COLUMN discount_percent TEXT NOT NULL DEFAULT '0';
@@ -0,0 +1,2 @@
+-- Rounding of the tax: per rate on the total (default) or per line
+ALTER TABLE settings ADD COLUMN rounding_mode TEXT NOT NULL DEFAULT 'total';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS invoice_attachments (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    invoice_id  INTEGER NOT NULL,
+    owner_id    INTEGER NOT NULL,
+    filename    TEXT NOT NULL,
+    path        TEXT NOT NULL,
+    mime        TEXT NOT NULL,
+    size        INTEGER NOT NULL
+);
+
+CREATE INDEX idx_invoice_attachments_invoice_id ON invoice_attachments(invoice_id);
+CREATE INDEX idx_invoice_attachments_owner_id ON invoice_attachments(owner_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invoice_events (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    invoice_id  INTEGER NOT NULL,
+    owner_id    INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL DEFAULT 0,
+    kind        TEXT NOT NULL,
+    detail      TEXT
+);
+
+CREATE INDEX idx_invoice_events_invoice_id ON invoice_events(invoice_id);
+CREATE INDEX idx_invoice_events_owner_id ON invoice_events(owner_id);
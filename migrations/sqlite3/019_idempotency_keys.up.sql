@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    owner_id         INTEGER NOT NULL,
+    idempotency_key  TEXT NOT NULL,
+    request_hash     TEXT NOT NULL,
+    status_code      INTEGER NOT NULL DEFAULT 0,
+    content_type     TEXT,
+    response         BLOB
+);
+
+CREATE UNIQUE INDEX idx_idempotency_keys_owner_key ON idempotency_keys(owner_id, idempotency_key);
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys(created_at);
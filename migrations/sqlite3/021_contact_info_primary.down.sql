@@ -0,0 +1 @@
+ALTER TABLE contact_infos DROP COLUMN is_primary;
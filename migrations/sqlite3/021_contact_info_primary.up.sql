@@ -0,0 +1,2 @@
+-- Contact infos can be marked as the primary entry of their type
+ALTER TABLE contact_infos ADD COLUMN is_primary numeric NOT NULL DEFAULT false;
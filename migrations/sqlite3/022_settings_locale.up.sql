@@ -0,0 +1,2 @@
+-- Locale for CSV/XLSX exports (delimiter, number and date format, header language)
+ALTER TABLE settings ADD COLUMN locale TEXT NOT NULL DEFAULT 'de-DE';
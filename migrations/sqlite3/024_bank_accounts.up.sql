@@ -0,0 +1,20 @@
+-- Several bank accounts per owner; the account in settings becomes the default
+CREATE TABLE IF NOT EXISTS bank_accounts (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    owner_id   INTEGER NOT NULL,
+    label      TEXT,
+    iban       TEXT NOT NULL,
+    bic        TEXT,
+    name       TEXT,
+    currency   TEXT,
+    is_default BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_bank_accounts_owner_id ON bank_accounts(owner_id);
+
+INSERT INTO bank_accounts (created_at, updated_at, owner_id, label, iban, bic, name, currency, is_default)
+SELECT CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, owner_id, 'Hauptkonto', bank_iban, COALESCE(bank_bic, ''), COALESCE(bank_name, ''), 'EUR', 1
+FROM settings
+WHERE deleted_at IS NULL AND COALESCE(bank_iban, '') <> '';
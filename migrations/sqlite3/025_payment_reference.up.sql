@@ -0,0 +1,3 @@
+-- Payment reference (BT-83): template in the settings, frozen value on issued invoices
+ALTER TABLE settings ADD COLUMN payment_reference_template TEXT NOT NULL DEFAULT '';
+ALTER TABLE invoices ADD COLUMN payment_reference TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS team_invitations;
+ALTER TABLE users DROP COLUMN role;
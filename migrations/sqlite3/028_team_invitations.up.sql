@@ -0,0 +1,16 @@
+-- Teams: several users share an owner. Existing users created their owner.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'owner';
+
+CREATE TABLE IF NOT EXISTS team_invitations (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL,
+    owner_id    INTEGER NOT NULL,
+    invited_by  INTEGER NOT NULL,
+    email       TEXT NOT NULL,
+    token_hash  BLOB NOT NULL,
+    expires_at  DATETIME NOT NULL,
+    accepted_at DATETIME
+);
+
+CREATE INDEX idx_team_invitations_owner_id ON team_invitations(owner_id);
+CREATE UNIQUE INDEX idx_team_invitations_token_hash ON team_invitations(token_hash);
@@ -0,0 +1,14 @@
+-- Login attempts for the security overview on the profile page
+CREATE TABLE IF NOT EXISTS login_events (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL,
+    user_id    INTEGER NOT NULL DEFAULT 0,
+    owner_id   INTEGER NOT NULL DEFAULT 0,
+    email      TEXT NOT NULL DEFAULT '',
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    success    BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_login_events_created_at ON login_events(created_at);
+CREATE INDEX idx_login_events_user_id ON login_events(user_id);
@@ -0,0 +1 @@
+ALTER TABLE settings DROP COLUMN customer_number_mode;
@@ -0,0 +1,2 @@
+-- Customer numbers: "numeric" (prefix + counter) or "freeform" (entered by hand)
+ALTER TABLE settings ADD COLUMN customer_number_mode TEXT NOT NULL DEFAULT 'numeric';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_notes_owner_remind_at;
+ALTER TABLE notes DROP COLUMN remind_at;
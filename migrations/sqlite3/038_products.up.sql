@@ -0,0 +1,13 @@
+-- Catalog of products and services that pre-fill invoice positions
+CREATE TABLE IF NOT EXISTS products (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at        DATETIME NOT NULL,
+    updated_at        DATETIME NOT NULL,
+    owner_id          INTEGER NOT NULL,
+    name              TEXT NOT NULL,
+    default_unit      TEXT NOT NULL DEFAULT '',
+    default_net_price TEXT NOT NULL DEFAULT '0',
+    default_tax_rate  TEXT NOT NULL DEFAULT '0'
+);
+
+CREATE INDEX idx_products_owner_id ON products(owner_id);
@@ -0,0 +1,17 @@
+-- Billable hours that can be turned into invoice positions
+CREATE TABLE IF NOT EXISTS time_entries (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL,
+    updated_at  DATETIME NOT NULL,
+    owner_id    INTEGER NOT NULL,
+    company_id  INTEGER NOT NULL,
+    date        DATETIME NOT NULL,
+    hours       TEXT NOT NULL DEFAULT '0',
+    description TEXT NOT NULL DEFAULT '',
+    hourly_rate TEXT NOT NULL DEFAULT '0',
+    billed      BOOLEAN NOT NULL DEFAULT 0,
+    invoice_id  INTEGER
+);
+
+CREATE INDEX idx_time_entries_owner_id ON time_entries(owner_id);
+CREATE INDEX idx_time_entries_company_id ON time_entries(company_id);
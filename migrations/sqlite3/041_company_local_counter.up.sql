@@ -0,0 +1,2 @@
+-- Companies can have their own invoice number sequence
+ALTER TABLE companies ADD COLUMN use_local_counter BOOLEAN NOT NULL DEFAULT 0;
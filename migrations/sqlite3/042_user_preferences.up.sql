@@ -0,0 +1,12 @@
+-- UI choices of a user (page sizes, sort order) kept across requests
+CREATE TABLE IF NOT EXISTS user_preferences (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    owner_id   INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    key        TEXT NOT NULL,
+    value      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX idx_user_pref ON user_preferences(owner_id, user_id, key);
@@ -0,0 +1,6 @@
+-- DATEV export: header numbers and account mapping
+ALTER TABLE settings ADD COLUMN datev_consultant_number TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN datev_client_number TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN datev_account_length INTEGER NOT NULL DEFAULT 4;
+ALTER TABLE settings ADD COLUMN datev_debtor_account TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN datev_accounts TEXT NOT NULL DEFAULT '';
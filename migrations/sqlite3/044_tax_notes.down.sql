@@ -0,0 +1,4 @@
+ALTER TABLE settings DROP COLUMN tax_note_k_en;
+ALTER TABLE settings DROP COLUMN tax_note_k_de;
+ALTER TABLE settings DROP COLUMN tax_note_ae_en;
+ALTER TABLE settings DROP COLUMN tax_note_ae_de;
@@ -0,0 +1,5 @@
+-- Statutory notes for reverse charge and intra-community supplies per language
+ALTER TABLE settings ADD COLUMN tax_note_ae_de TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN tax_note_ae_en TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN tax_note_k_de TEXT NOT NULL DEFAULT '';
+ALTER TABLE settings ADD COLUMN tax_note_k_en TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Error of the last failed background rendering of an invoice PDF
+ALTER TABLE invoices ADD COLUMN render_error TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Letterhead previews moved from uploads/letterhead/ownerN to
+-- uploads/ownerN/letterhead and are served per owner. Clear the old URLs so
+-- that the previews are rendered again into the new directory.
+UPDATE letterhead_templates SET preview_page1_url = '', preview_page2_url = ''
+WHERE preview_page1_url LIKE '/uploads/letterhead/owner%';
@@ -0,0 +1,2 @@
+-- Next attempt of a webhook delivery that is retrying, resumed after a restart
+ALTER TABLE webhook_deliveries ADD COLUMN next_attempt_at DATETIME;
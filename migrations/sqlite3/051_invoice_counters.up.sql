@@ -0,0 +1,11 @@
+-- Invoice counters are allocated when an invoice is issued, from one row per
+-- number sequence that is updated in place
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    owner_id   INTEGER NOT NULL,
+    company_id INTEGER NOT NULL DEFAULT 0,
+    value      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (owner_id, company_id)
+);
+
+ALTER TABLE invoices ADD COLUMN counter_allocated BOOLEAN NOT NULL DEFAULT 0;
+UPDATE invoices SET counter_allocated = 1 WHERE status <> 'draft';
@@ -6,6 +6,9 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -22,16 +25,103 @@ type APIToken struct {
 	TokenHash   string `gorm:"size:64;uniqueIndex;not null"` // Hex-encoded SHA-256(salt || token)
 	Salt        string `gorm:"size:64;not null"`             // Hex-encoded per-token salt
 
-	Name       string     `gorm:"size:100"` // Human-readable label, e.g. "CI build token"
-	Scope      string     `gorm:"size:200"` // Application-defined scope, e.g. "read:contacts write:notes"
+	Name       string     `gorm:"size:100"`              // Human-readable label, e.g. "CI build token"
+	Scopes     string     `gorm:"column:scope;size:200"` // Comma-separated, e.g. "customers:read,invoices:read"; empty = all (legacy tokens)
 	ExpiresAt  *time.Time // Optional absolute expiry
-	LastUsedAt *time.Time // Updated on successful validation (best-effort)
+	LastUsedAt *time.Time // Set by TouchAPIToken on use, at most once per minute (best-effort)
 	Disabled   bool       `gorm:"not null;default:false"` // Soft revocation flag
 }
 
 // TableName sets the underlying table name.
 func (APIToken) TableName() string { return "api_tokens" }
 
+// APITokenExpiredRetention is how long expired tokens are kept (and listed
+// as expired) before the maintenance run deletes them.
+const APITokenExpiredRetention = 90 * 24 * time.Hour
+
+// Expired reports whether the token is past its expiry.
+func (t APIToken) Expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// API token scopes. Each API route requires one of them.
+const (
+	ScopeCustomersRead  = "customers:read"
+	ScopeCustomersWrite = "customers:write"
+	ScopeInvoicesRead   = "invoices:read"
+	ScopeInvoicesWrite  = "invoices:write"
+	ScopeStatsRead      = "stats:read"
+	ScopeTokensWrite    = "tokens:write"
+)
+
+// APIScopes lists all scopes in the order the profile page offers them.
+var APIScopes = []string{
+	ScopeCustomersRead, ScopeCustomersWrite,
+	ScopeInvoicesRead, ScopeInvoicesWrite,
+	ScopeStatsRead,
+	ScopeTokensWrite,
+}
+
+// ErrUnknownScope is returned for scopes not in APIScopes.
+var ErrUnknownScope = errors.New("unknown scope")
+
+// ErrNoScope is returned when a new token would get no scope at all.
+var ErrNoScope = errors.New("no scope given")
+
+// NormalizeAPIScopes checks the comma-separated scopes and returns them
+// sorted in the order of APIScopes without duplicates.
+func NormalizeAPIScopes(scopes string) (string, error) {
+	var want []string
+	for _, sc := range strings.Split(scopes, ",") {
+		sc = strings.ToLower(strings.TrimSpace(sc))
+		if sc == "" {
+			continue
+		}
+		if !slices.Contains(APIScopes, sc) {
+			return "", fmt.Errorf("%w %q", ErrUnknownScope, sc)
+		}
+		want = append(want, sc)
+	}
+	var out []string
+	for _, sc := range APIScopes {
+		if slices.Contains(want, sc) {
+			out = append(out, sc)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+// ScopeList returns the token's scopes; nil for a token without scopes.
+func (t APIToken) ScopeList() []string {
+	if strings.TrimSpace(t.Scopes) == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope reports whether the token grants scope. Tokens created before
+// scopes existed have none stored and keep full access; CreateAPIToken
+// refuses to create new tokens without scopes.
+func (t APIToken) HasScope(scope string) bool {
+	list := t.ScopeList()
+	return list == nil || slices.Contains(list, scope)
+}
+
+// Covers reports whether t grants every scope of other. Only a legacy token
+// with full access covers another legacy token.
+func (t APIToken) Covers(other APIToken) bool {
+	list := other.ScopeList()
+	if list == nil {
+		return t.ScopeList() == nil
+	}
+	for _, sc := range list {
+		if !t.HasScope(sc) {
+			return false
+		}
+	}
+	return true
+}
+
 // ---- Internal token factory (single place that touches RNG and hashing) ----
 // makeToken generates a new plaintext token plus the data required for storage.
 //
@@ -25,7 +25,8 @@ func (s *Store) AutoMigrateTokens() error {
 //   - ownerID: The tenant or account that owns the token.
 //   - userID:  Optional pointer to the user associated with this token (nil for system tokens).
 //   - name:    A human-readable label (e.g. “CI build token”).
-//   - scope:   Application-defined permission scope (e.g. “read:contacts”).
+//   - scopes:  Comma-separated scopes from APIScopes (e.g. “customers:read,invoices:read”);
+//     at least one is required (ErrNoScope).
 //   - expiresAt: Optional expiration timestamp.
 //
 // Returns:
@@ -36,7 +37,14 @@ func (s *Store) AutoMigrateTokens() error {
 // Security:
 // The plaintext token is composed of a random prefix and salt; its hash is computed via SHA-256.
 // The prefix allows efficient lookup without storing the full token.
-func (s *Store) CreateAPIToken(ownerID uint, userID *uint, name, scope string, expiresAt *time.Time) (plain string, rec *APIToken, err error) {
+func (s *Store) CreateAPIToken(ownerID uint, userID *uint, name, scopes string, expiresAt *time.Time) (plain string, rec *APIToken, err error) {
+	scopes, err = NormalizeAPIScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if scopes == "" {
+		return "", nil, ErrNoScope
+	}
 	plain, prefix, saltHex, hash, err := makeToken()
 	if err != nil {
 		return "", nil, err
@@ -48,7 +56,7 @@ func (s *Store) CreateAPIToken(ownerID uint, userID *uint, name, scope string, e
 		TokenHash:   hash,
 		Salt:        saltHex,
 		Name:        name,
-		Scope:       scope,
+		Scopes:      scopes,
 		ExpiresAt:   expiresAt,
 	}
 	if err = s.db.Create(rec).Error; err != nil {
@@ -64,7 +72,8 @@ func (s *Store) CreateAPIToken(ownerID uint, userID *uint, name, scope string, e
 //  2. Look up the token by its prefix.
 //  3. Recompute and compare the salted SHA-256 hash in constant time.
 //  4. Ensure the token is not disabled and not expired.
-//  5. Update its "last_used_at" timestamp (best-effort; errors ignored).
+//
+// The caller records the use with TouchAPIToken.
 //
 // Returns:
 //   - The matching APIToken record if valid.
@@ -100,15 +109,46 @@ func (s *Store) ValidateAPIToken(raw string) (*APIToken, error) {
 	if rec.Disabled {
 		return nil, ErrTokenDisabled
 	}
-	if rec.ExpiresAt != nil && time.Now().After(*rec.ExpiresAt) {
+	if rec.Expired() {
 		return nil, ErrTokenExpired
 	}
-
-	// Best-effort update of last usage timestamp (non-blocking)
-	_ = s.db.Model(&APIToken{}).Where("id = ?", rec.ID).Update("last_used_at", time.Now()).Error
 	return &rec, nil
 }
 
+// APITokenTouchInterval throttles the LastUsedAt updates of TouchAPIToken, so
+// a busy token does not cause a write per request.
+const APITokenTouchInterval = time.Minute
+
+// TouchAPIToken sets LastUsedAt of rec to now unless it was set within
+// APITokenTouchInterval. The condition is repeated in the UPDATE, so
+// concurrent requests with the same token write at most once per interval.
+func (s *Store) TouchAPIToken(rec *APIToken) error {
+	now := time.Now()
+	cutoff := now.Add(-APITokenTouchInterval)
+	if rec.LastUsedAt != nil && rec.LastUsedAt.After(cutoff) {
+		return nil
+	}
+	res := s.db.Model(&APIToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at <= ?)", rec.ID, cutoff).
+		Update("last_used_at", now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		rec.LastUsedAt = &now
+	}
+	return nil
+}
+
+// LoadAPIToken returns the token with the given ID of the owner.
+func (s *Store) LoadAPIToken(id, ownerID uint) (*APIToken, error) {
+	var t APIToken
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // RevokeAPIToken disables a token by marking it as "disabled".
 // Only allowed for tokens belonging to the specified owner.
 func (s *Store) RevokeAPIToken(ownerID, tokenID uint) error {
@@ -0,0 +1,125 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestAPITokenExpiry(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+
+	create := func(name string, expiresAt time.Time) string {
+		t.Helper()
+		plain, _, err := store.CreateAPIToken(owner, nil, name, model.ScopeInvoicesRead, &expiresAt)
+		if err != nil {
+			t.Fatalf("CreateAPIToken failed: %v", err)
+		}
+		return plain
+	}
+	valid := create("valid", time.Now().AddDate(0, 0, 30))
+	recent := create("recently expired", time.Now().AddDate(0, 0, -1))
+	create("long expired", time.Now().Add(-model.APITokenExpiredRetention-24*time.Hour))
+
+	if _, err := store.ValidateAPIToken(valid); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+	if _, err := store.ValidateAPIToken(recent); err != model.ErrTokenExpired {
+		t.Errorf("expired token: got %v, want ErrTokenExpired", err)
+	}
+
+	if err := model.RunMaintenance(context.Background(), store); err != nil {
+		t.Fatalf("RunMaintenance failed: %v", err)
+	}
+	tokens, _, err := store.ListAPITokensByOwner(owner, 10, "")
+	if err != nil {
+		t.Fatalf("ListAPITokensByOwner failed: %v", err)
+	}
+	var names []string
+	for _, tok := range tokens {
+		names = append(names, tok.Name)
+		if tok.Name == "recently expired" && !tok.Expired() {
+			t.Errorf("token %q should report Expired", tok.Name)
+		}
+	}
+	if len(tokens) != 2 {
+		t.Errorf("after maintenance: %v, want the valid and the recently expired token", names)
+	}
+}
+
+func TestTouchAPIToken(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	plain, _, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "ci", model.ScopeInvoicesRead, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	rec, err := store.ValidateAPIToken(plain)
+	if err != nil {
+		t.Fatalf("ValidateAPIToken failed: %v", err)
+	}
+	if rec.LastUsedAt != nil {
+		t.Fatalf("validation alone should not record a use")
+	}
+	if err := store.TouchAPIToken(rec); err != nil {
+		t.Fatalf("TouchAPIToken failed: %v", err)
+	}
+	first := *rec.LastUsedAt
+
+	// A second use within the interval does not write again.
+	again, err := store.ValidateAPIToken(plain)
+	if err != nil {
+		t.Fatalf("ValidateAPIToken failed: %v", err)
+	}
+	if again.LastUsedAt == nil {
+		t.Fatalf("LastUsedAt not stored")
+	}
+	again.LastUsedAt = nil // pretend a stale copy: the UPDATE condition still throttles
+	if err := store.TouchAPIToken(again); err != nil {
+		t.Fatalf("TouchAPIToken failed: %v", err)
+	}
+	stored, err := store.ValidateAPIToken(plain)
+	if err != nil {
+		t.Fatalf("ValidateAPIToken failed: %v", err)
+	}
+	if !stored.LastUsedAt.Equal(first) {
+		t.Errorf("LastUsedAt changed within the interval: %v -> %v", first, *stored.LastUsedAt)
+	}
+}
+
+func TestAPITokenScopeChecks(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	if _, _, err := store.CreateAPIToken(fixtures.DefaultOwnerID, nil, "none", " , ", nil); !errors.Is(err, model.ErrNoScope) {
+		t.Errorf("token without scopes: got %v, want ErrNoScope", err)
+	}
+
+	legacy := model.APIToken{}
+	reader := model.APIToken{Scopes: model.ScopeInvoicesRead}
+	manager := model.APIToken{Scopes: model.ScopeInvoicesRead + "," + model.ScopeTokensWrite}
+	if !legacy.HasScope(model.ScopeStatsRead) {
+		t.Errorf("legacy token should keep full access")
+	}
+	if reader.HasScope(model.ScopeInvoicesWrite) {
+		t.Errorf("reader should not have %s", model.ScopeInvoicesWrite)
+	}
+	tests := []struct {
+		name          string
+		caller, other model.APIToken
+		want          bool
+	}{
+		{"manager covers reader", manager, reader, true},
+		{"reader does not cover manager", reader, manager, false},
+		{"manager does not cover legacy", manager, legacy, false},
+		{"legacy covers manager", legacy, manager, true},
+		{"legacy covers legacy", legacy, legacy, true},
+	}
+	for _, tt := range tests {
+		if got := tt.caller.Covers(tt.other); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BankAccount is one of the owner's accounts for incoming payments. Invoices
+// name the account whose Currency matches the invoice currency; an empty
+// Currency matches nothing and the account is only used as default. Exactly
+// one account per owner should have IsDefault set, SaveBankAccount and
+// DeleteBankAccount maintain that.
+type BankAccount struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	OwnerID   uint      `gorm:"not null;index"`
+	Label     string    `gorm:"size:100"` // shown in the settings, e.g. "Geschäftskonto USD"
+	IBAN      string    `gorm:"column:iban;size:34;not null"`
+	BIC       string    `gorm:"column:bic;size:11"`
+	Name      string    `gorm:"size:200"` // account holder / bank name, as in Settings.BankName
+	Currency  string    `gorm:"size:3"`   // ISO 4217, e.g. "EUR"
+	IsDefault bool      `gorm:"not null;default:false"`
+}
+
+func (BankAccount) TableName() string { return "bank_accounts" }
+
+// ListBankAccounts returns the owner's bank accounts, the default first.
+func (s *Store) ListBankAccounts(ownerID uint) ([]BankAccount, error) {
+	var accounts []BankAccount
+	err := s.db.Where("owner_id = ?", ownerID).
+		Order("is_default DESC, currency ASC, id ASC").
+		Find(&accounts).Error
+	return accounts, err
+}
+
+// LoadBankAccount loads one bank account of the owner.
+func (s *Store) LoadBankAccount(id, ownerID uint) (*BankAccount, error) {
+	var acc BankAccount
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&acc).Error; err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// SaveBankAccount creates (ID 0) or updates a bank account. The IBAN is
+// stored without spaces and upper case. If acc becomes the default, the
+// previous default loses the flag; the first account of an owner is always
+// the default.
+func (s *Store) SaveBankAccount(acc *BankAccount) error {
+	if acc.OwnerID == 0 {
+		return errors.New("SaveBankAccount: OwnerID required")
+	}
+	acc.IBAN = strings.ToUpper(strings.Join(strings.Fields(acc.IBAN), ""))
+	acc.BIC = strings.ToUpper(strings.TrimSpace(acc.BIC))
+	acc.Currency = strings.ToUpper(strings.TrimSpace(acc.Currency))
+	acc.Label = strings.TrimSpace(acc.Label)
+	acc.Name = strings.TrimSpace(acc.Name)
+	if acc.IBAN == "" {
+		return errors.New("IBAN required")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var others int64
+		if err := tx.Model(&BankAccount{}).
+			Where("owner_id = ? AND id <> ?", acc.OwnerID, acc.ID).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		if others == 0 {
+			acc.IsDefault = true
+		}
+		if acc.ID != 0 {
+			var existing BankAccount
+			if err := tx.Where("id = ? AND owner_id = ?", acc.ID, acc.OwnerID).First(&existing).Error; err != nil {
+				return err
+			}
+			acc.CreatedAt = existing.CreatedAt
+			// The default can only be moved to another account, not removed.
+			if existing.IsDefault {
+				acc.IsDefault = true
+			}
+		}
+		if acc.IsDefault {
+			if err := tx.Model(&BankAccount{}).
+				Where("owner_id = ? AND id <> ?", acc.OwnerID, acc.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(acc).Error
+	})
+}
+
+// DeleteBankAccount removes a bank account. When it was the default, the
+// oldest remaining account becomes the default.
+func (s *Store) DeleteBankAccount(id, ownerID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var acc BankAccount
+		if err := tx.Where("id = ? AND owner_id = ?", id, ownerID).First(&acc).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&acc).Error; err != nil {
+			return err
+		}
+		if !acc.IsDefault {
+			return nil
+		}
+		var next BankAccount
+		err := tx.Where("owner_id = ?", ownerID).Order("id ASC").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("is_default", true).Error
+	})
+}
+
+// BankAccountForCurrency picks the account invoices in currency are paid to:
+// an account with that currency (the default one if several match), else the
+// default account, else the oldest. It returns nil without an error if the
+// owner has no bank accounts.
+func (s *Store) BankAccountForCurrency(ownerID uint, currency string) (*BankAccount, error) {
+	accounts, err := s.ListBankAccounts(ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("list bank accounts (owner %d): %w", ownerID, err)
+	}
+	return pickBankAccount(accounts, currency), nil
+}
+
+// pickBankAccount implements the choice of BankAccountForCurrency on a list
+// ordered like ListBankAccounts (default first).
+func pickBankAccount(accounts []BankAccount, currency string) *BankAccount {
+	if len(accounts) == 0 {
+		return nil
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = "EUR"
+	}
+	for i := range accounts {
+		if accounts[i].Currency == currency {
+			return &accounts[i]
+		}
+	}
+	for i := range accounts {
+		if accounts[i].IsDefault {
+			return &accounts[i]
+		}
+	}
+	oldest := &accounts[0]
+	for i := range accounts {
+		if accounts[i].ID < oldest.ID {
+			oldest = &accounts[i]
+		}
+	}
+	return oldest
+}
+
+// LoadSettingsForCurrency loads the owner's settings with the bank fields
+// (BankIBAN, BankBIC, BankName) set to the account chosen by
+// BankAccountForCurrency. Owners without bank accounts keep the single
+// account stored in the settings themselves. Everything that prints or
+// embeds the bank account of an invoice (XML, PDF, reminders) loads its
+// settings this way.
+func (s *Store) LoadSettingsForCurrency(ownerID any, currency string) (*Settings, error) {
+	settings, err := s.LoadSettings(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	acc, err := s.BankAccountForCurrency(settings.OwnerID, currency)
+	if err != nil {
+		return nil, err
+	}
+	if acc != nil {
+		settings.BankIBAN = acc.IBAN
+		settings.BankBIC = acc.BIC
+		settings.BankName = acc.Name
+	}
+	return settings, nil
+}
@@ -0,0 +1,144 @@
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestBankAccounts_DefaultHandling(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+
+	eur := &model.BankAccount{OwnerID: owner, Label: "EUR", IBAN: "de89 3704 0044 0532 0130 00", Currency: "eur"}
+	if err := store.SaveBankAccount(eur); err != nil {
+		t.Fatalf("SaveBankAccount failed: %v", err)
+	}
+	if !eur.IsDefault {
+		t.Errorf("first account should become the default")
+	}
+	if eur.IBAN != "DE89370400440532013000" || eur.Currency != "EUR" {
+		t.Errorf("not normalized: IBAN %q, currency %q", eur.IBAN, eur.Currency)
+	}
+
+	usd := &model.BankAccount{OwnerID: owner, Label: "USD", IBAN: "GB29NWBK60161331926819", Currency: "USD", IsDefault: true}
+	if err := store.SaveBankAccount(usd); err != nil {
+		t.Fatalf("SaveBankAccount failed: %v", err)
+	}
+	accounts, err := store.ListBankAccounts(owner)
+	if err != nil {
+		t.Fatalf("ListBankAccounts failed: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].ID != usd.ID || accounts[1].IsDefault {
+		t.Fatalf("after moving the default: %+v", accounts)
+	}
+
+	if err := store.DeleteBankAccount(usd.ID, owner); err != nil {
+		t.Fatalf("DeleteBankAccount failed: %v", err)
+	}
+	left, err := store.LoadBankAccount(eur.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadBankAccount failed: %v", err)
+	}
+	if !left.IsDefault {
+		t.Errorf("remaining account should become the default")
+	}
+
+	if err := store.DeleteBankAccount(eur.ID, owner+1); err == nil {
+		t.Errorf("deleting another owner's account should fail")
+	}
+}
+
+func TestBankAccountForCurrency(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+
+	if acc, err := store.BankAccountForCurrency(owner, "EUR"); err != nil || acc != nil {
+		t.Fatalf("no accounts: got %v, %v; want nil, nil", acc, err)
+	}
+
+	eur := &model.BankAccount{OwnerID: owner, IBAN: "DE89370400440532013000", Currency: "EUR"}
+	usd := &model.BankAccount{OwnerID: owner, IBAN: "GB29NWBK60161331926819", Currency: "USD"}
+	for _, acc := range []*model.BankAccount{eur, usd} {
+		if err := store.SaveBankAccount(acc); err != nil {
+			t.Fatalf("SaveBankAccount failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		currency string
+		want     uint
+	}{
+		{"USD", usd.ID},
+		{"usd", usd.ID},
+		{"EUR", eur.ID},
+		{"", eur.ID},    // empty means EUR
+		{"CHF", eur.ID}, // no match: default
+	}
+	for _, tt := range tests {
+		acc, err := store.BankAccountForCurrency(owner, tt.currency)
+		if err != nil {
+			t.Fatalf("BankAccountForCurrency(%q) failed: %v", tt.currency, err)
+		}
+		if acc == nil || acc.ID != tt.want {
+			t.Errorf("BankAccountForCurrency(%q) = %+v, want account %d", tt.currency, acc, tt.want)
+		}
+	}
+}
+
+func TestZUGFeRDXML_UsesAccountForCurrency(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+	dir := t.TempDir()
+
+	writeXML := func() string {
+		t.Helper()
+		inv, err := store.LoadInvoice(data.Invoice.ID, owner)
+		if err != nil {
+			t.Fatalf("LoadInvoice failed: %v", err)
+		}
+		path := filepath.Join(dir, "invoice.xml")
+		if err := store.WriteZUGFeRDXML(inv, owner, path); err != nil {
+			t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// Without bank accounts the account from the settings is used.
+	if xml := writeXML(); !strings.Contains(xml, data.Settings.BankIBAN) {
+		t.Errorf("XML does not contain the settings IBAN %s", data.Settings.BankIBAN)
+	}
+
+	usd := &model.BankAccount{OwnerID: owner, IBAN: "GB29NWBK60161331926819", BIC: "NWBKGB2L", Currency: "USD"}
+	eur := &model.BankAccount{OwnerID: owner, IBAN: "DE02120300000000202051", BIC: "BYLADEM1001", Currency: "EUR"}
+	for _, acc := range []*model.BankAccount{usd, eur} {
+		if err := store.SaveBankAccount(acc); err != nil {
+			t.Fatalf("SaveBankAccount failed: %v", err)
+		}
+	}
+	xml := writeXML()
+	if !strings.Contains(xml, eur.IBAN) || strings.Contains(xml, usd.IBAN) {
+		t.Errorf("EUR invoice should name the EUR account only:\n%s", xml)
+	}
+
+	inv, err := store.LoadInvoice(data.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	inv.Currency = "USD"
+	if err := store.UpdateInvoice(inv, owner); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+	if xml := writeXML(); !strings.Contains(xml, usd.IBAN) || !strings.Contains(xml, usd.BIC) {
+		t.Errorf("USD invoice should name the USD account:\n%s", xml)
+	}
+}
@@ -3,7 +3,9 @@ package model
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
@@ -38,6 +40,47 @@ type Company struct {
 	SupplierNumber         string          `gorm:"column:supplier_number"`
 	VATID                  string          `gorm:"column:vat_id"` // VAT identification number
 	Notes                  []Note          `gorm:"polymorphic:Parent;polymorphicValue:company;constraint:OnDelete:CASCADE;"`
+	EInvoiceProfile        EInvoiceProfile `gorm:"column:einvoice_profile;type:text;not null;default:zugferd"`
+	DefaultPaymentTermDays int             `gorm:"column:default_payment_term_days"` // overrides the settings value when > 0
+	ArchivedAt             *time.Time      `gorm:"column:archived_at;index"`         // hidden from the customer list when set
+	// UseLocalCounter gives the company its own invoice number sequence,
+	// regardless of Settings.UseLocalCounter. See UsesLocalCounter.
+	UseLocalCounter bool `gorm:"column:use_local_counter;not null;default:false"`
+}
+
+// EInvoiceProfile selects the electronic invoice format a company receives.
+type EInvoiceProfile string
+
+const (
+	// EInvoiceProfileZUGFeRD is a PDF with embedded CII XML (EN 16931). Default.
+	EInvoiceProfileZUGFeRD EInvoiceProfile = "zugferd"
+	// EInvoiceProfileXRechnung is a standalone XRechnung CII file, required by
+	// German public-sector customers (needs a Leitweg-ID as buyer reference).
+	EInvoiceProfileXRechnung EInvoiceProfile = "xrechnung"
+)
+
+// PrimaryEmail returns the company's main e-mail contact info or nil.
+func (c Company) PrimaryEmail() *ContactInfo {
+	return primaryContactInfo(c.ContactInfos, "email")
+}
+
+// PrimaryPhone returns the company's main phone number or nil.
+func (c Company) PrimaryPhone() *ContactInfo {
+	return primaryContactInfo(c.ContactInfos, "phone")
+}
+
+// UsesLocalCounter reports whether invoices of the company are numbered in
+// a sequence of their own. The company's UseLocalCounter takes precedence:
+// when set, the company always counts on its own. Otherwise the owner's
+// Settings.UseLocalCounter decides for all companies. Companies with their
+// own sequence don't take part in the shared one.
+func (c *Company) UsesLocalCounter(settings *Settings) bool {
+	return c.UseLocalCounter || (settings != nil && settings.UseLocalCounter)
+}
+
+// UsesXRechnung reports whether invoices for the company follow the XRechnung rules.
+func (c *Company) UsesXRechnung() bool {
+	return c.EInvoiceProfile == EInvoiceProfileXRechnung
 }
 
 var ErrNotAllowed = fmt.Errorf("not allowed")
@@ -70,24 +113,27 @@ func (s *Store) SaveCompany(c *Company, ownerID uint, tagNames []string) error {
 			// Update a controlled set of fields within the owner scope.
 			if err = tx.Model(&Company{}).Where("id = ? AND owner_id = ?", c.ID, ownerID).
 				Updates(map[string]any{
-					"address1":                 c.Address1,
-					"address2":                 c.Address2,
-					"background":               c.Background,
-					"contact_invoice":          c.ContactInvoice,
-					"default_tax_rate":         c.DefaultTaxRate,
-					"invoice_currency":         c.InvoiceCurrency,
-					"invoice_exemption_reason": c.InvoiceExemptionReason,
-					"invoice_footer":           c.InvoiceFooter,
-					"invoice_opening":          c.InvoiceOpening,
-					"invoice_tax_type":         c.InvoiceTaxType,
-					"customer_number":          c.CustomerNumber,
-					"country":                  c.Country,
-					"name":                     c.Name,
-					"city":                     c.City,
-					"zip":                      c.Zip,
-					"invoice_email":            c.InvoiceEmail,
-					"supplier_number":          c.SupplierNumber,
-					"vat_id":                   c.VATID,
+					"address1":                  c.Address1,
+					"address2":                  c.Address2,
+					"background":                c.Background,
+					"contact_invoice":           c.ContactInvoice,
+					"default_tax_rate":          c.DefaultTaxRate,
+					"invoice_currency":          c.InvoiceCurrency,
+					"invoice_exemption_reason":  c.InvoiceExemptionReason,
+					"invoice_footer":            c.InvoiceFooter,
+					"invoice_opening":           c.InvoiceOpening,
+					"invoice_tax_type":          c.InvoiceTaxType,
+					"customer_number":           c.CustomerNumber,
+					"country":                   c.Country,
+					"name":                      c.Name,
+					"city":                      c.City,
+					"zip":                       c.Zip,
+					"invoice_email":             c.InvoiceEmail,
+					"supplier_number":           c.SupplierNumber,
+					"vat_id":                    c.VATID,
+					"einvoice_profile":          c.EInvoiceProfile,
+					"default_payment_term_days": c.DefaultPaymentTermDays,
+					"use_local_counter":         c.UseLocalCounter,
 				}).Error; err != nil {
 				return err
 			}
@@ -161,6 +207,29 @@ func (s *Store) LoadCompany(id any, ownerID any) (*Company, error) {
 	return c, nil
 }
 
+// ArchiveCompany hides a company from the customer list. The company and its
+// invoices stay accessible.
+func (s *Store) ArchiveCompany(id, ownerID uint) error {
+	now := time.Now()
+	return s.setCompanyArchivedAt(id, ownerID, &now)
+}
+
+// UnarchiveCompany shows an archived company in the customer list again.
+func (s *Store) UnarchiveCompany(id, ownerID uint) error {
+	return s.setCompanyArchivedAt(id, ownerID, nil)
+}
+
+func (s *Store) setCompanyArchivedAt(id, ownerID uint, t *time.Time) error {
+	res := s.db.Model(&Company{}).Where("id = ? AND owner_id = ?", id, ownerID).Update("archived_at", t)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // LoadAllCompanies returns all companies for a given owner, preloading ContactInfos.
 // Use with care for large datasets (consider pagination).
 func (s *Store) LoadAllCompanies(ownerid any) ([]*Company, error) {
@@ -180,23 +249,93 @@ func likeEscape(s string) string {
 // within an owner scope. Uses ILIKE on PostgreSQL and LOWER(name) LIKE on other dialects.
 // ContactInfos are preloaded for convenience.
 func (s *Store) FindAllCompaniesWithText(search string, ownerid uint) ([]*Company, error) {
-	search = likeEscape(search)
-	like := "%" + search + "%"
-	var companies []*Company
+	return s.FindCompaniesAdvanced(search, ownerid, nil)
+}
 
-	q := s.db.Preload("ContactInfos")
+// CompanySearchFields are the columns FindCompaniesAdvanced can search.
+var CompanySearchFields = []string{"name", "city", "zip", "vat_id"}
 
-	switch s.db.Dialector.Name() {
-	case "postgres":
-		q = q.Where("owner_id = ? AND name ILIKE ? ESCAPE '\\'", ownerid, like)
-	default: // sqlite, mysql/mariadb
-		q = q.Where("owner_id = ? AND LOWER(name) LIKE LOWER(?) ESCAPE '\\'", ownerid, like)
+// FindCompaniesAdvanced is FindAllCompaniesWithText on the given columns (see
+// CompanySearchFields): a company matches if any of them contains search.
+// No fields means name only. An unknown field is an error.
+func (s *Store) FindCompaniesAdvanced(search string, ownerID uint, fields []string) ([]*Company, error) {
+	q, err := s.companySearchQuery(search, ownerID, fields)
+	if err != nil {
+		return nil, err
 	}
+	var companies []*Company
+	err = q.Preload("ContactInfos").Find(&companies).Error
+	return companies, err
+}
 
-	err := q.Find(&companies).Error
+// SuggestCompanies returns at most limit companies that are not archived and
+// whose name contains search, ordered by name. Only ID and name are loaded.
+// It backs the company typeahead of the forms.
+func (s *Store) SuggestCompanies(search string, ownerID uint, limit int) ([]*Company, error) {
+	q, err := s.companySearchQuery(search, ownerID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var companies []*Company
+	err = q.Select("id", "name").
+		Where("archived_at IS NULL").
+		Order("LOWER(name)").
+		Limit(limit).
+		Find(&companies).Error
 	return companies, err
 }
 
+// companySearchQuery returns the query of the owner's companies with search
+// in one of fields, see FindCompaniesAdvanced.
+func (s *Store) companySearchQuery(search string, ownerID uint, fields []string) (*gorm.DB, error) {
+	if len(fields) == 0 {
+		fields = []string{"name"}
+	}
+	cond := "LOWER(%s) LIKE LOWER(?) ESCAPE '\\'"
+	if s.db.Dialector.Name() == "postgres" {
+		cond = "%s ILIKE ? ESCAPE '\\'"
+	}
+	like := "%" + likeEscape(search) + "%"
+	var (
+		conds []string
+		args  []any
+	)
+	for _, f := range fields {
+		if !slices.Contains(CompanySearchFields, f) {
+			return nil, fmt.Errorf("unknown company search field %q", f)
+		}
+		conds = append(conds, fmt.Sprintf(cond, f))
+		args = append(args, like)
+	}
+	return s.db.Where("owner_id = ?", ownerID).
+		Where("("+strings.Join(conds, " OR ")+")", args...), nil
+}
+
+// SearchMatch returns the first of fields (see CompanySearchFields) whose
+// value contains search, ignoring case, and that value. It tells why
+// FindCompaniesAdvanced returned the company.
+func (c *Company) SearchMatch(search string, fields []string) (field, value string) {
+	search = strings.ToLower(search)
+	for _, f := range fields {
+		switch f {
+		case "name":
+			value = c.Name
+		case "city":
+			value = c.City
+		case "zip":
+			value = c.Zip
+		case "vat_id":
+			value = c.VATID
+		default:
+			continue
+		}
+		if strings.Contains(strings.ToLower(value), search) {
+			return f, value
+		}
+	}
+	return "", ""
+}
+
 // CompanyNamesByIDs returns a map of company ID → company name for a given set of IDs.
 // Efficiently implemented via a selective scan on the "companies" table.
 func (s *Store) CompanyNamesByIDs(ownerID uint, ids []uint) (map[uint]string, error) {
@@ -233,11 +372,12 @@ func (s *Store) ListAllCompaniesByTags(ownerID uint, f CompanyListFilters) ([]Co
 
 	for {
 		page, err := s.SearchCompaniesByTags(ownerID, CompanyListFilters{
-			Query:   f.Query,
-			Tags:    f.Tags,
-			ModeAND: f.ModeAND,
-			Limit:   pageSize,
-			Offset:  offset,
+			Query:           f.Query,
+			Tags:            f.Tags,
+			ModeAND:         f.ModeAND,
+			IncludeArchived: f.IncludeArchived,
+			Limit:           pageSize,
+			Offset:          offset,
 		})
 		if err != nil {
 			return nil, err
@@ -297,3 +437,17 @@ func (s *Store) ListCompaniesForExportCtx(
 
 	return companies, nil
 }
+
+// LoadCompanyForExportCtx loads one company of the owner with contact infos
+// and notes, as ListCompaniesForExportCtx does for all companies.
+func (s *Store) LoadCompanyForExportCtx(ctx context.Context, companyID, ownerID uint) (*Company, error) {
+	var company Company
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND owner_id = ?", companyID, ownerID).
+		Preload("ContactInfos").Preload("Notes").
+		First(&company).Error
+	if err != nil {
+		return nil, fmt.Errorf("load company %d for export (owner %d): %w", companyID, ownerID, err)
+	}
+	return &company, nil
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// CompanyImportRow is one company read from an import file. Line is the
+// line number in the source file and only used for reporting.
+type CompanyImportRow struct {
+	Line           int
+	Name           string
+	Address1       string
+	Zip            string
+	City           string
+	Country        string
+	VATID          string
+	CustomerNumber string
+}
+
+// CompanyImportStatus is the outcome of importing a single row.
+type CompanyImportStatus string
+
+const (
+	CompanyImportCreated CompanyImportStatus = "created"
+	CompanyImportSkipped CompanyImportStatus = "skipped" // e.g. duplicate customer number
+	CompanyImportError   CompanyImportStatus = "error"
+)
+
+// CompanyImportResult reports what happened to one CompanyImportRow.
+type CompanyImportResult struct {
+	Line           int
+	Name           string
+	CustomerNumber string
+	Status         CompanyImportStatus
+	CompanyID      uint
+	Message        string
+}
+
+// ImportCompanies creates a company for every valid row. Each row is handled
+// on its own, so a bad row does not stop the import; the returned slice has
+// one result per row in input order. Rows without a customer number get the
+// next free one from the settings counter. A customer number that is already
+// in use (or appears twice in the file) is reported and the row is skipped,
+// existing companies are never overwritten. The error is only set if the
+// import could not run at all.
+func (s *Store) ImportCompanies(ownerID uint, rows []CompanyImportRow) ([]CompanyImportResult, error) {
+	ctx := context.Background()
+	results := make([]CompanyImportResult, 0, len(rows))
+	seen := make(map[string]int) // customer number -> line of first use in this file
+
+	for _, row := range rows {
+		res := CompanyImportResult{
+			Line:           row.Line,
+			Name:           strings.TrimSpace(row.Name),
+			CustomerNumber: strings.TrimSpace(row.CustomerNumber),
+		}
+		if res.Name == "" {
+			res.Status = CompanyImportError
+			res.Message = "Name fehlt"
+			results = append(results, res)
+			continue
+		}
+
+		if res.CustomerNumber != "" {
+			if line, ok := seen[res.CustomerNumber]; ok {
+				res.Status = CompanyImportSkipped
+				res.Message = fmt.Sprintf("Kundennummer bereits in Zeile %d verwendet", line)
+				results = append(results, res)
+				continue
+			}
+			var taken int64
+			if err := s.db.Model(&Company{}).
+				Where("owner_id = ? AND customer_number = ?", ownerID, res.CustomerNumber).
+				Count(&taken).Error; err != nil {
+				return results, err
+			}
+			if taken > 0 {
+				res.Status = CompanyImportSkipped
+				res.Message = "Kundennummer bereits vergeben"
+				results = append(results, res)
+				continue
+			}
+			seen[res.CustomerNumber] = row.Line
+			if err := s.MaybeLiftCustomerCounterFor(ctx, ownerID, res.CustomerNumber); err != nil {
+				return results, err
+			}
+		} else {
+			num, _, err := s.NextCustomerNumberTx(ctx, ownerID)
+			if errors.Is(err, ErrCustomerNumberFreeform) {
+				res.Status = CompanyImportError
+				res.Message = "Kundennummer fehlt"
+				results = append(results, res)
+				continue
+			}
+			if err != nil {
+				return results, fmt.Errorf("allocate customer number: %w", err)
+			}
+			res.CustomerNumber = num
+			seen[num] = row.Line
+		}
+
+		c := &Company{
+			OwnerID:        ownerID,
+			Name:           res.Name,
+			Address1:       strings.TrimSpace(row.Address1),
+			Zip:            strings.TrimSpace(row.Zip),
+			City:           strings.TrimSpace(row.City),
+			Country:        strings.TrimSpace(row.Country),
+			VATID:          strings.TrimSpace(row.VATID),
+			CustomerNumber: res.CustomerNumber,
+			DefaultTaxRate: decimal.NewFromInt(19),
+			InvoiceTaxType: "S",
+		}
+		if err := s.SaveCompany(c, ownerID, nil); err != nil {
+			res.Status = CompanyImportError
+			res.Message = err.Error()
+			results = append(results, res)
+			continue
+		}
+		res.Status = CompanyImportCreated
+		res.CompanyID = c.ID
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,68 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestImportCompanies(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+
+	existing := fixtures.Company(fixtures.WithCompanyName("Alt GmbH"), fixtures.WithCompanyCustomerNumber("100"))
+	if err := store.SaveCompany(existing, fixtures.DefaultOwnerID, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	rows := []model.CompanyImportRow{
+		{Line: 2, Name: "Neu AG", City: "Hamburg", CustomerNumber: "200"},
+		{Line: 3, Name: "Ohne Nummer KG"},
+		{Line: 4, Name: "Doppelt GmbH", CustomerNumber: "100"},
+		{Line: 5, Name: "Nochmal AG", CustomerNumber: "200"},
+		{Line: 6, Name: "  ", CustomerNumber: "300"},
+	}
+	results, err := store.ImportCompanies(fixtures.DefaultOwnerID, rows)
+	if err != nil {
+		t.Fatalf("ImportCompanies failed: %v", err)
+	}
+	if len(results) != len(rows) {
+		t.Fatalf("results = %d, want %d", len(results), len(rows))
+	}
+
+	want := []model.CompanyImportStatus{
+		model.CompanyImportCreated,
+		model.CompanyImportCreated,
+		model.CompanyImportSkipped,
+		model.CompanyImportSkipped,
+		model.CompanyImportError,
+	}
+	for i, w := range want {
+		if results[i].Status != w {
+			t.Errorf("line %d: status = %s, want %s (%s)", results[i].Line, results[i].Status, w, results[i].Message)
+		}
+	}
+
+	// The blank customer number is allocated above the imported one.
+	if got := results[1].CustomerNumber; got != "201" {
+		t.Errorf("allocated customer number = %q, want %q", got, "201")
+	}
+
+	c, err := store.LoadCompany(results[0].CompanyID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadCompany failed: %v", err)
+	}
+	if c.City != "Hamburg" || c.CustomerNumber != "200" {
+		t.Errorf("imported company = %q/%q, want Hamburg/200", c.City, c.CustomerNumber)
+	}
+
+	// The existing company is untouched.
+	old, err := store.LoadCompany(existing.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadCompany failed: %v", err)
+	}
+	if old.Name != "Alt GmbH" {
+		t.Errorf("existing company renamed to %q", old.Name)
+	}
+}
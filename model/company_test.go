@@ -0,0 +1,208 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestArchiveCompany(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	count := func(f model.CompanyListFilters) int64 {
+		t.Helper()
+		res, err := store.SearchCompaniesByTags(fixtures.DefaultOwnerID, f)
+		if err != nil {
+			t.Fatalf("SearchCompaniesByTags failed: %v", err)
+		}
+		return res.Total
+	}
+	before := count(model.CompanyListFilters{Limit: 10})
+
+	if err := store.ArchiveCompany(data.Company.ID, fixtures.DefaultOwnerID+1); err == nil {
+		t.Error("archiving a company of another owner should fail")
+	}
+	if err := store.ArchiveCompany(data.Company.ID, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("ArchiveCompany failed: %v", err)
+	}
+
+	if got := count(model.CompanyListFilters{Limit: 10}); got != before-1 {
+		t.Errorf("default list: total = %d, want %d", got, before-1)
+	}
+	if got := count(model.CompanyListFilters{Limit: 10, IncludeArchived: true}); got != before {
+		t.Errorf("include archived: total = %d, want %d", got, before)
+	}
+
+	// Archived companies stay reachable directly, with their invoices.
+	c, err := store.LoadCompany(data.Company.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadCompany failed: %v", err)
+	}
+	if c.ArchivedAt == nil {
+		t.Error("ArchivedAt should be set")
+	}
+	if len(c.Invoices) == 0 {
+		t.Error("invoices of an archived company should still load")
+	}
+
+	if err := store.UnarchiveCompany(data.Company.ID, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("UnarchiveCompany failed: %v", err)
+	}
+	if got := count(model.CompanyListFilters{Limit: 10}); got != before {
+		t.Errorf("after unarchive: total = %d, want %d", got, before)
+	}
+}
+
+func TestCustomerNumbersPerOwner(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	ctx := context.Background()
+	const ownerA, ownerB, ownerNone uint = 2, 3, 4
+
+	for _, owner := range []uint{ownerA, ownerB} {
+		s := fixtures.Settings(fixtures.WithSettingsOwnerID(owner))
+		s.CustomerNumberPrefix = "K-"
+		s.CustomerNumberWidth = 5
+		if err := store.SaveSettings(s); err != nil {
+			t.Fatalf("SaveSettings failed: %v", err)
+		}
+	}
+	comp := fixtures.Company(fixtures.WithCompanyOwnerID(ownerA), fixtures.WithCompanyCustomerNumber("K-00001"))
+	if err := store.SaveCompany(comp, ownerA, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	// Another owner's company does not block the number.
+	if ok, msg, err := store.CheckCustomerNumber(ctx, ownerB, "K-00001", 0); err != nil || !ok {
+		t.Errorf("CheckCustomerNumber(ownerB) = %v, %q, %v; want available", ok, msg, err)
+	}
+	if ok, _, err := store.CheckCustomerNumber(ctx, ownerA, "K-00001", 0); err != nil || ok {
+		t.Errorf("CheckCustomerNumber(ownerA) = %v, %v; want taken", ok, err)
+	}
+	if num, _, err := store.NextCustomerNumberTx(ctx, ownerB); err != nil || num != "K-00001" {
+		t.Errorf("NextCustomerNumberTx(ownerB) = %q, %v; want K-00001", num, err)
+	}
+	if num, _, err := store.NextCustomerNumberTx(ctx, ownerA); err != nil || num != "K-00002" {
+		t.Errorf("NextCustomerNumberTx(ownerA) = %q, %v; want K-00002", num, err)
+	}
+
+	// Lifting the counter touches only the owner's settings.
+	if err := store.MaybeLiftCustomerCounterFor(ctx, ownerA, "K-00010"); err != nil {
+		t.Fatalf("MaybeLiftCustomerCounterFor failed: %v", err)
+	}
+	if got, err := store.SuggestNextCustomerNumber(ctx, ownerA); err != nil || got != "K-00011" {
+		t.Errorf("SuggestNextCustomerNumber(ownerA) = %q, %v; want K-00011", got, err)
+	}
+	if got, err := store.SuggestNextCustomerNumber(ctx, ownerB); err != nil || got != "K-00002" {
+		t.Errorf("SuggestNextCustomerNumber(ownerB) = %q, %v; want K-00002", got, err)
+	}
+
+	if _, err := store.SuggestNextCustomerNumber(ctx, ownerNone); !errors.Is(err, model.ErrNoSettingsRow) {
+		t.Errorf("SuggestNextCustomerNumber without settings: got %v, want ErrNoSettingsRow", err)
+	}
+	if _, _, err := store.NextCustomerNumberTx(ctx, ownerNone); !errors.Is(err, model.ErrNoSettingsRow) {
+		t.Errorf("NextCustomerNumberTx without settings: got %v, want ErrNoSettingsRow", err)
+	}
+}
+
+func TestFreeformCustomerNumbers(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	ctx := context.Background()
+	owner := fixtures.DefaultOwnerID
+
+	settings, err := store.LoadSettings(owner)
+	if err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	settings.CustomerNumberPrefix = "K-"
+	settings.CustomerNumberWidth = 5
+	settings.CustomerNumberCounter = 7
+	settings.CustomerNumberMode = model.CustomerNumberFreeform
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	if ok, msg, err := store.CheckCustomerNumber(ctx, owner, "ACME-01", 0); err != nil || !ok {
+		t.Errorf("CheckCustomerNumber(ACME-01) = %v, %q, %v; want ok", ok, msg, err)
+	}
+	comp := fixtures.Company(fixtures.WithCompanyCustomerNumber("ACME-01"))
+	if err := store.SaveCompany(comp, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	if ok, _, _ := store.CheckCustomerNumber(ctx, owner, "ACME-01", 0); ok {
+		t.Errorf("CheckCustomerNumber: duplicate ACME-01 accepted")
+	}
+
+	if _, _, err := store.NextCustomerNumberTx(ctx, owner); !errors.Is(err, model.ErrCustomerNumberFreeform) {
+		t.Errorf("NextCustomerNumberTx: got %v, want ErrCustomerNumberFreeform", err)
+	}
+	if got, err := store.SuggestNextCustomerNumber(ctx, owner); err != nil || got != "" {
+		t.Errorf("SuggestNextCustomerNumber = %q, %v; want no suggestion", got, err)
+	}
+	if err := store.MaybeLiftCustomerCounterFor(ctx, owner, "K-00100"); err != nil {
+		t.Fatalf("MaybeLiftCustomerCounterFor failed: %v", err)
+	}
+	settings, err = store.LoadSettings(owner)
+	if err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	if settings.CustomerNumberCounter != 7 {
+		t.Errorf("counter lifted to %d in freeform mode", settings.CustomerNumberCounter)
+	}
+}
+
+func TestFindCompaniesAdvanced(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+
+	hh := fixtures.Company(
+		fixtures.WithCompanyName("Nordlicht GmbH"),
+		fixtures.WithCompanyAddress("Hafenstraße 1", "20457", "Hamburg", "DE"),
+		fixtures.WithCompanyVATID("DE987654321"),
+	)
+	if err := store.SaveCompany(hh, fixtures.DefaultOwnerID, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	other := fixtures.Company(
+		fixtures.WithCompanyName("Fremd AG"),
+		fixtures.WithCompanyAddress("", "20095", "Hamburg", "DE"),
+		fixtures.WithCompanyOwnerID(fixtures.DefaultOwnerID+1),
+	)
+	if err := store.SaveCompany(other, fixtures.DefaultOwnerID+1, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	tests := []struct {
+		search string
+		fields []string
+		want   int
+	}{
+		{"hamburg", nil, 0}, // name only by default
+		{"hamburg", []string{"name", "city"}, 1},
+		{"2045", []string{"zip"}, 1},
+		{"de9876", []string{"vat_id"}, 1},
+		{"nordlicht", []string{"city", "vat_id"}, 0},
+		{"NORDLICHT", nil, 1},
+	}
+	for _, tt := range tests {
+		got, err := store.FindCompaniesAdvanced(tt.search, fixtures.DefaultOwnerID, tt.fields)
+		if err != nil {
+			t.Fatalf("FindCompaniesAdvanced(%q, %v) failed: %v", tt.search, tt.fields, err)
+		}
+		if len(got) != tt.want {
+			t.Errorf("FindCompaniesAdvanced(%q, %v) = %d companies, want %d", tt.search, tt.fields, len(got), tt.want)
+		}
+	}
+
+	if field, value := hh.SearchMatch("hamburg", []string{"name", "city"}); field != "city" || value != "Hamburg" {
+		t.Errorf("SearchMatch = %q/%q, want city/Hamburg", field, value)
+	}
+	if _, err := store.FindCompaniesAdvanced("x", fixtures.DefaultOwnerID, []string{"background"}); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
@@ -27,13 +27,42 @@ func (s *Store) ListOwnerCompanyTags(ownerID uint) ([]TagCount, error) {
 	return rows, err
 }
 
+// TagUsage is a tag with the number of companies and persons carrying it.
+type TagUsage struct {
+	Name      string `json:"name"`
+	Companies int64  `json:"companies"`
+	Persons   int64  `json:"persons"`
+	Total     int64  `json:"total"`
+}
+
+// TagUsageCounts returns all tags of an owner that are in use, with separate
+// counts for companies and persons, most used first. Soft-deleted links are
+// ignored.
+func (s *Store) TagUsageCounts(ownerID uint) ([]TagUsage, error) {
+	var rows []TagUsage
+	err := s.db.
+		Table("tag_links tl").
+		Select(`t.name AS name,
+			SUM(CASE WHEN tl.parent_type = ? THEN 1 ELSE 0 END) AS companies,
+			SUM(CASE WHEN tl.parent_type = ? THEN 1 ELSE 0 END) AS persons,
+			COUNT(*) AS total`, ParentTypeCompany, ParentTypePerson).
+		Joins("JOIN tags t ON t.id = tl.tag_id").
+		Where("tl.owner_id = ? AND tl.deleted_at IS NULL", ownerID).
+		Group("t.id, t.name").
+		Order("total DESC, LOWER(t.name) ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
 // CompanyListFilters is the input for the company search.
 type CompanyListFilters struct {
 	Query   string   // optional free text
 	Tags    []string // display names from UI (we normalize internally)
 	ModeAND bool     // true: entity must have ALL tags; false: ANY of tags
-	Limit   int
-	Offset  int
+	// IncludeArchived also returns archived companies (default: hidden)
+	IncludeArchived bool
+	Limit           int
+	Offset          int
 }
 
 // CompanyListResult bundles page results.
@@ -60,6 +89,9 @@ func (s *Store) SearchCompaniesByTags(ownerID uint, f CompanyListFilters) (Compa
 
 	// Base scope: owner companies
 	base := s.db.Model(&Company{}).Where("owner_id = ?", ownerID)
+	if !f.IncludeArchived {
+		base = base.Where("archived_at IS NULL")
+	}
 
 	// Free-text query (expand fields as you like)
 	if q := strings.TrimSpace(f.Query); q != "" {
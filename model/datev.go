@@ -0,0 +1,325 @@
+package model
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+	"gorm.io/gorm"
+)
+
+// DefaultDatevAccounts is the revenue account mapping used when
+// Settings.DatevAccounts is empty: the automatic revenue accounts of the
+// SKR03 chart, which need no tax key.
+const DefaultDatevAccounts = `S 19 8400
+S 7 8300
+AE 0 8337
+E 0 8100
+K 0 8125
+G 0 8120`
+
+// DefaultDatevDebtorAccount is the collective debtor account used when
+// Settings.DatevDebtorAccount is empty.
+const DefaultDatevDebtorAccount = "10000"
+
+// DatevAccount maps invoices of a tax category and rate to a revenue
+// account and an optional DATEV tax key (BU-Schlüssel).
+type DatevAccount struct {
+	Category string
+	Rate     decimal.Decimal
+	Account  string
+	TaxKey   string
+}
+
+// ErrDatevAccountMissing is returned by DatevBookings when an invoice has a
+// tax category and rate without a revenue account.
+var ErrDatevAccountMissing = errors.New("no DATEV account for tax category and rate")
+
+// ParseDatevAccounts parses a mapping with one entry per line: tax category,
+// rate, revenue account and an optional tax key separated by blanks, e.g.
+// "S 19 8400" or "AE 0 8337 94". Empty lines and lines starting with # are
+// skipped.
+func ParseDatevAccounts(s string) ([]DatevAccount, error) {
+	var out []DatevAccount
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 3 || len(f) > 4 {
+			return nil, fmt.Errorf("line %d: want category, rate, account and optional tax key", i+1)
+		}
+		rate, err := decimal.NewFromString(strings.Replace(f[1], ",", ".", 1))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", i+1, f[1])
+		}
+		a := DatevAccount{Category: strings.ToUpper(f[0]), Rate: rate, Account: f[2]}
+		if len(f) == 4 {
+			a.TaxKey = f[3]
+		}
+		if !isDigits(a.Account) || (a.TaxKey != "" && !isDigits(a.TaxKey)) {
+			return nil, fmt.Errorf("line %d: account and tax key must be numbers", i+1)
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// DatevBooking is one row of a DATEV booking batch. Amount is signed: credit
+// notes yield negative amounts.
+type DatevBooking struct {
+	Amount        decimal.Decimal
+	Currency      string
+	Account       string // debtor account
+	ContraAccount string // revenue account
+	TaxKey        string
+	Date          time.Time
+	Number        string // invoice number, "Belegfeld 1"
+	Text          string
+}
+
+// DatevBookings returns one booking per tax rate of each issued or paid
+// invoice of the owner with an invoice date in [from, to): the gross amount
+// in the base currency from the debtor account to the revenue account of
+// Settings.DatevAccounts. Amounts are computed like in TaxReport. An invoice
+// whose category and rate have no account fails with ErrDatevAccountMissing.
+func (s *Store) DatevBookings(ownerID uint, from, to time.Time) ([]DatevBooking, error) {
+	settings, err := s.LoadSettings(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := ParseDatevAccounts(cmp.Or(strings.TrimSpace(settings.DatevAccounts), DefaultDatevAccounts))
+	if err != nil {
+		return nil, fmt.Errorf("DATEV accounts: %w", err)
+	}
+	debtor := cmp.Or(strings.TrimSpace(settings.DatevDebtorAccount), DefaultDatevDebtorAccount)
+	currency := cmp.Or(settings.BaseCurrency, "EUR")
+
+	var invs []Invoice
+	err = s.db.
+		Where("owner_id = ? AND status IN ? AND date >= ? AND date < ?",
+			ownerID, []InvoiceStatus{InvoiceStatusIssued, InvoiceStatusPaid}, from, to).
+		Preload("InvoicePositions", "owner_id = ?", ownerID).
+		Preload("Company", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("date ASC, number ASC").
+		Find(&invs).Error
+	if err != nil {
+		return nil, fmt.Errorf("DATEV bookings (owner %d): %w", ownerID, err)
+	}
+
+	var out []DatevBooking
+	for i := range invs {
+		inv := &invs[i]
+		category := cmp.Or(inv.TaxType, "S")
+		for _, t := range invoiceRateTotals(inv) {
+			idx := slices.IndexFunc(accounts, func(a DatevAccount) bool {
+				return a.Category == category && a.Rate.Equal(t.Rate)
+			})
+			if idx < 0 {
+				return nil, fmt.Errorf("invoice %s, %s %s%%: %w", inv.Number, category, t.Rate, ErrDatevAccountMissing)
+			}
+			out = append(out, DatevBooking{
+				Amount:        inv.ToBaseCurrency(t.Net.Add(t.Tax)).Round(2),
+				Currency:      currency,
+				Account:       debtor,
+				ContraAccount: accounts[idx].Account,
+				TaxKey:        accounts[idx].TaxKey,
+				Date:          inv.Date,
+				Number:        inv.Number,
+				Text:          cmp.Or(inv.Company.Name, inv.Number),
+			})
+		}
+	}
+	return out, nil
+}
+
+// DatevHeader holds the values of the first line of a DATEV booking batch.
+type DatevHeader struct {
+	Created          time.Time
+	ConsultantNumber string // Beraternummer
+	ClientNumber     string // Mandantennummer
+	FiscalYearStart  time.Time
+	AccountLength    int // Sachkontenlänge, 4 to 8
+	From, To         time.Time
+	Label            string
+	Currency         string
+}
+
+// datevColumns are the column names of the booking batch (Buchungsstapel,
+// format version 13), written as the second line.
+var datevColumns = func() []string {
+	cols := []string{
+		"Umsatz (ohne Soll/Haben-Kz)", "Soll/Haben-Kennzeichen", "WKZ Umsatz", "Kurs",
+		"Basis-Umsatz", "WKZ Basis-Umsatz", "Konto", "Gegenkonto (ohne BU-Schlüssel)",
+		"BU-Schlüssel", "Belegdatum", "Belegfeld 1", "Belegfeld 2", "Skonto", "Buchungstext",
+		"Postensperre", "Diverse Adressnummer", "Geschäftspartnerbank", "Sachverhalt",
+		"Zinssperre", "Beleglink",
+	}
+	for i := 1; i <= 8; i++ {
+		cols = append(cols, fmt.Sprintf("Beleginfo - Art %d", i), fmt.Sprintf("Beleginfo - Inhalt %d", i))
+	}
+	cols = append(cols,
+		"KOST1 - Kostenstelle", "KOST2 - Kostenstelle", "Kost-Menge", "EU-Land u. UStID (Bestimmung)",
+		"EU-Steuersatz (Bestimmung)", "Abw. Versteuerungsart", "Sachverhalt L+L",
+		"Funktionsergänzung L+L", "BU 49 Hauptfunktionstyp", "BU 49 Hauptfunktionsnummer",
+		"BU 49 Funktionsergänzung",
+	)
+	for i := 1; i <= 20; i++ {
+		cols = append(cols, fmt.Sprintf("Zusatzinformation - Art %d", i), fmt.Sprintf("Zusatzinformation - Inhalt %d", i))
+	}
+	return append(cols,
+		"Stück", "Gewicht", "Zahlweise", "Forderungsart", "Veranlagungsjahr", "Zugeordnete Fälligkeit",
+		"Skontotyp", "Auftragsnummer", "Buchungstyp", "USt-Schlüssel (Anzahlungen)",
+		"EU-Mitgliedstaat (Anzahlungen)", "Sachverhalt L+L (Anzahlungen)",
+		"EU-Steuersatz (Anzahlungen)", "Erlöskonto (Anzahlungen)", "Herkunft-Kz", "Buchungs GUID",
+		"KOST-Datum", "SEPA-Mandatsreferenz", "Skontosperre", "Gesellschaftername",
+		"Beteiligtennummer", "Identifikationsnummer", "Zeichnernummer", "Postensperre bis",
+		"Bezeichnung SoBil-Sachverhalt", "Kennzeichen SoBil-Buchung", "Festschreibung",
+		"Leistungsdatum", "Datum Zuord. Steuerperiode", "Fälligkeit", "Generalumkehr (GU)",
+		"Steuersatz", "Land", "Abrechnungsreferenz", "BVV-Position",
+		"EU-Mitgliedstaat u. UStID (Ursprung)", "EU-Steuersatz (Ursprung)", "Abw. Skontokonto",
+	)
+}()
+
+// WriteDatevCSV writes bookings as a DATEV booking batch in the EXTF format
+// (Buchungsstapel, version 700, format version 13): the header line, the
+// column names and one line per booking, separated by semicolons with CRLF
+// line ends and encoded in Windows-1252 as DATEV expects. Texts are passed
+// through datevText, so characters Windows-1252 lacks become "?".
+func WriteDatevCSV(w io.Writer, h DatevHeader, bookings []DatevBooking) error {
+	bw := bufio.NewWriter(charmap.Windows1252.NewEncoder().Writer(w))
+	writeLine := func(fields []string) error {
+		_, err := bw.WriteString(strings.Join(fields, ";") + "\r\n")
+		return err
+	}
+	if err := writeLine(datevHeaderFields(h)); err != nil {
+		return err
+	}
+	if err := writeLine(datevColumns); err != nil {
+		return err
+	}
+	for _, b := range bookings {
+		if err := writeLine(datevBookingFields(b)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// datevHeaderFields returns the 31 fields of the EXTF header line.
+func datevHeaderFields(h DatevHeader) []string {
+	const dateLayout = "20060102"
+	return []string{
+		datevQuote("EXTF"),
+		"700",
+		"21",
+		datevQuote("Buchungsstapel"),
+		"13",
+		h.Created.Format("20060102150405") + fmt.Sprintf("%03d", h.Created.Nanosecond()/1e6),
+		"",
+		datevQuote("RE"),
+		datevQuote(""),
+		datevQuote(""),
+		datevText(h.ConsultantNumber, 7),
+		datevText(h.ClientNumber, 5),
+		h.FiscalYearStart.Format(dateLayout),
+		strconv.Itoa(h.AccountLength),
+		h.From.Format(dateLayout),
+		h.To.Format(dateLayout),
+		datevQuote(datevText(h.Label, 30)),
+		datevQuote(""),
+		"1", // Buchungstyp: Finanzbuchführung
+		"0", // Rechnungslegungszweck
+		"0", // Festschreibung
+		datevQuote(datevText(h.Currency, 3)),
+		"",
+		datevQuote(""),
+		"",
+		"",
+		datevQuote(""),
+		"",
+		"",
+		datevQuote(""),
+		datevQuote(""),
+	}
+}
+
+// datevBookingFields returns the fields of one booking line.
+func datevBookingFields(b DatevBooking) []string {
+	fields := make([]string, len(datevColumns))
+	sign := "S"
+	amount := b.Amount
+	if amount.IsNegative() {
+		sign = "H"
+		amount = amount.Neg()
+	}
+	fields[0] = strings.Replace(amount.StringFixed(2), ".", ",", 1)
+	fields[1] = datevQuote(sign)
+	fields[2] = datevQuote(datevText(b.Currency, 3))
+	fields[6] = b.Account
+	fields[7] = b.ContraAccount
+	fields[8] = datevQuote(b.TaxKey)
+	fields[9] = b.Date.Format("0201")
+	fields[10] = datevQuote(datevDocumentField(b.Number))
+	fields[13] = datevQuote(datevText(b.Text, 60))
+	return fields
+}
+
+// datevQuote encloses s in double quotes, doubling quotes inside.
+func datevQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// datevText shortens s to max runes and replaces runes that Windows-1252
+// cannot encode.
+func datevText(s string, max int) string {
+	var sb strings.Builder
+	n := 0
+	for _, r := range s {
+		if n == max {
+			break
+		}
+		if _, ok := charmap.Windows1252.EncodeRune(r); !ok {
+			r = '?'
+		}
+		sb.WriteRune(r)
+		n++
+	}
+	return sb.String()
+}
+
+// datevDocumentField returns s with the characters DATEV allows in
+// "Belegfeld 1" (letters, digits and $&%*+-/), at most 36 of them.
+func datevDocumentField(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if sb.Len() == 36 {
+			break
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune("$&%*+-/", r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
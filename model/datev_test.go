@@ -0,0 +1,147 @@
+package model_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestWriteDatevCSV(t *testing.T) {
+	h := model.DatevHeader{
+		Created:          time.Date(2025, time.July, 2, 14, 4, 40, 439e6, time.UTC),
+		ConsultantNumber: "29098",
+		ClientNumber:     "55003",
+		FiscalYearStart:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		AccountLength:    4,
+		From:             time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC),
+		To:               time.Date(2025, time.June, 30, 0, 0, 0, 0, time.UTC),
+		Label:            "Ausgangsrechnungen",
+		Currency:         "EUR",
+	}
+	bookings := []model.DatevBooking{
+		{Amount: decimal.RequireFromString("1975.4"), Currency: "EUR", Account: "10000", ContraAccount: "8400",
+			Date: time.Date(2025, time.May, 10, 0, 0, 0, 0, time.UTC), Number: "RE-2025/0001", Text: `Müller "Bau" GmbH`},
+		{Amount: decimal.RequireFromString("-119"), Currency: "EUR", Account: "10000", ContraAccount: "8337", TaxKey: "94",
+			Date: time.Date(2025, time.June, 3, 0, 0, 0, 0, time.UTC), Number: "GS_2025 #2", Text: "Kunde ✓"},
+	}
+	var buf bytes.Buffer
+	if err := model.WriteDatevCSV(&buf, h, bookings); err != nil {
+		t.Fatalf("WriteDatevCSV failed: %v", err)
+	}
+	decoded, err := charmap.Windows1252.NewDecoder().Bytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(decoded)
+	if !strings.HasSuffix(out, "\r\n") {
+		t.Error("lines must end with CRLF")
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want header, column names and 2 bookings:\n%s", len(lines), out)
+	}
+
+	header := strings.Split(lines[0], ";")
+	if len(header) != 31 {
+		t.Fatalf("header has %d fields, want 31: %s", len(header), lines[0])
+	}
+	wantHeader := map[int]string{
+		0: `"EXTF"`, 1: "700", 2: "21", 3: `"Buchungsstapel"`, 4: "13", 5: "20250702140440439",
+		10: "29098", 11: "55003", 12: "20250101", 13: "4", 14: "20250401", 15: "20250630",
+		16: `"Ausgangsrechnungen"`, 18: "1", 21: `"EUR"`,
+	}
+	for i, want := range wantHeader {
+		if header[i] != want {
+			t.Errorf("header field %d = %s, want %s", i+1, header[i], want)
+		}
+	}
+
+	columns := strings.Split(lines[1], ";")
+	if len(columns) != 125 || columns[0] != "Umsatz (ohne Soll/Haben-Kz)" || columns[124] != "Abw. Skontokonto" {
+		t.Errorf("column line: %d fields, first %q, last %q", len(columns), columns[0], columns[len(columns)-1])
+	}
+
+	wantRows := [][]string{
+		{"1975,40", `"S"`, `"EUR"`, "10000", "8400", `""`, "1005", `"RE-2025/0001"`, `"Müller ""Bau"" GmbH"`},
+		{"119,00", `"H"`, `"EUR"`, "10000", "8337", `"94"`, "0306", `"GS20252"`, `"Kunde ?"`},
+	}
+	for i, want := range wantRows {
+		f := strings.Split(lines[2+i], ";")
+		if len(f) != 125 {
+			t.Fatalf("booking %d has %d fields, want 125", i+1, len(f))
+		}
+		got := []string{f[0], f[1], f[2], f[6], f[7], f[8], f[9], f[10], f[13]}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("booking %d field %d = %s, want %s", i+1, j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestDatevBookings(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // data.Invoice stays a draft
+	owner := fixtures.DefaultOwnerID
+
+	date := time.Date(2025, time.May, 10, 0, 0, 0, 0, time.UTC)
+	positions := append(fixtures.SamplePositions(), fixtures.Position(4, "Buch", 2, 50, 7)) // 1660 at 19 %, 100 at 7 %
+	inv := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber("RE-1"),
+		fixtures.WithInvoiceDate(date), fixtures.WithInvoicePositions(positions...))
+	if err := store.SaveInvoice(inv, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, owner, date); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	from := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)
+	bookings, err := store.DatevBookings(owner, from, from.AddDate(0, 3, 0))
+	if err != nil {
+		t.Fatalf("DatevBookings failed: %v", err)
+	}
+	if len(bookings) != 2 {
+		t.Fatalf("got %d bookings, want 2: %+v", len(bookings), bookings)
+	}
+	if b := bookings[0]; b.Amount.String() != "1975.4" || b.Account != model.DefaultDatevDebtorAccount || b.ContraAccount != "8400" || b.Number != "RE-1" {
+		t.Errorf("19 %% booking = %+v", b)
+	}
+	if b := bookings[1]; b.Amount.String() != "107" || b.ContraAccount != "8300" {
+		t.Errorf("7 %% booking = %+v", b)
+	}
+
+	// A mapping without the 7 % rate cannot book the invoice.
+	settings, err := store.LoadSettings(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.DatevAccounts = "S 19 4400"
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DatevBookings(owner, from, from.AddDate(0, 3, 0)); !errors.Is(err, model.ErrDatevAccountMissing) {
+		t.Errorf("err = %v, want missing account for 7 %%", err)
+	}
+}
+
+func TestParseDatevAccounts(t *testing.T) {
+	accounts, err := model.ParseDatevAccounts("# SKR04\nS 19 4400\n\nae 0 4337 94\n")
+	if err != nil {
+		t.Fatalf("ParseDatevAccounts failed: %v", err)
+	}
+	if len(accounts) != 2 || accounts[1].Category != "AE" || accounts[1].Account != "4337" || accounts[1].TaxKey != "94" {
+		t.Errorf("accounts = %+v", accounts)
+	}
+	for _, bad := range []string{"S 19", "S x 8400", "S 19 84A0"} {
+		if _, err := model.ParseDatevAccounts(bad); err == nil {
+			t.Errorf("ParseDatevAccounts(%q) succeeded", bad)
+		}
+	}
+}
@@ -1,14 +1,19 @@
 package model
 
 import (
+	"context"
+	"strings"
+
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 // Store wraps the GORM database connection and holds the configuration
 type Store struct {
-	db     *gorm.DB
-	Config *Config
+	db      *gorm.DB
+	Config  *Config
+	userID  uint         // acting user recorded in invoice events, 0 = system
+	renders *renderQueue // background rendering, see StartRenderWorkers
 }
 
 // NewStoreFromDB creates a Store from an existing GORM database connection.
@@ -17,10 +22,37 @@ func NewStoreFromDB(db *gorm.DB, cfg *Config) *Store {
 	return &Store{db: db, Config: cfg}
 }
 
+// AsUser returns a copy of the store that records uid as the acting user in
+// the invoice history. The copy shares the database connection.
+func (s *Store) AsUser(uid uint) *Store {
+	c := *s
+	c.userID = uid
+	return &c
+}
+
+// SQLiteDSN returns the data source name for the SQLite database file
+// filename. Transactions begin IMMEDIATE, so that a transaction which reads
+// before it writes (such as issuing an invoice, see allocateInvoiceCounter)
+// holds the write lock from the start instead of failing on the upgrade, and
+// waiting writers retry for a few seconds.
+func SQLiteDSN(filename string) string {
+	sep := "?"
+	if strings.Contains(filename, "?") {
+		sep = "&"
+	}
+	return filename + sep + "_txlock=immediate&_pragma=busy_timeout(5000)"
+}
+
+// Ping checks that the database answers a trivial query (SELECT 1).
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.WithContext(ctx).Exec("SELECT 1").Error
+}
+
 // Config holds the application configuration, it is read from config.toml
 type Config struct {
 	Basedir                  string
 	CookieSecret             string
+	IdleTimeoutMinutes       int // end sessions without requests for this long, 0 disables
 	MailAPIKey               string
 	MailSecret               string
 	Mode                     string
@@ -29,11 +61,29 @@ type Config struct {
 	PublishingServerAddress  string
 	PublishingServerUsername string
 	RegistrationAllowed      bool
+	RenderWorkers            int // concurrent background renderings of invoice files, default DefaultRenderWorkers
 	Servers                  map[string]server
+	SMTP                     SMTPConfig
 	SP                       string
 	XMLDir                   string
 }
 
+// SMTPConfig is the [smtp] section of config.toml. Without a host no mail is
+// sent via SMTP.
+type SMTPConfig struct {
+	Host     string
+	Port     int    // defaults to 587 (starttls), 465 (tls) or 25 (none)
+	User     string // no authentication if empty
+	Password string
+	From     string // sender address, e.g. "billingcat <app@example.com>"
+	TLS      string // "starttls" (default), "tls" (implicit TLS) or "none"
+}
+
+// Configured reports whether mail should be sent via SMTP.
+func (c SMTPConfig) Configured() bool {
+	return c.Host != ""
+}
+
 type server struct {
 	Database   string
 	DBName     string
@@ -15,7 +15,7 @@ func InitDatabase(cfg *Config) (*Store, error) {
 	filename := svr.DBName
 	fmt.Println("Use server sqlite and database", filename)
 
-	db, err := gorm.Open(sqlite.Open(filename), gormLoggerFor(cfg, svr))
+	db, err := gorm.Open(sqlite.Open(SQLiteDSN(filename)), gormLoggerFor(cfg, svr))
 	if err != nil {
 		return nil, err
 	}
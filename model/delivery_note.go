@@ -0,0 +1,177 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/boxesandglue/bagme/document"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultDeliveryNoteNumberTemplate is used while
+// Settings.DeliveryNoteNumberTemplate is empty.
+const DefaultDeliveryNoteNumberTemplate = "LS-%YYYY%-%04C%"
+
+// DeliveryNote (Lieferschein) lists the positions of an invoice without
+// prices. It is a separate document with its own number, the invoice (totals,
+// XML, PDF) is not changed by it.
+type DeliveryNote struct {
+	ID           uint      `gorm:"primaryKey"`
+	CreatedAt    time.Time `gorm:"not null"`
+	OwnerID      uint      `gorm:"not null;index"`
+	InvoiceID    uint      `gorm:"not null;index"`
+	Number       string    `gorm:"not null"`
+	DeliveryDate time.Time `gorm:"not null"`
+	// ShowInvoiceNumber prints the number of the invoice on the note.
+	ShowInvoiceNumber bool `gorm:"not null;default:false"`
+}
+
+func (DeliveryNote) TableName() string { return "delivery_notes" }
+
+// CreateDeliveryNote numbers and stores a new delivery note for inv. The
+// number comes from Settings.DeliveryNoteNumberTemplate and the owner's
+// delivery note counter, which is raised in the same transaction.
+func (s *Store) CreateDeliveryNote(inv *Invoice, ownerID uint, deliveryDate time.Time, showInvoiceNumber bool) (*DeliveryNote, error) {
+	if inv.OwnerID != ownerID {
+		return nil, errors.New("CreateDeliveryNote: invoice belongs to another owner")
+	}
+	note := &DeliveryNote{
+		OwnerID:           ownerID,
+		InvoiceID:         inv.ID,
+		DeliveryDate:      deliveryDate,
+		ShowInvoiceNumber: showInvoiceNumber,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock settings row for update (Postgres). SQLite ignores this clause.
+		var settings Settings
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("owner_id = ?", ownerID).
+			First(&settings).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoSettingsRow
+			}
+			return err
+		}
+		var company Company
+		if err := tx.Where("id = ? AND owner_id = ?", inv.CompanyID, ownerID).Limit(1).Find(&company).Error; err != nil {
+			return err
+		}
+		counter := settings.DeliveryNoteCounter + 1
+		if err := tx.Model(&Settings{}).Where("id = ?", settings.ID).
+			Update("delivery_note_counter", counter).Error; err != nil {
+			return err
+		}
+		tpl := settings.DeliveryNoteNumberTemplate
+		if strings.TrimSpace(tpl) == "" {
+			tpl = DefaultDeliveryNoteNumberTemplate
+		}
+		note.Number = FormatInvoiceNumber(tpl, company.CustomerNumber, int(counter), deliveryDate)
+		return tx.Create(note).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create delivery note for invoice %d: %w", inv.ID, err)
+	}
+	return note, nil
+}
+
+// ListDeliveryNotes returns the delivery notes of an invoice, oldest first.
+func (s *Store) ListDeliveryNotes(invoiceID, ownerID uint) ([]DeliveryNote, error) {
+	var notes []DeliveryNote
+	err := s.db.Where("invoice_id = ? AND owner_id = ?", invoiceID, ownerID).
+		Order("id ASC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// LoadDeliveryNote loads one delivery note of the owner.
+func (s *Store) LoadDeliveryNote(id, ownerID uint) (*DeliveryNote, error) {
+	var note DeliveryNote
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&note).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// CreateDeliveryNotePDF renders the delivery note for inv to pdfpath. Like
+// reminders it uses the invoice's letterhead template when one is set,
+// otherwise the generic layout, and carries no ZUGFeRD attachment.
+func (s *Store) CreateDeliveryNotePDF(inv *Invoice, note *DeliveryNote, ownerID uint, pdfpath string, logger *slog.Logger) error {
+	settings, err := s.LoadSettings(ownerID)
+	if err != nil {
+		return fmt.Errorf("load settings: %w", err)
+	}
+	company, err := s.LoadCompany(inv.CompanyID, ownerID)
+	if err != nil {
+		return fmt.Errorf("load company %d: %w", inv.CompanyID, err)
+	}
+
+	d, err := document.New(pdfpath)
+	if err != nil {
+		return fmt.Errorf("create pdf document: %w", err)
+	}
+	d.Title = "Lieferschein " + note.Number
+	d.Author = settings.CompanyName
+	d.Language = "de"
+
+	addressee := buildAddresseeInnerHTML(inv, company)
+	info := buildDeliveryNoteInfoInnerHTML(inv, note)
+	body := buildDeliveryNoteBodyHTML(inv, note)
+
+	if inv.TemplateID != nil && inv.Template != nil {
+		err = s.renderLetterheadPages(d, inv.Template, ownerID, addressee, info, body, "")
+	} else {
+		err = s.renderGenericPages(d, buildGenericPageHTML(settings, addressee, info, body), inv.ID, ownerID, logger)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = d.Finish(); err != nil {
+		return fmt.Errorf("finish pdf: %w", err)
+	}
+	logger.Debug("generated delivery note PDF", "invoice_id", inv.ID, "owner_id", ownerID,
+		"number", note.Number, "pdfpath", pdfpath)
+	return nil
+}
+
+// buildDeliveryNoteInfoInnerHTML renders the info block of a delivery note:
+// number, date, delivery date and optionally the invoice number.
+func buildDeliveryNoteInfoInnerHTML(inv *Invoice, note *DeliveryNote) string {
+	var b strings.Builder
+	b.WriteString("Lieferschein-Nr.: " + esc(note.Number) + "<br/>")
+	b.WriteString("Datum: " + esc(formatDateDE(note.CreatedAt)) + "<br/>")
+	b.WriteString("Lieferdatum: " + esc(formatDateDE(note.DeliveryDate)))
+	if note.ShowInvoiceNumber {
+		b.WriteString("<br/>zu Rechnung " + esc(inv.Number))
+	}
+	return b.String()
+}
+
+// buildDeliveryNoteBodyHTML renders the positions of inv with quantity, unit
+// and description only. Prices and totals are left out on purpose.
+func buildDeliveryNoteBodyHTML(inv *Invoice, note *DeliveryNote) string {
+	var b strings.Builder
+	b.WriteString(`<p class="opening"><b>Lieferschein ` + esc(note.Number) + `</b></p>`)
+	b.WriteString(`<table class="items"><thead><tr>`)
+	b.WriteString(`<th class="num">Pos.</th>`)
+	b.WriteString(`<th class="num">Menge</th>`)
+	b.WriteString(`<th class="unit">Einheit</th>`)
+	b.WriteString(`<th>Beschreibung</th>`)
+	b.WriteString(`</tr></thead><tbody>`)
+	for _, pos := range inv.InvoicePositions {
+		b.WriteString(`<tr>`)
+		b.WriteString(`<td class="num">` + fmt.Sprint(pos.Position) + `</td>`)
+		b.WriteString(`<td class="num">` + esc(formatQuantityDE(pos.Quantity)) + `</td>`)
+		b.WriteString(`<td class="unit">` + esc(unitCodeToText(pos.UnitCode)) + `</td>`)
+		b.WriteString(`<td>` + esc(pos.Text) + `</td>`)
+		b.WriteString(`</tr>`)
+	}
+	b.WriteString(`</tbody></table>`)
+	b.WriteString(`<p class="closing">Ware vollständig und in einwandfreiem Zustand erhalten:<br/><br/><br/>` +
+		`Datum, Unterschrift</p>`)
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package model_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestCreateDeliveryNote(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	inv, err := store.LoadInvoiceWithTemplate(data.Invoice.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoiceWithTemplate failed: %v", err)
+	}
+	deliveryDate := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+
+	// Without a template the default one is used.
+	first, err := store.CreateDeliveryNote(inv, fixtures.DefaultOwnerID, deliveryDate, true)
+	if err != nil {
+		t.Fatalf("CreateDeliveryNote failed: %v", err)
+	}
+	if want := model.FormatInvoiceNumber(model.DefaultDeliveryNoteNumberTemplate, "", 1, deliveryDate); first.Number != want {
+		t.Errorf("first number = %q, want %q", first.Number, want)
+	}
+
+	data.Settings.DeliveryNoteNumberTemplate = "LS-%03C%"
+	if err := store.SaveSettings(data.Settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	second, err := store.CreateDeliveryNote(inv, fixtures.DefaultOwnerID, deliveryDate, false)
+	if err != nil {
+		t.Fatalf("CreateDeliveryNote failed: %v", err)
+	}
+	if second.Number != "LS-002" {
+		t.Errorf("second number = %q, want %q", second.Number, "LS-002")
+	}
+
+	notes, err := store.ListDeliveryNotes(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("ListDeliveryNotes failed: %v", err)
+	}
+	if len(notes) != 2 || notes[0].ID != first.ID || notes[1].ID != second.ID {
+		t.Fatalf("ListDeliveryNotes = %+v, want notes %d and %d", notes, first.ID, second.ID)
+	}
+	if _, err := store.LoadDeliveryNote(first.ID, fixtures.DefaultOwnerID+1); err == nil {
+		t.Error("expected error loading a delivery note of another owner")
+	}
+
+	pdfPath := filepath.Join(t.TempDir(), "deliverynote.pdf")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := store.CreateDeliveryNotePDF(inv, first, fixtures.DefaultOwnerID, pdfPath, logger); err != nil {
+		t.Fatalf("CreateDeliveryNotePDF failed: %v", err)
+	}
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF")
+	}
+
+	// Delivery notes must not touch the invoice.
+	after, _ := store.LoadInvoiceWithTemplate(inv.ID, fixtures.DefaultOwnerID)
+	if !after.NetTotal.Equal(inv.NetTotal) || after.Number != inv.Number {
+		t.Errorf("invoice changed: net %s -> %s, number %q -> %q", inv.NetTotal, after.NetTotal, inv.Number, after.Number)
+	}
+}
@@ -34,10 +34,7 @@ type InvoiceMailData struct {
 
 // InvoiceMailPlaceholders lists the placeholders shown in the editor help text.
 // Keep in sync with InvoiceMailData fields and BuildInvoiceMailData.
-var InvoiceMailPlaceholders = []struct {
-	Name string
-	Desc string
-}{
+var InvoiceMailPlaceholders = []EmailPlaceholder{
 	{"Number", "Rechnungsnummer"},
 	{"Date", "Rechnungsdatum (TT.MM.JJJJ)"},
 	{"DueDate", "Fälligkeitsdatum (TT.MM.JJJJ)"},
@@ -117,13 +114,18 @@ func renderOrDefault(tpl, fallback string, data any) string {
 }
 
 func tryRender(tpl string, data any) (string, bool) {
+	out, err := renderEmailTemplate(tpl, data)
+	return out, err == nil
+}
+
+func renderEmailTemplate(tpl string, data any) (string, error) {
 	t, err := template.New("mail").Option("missingkey=zero").Parse(tpl)
 	if err != nil {
-		return "", false
+		return "", err
 	}
 	var buf bytes.Buffer
 	if err := t.Execute(&buf, data); err != nil {
-		return "", false
+		return "", err
 	}
-	return buf.String(), true
+	return buf.String(), nil
 }
@@ -172,3 +172,66 @@ func TestSaveEmailTemplate_EmptyDeletes(t *testing.T) {
 		t.Errorf("expected company override to be deleted, got %+v", got)
 	}
 }
+
+func TestRenderEmail_DefaultAndOverride(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := model.PasswordResetMailData{Name: "Erika", Link: "https://example.com/reset/abc", ValidMinutes: 60}
+
+	subject, body, err := store.RenderEmail(fixtures.DefaultOwnerID, model.EmailTemplateKindPasswordReset, data)
+	if err != nil {
+		t.Fatalf("RenderEmail failed: %v", err)
+	}
+	if subject != "Reset your password" || !strings.Contains(body, data.Link) || !strings.Contains(body, "60 minutes") {
+		t.Errorf("default mail: subject %q, body:\n%s", subject, body)
+	}
+
+	if err := store.SaveEmailTemplate(&model.EmailTemplate{
+		OwnerID: fixtures.DefaultOwnerID,
+		Kind:    model.EmailTemplateKindPasswordReset,
+		Body:    "Hallo {{.Name}}, hier ist dein Link: {{.Link}}",
+	}); err != nil {
+		t.Fatalf("SaveEmailTemplate: %v", err)
+	}
+	subject, body, err = store.RenderEmail(fixtures.DefaultOwnerID, model.EmailTemplateKindPasswordReset, data)
+	if err != nil {
+		t.Fatalf("RenderEmail failed: %v", err)
+	}
+	if subject != "Reset your password" {
+		t.Errorf("empty subject should fall back to default, got %q", subject)
+	}
+	if body != "Hallo Erika, hier ist dein Link: https://example.com/reset/abc" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	// Other tenants and mails without tenant keep the built-in texts.
+	if _, body, _ := store.RenderEmail(fixtures.DefaultOwnerID+1, model.EmailTemplateKindPasswordReset, data); strings.HasPrefix(body, "Hallo") {
+		t.Errorf("template of another owner used: %q", body)
+	}
+	if _, body, _ := store.RenderEmail(0, model.EmailTemplateKindPasswordReset, data); strings.HasPrefix(body, "Hallo") {
+		t.Errorf("template used without owner: %q", body)
+	}
+
+	if _, _, err := store.RenderEmail(fixtures.DefaultOwnerID, "unknown", data); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
+
+func TestRenderEmailPreview(t *testing.T) {
+	subject, body, err := model.RenderEmailPreview(model.EmailTemplateKindTeamInvitation, "Von {{.Inviter}}", "")
+	if err != nil {
+		t.Fatalf("RenderEmailPreview failed: %v", err)
+	}
+	if subject != "Von Erika Mustermann" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "7 days") {
+		t.Errorf("empty body should render the default, got:\n%s", body)
+	}
+
+	if _, _, err := model.RenderEmailPreview(model.EmailTemplateKindInvoice, "{{.Number", ""); err == nil {
+		t.Error("expected parse error")
+	}
+	if _, _, err := model.RenderEmailPreview(model.EmailTemplateKindInvoice, "", "{{.Unknown}}"); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
@@ -2,20 +2,192 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-// EmailTemplateKind identifies the message that a template configures
-// (currently only invoice mails; further kinds like reminders can be added).
+// EmailTemplateKind identifies the message that a template configures.
+// Further kinds are added to emailKinds.
 type EmailTemplateKind string
 
 const (
-	EmailTemplateKindInvoice EmailTemplateKind = "invoice"
+	EmailTemplateKindInvoice        EmailTemplateKind = "invoice"
+	EmailTemplateKindPasswordReset  EmailTemplateKind = "password_reset"
+	EmailTemplateKindTeamInvitation EmailTemplateKind = "team_invitation"
+	// EmailTemplateKindSignup is the confirmation mail of a new account.
+	// There is no tenant yet, so it always uses the built-in texts.
+	EmailTemplateKindSignup EmailTemplateKind = "signup"
 )
 
+// EmailPlaceholder documents a template field for the editor.
+type EmailPlaceholder struct {
+	Name string
+	Desc string
+}
+
+// PasswordResetMailData holds the values exposed to password reset mails.
+type PasswordResetMailData struct {
+	Name         string
+	Email        string
+	Link         string
+	ValidMinutes int
+}
+
+// TeamInvitationMailData holds the values exposed to team invitation mails.
+type TeamInvitationMailData struct {
+	Inviter   string
+	Link      string
+	ValidDays int
+}
+
+// SignupMailData holds the values exposed to signup confirmation mails.
+type SignupMailData struct {
+	Email        string
+	Link         string
+	ValidMinutes int
+}
+
+// EmailKind describes a mail kind: the built-in texts used without a
+// template, the placeholders available in templates and sample data for the
+// preview in the editor.
+type EmailKind struct {
+	Kind           EmailTemplateKind
+	DefaultSubject string
+	DefaultBody    string
+	Placeholders   []EmailPlaceholder
+	Sample         any
+}
+
+var emailKinds = []EmailKind{
+	{
+		Kind:           EmailTemplateKindInvoice,
+		DefaultSubject: DefaultInvoiceMailSubject,
+		DefaultBody:    DefaultInvoiceMailBody,
+		Placeholders:   InvoiceMailPlaceholders,
+		Sample: InvoiceMailData{
+			Number:   "RE-2025-0042",
+			Date:     "15.03.2025",
+			DueDate:  "29.03.2025",
+			Amount:   "1190.00",
+			NetTotal: "1000.00",
+			TaxTotal: "190.00",
+			Contact:  "Erika Mustermann",
+			Company:  "Beispiel GmbH",
+		},
+	},
+	{
+		Kind:           EmailTemplateKindPasswordReset,
+		DefaultSubject: "Reset your password",
+		DefaultBody:    "Click the link to reset your password:\n\n{{.Link}}\n\nThe link is valid for {{.ValidMinutes}} minutes.",
+		Placeholders: []EmailPlaceholder{
+			{"Name", "Name des Benutzers"},
+			{"Email", "E-Mail-Adresse des Benutzers"},
+			{"Link", "Link zum Zurücksetzen des Passworts"},
+			{"ValidMinutes", "Gültigkeit des Links in Minuten"},
+		},
+		Sample: PasswordResetMailData{
+			Name:         "Erika Mustermann",
+			Email:        "erika@example.com",
+			Link:         "https://app.example.com/password/reset/…",
+			ValidMinutes: 60,
+		},
+	},
+	{
+		Kind:           EmailTemplateKindTeamInvitation,
+		DefaultSubject: "Invitation to billingcat",
+		DefaultBody:    "{{.Inviter}} invited you to work together on billingcat.\n\nCreate your account here:\n\n{{.Link}}\n\nThe link is valid for {{.ValidDays}} days.",
+		Placeholders: []EmailPlaceholder{
+			{"Inviter", "Name der einladenden Person"},
+			{"Link", "Link zum Anlegen des Zugangs"},
+			{"ValidDays", "Gültigkeit des Links in Tagen"},
+		},
+		Sample: TeamInvitationMailData{
+			Inviter:   "Erika Mustermann",
+			Link:      "https://app.example.com/team/join?token=…",
+			ValidDays: 7,
+		},
+	},
+	{
+		Kind:           EmailTemplateKindSignup,
+		DefaultSubject: "Confirm your email",
+		DefaultBody:    "Please confirm your email for billingcat:\n\n{{.Link}}\n\nThe link is valid for {{.ValidMinutes}} minutes. If you did not request this, you can ignore this message.",
+		Placeholders: []EmailPlaceholder{
+			{"Email", "E-Mail-Adresse des neuen Zugangs"},
+			{"Link", "Bestätigungslink"},
+			{"ValidMinutes", "Gültigkeit des Links in Minuten"},
+		},
+		Sample: SignupMailData{
+			Email:        "erika@example.com",
+			Link:         "https://app.example.com/verify?token=…",
+			ValidMinutes: 30,
+		},
+	},
+}
+
+// LookupEmailKind returns the description of a mail kind.
+func LookupEmailKind(kind EmailTemplateKind) (EmailKind, bool) {
+	for _, k := range emailKinds {
+		if k.Kind == kind {
+			return k, true
+		}
+	}
+	return EmailKind{}, false
+}
+
+// RenderEmail returns subject and body of a mail of the given kind for the
+// owner, filled with data. The owner's template is used field by field,
+// empty or broken fields fall back to the built-in texts (like
+// RenderInvoiceMail, without the company layer). ownerID 0 always renders
+// the built-in texts.
+func (s *Store) RenderEmail(ownerID uint, kind EmailTemplateKind, data any) (subject, body string, err error) {
+	k, ok := LookupEmailKind(kind)
+	if !ok {
+		return "", "", fmt.Errorf("unknown mail kind %q", kind)
+	}
+	subjectTpl, bodyTpl := k.DefaultSubject, k.DefaultBody
+	if ownerID != 0 {
+		if t, terr := s.LoadOwnerEmailTemplate(ownerID, kind); terr != nil {
+			err = terr
+		} else if t != nil {
+			if t.Subject != "" {
+				subjectTpl = t.Subject
+			}
+			if t.Body != "" {
+				bodyTpl = t.Body
+			}
+		}
+	}
+	subject = renderOrDefault(subjectTpl, k.DefaultSubject, data)
+	body = renderOrDefault(bodyTpl, k.DefaultBody, data)
+	return subject, body, err
+}
+
+// RenderEmailPreview renders the given subject and body templates with the
+// sample data of the kind. Unlike RenderEmail, errors in the templates are
+// reported instead of falling back to the built-in texts.
+func RenderEmailPreview(kind EmailTemplateKind, subjectTpl, bodyTpl string) (subject, body string, err error) {
+	k, ok := LookupEmailKind(kind)
+	if !ok {
+		return "", "", fmt.Errorf("unknown mail kind %q", kind)
+	}
+	if subjectTpl == "" {
+		subjectTpl = k.DefaultSubject
+	}
+	if bodyTpl == "" {
+		bodyTpl = k.DefaultBody
+	}
+	if subject, err = renderEmailTemplate(subjectTpl, k.Sample); err != nil {
+		return "", "", fmt.Errorf("Betreff: %w", err)
+	}
+	if body, err = renderEmailTemplate(bodyTpl, k.Sample); err != nil {
+		return "", "", fmt.Errorf("Nachricht: %w", err)
+	}
+	return subject, body, nil
+}
+
 // EmailTemplate stores a customizable mail subject + body.
 //
 // CompanyID == 0 means the row is the owner-wide default for the given kind.
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SetWebhookRetryDelays replaces the pauses between webhook delivery
+// attempts for the duration of a test and returns a function restoring them.
+func SetWebhookRetryDelays(d ...time.Duration) (restore func()) {
+	old := webhookRetryDelays
+	webhookRetryDelays = d
+	return func() { webhookRetryDelays = old }
+}
+
+// SetRenderRetryDelays replaces the pauses between the attempts of a render
+// job for the duration of a test and returns a function restoring them.
+func SetRenderRetryDelays(d ...time.Duration) (restore func()) {
+	old := renderRetryDelays
+	renderRetryDelays = d
+	return func() { renderRetryDelays = old }
+}
+
+// AllowLocalWebhooks lets webhooks reach localhost for the duration of a
+// test and returns a function restoring the address check.
+func AllowLocalWebhooks() (restore func()) {
+	webhookAllowLocal = true
+	return func() { webhookAllowLocal = false }
+}
+
+// WebhookDialControl exposes the address check of webhook connections.
+var WebhookDialControl = webhookDialControl
+
+// CreateWebhookDeliveryForTest stores d as is, without sending it.
+func (s *Store) CreateWebhookDeliveryForTest(d *WebhookDelivery) error {
+	return s.db.Create(d).Error
+}
+
+// PurgeInvoiceTrash exposes purgeInvoiceTrash, which RunMaintenance calls
+// with InvoiceTrashRetention.
+var PurgeInvoiceTrash = purgeInvoiceTrash
+
+// CountInvoiceReferencesForTest counts the rows of each table that refer to
+// the invoice, including the invoice itself, soft deleted rows included. The
+// append-only change history is not counted.
+func (s *Store) CountInvoiceReferencesForTest(invoiceID uint) (map[string]int64, error) {
+	counts := map[string]int64{}
+	var n int64
+	if err := s.db.Unscoped().Model(&Invoice{}).Where("id = ?", invoiceID).Count(&n).Error; err != nil {
+		return nil, err
+	}
+	counts["invoices"] = n
+	for _, m := range []any{
+		&InvoicePosition{}, &InvoiceAttachment{}, &InvoiceValidation{}, &DeliveryNote{},
+		&Payment{}, &WebhookDelivery{}, &TimeEntry{},
+	} {
+		stmt := &gorm.Statement{DB: s.db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		if err := s.db.Unscoped().Model(m).Where("invoice_id = ?", invoiceID).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts[stmt.Schema.Table] = n
+	}
+	return counts, nil
+}
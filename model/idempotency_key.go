@@ -0,0 +1,78 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyTTL is how long a client supplied Idempotency-Key is
+// remembered. Within this window a retried request gets the original response.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKey remembers the outcome of an API request that was sent with an
+// Idempotency-Key header. RequestHash identifies the request body so that a
+// key reused for a different request can be detected. StatusCode is 0 while
+// the original request is still being processed.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primaryKey"`
+	CreatedAt   time.Time `gorm:"not null;index"`
+	OwnerID     uint      `gorm:"not null;uniqueIndex:idx_idempotency_keys_owner_key"`
+	Key         string    `gorm:"column:idempotency_key;type:text;not null;uniqueIndex:idx_idempotency_keys_owner_key"`
+	RequestHash string    `gorm:"type:text;not null"`
+	StatusCode  int       `gorm:"not null;default:0"`
+	ContentType string    `gorm:"type:text"`
+	Response    []byte
+}
+
+func (IdempotencyKey) TableName() string { return "idempotency_keys" }
+
+// ReserveIdempotencyKey claims key for the owner. If the key is new (or the
+// previous use has expired) a fresh record is created and created is true.
+// Otherwise the existing record is returned and the caller decides whether to
+// replay its response or reject the request.
+func (s *Store) ReserveIdempotencyKey(ownerID uint, key, requestHash string) (rec *IdempotencyKey, created bool, err error) {
+	// An expired key may be used again.
+	if err = s.db.Where("owner_id = ? AND idempotency_key = ? AND created_at < ?", ownerID, key, time.Now().Add(-IdempotencyKeyTTL)).
+		Delete(&IdempotencyKey{}).Error; err != nil {
+		return nil, false, err
+	}
+
+	rec = &IdempotencyKey{OwnerID: ownerID, Key: key, RequestHash: requestHash}
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(rec)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return rec, true, nil
+	}
+
+	var existing IdempotencyKey
+	if err = s.db.Where("owner_id = ? AND idempotency_key = ?", ownerID, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response for a reserved key.
+func (s *Store) CompleteIdempotencyKey(id uint, statusCode int, contentType string, response []byte) error {
+	return s.db.Model(&IdempotencyKey{}).Where("id = ?", id).Updates(map[string]any{
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"response":     response,
+	}).Error
+}
+
+// ReleaseIdempotencyKey removes a reservation after the request failed, so
+// that the client can retry with the same key.
+func (s *Store) ReleaseIdempotencyKey(id uint) error {
+	return s.db.Delete(&IdempotencyKey{}, id).Error
+}
+
+// deleteExpiredIdempotencyKeys removes keys older than IdempotencyKeyTTL.
+func deleteExpiredIdempotencyKeys(ctx context.Context, s *Store) error {
+	return s.db.WithContext(ctx).
+		Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`, time.Now().Add(-IdempotencyKeyTTL)).
+		Error
+}
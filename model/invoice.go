@@ -1,14 +1,15 @@
 package model
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/beevik/etree"
 	"github.com/biter777/countries"
 	"github.com/shopspring/decimal"
 	"github.com/speedata/einvoice"
@@ -29,6 +30,89 @@ func (s InvoiceStatus) IsFinal() bool {
 	return s == InvoiceStatusPaid || s == InvoiceStatusVoided
 }
 
+// DocumentType distinguishes regular invoices from credit notes (Gutschriften).
+type DocumentType string
+
+const (
+	DocumentTypeInvoice    DocumentType = "invoice"
+	DocumentTypeCreditNote DocumentType = "creditnote"
+)
+
+// TypeCode returns the UNTDID 1001 document code used in the e-invoice
+// (BT-3): 380 for commercial invoices, 381 for credit notes.
+func (d DocumentType) TypeCode() einvoice.CodeDocument {
+	if d == DocumentTypeCreditNote {
+		return 381
+	}
+	return 380
+}
+
+// Title returns the German document title printed on the PDF.
+func (d DocumentType) Title() string {
+	if d == DocumentTypeCreditNote {
+		return "Gutschrift"
+	}
+	return "Rechnung"
+}
+
+// ZugferdProfile is the ZUGFeRD/Factur-X conformance level of the e-invoice
+// embedded in the PDF. It is ignored for companies that receive XRechnung.
+// All levels need the EN 16931 core: number, date, seller and buyer name and
+// postal address with country, the seller's VAT ID or tax number, at least
+// one line, the VAT breakdown and a due date or payment terms. Beyond that:
+//
+//   - BASIC: the core only; article numbers (BT-155, BT-156) and the
+//     rounding amount (BT-114) are not transmitted.
+//   - EN 16931: the default, all fields billingcat records.
+//   - EXTENDED: additionally the business process (BT-23), which is empty
+//     unless the recipient prescribes one.
+type ZugferdProfile string
+
+const (
+	ZugferdProfileBasic    ZugferdProfile = "basic"
+	ZugferdProfileEN16931  ZugferdProfile = "en16931"
+	ZugferdProfileExtended ZugferdProfile = "extended"
+)
+
+// orDefault maps unknown or empty values to ZugferdProfileEN16931.
+func (p ZugferdProfile) orDefault() ZugferdProfile {
+	switch p {
+	case ZugferdProfileBasic, ZugferdProfileExtended:
+		return p
+	}
+	return ZugferdProfileEN16931
+}
+
+// einvoiceProfile returns the profile constant of the einvoice library.
+func (p ZugferdProfile) einvoiceProfile() einvoice.CodeProfileType {
+	switch p.orDefault() {
+	case ZugferdProfileBasic:
+		return einvoice.CProfileBasic
+	case ZugferdProfileExtended:
+		return einvoice.CProfileExtended
+	}
+	return einvoice.CProfileEN16931
+}
+
+// conformanceLevel returns the level declared in the PDF's XMP metadata.
+func (p ZugferdProfile) conformanceLevel() string {
+	switch p.orDefault() {
+	case ZugferdProfileBasic:
+		return "BASIC"
+	case ZugferdProfileExtended:
+		return "EXTENDED"
+	}
+	return "EN 16931"
+}
+
+// orDefault maps unknown or empty values to DocumentTypeInvoice.
+func (d DocumentType) orDefault() DocumentType {
+	if d == DocumentTypeCreditNote {
+		return d
+	}
+	return DocumentTypeInvoice
+}
+
 type Invoice struct {
 	gorm.Model
 	CompanyID        uint
@@ -57,11 +141,115 @@ type Invoice struct {
 	IssuedAt         *time.Time    // set when status -> issued
 	PaidAt           *time.Time    // set when status -> paid
 	VoidedAt         *time.Time    // set when status -> voided
+	SentAt           *time.Time    // set when the invoice was emailed to the customer
+	DocumentType     DocumentType  `gorm:"type:text;not null;default:invoice"`
+	// ZugferdProfile is the conformance level of the embedded e-invoice.
+	ZugferdProfile ZugferdProfile `gorm:"type:text;not null;default:en16931"`
+	// ReferencedInvoiceNumber is the number of the original invoice a credit
+	// note refers to (BT-25). Empty for regular invoices.
+	ReferencedInvoiceNumber string
+	// CounterAllocated is set once Counter was allocated from the number
+	// sequence (when the invoice was first issued). An invoice reverted to
+	// draft keeps its counter and number when it is issued again.
+	CounterAllocated bool `gorm:"not null;default:false"`
+	// ReminderLevel counts the payment reminders sent for this invoice
+	// (0 = none, 1 = Zahlungserinnerung, 2+ = Mahnung).
+	ReminderLevel int `gorm:"not null;default:0"`
+	// SkontoPercent and SkontoDays describe the early-payment discount:
+	// paying within SkontoDays of the invoice date allows deducting
+	// SkontoPercent of the gross total. Zero values mean no discount.
+	SkontoPercent decimal.Decimal `gorm:"type:text;not null;default:'0'"`
+	SkontoDays    int             `gorm:"not null;default:0"`
+	// SkontoAmount is the amount to pay when the discount is taken. It is
+	// computed, not stored.
+	SkontoAmount decimal.Decimal `gorm:"-"`
+	// PaymentReference is the remittance information the customer should
+	// quote (BT-83). It is derived from Settings.PaymentReferenceTemplate and
+	// frozen when the invoice is issued.
+	PaymentReference string `gorm:"not null;default:''"`
+	// RenderError is the error of the last failed background rendering of
+	// the PDF (see StartRenderWorkers). It is empty once the PDF was rendered.
+	RenderError string `gorm:"not null;default:''"`
+	// RoundingMode controls how RecomputeTotals rounds the tax. Like
+	// PriceDecimals, drafts follow the owner's settings and the value is
+	// frozen when the invoice is issued.
+	RoundingMode RoundingMode `gorm:"not null;default:'total'"`
+	// PriceDecimals is the number of decimals unit prices are rounded to,
+	// line totals are rounded to cents. Drafts take it from the owner's
+	// settings on every load and save; it is frozen when the invoice is
+	// issued, so that its documents do not change with the setting.
+	PriceDecimals int `gorm:"not null;default:2"`
+	// ExchangeRate converts amounts in Currency to the owner's base currency
+	// (Settings.BaseCurrency): one unit of Currency is worth ExchangeRate
+	// units of the base currency. It is 1 for invoices in the base currency
+	// and only used for reporting, the invoice itself stays in Currency.
+	ExchangeRate decimal.Decimal `gorm:"type:text;not null;default:'1'"`
 
 	TemplateID *uint
 	Template   *LetterheadTemplate `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 }
 
+// ToBaseCurrency converts an amount in the invoice currency to the base
+// currency.
+func (i *Invoice) ToBaseCurrency(amount decimal.Decimal) decimal.Decimal {
+	return amount.Mul(i.exchangeRate())
+}
+
+// exchangeRate returns ExchangeRate; a missing rate counts as 1.
+func (i *Invoice) exchangeRate() decimal.Decimal {
+	if !i.ExchangeRate.IsPositive() {
+		return decimal.NewFromInt(1)
+	}
+	return i.ExchangeRate
+}
+
+// IsCreditNote reports whether the invoice is a credit note (type code 381).
+func (i *Invoice) IsCreditNote() bool {
+	return i.DocumentType == DocumentTypeCreditNote
+}
+
+// HasSkonto reports whether the invoice grants an early-payment discount.
+func (i *Invoice) HasSkonto() bool {
+	return i.SkontoPercent.IsPositive() && i.SkontoDays > 0
+}
+
+// SkontoDate returns the last day on which the discount may be taken.
+func (i *Invoice) SkontoDate() time.Time {
+	return i.Date.AddDate(0, 0, i.SkontoDays)
+}
+
+// updateSkonto sets SkontoAmount from GrossTotal.
+func (i *Invoice) updateSkonto() {
+	if !i.HasSkonto() {
+		i.SkontoAmount = decimal.Zero
+		return
+	}
+	i.SkontoAmount = skontoAmount(i.GrossTotal, i.SkontoPercent)
+}
+
+// skontoAmount returns gross reduced by percent, rounded to cents.
+func skontoAmount(gross, percent decimal.Decimal) decimal.Decimal {
+	gross = gross.Round(2)
+	return gross.Sub(gross.Mul(percent).Div(hundred).Round(2))
+}
+
+// defaultPaymentTermDays is used when neither the company nor the settings
+// define a payment term.
+const defaultPaymentTermDays = 14
+
+// ComputeDueDate returns the due date for an invoice dated invoiceDate. The
+// payment term of the company takes precedence over the one in the settings;
+// a zero value falls through to the next level. Both arguments may be nil.
+func ComputeDueDate(invoiceDate time.Time, company *Company, settings *Settings) time.Time {
+	days := defaultPaymentTermDays
+	if company != nil && company.DefaultPaymentTermDays > 0 {
+		days = company.DefaultPaymentTermDays
+	} else if settings != nil && settings.DefaultPaymentTermDays > 0 {
+		days = settings.DefaultPaymentTermDays
+	}
+	return invoiceDate.AddDate(0, 0, days)
+}
+
 // TaxAmount collects the amount for each rate
 type TaxAmount struct {
 	Rate   decimal.Decimal
@@ -82,10 +270,35 @@ type InvoicePosition struct {
 	NetPrice   decimal.Decimal `sql:"type:decimal(20,8);"`
 	GrossPrice decimal.Decimal `sql:"type:decimal(20,8);"`
 	LineTotal  decimal.Decimal `sql:"type:decimal(20,8);"`
+	// DiscountPercent is a per-line discount on NetPrice (0 = none).
+	DiscountPercent decimal.Decimal `gorm:"type:text;not null;default:'0'"`
+	// CostPrice is the internal cost per unit (0 = unknown), used for the
+	// margin reports only. It is never written to the PDF or the XML.
+	CostPrice decimal.Decimal `gorm:"type:text;not null;default:'0'"`
 }
 
 func (InvoicePosition) TableName() string { return "invoicepositions" }
 
+// DiscountedNetPrice returns the unit price after the line discount, rounded
+// to decimals places so that PDF and XML show the same price.
+func (p *InvoicePosition) DiscountedNetPrice(decimals int) decimal.Decimal {
+	price := p.NetPrice
+	if p.DiscountPercent.IsPositive() {
+		price = price.Sub(price.Mul(p.DiscountPercent).Div(hundred))
+	}
+	return price.Round(int32(NormalizePriceDecimals(decimals)))
+}
+
+// DiscountedLineTotal returns Quantity times DiscountedNetPrice, rounded to cents.
+func (p *InvoicePosition) DiscountedLineTotal(decimals int) decimal.Decimal {
+	return p.Quantity.Mul(p.DiscountedNetPrice(decimals)).Round(2)
+}
+
+// LineCost returns Quantity times CostPrice, rounded to cents.
+func (p *InvoicePosition) LineCost() decimal.Decimal {
+	return p.Quantity.Mul(p.CostPrice).Round(2)
+}
+
 var hundred = decimal.NewFromInt(100)
 var one = decimal.NewFromInt(1)
 
@@ -93,92 +306,133 @@ var one = decimal.NewFromInt(1)
 // SaveInvoice: robust against duplicates
 func (s *Store) SaveInvoice(inv *Invoice, ownerid uint) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		if inv.OwnerID != ownerid {
-			return fmt.Errorf("save invoice: ownerid mismatch")
-		}
+		return s.saveInvoice(tx, inv, ownerid)
+	})
+}
 
-		// 1) Save/create invoice (always belongs to ownerid)
-		if err := tx.Save(inv).Error; err != nil {
-			return err
+// saveInvoice is SaveInvoice within the transaction tx, for callers that
+// change other records together with the invoice.
+func (s *Store) saveInvoice(tx *gorm.DB, inv *Invoice, ownerid uint) error {
+	if inv.OwnerID != ownerid {
+		return fmt.Errorf("save invoice: ownerid mismatch")
+	}
+	inv.DocumentType = inv.DocumentType.orDefault()
+	inv.ZugferdProfile = inv.ZugferdProfile.orDefault()
+	s.setPriceDecimals(tx, inv, ownerid)
+	s.setRoundingMode(tx, inv, ownerid)
+
+	// Remember the stored version for the change history.
+	var old *Invoice
+	if inv.ID != 0 {
+		var prev Invoice
+		if err := tx.Where("id = ? AND owner_id = ?", inv.ID, ownerid).
+			Preload("InvoicePositions", func(db *gorm.DB) *gorm.DB {
+				return db.Where("owner_id = ?", ownerid).Order("position ASC")
+			}).
+			First(&prev).Error; err == nil {
+			old = &prev
 		}
+	}
 
-		// 2) Safely remove old positions (only for this owner)
-		if err := tx.Where("invoice_id = ? AND owner_id = ?", inv.ID, ownerid).
-			Delete(&InvoicePosition{}).Error; err != nil {
-			return err
+	// Drafts get their counter when they are issued (changeInvoiceStatus).
+	if old == nil && inv.Status != "" && inv.Status != InvoiceStatusDraft {
+		if err := s.allocateInvoiceCounter(tx, inv, ownerid); err != nil {
+			return fmt.Errorf("allocate invoice counter: %w", err)
 		}
+	}
 
-		// 3) Create new positions cleanly
-		if len(inv.InvoicePositions) > 0 {
-			for i := range inv.InvoicePositions {
-				inv.InvoicePositions[i].ID = 0 // important!
-				inv.InvoicePositions[i].InvoiceID = inv.ID
-				inv.InvoicePositions[i].OwnerID = ownerid // enforce
-			}
-			if err := tx.Omit("ID").Create(&inv.InvoicePositions).Error; err != nil {
-				return err
-			}
-		}
+	// 1) Save/create invoice (always belongs to ownerid)
+	if err := tx.Save(inv).Error; err != nil {
+		return err
+	}
 
-		return nil
-	})
-}
+	// 2) Safely remove old positions (only for this owner)
+	if err := tx.Where("invoice_id = ? AND owner_id = ?", inv.ID, ownerid).
+		Delete(&InvoicePosition{}).Error; err != nil {
+		return err
+	}
 
-// GetMaxCounter returns the maximum counter for the given company
-func (s *Store) GetMaxCounter(companyID uint, useLocalCounter bool, ownerID uint) (uint, error) {
-	var max sql.NullInt64
-	q := s.db.Model(&Invoice{})
-	if useLocalCounter {
-		q = q.Where("company_id = ? AND owner_id = ?", companyID, ownerID)
-	} else {
-		q = q.Where("owner_id = ?", ownerID)
+	// 3) Create new positions cleanly
+	if len(inv.InvoicePositions) > 0 {
+		for i := range inv.InvoicePositions {
+			inv.InvoicePositions[i].ID = 0 // important!
+			inv.InvoicePositions[i].InvoiceID = inv.ID
+			inv.InvoicePositions[i].OwnerID = ownerid // enforce
+		}
+		if err := tx.Omit("ID").Create(&inv.InvoicePositions).Error; err != nil {
+			return err
+		}
 	}
-	if err := q.Select("COALESCE(MAX(counter), 0)").Scan(&max).Error; err != nil {
-		return 0, err
+
+	if old == nil {
+		return s.recordInvoiceEvent(tx, inv.ID, ownerid, InvoiceEventCreated, inv.Number)
 	}
-	return uint(max.Int64), nil
+	return s.recordInvoiceEvent(tx, inv.ID, ownerid, InvoiceEventUpdated, invoiceChanges(old, inv))
 }
 
 // UpdateInvoice updates an invoice and fully replaces its positions (hard delete + recreate).
+// Only drafts can be updated, other invoices yield ErrInvoiceNotDraft.
 func (s *Store) UpdateInvoice(inv *Invoice, ownerid uint) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		if inv.ID == 0 {
 			return fmt.Errorf("update invoice: inv.ID is zero")
 		}
 
+		var old Invoice
+		if err := tx.Where("id = ? AND owner_id = ?", inv.ID, ownerid).
+			Preload("InvoicePositions", func(db *gorm.DB) *gorm.DB {
+				return db.Where("owner_id = ?", ownerid).Order("position ASC")
+			}).
+			First(&old).Error; err != nil {
+			return fmt.Errorf("update invoice: %w", err)
+		}
+		if old.Status != InvoiceStatusDraft {
+			return fmt.Errorf("update invoice %d: %w", inv.ID, ErrInvoiceNotDraft)
+		}
+
 		data := map[string]any{
-			"number":           inv.Number,
-			"date":             inv.Date,
-			"occurrence_date":  inv.OccurrenceDate,
-			"due_date":         inv.DueDate,
-			"tax_type":         inv.TaxType,
-			"currency":         inv.Currency,
-			"tax_number":       inv.TaxNumber,
-			"order_number":     inv.OrderNumber,
-			"buyer_reference":  inv.BuyerReference,
-			"supplier_number":  inv.SupplierNumber,
-			"counter":          inv.Counter,
-			"contact_invoice":  inv.ContactInvoice,
-			"opening":          inv.Opening,
-			"footer":           inv.Footer,
-			"exemption_reason": inv.ExemptionReason,
-			"template_id":      inv.TemplateID,
+			"number":                    inv.Number,
+			"date":                      inv.Date,
+			"occurrence_date":           inv.OccurrenceDate,
+			"due_date":                  inv.DueDate,
+			"tax_type":                  inv.TaxType,
+			"currency":                  inv.Currency,
+			"tax_number":                inv.TaxNumber,
+			"order_number":              inv.OrderNumber,
+			"buyer_reference":           inv.BuyerReference,
+			"supplier_number":           inv.SupplierNumber,
+			"counter":                   inv.Counter,
+			"contact_invoice":           inv.ContactInvoice,
+			"opening":                   inv.Opening,
+			"footer":                    inv.Footer,
+			"exemption_reason":          inv.ExemptionReason,
+			"template_id":               inv.TemplateID,
+			"document_type":             inv.DocumentType.orDefault(),
+			"zugferd_profile":           inv.ZugferdProfile.orDefault(),
+			"referenced_invoice_number": inv.ReferencedInvoiceNumber,
+			"skonto_percent":            inv.SkontoPercent,
+			"skonto_days":               inv.SkontoDays,
+			"exchange_rate":             inv.ExchangeRate,
+			"price_decimals":            s.loadPriceDecimals(tx, ownerid),
+			"rounding_mode":             s.loadRoundingMode(tx, ownerid),
 		}
+		inv.PriceDecimals = data["price_decimals"].(int)
+		inv.RoundingMode = data["rounding_mode"].(RoundingMode)
 
 		// In Drafts sollen Totals nicht persistiert werden:
-		if inv.Status == InvoiceStatusDraft {
-			data["net_total"] = decimal.Zero
-			data["gross_total"] = decimal.Zero
-		} else {
-			data["net_total"] = inv.NetTotal
-			data["gross_total"] = inv.GrossTotal
+		data["net_total"] = decimal.Zero
+		data["gross_total"] = decimal.Zero
+
+		// 1) Update invoice row (mit Owner- und Status-Gate, falls die
+		// Rechnung inzwischen gestellt wurde)
+		res := tx.Model(&Invoice{}).
+			Where("id = ? AND owner_id = ? AND status = ?", inv.ID, ownerid, InvoiceStatusDraft).
+			Updates(data)
+		if res.Error != nil {
+			return fmt.Errorf("update invoice: %w", res.Error)
 		}
-
-		// 1) Update invoice row (mit Owner-Gate)
-		if err := tx.Model(&Invoice{}).
-			Where("id = ? AND owner_id = ?", inv.ID, ownerid).
-			Updates(data).Error; err != nil {
-			return fmt.Errorf("update invoice: %w", err)
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("update invoice %d: %w", inv.ID, ErrInvoiceNotDraft)
 		}
 
 		// 2) Delete old positions (Owner-Gate)
@@ -199,31 +453,105 @@ func (s *Store) UpdateInvoice(inv *Invoice, ownerid uint) error {
 			}
 		}
 
+		return s.recordInvoiceEvent(tx, inv.ID, ownerid, InvoiceEventUpdated, invoiceChanges(&old, inv))
+	})
+}
+
+// DeleteInvoice moves an invoice to the trash (soft delete). Positions and
+// attachments are kept so that RestoreInvoice can bring it back; they are
+// removed when the trash is purged. Time entries billed with the invoice
+// become unbilled. Deleting an invoice of another owner
+// matches no row and returns ErrInvoiceNotFound.
+func (s *Store) DeleteInvoice(inv *Invoice, ownerID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND owner_id = ?", inv.ID, ownerID).Delete(&Invoice{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("delete invoice %d: %w", inv.ID, ErrInvoiceNotFound)
+		}
+		if err := unbillTimeEntries(tx, ownerID, []uint{inv.ID}); err != nil {
+			return err
+		}
+		return s.recordInvoiceEvent(tx, inv.ID, ownerID, InvoiceEventDeleted, "")
+	})
+}
+
+// ErrInvoiceNotDraft is returned when an invoice that has been issued is to
+// be deleted.
+var ErrInvoiceNotDraft = errors.New("invoice is not a draft")
+
+// DeleteDraftInvoicesForCompany moves all draft invoices of the company to
+// the trash, like DeleteInvoice, and returns how many were deleted. Their
+// positions are removed when the trash is purged. Invoices of any other
+// status are never touched: if one of the selected drafts is issued
+// concurrently, nothing is deleted and the error wraps ErrInvoiceNotDraft.
+func (s *Store) DeleteDraftInvoicesForCompany(ownerID, companyID uint) (int, error) {
+	var ids []uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Invoice{}).
+			Where("owner_id = ? AND company_id = ? AND status = ?", ownerID, companyID, InvoiceStatusDraft).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		res := tx.Where("id IN ? AND owner_id = ? AND status = ?", ids, ownerID, InvoiceStatusDraft).Delete(&Invoice{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != int64(len(ids)) {
+			return fmt.Errorf("%d of %d invoices changed meanwhile: %w", int64(len(ids))-res.RowsAffected, len(ids), ErrInvoiceNotDraft)
+		}
+		if err := unbillTimeEntries(tx, ownerID, ids); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := s.recordInvoiceEvent(tx, id, ownerID, InvoiceEventDeleted, ""); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
+	if err != nil {
+		return 0, fmt.Errorf("delete draft invoices of company %d: %w", companyID, err)
+	}
+	return len(ids), nil
 }
 
-// DeleteInvoice removes an invoice and all referenced invoice positions from
-// the database.
-func (s *Store) DeleteInvoice(inv *Invoice, ownerid any) error {
-	// Ensure we only delete invoices owned by the given owner
-	result := s.db.Where("owner_id = ?", ownerid).Select("InvoicePositions").Delete(inv)
-	return result.Error
+// ErrInvoiceNotFound is returned by LoadInvoice and LoadInvoiceWithTemplate
+// when the owner has no invoice with the given id.
+var ErrInvoiceNotFound = errors.New("invoice not found")
+
+// loadInvoiceError wraps err from loading invoice id, mapping a missing
+// record to ErrInvoiceNotFound.
+func loadInvoiceError(id any, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("load invoice %v: %w", id, ErrInvoiceNotFound)
+	}
+	return fmt.Errorf("load invoice %v: %w", id, err)
 }
 
-// LoadInvoice loads an invoice
+// LoadInvoice loads an invoice. It returns ErrInvoiceNotFound if the invoice
+// does not exist for the owner.
 func (s *Store) LoadInvoice(id any, ownerid uint) (*Invoice, error) {
 	var inv Invoice
 	err := s.db.Where("owner_id = ?", ownerid).
 		Preload("InvoicePositions", "owner_id = ?", ownerid).
 		First(&inv, id).Error
 	if err != nil {
-		return nil, fmt.Errorf("load invoice %v: %w", id, err)
+		return nil, loadInvoiceError(id, err)
 	}
+	s.setPriceDecimals(s.db, &inv, ownerid)
+	s.setRoundingMode(s.db, &inv, ownerid)
 
 	// Always recalculate in drafts
 	if inv.Status == InvoiceStatusDraft {
 		inv.RecomputeTotals()
+	} else {
+		inv.updateSkonto()
 	}
 	return &inv, nil
 }
@@ -236,20 +564,87 @@ func (s *Store) LoadInvoiceWithTemplate(id any, ownerid uint) (*Invoice, error)
 		Preload("Template.Regions", "owner_id = ?", ownerid)
 
 	if err := q.First(&inv, id).Error; err != nil {
-		return nil, fmt.Errorf("load invoice %v: %w", id, err)
+		return nil, loadInvoiceError(id, err)
 	}
+	s.setPriceDecimals(s.db, &inv, ownerid)
+	s.setRoundingMode(s.db, &inv, ownerid)
 	if inv.Status == InvoiceStatusDraft {
 		inv.RecomputeTotals()
+	} else {
+		inv.updateSkonto()
 	}
 	return &inv, nil
 }
 
-// RecomputeTotals sets NetTotal, GrossTotal and TaxAmounts based on the positions.
+// setPriceDecimals sets the PriceDecimals of a draft from the owner's
+// settings. Other invoices keep the stored value.
+func (s *Store) setPriceDecimals(db *gorm.DB, inv *Invoice, ownerID uint) {
+	if inv.Status == InvoiceStatusDraft || inv.Status == "" {
+		inv.PriceDecimals = s.loadPriceDecimals(db, ownerID)
+	} else {
+		inv.PriceDecimals = NormalizePriceDecimals(inv.PriceDecimals)
+	}
+}
+
+// setRoundingMode sets the RoundingMode of a draft from the owner's
+// settings. Other invoices keep the stored value.
+func (s *Store) setRoundingMode(db *gorm.DB, inv *Invoice, ownerID uint) {
+	if inv.Status == InvoiceStatusDraft || inv.Status == "" {
+		inv.RoundingMode = s.loadRoundingMode(db, ownerID)
+	} else if inv.RoundingMode != RoundingModeLine {
+		inv.RoundingMode = RoundingModeTotal
+	}
+}
+
+// RoundingMode selects how the tax of an invoice is rounded.
+type RoundingMode string
+
+const (
+	// RoundingModeTotal computes the tax per rate from the summed line totals
+	// and rounds once (EN 16931 default). The empty value means total.
+	RoundingModeTotal RoundingMode = "total"
+	// RoundingModeLine rounds the tax of every position to cents before
+	// summing it per rate.
+	RoundingModeLine RoundingMode = "line"
+)
+
+// lineTax returns the tax of a line amount at rate percent, rounded to cents.
+func lineTax(amount, rate decimal.Decimal) decimal.Decimal {
+	return amount.Mul(rate).Div(hundred).Round(2)
+}
+
+// RecomputeTotals sets NetTotal, GrossTotal and TaxAmounts based on the
+// positions. The LineTotal of positions with a discount is recomputed first.
+// With RoundingModeLine each position's tax is rounded before summing.
 func (i *Invoice) RecomputeTotals() {
-	i.TaxAmounts = i.TaxAmounts[:0]
+	for idx := range i.InvoicePositions {
+		p := &i.InvoicePositions[idx]
+		// discounted lines: the line total follows from the discounted price
+		if p.DiscountPercent.IsPositive() {
+			p.LineTotal = p.DiscountedLineTotal(i.PriceDecimals)
+		}
+	}
+	i.NetTotal, i.GrossTotal, i.TaxAmounts = i.positionTotals()
+	i.updateSkonto()
+}
+
+// RecomputeTaxAmounts sets TaxAmounts based on the positions. Drafts get all
+// totals recomputed (see RecomputeTotals); issued, paid and voided invoices
+// keep their stored NetTotal, GrossTotal and line totals.
+func (i *Invoice) RecomputeTaxAmounts() {
+	if i.Status == InvoiceStatusDraft {
+		i.RecomputeTotals()
+		return
+	}
+	_, _, i.TaxAmounts = i.positionTotals()
+}
+
+// positionTotals sums the line totals of the positions and their tax per
+// rate, ordered by rate.
+func (i *Invoice) positionTotals() (netTotal, grossTotal decimal.Decimal, taxAmounts []TaxAmount) {
 	totals := map[string]decimal.Decimal{}
-	netTotal := decimal.Zero
-	grossTotal := decimal.Zero
+	netTotal = decimal.Zero
+	grossTotal = decimal.Zero
 
 	for _, p := range i.InvoicePositions {
 		if _, ok := totals[p.TaxRate.String()]; !ok {
@@ -257,9 +652,12 @@ func (i *Invoice) RecomputeTotals() {
 		}
 		taxrate := p.TaxRate.Div(hundred)
 		netTotal = netTotal.Add(p.LineTotal)
-		grossTotal = grossTotal.Add(p.LineTotal.Mul(taxrate.Add(one)))
 
 		taxamount := p.LineTotal.Mul(taxrate)
+		if i.RoundingMode == RoundingModeLine {
+			taxamount = lineTax(p.LineTotal, p.TaxRate)
+		}
+		grossTotal = grossTotal.Add(p.LineTotal).Add(taxamount)
 		totals[p.TaxRate.String()] = totals[p.TaxRate.String()].Add(taxamount)
 	}
 
@@ -272,14 +670,14 @@ func (i *Invoice) RecomputeTotals() {
 		dj, _ := decimal.NewFromString(keys[j1])
 		return di.LessThan(dj)
 	})
+	taxAmounts = i.TaxAmounts[:0]
 	for _, key := range keys {
-		i.TaxAmounts = append(i.TaxAmounts, TaxAmount{
+		taxAmounts = append(taxAmounts, TaxAmount{
 			Rate:   decimal.RequireFromString(key),
 			Amount: totals[key],
 		})
 	}
-	i.NetTotal = netTotal
-	i.GrossTotal = grossTotal
+	return netTotal, grossTotal, taxAmounts
 }
 
 // countryID returns a two-letter alpha code for the given country
@@ -307,12 +705,14 @@ type InvoiceProblem struct {
 	Message string
 }
 
+// LoadAndVerifyInvoice loads the invoice, validates the e-invoice that would
+// be generated for it and stores the result (see InvoiceValidation).
 func (s *Store) LoadAndVerifyInvoice(id any, ownerID uint) (*Invoice, []einvoice.SemanticError, error) {
 	inv, err := s.LoadInvoice(id, ownerID)
 	if err != nil {
 		return nil, nil, err
 	}
-	settings, err := s.LoadSettings(ownerID)
+	settings, err := s.LoadSettingsForCurrency(ownerID, inv.Currency)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -320,27 +720,76 @@ func (s *Store) LoadAndVerifyInvoice(id any, ownerID uint) (*Invoice, []einvoice
 	if err != nil {
 		return nil, nil, err
 	}
-	zi := createZUGFerdXML(inv, settings, company)
+	var zi einvoice.Invoice
+	if company.UsesXRechnung() {
+		zi = createXRechnungXML(inv, settings, company)
+	} else {
+		zi = createZUGFerdXML(inv, settings, company)
+	}
 
+	violations := []einvoice.SemanticError{}
 	err = zi.Validate()
 	if err != nil {
 		var valErr *einvoice.ValidationError
 		if errors.As(err, &valErr) {
-			return inv, valErr.Violations(), nil
+			violations = valErr.Violations()
 		}
 	}
+	if inv.RoundingMode == RoundingModeLine {
+		violations = dropLineRoundingDeviations(&zi, violations)
+	}
+	if company.UsesXRechnung() {
+		violations = append(violations, xrechnungViolations(&zi)...)
+	}
+	violations = buyerVATIDViolations(inv, company, violations)
+	if err := s.saveInvoiceValidation(inv, violations); err != nil {
+		return nil, nil, fmt.Errorf("save validation result: %w", err)
+	}
+
+	return inv, violations, nil
+}
 
-	return inv, []einvoice.SemanticError{}, nil
+// buyerVATIDViolations reports a missing VAT ID of the customer on reverse
+// charge (AE) and intra-community (K) invoices, where the buyer's VAT ID must
+// be given. einvoice checks this as well (BR-AE-2, BR-IC-2), but its message
+// does not say where the VAT ID is entered, so its entry in violations is
+// replaced; the problem is added if einvoice did not report it.
+func buyerVATIDViolations(inv *Invoice, company *Company, violations []einvoice.SemanticError) []einvoice.SemanticError {
+	if strings.TrimSpace(company.VATID) != "" {
+		return violations
+	}
+	var own einvoice.SemanticError
+	switch inv.TaxType {
+	case "AE":
+		own = einvoice.SemanticError{Rule: "BR-AE-2", InvFields: []string{"BT-48"},
+			Text: "Bei Steuerschuldnerschaft des Leistungsempfängers muss beim Kunden eine USt-IdNr. hinterlegt sein."}
+	case "K":
+		own = einvoice.SemanticError{Rule: "BR-IC-2", InvFields: []string{"BT-48"},
+			Text: "Bei einer innergemeinschaftlichen Lieferung muss beim Kunden eine USt-IdNr. hinterlegt sein."}
+	default:
+		return violations
+	}
+	out := violations[:0]
+	for _, v := range violations {
+		if v.Rule == own.Rule && slices.Contains(v.InvFields, "BT-48") {
+			continue
+		}
+		out = append(out, v)
+	}
+	return append(out, own)
 }
 
+// createZUGFerdXML builds the CII invoice. The payment means (BG-16/BG-17)
+// name the bank account in settings, so settings should be loaded with
+// LoadSettingsForCurrency for the invoice currency.
 func createZUGFerdXML(inv *Invoice, settings *Settings, company *Company) einvoice.Invoice {
 	// combine opening and footer, ignore empty lines
 	text := strings.TrimSpace(strings.Join(
-		filterEmpty(inv.Opening, inv.Footer), "·"))
+		filterEmpty(renderInvoiceText(inv.Opening, inv, company), renderInvoiceText(inv.Footer, inv, company)), "·"))
 	zi := einvoice.Invoice{
 		InvoiceNumber:       inv.Number,
-		InvoiceTypeCode:     380,
-		Profile:             einvoice.CProfileEN16931,
+		InvoiceTypeCode:     inv.DocumentType.TypeCode(),
+		Profile:             inv.ZugferdProfile.einvoiceProfile(),
 		InvoiceDate:         inv.Date,
 		OccurrenceDateTime:  inv.OccurrenceDate,
 		InvoiceCurrencyCode: inv.Currency,
@@ -360,8 +809,9 @@ func createZUGFerdXML(inv *Invoice, settings *Settings, company *Company) einvoi
 				CountryID:    countryID(settings.CountryCode),
 			},
 			DefinedTradeContact: []einvoice.DefinedTradeContact{{
-				PersonName: settings.InvoiceContact,
-				EMail:      settings.InvoiceEMail,
+				PersonName:  settings.InvoiceContact,
+				EMail:       settings.InvoiceEMail,
+				PhoneNumber: settings.InvoicePhone,
 			}},
 		},
 		Buyer: einvoice.Party{
@@ -387,10 +837,21 @@ func createZUGFerdXML(inv *Invoice, settings *Settings, company *Company) einvoi
 			},
 		},
 		SpecifiedTradePaymentTerms: []einvoice.SpecifiedTradePaymentTerms{{
-			DueDate: inv.DueDate,
+			Description: skontoTerms(inv),
+			DueDate:     inv.DueDate,
 		}},
+		PaymentReference: invoicePaymentReference(inv, settings, company),
+	}
+	if zi.PaymentReference != "" {
+		// The #SKONTO# line has to stay first, the reference follows as text.
+		zi.SpecifiedTradePaymentTerms[0].Description += "Verwendungszweck: " + zi.PaymentReference
 	}
 	zi.BuyerOrderReferencedDocument = inv.OrderNumber
+	if inv.ReferencedInvoiceNumber != "" {
+		zi.InvoiceReferencedDocument = append(zi.InvoiceReferencedDocument, einvoice.ReferencedDocument{
+			ID: inv.ReferencedInvoiceNumber,
+		})
+	}
 	if inv.SupplierNumber != "" {
 		zi.Seller.ID = append(zi.Seller.ID, inv.SupplierNumber)
 	}
@@ -408,21 +869,48 @@ func createZUGFerdXML(inv *Invoice, settings *Settings, company *Company) einvoi
 		}
 	}
 
+	priceDecimals := NormalizePriceDecimals(inv.PriceDecimals)
 	for _, pos := range inv.InvoicePositions {
 		li := einvoice.InvoiceLine{
 			LineID:                   fmt.Sprintf("%d", pos.Position),
 			ItemName:                 pos.Text,
 			BilledQuantity:           pos.Quantity,
 			BilledQuantityUnit:       pos.UnitCode,
-			NetPrice:                 pos.NetPrice,
+			NetPrice:                 pos.DiscountedNetPrice(priceDecimals),
 			TaxRateApplicablePercent: pos.TaxRate,
 			Total:                    pos.LineTotal,
 			TaxTypeCode:              "VAT",
 			TaxCategoryCode:          inv.TaxType,
 		}
+		// Line discount: gross price (BT-148) minus price discount (BT-147)
+		// gives the net price (BT-146).
+		if pos.DiscountPercent.IsPositive() {
+			li.GrossPrice = pos.NetPrice.Round(int32(priceDecimals))
+			li.AppliedTradeAllowanceCharge = []einvoice.AllowanceCharge{{
+				ChargeIndicator:    false,
+				CalculationPercent: pos.DiscountPercent,
+				BasisAmount:        li.GrossPrice,
+				ActualAmount:       li.GrossPrice.Sub(li.NetPrice),
+				Reason:             "Rabatt",
+			}}
+		}
 		zi.InvoiceLines = append(zi.InvoiceLines, li)
 	}
-	zi.UpdateApplicableTradeTax(map[string]string{"AE": inv.ExemptionReason, "K": inv.ExemptionReason, "E": inv.ExemptionReason})
+	// Reverse charge and intra-community supplies need an exemption reason
+	// (BR-AE-10, BR-IC-10) and the statutory sentence as a visible note.
+	exemption := map[string]string{"AE": inv.ExemptionReason, "K": inv.ExemptionReason, "E": inv.ExemptionReason}
+	if note := settings.TaxNote(inv.TaxType); note != "" {
+		if exemption[inv.TaxType] == "" {
+			exemption[inv.TaxType] = note
+		}
+		if !strings.Contains(text, note) {
+			zi.Notes = append(zi.Notes, einvoice.Note{Text: note, SubjectCode: taxNoteSubjectCode})
+		}
+	}
+	zi.UpdateApplicableTradeTax(exemption)
+	if inv.RoundingMode == RoundingModeLine {
+		applyLineRounding(&zi)
+	}
 	zi.UpdateTotals()
 	// BR-53
 	if !zi.TaxTotalVAT.IsZero() {
@@ -432,10 +920,56 @@ func createZUGFerdXML(inv *Invoice, settings *Settings, company *Company) einvoi
 	return zi
 }
 
+// applyLineRounding replaces the tax per rate computed by einvoice with the
+// sum of the rounded taxes of the lines, so the XML matches RecomputeTotals
+// in RoundingModeLine.
+func applyLineRounding(zi *einvoice.Invoice) {
+	for idx := range zi.TradeTaxes {
+		tt := &zi.TradeTaxes[idx]
+		sum := decimal.Zero
+		for _, li := range zi.InvoiceLines {
+			if li.TaxCategoryCode == tt.CategoryCode && li.TaxRateApplicablePercent.Equal(tt.Percent) {
+				sum = sum.Add(lineTax(li.Total, li.TaxRateApplicablePercent))
+			}
+		}
+		tt.CalculatedAmount = sum
+	}
+}
+
+// dropLineRoundingDeviations removes BR-CO-17 violations when every tax
+// amount is within one cent of basis × rate. einvoice checks BR-CO-17
+// exactly, while the EN 16931 schematron accepts this deviation, which line
+// rounding can produce.
+func dropLineRoundingDeviations(zi *einvoice.Invoice, violations []einvoice.SemanticError) []einvoice.SemanticError {
+	cent := decimal.RequireFromString("0.01")
+	for _, tt := range zi.TradeTaxes {
+		if tt.CalculatedAmount.Sub(lineTax(tt.BasisAmount, tt.Percent)).Abs().GreaterThan(cent) {
+			return violations
+		}
+	}
+	out := violations[:0]
+	for _, v := range violations {
+		if v.Rule != "BR-CO-17" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// skontoTerms returns the structured payment terms line for the discount
+// ("#SKONTO#TAGE=14#PROZENT=2.00#", terminated by a line feed) as expected by
+// XRechnung and ZUGFeRD, or an empty string when there is no discount.
+func skontoTerms(inv *Invoice) string {
+	if !inv.HasSkonto() {
+		return ""
+	}
+	return fmt.Sprintf("#SKONTO#TAGE=%d#PROZENT=%s#\n", inv.SkontoDays, inv.SkontoPercent.StringFixed(2))
+}
+
 // WriteZUGFeRDXML writes the ZUGFeRD XML file to the hard drive. The file name
 // is the invoice id plus the extension ".xml".
 func (s *Store) WriteZUGFeRDXML(inv *Invoice, ownerID any, path string) error {
-	settings, err := s.LoadSettings(ownerID)
+	settings, err := s.LoadSettingsForCurrency(ownerID, inv.Currency)
 	if err != nil {
 		return err
 	}
@@ -444,18 +978,66 @@ func (s *Store) WriteZUGFeRDXML(inv *Invoice, ownerID any, path string) error {
 		return err
 	}
 
-	var sb strings.Builder
-
 	zi := createZUGFerdXML(inv, settings, company)
-	err = zi.Write(&sb)
+	docs, err := s.attachmentDocuments(inv.ID, settings.OwnerID)
+	if err != nil {
+		return err
+	}
+	zi.AdditionalReferencedDocument = append(zi.AdditionalReferencedDocument, docs...)
+	cii, err := writeCII(&zi, inv.PriceDecimals)
 	if err != nil {
 		return err
 	}
+	return os.WriteFile(path, []byte(insertPaymentReference(cii, zi.PaymentReference)), 0644)
+}
 
-	return os.WriteFile(path, []byte(sb.String()), 0644)
+// writeCII serializes zi as CII with the unit prices (BT-148, BT-146) in
+// decimals places. einvoice writes every amount with two decimals, so the
+// price elements of each line item are set again from zi.InvoiceLines,
+// matched by line ID, before the document is written.
+func writeCII(zi *einvoice.Invoice, decimals int) (string, error) {
+	var sb strings.Builder
+	if err := zi.Write(&sb); err != nil {
+		return "", err
+	}
+	decimals = NormalizePriceDecimals(decimals)
+	if decimals == MinPriceDecimals {
+		return sb.String(), nil
+	}
 
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(sb.String()); err != nil {
+		return "", fmt.Errorf("read CII: %w", err)
+	}
+	lines := make(map[string]einvoice.InvoiceLine, len(zi.InvoiceLines))
+	for _, li := range zi.InvoiceLines {
+		lines[li.LineID] = li
+	}
+	places := int32(decimals)
+	for _, item := range doc.FindElements("//ram:IncludedSupplyChainTradeLineItem") {
+		id := item.FindElement("ram:AssociatedDocumentLineDocument/ram:LineID")
+		if id == nil {
+			continue
+		}
+		li, ok := lines[id.Text()]
+		if !ok {
+			continue
+		}
+		if e := item.FindElement("ram:SpecifiedLineTradeAgreement/ram:GrossPriceProductTradePrice/ram:ChargeAmount"); e != nil {
+			e.SetText(li.GrossPrice.StringFixed(places))
+		}
+		if e := item.FindElement("ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:ChargeAmount"); e != nil {
+			e.SetText(li.NetPrice.StringFixed(places))
+		}
+	}
+	doc.Indent(2)
+	return doc.WriteToString()
 }
 
+// ErrInvoiceFinal is returned when the status of a paid or voided invoice is
+// to be changed.
+var ErrInvoiceFinal = errors.New("invoice is already paid or voided")
+
 // --- Status Transitions ------------------------------------------------------
 //
 // Allowed transitions:
@@ -463,12 +1045,17 @@ func (s *Store) WriteZUGFeRDXML(inv *Invoice, ownerID any, path string) error {
 //   issued -> paid   | voided
 //   paid   -> (final, no further changes)
 //   voided -> (final, no further changes)
+//
+// Voiding an invoice with recorded payments requires force. Changing a paid
+// or voided invoice yields ErrInvoiceFinal. Every transition is sent to the
+// owner's webhooks (see dispatchInvoiceWebhooks).
 
 func (s *Store) changeInvoiceStatus(
 	id uint, ownerID uint,
-	to InvoiceStatus, t time.Time,
+	to InvoiceStatus, t time.Time, force bool,
 ) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	changed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		var inv Invoice
 
 		// Lock the row (Postgres: FOR UPDATE; SQLite: no-op)
@@ -482,7 +1069,7 @@ func (s *Store) changeInvoiceStatus(
 
 		// Guard: do not change final states
 		if from.IsFinal() {
-			return nil
+			return fmt.Errorf("invoice %d is %s: %w", id, from, ErrInvoiceFinal)
 		}
 
 		// Allowed transitions map
@@ -508,9 +1095,28 @@ func (s *Store) changeInvoiceStatus(
 				First(&full).Error; err != nil {
 				return err
 			}
+			full.RoundingMode = s.loadRoundingMode(tx, ownerID)
+			full.PriceDecimals = s.loadPriceDecimals(tx, ownerID)
 			full.RecomputeTotals()
+			if !full.CounterAllocated {
+				if err := s.allocateInvoiceCounter(tx, &full, ownerID); err != nil {
+					return fmt.Errorf("allocate invoice counter: %w", err)
+				}
+				updates["counter"] = full.Counter
+				updates["number"] = full.Number
+				updates["counter_allocated"] = true
+			}
+			updates["price_decimals"] = full.PriceDecimals
+			updates["rounding_mode"] = full.RoundingMode
 			updates["net_total"] = full.NetTotal
 			updates["gross_total"] = full.GrossTotal
+			if full.PaymentReference == "" {
+				ref, err := issuedPaymentReference(tx, &full)
+				if err != nil {
+					return err
+				}
+				updates["payment_reference"] = ref
+			}
 		case InvoiceStatusPaid:
 			updates["paid_at"] = t
 		case InvoiceStatusVoided:
@@ -518,6 +1124,15 @@ func (s *Store) changeInvoiceStatus(
 			if from == InvoiceStatusPaid {
 				return fmt.Errorf("paid invoices cannot be voided")
 			}
+			if !force {
+				n, err := countPayments(tx, id, ownerID)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					return ErrInvoiceHasPayments
+				}
+			}
 			updates["voided_at"] = t
 		}
 
@@ -528,14 +1143,46 @@ func (s *Store) changeInvoiceStatus(
 			return err
 		}
 
-		return nil
+		changed = true
+		return s.recordInvoiceEvent(tx, id, ownerID, InvoiceEventStatus, statusEventDetail(from, to))
 	})
+	if err != nil || !changed {
+		return err
+	}
+	s.dispatchInvoiceWebhooks(id, ownerID, "invoice."+string(to))
+	return nil
+}
+
+// issuedPaymentReference computes the payment reference stored when inv is
+// issued. A template that cannot produce a valid creditor reference for this
+// invoice is an error, the invoice must not go out with a wrong checksum.
+func issuedPaymentReference(tx *gorm.DB, inv *Invoice) (string, error) {
+	var settings Settings
+	err := tx.Where("owner_id = ?", inv.OwnerID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(settings.PaymentReferenceTemplate) == "" {
+		return "", nil
+	}
+	var company Company
+	if err := tx.Where("id = ? AND owner_id = ?", inv.CompanyID, inv.OwnerID).First(&company).Error; err != nil {
+		return "", err
+	}
+	ref, err := FormatPaymentReference(settings.PaymentReferenceTemplate, inv.Number, company.CustomerNumber)
+	if err != nil {
+		return "", fmt.Errorf("payment reference for invoice %s: %w", inv.Number, err)
+	}
+	return ref, nil
 }
 
 // In your model (e.g. in invoice.go):
 
 // MarkInvoiceDraft rolls back an issued invoice to draft.
-// Business rules: clears IssuedAt (and optionally Number/Counter).
+// Business rules: clears IssuedAt; Number and Counter stay allocated.
 func (s *Store) MarkInvoiceDraft(id uint, ownerID uint, t time.Time) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		var inv Invoice
@@ -558,75 +1205,189 @@ func (s *Store) MarkInvoiceDraft(id uint, ownerID uint, t time.Time) error {
 		}
 
 		updates := map[string]any{
-			"status":    InvoiceStatusDraft,
-			"issued_at": nil,
+			"status":            InvoiceStatusDraft,
+			"issued_at":         nil,
+			"payment_reference": "",
 		}
 
-		// Optional (if you only assign numbers at 'issued' and want to delete them when reverting):
-		// updates["number"]  = ""   // caution: only if number has not yet been sent to customer
-		// updates["counter"] = 0    // same
-
-		return tx.Model(&Invoice{}).
+		if err := tx.Model(&Invoice{}).
 			Where("id = ? AND owner_id = ?", id, ownerID).
-			Updates(updates).Error
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		return s.recordInvoiceEvent(tx, id, ownerID, InvoiceEventStatus, statusEventDetail(inv.Status, InvoiceStatusDraft))
 	})
 }
 
 // Convenience: draft -> issued
 func (s *Store) MarkInvoiceIssued(id uint, ownerID uint, t time.Time) error {
-	return s.changeInvoiceStatus(id, ownerID, InvoiceStatusIssued, t)
+	return s.changeInvoiceStatus(id, ownerID, InvoiceStatusIssued, t, false)
 }
 
 // Convenience: (draft|issued) -> paid
 func (s *Store) MarkInvoicePaid(id uint, ownerID uint, t time.Time) error {
-	return s.changeInvoiceStatus(id, ownerID, InvoiceStatusPaid, t)
+	return s.changeInvoiceStatus(id, ownerID, InvoiceStatusPaid, t, false)
+}
+
+// Convenience: (draft|issued) -> voided. Invoices with recorded payments are
+// only voided when force is set.
+func (s *Store) VoidInvoice(id uint, ownerID uint, t time.Time, force bool) error {
+	return s.changeInvoiceStatus(id, ownerID, InvoiceStatusVoided, t, force)
+}
+
+// MarkInvoiceSent records that the invoice was emailed to the customer.
+// Drafts cannot be sent.
+func (s *Store) MarkInvoiceSent(id uint, ownerID uint, t time.Time) error {
+	res := s.db.Model(&Invoice{}).
+		Where("id = ? AND owner_id = ? AND status <> ?", id, ownerID, InvoiceStatusDraft).
+		Update("sent_at", t)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("invoice %d not found or still a draft", id)
+	}
+	return nil
 }
 
-// Convenience: (draft|issued) -> voided
-func (s *Store) VoidInvoice(id uint, ownerID uint, t time.Time) error {
-	return s.changeInvoiceStatus(id, ownerID, InvoiceStatusVoided, t)
+// InvoiceFilters narrows down an invoice listing. Zero values mean "no
+// filter". Search matches the invoice number or order number
+// case-insensitively; Field selects the date column From/To apply to ("due"
+// for the due date, anything else for the invoice date), To is inclusive.
+// UpdatedSince restricts the result to invoices changed at or after that time.
+type InvoiceFilters struct {
+	Statuses     []InvoiceStatus
+	CompanyID    *uint
+	Search       string
+	Field        string
+	From, To     *time.Time
+	UpdatedSince *time.Time
+	Order        string
 }
 
-func (s *Store) FindInvoices(ownerID uint, statuses []InvoiceStatus, companyID *uint, field string, from, to *time.Time, limit, offset int, order string) (rows []Invoice, total int64, err error) {
-	q := s.db.Model(&Invoice{}).Preload("Company").Where("owner_id = ?", ownerID)
-	if companyID != nil {
-		q = q.Where("company_id = ?", *companyID)
+// invoiceQuery builds the filtered (but not ordered or paginated) query.
+func (s *Store) invoiceQuery(ownerID uint, f InvoiceFilters) *gorm.DB {
+	q := s.db.Model(&Invoice{}).Where("owner_id = ?", ownerID)
+	if f.CompanyID != nil {
+		q = q.Where("company_id = ?", *f.CompanyID)
 	}
-	if len(statuses) > 0 {
-		q = q.Where("status IN ?", statuses)
+	if search := strings.TrimSpace(f.Search); search != "" {
+		like := "%" + likeEscape(search) + "%"
+		switch s.db.Dialector.Name() {
+		case "postgres":
+			q = q.Where("(number ILIKE ? ESCAPE '\\' OR order_number ILIKE ? ESCAPE '\\')", like, like)
+		default: // sqlite, mysql/mariadb
+			q = q.Where("(LOWER(number) LIKE LOWER(?) ESCAPE '\\' OR LOWER(order_number) LIKE LOWER(?) ESCAPE '\\')", like, like)
+		}
 	}
-	if from != nil {
-		if field == "due" {
-			q = q.Where("due_date >= ?", from)
+	if len(f.Statuses) > 0 {
+		q = q.Where("status IN ?", f.Statuses)
+	}
+	if f.From != nil {
+		if f.Field == "due" {
+			q = q.Where("due_date >= ?", f.From)
 		} else {
-			q = q.Where("date >= ?", from)
+			q = q.Where("date >= ?", f.From)
 		}
 	}
-	if to != nil {
-		next := to.Add(24 * time.Hour)
-		if field == "due" {
+	if f.To != nil {
+		next := f.To.Add(24 * time.Hour)
+		if f.Field == "due" {
 			q = q.Where("due_date < ?", next)
 		} else {
 			q = q.Where("date < ?", next)
 		}
 	}
+	if f.UpdatedSince != nil {
+		q = q.Where("updated_at >= ?", f.UpdatedSince)
+	}
+	return q
+}
+
+// FindInvoices returns one page of the owner's invoices matching the filters
+// and the total number of matches. search, if not empty, matches the invoice
+// number or order number case-insensitively. updatedSince, if set, restricts
+// the result to invoices changed at or after that time.
+func (s *Store) FindInvoices(ownerID uint, statuses []InvoiceStatus, companyID *uint, search string, field string, from, to, updatedSince *time.Time, limit, offset int, order string) (rows []Invoice, total int64, err error) {
+	q := s.invoiceQuery(ownerID, InvoiceFilters{
+		Statuses:     statuses,
+		CompanyID:    companyID,
+		Search:       search,
+		Field:        field,
+		From:         from,
+		To:           to,
+		UpdatedSince: updatedSince,
+	})
 	if err = q.Count(&total).Error; err != nil {
 		return
 	}
-	err = q.Order(order).Limit(limit).Offset(offset).Find(&rows).Error
+	err = q.Preload("Company").Order(order).Limit(limit).Offset(offset).Find(&rows).Error
 	return
 }
 
+// invoiceStreamBatchSize is the number of invoices StreamInvoices loads at once.
+const invoiceStreamBatchSize = 500
+
+// StreamInvoices calls fn for every invoice of the owner matching f, in
+// f.Order, without holding more than one batch in memory. Company and
+// positions are not loaded. The batches are read with LIMIT/OFFSET, so
+// f.Order should end with a unique column (all orders of the invoice list end
+// with id). No query is open while fn runs, so fn may use the store. An error
+// from fn stops the iteration and is returned.
+func (s *Store) StreamInvoices(ownerID uint, f InvoiceFilters, fn func(Invoice) error) error {
+	order := f.Order
+	if order == "" {
+		order = "id asc"
+	}
+	for offset := 0; ; offset += invoiceStreamBatchSize {
+		var batch []Invoice
+		if err := s.invoiceQuery(ownerID, f).
+			Order(order).
+			Limit(invoiceStreamBatchSize).
+			Offset(offset).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		for _, inv := range batch {
+			if err := fn(inv); err != nil {
+				return err
+			}
+		}
+		if len(batch) < invoiceStreamBatchSize {
+			return nil
+		}
+	}
+}
+
 func (s *Store) ListInvoicesForExport(ownerID uint) ([]Invoice, error) {
+	return s.listInvoicesForExport(ownerID, 0)
+}
+
+// ListCompanyInvoicesForExport is ListInvoicesForExport for the invoices of
+// one company.
+func (s *Store) ListCompanyInvoicesForExport(companyID, ownerID uint) ([]Invoice, error) {
+	return s.listInvoicesForExport(ownerID, companyID)
+}
+
+// listInvoicesForExport loads the owner's invoices with positions, limited
+// to one company unless companyID is 0.
+func (s *Store) listInvoicesForExport(ownerID, companyID uint) ([]Invoice, error) {
 	var invs []Invoice
 
 	q := s.db.
 		Where("owner_id = ?", ownerID).
 		Preload("InvoicePositions", "owner_id = ?", ownerID)
+	if companyID != 0 {
+		q = q.Where("company_id = ?", companyID)
+	}
 
 	if err := q.Find(&invs).Error; err != nil {
 		return nil, fmt.Errorf("list invoices for export (owner %d): %w", ownerID, err)
 	}
+	for i := range invs {
+		s.setPriceDecimals(s.db, &invs[i], ownerID)
+		s.setRoundingMode(s.db, &invs[i], ownerID)
+	}
 
 	return invs, nil
 }
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/speedata/einvoice"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxInvoiceAttachmentsSize is the maximum total size of all files attached
+// to one invoice. Attachments end up inside the invoice PDF, so the limit
+// keeps mails with the invoice deliverable.
+const MaxInvoiceAttachmentsSize int64 = 10 << 20
+
+// AllowedAttachmentMIMETypes lists the file types that may be attached to an
+// invoice.
+var AllowedAttachmentMIMETypes = map[string]bool{
+	"application/pdf": true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"text/plain":      true,
+	"text/csv":        true,
+}
+
+var (
+	// ErrAttachmentTooLarge is returned when an upload would exceed
+	// MaxInvoiceAttachmentsSize for the invoice.
+	ErrAttachmentTooLarge = errors.New("attachments exceed the size limit")
+	// ErrAttachmentType is returned for MIME types not in
+	// AllowedAttachmentMIMETypes.
+	ErrAttachmentType = errors.New("attachment type not allowed")
+)
+
+// InvoiceAttachment is a supporting file (timesheet, delivery note, ...)
+// stored with an invoice. The file itself lives on disk at Path.
+type InvoiceAttachment struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+	InvoiceID uint      `gorm:"not null;index"`
+	OwnerID   uint      `gorm:"not null;index"`
+	Filename  string    `gorm:"type:text;not null"`
+	Path      string    `gorm:"type:text;not null"`
+	MIME      string    `gorm:"column:mime;type:text;not null"`
+	Size      int64     `gorm:"not null"`
+}
+
+func (InvoiceAttachment) TableName() string { return "invoice_attachments" }
+
+// IsPDF reports whether the attachment is a PDF file. Only PDFs are embedded
+// into the e-invoice.
+func (a *InvoiceAttachment) IsPDF() bool {
+	return a.MIME == "application/pdf"
+}
+
+// AddInvoiceAttachment stores the attachment record for an invoice. The MIME
+// type must be whitelisted and the total size of the invoice's attachments
+// must stay within MaxInvoiceAttachmentsSize.
+func (s *Store) AddInvoiceAttachment(a *InvoiceAttachment) error {
+	if !AllowedAttachmentMIMETypes[a.MIME] {
+		return fmt.Errorf("%w: %s", ErrAttachmentType, a.MIME)
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var inv Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", a.InvoiceID, a.OwnerID).
+			First(&inv).Error; err != nil {
+			return err
+		}
+		var used int64
+		if err := tx.Model(&InvoiceAttachment{}).
+			Where("invoice_id = ? AND owner_id = ?", a.InvoiceID, a.OwnerID).
+			Select("COALESCE(SUM(size), 0)").
+			Scan(&used).Error; err != nil {
+			return err
+		}
+		if used+a.Size > MaxInvoiceAttachmentsSize {
+			return ErrAttachmentTooLarge
+		}
+		return tx.Create(a).Error
+	})
+}
+
+// ListInvoiceAttachments returns the attachments of an invoice, oldest first.
+func (s *Store) ListInvoiceAttachments(invoiceID, ownerID uint) ([]InvoiceAttachment, error) {
+	var out []InvoiceAttachment
+	err := s.db.Where("invoice_id = ? AND owner_id = ?", invoiceID, ownerID).
+		Order("id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// LoadInvoiceAttachment loads a single attachment of the owner.
+func (s *Store) LoadInvoiceAttachment(id, ownerID uint) (*InvoiceAttachment, error) {
+	var a InvoiceAttachment
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// DeleteInvoiceAttachment removes the attachment record and its file.
+func (s *Store) DeleteInvoiceAttachment(id, ownerID uint) error {
+	a, err := s.LoadInvoiceAttachment(id, ownerID)
+	if err != nil {
+		return err
+	}
+	if err = s.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&InvoiceAttachment{}).Error; err != nil {
+		return err
+	}
+	if err = os.Remove(a.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// attachmentDocuments returns the invoice's PDF attachments as additional
+// referenced documents (BG-24, type code 916) with the file content as
+// binary object. Files that cannot be read are skipped.
+func (s *Store) attachmentDocuments(invoiceID, ownerID uint) ([]einvoice.Document, error) {
+	atts, err := s.ListInvoiceAttachments(invoiceID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	var docs []einvoice.Document
+	for _, a := range atts {
+		if !a.IsPDF() {
+			continue
+		}
+		data, err := os.ReadFile(a.Path)
+		if err != nil {
+			continue
+		}
+		docs = append(docs, einvoice.Document{
+			IssuerAssignedID:       a.Filename,
+			TypeCode:               "916",
+			Name:                   a.Filename,
+			AttachmentBinaryObject: data,
+			AttachmentMimeCode:     a.MIME,
+			AttachmentFilename:     a.Filename,
+		})
+	}
+	return docs, nil
+}
@@ -0,0 +1,90 @@
+package model_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestInvoiceAttachments(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	dir := t.TempDir()
+
+	pdfPath := filepath.Join(dir, "stundenzettel.pdf")
+	if err := os.WriteFile(pdfPath, []byte("%PDF-1.4\n%%EOF\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	att := &model.InvoiceAttachment{
+		InvoiceID: data.Invoice.ID,
+		OwnerID:   fixtures.DefaultOwnerID,
+		Filename:  "stundenzettel.pdf",
+		Path:      pdfPath,
+		MIME:      "application/pdf",
+		Size:      15,
+	}
+	if err := store.AddInvoiceAttachment(att); err != nil {
+		t.Fatalf("AddInvoiceAttachment failed: %v", err)
+	}
+
+	exe := &model.InvoiceAttachment{
+		InvoiceID: data.Invoice.ID,
+		OwnerID:   fixtures.DefaultOwnerID,
+		Filename:  "tool.exe",
+		Path:      filepath.Join(dir, "tool.exe"),
+		MIME:      "application/x-msdownload",
+		Size:      1,
+	}
+	if err := store.AddInvoiceAttachment(exe); !errors.Is(err, model.ErrAttachmentType) {
+		t.Errorf("AddInvoiceAttachment(exe) error = %v, want ErrAttachmentType", err)
+	}
+
+	big := &model.InvoiceAttachment{
+		InvoiceID: data.Invoice.ID,
+		OwnerID:   fixtures.DefaultOwnerID,
+		Filename:  "scan.png",
+		Path:      filepath.Join(dir, "scan.png"),
+		MIME:      "image/png",
+		Size:      model.MaxInvoiceAttachmentsSize,
+	}
+	if err := store.AddInvoiceAttachment(big); !errors.Is(err, model.ErrAttachmentTooLarge) {
+		t.Errorf("AddInvoiceAttachment(big) error = %v, want ErrAttachmentTooLarge", err)
+	}
+
+	atts, err := store.ListInvoiceAttachments(data.Invoice.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("ListInvoiceAttachments failed: %v", err)
+	}
+	if len(atts) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(atts))
+	}
+
+	inv, err := store.LoadInvoice(data.Invoice.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	xmlPath := filepath.Join(dir, "invoice.xml")
+	if err := store.WriteZUGFeRDXML(inv, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	xml, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(xml), "AdditionalReferencedDocument") ||
+		!strings.Contains(string(xml), `filename="stundenzettel.pdf"`) {
+		t.Error("XML does not reference the PDF attachment")
+	}
+
+	if err := store.DeleteInvoiceAttachment(att.ID, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("DeleteInvoiceAttachment failed: %v", err)
+	}
+	if _, err := os.Stat(pdfPath); !os.IsNotExist(err) {
+		t.Error("attachment file was not removed")
+	}
+}
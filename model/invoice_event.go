@@ -0,0 +1,136 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InvoiceEventKind describes what happened to an invoice.
+type InvoiceEventKind string
+
+const (
+	InvoiceEventCreated  InvoiceEventKind = "created"
+	InvoiceEventUpdated  InvoiceEventKind = "updated"
+	InvoiceEventStatus   InvoiceEventKind = "status" // Detail holds "old → new"
+	InvoiceEventDeleted  InvoiceEventKind = "deleted"
+	InvoiceEventRestored InvoiceEventKind = "restored"
+)
+
+// ErrInvoiceEventImmutable is returned when an invoice event is updated or
+// deleted. The history is append-only.
+var ErrInvoiceEventImmutable = errors.New("invoice events are immutable")
+
+// InvoiceEvent is one entry in the change history of an invoice. Events are
+// written in the same transaction as the change they describe and are never
+// modified afterwards; they are not associated with the invoice in GORM, so
+// replacing positions or re-saving the invoice leaves them untouched.
+type InvoiceEvent struct {
+	ID        uint             `gorm:"primaryKey"`
+	CreatedAt time.Time        `gorm:"not null"`
+	InvoiceID uint             `gorm:"not null;index"`
+	OwnerID   uint             `gorm:"not null;index"`
+	UserID    uint             `gorm:"not null"` // 0 = system (e.g. payment import)
+	Kind      InvoiceEventKind `gorm:"type:text;not null"`
+	Detail    string           `gorm:"type:text"`
+}
+
+func (InvoiceEvent) TableName() string { return "invoice_events" }
+
+// BeforeUpdate keeps events immutable.
+func (InvoiceEvent) BeforeUpdate(*gorm.DB) error { return ErrInvoiceEventImmutable }
+
+// BeforeDelete keeps events immutable.
+func (InvoiceEvent) BeforeDelete(*gorm.DB) error { return ErrInvoiceEventImmutable }
+
+// InvoiceEventEntry is an event joined with the name of the acting user.
+type InvoiceEventEntry struct {
+	InvoiceEvent
+	UserEmail    string `gorm:"column:user_email"`
+	UserFullName string `gorm:"column:user_full_name"`
+}
+
+// recordInvoiceEvent appends an event within tx. The acting user is the one
+// the store was bound to with AsUser.
+func (s *Store) recordInvoiceEvent(tx *gorm.DB, invoiceID, ownerID uint, kind InvoiceEventKind, detail string) error {
+	return tx.Create(&InvoiceEvent{
+		InvoiceID: invoiceID,
+		OwnerID:   ownerID,
+		UserID:    s.userID,
+		Kind:      kind,
+		Detail:    detail,
+	}).Error
+}
+
+// statusEventDetail formats a status change for the event detail.
+func statusEventDetail(from, to InvoiceStatus) string {
+	return fmt.Sprintf("%s → %s", from, to)
+}
+
+// ListInvoiceEvents returns the history of an invoice, oldest first.
+func (s *Store) ListInvoiceEvents(invoiceID, ownerID uint) ([]InvoiceEventEntry, error) {
+	var out []InvoiceEventEntry
+	err := s.db.Table("invoice_events").
+		Select("invoice_events.*, users.email AS user_email, users.full_name AS user_full_name").
+		Joins("LEFT JOIN users ON users.id = invoice_events.user_id").
+		Where("invoice_events.invoice_id = ? AND invoice_events.owner_id = ?", invoiceID, ownerID).
+		Order("invoice_events.created_at ASC, invoice_events.id ASC").
+		Scan(&out).Error
+	return out, err
+}
+
+// invoiceChanges lists the (German) names of the fields that differ between
+// the stored invoice old and the edited invoice inv.
+func invoiceChanges(old, inv *Invoice) string {
+	var changed []string
+	add := func(differs bool, label string) {
+		if differs {
+			changed = append(changed, label)
+		}
+	}
+	add(old.Number != inv.Number, "Nummer")
+	add(!old.Date.Equal(inv.Date), "Datum")
+	add(!old.OccurrenceDate.Equal(inv.OccurrenceDate), "Leistungsdatum")
+	add(!old.DueDate.Equal(inv.DueDate), "Fälligkeit")
+	add(old.OrderNumber != inv.OrderNumber, "Bestellnummer")
+	add(old.BuyerReference != inv.BuyerReference, "Käuferreferenz")
+	add(old.ContactInvoice != inv.ContactInvoice, "Ansprechpartner")
+	add(old.Opening != inv.Opening, "Einleitung")
+	add(old.Footer != inv.Footer, "Schlusstext")
+	add(old.Currency != inv.Currency || !old.exchangeRate().Equal(inv.exchangeRate()), "Währung")
+	add(old.TaxType != inv.TaxType || old.ExemptionReason != inv.ExemptionReason, "Steuer")
+	add(!old.SkontoPercent.Equal(inv.SkontoPercent) || old.SkontoDays != inv.SkontoDays, "Skonto")
+	add(old.ZugferdProfile.orDefault() != inv.ZugferdProfile.orDefault(), "ZUGFeRD-Profil")
+	add(!sameTemplate(old.TemplateID, inv.TemplateID), "Briefkopf")
+	add(!samePositions(old.InvoicePositions, inv.InvoicePositions), "Positionen")
+	if len(changed) == 0 {
+		return "keine inhaltlichen Änderungen"
+	}
+	return strings.Join(changed, ", ")
+}
+
+func sameTemplate(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func samePositions(a, b []InvoicePosition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		p, q := a[i], b[i]
+		if p.Text != q.Text || p.UnitCode != q.UnitCode ||
+			!p.Quantity.Equal(q.Quantity) || !p.NetPrice.Equal(q.NetPrice) ||
+			!p.TaxRate.Equal(q.TaxRate) || !p.DiscountPercent.Equal(q.DiscountPercent) ||
+			!p.CostPrice.Equal(q.CostPrice) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestInvoiceEvents(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	const uid = 7
+	userStore := store.AsUser(uid)
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := userStore.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	inv.Opening = "Neue Einleitung"
+	inv.InvoicePositions = inv.InvoicePositions[:1]
+	if err := userStore.UpdateInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+	if err := userStore.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	events, err := store.ListInvoiceEvents(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("ListInvoiceEvents failed: %v", err)
+	}
+	want := []struct {
+		kind   model.InvoiceEventKind
+		detail string
+	}{
+		{model.InvoiceEventCreated, inv.Number},
+		{model.InvoiceEventUpdated, "Einleitung, Positionen"},
+		{model.InvoiceEventStatus, "draft → issued"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		if events[i].Kind != w.kind || events[i].Detail != w.detail {
+			t.Errorf("event %d = %s %q, want %s %q", i, events[i].Kind, events[i].Detail, w.kind, w.detail)
+		}
+		if events[i].UserID != uid {
+			t.Errorf("event %d UserID = %d, want %d", i, events[i].UserID, uid)
+		}
+	}
+}
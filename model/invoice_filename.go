@@ -0,0 +1,60 @@
+package model
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// filenameTransliteration spells out German umlauts and ß in file names.
+var filenameTransliteration = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+)
+
+// SafeInvoiceFilename turns s, usually an invoice number, into a file name
+// (without extension) that is valid on all common systems and in a
+// Content-Disposition header: umlauts and ß are spelled out, slashes,
+// backslashes and colons become hyphens, white space becomes an underscore
+// and any other character but ASCII letters, digits, '.', '-' and '_' is
+// dropped. Leading dots are removed. An empty result yields "rechnung".
+func SafeInvoiceFilename(s string) string {
+	s = filenameTransliteration.Replace(strings.TrimSpace(s))
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			b.WriteByte('-')
+		case unicode.IsSpace(r):
+			b.WriteByte('_')
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_'):
+			b.WriteRune(r)
+		}
+	}
+	if name := strings.TrimLeft(b.String(), "."); name != "" {
+		return name
+	}
+	return "rechnung"
+}
+
+// InvoiceFilename returns the file name (without extension) of a downloaded
+// invoice. template is Settings.InvoiceFilenameTemplate with the
+// placeholders %NR% (invoice number), %CN% (customer number) and %NAME%
+// (company name); empty means the invoice number. The caller appends the
+// extension, so a trailing .pdf or .xml in template is dropped. The result is
+// passed through SafeInvoiceFilename. company may be nil.
+func InvoiceFilename(template string, inv *Invoice, company *Company) string {
+	template = strings.TrimSpace(template)
+	if ext := strings.ToLower(path.Ext(template)); ext == ".pdf" || ext == ".xml" {
+		template = strings.TrimSpace(template[:len(template)-len(ext)])
+	}
+	if template == "" {
+		template = "%NR%"
+	}
+	var customerNumber, name string
+	if company != nil {
+		customerNumber, name = company.CustomerNumber, company.Name
+	}
+	return SafeInvoiceFilename(strings.NewReplacer(
+		"%NR%", inv.Number, "%CN%", customerNumber, "%NAME%", name,
+	).Replace(template))
+}
@@ -0,0 +1,48 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/billingcat/crm/model"
+)
+
+func TestSafeInvoiceFilename(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"RE-2025-0001", "RE-2025-0001"},
+		{"RE/2025/0001", "RE-2025-0001"},
+		{`RE\2025:1`, "RE-2025-1"},
+		{"Rechnung 12 für Müller", "Rechnung_12_fuer_Mueller"},
+		{"Größe Ärger Öl Übung", "Groesse_Aerger_Oel_Uebung"},
+		{`A*B?"<>|#C`, "ABC"},
+		{"../etc/passwd", "-etc-passwd"},
+		{"  ", "rechnung"},
+		{"€", "rechnung"},
+	} {
+		if got := model.SafeInvoiceFilename(tc.in); got != tc.want {
+			t.Errorf("SafeInvoiceFilename(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestInvoiceFilename(t *testing.T) {
+	inv := &model.Invoice{Number: "RE/2025/7"}
+	company := &model.Company{Name: "Bäckerei Schütz GmbH", CustomerNumber: "K-100"}
+	for _, tc := range []struct {
+		template string
+		company  *model.Company
+		want     string
+	}{
+		{"", company, "RE-2025-7"},
+		{"Rechnung_%NR%_%NAME%", company, "Rechnung_RE-2025-7_Baeckerei_Schuetz_GmbH"},
+		{"%CN%-%NR%", company, "K-100-RE-2025-7"},
+		{"Rechnung_%NR%_%NAME%", nil, "Rechnung_RE-2025-7_"},
+		{"Rechnung_%NR%_%NAME%.pdf", company, "Rechnung_RE-2025-7_Baeckerei_Schuetz_GmbH"},
+		{"%NR%.PDF", company, "RE-2025-7"},
+		{"%NR%.xml", company, "RE-2025-7"},
+		{".pdf", company, "RE-2025-7"},
+	} {
+		if got := model.InvoiceFilename(tc.template, inv, tc.company); got != tc.want {
+			t.Errorf("InvoiceFilename(%q) = %q, want %q", tc.template, got, tc.want)
+		}
+	}
+}
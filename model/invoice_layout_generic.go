@@ -58,6 +58,9 @@ body { font-family: sans-serif; font-size: 10pt; }
    vertical space here (empty height/padding collapse); it does not collapse at
    the page top, and later pages have no wrapper so the table flows to the top. */
 .below-address { margin-top: 85mm; }
+/* GiroCode below the totals; the caption sits next to the code. */
+table.paymentqr { margin-top: 6mm; }
+table.paymentqr td { vertical-align: middle; padding-right: 4mm; font-size: 8pt; }
 
 /* The footer is captured as a running element and re-emitted in the
    @bottom-center margin box on every page; the box's margins (see @page)
@@ -93,8 +96,24 @@ td.sumlabel { text-align: right; }
 // buildGenericInvoiceHTML renders the invoice body as HTML for the generic
 // (no-letterhead) layout. zi carries the computed totals and per-rate taxes so
 // the printed amounts match the embedded ZUGFeRD XML exactly; inv/settings
-// provide the remaining display data.
+// provide the remaining display data. Invoices payable by SEPA transfer get a
+// GiroCode below the body.
 func buildGenericInvoiceHTML(zi *einvoice.Invoice, inv *Invoice, settings *Settings, company *Company) string {
+	body := buildInvoiceBodyHTML(zi, inv, company)
+	if payload := invoicePaymentQR(inv, settings, zi.PaymentReference); payload != "" {
+		body += `<table class="paymentqr"><tr><td>` + paymentQRHTML(payload, 2.5) +
+			`</td><td>Jetzt mit der Banking-App scannen und bezahlen.</td></tr></table>`
+	}
+	return buildGenericPageHTML(settings,
+		buildAddresseeInnerHTML(inv, company),
+		buildInvoiceInfoInnerHTML(inv),
+		body)
+}
+
+// buildGenericPageHTML wraps the given addressee, info and body fragments in
+// the generic page scaffold (footer, sender line, DIN 5008 header). It is used
+// for invoices and for documents derived from them, such as reminders.
+func buildGenericPageHTML(settings *Settings, addresseeHTML, infoHTML, bodyHTML string) string {
 	var b strings.Builder
 
 	// --- page footer: captured as a CSS running element (no flow space) and
@@ -113,17 +132,17 @@ func buildGenericInvoiceHTML(zi *einvoice.Invoice, inv *Invoice, settings *Setti
 	b.WriteString(`</div>`)
 
 	b.WriteString(`<div class="addressee">`)
-	b.WriteString(buildAddresseeInnerHTML(inv, company))
+	b.WriteString(addresseeHTML)
 	b.WriteString(`</div>`)
 
 	b.WriteString(`<div class="info">`)
-	b.WriteString(buildInvoiceInfoInnerHTML(inv))
+	b.WriteString(infoHTML)
 	b.WriteString(`</div>`)
 
 	// Everything below the address field flows in a wrapper whose margin-top
 	// reserves the page-1 address space (see .below-address).
 	b.WriteString(`<div class="below-address">`)
-	b.WriteString(buildInvoiceBodyHTML(zi, inv))
+	b.WriteString(bodyHTML)
 	b.WriteString(`</div>`) // .below-address
 
 	return b.String()
@@ -149,11 +168,14 @@ func buildAddresseeInnerHTML(inv *Invoice, company *Company) string {
 }
 
 // buildInvoiceInfoInnerHTML renders the invoice-info block (date, number, due
-// date) as inline HTML without a wrapping element. Shared by both layouts.
+// date and, for credit notes, the original invoice number) as inline HTML without a wrapping element. Shared by both layouts.
 func buildInvoiceInfoInnerHTML(inv *Invoice) string {
 	var b strings.Builder
 	b.WriteString("Datum: " + esc(formatDateDE(inv.Date)) + "<br/>")
-	b.WriteString("Rechnung " + esc(inv.Number))
+	b.WriteString(inv.DocumentType.Title() + " " + esc(inv.Number))
+	if inv.ReferencedInvoiceNumber != "" {
+		b.WriteString("<br/>zu Rechnung " + esc(inv.ReferencedInvoiceNumber))
+	}
 	if !inv.DueDate.IsZero() {
 		b.WriteString("<br/>Zahlungsziel: " + esc(formatDateDE(inv.DueDate)))
 	}
@@ -161,24 +183,36 @@ func buildInvoiceInfoInnerHTML(inv *Invoice) string {
 }
 
 // buildInvoiceBodyHTML renders the flowing part of the invoice: opening text,
-// the line-item table with totals, and closing text. This is the content that
+// the line-item table with totals, and closing text (placeholders filled by
+// renderInvoiceText). This is the content that
 // breaks across pages and is shared by both layouts (styled via invoiceItemsCSS).
 // zi carries the computed totals so the printed amounts match the embedded
 // ZUGFeRD XML exactly.
-func buildInvoiceBodyHTML(zi *einvoice.Invoice, inv *Invoice) string {
+func buildInvoiceBodyHTML(zi *einvoice.Invoice, inv *Invoice, company *Company) string {
 	currency := currencyCodeToText(inv.Currency)
 	hasDifferentTax := len(zi.TradeTaxes) > 1
-	// One extra "Steuer" column only when line items carry different rates.
+	// One extra "Steuer" column only when line items carry different rates,
+	// one extra "Rabatt" column only when a line has a discount.
+	hasDiscount := false
+	for _, pos := range inv.InvoicePositions {
+		if pos.DiscountPercent.IsPositive() {
+			hasDiscount = true
+			break
+		}
+	}
 	ncols := 5
 	if hasDifferentTax {
-		ncols = 6
+		ncols++
+	}
+	if hasDiscount {
+		ncols++
 	}
 
 	var b strings.Builder
 
 	// --- opening text ---
-	if strings.TrimSpace(inv.Opening) != "" {
-		b.WriteString(`<p class="opening">` + escMultiline(inv.Opening) + `</p>`)
+	if opening := renderInvoiceText(inv.Opening, inv, company); strings.TrimSpace(opening) != "" {
+		b.WriteString(`<p class="opening">` + escMultiline(opening) + `</p>`)
 	}
 
 	// --- line-item table ---
@@ -190,6 +224,9 @@ func buildInvoiceBodyHTML(zi *einvoice.Invoice, inv *Invoice) string {
 		b.WriteString(`<th class="num">Steuer</th>`)
 	}
 	b.WriteString(`<th class="num">Einzelpreis<br/>(` + esc(currency) + `)</th>`)
+	if hasDiscount {
+		b.WriteString(`<th class="num">Rabatt</th>`)
+	}
 	b.WriteString(`<th class="num">Gesamtpreis<br/>(` + esc(currency) + `)</th>`)
 	b.WriteString(`</tr></thead><tbody>`)
 
@@ -201,7 +238,14 @@ func buildInvoiceBodyHTML(zi *einvoice.Invoice, inv *Invoice) string {
 		if hasDifferentTax {
 			b.WriteString(`<td class="num">` + esc(formatQuantityDE(pos.TaxRate)) + `%</td>`)
 		}
-		b.WriteString(`<td class="num">` + esc(formatAmountDE(pos.NetPrice)) + `</td>`)
+		b.WriteString(`<td class="num">` + esc(formatPriceDE(pos.NetPrice, inv.PriceDecimals)) + `</td>`)
+		if hasDiscount {
+			if pos.DiscountPercent.IsPositive() {
+				b.WriteString(`<td class="num">` + esc(formatQuantityDE(pos.DiscountPercent)) + `%</td>`)
+			} else {
+				b.WriteString(`<td class="num"></td>`)
+			}
+		}
 		b.WriteString(`<td class="num">` + esc(formatAmountDE(pos.LineTotal)) + `</td>`)
 		b.WriteString(`</tr>`)
 	}
@@ -215,9 +259,29 @@ func buildInvoiceBodyHTML(zi *einvoice.Invoice, inv *Invoice) string {
 	b.WriteString(sumRow("total", ncols, "Gesamtbetrag", zi.GrandTotal))
 	b.WriteString(`</tbody></table>`)
 
+	// --- statutory tax note (reverse charge, intra-community supply) ---
+	for _, n := range zi.Notes {
+		if n.SubjectCode == taxNoteSubjectCode {
+			b.WriteString(`<p class="closing">` + esc(n.Text) + `</p>`)
+		}
+	}
+
+	// --- early-payment discount ---
+	if inv.HasSkonto() {
+		b.WriteString(`<p class="closing">Bei Zahlung bis ` + esc(formatDateDE(inv.SkontoDate())) +
+			` abzüglich ` + esc(formatQuantityDE(inv.SkontoPercent)) + `% Skonto: ` +
+			esc(formatAmountDE(skontoAmount(zi.GrandTotal, inv.SkontoPercent))) + ` ` + esc(currency) + `</p>`)
+	}
+
+	// --- payment reference ---
+	if zi.PaymentReference != "" {
+		b.WriteString(`<p class="closing">Bitte geben Sie bei der Zahlung als Verwendungszweck ` +
+			esc(zi.PaymentReference) + ` an.</p>`)
+	}
+
 	// --- closing text ---
-	if strings.TrimSpace(inv.Footer) != "" {
-		b.WriteString(`<p class="closing">` + escMultiline(inv.Footer) + `</p>`)
+	if footer := renderInvoiceText(inv.Footer, inv, company); strings.TrimSpace(footer) != "" {
+		b.WriteString(`<p class="closing">` + escMultiline(footer) + `</p>`)
 	}
 
 	return b.String()
@@ -238,6 +302,13 @@ const userInvoiceCSSFile = "invoice.css"
 // logged and skipped rather than failing the invoice. The caller
 // (CreateZUGFeRDPDF) owns document creation and calls Finish afterwards.
 func (s *Store) layoutGenericInvoice(d *document.Document, inv *Invoice, settings *Settings, company *Company, zi *einvoice.Invoice, ownerID uint, logger *slog.Logger) error {
+	return s.renderGenericPages(d, buildGenericInvoiceHTML(zi, inv, settings, company), inv.ID, ownerID, logger)
+}
+
+// renderGenericPages adds the generic layout CSS (plus the optional user
+// stylesheet) to d and renders pageHTML, which is expected to be built with
+// buildGenericPageHTML. invoiceID is only used for logging.
+func (s *Store) renderGenericPages(d *document.Document, pageHTML string, invoiceID, ownerID uint, logger *slog.Logger) error {
 	if err := d.AddCSS(genericInvoiceCSS); err != nil {
 		return fmt.Errorf("add css: %w", err)
 	}
@@ -247,10 +318,10 @@ func (s *Store) layoutGenericInvoice(d *document.Document, inv *Invoice, setting
 	if _, err := os.Stat(cssPath); err == nil {
 		if err = d.ReadCSSFile(cssPath); err != nil {
 			logger.Warn("user invoice.css could not be applied, rendering with default styling",
-				"err", err, "invoice_id", inv.ID, "owner_id", ownerID)
+				"err", err, "invoice_id", invoiceID, "owner_id", ownerID)
 		}
 	}
-	if err := d.RenderPages(buildGenericInvoiceHTML(zi, inv, settings, company)); err != nil {
+	if err := d.RenderPages(pageHTML); err != nil {
 		return fmt.Errorf("render pages: %w", err)
 	}
 	return nil
@@ -319,7 +390,23 @@ func joinNonEmpty(sep string, parts ...string) string {
 // formatAmountDE formats a decimal as German currency: thousands separated by
 // ".", two decimals after ",". Example: 1234.5 -> "1.234,50".
 func formatAmountDE(d decimal.Decimal) string {
-	s := d.StringFixed(2)
+	return formatFixedDE(d.StringFixed(2))
+}
+
+// formatPriceDE formats a unit price like formatAmountDE, but with up to
+// decimals places: 0.0125 -> "0,0125", 12.5 -> "12,50".
+func formatPriceDE(d decimal.Decimal, decimals int) string {
+	s := d.StringFixed(int32(NormalizePriceDecimals(decimals)))
+	intPart, frac, _ := strings.Cut(s, ".")
+	for len(frac) > 2 && strings.HasSuffix(frac, "0") {
+		frac = frac[:len(frac)-1]
+	}
+	return formatFixedDE(intPart + "." + frac)
+}
+
+// formatFixedDE groups the thousands of a fixed point number ("1234.50") and
+// uses a decimal comma ("1.234,50").
+func formatFixedDE(s string) string {
 	neg := strings.HasPrefix(s, "-")
 	s = strings.TrimPrefix(s, "-")
 	intPart, frac, _ := strings.Cut(s, ".")
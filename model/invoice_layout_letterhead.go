@@ -11,13 +11,15 @@ import (
 )
 
 // layoutLetterheadInvoice renders the invoice on top of a user-defined
-// letterhead (mode 2). The layout is driven by the template's three regions
+// letterhead (mode 2). The layout is driven by the template's regions
 // (LetterheadTemplate.Regions, measured in cm from the top-left paper edge):
 //
 //   - main_area:     defines the @page margins; the line-item table flows here
 //     and breaks across pages.
 //   - addressee:     recipient address block, placed on page 1 at its region.
 //   - invoice_info:  date / number / due date, placed on page 1 at its region.
+//   - payment_qr:    optional; the GiroCode, placed on page 1 at its region.
+//     Templates without this region print no QR code.
 //
 // The letterhead PDF is painted as a full-page background on every page via a
 // CSS `@page { background-image: url(...) }` rule; htmlbag loads the PDF,
@@ -25,8 +27,19 @@ import (
 // distinct page-2 rectangle (HasPage2), later pages use that rectangle and PDF
 // page 2 via `@page :first` vs. `@page` (see letterheadInvoiceCSS). The caller
 // (CreateZUGFeRDPDF) owns document creation and calls Finish afterwards.
-func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, company *Company, zi *einvoice.Invoice, ownerID uint) error {
-	tpl := inv.Template
+func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, settings *Settings, company *Company, zi *einvoice.Invoice, ownerID uint) error {
+	return s.renderLetterheadPages(d, inv.Template, ownerID,
+		buildAddresseeInnerHTML(inv, company),
+		buildInvoiceInfoInnerHTML(inv),
+		buildInvoiceBodyHTML(zi, inv, company),
+		invoicePaymentQR(inv, settings, zi.PaymentReference))
+}
+
+// renderLetterheadPages adds the letterhead CSS for tpl to d and renders the
+// addressee and info fragments at their regions followed by the flowing body.
+// A non-empty qrPayload is drawn as QR code in the payment_qr region, if the
+// template has one. Shared by invoices and reminders.
+func (s *Store) renderLetterheadPages(d *document.Document, tpl *LetterheadTemplate, ownerID uint, addresseeHTML, infoHTML, bodyHTML, qrPayload string) error {
 
 	pageW, pageH := tpl.PageWidthCm, tpl.PageHeightCm
 	if pageW <= 0 || pageH <= 0 {
@@ -36,6 +49,10 @@ func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, comp
 	main := findRegion(tpl.Regions, FieldPositions)
 	addressee := findRegion(tpl.Regions, FieldSender)
 	info := findRegion(tpl.Regions, FieldInvoiceInfo)
+	qr := findRegion(tpl.Regions, FieldPaymentQR)
+	if qrPayload == "" {
+		qr = nil
+	}
 
 	assetDir := filepath.Join(s.Config.Basedir, "assets", "userassets", fmt.Sprintf("owner%d", ownerID))
 
@@ -45,10 +62,10 @@ func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, comp
 	// so a missing PDF just yields a blank background — same as before.
 	bgPath := ""
 	if p := strings.TrimSpace(tpl.PDFPath); p != "" {
-		bgPath = filepath.Join(assetDir, p)
+		bgPath, _ = SafeRelPath(assetDir, p) // unsafe paths get no background
 	}
 
-	if err := d.AddCSS(letterheadInvoiceCSS(pageW, pageH, main, addressee, info, bgPath)); err != nil {
+	if err := d.AddCSS(letterheadInvoiceCSS(pageW, pageH, main, addressee, info, qr, bgPath)); err != nil {
 		return fmt.Errorf("add css: %w", err)
 	}
 	// Custom template fonts, appended after the base CSS so the body
@@ -66,12 +83,15 @@ func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, comp
 	// here — the letterhead itself carries that branding.
 	var b strings.Builder
 	if addressee != nil {
-		b.WriteString(`<div class="lh-addressee">` + buildAddresseeInnerHTML(inv, company) + `</div>`)
+		b.WriteString(`<div class="lh-addressee">` + addresseeHTML + `</div>`)
 	}
 	if info != nil {
-		b.WriteString(`<div class="lh-info">` + buildInvoiceInfoInnerHTML(inv) + `</div>`)
+		b.WriteString(`<div class="lh-info">` + infoHTML + `</div>`)
 	}
-	b.WriteString(buildInvoiceBodyHTML(zi, inv))
+	if qr != nil {
+		b.WriteString(`<div class="lh-paymentqr">` + paymentQRHTML(qrPayload, min(qr.WidthCm, qr.HeightCm)) + `</div>`)
+	}
+	b.WriteString(bodyHTML)
 
 	if err := d.RenderPages(b.String()); err != nil {
 		return fmt.Errorf("render pages: %w", err)
@@ -82,7 +102,7 @@ func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, comp
 // letterheadInvoiceCSS builds the stylesheet for the letterhead layout: the
 // @page size/margins from the main_area region, the letterhead PDF as the @page
 // background image, the body font from main_area, and the per-region
-// font/alignment for the two positioned blocks. The shared invoiceItemsCSS
+// font/alignment for the positioned blocks. The shared invoiceItemsCSS
 // styles the line-item table. bgPath is the absolute path of the letterhead PDF
 // (empty for no background).
 //
@@ -91,7 +111,7 @@ func (s *Store) layoutLetterheadInvoice(d *document.Document, inv *Invoice, comp
 // page 1 via `@page :first`, and all later pages use rectangle 2 and PDF page 2
 // via the base `@page`. htmlbag applies the margins per page and reflows the
 // running text (including split tables) at the page-2 content width.
-func letterheadInvoiceCSS(pageW, pageH float64, main, addressee, info *PlacedRegion, bgPath string) string {
+func letterheadInvoiceCSS(pageW, pageH float64, main, addressee, info, qr *PlacedRegion, bgPath string) string {
 	// @page margins from the main_area region (cm from the paper edges). Fall
 	// back to a 2cm frame when the region is missing.
 	mTop, mRight, mBottom, mLeft := 2.0, 2.0, 2.0, 2.0
@@ -137,6 +157,7 @@ func letterheadInvoiceCSS(pageW, pageH float64, main, addressee, info *PlacedReg
 		mainFont, mainLine)
 	b.WriteString(regionBlockCSS("lh-addressee", addressee, "left"))
 	b.WriteString(regionBlockCSS("lh-info", info, "right"))
+	b.WriteString(regionBlockCSS("lh-paymentqr", qr, "left"))
 	b.WriteString(invoiceItemsCSS)
 	return b.String()
 }
@@ -165,7 +186,10 @@ func letterheadFontCSS(assetDir string, tpl *LetterheadTemplate) string {
 		if name == "" {
 			continue
 		}
-		p := filepath.Join(assetDir, filepath.Base(name))
+		p, err := SafeRelPath(assetDir, filepath.Base(name))
+		if err != nil {
+			continue
+		}
 		if _, err := os.Stat(p); err != nil {
 			continue
 		}
@@ -176,8 +200,10 @@ func letterheadFontCSS(assetDir string, tpl *LetterheadTemplate) string {
 		return ""
 	}
 	if n := strings.TrimSpace(tpl.FontNormal); n != "" {
-		if _, err := os.Stat(filepath.Join(assetDir, filepath.Base(n))); err == nil {
-			fmt.Fprintf(&b, "body { font-family: %q; }\n", letterheadFontFamily)
+		if p, err := SafeRelPath(assetDir, filepath.Base(n)); err == nil {
+			if _, err := os.Stat(p); err == nil {
+				fmt.Fprintf(&b, "body { font-family: %q; }\n", letterheadFontFamily)
+			}
 		}
 	}
 	return b.String()
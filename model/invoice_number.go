@@ -0,0 +1,150 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	customerNumberReplacer = regexp.MustCompile(`%CN%`)
+	counterReplacer        = regexp.MustCompile(`%(0?)(\d*)C%`)
+	year4Replacer          = regexp.MustCompile(`%YYYY%`)
+	year2Replacer          = regexp.MustCompile(`%YY%`)
+	monthReplacer          = regexp.MustCompile(`%MM%`)
+	dayReplacer            = regexp.MustCompile(`%DD%`)
+)
+
+// InvoiceCounter is the last counter handed out in one number sequence of
+// an owner: the shared sequence (CompanyID 0) or the sequence of a company
+// with a counter of its own. Counters are allocated when an invoice is
+// issued; updating the row in place serializes concurrent allocations.
+type InvoiceCounter struct {
+	OwnerID   uint `gorm:"primaryKey;autoIncrement:false"`
+	CompanyID uint `gorm:"primaryKey;autoIncrement:false"` // 0 = shared sequence
+	Value     uint `gorm:"not null;default:0"`
+}
+
+func (InvoiceCounter) TableName() string { return "invoice_counters" }
+
+// FormatInvoiceNumber renders an invoice number template. Placeholders:
+// %CN% customer number, %YYYY% / %YY% year, %MM% month and %DD% day of
+// date (the invoice date, zero-padded), %C% counter and %0nC% counter
+// zero-padded to n digits.
+func FormatInvoiceNumber(in string, customernumber string, counter int, date time.Time) string {
+	// Replace customer number
+	in = customerNumberReplacer.ReplaceAllLiteralString(in, customernumber)
+
+	// Replace date placeholders
+	year := date.Year()
+	in = year4Replacer.ReplaceAllLiteralString(in, fmt.Sprintf("%04d", year))
+	in = year2Replacer.ReplaceAllLiteralString(in, fmt.Sprintf("%02d", year%100))
+	in = monthReplacer.ReplaceAllLiteralString(in, fmt.Sprintf("%02d", int(date.Month())))
+	in = dayReplacer.ReplaceAllLiteralString(in, fmt.Sprintf("%02d", date.Day()))
+
+	// Replace counter (supports %C% and %0nC%)
+	if counterReplacer.MatchString(in) {
+		x := counterReplacer.FindAllStringSubmatch(in, -1)
+		for _, m := range x {
+			var formatted string
+			if m[2] == "" { // no width → just %d
+				formatted = fmt.Sprintf("%d", counter)
+			} else if m[1] == "0" {
+				formatted = fmt.Sprintf("%0"+m[2]+"d", counter)
+			} else {
+				// width given but no leading zero → %d
+				formatted = fmt.Sprintf("%d", counter)
+			}
+			in = counterReplacer.ReplaceAllString(in, formatted)
+		}
+	}
+	return in
+}
+
+// GetMaxCounter returns the maximum counter of the issued invoices for the
+// given company. useLocalCounter is the company's choice, see
+// Company.UsesLocalCounter: true looks at the company's own invoices only,
+// false at the shared sequence, which leaves out the companies with a counter
+// of their own. Drafts have no counter yet.
+func (s *Store) GetMaxCounter(companyID uint, useLocalCounter bool, ownerID uint) (uint, error) {
+	return maxCounter(s.db, companyID, useLocalCounter, ownerID)
+}
+
+func maxCounter(db *gorm.DB, companyID uint, useLocalCounter bool, ownerID uint) (uint, error) {
+	var max sql.NullInt64
+	q := db.Model(&Invoice{}).Where("status <> ?", InvoiceStatusDraft)
+	if useLocalCounter {
+		q = q.Where("company_id = ? AND owner_id = ?", companyID, ownerID)
+	} else {
+		ownSequence := db.Model(&Company{}).Unscoped().Select("id").
+			Where("owner_id = ? AND use_local_counter = ?", ownerID, true)
+		q = q.Where("owner_id = ? AND company_id NOT IN (?)", ownerID, ownSequence)
+	}
+	if err := q.Select("COALESCE(MAX(counter), 0)").Scan(&max).Error; err != nil {
+		return 0, err
+	}
+	return uint(max.Int64), nil
+}
+
+// allocateInvoiceCounter assigns the next counter of its sequence to an
+// invoice that is being issued, within tx. The counter of a draft is only a
+// suggestion: two drafts may show the same one, and deleted drafts must not
+// leave gaps. The sequence's InvoiceCounter row is incremented in place
+// first, which locks it until tx ends (a row lock on PostgreSQL, the write
+// lock on SQLite). The number is re-derived from the template unless the
+// user entered a different one. The editor suggests the number for today, so
+// a number formatted for today is a suggestion as well and gets the date of
+// a backdated invoice.
+func (s *Store) allocateInvoiceCounter(tx *gorm.DB, inv *Invoice, ownerID uint) error {
+	var settings Settings
+	if err := tx.Where("owner_id = ?", ownerID).Limit(1).Find(&settings).Error; err != nil {
+		return err
+	}
+	var company Company
+	if err := tx.Where("id = ? AND owner_id = ?", inv.CompanyID, ownerID).Limit(1).Find(&company).Error; err != nil {
+		return err
+	}
+	local := company.UsesLocalCounter(&settings)
+	seq := InvoiceCounter{OwnerID: ownerID}
+	if local {
+		seq.CompanyID = inv.CompanyID
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seq).Error; err != nil {
+		return fmt.Errorf("create counter: %w", err)
+	}
+	where := tx.Model(&InvoiceCounter{}).Where("owner_id = ? AND company_id = ?", seq.OwnerID, seq.CompanyID)
+	if err := where.Session(&gorm.Session{}).Update("value", gorm.Expr("value + 1")).Error; err != nil {
+		return fmt.Errorf("lock counter: %w", err)
+	}
+	if err := tx.Where("owner_id = ? AND company_id = ?", seq.OwnerID, seq.CompanyID).First(&seq).Error; err != nil {
+		return fmt.Errorf("read counter: %w", err)
+	}
+	// Invoices issued before the counter row existed, imported ones or a
+	// company that changed its sequence can be ahead of the row.
+	max, err := maxCounter(tx, inv.CompanyID, local, ownerID)
+	if err != nil {
+		return err
+	}
+	if seq.Value <= max {
+		seq.Value = max + 1
+		if err := where.Session(&gorm.Session{}).Update("value", seq.Value).Error; err != nil {
+			return fmt.Errorf("update counter: %w", err)
+		}
+	}
+
+	tpl := settings.InvoiceNumberTemplate
+	suggested := inv.Number == "" ||
+		inv.Number == FormatInvoiceNumber(tpl, company.CustomerNumber, int(inv.Counter), inv.Date) ||
+		inv.Number == FormatInvoiceNumber(tpl, company.CustomerNumber, int(inv.Counter), time.Now())
+	inv.Counter = seq.Value
+	inv.CounterAllocated = true
+	if suggested {
+		inv.Number = FormatInvoiceNumber(tpl, company.CustomerNumber, int(inv.Counter), inv.Date)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestFormatInvoiceNumber_Tokens(t *testing.T) {
+	date := time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		in      string
+		cn      string
+		counter int
+		date    time.Time
+		want    string
+	}{
+		{"four digit year", "%YYYY%", "", 1, date, "2024"},
+		{"two digit year", "%YY%", "", 1, date, "24"},
+		{"month zero-padded", "%MM%", "", 1, date, "03"},
+		{"day zero-padded", "%DD%", "", 1, date, "05"},
+		{"two digit month and day", "%MM%%DD%", "", 1, time.Date(2024, time.November, 23, 0, 0, 0, 0, time.UTC), "1123"},
+		{"customer number", "%CN%", "K-100", 1, date, "K-100"},
+		{"plain counter", "%C%", "", 42, date, "42"},
+		{"padded counter", "%05C%", "", 42, date, "00042"},
+		{"width without zero flag", "%3C%", "", 42, date, "42"},
+		{"all tokens", "RE-%YYYY%%MM%%DD%-%CN%-%04C%", "4711", 7, date, "RE-20240305-4711-0007"},
+		{"short date with counter", "%YY%/%MM%-%C%", "", 12, date, "24/03-12"},
+		{"tokens repeated", "%DD%.%MM%.%YYYY% %DD%", "", 1, date, "05.03.2024 05"},
+		{"backdated invoice keeps its year", "%YYYY%-%02C%", "", 3, time.Date(2019, time.December, 31, 0, 0, 0, 0, time.UTC), "2019-03"},
+		{"no tokens", "PLAIN", "X", 9, date, "PLAIN"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := model.FormatInvoiceNumber(tc.in, tc.cn, tc.counter, tc.date)
+			if got != tc.want {
+				t.Errorf("FormatInvoiceNumber(%q, %q, %d, %s) = %q, want %q",
+					tc.in, tc.cn, tc.counter, tc.date.Format("2006-01-02"), got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompany_UsesLocalCounter(t *testing.T) {
+	tests := []struct {
+		name            string
+		company, global bool
+		want            bool
+	}{
+		{"shared everywhere", false, false, false},
+		{"company override", true, false, true},
+		{"global local counter", false, true, true},
+		{"both", true, true, true},
+	}
+	for _, tc := range tests {
+		c := &model.Company{UseLocalCounter: tc.company}
+		if got := c.UsesLocalCounter(&model.Settings{UseLocalCounter: tc.global}); got != tc.want {
+			t.Errorf("%s: UsesLocalCounter = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInvoiceCounter_MixedSequences(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // one draft of data.Company
+
+	shared := fixtures.Company(fixtures.WithCompanyName("Shared AG"))
+	own := fixtures.Company(fixtures.WithCompanyName("Own KG"))
+	own.UseLocalCounter = true
+	for _, c := range []*model.Company{shared, own} {
+		if err := store.SaveCompany(c, fixtures.DefaultOwnerID, nil); err != nil {
+			t.Fatalf("SaveCompany failed: %v", err)
+		}
+	}
+
+	// Counters are allocated when an invoice is issued.
+	save := func(c *model.Company) uint {
+		t.Helper()
+		inv := fixtures.Invoice(fixtures.WithInvoiceCompanyID(c.ID), fixtures.WithInvoiceNumber(""))
+		if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+			t.Fatalf("MarkInvoiceIssued failed: %v", err)
+		}
+		issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+		if err != nil {
+			t.Fatalf("LoadInvoice failed: %v", err)
+		}
+		return issued.Counter
+	}
+
+	// The global setting is off: data.Company and shared count together,
+	// own has a sequence of its own that does not move the shared one.
+	steps := []struct {
+		company *model.Company
+		want    uint
+	}{
+		{own, 1},
+		{own, 2},
+		{own, 3},
+		{shared, 1},
+		{data.Company, 2},
+		{own, 4},
+		{shared, 3},
+	}
+	for i, st := range steps {
+		if got := save(st.company); got != st.want {
+			t.Errorf("step %d (%s): counter = %d, want %d", i+1, st.company.Name, got, st.want)
+		}
+	}
+	if max, _ := store.GetMaxCounter(data.Company.ID, data.Company.UsesLocalCounter(data.Settings), fixtures.DefaultOwnerID); max != 3 {
+		t.Errorf("shared GetMaxCounter = %d, want 3", max)
+	}
+	if max, _ := store.GetMaxCounter(own.ID, own.UsesLocalCounter(data.Settings), fixtures.DefaultOwnerID); max != 4 {
+		t.Errorf("own GetMaxCounter = %d, want 4", max)
+	}
+
+	// With the global setting on every company counts on its own.
+	data.Settings.UseLocalCounter = true
+	if err := store.SaveSettings(data.Settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	if got := save(data.Company); got != 3 {
+		t.Errorf("data.Company with global local counter: counter = %d, want 3", got)
+	}
+	if got := save(shared); got != 4 {
+		t.Errorf("shared with global local counter: counter = %d, want 4", got)
+	}
+	if got := save(own); got != 5 {
+		t.Errorf("own with global local counter: counter = %d, want 5", got)
+	}
+}
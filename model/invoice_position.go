@@ -0,0 +1,90 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvoicePositionNotFound is returned when a position to be deleted does
+// not exist.
+var ErrInvoicePositionNotFound = errors.New("invoice position not found")
+
+// AddInvoicePosition appends pos to the positions of a draft invoice and
+// returns its position number. pos.LineTotal must already be computed.
+// Issued invoices yield ErrInvoiceNotDraft, unknown ones ErrInvoiceNotFound.
+func (s *Store) AddInvoicePosition(invoiceID, ownerID uint, pos InvoicePosition) (int, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDraftInvoice(tx, invoiceID, ownerID); err != nil {
+			return err
+		}
+		var last int
+		if err := tx.Model(&InvoicePosition{}).
+			Where("invoice_id = ? AND owner_id = ?", invoiceID, ownerID).
+			Select("COALESCE(MAX(position), 0)").Scan(&last).Error; err != nil {
+			return fmt.Errorf("add position: %w", err)
+		}
+		pos.ID = 0
+		pos.InvoiceID = invoiceID
+		pos.OwnerID = ownerID
+		pos.Position = last + 1
+		if err := tx.Omit("ID").Create(&pos).Error; err != nil {
+			return fmt.Errorf("add position: %w", err)
+		}
+		return s.recordInvoiceEvent(tx, invoiceID, ownerID, InvoiceEventUpdated,
+			fmt.Sprintf("Position %d hinzugefügt", pos.Position))
+	})
+	return pos.Position, err
+}
+
+// DeleteInvoicePosition removes the position with the given number from a
+// draft invoice and renumbers the following positions, so that they stay
+// sequential. Issued invoices yield ErrInvoiceNotDraft, unknown positions
+// ErrInvoicePositionNotFound.
+func (s *Store) DeleteInvoicePosition(invoiceID, ownerID uint, position int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDraftInvoice(tx, invoiceID, ownerID); err != nil {
+			return err
+		}
+		res := tx.Where("invoice_id = ? AND owner_id = ? AND position = ?", invoiceID, ownerID, position).
+			Delete(&InvoicePosition{})
+		if res.Error != nil {
+			return fmt.Errorf("delete position: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("delete position %d of invoice %d: %w", position, invoiceID, ErrInvoicePositionNotFound)
+		}
+		if err := tx.Model(&InvoicePosition{}).
+			Where("invoice_id = ? AND owner_id = ? AND position > ?", invoiceID, ownerID, position).
+			Update("position", gorm.Expr("position - 1")).Error; err != nil {
+			return fmt.Errorf("renumber positions: %w", err)
+		}
+		return s.recordInvoiceEvent(tx, invoiceID, ownerID, InvoiceEventUpdated,
+			fmt.Sprintf("Position %d gelöscht", position))
+	})
+}
+
+// lockDraftInvoice checks within tx that the invoice is a draft of the owner
+// and marks it as changed, so that a stored validation result is renewed.
+// The update also serializes concurrent changes of the positions.
+func lockDraftInvoice(tx *gorm.DB, invoiceID, ownerID uint) error {
+	res := tx.Model(&Invoice{}).
+		Where("id = ? AND owner_id = ? AND status = ?", invoiceID, ownerID, InvoiceStatusDraft).
+		Update("updated_at", time.Now())
+	if res.Error != nil {
+		return fmt.Errorf("invoice %d: %w", invoiceID, res.Error)
+	}
+	if res.RowsAffected == 1 {
+		return nil
+	}
+	var n int64
+	if err := tx.Model(&Invoice{}).Where("id = ? AND owner_id = ?", invoiceID, ownerID).Count(&n).Error; err != nil {
+		return fmt.Errorf("invoice %d: %w", invoiceID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("invoice %d: %w", invoiceID, ErrInvoiceNotFound)
+	}
+	return fmt.Errorf("invoice %d: %w", invoiceID, ErrInvoiceNotDraft)
+}
@@ -0,0 +1,122 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestInvoicePositionAddDelete(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	n, err := store.AddInvoicePosition(inv.ID, fixtures.DefaultOwnerID, fixtures.Position(0, "Support", 1, 80, 7))
+	if err != nil {
+		t.Fatalf("AddInvoicePosition failed: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("new position = %d, want 4", n)
+	}
+	if err := store.DeleteInvoicePosition(inv.ID, fixtures.DefaultOwnerID, 2); err != nil {
+		t.Fatalf("DeleteInvoicePosition failed: %v", err)
+	}
+	if err := store.DeleteInvoicePosition(inv.ID, fixtures.DefaultOwnerID, 9); !errors.Is(err, model.ErrInvoicePositionNotFound) {
+		t.Errorf("delete unknown position: err = %v, want ErrInvoicePositionNotFound", err)
+	}
+
+	got, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	want := map[int]string{1: "Software Development", 2: "License Fee", 3: "Support"}
+	if len(got.InvoicePositions) != len(want) {
+		t.Fatalf("got %d positions, want %d", len(got.InvoicePositions), len(want))
+	}
+	for _, p := range got.InvoicePositions {
+		if want[p.Position] != p.Text {
+			t.Errorf("position %d = %q, want %q", p.Position, p.Text, want[p.Position])
+		}
+	}
+	// 960 + 500 at 19 %, 80 at 7 %
+	if s := got.NetTotal.StringFixed(2); s != "1540.00" {
+		t.Errorf("NetTotal = %s, want 1540.00", s)
+	}
+	if s := got.GrossTotal.StringFixed(2); s != "1823.00" {
+		t.Errorf("GrossTotal = %s, want 1823.00", s)
+	}
+
+	events, err := store.ListInvoiceEvents(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("ListInvoiceEvents failed: %v", err)
+	}
+	var details []string
+	for _, e := range events {
+		if e.Kind == model.InvoiceEventUpdated {
+			details = append(details, e.Detail)
+		}
+	}
+	if len(details) != 2 {
+		t.Errorf("update events = %q, want two", details)
+	}
+
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if _, err := store.AddInvoicePosition(inv.ID, fixtures.DefaultOwnerID, fixtures.Position(0, "Nachtrag", 1, 10, 19)); !errors.Is(err, model.ErrInvoiceNotDraft) {
+		t.Errorf("add to issued invoice: err = %v, want ErrInvoiceNotDraft", err)
+	}
+	if err := store.DeleteInvoicePosition(inv.ID, fixtures.DefaultOwnerID, 1); !errors.Is(err, model.ErrInvoiceNotDraft) {
+		t.Errorf("delete from issued invoice: err = %v, want ErrInvoiceNotDraft", err)
+	}
+	if _, err := store.AddInvoicePosition(inv.ID, fixtures.DefaultOwnerID+1, fixtures.Position(0, "Fremd", 1, 10, 19)); !errors.Is(err, model.ErrInvoiceNotFound) {
+		t.Errorf("add to foreign invoice: err = %v, want ErrInvoiceNotFound", err)
+	}
+}
+
+func TestUpdateInvoice_NotDraft(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	issued.InvoicePositions = issued.InvoicePositions[:1]
+	issued.InvoicePositions[0].Quantity = issued.InvoicePositions[0].Quantity.Mul(issued.InvoicePositions[0].Quantity)
+	if err := store.UpdateInvoice(issued, fixtures.DefaultOwnerID); !errors.Is(err, model.ErrInvoiceNotDraft) {
+		t.Fatalf("UpdateInvoice of issued invoice: err = %v, want ErrInvoiceNotDraft", err)
+	}
+
+	got, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if len(got.InvoicePositions) != 3 {
+		t.Errorf("got %d positions, want the 3 issued ones", len(got.InvoicePositions))
+	}
+	if !got.GrossTotal.Equal(issued.GrossTotal) {
+		t.Errorf("GrossTotal = %s, want %s", got.GrossTotal, issued.GrossTotal)
+	}
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// InvoiceTextData holds the values the opening and closing texts of an
+// invoice may reference, for example "Bitte überweisen Sie bis {{.DueDate}}".
+// Only these plain strings are exposed to the template.
+type InvoiceTextData struct {
+	Company InvoiceTextCompany
+	Invoice InvoiceTextInvoice
+	Date    string // invoice date, shortcut for .Invoice.Date
+	DueDate string // shortcut for .Invoice.DueDate
+	Total   string // shortcut for .Invoice.GrossTotal
+}
+
+// InvoiceTextCompany is the customer part of InvoiceTextData.
+type InvoiceTextCompany struct {
+	Name           string
+	CustomerNumber string
+	ContactInvoice string
+}
+
+// InvoiceTextInvoice is the invoice part of InvoiceTextData. Dates use the
+// German format, amounts the German format with currency code.
+type InvoiceTextInvoice struct {
+	Number         string
+	Date           string
+	DueDate        string
+	OrderNumber    string
+	BuyerReference string
+	Currency       string
+	NetTotal       string
+	GrossTotal     string
+}
+
+// buildInvoiceTextData collects the placeholder values for inv.
+func buildInvoiceTextData(inv *Invoice, company *Company) InvoiceTextData {
+	inr := InvoiceTextInvoice{
+		Number:         inv.Number,
+		Date:           formatDateDE(inv.Date),
+		DueDate:        formatDateDE(inv.DueDate),
+		OrderNumber:    inv.OrderNumber,
+		BuyerReference: inv.BuyerReference,
+		Currency:       inv.Currency,
+		NetTotal:       strings.TrimSpace(formatAmountDE(inv.NetTotal) + " " + inv.Currency),
+		GrossTotal:     strings.TrimSpace(formatAmountDE(inv.GrossTotal) + " " + inv.Currency),
+	}
+	data := InvoiceTextData{
+		Invoice: inr,
+		Date:    inr.Date,
+		DueDate: inr.DueDate,
+		Total:   inr.GrossTotal,
+	}
+	if company != nil {
+		data.Company = InvoiceTextCompany{
+			Name:           company.Name,
+			CustomerNumber: company.CustomerNumber,
+			ContactInvoice: inv.ContactInvoice,
+		}
+	}
+	return data
+}
+
+// maxInvoiceTextGrowth is how many bytes the placeholders may add to an
+// opening or closing text. Rendering stops when the output grows beyond.
+const maxInvoiceTextGrowth = 4 << 10
+
+// errInvoiceTextTooLong aborts the rendering of an invoice text.
+var errInvoiceTextTooLong = errors.New("invoice text too long")
+
+// limitedBuffer is a bytes.Buffer that refuses writes beyond max bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, errInvoiceTextTooLong
+	}
+	return b.Buffer.Write(p)
+}
+
+// renderInvoiceText fills the placeholders in an opening or closing text.
+// Texts without placeholders are returned unchanged; invalid templates and
+// unknown fields fall back to the raw text, so a typo never breaks the
+// invoice. The same holds for texts with {{range}} and for output longer
+// than maxInvoiceTextGrowth beyond the text, which protects the server from
+// texts like {{range 1000000000}}x{{end}}.
+func renderInvoiceText(text string, inv *Invoice, company *Company) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	t, err := template.New("text").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return text
+	}
+	for _, tt := range t.Templates() {
+		if hasRangeNode(tt.Root) {
+			return text
+		}
+	}
+	buf := limitedBuffer{max: len(text) + maxInvoiceTextGrowth}
+	if err := t.Execute(&buf, buildInvoiceTextData(inv, company)); err != nil {
+		return text
+	}
+	return buf.String()
+}
+
+// hasRangeNode reports whether the template tree below n contains a range
+// action.
+func hasRangeNode(n parse.Node) bool {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Nodes {
+			if hasRangeNode(c) {
+				return true
+			}
+		}
+	case *parse.RangeNode:
+		return true
+	case *parse.IfNode:
+		return hasRangeNode(n.List) || hasRangeNode(n.ElseList)
+	case *parse.WithNode:
+		return hasRangeNode(n.List) || hasRangeNode(n.ElseList)
+	}
+	return false
+}
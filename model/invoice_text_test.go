@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRenderInvoiceText(t *testing.T) {
+	inv := &Invoice{
+		Number:     "RE-2025-0042",
+		Date:       time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC),
+		DueDate:    time.Date(2025, 3, 29, 0, 0, 0, 0, time.UTC),
+		Currency:   "EUR",
+		GrossTotal: decimal.RequireFromString("1190"),
+	}
+	company := &Company{Name: "Beispiel GmbH", CustomerNumber: "K-7"}
+
+	testcases := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no placeholders", "Vielen Dank!", "Vielen Dank!"},
+		{"due date", "Bitte überweisen Sie bis {{.DueDate}}.", "Bitte überweisen Sie bis 29.03.2025."},
+		{"nested fields", "{{.Company.Name}} ({{.Company.CustomerNumber}}), Rechnung {{.Invoice.Number}}", "Beispiel GmbH (K-7), Rechnung RE-2025-0042"},
+		{"total", "Betrag: {{.Total}}", "Betrag: 1.190,00 EUR"},
+		{"parse error keeps raw text", "Bis {{.DueDate", "Bis {{.DueDate"},
+		{"unknown field keeps raw text", "Hallo {{.Customer}}", "Hallo {{.Customer}}"},
+		{"no access to the invoice", "{{.Invoice.OwnerID}}", "{{.Invoice.OwnerID}}"},
+		{"range keeps raw text", "{{range 1000000000}}x{{end}}", "{{range 1000000000}}x{{end}}"},
+		{"defined range keeps raw text", `{{define "x"}}{{range 3}}x{{end}}{{end}}{{template "x"}}`, `{{define "x"}}{{range 3}}x{{end}}{{end}}{{template "x"}}`},
+		{"nested range keeps raw text", "{{if .Total}}{{range 3}}x{{end}}{{end}}", "{{if .Total}}{{range 3}}x{{end}}{{end}}"},
+	}
+	for _, tc := range testcases {
+		if got := renderInvoiceText(tc.text, inv, company); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRenderInvoiceText_OutputLimit(t *testing.T) {
+	inv := &Invoice{Number: strings.Repeat("9", 1000)}
+
+	// Each placeholder adds 1000 bytes; eight of them exceed the limit.
+	short := "{{.Invoice.Number}}{{.Invoice.Number}}"
+	if got := renderInvoiceText(short, inv, nil); len(got) != 2000 {
+		t.Errorf("short text: got %d bytes, want 2000", len(got))
+	}
+	long := strings.Repeat("{{.Invoice.Number}}", 8)
+	if got := renderInvoiceText(long, inv, nil); got != long {
+		t.Errorf("long text: got %d bytes, want the raw text", len(got))
+	}
+}
@@ -1,7 +1,14 @@
 package model_test
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/billingcat/crm/fixtures"
 	"github.com/billingcat/crm/model"
@@ -54,6 +61,16 @@ func TestInvoice_RecomputeTotals(t *testing.T) {
 			wantGross:     "2500", // no tax
 			wantTaxCount:  1,
 		},
+		{
+			name: "credit note with negated quantities",
+			positions: []model.InvoicePosition{
+				fixtures.Position(1, "Standard", -2, 100.00, 19),
+				fixtures.Position(2, "Reduced", -1, 50.00, 7),
+			},
+			wantNet:       "-250",
+			wantGross:     "-291.5", // -238 + -53.5
+			wantTaxCount:  2,
+		},
 	}
 
 	for _, tt := range tests {
@@ -76,6 +93,39 @@ func TestInvoice_RecomputeTotals(t *testing.T) {
 	}
 }
 
+func TestInvoice_RecomputeTaxAmounts(t *testing.T) {
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceStatus(model.InvoiceStatusIssued),
+		fixtures.WithInvoicePositions(
+			fixtures.Position(1, "Standard", 1, 100.00, 19),
+			fixtures.Position(2, "Reduced", 1, 100.00, 7),
+		),
+	)
+	// The stored totals of an issued invoice are legally fixed, even if the
+	// positions would sum up differently today.
+	inv.NetTotal = decimal.RequireFromString("199.99")
+	inv.GrossTotal = decimal.RequireFromString("225.99")
+	inv.TaxAmounts = nil
+
+	inv.RecomputeTaxAmounts()
+	if got := inv.NetTotal.String(); got != "199.99" {
+		t.Errorf("NetTotal = %s, want the stored 199.99", got)
+	}
+	if got := inv.GrossTotal.String(); got != "225.99" {
+		t.Errorf("GrossTotal = %s, want the stored 225.99", got)
+	}
+	if len(inv.TaxAmounts) != 2 || !inv.TaxAmounts[0].Amount.Equal(decimal.NewFromInt(7)) || !inv.TaxAmounts[1].Amount.Equal(decimal.NewFromInt(19)) {
+		t.Errorf("TaxAmounts = %+v, want 7 and 19", inv.TaxAmounts)
+	}
+
+	// Drafts are recomputed completely.
+	inv.Status = model.InvoiceStatusDraft
+	inv.RecomputeTaxAmounts()
+	if !inv.NetTotal.Equal(decimal.NewFromInt(200)) || !inv.GrossTotal.Equal(decimal.NewFromInt(226)) {
+		t.Errorf("draft totals = %s / %s, want 200 / 226", inv.NetTotal, inv.GrossTotal)
+	}
+}
+
 func TestInvoice_SaveAndLoad(t *testing.T) {
 	store := fixtures.NewTestStore(t)
 	data := fixtures.SeedTestData(t, store)
@@ -151,3 +201,607 @@ func TestInvoice_StatusTransitions(t *testing.T) {
 		t.Errorf("Status after paid = %q, want %q", loaded.Status, model.InvoiceStatusPaid)
 	}
 }
+
+func TestInvoice_CreditNoteXML(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("GS-001"),
+		fixtures.WithInvoicePositions(fixtures.Position(1, "Service", -1, 100.00, 19)),
+	)
+	inv.DocumentType = model.DocumentTypeCreditNote
+	inv.ReferencedInvoiceNumber = "RE-001"
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if !loaded.IsCreditNote() {
+		t.Fatalf("DocumentType = %q, want %q", loaded.DocumentType, model.DocumentTypeCreditNote)
+	}
+
+	xmlPath := filepath.Join(t.TempDir(), "creditnote.xml")
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	xml := string(b)
+	if !strings.Contains(xml, "<ram:TypeCode>381</ram:TypeCode>") {
+		t.Error("credit note XML should carry type code 381")
+	}
+	if !strings.Contains(xml, "RE-001") {
+		t.Error("credit note XML should reference the original invoice number")
+	}
+}
+
+func TestInvoice_Skonto(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.Position(1, "Service", 1, 100.00, 19)),
+	)
+	inv.SkontoPercent = decimal.NewFromInt(2)
+	inv.SkontoDays = 10
+	inv.RecomputeTotals()
+	if want := decimal.RequireFromString("116.62"); !inv.SkontoAmount.Equal(want) {
+		t.Errorf("SkontoAmount = %s, want %s", inv.SkontoAmount, want)
+	}
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	xmlPath := filepath.Join(t.TempDir(), "skonto.xml")
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	if !strings.Contains(string(b), "#SKONTO#TAGE=10#PROZENT=2.00#") {
+		t.Error("XML should carry the structured Skonto payment terms")
+	}
+
+	// Without a discount the payment terms carry no description.
+	loaded.SkontoPercent = decimal.Zero
+	loaded.SkontoDays = 0
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, _ = os.ReadFile(xmlPath)
+	if strings.Contains(string(b), "#SKONTO#") {
+		t.Error("XML should omit Skonto terms when no discount is set")
+	}
+}
+
+func TestInvoice_LineDiscount(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	pos := fixtures.Position(1, "Beratung", 3, 33.33, 19)
+	pos.DiscountPercent = decimal.NewFromInt(10)
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(pos, fixtures.Position(2, "Material", 1, 10.00, 19)),
+	)
+	inv.RecomputeTotals()
+
+	// 33.33 - 10% = 29.997, rounded to 30.00 per unit
+	if want := decimal.RequireFromString("90"); !inv.InvoicePositions[0].LineTotal.Equal(want) {
+		t.Errorf("LineTotal = %s, want %s", inv.InvoicePositions[0].LineTotal, want)
+	}
+	if want := decimal.RequireFromString("100"); !inv.NetTotal.Equal(want) {
+		t.Errorf("NetTotal = %s, want %s", inv.NetTotal, want)
+	}
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	xmlPath := filepath.Join(t.TempDir(), "discount.xml")
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	xml := string(b)
+	if !strings.Contains(xml, "<ram:AppliedTradeAllowanceCharge>") {
+		t.Error("XML should carry the line discount as AppliedTradeAllowanceCharge")
+	}
+	if !strings.Contains(xml, "<ram:LineTotalAmount>90.00</ram:LineTotalAmount>") {
+		t.Error("XML line total should include the discount")
+	}
+}
+
+func TestInvoice_LineDiscountPriceDecimals(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	settings := fixtures.Settings()
+	settings.PriceDecimals = 4
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	// 1.2345 - 10% = 1.11105, rounded to 1.1111 per unit (1.11 with cents)
+	pos := fixtures.Position(1, "API-Aufrufe", 1000, 1.2345, 19)
+	pos.DiscountPercent = decimal.NewFromInt(10)
+	if got, want := pos.DiscountedNetPrice(4), decimal.RequireFromString("1.1111"); !got.Equal(want) {
+		t.Errorf("DiscountedNetPrice(4) = %s, want %s", got, want)
+	}
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(pos),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if want := decimal.RequireFromString("1111.1"); !loaded.NetTotal.Equal(want) {
+		t.Errorf("NetTotal = %s, want %s", loaded.NetTotal, want)
+	}
+
+	xmlPath := filepath.Join(t.TempDir(), "discount-decimals.xml")
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	xml := string(b)
+	if !strings.Contains(xml, "<ram:ChargeAmount>1.1111</ram:ChargeAmount>") {
+		t.Error("XML discounted net price should have four decimals")
+	}
+	if !strings.Contains(xml, "<ram:LineTotalAmount>1111.10</ram:LineTotalAmount>") {
+		t.Error("XML line total should be 1111.10")
+	}
+}
+
+func TestInvoice_RoundingModeLine(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	settings := fixtures.Settings()
+	settings.RoundingMode = string(model.RoundingModeLine)
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	// Small amounts where per-line rounding differs from rounding per rate:
+	// 10 × 0.10 at 19% (0.019 -> 0.02 per line) and 3 × 0.50 at 7%
+	// (0.035 -> 0.04 per line).
+	var positions []model.InvoicePosition
+	for n := 1; n <= 10; n++ {
+		positions = append(positions, fixtures.Position(n, "Standard", 1, 0.10, 19))
+	}
+	for n := 11; n <= 13; n++ {
+		positions = append(positions, fixtures.Position(n, "Reduced", 1, 0.50, 7))
+	}
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(positions...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if loaded.RoundingMode != model.RoundingModeLine {
+		t.Fatalf("RoundingMode = %q, want %q", loaded.RoundingMode, model.RoundingModeLine)
+	}
+	if want := decimal.RequireFromString("2.82"); !loaded.GrossTotal.Equal(want) {
+		t.Errorf("GrossTotal = %s, want %s", loaded.GrossTotal, want)
+	}
+	wantTax := map[string]string{"7": "0.12", "19": "0.2"}
+	for _, ta := range loaded.TaxAmounts {
+		if want := decimal.RequireFromString(wantTax[ta.Rate.String()]); !ta.Amount.Equal(want) {
+			t.Errorf("tax at %s%% = %s, want %s", ta.Rate, ta.Amount, want)
+		}
+	}
+
+	// The XML must carry the same amounts as the PDF/RecomputeTotals.
+	xmlPath := filepath.Join(t.TempDir(), "rounding.xml")
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	if !strings.Contains(string(b), "<ram:GrandTotalAmount>2.82</ram:GrandTotalAmount>") {
+		t.Error("XML grand total should be 2.82 with line rounding")
+	}
+
+	_, violations, err := store.LoadAndVerifyInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadAndVerifyInvoice failed: %v", err)
+	}
+	for _, v := range violations {
+		if v.Rule == "BR-CO-17" {
+			t.Errorf("unexpected violation %s: %s", v.Rule, v.Text)
+		}
+	}
+
+	// Issued invoices keep their rounding mode when the setting changes.
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	settings.RoundingMode = string(model.RoundingModeTotal)
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if issued.RoundingMode != model.RoundingModeLine {
+		t.Errorf("issued RoundingMode = %q, want %q", issued.RoundingMode, model.RoundingModeLine)
+	}
+	if want := decimal.RequireFromString("2.82"); !issued.GrossTotal.Equal(want) {
+		t.Errorf("issued GrossTotal = %s, want %s", issued.GrossTotal, want)
+	}
+	if err := store.WriteZUGFeRDXML(issued, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	if b, _ = os.ReadFile(xmlPath); !strings.Contains(string(b), "<ram:GrandTotalAmount>2.82</ram:GrandTotalAmount>") {
+		t.Error("XML grand total of the issued invoice should stay 2.82")
+	}
+	rows, err := store.TaxReport(fixtures.DefaultOwnerID, issued.Date.AddDate(0, 0, -1), issued.Date.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("TaxReport failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("tax report has %d rows, want 2", len(rows))
+	}
+	for _, row := range rows {
+		if want := decimal.RequireFromString(wantTax[row.Rate.String()]); !row.Tax.Equal(want) {
+			t.Errorf("tax report at %s%% = %s, want %s", row.Rate, row.Tax, want)
+		}
+	}
+}
+
+func TestInvoice_PriceDecimals(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	settings := fixtures.Settings()
+	settings.PriceDecimals = 4
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	// 100000 × 0.0125: cents would turn the unit price into 0.01.
+	pos := fixtures.Position(1, "API-Aufrufe", 100000, 0.0125, 19)
+	if got, want := pos.DiscountedLineTotal(2), decimal.RequireFromString("1000"); !got.Equal(want) {
+		t.Errorf("DiscountedLineTotal(2) = %s, want %s", got, want)
+	}
+	pos.LineTotal = pos.DiscountedLineTotal(4)
+	if want := decimal.RequireFromString("1250"); !pos.LineTotal.Equal(want) {
+		t.Fatalf("DiscountedLineTotal(4) = %s, want %s", pos.LineTotal, want)
+	}
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(pos),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if loaded.PriceDecimals != 4 {
+		t.Errorf("PriceDecimals = %d, want 4", loaded.PriceDecimals)
+	}
+	if want := decimal.RequireFromString("1250"); !loaded.NetTotal.Equal(want) {
+		t.Errorf("NetTotal = %s, want %s", loaded.NetTotal, want)
+	}
+
+	xmlPath := filepath.Join(t.TempDir(), "decimals.xml")
+	if err := store.WriteZUGFeRDXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	xml := string(b)
+	if !strings.Contains(xml, "<ram:ChargeAmount>0.0125</ram:ChargeAmount>") {
+		t.Error("XML net price should have four decimals")
+	}
+	if !strings.Contains(xml, "<ram:LineTotalAmount>1250.00</ram:LineTotalAmount>") {
+		t.Error("XML line total should be 1250.00")
+	}
+
+	// Issued invoices keep their precision when the setting changes.
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	settings.PriceDecimals = 2
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if issued.PriceDecimals != 4 {
+		t.Errorf("issued PriceDecimals = %d, want 4", issued.PriceDecimals)
+	}
+	if err := store.WriteZUGFeRDXML(issued, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	if b, _ = os.ReadFile(xmlPath); !strings.Contains(string(b), "<ram:ChargeAmount>0.0125</ram:ChargeAmount>") {
+		t.Error("XML of the issued invoice should keep four decimals")
+	}
+}
+
+func TestComputeDueDate(t *testing.T) {
+	date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		company  *model.Company
+		settings *model.Settings
+		want     time.Time
+	}{
+		{"default", &model.Company{}, &model.Settings{}, date.AddDate(0, 0, 14)},
+		{"nil", nil, nil, date.AddDate(0, 0, 14)},
+		{"settings", &model.Company{}, &model.Settings{DefaultPaymentTermDays: 30}, date.AddDate(0, 0, 30)},
+		{"company overrides", &model.Company{DefaultPaymentTermDays: 7}, &model.Settings{DefaultPaymentTermDays: 30}, date.AddDate(0, 0, 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := model.ComputeDueDate(date, tt.company, tt.settings); !got.Equal(tt.want) {
+				t.Errorf("ComputeDueDate = %s, want %s", got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestFindInvoices_Search(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	for _, num := range []string{"RE-2025-0100", "RE-2025-0101", "GS-2025-0001"} {
+		inv := fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(data.Company.ID),
+			fixtures.WithInvoiceNumber(num),
+		)
+		if num == "GS-2025-0001" {
+			inv.OrderNumber = "Bestellung re-77"
+		}
+		if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   int64
+	}{
+		{"re-2025-010", 2},
+		{"RE-77", 1},
+		{"0001", 2}, // seeded INV-2024-0001 and GS-2025-0001
+		{"50%", 0},
+		{"", 4},
+	}
+	for _, tt := range tests {
+		rows, total, err := store.FindInvoices(fixtures.DefaultOwnerID, nil, nil, tt.search, "date", nil, nil, nil, 1, 0, "id asc")
+		if err != nil {
+			t.Fatalf("FindInvoices(%q) failed: %v", tt.search, err)
+		}
+		if total != tt.want {
+			t.Errorf("FindInvoices(%q) total = %d, want %d", tt.search, total, tt.want)
+		}
+		if tt.want > 0 && len(rows) != 1 {
+			t.Errorf("FindInvoices(%q) returned %d rows, want 1 (page size)", tt.search, len(rows))
+		}
+	}
+}
+
+func TestIssueInvoice_ConcurrentCounter(t *testing.T) {
+	store := fixtures.NewFileTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	if err := store.SaveSettings(fixtures.Settings(fixtures.WithSettingsNumberTemplate("RE-%04C%"))); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	// Both drafts were written at the same time and suggest the same counter.
+	invoices := make([]*model.Invoice, 4)
+	for i := range invoices {
+		invoices[i] = fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(data.Company.ID),
+			fixtures.WithInvoiceNumber("RE-0001"),
+		)
+		if err := store.SaveInvoice(invoices[i], fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("SaveInvoice #%d failed: %v", i, err)
+		}
+	}
+	errs := make([]error, len(invoices))
+	var wg sync.WaitGroup
+	for i := range invoices {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.MarkInvoiceIssued(invoices[i].ID, fixtures.DefaultOwnerID, time.Now())
+		}(i)
+	}
+	wg.Wait()
+
+	counters := map[uint]bool{}
+	numbers := map[string]bool{}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("MarkInvoiceIssued #%d failed: %v", i, err)
+		}
+		inv, err := store.LoadInvoice(invoices[i].ID, fixtures.DefaultOwnerID)
+		if err != nil {
+			t.Fatalf("LoadInvoice failed: %v", err)
+		}
+		if counters[inv.Counter] {
+			t.Errorf("counter %d allocated twice", inv.Counter)
+		}
+		if numbers[inv.Number] {
+			t.Errorf("number %q allocated twice", inv.Number)
+		}
+		counters[inv.Counter], numbers[inv.Number] = true, true
+		if want := model.FormatInvoiceNumber("RE-%04C%", "", int(inv.Counter), inv.Date); inv.Number != want {
+			t.Errorf("Number = %q, want %q", inv.Number, want)
+		}
+	}
+	for c := uint(1); c <= uint(len(invoices)); c++ {
+		if !counters[c] {
+			t.Errorf("counter %d missing, got %v", c, counters)
+		}
+	}
+}
+
+func TestIssueInvoice_DeletedDraftLeavesNoGap(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	if err := store.SaveSettings(fixtures.Settings(fixtures.WithSettingsNumberTemplate("RE-%04C%"))); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	// The seeded draft is deleted without ever being issued.
+	if err := store.DeleteInvoice(data.Invoice, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("DeleteInvoice failed: %v", err)
+	}
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-0002"),
+	)
+	inv.Counter = 2
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if issued.Counter != 1 || issued.Number != "RE-0001" {
+		t.Errorf("issued invoice = %q/%d, want RE-0001/1", issued.Number, issued.Counter)
+	}
+
+	// Reverting to draft and issuing again keeps the number.
+	if err := store.MarkInvoiceDraft(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceDraft failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if again, _ := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID); again.Counter != 1 || again.Number != "RE-0001" {
+		t.Errorf("reissued invoice = %q/%d, want RE-0001/1", again.Number, again.Counter)
+	}
+}
+
+func TestSaveInvoice_KeepsManualNumber(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	if err := store.SaveSettings(fixtures.Settings(fixtures.WithSettingsNumberTemplate("RE-%04C%"))); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("SONDER-1"),
+	)
+	inv.Counter = 2
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	issued, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if issued.Number != "SONDER-1" {
+		t.Errorf("Number = %q, want manually entered SONDER-1", issued.Number)
+	}
+}
+
+func TestStreamInvoices(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	// More than one batch, plus the seeded invoice.
+	const n = 520
+	for i := 0; i < n; i++ {
+		inv := fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(data.Company.ID),
+			fixtures.WithInvoiceNumber(fmt.Sprintf("ST-%04d", i)),
+		)
+		if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+	}
+
+	var got []string
+	err := store.StreamInvoices(fixtures.DefaultOwnerID, model.InvoiceFilters{Search: "ST-", Order: "number desc, id desc"}, func(inv model.Invoice) error {
+		got = append(got, inv.Number)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamInvoices failed: %v", err)
+	}
+	if len(got) != n {
+		t.Fatalf("StreamInvoices returned %d invoices, want %d", len(got), n)
+	}
+	for i, num := range got {
+		if want := fmt.Sprintf("ST-%04d", n-1-i); num != want {
+			t.Fatalf("invoice %d = %s, want %s", i, num, want)
+		}
+	}
+
+	// An error from the callback stops the iteration.
+	stop := errors.New("stop")
+	calls := 0
+	err = store.StreamInvoices(fixtures.DefaultOwnerID, model.InvoiceFilters{}, func(model.Invoice) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("StreamInvoices after error: err = %v, calls = %d", err, calls)
+	}
+
+	// Other owners see nothing.
+	err = store.StreamInvoices(fixtures.DefaultOwnerID+1, model.InvoiceFilters{}, func(model.Invoice) error {
+		t.Error("callback called for foreign owner")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("StreamInvoices failed: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InvoiceTrashRetention is how long deleted invoices stay in the trash before
+// the maintenance run removes them for good.
+const InvoiceTrashRetention = 30 * 24 * time.Hour
+
+// ListDeletedInvoices returns the owner's invoices in the trash, most recently
+// deleted first.
+func (s *Store) ListDeletedInvoices(ownerID uint) ([]Invoice, error) {
+	var invs []Invoice
+	err := s.db.Unscoped().
+		Preload("Company", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).
+		Order("deleted_at DESC").
+		Find(&invs).Error
+	return invs, err
+}
+
+// RestoreInvoice takes an invoice out of the trash. A new invoice may have
+// been given the same number by hand in the meantime; in that case a restored
+// invoice that already had a counter gets the next one. A draft without a
+// counter gets one when it is issued. Its time entries are billed again
+// unless they went into another invoice.
+func (s *Store) RestoreInvoice(id, ownerID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var inv Invoice
+		if err := tx.Unscoped().Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", id, ownerID).
+			First(&inv).Error; err != nil {
+			return loadInvoiceError(id, err)
+		}
+
+		var taken int64
+		if err := tx.Model(&Invoice{}).
+			Where("owner_id = ? AND number = ?", ownerID, inv.Number).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		updates := map[string]any{"deleted_at": nil}
+		if taken > 0 && inv.CounterAllocated {
+			if err := s.allocateInvoiceCounter(tx, &inv, ownerID); err != nil {
+				return fmt.Errorf("allocate invoice counter: %w", err)
+			}
+			updates["counter"] = inv.Counter
+			updates["number"] = inv.Number
+		}
+		if err := tx.Unscoped().Model(&Invoice{}).Where("id = ? AND owner_id = ?", id, ownerID).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := rebillTimeEntries(tx, ownerID, id); err != nil {
+			return err
+		}
+		return s.recordInvoiceEvent(tx, inv.ID, ownerID, InvoiceEventRestored, "")
+	})
+}
+
+// purgeInvoiceTrash permanently removes invoices that have been in the trash
+// for longer than olderThan, together with everything that belongs to them:
+// positions, attachments, validation results, delivery notes, payments,
+// webhook deliveries and the generated files (XML, PDF, reminders, delivery
+// notes). Time entries billed with them lose the reference and stay unbilled.
+// The change history is append-only and kept.
+func purgeInvoiceTrash(ctx context.Context, s *Store, olderThan time.Duration) error {
+	db := s.db.WithContext(ctx)
+	var invs []Invoice
+	if err := db.Unscoped().Select("id", "owner_id").
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-olderThan)).
+		Find(&invs).Error; err != nil {
+		return err
+	}
+	if len(invs) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(invs))
+	for i, inv := range invs {
+		ids[i] = inv.ID
+	}
+
+	var atts []InvoiceAttachment
+	if err := db.Where("invoice_id IN ?", ids).Find(&atts).Error; err != nil {
+		return err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, dep := range []any{
+			&InvoiceAttachment{}, &InvoicePosition{}, &InvoiceValidation{},
+			&DeliveryNote{}, &Payment{}, &WebhookDelivery{},
+		} {
+			if err := tx.Where("invoice_id IN ?", ids).Delete(dep).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&TimeEntry{}).Where("invoice_id IN ?", ids).
+			Updates(map[string]any{"billed": false, "invoice_id": nil, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&Invoice{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range atts {
+		if err := os.Remove(a.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	for _, inv := range invs {
+		if err := s.removeInvoiceFiles(inv.ID, inv.OwnerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeInvoiceFiles deletes the files generated for an invoice. They are
+// named after the invoice ID in the owner's directory below Config.XMLDir:
+// "<id>.xml", "<id>.pdf" and "<id>-<variant>.<ext>".
+func (s *Store) removeInvoiceFiles(invoiceID, ownerID uint) error {
+	if s.Config.XMLDir == "" {
+		return nil
+	}
+	dir := filepath.Join(s.Config.XMLDir, fmt.Sprintf("owner%d", ownerID))
+	for _, pattern := range []string{"%d.*", "%d-*"} {
+		files, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf(pattern, invoiceID)))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
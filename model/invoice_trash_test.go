@@ -0,0 +1,259 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func TestDeleteInvoice_SoftDeleteAndRestore(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	inv := data.Invoice
+
+	if err := store.DeleteInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("DeleteInvoice failed: %v", err)
+	}
+	if _, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID); !errors.Is(err, model.ErrInvoiceNotFound) {
+		t.Errorf("LoadInvoice after delete: err = %v, want ErrInvoiceNotFound", err)
+	}
+	_, total, err := store.FindInvoices(fixtures.DefaultOwnerID, nil, nil, "", "date", nil, nil, nil, 10, 0, "id asc")
+	if err != nil {
+		t.Fatalf("FindInvoices failed: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("FindInvoices total = %d, want 0", total)
+	}
+	if max, _ := store.GetMaxCounter(data.Company.ID, false, fixtures.DefaultOwnerID); max != 0 {
+		t.Errorf("GetMaxCounter = %d, want 0", max)
+	}
+
+	trash, err := store.ListDeletedInvoices(fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("ListDeletedInvoices failed: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != inv.ID {
+		t.Fatalf("trash = %v, want invoice %d", trash, inv.ID)
+	}
+	if other, _ := store.ListDeletedInvoices(fixtures.DefaultOwnerID + 1); len(other) != 0 {
+		t.Errorf("other owner sees %d invoices in the trash", len(other))
+	}
+	if err := store.RestoreInvoice(inv.ID, fixtures.DefaultOwnerID+1); !errors.Is(err, model.ErrInvoiceNotFound) {
+		t.Errorf("RestoreInvoice by other owner: err = %v, want ErrInvoiceNotFound", err)
+	}
+
+	if err := store.RestoreInvoice(inv.ID, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("RestoreInvoice failed: %v", err)
+	}
+	restored, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice after restore failed: %v", err)
+	}
+	if len(restored.InvoicePositions) != len(fixtures.SamplePositions()) {
+		t.Errorf("positions after restore = %d, want %d", len(restored.InvoicePositions), len(fixtures.SamplePositions()))
+	}
+	if restored.Number != inv.Number {
+		t.Errorf("Number = %q, want %q", restored.Number, inv.Number)
+	}
+}
+
+func TestRestoreInvoice_NumberTaken(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	if err := store.SaveSettings(fixtures.Settings(fixtures.WithSettingsNumberTemplate("RE-%04C%"))); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	first := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber(""))
+	if err := store.SaveInvoice(first, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(first.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	first, err := store.LoadInvoice(first.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if err := store.DeleteInvoice(first, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("DeleteInvoice failed: %v", err)
+	}
+
+	// The number of the deleted invoice is entered by hand for a new one.
+	second := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber(first.Number))
+	second.Counter = 7
+	if err := store.SaveInvoice(second, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(second.ID, fixtures.DefaultOwnerID, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if second, err = store.LoadInvoice(second.ID, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if second.Number != first.Number {
+		t.Fatalf("second.Number = %q, want manual %q", second.Number, first.Number)
+	}
+
+	if err := store.RestoreInvoice(first.ID, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("RestoreInvoice failed: %v", err)
+	}
+	restored, err := store.LoadInvoice(first.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if restored.Number == second.Number || restored.Counter == second.Counter {
+		t.Errorf("restored invoice %q/%d collides with %q/%d", restored.Number, restored.Counter, second.Number, second.Counter)
+	}
+}
+
+func TestDeleteInvoice_OtherOwner(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	inv := data.Invoice
+
+	if err := store.DeleteInvoice(inv, fixtures.DefaultOwnerID+1); !errors.Is(err, model.ErrInvoiceNotFound) {
+		t.Fatalf("DeleteInvoice by other owner: err = %v, want ErrInvoiceNotFound", err)
+	}
+	kept, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("invoice gone after foreign delete: %v", err)
+	}
+	if len(kept.InvoicePositions) != len(fixtures.SamplePositions()) {
+		t.Errorf("positions = %d, want %d", len(kept.InvoicePositions), len(fixtures.SamplePositions()))
+	}
+	if trash, _ := store.ListDeletedInvoices(fixtures.DefaultOwnerID); len(trash) != 0 {
+		t.Errorf("trash = %d invoices, want none", len(trash))
+	}
+}
+
+func TestDeleteDraftInvoicesForCompany(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // data.Invoice is a draft
+	owner := fixtures.DefaultOwnerID
+
+	draft := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber("D-2"))
+	issued := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber("R-1"),
+		fixtures.WithInvoiceStatus(model.InvoiceStatusIssued))
+	other := fixtures.Company(fixtures.WithCompanyName("Andere GmbH"))
+	if err := store.SaveCompany(other, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	otherDraft := fixtures.Invoice(fixtures.WithInvoiceCompanyID(other.ID), fixtures.WithInvoiceNumber("D-3"))
+	for _, inv := range []*model.Invoice{draft, issued, otherDraft} {
+		if err := store.SaveInvoice(inv, owner); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+	}
+
+	if n, err := store.DeleteDraftInvoicesForCompany(owner+1, data.Company.ID); err != nil || n != 0 {
+		t.Errorf("delete by other owner = %d, %v; want 0", n, err)
+	}
+
+	n, err := store.DeleteDraftInvoicesForCompany(owner, data.Company.ID)
+	if err != nil {
+		t.Fatalf("DeleteDraftInvoicesForCompany failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d invoices, want 2", n)
+	}
+	for _, inv := range []*model.Invoice{data.Invoice, draft} {
+		if _, err := store.LoadInvoice(inv.ID, owner); !errors.Is(err, model.ErrInvoiceNotFound) {
+			t.Errorf("draft %s: err = %v, want ErrInvoiceNotFound", inv.Number, err)
+		}
+	}
+	for _, inv := range []*model.Invoice{issued, otherDraft} {
+		if _, err := store.LoadInvoice(inv.ID, owner); err != nil {
+			t.Errorf("invoice %s deleted: %v", inv.Number, err)
+		}
+	}
+	if trash, _ := store.ListDeletedInvoices(owner); len(trash) != 2 {
+		t.Errorf("trash = %d invoices, want 2", len(trash))
+	}
+}
+
+func TestPurgeInvoiceTrash_RemovesEverything(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+	store.Config.XMLDir = t.TempDir()
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-PURGE"),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(inv, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, owner, inv.Date); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if _, err := store.AddPayment(inv.ID, owner, decimal.NewFromInt(10), inv.Date, ""); err != nil {
+		t.Fatalf("AddPayment failed: %v", err)
+	}
+	if _, err := store.CreateDeliveryNote(inv, owner, inv.Date, true); err != nil {
+		t.Fatalf("CreateDeliveryNote failed: %v", err)
+	}
+	if err := store.CreateWebhookDeliveryForTest(&model.WebhookDelivery{
+		OwnerID: owner, WebhookID: 1, Event: model.WebhookEventInvoicePaid, InvoiceID: inv.ID,
+		Payload: "{}", Status: model.WebhookDeliveryDelivered,
+	}); err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+	dir := filepath.Join(store.Config.XMLDir, fmt.Sprintf("owner%d", owner))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{filepath.Join(dir, "attachment.pdf")}
+	for _, name := range []string{"%d.xml", "%d.pdf", "%d-plain.pdf", "%d-xrechnung.xml", "%d-deliverynote1.pdf"} {
+		files = append(files, filepath.Join(dir, fmt.Sprintf(name, inv.ID)))
+	}
+	other := filepath.Join(dir, fmt.Sprintf("%d0.pdf", inv.ID))
+	for _, f := range append(files, other) {
+		if err := os.WriteFile(f, []byte("%PDF-1.4"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.AddInvoiceAttachment(&model.InvoiceAttachment{
+		InvoiceID: inv.ID, OwnerID: owner, Filename: "a.pdf", Path: files[0], MIME: "application/pdf", Size: 8,
+	}); err != nil {
+		t.Fatalf("AddInvoiceAttachment failed: %v", err)
+	}
+
+	if err := store.DeleteInvoice(inv, owner); err != nil {
+		t.Fatalf("DeleteInvoice failed: %v", err)
+	}
+	if err := model.PurgeInvoiceTrash(context.Background(), store, -time.Hour); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+
+	counts, err := store.CountInvoiceReferencesForTest(inv.ID)
+	if err != nil {
+		t.Fatalf("CountInvoiceReferencesForTest failed: %v", err)
+	}
+	for table, n := range counts {
+		if n != 0 {
+			t.Errorf("%s: %d rows left for the purged invoice", table, n)
+		}
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s still exists after purge", filepath.Base(f))
+		}
+	}
+	// Files of other invoices stay.
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("file of another invoice removed: %v", err)
+	}
+	if _, err := store.LoadInvoice(data.Invoice.ID, owner); err != nil {
+		t.Errorf("invoice outside the trash: %v", err)
+	}
+}
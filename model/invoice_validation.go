@@ -0,0 +1,83 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/speedata/einvoice"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InvoiceValidation is the result of the last ZUGFeRD/XRechnung check of an
+// invoice. There is at most one row per invoice; LoadAndVerifyInvoice
+// overwrites it. ProblemsJSON holds the []InvoiceProblem found, "[]" if the
+// invoice was valid. Stale is set by LoadInvoiceValidation when the invoice
+// has been changed after the check.
+type InvoiceValidation struct {
+	ID           uint      `gorm:"primaryKey"`
+	InvoiceID    uint      `gorm:"not null;uniqueIndex:idx_invoice_validations_invoice"`
+	OwnerID      uint      `gorm:"not null;index"`
+	ValidatedAt  time.Time `gorm:"not null"`
+	ProblemsJSON string    `gorm:"column:problems_json;type:text;not null"`
+	Stale        bool      `gorm:"-"`
+}
+
+func (InvoiceValidation) TableName() string { return "invoice_validations" }
+
+// Problems decodes ProblemsJSON. A broken value yields no problems.
+func (v *InvoiceValidation) Problems() []InvoiceProblem {
+	var out []InvoiceProblem
+	_ = json.Unmarshal([]byte(v.ProblemsJSON), &out)
+	return out
+}
+
+// invoiceProblemsFromViolations converts the semantic errors of the e-invoice
+// library into InvoiceProblems.
+func invoiceProblemsFromViolations(violations []einvoice.SemanticError) []InvoiceProblem {
+	problems := make([]InvoiceProblem, 0, len(violations))
+	for _, v := range violations {
+		problems = append(problems, InvoiceProblem{
+			Level:   "error",
+			Message: v.Rule + ": " + v.Text,
+		})
+	}
+	return problems
+}
+
+// saveInvoiceValidation stores the result of a validation run, replacing the
+// previous one.
+func (s *Store) saveInvoiceValidation(inv *Invoice, violations []einvoice.SemanticError) error {
+	b, err := json.Marshal(invoiceProblemsFromViolations(violations))
+	if err != nil {
+		return err
+	}
+	v := InvoiceValidation{
+		InvoiceID:    inv.ID,
+		OwnerID:      inv.OwnerID,
+		ValidatedAt:  time.Now(),
+		ProblemsJSON: string(b),
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "invoice_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"validated_at", "problems_json"}),
+	}).Create(&v).Error
+}
+
+// LoadInvoiceValidation returns the stored validation result of the invoice.
+// It does not validate: a result older than the last change of the invoice
+// is returned marked Stale. An invoice that was never validated yields nil
+// without an error.
+func (s *Store) LoadInvoiceValidation(inv *Invoice, ownerID uint) (*InvoiceValidation, error) {
+	var v InvoiceValidation
+	err := s.db.Where("invoice_id = ? AND owner_id = ?", inv.ID, ownerID).First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Stale = inv.UpdatedAt.After(v.ValidatedAt)
+	return &v, nil
+}
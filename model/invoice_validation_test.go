@@ -0,0 +1,156 @@
+package model_test
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestInvoiceValidation_Stored(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	inv, err := store.LoadInvoice(data.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if v, err := store.LoadInvoiceValidation(inv, owner); err != nil || v != nil {
+		t.Fatalf("before any check: got %v, %v; want nil, nil", v, err)
+	}
+
+	_, violations, err := store.LoadAndVerifyInvoice(inv.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadAndVerifyInvoice failed: %v", err)
+	}
+	first, err := store.LoadInvoiceValidation(inv, owner)
+	if err != nil || first == nil {
+		t.Fatalf("LoadInvoiceValidation: got %v, %v", first, err)
+	}
+	if got := len(first.Problems()); got != len(violations) {
+		t.Errorf("stored %d problems, want %d", got, len(violations))
+	}
+
+	if first.Stale {
+		t.Errorf("fresh result marked stale")
+	}
+
+	// Changed invoice: the stored result is returned marked stale, loading
+	// does not validate again.
+	time.Sleep(10 * time.Millisecond)
+	inv.OrderNumber = "PO-1"
+	if err := store.UpdateInvoice(inv, owner); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+	inv, _ = store.LoadInvoice(inv.ID, owner)
+	stale, err := store.LoadInvoiceValidation(inv, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoiceValidation failed: %v", err)
+	}
+	if !stale.Stale || !stale.ValidatedAt.Equal(first.ValidatedAt) {
+		t.Errorf("changed invoice: Stale = %v, ValidatedAt %s (was %s); want the stale result",
+			stale.Stale, stale.ValidatedAt, first.ValidatedAt)
+	}
+
+	// Other owners do not see the result.
+	if v, err := store.LoadInvoiceValidation(inv, owner+1); err != nil || v != nil {
+		t.Errorf("foreign owner: got %v, %v; want nil, nil", v, err)
+	}
+}
+
+func TestVerifyInvoice_BuyerVATID(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	company := fixtures.Company(fixtures.WithCompanyName("Kunde ohne USt-IdNr."), fixtures.WithCompanyVATID(""))
+	if err := store.SaveCompany(company, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	// buyerVATID returns how often the missing buyer VAT ID is reported
+	// under rule and whether the report says where to enter it.
+	buyerVATID := func(taxType, rule string) (int, bool) {
+		t.Helper()
+		inv := fixtures.Invoice(fixtures.WithInvoiceCompanyID(company.ID), fixtures.WithInvoiceNumber("RE-"+taxType),
+			fixtures.WithInvoiceTaxType(taxType), fixtures.WithInvoicePositions(fixtures.ZeroTaxPositions()...))
+		if err := store.SaveInvoice(inv, owner); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		_, violations, err := store.LoadAndVerifyInvoice(inv.ID, owner)
+		if err != nil {
+			t.Fatalf("LoadAndVerifyInvoice failed: %v", err)
+		}
+		n, german := 0, false
+		for _, v := range violations {
+			if v.Rule == rule && slices.Contains(v.InvFields, "BT-48") {
+				n++
+				german = strings.Contains(v.Text, "USt-IdNr.")
+			}
+		}
+		return n, german
+	}
+
+	if n, german := buyerVATID("AE", "BR-AE-2"); n != 1 || !german {
+		t.Errorf("reverse charge invoice without buyer VAT ID: %d problems (German %v), want one German", n, german)
+	}
+	if n, german := buyerVATID("K", "BR-IC-2"); n != 1 || !german {
+		t.Errorf("intra-community invoice without buyer VAT ID: %d problems (German %v), want one German", n, german)
+	}
+
+	company.VATID = "FR12345678901"
+	if err := store.SaveCompany(company, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	if n, _ := buyerVATID("AE", "BR-AE-2"); n != 0 {
+		t.Errorf("buyer VAT ID given: problem still reported %d times", n)
+	}
+}
+
+func TestZUGFeRDProfile(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	for _, tc := range []struct {
+		profile model.ZugferdProfile
+		urn     string
+	}{
+		{"", "urn:cen.eu:en16931:2017</ram:ID>"},
+		{model.ZugferdProfileBasic, "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic</ram:ID>"},
+		{model.ZugferdProfileExtended, "urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended</ram:ID>"},
+	} {
+		inv, err := store.LoadInvoice(data.Invoice.ID, owner)
+		if err != nil {
+			t.Fatalf("LoadInvoice failed: %v", err)
+		}
+		inv.ZugferdProfile = tc.profile
+		if err := store.UpdateInvoice(inv, owner); err != nil {
+			t.Fatalf("UpdateInvoice failed: %v", err)
+		}
+		inv, _, err = store.LoadAndVerifyInvoice(inv.ID, owner)
+		if err != nil {
+			t.Fatalf("%q: LoadAndVerifyInvoice failed: %v", tc.profile, err)
+		}
+		if want := cmp.Or(tc.profile, model.ZugferdProfileEN16931); inv.ZugferdProfile != want {
+			t.Errorf("stored profile = %q, want %q", inv.ZugferdProfile, want)
+		}
+		path := filepath.Join(t.TempDir(), "invoice.xml")
+		if err := store.WriteZUGFeRDXML(inv, owner, path); err != nil {
+			t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tc.urn) {
+			t.Errorf("%q: XML lacks the guideline %s", tc.profile, tc.urn)
+		}
+	}
+}
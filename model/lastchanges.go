@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -17,22 +19,10 @@ type ActivityHead struct {
 	ParentID   *uint       `gorm:"column:parent_id"`   // Only for notes
 }
 
-// GetActivityHeads returns the most recent items across all major entity types
-// (companies, invoices, notes) for a given owner/user, ordered by creation time descending.
-//
-// Internally this uses a SQL UNION to merge multiple tables into a unified feed.
-// This avoids complex ORM joins and is efficient for SQLite (and other simple dialects).
-//
-// Parameters:
-//   - userID: owner/tenant identifier (scopes the query)
-//   - limit:  max number of feed items to return (defaults to 20 if <= 0)
-func (s *Store) GetActivityHeads(userID any, limit int) ([]ActivityHead, error) {
-	if limit <= 0 {
-		limit = 20
-	}
-	var rows []ActivityHead
-
-	raw := `
+// activityHeadQueries holds one SELECT per activity item type. Each yields
+// the columns of ActivityHead for a single owner.
+var activityHeadQueries = map[string]string{
+	"company": `
 SELECT CAST('company' AS text) AS item_type,
        CAST(id AS bigint)      AS item_id,
        created_at,
@@ -40,34 +30,79 @@ SELECT CAST('company' AS text) AS item_type,
        CAST(NULL AS text)      AS parent_type,
        CAST(NULL AS bigint)    AS parent_id
 FROM companies
-WHERE owner_id = ?
-
-UNION ALL
+WHERE owner_id = ? AND deleted_at IS NULL`,
 
+	"invoice": `
 SELECT CAST('invoice' AS text) AS item_type,
        CAST(id AS bigint)      AS item_id,
        created_at,
-       CAST(company_id AS bigint),
+       CAST(company_id AS bigint) AS company_id,
        CAST(NULL AS text)      AS parent_type,
        CAST(NULL AS bigint)    AS parent_id
 FROM invoices
-WHERE owner_id = ?
-
-UNION ALL
+WHERE owner_id = ? AND deleted_at IS NULL`,
 
+	"note": `
 SELECT CAST('note' AS text)    AS item_type,
        CAST(id AS bigint)      AS item_id,
        created_at,
        CAST(NULL AS bigint)    AS company_id,
-       CAST(parent_type AS text),
-       CAST(parent_id AS bigint)
+       CAST(parent_type AS text) AS parent_type,
+       CAST(parent_id AS bigint) AS parent_id
 FROM notes
-WHERE owner_id = ?
+WHERE owner_id = ? AND deleted_at IS NULL`,
+}
+
+// ActivityItemTypes lists the item types of the activity feed in display
+// order.
+var ActivityItemTypes = []string{"company", "invoice", "note"}
+
+// GetActivityHeads returns the most recent items across all major entity types
+// (companies, invoices, notes) for a given owner/user, ordered by creation time descending.
+// Deleted items are left out.
+//
+// Parameters:
+//   - userID: owner/tenant identifier (scopes the query)
+//   - limit:  max number of feed items to return (defaults to 20 if <= 0)
+func (s *Store) GetActivityHeads(userID any, limit int) ([]ActivityHead, error) {
+	return s.GetActivityHeadsPaged(userID, limit, 0, "")
+}
 
-ORDER BY created_at DESC
-LIMIT ?;`
+// GetActivityHeadsPaged returns a page of the activity feed of the owner:
+// limit items (defaults to 20 if <= 0) after skipping offset items, newest
+// first. itemType restricts the feed to "company", "invoice" or "note"; an
+// empty itemType means all of them.
+//
+// Internally this uses a SQL UNION to merge multiple tables into a unified feed.
+// This avoids complex ORM joins and is efficient for SQLite (and other simple dialects).
+// Each table contributes at most offset+limit rows, so the merged result
+// stays small even for owners with a long history.
+func (s *Store) GetActivityHeadsPaged(ownerID any, limit, offset int, itemType string) ([]ActivityHead, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	types := ActivityItemTypes
+	if itemType != "" {
+		if _, ok := activityHeadQueries[itemType]; !ok {
+			return nil, fmt.Errorf("unknown activity item type %q", itemType)
+		}
+		types = []string{itemType}
+	}
 
-	if err := s.db.Raw(raw, userID, userID, userID, limit).Scan(&rows).Error; err != nil {
+	parts := make([]string, 0, len(types))
+	args := make([]any, 0, 2*len(types)+2)
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("SELECT * FROM (%s\nORDER BY created_at DESC, id DESC\nLIMIT ?) AS %s_heads", activityHeadQueries[t], t))
+		args = append(args, ownerID, offset+limit)
+	}
+	raw := strings.Join(parts, "\n\nUNION ALL\n\n") + "\n\nORDER BY created_at DESC, item_id DESC\nLIMIT ? OFFSET ?;"
+	args = append(args, limit, offset)
+
+	var rows []ActivityHead
+	if err := s.db.Raw(raw, args...).Scan(&rows).Error; err != nil {
 		return nil, err
 	}
 	return rows, nil
@@ -165,7 +200,13 @@ type ActivityHydration struct {
 // This method effectively produces a complete in-memory view of recent activity
 // without issuing a separate SQL query per item.
 func (s *Store) LoadActivity(ownerID any, limit int) (*ActivityHydration, error) {
-	heads, err := s.GetActivityHeads(ownerID, limit)
+	return s.LoadActivityPaged(ownerID, limit, 0, "")
+}
+
+// LoadActivityPaged is LoadActivity for a page of the feed, optionally
+// restricted to one item type; see GetActivityHeadsPaged.
+func (s *Store) LoadActivityPaged(ownerID any, limit, offset int, itemType string) (*ActivityHydration, error) {
+	heads, err := s.GetActivityHeadsPaged(ownerID, limit, offset, itemType)
 	if err != nil {
 		return nil, err
 	}
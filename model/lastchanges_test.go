@@ -0,0 +1,84 @@
+package model_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+)
+
+func TestLoadActivityPaged(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	for i := 0; i < 5; i++ {
+		note := fixtures.NoteForCompany(data.Company.ID,
+			fixtures.WithNoteTitle(fmt.Sprintf("Notiz %d", i)),
+			fixtures.WithNoteAuthorID(data.User.ID),
+		)
+		if err := store.CreateNote(note); err != nil {
+			t.Fatalf("CreateNote failed: %v", err)
+		}
+	}
+
+	all, err := store.LoadActivity(owner, 100)
+	if err != nil {
+		t.Fatalf("LoadActivity failed: %v", err)
+	}
+	// Seed data: one company and one invoice, plus the five notes.
+	if len(all.Heads) != 7 {
+		t.Fatalf("LoadActivity returned %d heads, want 7", len(all.Heads))
+	}
+
+	seen := map[string]bool{}
+	for offset := 0; ; offset += 3 {
+		page, err := store.LoadActivityPaged(owner, 3, offset, "")
+		if err != nil {
+			t.Fatalf("LoadActivityPaged failed: %v", err)
+		}
+		if len(page.Heads) == 0 {
+			break
+		}
+		for i, h := range page.Heads {
+			key := fmt.Sprintf("%s/%d", h.ItemType, h.ItemID)
+			if seen[key] {
+				t.Errorf("%s listed twice", key)
+			}
+			seen[key] = true
+			if want := all.Heads[offset+i]; want.ItemType != h.ItemType || want.ItemID != h.ItemID {
+				t.Errorf("offset %d: got %s, want %s/%d", offset+i, key, want.ItemType, want.ItemID)
+			}
+		}
+		if _, ok := page.Companies[data.Company.ID]; !ok && len(page.Heads) > 0 {
+			t.Errorf("offset %d: company of the notes not hydrated", offset)
+		}
+	}
+	if len(seen) != 7 {
+		t.Errorf("paging yielded %d heads, want 7", len(seen))
+	}
+
+	notes, err := store.LoadActivityPaged(owner, 10, 1, "note")
+	if err != nil {
+		t.Fatalf("LoadActivityPaged(note) failed: %v", err)
+	}
+	if len(notes.Heads) != 4 || len(notes.Notes) != 4 {
+		t.Errorf("note feed from offset 1: %d heads, %d notes, want 4", len(notes.Heads), len(notes.Notes))
+	}
+	for _, h := range notes.Heads {
+		if h.ItemType != "note" {
+			t.Errorf("filtered feed contains %s", h.ItemType)
+		}
+	}
+	invoices, err := store.LoadActivityPaged(owner, 10, 0, "invoice")
+	if err != nil {
+		t.Fatalf("LoadActivityPaged(invoice) failed: %v", err)
+	}
+	if len(invoices.Heads) != 1 || invoices.Heads[0].CompanyID == nil || *invoices.Heads[0].CompanyID != data.Company.ID {
+		t.Errorf("invoice feed = %+v, want the seeded invoice with its company", invoices.Heads)
+	}
+
+	if _, err := store.LoadActivityPaged(owner, 10, 0, "person"); err == nil {
+		t.Errorf("expected error for unknown item type")
+	}
+}
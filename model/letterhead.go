@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -16,6 +17,8 @@ const (
 	FieldSender      FieldKind = "addressee"    // "Recipient"
 	FieldInvoiceInfo FieldKind = "invoice_info" // "Rechnungsangaben"
 	FieldPositions   FieldKind = "main_area"    // table area (may have page 2 coords)
+	// Optional: only templates that have this region print the GiroCode.
+	FieldPaymentQR FieldKind = "payment_qr"
 )
 
 // LetterheadTemplate represents a letterhead (1–2 pages) with optional predefined regions.
@@ -121,9 +124,10 @@ func (s *Store) LoadLetterheadTemplateAnyOwner(id uint) (*LetterheadTemplate, er
 	return &t, nil
 }
 
-// Optional Convenience: kapselt die Zugriffspolitik
-func (s *Store) LoadLetterheadTemplateForAccess(id, ownerID uint, isAdmin bool) (*LetterheadTemplate, error) {
-	if isAdmin {
+// Optional Convenience: kapselt die Zugriffspolitik. Admins (RoleAdmin)
+// dürfen Vorlagen aller Owner laden.
+func (s *Store) LoadLetterheadTemplateForAccess(id, ownerID uint, role string) (*LetterheadTemplate, error) {
+	if role == RoleAdmin {
 		return s.LoadLetterheadTemplateAnyOwner(id)
 	}
 	return s.LoadLetterheadTemplate(id, ownerID)
@@ -194,8 +198,39 @@ func (s *Store) EnsureDefaultLetterheadRegions(templateID, ownerID uint, pageWid
 	})
 }
 
+// ErrRegionOutOfBounds is returned when a letterhead region does not fit on
+// the page.
+var ErrRegionOutOfBounds = errors.New("region outside the page")
+
+// checkRegionBounds reports the regions that reach beyond a page of pageW x
+// pageH cm, including the page 2 rectangle of the positions area. The
+// returned error wraps ErrRegionOutOfBounds and lists the region kinds.
+func checkRegionBounds(regions []PlacedRegion, pageW, pageH float64) error {
+	const eps = 0.01 // rounding of the editor
+	fits := func(x, y, w, h float64) bool {
+		return x >= -eps && y >= -eps && x+w <= pageW+eps && y+h <= pageH+eps
+	}
+	var bad []string
+	for _, r := range regions {
+		if !fits(r.XCm, r.YCm, r.WidthCm, r.HeightCm) {
+			bad = append(bad, string(r.Kind))
+		}
+		if r.Kind == FieldPositions && r.HasPage2 && !fits(r.X2Cm, r.Y2Cm, r.Width2Cm, r.Height2Cm) {
+			bad = append(bad, string(r.Kind)+" (page 2)")
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%w (%gx%g cm): %s", ErrRegionOutOfBounds, pageW, pageH, strings.Join(bad, ", "))
+	}
+	return nil
+}
+
 // UpdateLetterheadRegionsAndFonts speichert Regions und zusätzlich
 // Template-Meta (Fonts + Page-Size) atomar in einer Transaktion.
+// The optional payment_qr region is removed when regions does not contain it;
+// the fixed regions are never removed. Regions must lie within the page
+// (pageW x pageH, or the stored page size when 0), otherwise an error
+// wrapping ErrRegionOutOfBounds is returned and nothing is saved.
 func (s *Store) UpdateLetterheadRegionsAndFonts(
 	templateID, ownerID uint,
 	regions []PlacedRegion,
@@ -203,17 +238,37 @@ func (s *Store) UpdateLetterheadRegionsAndFonts(
 	pageW, pageH float64,
 ) error {
 	allowed := map[FieldKind]bool{
-		FieldSender: true, FieldInvoiceInfo: true, FieldPositions: true,
+		FieldSender: true, FieldInvoiceInfo: true, FieldPositions: true, FieldPaymentQR: true,
 	}
 
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		var tpl LetterheadTemplate
-		if err := tx.Select("id, owner_id").
+		if err := tx.Select("id, owner_id, page_width_cm, page_height_cm").
 			Where("id = ? AND owner_id = ?", templateID, ownerID).
 			First(&tpl).Error; err != nil {
 			return err
 		}
 
+		boundsW, boundsH := tpl.PageWidthCm, tpl.PageHeightCm
+		if pageW > 0 {
+			boundsW = pageW
+		}
+		if pageH > 0 {
+			boundsH = pageH
+		}
+		if boundsW <= 0 || boundsH <= 0 {
+			boundsW, boundsH = 21.0, 29.7 // A4, as in renderLetterheadPages
+		}
+		var checked []PlacedRegion
+		for _, in := range regions {
+			if allowed[in.Kind] {
+				checked = append(checked, in)
+			}
+		}
+		if err := checkRegionBounds(checked, boundsW, boundsH); err != nil {
+			return err
+		}
+
 		meta := map[string]any{}
 		if pageW > 0 {
 			meta["page_width_cm"] = pageW
@@ -245,10 +300,14 @@ func (s *Store) UpdateLetterheadRegionsAndFonts(
 			curByKind[r.Kind] = r
 		}
 
+		wantQR := false
 		for _, in := range regions {
 			if !allowed[in.Kind] {
 				continue
 			}
+			if in.Kind == FieldPaymentQR {
+				wantQR = true
+			}
 			if ex, ok := curByKind[in.Kind]; ok {
 				// Update allowed fields
 				ex.Page = 1
@@ -287,6 +346,11 @@ func (s *Store) UpdateLetterheadRegionsAndFonts(
 				}
 			}
 		}
+		if ex, ok := curByKind[FieldPaymentQR]; ok && !wantQR {
+			if err := tx.Delete(ex).Error; err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
@@ -0,0 +1,66 @@
+package model_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestUpdateLetterheadRegions_Bounds(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+	tpl := fixtures.SeedLetterheadTemplate(t, store, "")
+
+	main := model.PlacedRegion{
+		Kind: model.FieldPositions,
+		XCm:  2, YCm: 10, WidthCm: 17, HeightCm: 15,
+		HasPage2: true,
+		X2Cm:     1, Y2Cm: 4, Width2Cm: 19, Height2Cm: 23,
+	}
+	tests := []struct {
+		name    string
+		region  model.PlacedRegion
+		pageW   float64
+		wantErr string
+	}{
+		{"fits", main, 0, ""},
+		{"too wide", func() model.PlacedRegion { r := main; r.WidthCm = 19.5; return r }(), 0, "main_area"},
+		{"negative", func() model.PlacedRegion { r := main; r.YCm = -1; return r }(), 0, "main_area"},
+		{"page 2 too high", func() model.PlacedRegion { r := main; r.Height2Cm = 26; return r }(), 0, "main_area (page 2)"},
+		{"page 2 ignored", func() model.PlacedRegion { r := main; r.HasPage2 = false; r.Height2Cm = 26; return r }(), 0, ""},
+		{"narrower page", main, 18, "main_area, main_area (page 2)"},
+		{"qr code", model.PlacedRegion{Kind: model.FieldPaymentQR, XCm: 19, YCm: 24, WidthCm: 3, HeightCm: 3}, 0, "payment_qr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.UpdateLetterheadRegionsAndFonts(tpl.ID, owner, []model.PlacedRegion{tt.region}, nil, tt.pageW, 0)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("UpdateLetterheadRegionsAndFonts failed: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, model.ErrRegionOutOfBounds) || !strings.HasSuffix(err.Error(), ": "+tt.wantErr) {
+				t.Fatalf("error = %v, want out of bounds for %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Rejected updates leave the template untouched.
+	reloaded, err := store.LoadLetterheadTemplate(tpl.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadLetterheadTemplate failed: %v", err)
+	}
+	if reloaded.PageWidthCm != 21 {
+		t.Errorf("PageWidthCm = %g, want 21", reloaded.PageWidthCm)
+	}
+	for _, r := range reloaded.Regions {
+		if r.Kind == model.FieldPositions && (r.WidthCm != 17 || r.YCm != 10) {
+			t.Errorf("main_area changed by a rejected update: %+v", r)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// LoginEventRetention is how long login events are kept.
+const LoginEventRetention = 365 * 24 * time.Hour
+
+// LoginEvent records a login attempt. Failed attempts for unknown addresses
+// have no UserID and OwnerID; Email always holds the address that was
+// entered. Passwords are never recorded.
+type LoginEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index;not null"`
+	UserID    uint      `gorm:"not null;index"`
+	OwnerID   uint      `gorm:"not null"`
+	Email     string    `gorm:"type:text;not null"`
+	IP        string    `gorm:"type:text;not null"`
+	UserAgent string    `gorm:"type:text;not null"`
+	Success   bool      `gorm:"not null"`
+}
+
+func (LoginEvent) TableName() string { return "login_events" }
+
+// RecordLoginEvent stores ev. Overlong emails and user agents are cut so
+// that a client cannot fill the table with arbitrary data.
+func (s *Store) RecordLoginEvent(ev *LoginEvent) error {
+	ev.Email = truncateRunes(ev.Email, 254)
+	ev.UserAgent = truncateRunes(ev.UserAgent, 512)
+	ev.IP = truncateRunes(ev.IP, 64)
+	return s.db.Create(ev).Error
+}
+
+// ListLoginEvents returns the latest limit login events of the user, newest
+// first.
+func (s *Store) ListLoginEvents(userID uint, limit int) ([]LoginEvent, error) {
+	var events []LoginEvent
+	err := s.db.Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// pruneLoginEvents deletes login events older than retention.
+func pruneLoginEvents(ctx context.Context, s *Store, retention time.Duration) error {
+	return s.db.WithContext(ctx).
+		Exec(`DELETE FROM login_events WHERE created_at < ?`, time.Now().Add(-retention)).
+		Error
+}
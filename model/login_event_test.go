@@ -0,0 +1,33 @@
+package model_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestLoginEventsPruned(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	old := &model.LoginEvent{CreatedAt: time.Now().Add(-model.LoginEventRetention - time.Hour), UserID: data.User.ID, Success: true}
+	recent := &model.LoginEvent{CreatedAt: time.Now().Add(-24 * time.Hour), UserID: data.User.ID, Success: true}
+	for _, ev := range []*model.LoginEvent{old, recent} {
+		if err := store.RecordLoginEvent(ev); err != nil {
+			t.Fatalf("RecordLoginEvent failed: %v", err)
+		}
+	}
+	if err := model.RunMaintenance(context.Background(), store); err != nil {
+		t.Fatalf("RunMaintenance failed: %v", err)
+	}
+	events, err := store.ListLoginEvents(data.User.ID, 20)
+	if err != nil {
+		t.Fatalf("ListLoginEvents failed: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != recent.ID {
+		t.Errorf("after pruning: %+v, want only the recent event", events)
+	}
+}
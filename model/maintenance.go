@@ -25,8 +25,8 @@ func RunMaintenance(ctx context.Context, s *Store) error {
 		defer unlock()
 	}
 
-	// 1) Delete API tokens that are either disabled or expired
-	if err := deleteInvalidAPITokens(ctx, s); err != nil {
+	// 1) Delete API tokens that are disabled or expired for 90 days
+	if err := deleteInvalidAPITokens(ctx, s, APITokenExpiredRetention); err != nil {
 		return fmt.Errorf("delete invalid API tokens: %w", err)
 	}
 
@@ -40,12 +40,27 @@ func RunMaintenance(ctx context.Context, s *Store) error {
 		return fmt.Errorf("prune recent views: %w", err)
 	}
 
-	// 4) Run VACUUM/ANALYZE depending on the DB engine
+	// 4) Delete idempotency keys past their retention window
+	if err := deleteExpiredIdempotencyKeys(ctx, s); err != nil {
+		return fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+
+	// 5) Purge invoices that have been in the trash for 30 days
+	if err := purgeInvoiceTrash(ctx, s, InvoiceTrashRetention); err != nil {
+		return fmt.Errorf("purge invoice trash: %w", err)
+	}
+
+	// 6) Prune login events older than a year
+	if err := pruneLoginEvents(ctx, s, LoginEventRetention); err != nil {
+		return fmt.Errorf("prune login events: %w", err)
+	}
+
+	// 7) Run VACUUM/ANALYZE depending on the DB engine
 	if err := vacuumAnalyze(ctx, s); err != nil {
 		return fmt.Errorf("vacuum/analyze: %w", err)
 	}
 
-	// // 5) Delete stale files in XMLDir (older than 30 days)
+	// // 8) Delete stale files in XMLDir (older than 30 days)
 	// _ = pruneTempFiles(s.Config.XMLDir, 30*24*time.Hour)
 
 	log.Printf("maintenance: done in %s", time.Since(start).Truncate(time.Millisecond))
@@ -85,19 +100,22 @@ func tryAcquireLock(ctx context.Context, s *Store) (func(), error) {
 // Maintenance tasks
 // --------------------------------------------------------------------
 
-// deleteInvalidAPITokens removes tokens that are explicitly disabled
-// or past their expiration date.
-func deleteInvalidAPITokens(ctx context.Context, s *Store) error {
+// deleteInvalidAPITokens removes tokens that are explicitly disabled or
+// expired longer than retention ago. Recently expired tokens stay so the
+// profile page can show them as expired.
+func deleteInvalidAPITokens(ctx context.Context, s *Store, retention time.Duration) error {
+	cutoff := time.Now().Add(-retention)
 	return s.db.WithContext(ctx).
-		Exec(`DELETE FROM api_tokens WHERE disabled = TRUE OR (expires_at IS NOT NULL AND expires_at < NOW())`).
+		Exec(`DELETE FROM api_tokens WHERE disabled = TRUE OR (expires_at IS NOT NULL AND expires_at < ?)`, cutoff).
 		Error
 }
 
 // deleteExpiredSignupTokens removes signup tokens that are already expired
-// or have been consumed.
+// or have been consumed. The current time is passed from Go, like the
+// expiry was written, so both are in the same time zone.
 func deleteExpiredSignupTokens(ctx context.Context, s *Store) error {
 	return s.db.WithContext(ctx).
-		Exec(`DELETE FROM signup_tokens WHERE expires_at < NOW() OR consumed_at IS NOT NULL`).
+		Exec(`DELETE FROM signup_tokens WHERE expires_at < ? OR consumed_at IS NOT NULL`, time.Now()).
 		Error
 }
 
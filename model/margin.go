@@ -0,0 +1,83 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// InvoiceMargin returns the net revenue of inv (the sum of its line totals)
+// minus the cost of its positions, see InvoicePosition.CostPrice. Positions
+// without a cost price count as pure margin.
+func InvoiceMargin(inv *Invoice) decimal.Decimal {
+	return invoiceRevenue(inv).Sub(InvoiceCost(inv))
+}
+
+// InvoiceCost returns the summed cost of the positions of inv.
+func InvoiceCost(inv *Invoice) decimal.Decimal {
+	cost := decimal.Zero
+	for i := range inv.InvoicePositions {
+		cost = cost.Add(inv.InvoicePositions[i].LineCost())
+	}
+	return cost
+}
+
+func invoiceRevenue(inv *Invoice) decimal.Decimal {
+	revenue := decimal.Zero
+	for i := range inv.InvoicePositions {
+		revenue = revenue.Add(inv.InvoicePositions[i].LineTotal)
+	}
+	return revenue
+}
+
+// MonthlyMargin holds net revenue, cost and margin of one calendar month.
+type MonthlyMargin struct {
+	Month   time.Month
+	Revenue decimal.Decimal
+	Cost    decimal.Decimal
+	Margin  decimal.Decimal
+}
+
+// MarginPercent returns Margin as a percentage of Revenue, rounded to one
+// decimal. It is zero without revenue.
+func (m MonthlyMargin) MarginPercent() decimal.Decimal {
+	if m.Revenue.IsZero() {
+		return decimal.Zero
+	}
+	return m.Margin.Mul(hundred).Div(m.Revenue).Round(1)
+}
+
+// MarginsByMonth sums net revenue, cost and margin of the owner's issued and
+// paid invoices per month of year, like RevenueByMonth: by invoice date,
+// converted to the base currency, credit notes reduce the sums. The result
+// always has twelve entries, January first.
+func (s *Store) MarginsByMonth(ownerID uint, year int) ([]MonthlyMargin, error) {
+	var invs []Invoice
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	err := s.db.
+		Where("owner_id = ? AND status IN ? AND date >= ? AND date < ?",
+			ownerID, []InvoiceStatus{InvoiceStatusIssued, InvoiceStatusPaid}, start, start.AddDate(1, 0, 0)).
+		Preload("InvoicePositions", "owner_id = ?", ownerID).
+		Find(&invs).Error
+	if err != nil {
+		return nil, fmt.Errorf("margins by month (owner %d, %d): %w", ownerID, year, err)
+	}
+
+	out := make([]MonthlyMargin, 12)
+	for i := range out {
+		out[i] = MonthlyMargin{Month: time.Month(i + 1)}
+	}
+	for i := range invs {
+		inv := &invs[i]
+		m := &out[inv.Date.Month()-1]
+		m.Revenue = m.Revenue.Add(inv.ToBaseCurrency(invoiceRevenue(inv)))
+		m.Cost = m.Cost.Add(inv.ToBaseCurrency(InvoiceCost(inv)))
+	}
+	for i := range out {
+		out[i].Revenue = out[i].Revenue.Round(2)
+		out[i].Cost = out[i].Cost.Round(2)
+		out[i].Margin = out[i].Revenue.Sub(out[i].Cost)
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func TestInvoiceMargin(t *testing.T) {
+	dev := fixtures.Position(1, "Software Development", 8, 120.00, 19)
+	dev.CostPrice = decimal.RequireFromString("87.65")
+	inv := fixtures.Invoice(fixtures.WithInvoicePositions(dev, fixtures.Position(2, "Project Management", 2, 100.00, 19)))
+
+	// revenue 960 + 200, cost 8 × 87.65 = 701.20
+	if got, want := model.InvoiceCost(inv), decimal.RequireFromString("701.2"); !got.Equal(want) {
+		t.Errorf("InvoiceCost = %s, want %s", got, want)
+	}
+	if got, want := model.InvoiceMargin(inv), decimal.RequireFromString("458.8"); !got.Equal(want) {
+		t.Errorf("InvoiceMargin = %s, want %s", got, want)
+	}
+}
+
+func TestMarginsByMonth(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // data.Invoice stays a draft
+	owner := fixtures.DefaultOwnerID
+
+	date := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+	positions := fixtures.SamplePositions() // 1660 net
+	positions[0].CostPrice = decimal.RequireFromString("87.65")
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-1"),
+		fixtures.WithInvoiceDate(date),
+		fixtures.WithInvoicePositions(positions...),
+	)
+	if err := store.SaveInvoice(inv, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, owner, date); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	got, err := store.MarginsByMonth(owner, 2025)
+	if err != nil {
+		t.Fatalf("MarginsByMonth failed: %v", err)
+	}
+	if len(got) != 12 {
+		t.Fatalf("got %d months, want 12", len(got))
+	}
+	for _, m := range got {
+		wantRevenue, wantCost := decimal.Zero, decimal.Zero
+		if m.Month == time.April {
+			wantRevenue, wantCost = decimal.RequireFromString("1660"), decimal.RequireFromString("701.2")
+		}
+		if !m.Revenue.Equal(wantRevenue) || !m.Cost.Equal(wantCost) || !m.Margin.Equal(wantRevenue.Sub(wantCost)) {
+			t.Errorf("%s: revenue %s, cost %s, margin %s; want %s, %s", m.Month, m.Revenue, m.Cost, m.Margin, wantRevenue, wantCost)
+		}
+	}
+
+	// The cost is internal and must not show up in the XML.
+	loaded, err := store.LoadInvoice(inv.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if !loaded.InvoicePositions[0].CostPrice.Equal(positions[0].CostPrice) {
+		t.Errorf("CostPrice = %s, want %s", loaded.InvoicePositions[0].CostPrice, positions[0].CostPrice)
+	}
+	xmlPath := filepath.Join(t.TempDir(), "margin.xml")
+	if err := store.WriteZUGFeRDXML(loaded, owner, xmlPath); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	if strings.Contains(string(b), "87.65") || strings.Contains(string(b), "701.20") {
+		t.Error("XML must not contain the cost price")
+	}
+}
@@ -26,6 +26,8 @@ type Note struct {
 	Body       string     `json:"body"        form:"body"`                     // Main text content
 	Tags       string     `json:"tags"        form:"tags"`                     // Comma-separated tags (stored as CSV)
 	EditedAt   time.Time  `json:"edited_at"   form:"edited_at"`                // Usually managed server-side
+	Pinned     bool       `json:"pinned"      form:"-"`                        // Listed first, see SetNotePinned
+	RemindAt   *time.Time `json:"remind_at,omitempty" form:"-"`                // Optional follow-up date, see DueReminders
 }
 
 // BeforeSave GORM hook — automatically updates EditedAt timestamp
@@ -108,7 +110,8 @@ func (s *Store) LoadAllNotesForParent(ownerID uint, parentType ParentType, paren
 }
 
 // ListNotesForParent returns a list of notes belonging to a given parent entity,
-// optionally filtered by search terms, with pagination support.
+// optionally filtered by search terms, with pagination support. Pinned notes
+// come first, then the newest.
 //
 // Search applies a simple LIKE filter over title, body, and tags (case-sensitive by default).
 func (s *Store) ListNotesForParent(ownerID uint, parentType ParentType, parentID uint, f NoteFilters) ([]Note, error) {
@@ -132,7 +135,7 @@ func (s *Store) ListNotesForParent(ownerID uint, parentType ParentType, parentID
 
 	var notes []Note
 	err = q.
-		Order("edited_at DESC, id DESC").
+		Order("pinned DESC, created_at DESC, id DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&notes).Error
@@ -162,10 +165,85 @@ func (s *Store) UpdateNoteContentAsAuthor(ownerID, authorID, noteID uint, title,
 	return &n, nil
 }
 
-// DeleteNote removes a note by ID, restricted to its owner and author.
-// Authors can only delete their own notes.
+// SetNotePinned pins a note to the top of its parent's list or unpins it.
+// Only the author may do so; for other notes gorm.ErrRecordNotFound is
+// returned.
+func (s *Store) SetNotePinned(id, ownerID, userID uint, pinned bool) error {
+	res := s.db.Model(&Note{}).
+		Where("id = ? AND owner_id = ? AND author_id = ?", id, ownerID, userID).
+		UpdateColumn("pinned", pinned)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetNoteReminder sets the follow-up date of a note; nil removes the
+// reminder. Any user of the owner may do so, since reminders are usually
+// dealt with by whoever picks them up from the dashboard.
+func (s *Store) SetNoteReminder(id, ownerID uint, remindAt *time.Time) error {
+	res := s.db.Model(&Note{}).
+		Where("id = ? AND owner_id = ?", id, ownerID).
+		UpdateColumn("remind_at", remindAt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DueReminders returns the notes of the owner whose reminder is due at now,
+// the oldest reminder first.
+func (s *Store) DueReminders(ownerID uint, now time.Time) ([]Note, error) {
+	var notes []Note
+	err := s.db.
+		Where("owner_id = ? AND remind_at IS NOT NULL AND remind_at <= ?", ownerID, now).
+		Order("remind_at ASC, id ASC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// NoteUndoWindow is how long the author can restore a deleted note.
+const NoteUndoWindow = 10 * time.Minute
+
+// DeleteNote soft-deletes a note by ID, restricted to its owner and author.
+// Authors can only delete their own notes; for other notes
+// gorm.ErrRecordNotFound is returned. Deleted notes disappear from all lists
+// and can be restored with RestoreNote for NoteUndoWindow.
 func (s *Store) DeleteNote(id uint, ownerID uint, authorID uint) error {
-	return s.db.
+	res := s.db.
 		Where("id = ? AND owner_id = ? AND author_id = ?", id, ownerID, authorID).
-		Delete(&Note{}).Error
+		Delete(&Note{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RestoreNote undoes DeleteNote for the note's author within NoteUndoWindow
+// and returns the restored note. Otherwise gorm.ErrRecordNotFound is
+// returned.
+func (s *Store) RestoreNote(id, ownerID, userID uint) (*Note, error) {
+	var n Note
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("id = ? AND owner_id = ? AND author_id = ? AND deleted_at > ?", id, ownerID, userID, time.Now().Add(-NoteUndoWindow)).
+			First(&n).Error; err != nil {
+			return err
+		}
+		n.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Model(&n).UpdateColumn("deleted_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
 }
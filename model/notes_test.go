@@ -1,10 +1,14 @@
 package model_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/billingcat/crm/fixtures"
 	"github.com/billingcat/crm/model"
+	"gorm.io/gorm"
 )
 
 func TestNote_CreateAndLoad(t *testing.T) {
@@ -97,6 +101,106 @@ func TestNote_ListForParent(t *testing.T) {
 	}
 }
 
+func TestNote_Pinned(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	var ids []uint
+	for _, title := range []string{"Erste Notiz", "Zweite Notiz", "Dritte Notiz"} {
+		note := fixtures.NoteForCompany(data.Company.ID,
+			fixtures.WithNoteTitle(title),
+			fixtures.WithNoteAuthorID(data.User.ID),
+		)
+		if err := store.CreateNote(note); err != nil {
+			t.Fatalf("CreateNote failed: %v", err)
+		}
+		ids = append(ids, note.ID)
+	}
+
+	if err := store.SetNotePinned(ids[0], owner, data.User.ID+1, true); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("SetNotePinned by another user: err = %v, want ErrRecordNotFound", err)
+	}
+	if err := store.SetNotePinned(ids[0], owner, data.User.ID, true); err != nil {
+		t.Fatalf("SetNotePinned failed: %v", err)
+	}
+
+	notes, err := store.LoadAllNotesForParent(owner, model.ParentTypeCompany, data.Company.ID)
+	if err != nil {
+		t.Fatalf("LoadAllNotesForParent failed: %v", err)
+	}
+	var got []string
+	for _, n := range notes {
+		got = append(got, n.Title)
+	}
+	if want := "Erste Notiz,Dritte Notiz,Zweite Notiz"; strings.Join(got, ",") != want {
+		t.Errorf("order = %v, want %s", got, want)
+	}
+	if !notes[0].Pinned || notes[1].Pinned {
+		t.Errorf("pinned flags = %v, %v", notes[0].Pinned, notes[1].Pinned)
+	}
+}
+
+func TestNote_DueReminders(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	remind := map[string]*time.Time{
+		"Ohne Erinnerung": nil,
+		"Überfällig":      ptrTime(now.AddDate(0, 0, -2)),
+		"Heute":           ptrTime(now.Add(-time.Hour)),
+		"Später":          ptrTime(now.AddDate(0, 0, 1)),
+	}
+	ids := map[string]uint{}
+	for title, at := range remind {
+		note := fixtures.NoteForCompany(data.Company.ID,
+			fixtures.WithNoteTitle(title),
+			fixtures.WithNoteAuthorID(data.User.ID),
+		)
+		note.RemindAt = at
+		if err := store.CreateNote(note); err != nil {
+			t.Fatalf("CreateNote failed: %v", err)
+		}
+		ids[title] = note.ID
+	}
+
+	due := func() []string {
+		t.Helper()
+		notes, err := store.DueReminders(owner, now)
+		if err != nil {
+			t.Fatalf("DueReminders failed: %v", err)
+		}
+		var got []string
+		for _, n := range notes {
+			got = append(got, n.Title)
+		}
+		return got
+	}
+	if got := strings.Join(due(), ","); got != "Überfällig,Heute" {
+		t.Errorf("due reminders = %q, want Überfällig,Heute", got)
+	}
+	if notes, _ := store.DueReminders(owner+1, now); len(notes) != 0 {
+		t.Errorf("other owner sees %d reminders", len(notes))
+	}
+
+	if err := store.SetNoteReminder(ids["Überfällig"], owner, nil); err != nil {
+		t.Fatalf("SetNoteReminder failed: %v", err)
+	}
+	if err := store.DeleteNote(ids["Heute"], owner, data.User.ID); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+	if got := due(); len(got) != 0 {
+		t.Errorf("due reminders after done and delete = %v, want none", got)
+	}
+	if err := store.SetNoteReminder(ids["Später"], owner+1, nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("SetNoteReminder for another owner: err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
+
 func TestNote_UpdateAsAuthor(t *testing.T) {
 	store := fixtures.NewTestStore(t)
 	data := fixtures.SeedTestData(t, store)
@@ -190,6 +294,53 @@ func TestNote_DeleteAsAuthor(t *testing.T) {
 	}
 }
 
+func TestNote_Restore(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	note := fixtures.NoteForCompany(data.Company.ID,
+		fixtures.WithNoteAuthorID(data.User.ID),
+	)
+	if err := store.CreateNote(note); err != nil {
+		t.Fatalf("CreateNote failed: %v", err)
+	}
+	if err := store.DeleteNote(note.ID, owner, data.User.ID); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+
+	notes, err := store.LoadAllNotesForParent(owner, model.ParentTypeCompany, data.Company.ID)
+	if err != nil {
+		t.Fatalf("LoadAllNotesForParent failed: %v", err)
+	}
+	if len(notes) != 0 {
+		t.Errorf("deleted note still listed: %d notes", len(notes))
+	}
+	activity, err := store.LoadActivity(owner, 20)
+	if err != nil {
+		t.Fatalf("LoadActivity failed: %v", err)
+	}
+	for _, h := range activity.Heads {
+		if h.ItemType == "note" && h.ItemID == note.ID {
+			t.Errorf("deleted note in the activity feed")
+		}
+	}
+
+	if _, err := store.RestoreNote(note.ID, owner, data.User.ID+1); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("RestoreNote by another user: err = %v, want ErrRecordNotFound", err)
+	}
+	restored, err := store.RestoreNote(note.ID, owner, data.User.ID)
+	if err != nil {
+		t.Fatalf("RestoreNote failed: %v", err)
+	}
+	if restored.ParentID != data.Company.ID || restored.DeletedAt.Valid {
+		t.Errorf("restored note = %+v", restored)
+	}
+	if _, err := store.GetNoteByID(note.ID, owner); err != nil {
+		t.Errorf("restored note not found: %v", err)
+	}
+}
+
 func TestNote_DeleteAsWrongAuthor_NoEffect(t *testing.T) {
 	store := fixtures.NewTestStore(t)
 	data := fixtures.SeedTestData(t, store)
@@ -208,7 +359,7 @@ func TestNote_DeleteAsWrongAuthor_NoEffect(t *testing.T) {
 		t.Fatalf("CreateNote failed: %v", err)
 	}
 
-	// Try to delete as different user (no error, but no effect)
+	// Try to delete as different user (no effect)
 	_ = store.DeleteNote(note.ID, fixtures.DefaultOwnerID, otherUser.ID)
 
 	// Note should still exist
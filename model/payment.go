@@ -0,0 +1,126 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvoiceHasPayments is returned when voiding an invoice that already has
+// recorded payments and the caller did not force the transition.
+var ErrInvoiceHasPayments = errors.New("invoice has recorded payments")
+
+// ErrCreditNotePayment is returned when a payment is recorded for a credit
+// note. Credit notes have a negative GrossTotal and are settled by a status
+// change, not by payments.
+var ErrCreditNotePayment = errors.New("payments cannot be recorded for credit notes")
+
+// Payment is a (partial) payment received for an issued invoice. Once the sum
+// of all payments reaches the invoice's GrossTotal, the invoice becomes paid.
+type Payment struct {
+	ID        uint            `gorm:"primaryKey"`
+	CreatedAt time.Time       `gorm:"not null"`
+	InvoiceID uint            `gorm:"not null;index"`
+	OwnerID   uint            `gorm:"not null;index"`
+	Amount    decimal.Decimal `gorm:"type:text;not null"`
+	Date      time.Time       `gorm:"not null"`
+	Note      string          `gorm:"type:text"`
+}
+
+func (Payment) TableName() string { return "payments" }
+
+// AddPayment records a payment for an issued invoice. When the sum of all
+// payments reaches the invoice's GrossTotal the invoice is transitioned to
+// paid, using date as PaidAt. Credit notes yield ErrCreditNotePayment.
+func (s *Store) AddPayment(invoiceID, ownerID uint, amount decimal.Decimal, date time.Time, note string) (*Payment, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("payment amount must be positive")
+	}
+	p := &Payment{
+		InvoiceID: invoiceID,
+		OwnerID:   ownerID,
+		Amount:    amount,
+		Date:      date,
+		Note:      note,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var inv Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", invoiceID, ownerID).
+			First(&inv).Error; err != nil {
+			return err
+		}
+		if inv.Status != InvoiceStatusIssued {
+			return fmt.Errorf("payments can only be recorded for issued invoices (status %q)", inv.Status)
+		}
+		if inv.IsCreditNote() {
+			return ErrCreditNotePayment
+		}
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+
+		paid, err := sumPayments(tx, invoiceID, ownerID)
+		if err != nil {
+			return err
+		}
+		if paid.LessThan(inv.GrossTotal) {
+			return nil
+		}
+		if err := tx.Model(&Invoice{}).
+			Where("id = ? AND owner_id = ?", invoiceID, ownerID).
+			Updates(map[string]any{
+				"status":  InvoiceStatusPaid,
+				"paid_at": date,
+			}).Error; err != nil {
+			return err
+		}
+		return s.recordInvoiceEvent(tx, invoiceID, ownerID, InvoiceEventStatus, statusEventDetail(inv.Status, InvoiceStatusPaid))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListPayments returns all payments of an invoice, oldest first.
+func (s *Store) ListPayments(invoiceID, ownerID uint) ([]Payment, error) {
+	var out []Payment
+	err := s.db.Where("invoice_id = ? AND owner_id = ?", invoiceID, ownerID).
+		Order("date ASC, id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// PaymentsTotal sums the given payments.
+func PaymentsTotal(payments []Payment) decimal.Decimal {
+	sum := decimal.Zero
+	for _, p := range payments {
+		sum = sum.Add(p.Amount)
+	}
+	return sum
+}
+
+// sumPayments adds up all payments of an invoice. Amounts are stored as text,
+// so the sum is computed in Go rather than in SQL.
+func sumPayments(tx *gorm.DB, invoiceID, ownerID uint) (decimal.Decimal, error) {
+	var payments []Payment
+	if err := tx.Where("invoice_id = ? AND owner_id = ?", invoiceID, ownerID).
+		Find(&payments).Error; err != nil {
+		return decimal.Zero, err
+	}
+	return PaymentsTotal(payments), nil
+}
+
+// countPayments returns the number of payments recorded for an invoice.
+func countPayments(tx *gorm.DB, invoiceID, ownerID uint) (int64, error) {
+	var n int64
+	err := tx.Model(&Payment{}).
+		Where("invoice_id = ? AND owner_id = ?", invoiceID, ownerID).
+		Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,128 @@
+package model_test
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func TestEPCQRPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		in   model.EPCPayment
+		want string
+	}{
+		{
+			name: "unstructured text",
+			in: model.EPCPayment{
+				Name:   "Testfirma GmbH",
+				IBAN:   "DE89 3704 0044 0532 0130 00",
+				BIC:    "cobadeffxxx",
+				Amount: decimal.RequireFromString("1975.4"),
+				Text:   "Rechnung INV-2025-0001",
+			},
+			want: "BCD\n002\n1\nSCT\nCOBADEFFXXX\nTestfirma GmbH\nDE89370400440532013000\nEUR1975.40\n\n\nRechnung INV-2025-0001",
+		},
+		{
+			name: "structured reference wins, no BIC",
+			in: model.EPCPayment{
+				Name:      "Testfirma GmbH",
+				IBAN:      "DE89370400440532013000",
+				Amount:    decimal.RequireFromString("12.3"),
+				Reference: "RF18 5390 0754 7034",
+				Text:      "ignored",
+			},
+			want: "BCD\n002\n1\nSCT\n\nTestfirma GmbH\nDE89370400440532013000\nEUR12.30\n\nRF18539007547034",
+		},
+		{
+			name: "no remittance information",
+			in: model.EPCPayment{
+				Name:   "Testfirma GmbH",
+				IBAN:   "DE89370400440532013000",
+				Amount: decimal.RequireFromString("0.01"),
+			},
+			want: "BCD\n002\n1\nSCT\n\nTestfirma GmbH\nDE89370400440532013000\nEUR0.01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := model.EPCQRPayload(tt.in)
+			if err != nil {
+				t.Fatalf("EPCQRPayload failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("payload\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+
+	long := model.EPCPayment{Name: strings.Repeat("ä", 80), IBAN: "DE89370400440532013000", Amount: decimal.NewFromInt(1)}
+	got, err := model.EPCQRPayload(long)
+	if err != nil {
+		t.Fatalf("EPCQRPayload failed: %v", err)
+	}
+	if name := strings.Split(got, "\n")[5]; name != strings.Repeat("ä", 70) {
+		t.Errorf("name not cut to 70 characters: %d", len([]rune(name)))
+	}
+
+	for _, bad := range []model.EPCPayment{
+		{Name: "X", Amount: decimal.NewFromInt(1)},
+		{IBAN: "DE89370400440532013000", Amount: decimal.NewFromInt(1)},
+		{Name: "X", IBAN: "DE89370400440532013000"},
+		{Name: "X", IBAN: "DE89370400440532013000", Amount: decimal.NewFromInt(1_000_000_000)},
+		{Name: "X", IBAN: "DE89370400440532013000", Amount: decimal.NewFromInt(1), Reference: strings.Repeat("1", 36)},
+	} {
+		if _, err := model.EPCQRPayload(bad); err == nil {
+			t.Errorf("EPCQRPayload(%+v): expected error", bad)
+		}
+	}
+}
+
+func TestLetterheadPaymentQRRegion(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+	store.Config.Basedir = t.TempDir()
+
+	tpl := fixtures.SeedLetterheadTemplate(t, store, "")
+	qr := model.PlacedRegion{Kind: model.FieldPaymentQR, XCm: 2, YCm: 24, WidthCm: 3, HeightCm: 3}
+	if err := store.UpdateLetterheadRegionsAndFonts(tpl.ID, owner, append(tpl.Regions, qr), nil, 0, 0); err != nil {
+		t.Fatalf("UpdateLetterheadRegionsAndFonts failed: %v", err)
+	}
+	fixtures.AttachTemplateToInvoice(t, store, td.Invoice, tpl.ID)
+
+	inv, err := store.LoadInvoiceWithTemplate(td.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("load invoice: %v", err)
+	}
+	if len(inv.Template.Regions) != 4 {
+		t.Fatalf("expected 4 regions, got %d", len(inv.Template.Regions))
+	}
+	dir := t.TempDir()
+	xmlPath := filepath.Join(dir, "invoice.xml")
+	if err := store.WriteZUGFeRDXML(inv, owner, xmlPath); err != nil {
+		t.Fatalf("write zugferd xml: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := store.CreateZUGFeRDPDF(inv, owner, xmlPath, filepath.Join(dir, "invoice.pdf"), logger); err != nil {
+		t.Fatalf("create pdf with QR region: %v", err)
+	}
+
+	// Saving without the region switches the QR code off again.
+	if err := store.UpdateLetterheadRegionsAndFonts(tpl.ID, owner, tpl.Regions, nil, 0, 0); err != nil {
+		t.Fatalf("UpdateLetterheadRegionsAndFonts failed: %v", err)
+	}
+	reloaded, err := store.LoadLetterheadTemplate(tpl.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadLetterheadTemplate failed: %v", err)
+	}
+	if len(reloaded.Regions) != 3 {
+		t.Errorf("expected 3 regions after removing the QR code, got %d", len(reloaded.Regions))
+	}
+}
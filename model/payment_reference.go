@@ -0,0 +1,110 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// GenerateCreditorReference builds an ISO 11649 creditor reference
+// ("RF" + two check digits + reference) from number. Everything but letters
+// and digits is dropped from number; what remains must be 1 to 21 characters
+// long.
+func GenerateCreditorReference(number string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(number) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	base := b.String()
+	if base == "" {
+		return "", fmt.Errorf("creditor reference: no letters or digits in %q", number)
+	}
+	if len(base) > 21 {
+		return "", fmt.Errorf("creditor reference: %q is longer than 21 characters", base)
+	}
+	check := 98 - mod97(base+"RF00")
+	return fmt.Sprintf("RF%02d%s", check, base), nil
+}
+
+// ValidCreditorReference reports whether ref is a well-formed ISO 11649
+// creditor reference with correct check digits. Spaces are ignored.
+func ValidCreditorReference(ref string) bool {
+	ref = strings.ToUpper(strings.Join(strings.Fields(ref), ""))
+	if len(ref) < 5 || len(ref) > 25 || !strings.HasPrefix(ref, "RF") {
+		return false
+	}
+	for _, r := range ref {
+		if !((r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return mod97(ref[4:]+ref[:4]) == 1
+}
+
+// mod97 computes the ISO 7064 MOD 97-10 remainder of s, letters counting as
+// 10 (A) to 35 (Z). s must consist of upper case letters and digits.
+func mod97(s string) int {
+	rem := 0
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		} else {
+			rem = (rem*10 + int(r-'0')) % 97
+		}
+	}
+	return rem
+}
+
+// FormatPaymentReference expands the payment reference template of the
+// settings for an invoice. Placeholders: %NR% invoice number, %CN% customer
+// number. A template starting with "RF" yields a creditor reference: the rest
+// of the expanded template gets ISO 11649 check digits (see
+// GenerateCreditorReference). An empty template means no payment reference.
+func FormatPaymentReference(template, invoiceNumber, customerNumber string) (string, error) {
+	template = strings.TrimSpace(template)
+	if template == "" {
+		return "", nil
+	}
+	ref := strings.NewReplacer("%NR%", invoiceNumber, "%CN%", customerNumber).Replace(template)
+	if len(template) >= 2 && strings.EqualFold(template[:2], "RF") {
+		return GenerateCreditorReference(ref[2:])
+	}
+	return strings.TrimSpace(ref), nil
+}
+
+// invoicePaymentReference returns the payment reference of inv: the one
+// stored when the invoice was issued, otherwise (drafts and invoices issued
+// before references existed) the one the settings template yields now.
+func invoicePaymentReference(inv *Invoice, settings *Settings, company *Company) string {
+	if inv.PaymentReference != "" {
+		return inv.PaymentReference
+	}
+	ref, err := FormatPaymentReference(settings.PaymentReferenceTemplate, inv.Number, company.CustomerNumber)
+	if err != nil {
+		return ""
+	}
+	return ref
+}
+
+// insertPaymentReference adds the payment reference (BT-83) to a CII
+// document written by einvoice, which does not write that element itself.
+// It belongs in front of the invoice currency of the header trade
+// settlement.
+func insertPaymentReference(cii, ref string) string {
+	if ref == "" {
+		return cii
+	}
+	const anchor = "<ram:InvoiceCurrencyCode>"
+	i := strings.Index(cii, anchor)
+	if i < 0 {
+		return cii
+	}
+	lineStart := strings.LastIndex(cii[:i], "\n") + 1
+	indent := cii[lineStart:i]
+	var esc bytes.Buffer
+	_ = xml.EscapeText(&esc, []byte(ref))
+	return cii[:i] + "<ram:PaymentReference>" + esc.String() + "</ram:PaymentReference>\n" + indent + cii[i:]
+}
@@ -0,0 +1,125 @@
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestGenerateCreditorReference(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"539007547034", "RF18539007547034"}, // example from ISO 11649
+		{"5390 0754 7034", "RF18539007547034"},
+		{"INV-2024-0001", "RF17INV20240001"},
+		{"a", "RF25A"},
+	}
+	for _, tt := range tests {
+		got, err := model.GenerateCreditorReference(tt.in)
+		if err != nil {
+			t.Fatalf("GenerateCreditorReference(%q) failed: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateCreditorReference(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !model.ValidCreditorReference(got) {
+			t.Errorf("ValidCreditorReference(%q) = false", got)
+		}
+	}
+
+	for _, bad := range []string{"", "--", strings.Repeat("1", 22)} {
+		if _, err := model.GenerateCreditorReference(bad); err == nil {
+			t.Errorf("GenerateCreditorReference(%q): expected error", bad)
+		}
+	}
+	for _, bad := range []string{"RF19539007547034", "RF18", "XX18539007547034", "RF18 5390-0754 7034"} {
+		if model.ValidCreditorReference(bad) {
+			t.Errorf("ValidCreditorReference(%q) = true", bad)
+		}
+	}
+}
+
+func TestFormatPaymentReference(t *testing.T) {
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{"", ""},
+		{"%NR%", "INV-2024-0001"},
+		{"%CN% / %NR%", "K-00042 / INV-2024-0001"},
+		{"RF%NR%", "RF17INV20240001"},
+		{"rf%CN%", "RF31K00042"},
+	}
+	for _, tt := range tests {
+		got, err := model.FormatPaymentReference(tt.tpl, "INV-2024-0001", "K-00042")
+		if err != nil {
+			t.Fatalf("FormatPaymentReference(%q) failed: %v", tt.tpl, err)
+		}
+		if got != tt.want {
+			t.Errorf("FormatPaymentReference(%q) = %q, want %q", tt.tpl, got, tt.want)
+		}
+	}
+	if _, err := model.FormatPaymentReference("RF%CN%%NR%%NR%", "INV-2024-0001", "K-00042"); err == nil {
+		t.Errorf("expected error for a creditor reference longer than 21 characters")
+	}
+}
+
+func TestPaymentReference_FrozenOnIssue(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	data.Settings.PaymentReferenceTemplate = "RF%NR%"
+	if err := store.SaveSettings(data.Settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(data.Invoice.ID, owner, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	inv, err := store.LoadInvoice(data.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if inv.PaymentReference != "RF17INV20240001" {
+		t.Fatalf("PaymentReference = %q, want RF17INV20240001", inv.PaymentReference)
+	}
+
+	// Changing the template later does not touch issued invoices.
+	data.Settings.PaymentReferenceTemplate = "%NR%"
+	if err := store.SaveSettings(data.Settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "invoice.xml")
+	if err := store.WriteZUGFeRDXML(inv, owner, path); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(b)
+	if !strings.Contains(xml, "<ram:PaymentReference>RF17INV20240001</ram:PaymentReference>") {
+		t.Errorf("XML lacks the payment reference:\n%s", xml)
+	}
+	if strings.Index(xml, "<ram:PaymentReference>") > strings.Index(xml, "<ram:InvoiceCurrencyCode>") {
+		t.Errorf("payment reference must precede the invoice currency")
+	}
+
+	if err := store.MarkInvoiceDraft(inv.ID, owner, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceDraft failed: %v", err)
+	}
+	inv, err = store.LoadInvoice(inv.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	if inv.PaymentReference != "" {
+		t.Errorf("draft keeps payment reference %q", inv.PaymentReference)
+	}
+}
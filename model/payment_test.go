@@ -0,0 +1,128 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func issuedTestInvoice(t *testing.T, store *model.Store) *model.Invoice {
+	t.Helper()
+	data := fixtures.SeedTestData(t, store)
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, inv.Date); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	return loaded
+}
+
+func TestAddPayment_Installments(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	inv := issuedTestInvoice(t, store)
+
+	half := inv.GrossTotal.Div(decimal.NewFromInt(2))
+	if _, err := store.AddPayment(inv.ID, fixtures.DefaultOwnerID, half, inv.Date, "1. Rate"); err != nil {
+		t.Fatalf("AddPayment failed: %v", err)
+	}
+
+	loaded, _ := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if loaded.Status != model.InvoiceStatusIssued {
+		t.Errorf("Status after partial payment = %q, want %q", loaded.Status, model.InvoiceStatusIssued)
+	}
+
+	rest := inv.GrossTotal.Sub(half)
+	if _, err := store.AddPayment(inv.ID, fixtures.DefaultOwnerID, rest, inv.Date, "2. Rate"); err != nil {
+		t.Fatalf("AddPayment failed: %v", err)
+	}
+
+	loaded, _ = store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if loaded.Status != model.InvoiceStatusPaid {
+		t.Errorf("Status after full payment = %q, want %q", loaded.Status, model.InvoiceStatusPaid)
+	}
+	if loaded.PaidAt == nil {
+		t.Error("PaidAt should be set after full payment")
+	}
+
+	payments, err := store.ListPayments(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("ListPayments failed: %v", err)
+	}
+	if len(payments) != 2 {
+		t.Fatalf("got %d payments, want 2", len(payments))
+	}
+	if !model.PaymentsTotal(payments).Equal(inv.GrossTotal) {
+		t.Errorf("PaymentsTotal = %s, want %s", model.PaymentsTotal(payments), inv.GrossTotal)
+	}
+
+	// Paid invoices accept no further payments.
+	if _, err := store.AddPayment(inv.ID, fixtures.DefaultOwnerID, decimal.NewFromInt(1), inv.Date, ""); err == nil {
+		t.Error("expected error when adding a payment to a paid invoice")
+	}
+}
+
+func TestVoidInvoice_WithPayments(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	inv := issuedTestInvoice(t, store)
+
+	if _, err := store.AddPayment(inv.ID, fixtures.DefaultOwnerID, decimal.NewFromInt(10), inv.Date, ""); err != nil {
+		t.Fatalf("AddPayment failed: %v", err)
+	}
+
+	err := store.VoidInvoice(inv.ID, fixtures.DefaultOwnerID, inv.Date, false)
+	if !errors.Is(err, model.ErrInvoiceHasPayments) {
+		t.Fatalf("VoidInvoice without force: got %v, want ErrInvoiceHasPayments", err)
+	}
+
+	if err := store.VoidInvoice(inv.ID, fixtures.DefaultOwnerID, inv.Date, true); err != nil {
+		t.Fatalf("VoidInvoice with force failed: %v", err)
+	}
+	loaded, _ := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if loaded.Status != model.InvoiceStatusVoided {
+		t.Errorf("Status after forced void = %q, want %q", loaded.Status, model.InvoiceStatusVoided)
+	}
+}
+
+func TestAddPayment_CreditNote(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	cn := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("GS-001"),
+		fixtures.WithInvoicePositions(fixtures.Position(1, "Service", -1, 100.00, 19)),
+	)
+	cn.DocumentType = model.DocumentTypeCreditNote
+	if err := store.SaveInvoice(cn, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(cn.ID, fixtures.DefaultOwnerID, cn.Date); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	// Any amount would reach the negative GrossTotal.
+	_, err := store.AddPayment(cn.ID, fixtures.DefaultOwnerID, decimal.NewFromInt(1), cn.Date, "")
+	if !errors.Is(err, model.ErrCreditNotePayment) {
+		t.Fatalf("AddPayment on credit note: got %v, want ErrCreditNotePayment", err)
+	}
+	loaded, _ := store.LoadInvoice(cn.ID, fixtures.DefaultOwnerID)
+	if loaded.Status != model.InvoiceStatusIssued {
+		t.Errorf("Status = %q, want %q", loaded.Status, model.InvoiceStatusIssued)
+	}
+	if payments, _ := store.ListPayments(cn.ID, fixtures.DefaultOwnerID); len(payments) != 0 {
+		t.Errorf("got %d payments, want none", len(payments))
+	}
+}
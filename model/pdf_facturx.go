@@ -0,0 +1,53 @@
+package model
+
+import (
+	"github.com/boxesandglue/bagme/document"
+	pdfdoc "github.com/boxesandglue/boxesandglue/backend/document"
+)
+
+// facturXFilename is the name of the embedded CII invoice in ZUGFeRD 2.x /
+// Factur-X PDFs.
+const facturXFilename = "factur-x.xml"
+
+// facturXOptions returns the document options for a ZUGFeRD PDF: PDF/A-3b
+// output with the CII XML as associated file. bagme assigns
+// /AFRelationship /Alternative to document attachments, which is what
+// ZUGFeRD requires for the invoice XML. The XMP metadata is added separately
+// with addFacturXMetadata.
+//
+// bagme's WithZUGFeRD is not used because it declares the ZUGFeRD 1.0 XMP
+// schema (urn:ferd:...), which strict validators such as Mustang reject for a
+// factur-x.xml attachment.
+func facturXOptions(xmlData []byte) []document.Option {
+	return []document.Option{
+		document.WithPDFA3b(),
+		document.WithAttachment(document.Attachment{
+			Name:        facturXFilename,
+			Description: "Factur-X/ZUGFeRD invoice",
+			MimeType:    "text/xml",
+			Data:        xmlData,
+		}),
+	}
+}
+
+// addFacturXMetadata adds the Factur-X XMP extension schema (fx namespace)
+// with the conformance level of the embedded XML, e.g. "EN 16931".
+func addFacturXMetadata(d *document.Document, conformanceLevel string) {
+	d.Frontend.Doc.AddXMPExtension(pdfdoc.XMPExtension{
+		Schema:       "Factur-X PDFA Extension Schema",
+		NamespaceURI: "urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#",
+		Prefix:       "fx",
+		Properties: []pdfdoc.XMPExtensionProperty{
+			{Name: "DocumentFileName", ValueType: "Text", Category: "external", Description: "The name of the embedded XML document"},
+			{Name: "DocumentType", ValueType: "Text", Category: "external", Description: "The type of the hybrid document in capital letters, e.g. INVOICE or ORDER"},
+			{Name: "Version", ValueType: "Text", Category: "external", Description: "The actual version of the standard applying to the embedded XML document"},
+			{Name: "ConformanceLevel", ValueType: "Text", Category: "external", Description: "The conformance level of the embedded XML document"},
+		},
+		Values: map[string]string{
+			"DocumentFileName": facturXFilename,
+			"DocumentType":     "INVOICE",
+			"Version":          "1.0",
+			"ConformanceLevel": conformanceLevel,
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/boxesandglue/bagme/document"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+)
+
+// draftWatermarkText is stamped across every page of a draft PDF.
+const draftWatermarkText = "ENTWURF / DRAFT"
+
+// draftWatermark returns the watermark text for inv, or "" when the PDF is
+// final and must stay clean.
+func draftWatermark(inv *Invoice) string {
+	if inv.Status == InvoiceStatusDraft {
+		return draftWatermarkText
+	}
+	return ""
+}
+
+// addWatermark makes d stamp text diagonally (from lower left to upper
+// right) across each page. It hooks into the page initialisation, so the
+// watermark lies above the letterhead background and below the invoice
+// content. Must be called before RenderPages.
+func addWatermark(d *document.Document, text string, logger *slog.Logger) {
+	d.PageInitCallback = func() {
+		if err := outputWatermark(d, text); err != nil {
+			logger.Error("output watermark", "err", err)
+		}
+	}
+}
+
+func outputWatermark(d *document.Document, text string) error {
+	fe := d.Frontend
+	ff := fe.FindFontFamily("sans")
+	if ff == nil {
+		return fmt.Errorf("font family sans not defined")
+	}
+	dim, err := d.PageSize()
+	if err != nil {
+		return err
+	}
+	head, err := fe.BuildNodelistFromString(frontend.TypesettingSettings{
+		frontend.SettingFontFamily: ff,
+		frontend.SettingFontWeight: frontend.FontWeight700,
+		frontend.SettingSize:       dim.Width / 9,
+		frontend.SettingColor:      "#d9d9d9",
+	}, text)
+	if err != nil {
+		return err
+	}
+
+	// Rotate around the page center along the diagonal. The PDF operators
+	// are written by start/stop nodes around the text; the artifact marks
+	// the text as watermark for text extraction and screen readers.
+	w, h := dim.Width.ToPT(), dim.Height.ToPT()
+	angle := math.Atan2(h, w)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	cx, cy := w/2, h/2
+	start := node.NewStartStop()
+	start.Position = node.PDFOutputPage
+	start.ShipoutCallback = func(node.Node) string {
+		return fmt.Sprintf(" q %.4f %.4f %.4f %.4f %.2f %.2f cm /Artifact <</Type /Pagination /Subtype /Watermark>> BDC ",
+			cos, sin, -sin, cos, cx-cos*cx+sin*cy, cy-sin*cx-cos*cy)
+	}
+	stop := node.NewStartStop()
+	stop.Position = node.PDFOutputPage
+	stop.StartNode = start
+	stop.ShipoutCallback = func(node.Node) string {
+		return " EMC Q "
+	}
+	head = node.InsertBefore(head, head, start)
+	node.InsertAfter(head, node.Tail(head), stop)
+
+	hl := node.Hpack(head)
+	vl := node.Vpack(hl)
+	fe.Doc.CurrentPage.OutputAt((dim.Width-hl.Width)/2, (dim.Height+hl.Height-hl.Depth)/2, vl)
+	return nil
+}
@@ -76,7 +76,9 @@ func (s *Store) ResolvePDFEngine(ownerID uint) (PDFEngine, error) {
 
 // CreateZUGFeRDPDF creates a ZUGFeRD PDF file for the invoice with the engine
 // resolved for the owner. The CII XML is expected to exist at xmlpath and the
-// PDF gets written to pdfpath.
+// PDF gets written to pdfpath. Drafts rendered by the built-in engine carry an
+// "ENTWURF / DRAFT" watermark; the speedata engine renders the owner's
+// layout.xml unchanged.
 func (s *Store) CreateZUGFeRDPDF(inv *Invoice, ownerID uint, xmlpath string, pdfpath string, logger *slog.Logger) error {
 	engine, err := s.ResolvePDFEngine(ownerID)
 	if err != nil {
@@ -85,7 +87,15 @@ func (s *Store) CreateZUGFeRDPDF(inv *Invoice, ownerID uint, xmlpath string, pdf
 	if engine == PDFEngineSpeedata {
 		return s.createZUGFeRDPDFSpeedata(inv, ownerID, xmlpath, pdfpath, logger)
 	}
-	return s.createZUGFeRDPDFBag(inv, ownerID, xmlpath, pdfpath, logger)
+	return s.createZUGFeRDPDFBag(inv, ownerID, xmlpath, pdfpath, false, logger)
+}
+
+// CreatePlainZUGFeRDPDF creates a ZUGFeRD PDF file for the invoice without any
+// letterhead: neither a selected letterhead template nor the owner's
+// layout.xml is used. The invoice is always rendered locally with
+// boxesandglue in the generic A4 layout.
+func (s *Store) CreatePlainZUGFeRDPDF(inv *Invoice, ownerID uint, xmlpath string, pdfpath string, logger *slog.Logger) error {
+	return s.createZUGFeRDPDFBag(inv, ownerID, xmlpath, pdfpath, true, logger)
 }
 
 // AutoLayoutNote describes, for the UI, what the "Automatisch" letterhead
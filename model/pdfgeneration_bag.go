@@ -24,11 +24,16 @@ import (
 // "invoice.css" in the owner's asset directory is appended after the built-in
 // CSS and can restyle the fixed, documented HTML scaffold (see
 // docs/invoice-css.md).
+//
+// With plain set, a selected letterhead template is ignored and the generic
+// A4 layout is used, e.g. for internal copies without the letterhead.
+//
+// Drafts get a diagonal watermark on every page (pdf_watermark.go).
 
-func (s *Store) createZUGFeRDPDFBag(inv *Invoice, ownerID uint, xmlpath string, pdfpath string, logger *slog.Logger) error {
+func (s *Store) createZUGFeRDPDFBag(inv *Invoice, ownerID uint, xmlpath string, pdfpath string, plain bool, logger *slog.Logger) error {
 	// Reuse the exact same computation as the embedded XML so the printed
 	// amounts (net, per-rate tax, grand total) match the ZUGFeRD data.
-	settings, err := s.LoadSettings(ownerID)
+	settings, err := s.LoadSettingsForCurrency(ownerID, inv.Currency)
 	if err != nil {
 		return fmt.Errorf("load settings: %w", err)
 	}
@@ -38,27 +43,48 @@ func (s *Store) createZUGFeRDPDFBag(inv *Invoice, ownerID uint, xmlpath string,
 	}
 	zi := createZUGFerdXML(inv, settings, company)
 
-	// The CII XML was already written to xmlpath by WriteZUGFeRDXML. Embedding
-	// it via WithZUGFeRD also switches the output to PDF/A-3b and adds the
-	// required XMP extension schema.
+	// The CII XML was already written to xmlpath by WriteZUGFeRDXML. It is
+	// embedded as factur-x.xml in a PDF/A-3b document with the Factur-X XMP
+	// metadata (pdf_facturx.go).
 	xmlData, err := os.ReadFile(xmlpath)
 	if err != nil {
 		return fmt.Errorf("read ZUGFeRD xml %q: %w", xmlpath, err)
 	}
 
-	d, err := document.New(pdfpath, document.WithZUGFeRD(xmlData, "EN 16931"))
+	d, err := document.New(pdfpath, facturXOptions(xmlData)...)
 	if err != nil {
 		return fmt.Errorf("create pdf document: %w", err)
 	}
-	d.Title = fmt.Sprintf("Rechnung %s", inv.Number)
+	addFacturXMetadata(d, inv.ZugferdProfile.conformanceLevel())
+	d.Title = fmt.Sprintf("%s %s", inv.DocumentType.Title(), inv.Number)
 	d.Author = settings.CompanyName
 	d.Language = "de"
 
+	// PDF attachments of the invoice are embedded as associated files as
+	// well: einvoice lists them in the XML (BG-24) but does not write the
+	// binary content, so this is how they travel with the invoice.
+	docs, err := s.attachmentDocuments(inv.ID, ownerID)
+	if err != nil {
+		return fmt.Errorf("load attachments: %w", err)
+	}
+	for _, doc := range docs {
+		d.AttachFile(document.Attachment{
+			Name:        doc.AttachmentFilename,
+			Description: "Anlage zu " + inv.Number,
+			MimeType:    doc.AttachmentMimeCode,
+			Data:        doc.AttachmentBinaryObject,
+		})
+	}
+
+	if text := draftWatermark(inv); text != "" {
+		addWatermark(d, text, logger)
+	}
+
 	// Mode 2 (letterhead + regions) vs. mode 1 (generic). inv is loaded via
 	// LoadInvoiceWithTemplate, so Template and its Regions are preloaded when the
 	// invoice references a template.
-	if inv.TemplateID != nil && inv.Template != nil {
-		err = s.layoutLetterheadInvoice(d, inv, company, &zi, ownerID)
+	if !plain && inv.TemplateID != nil && inv.Template != nil {
+		err = s.layoutLetterheadInvoice(d, inv, settings, company, &zi, ownerID)
 	} else {
 		err = s.layoutGenericInvoice(d, inv, settings, company, &zi, ownerID, logger)
 	}
@@ -2,6 +2,7 @@ package model_test
 
 import (
 	"bytes"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"log/slog"
@@ -64,6 +65,98 @@ func TestCreateZUGFeRDPDF_Generic(t *testing.T) {
 	}
 }
 
+// TestCreateZUGFeRDPDF_FacturXMetadata checks what strict validators such as
+// Mustang look for: the CII as associated file factur-x.xml with
+// AFRelationship Alternative, the PDF/A-3b identification with an output
+// intent, and the Factur-X XMP extension with the invoice's conformance level.
+func TestCreateZUGFeRDPDF_FacturXMetadata(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	inv, err := store.LoadInvoiceWithTemplate(td.Invoice.ID, owner)
+	if err != nil {
+		t.Fatalf("load invoice: %v", err)
+	}
+	inv.ZugferdProfile = model.ZugferdProfileBasic
+	if err = store.UpdateInvoice(inv, owner); err != nil {
+		t.Fatalf("update invoice: %v", err)
+	}
+	if inv, err = store.LoadInvoiceWithTemplate(td.Invoice.ID, owner); err != nil {
+		t.Fatalf("load invoice: %v", err)
+	}
+
+	dir := t.TempDir()
+	xmlPath := filepath.Join(dir, "invoice.xml")
+	pdfPath := filepath.Join(dir, "invoice.pdf")
+	if err = store.WriteZUGFeRDXML(inv, owner, xmlPath); err != nil {
+		t.Fatalf("write zugferd xml: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err = store.CreateZUGFeRDPDF(inv, owner, xmlPath, pdfPath, logger); err != nil {
+		t.Fatalf("create pdf: %v", err)
+	}
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+
+	for _, want := range []string{
+		"/AFRelationship /Alternative",
+		"/F (factur-x.xml)",
+		"/Subtype /text#2fxml",
+		"/AF [",
+		"/S /GTS_PDFA1",
+		"<pdfaid:part>3</pdfaid:part>",
+		"<pdfaid:conformance>B</pdfaid:conformance>",
+		`xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#"`,
+		`fx:DocumentFileName="factur-x.xml"`,
+		`fx:DocumentType="INVOICE"`,
+		`fx:Version="1.0"`,
+		`fx:ConformanceLevel="BASIC"`,
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("PDF lacks %s", want)
+		}
+	}
+	if bytes.Contains(data, []byte("urn:ferd:pdfa")) {
+		t.Error("PDF declares the ZUGFeRD 1.0 XMP schema")
+	}
+
+	// The embedded file is the CII written before.
+	want, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := embeddedFile(t, data); !bytes.Equal(got, want) {
+		t.Errorf("embedded XML differs from %s (%d vs. %d bytes)", xmlPath, len(got), len(want))
+	}
+}
+
+// embeddedFile returns the decompressed content of the first
+// /EmbeddedFile stream in the PDF.
+func embeddedFile(t *testing.T, pdf []byte) []byte {
+	t.Helper()
+	i := bytes.Index(pdf, []byte("/Type /EmbeddedFile"))
+	if i < 0 {
+		t.Fatal("PDF has no embedded file")
+	}
+	start := bytes.Index(pdf[i:], []byte("stream\n"))
+	end := bytes.Index(pdf[i:], []byte("\nendstream"))
+	if start < 0 || end < start {
+		t.Fatal("embedded file stream not found")
+	}
+	r, err := zlib.NewReader(bytes.NewReader(pdf[i+start+len("stream\n") : i+end]))
+	if err != nil {
+		t.Fatalf("embedded file: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("embedded file: %v", err)
+	}
+	return out
+}
+
 // TestCreateZUGFeRDPDF_Generic_UserCSS checks the mode-3/B1 path: an
 // "invoice.css" in the owner's asset directory restyles the generic layout
 // (bar color, custom font via a relative @font-face url), and a broken
@@ -193,3 +286,35 @@ func TestCreateZUGFeRDPDF_Generic_MultiPage(t *testing.T) {
 		t.Logf("copied PDF to %s", out)
 	}
 }
+
+func TestCreateZUGFeRDPDF_DraftWatermark(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+
+	inv, err := store.LoadInvoiceWithTemplate(td.Invoice.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("load invoice: %v", err)
+	}
+	if inv.Status != model.InvoiceStatusDraft {
+		t.Fatalf("seeded invoice is %q, want draft", inv.Status)
+	}
+
+	dir := t.TempDir()
+	xmlPath := filepath.Join(dir, "invoice.xml")
+	pdfPath := filepath.Join(dir, "invoice.pdf")
+	if err = store.WriteZUGFeRDXML(inv, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("write zugferd xml: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err = store.CreateZUGFeRDPDF(inv, fixtures.DefaultOwnerID, xmlPath, pdfPath, logger); err != nil {
+		t.Fatalf("create pdf: %v", err)
+	}
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+	pages := bytes.Count(data, []byte("/Type /Page")) - bytes.Count(data, []byte("/Type /Pages"))
+	if got := fixtures.PDFWatermarks(t, data); got != pages {
+		t.Errorf("draft PDF has %d watermarks on %d pages", got, pages)
+	}
+}
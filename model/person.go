@@ -28,6 +28,22 @@ type Person struct {
 	Notes []Note `gorm:"polymorphic:Parent;polymorphicValue:person;constraint:OnDelete:CASCADE;"`
 }
 
+// PrimaryEmail returns the person's main e-mail address: a contact info
+// marked as primary, else the EMail field, else the best "email" contact info.
+// Returns nil if the person has no e-mail address.
+func (p Person) PrimaryEmail() *ContactInfo {
+	ci := primaryContactInfo(p.ContactInfos, "email")
+	if (ci == nil || !ci.IsPrimary) && p.EMail != "" {
+		return &ContactInfo{Type: "email", Value: p.EMail, OwnerID: p.OwnerID, ParentType: ParentTypePerson, ParentID: p.ID}
+	}
+	return ci
+}
+
+// PrimaryPhone returns the person's main phone number or nil.
+func (p Person) PrimaryPhone() *ContactInfo {
+	return primaryContactInfo(p.ContactInfos, "phone")
+}
+
 // HasDeparted returns true if the person has left the company
 func (p *Person) HasDeparted() bool {
 	return p.DepartedAt != nil
@@ -240,6 +256,22 @@ func (s *Store) ListPersonsForExportCtx(
 	return persons, nil
 }
 
+// ListCompanyPersonsForExportCtx is ListPersonsForExportCtx for the contacts
+// of one company.
+func (s *Store) ListCompanyPersonsForExportCtx(ctx context.Context, companyID, ownerID uint) ([]Person, error) {
+	var persons []Person
+	err := s.db.WithContext(ctx).
+		Where("owner_id = ? AND company_id = ?", ownerID, companyID).
+		Preload("ContactInfos").
+		Preload("Notes").
+		Order("id ASC").
+		Find(&persons).Error
+	if err != nil {
+		return nil, fmt.Errorf("list persons of company %d for export (owner %d): %w", companyID, ownerID, err)
+	}
+	return persons, nil
+}
+
 // DepartPersonResult contains the result of a DepartPerson operation
 type DepartPersonResult struct {
 	Person *Person
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PersonDuplicateGroup is a set of people of one company that share the same
+// e-mail address. Persons are ordered by ID, so the first one is the oldest
+// record.
+type PersonDuplicateGroup struct {
+	CompanyID   int
+	CompanyName string
+	EMail       string // normalized (trimmed, lower case)
+	Persons     []Person
+}
+
+// normalizeEMail returns the form used to compare e-mail addresses.
+func normalizeEMail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// FindDuplicatePersons groups the owner's people by company and normalized
+// e-mail address and returns every group with more than one person. People
+// without an e-mail address are never considered duplicates.
+func (s *Store) FindDuplicatePersons(ownerID uint) ([]PersonDuplicateGroup, error) {
+	var people []Person
+	if err := s.db.Preload("Company").
+		Where("owner_id = ? AND e_mail IS NOT NULL AND TRIM(e_mail) <> ''", ownerID).
+		Order("id ASC").
+		Find(&people).Error; err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		companyID int
+		email     string
+	}
+	groups := make(map[key]*PersonDuplicateGroup)
+	var order []key
+	for _, p := range people {
+		k := key{p.CompanyID, normalizeEMail(p.EMail)}
+		g, ok := groups[k]
+		if !ok {
+			g = &PersonDuplicateGroup{CompanyID: p.CompanyID, CompanyName: p.Company.Name, EMail: k.email}
+			groups[k] = g
+			order = append(order, k)
+		}
+		g.Persons = append(g.Persons, p)
+	}
+
+	var out []PersonDuplicateGroup
+	for _, k := range order {
+		if g := groups[k]; len(g.Persons) > 1 {
+			out = append(out, *g)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].CompanyName != out[j].CompanyName {
+			return out[i].CompanyName < out[j].CompanyName
+		}
+		return out[i].EMail < out[j].EMail
+	})
+	return out, nil
+}
+
+// ErrMergeSamePerson is returned by MergePersons if both IDs are equal.
+var ErrMergeSamePerson = errors.New("cannot merge a person into itself")
+
+// MergePersons folds the person mergeID into keepID and deletes mergeID.
+// Notes, contact infos and tag links are moved to the kept person; contact
+// infos and tags the kept person already has are dropped instead of being
+// duplicated. Empty fields of the kept person are filled from the merged one.
+// Both people must belong to ownerID.
+func (s *Store) MergePersons(ownerID, keepID, mergeID uint) error {
+	if keepID == mergeID {
+		return ErrMergeSamePerson
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var keep, merge Person
+		if err := tx.Where("id = ? AND owner_id = ?", keepID, ownerID).First(&keep).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND owner_id = ?", mergeID, ownerID).First(&merge).Error; err != nil {
+			return err
+		}
+
+		// Fill gaps on the kept record.
+		fill := map[string]any{}
+		if strings.TrimSpace(keep.Position) == "" && merge.Position != "" {
+			fill["position"] = merge.Position
+		}
+		if strings.TrimSpace(keep.EMail) == "" && merge.EMail != "" {
+			fill["e_mail"] = merge.EMail
+		}
+		if keep.CompanyID == 0 && merge.CompanyID != 0 {
+			fill["company_id"] = merge.CompanyID
+		}
+		if len(fill) > 0 {
+			if err := tx.Model(&Person{}).Where("id = ? AND owner_id = ?", keepID, ownerID).
+				Updates(fill).Error; err != nil {
+				return err
+			}
+		}
+
+		// Notes
+		if err := tx.Model(&Note{}).
+			Where("owner_id = ? AND parent_type = ? AND parent_id = ?", ownerID, ParentTypePerson, mergeID).
+			Update("parent_id", keepID).Error; err != nil {
+			return err
+		}
+
+		// Contact infos: drop those the kept person already has, move the rest.
+		samePerson := "owner_id = ? AND parent_type = ? AND parent_id = ?"
+		if err := tx.Where(samePerson, ownerID, ParentTypePerson, mergeID).
+			Where("EXISTS (SELECT 1 FROM contact_infos k WHERE k.owner_id = contact_infos.owner_id AND k.parent_type = contact_infos.parent_type AND k.parent_id = ? AND k.type = contact_infos.type AND k.value = contact_infos.value AND k.deleted_at IS NULL)", keepID).
+			Delete(&ContactInfo{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&ContactInfo{}).Where(samePerson, ownerID, ParentTypePerson, mergeID).
+			Update("parent_id", keepID).Error; err != nil {
+			return err
+		}
+
+		// Tag links: same approach as RenameTag. A tag both people carry
+		// stays on the kept person (revived if it was removed there) and the
+		// merged link is dropped, so re-pointing cannot hit the unique index.
+		sameTag := "EXISTS (SELECT 1 FROM tag_links o WHERE o.owner_id = tag_links.owner_id AND o.tag_id = tag_links.tag_id AND o.parent_type = tag_links.parent_type AND o.parent_id = ?"
+		if err := tx.Model(&TagLink{}).Unscoped().
+			Where(samePerson+" AND deleted_at IS NOT NULL", ownerID, ParentTypePerson, keepID).
+			Where(sameTag+" AND o.deleted_at IS NULL)", mergeID).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().
+			Where(samePerson, ownerID, ParentTypePerson, mergeID).
+			Where(sameTag+")", keepID).
+			Delete(&TagLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&TagLink{}).Unscoped().
+			Where(samePerson, ownerID, ParentTypePerson, mergeID).
+			Update("parent_id", keepID).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ? AND owner_id = ?", mergeID, ownerID).Delete(&Person{}).Error
+	})
+}
@@ -1,6 +1,7 @@
 package model_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/billingcat/crm/fixtures"
@@ -140,3 +141,85 @@ func TestPerson_HasDeparted(t *testing.T) {
 		t.Error("Departed person should return HasDeparted() = true")
 	}
 }
+
+func TestFindDuplicatePersons(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	cid := int(data.Company.ID)
+
+	for _, p := range []*model.Person{
+		fixtures.Person(fixtures.WithPersonName("Max M."), fixtures.WithPersonEmail(" MAX@example.com"), fixtures.WithPersonCompanyID(cid)),
+		fixtures.Person(fixtures.WithPersonName("Ohne Mail 1"), fixtures.WithPersonEmail(""), fixtures.WithPersonCompanyID(cid)),
+		fixtures.Person(fixtures.WithPersonName("Ohne Mail 2"), fixtures.WithPersonEmail(""), fixtures.WithPersonCompanyID(cid)),
+		// Same address at another company is not a duplicate.
+		fixtures.Person(fixtures.WithPersonName("Max anderswo")),
+	} {
+		if err := store.SavePerson(p, fixtures.DefaultOwnerID, nil); err != nil {
+			t.Fatalf("SavePerson failed: %v", err)
+		}
+	}
+
+	groups, err := store.FindDuplicatePersons(fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("FindDuplicatePersons failed: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("groups = %d, want 1", len(groups))
+	}
+	if g := groups[0]; g.EMail != "max@example.com" || len(g.Persons) != 2 || g.Persons[0].ID != data.Person.ID {
+		t.Errorf("group = %q with %d persons (first %d), want max@example.com with 2 (first %d)",
+			g.EMail, len(g.Persons), g.Persons[0].ID, data.Person.ID)
+	}
+}
+
+func TestMergePersons(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	keep := data.Person
+
+	dup := fixtures.Person(fixtures.WithPersonCompanyID(int(data.Company.ID)))
+	dup.ContactInfos = []model.ContactInfo{
+		{Type: "phone", Value: "030 123"},
+		{Type: "email", Value: "privat@example.com"},
+	}
+	if err := store.SavePerson(dup, fixtures.DefaultOwnerID, []string{"VIP", "Newsletter"}); err != nil {
+		t.Fatalf("SavePerson failed: %v", err)
+	}
+	keep.ContactInfos = []model.ContactInfo{{Type: "phone", Value: "030 123"}}
+	if err := store.SavePerson(keep, fixtures.DefaultOwnerID, []string{"VIP"}); err != nil {
+		t.Fatalf("SavePerson failed: %v", err)
+	}
+	note := &model.Note{OwnerID: fixtures.DefaultOwnerID, ParentType: model.ParentTypePerson, ParentID: dup.ID, Title: "Anruf"}
+	if err := store.CreateNote(note); err != nil {
+		t.Fatalf("CreateNote failed: %v", err)
+	}
+
+	if err := store.MergePersons(fixtures.DefaultOwnerID+1, keep.ID, dup.ID); err == nil {
+		t.Error("merging people of another owner should fail")
+	}
+	if err := store.MergePersons(fixtures.DefaultOwnerID, keep.ID, keep.ID); !errors.Is(err, model.ErrMergeSamePerson) {
+		t.Errorf("merge into itself: err = %v, want ErrMergeSamePerson", err)
+	}
+	if err := store.MergePersons(fixtures.DefaultOwnerID, keep.ID, dup.ID); err != nil {
+		t.Fatalf("MergePersons failed: %v", err)
+	}
+
+	if _, err := store.LoadPerson(dup.ID, fixtures.DefaultOwnerID); err == nil {
+		t.Error("merged person should be deleted")
+	}
+	got, err := store.LoadPerson(keep.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadPerson failed: %v", err)
+	}
+	if len(got.ContactInfos) != 2 {
+		t.Errorf("contact infos = %d, want 2 (duplicate phone dropped)", len(got.ContactInfos))
+	}
+	notes, err := store.LoadAllNotesForParent(fixtures.DefaultOwnerID, model.ParentTypePerson, keep.ID)
+	if err != nil || len(notes) != 1 {
+		t.Errorf("notes = %d (%v), want 1", len(notes), err)
+	}
+	tags, err := store.ListTagsForParent(fixtures.DefaultOwnerID, model.ParentTypePerson, keep.ID)
+	if err != nil || len(tags) != 2 {
+		t.Errorf("tags = %d (%v), want 2", len(tags), err)
+	}
+}
@@ -1,7 +1,9 @@
 package model
 
 import (
+	"fmt"
 	"html/template"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -31,6 +33,43 @@ type ContactInfo struct {
 	Type  string `gorm:"size:30;index"` // Kind of contact info
 	Label string `gorm:"size:100"`      // e.g. “Office”, “HQ”, “Support”
 	Value string `gorm:"size:300"`      // Actual data (phone number, email, URL, etc.)
+
+	IsPrimary bool `gorm:"not null;default:false"` // Marked by the user as the main entry of its Type
+}
+
+// mainLabels are labels that mark an entry as the main one if none is
+// explicitly flagged as primary.
+var mainLabels = []string{"main", "haupt"}
+
+// primaryContactInfo picks the entry of the given type to show first: the
+// one flagged IsPrimary, else one labeled "main", else the first of that type.
+// Returns nil if there is no entry of the type.
+func primaryContactInfo(infos []ContactInfo, typ string) *ContactInfo {
+	var labeled, first *ContactInfo
+	for i := range infos {
+		ci := &infos[i]
+		if ci.Type != typ {
+			continue
+		}
+		if ci.IsPrimary {
+			return ci
+		}
+		if first == nil {
+			first = ci
+		}
+		if labeled == nil {
+			for _, l := range mainLabels {
+				if strings.EqualFold(strings.TrimSpace(ci.Label), l) {
+					labeled = ci
+					break
+				}
+			}
+		}
+	}
+	if labeled != nil {
+		return labeled
+	}
+	return first
 }
 
 // Href returns a URI-ready representation of the contact info's value.
@@ -134,3 +173,75 @@ func (s *Store) DeletePhone(id any) error {
 	}
 	return nil
 }
+
+// ContactInfoMatch is a company or person found through one of its contact
+// infos. Type and Value describe the entry that matched.
+type ContactInfoMatch struct {
+	ParentType ParentType
+	ParentID   uint
+	Name       string
+	Type       string
+	Value      string
+}
+
+// FindByContactInfo performs a case-insensitive substring search on the values
+// of contact infos (phone numbers, e-mail addresses, URLs, ...) within an owner
+// scope and returns the companies and people they belong to. The e-mail
+// address stored on the person itself is searched as well. Each parent is
+// returned once, with the first matching entry. Uses ILIKE on PostgreSQL and
+// LOWER(value) LIKE on other dialects, like FindAllCompaniesWithText.
+func (s *Store) FindByContactInfo(ownerID uint, text string) ([]ContactInfoMatch, error) {
+	like := "%" + likeEscape(text) + "%"
+	cond := "LOWER(%s) LIKE LOWER(?) ESCAPE '\\'"
+	if s.db.Dialector.Name() == "postgres" {
+		cond = "%s ILIKE ? ESCAPE '\\'"
+	}
+
+	var rows []ContactInfoMatch
+	for _, pt := range []ParentType{ParentTypeCompany, ParentTypePerson} {
+		table := "companies"
+		if pt == ParentTypePerson {
+			table = "people"
+		}
+		var found []ContactInfoMatch
+		err := s.db.Table("contact_infos").
+			Select("contact_infos.parent_type, contact_infos.parent_id, "+table+".name, contact_infos.type, contact_infos.value").
+			Joins("JOIN "+table+" ON "+table+".id = contact_infos.parent_id AND "+table+".deleted_at IS NULL").
+			Where("contact_infos.owner_id = ? AND "+table+".owner_id = ? AND contact_infos.parent_type = ? AND contact_infos.deleted_at IS NULL",
+				ownerID, ownerID, pt).
+			Where(fmt.Sprintf(cond, "contact_infos.value"), like).
+			Order(table + ".name, contact_infos.id").
+			Scan(&found).Error
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, found...)
+	}
+
+	var people []Person
+	if err := s.db.Where("owner_id = ?", ownerID).
+		Where(fmt.Sprintf(cond, "e_mail"), like).
+		Order("name").
+		Find(&people).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range people {
+		rows = append(rows, ContactInfoMatch{ParentType: ParentTypePerson, ParentID: p.ID, Name: p.Name, Type: "email", Value: p.EMail})
+	}
+
+	type key struct {
+		pt ParentType
+		id uint
+	}
+	seen := make(map[key]bool, len(rows))
+	out := rows[:0]
+	for _, r := range rows {
+		k := key{r.ParentType, r.ParentID}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, r)
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestFindByContactInfo(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	data.Company.ContactInfos = []model.ContactInfo{{Type: "phone", Label: "Zentrale", Value: "+49 30 555 1234"}}
+	if err := store.SaveCompany(data.Company, fixtures.DefaultOwnerID, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	data.Person.ContactInfos = []model.ContactInfo{
+		{Type: "phone", Value: "0171 555 1234"},
+		{Type: "email", Value: "Max.Privat@Example.org"},
+	}
+	if err := store.SavePerson(data.Person, fixtures.DefaultOwnerID, nil); err != nil {
+		t.Fatalf("SavePerson failed: %v", err)
+	}
+	foreign := fixtures.Person(fixtures.WithPersonOwnerID(fixtures.DefaultOwnerID + 1))
+	foreign.ContactInfos = []model.ContactInfo{{Type: "phone", Value: "555 1234"}}
+	if err := store.SavePerson(foreign, fixtures.DefaultOwnerID+1, nil); err != nil {
+		t.Fatalf("SavePerson failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []model.ParentType
+	}{
+		{"555 1234", []model.ParentType{model.ParentTypeCompany, model.ParentTypePerson}},
+		{"max.privat@example", []model.ParentType{model.ParentTypePerson}},
+		// The e-mail on the person record itself.
+		{"MAX@EXAMPLE.COM", []model.ParentType{model.ParentTypePerson}},
+		{"nichts", nil},
+	}
+	for _, tt := range tests {
+		got, err := store.FindByContactInfo(fixtures.DefaultOwnerID, tt.query)
+		if err != nil {
+			t.Fatalf("%q: FindByContactInfo failed: %v", tt.query, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: %d matches, want %d: %+v", tt.query, len(got), len(tt.want), got)
+			continue
+		}
+		for i, m := range got {
+			if m.ParentType != tt.want[i] {
+				t.Errorf("%q: match %d is a %s, want %s", tt.query, i, m.ParentType, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPrimaryContactInfo(t *testing.T) {
+	p := model.Person{EMail: "max@example.com", ContactInfos: []model.ContactInfo{
+		{Type: "phone", Label: "Mobil", Value: "0171"},
+		{Type: "phone", Label: "Main", Value: "030"},
+		{Type: "email", Label: "Privat", Value: "privat@example.com"},
+	}}
+	if got := p.PrimaryPhone(); got == nil || got.Value != "030" {
+		t.Errorf("PrimaryPhone = %+v, want the entry labeled main", got)
+	}
+	// The e-mail field of the person wins over an unmarked contact info.
+	if got := p.PrimaryEmail(); got == nil || got.Value != "max@example.com" {
+		t.Errorf("PrimaryEmail = %+v, want max@example.com", got)
+	}
+
+	p.ContactInfos[0].IsPrimary = true
+	p.ContactInfos[2].IsPrimary = true
+	if got := p.PrimaryPhone(); got == nil || got.Value != "0171" {
+		t.Errorf("PrimaryPhone = %+v, want the entry marked primary", got)
+	}
+	if got := p.PrimaryEmail(); got == nil || got.Value != "privat@example.com" {
+		t.Errorf("PrimaryEmail = %+v, want the entry marked primary", got)
+	}
+
+	var c model.Company
+	if c.PrimaryPhone() != nil || c.PrimaryEmail() != nil {
+		t.Error("company without contact infos should have no primary entries")
+	}
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Product is an entry of the owner's catalog of products and services. The
+// invoice editor offers products to pre-fill a position; the position keeps
+// its own copy of the values, so editing or deleting a product never changes
+// existing invoices.
+type Product struct {
+	ID              uint            `gorm:"primaryKey"`
+	CreatedAt       time.Time       `gorm:"not null"`
+	UpdatedAt       time.Time       `gorm:"not null"`
+	OwnerID         uint            `gorm:"not null;index"`
+	Name            string          `gorm:"not null"`
+	DefaultUnit     string          `gorm:"not null;default:''"` // unit code as in InvoicePosition.UnitCode, e.g. "HUR"
+	DefaultNetPrice decimal.Decimal `gorm:"type:text;not null;default:'0'"`
+	DefaultTaxRate  decimal.Decimal `gorm:"type:text;not null;default:'0'"` // percent
+}
+
+func (Product) TableName() string { return "products" }
+
+// ListProducts returns the owner's products ordered by name.
+func (s *Store) ListProducts(ownerID uint) ([]Product, error) {
+	var products []Product
+	err := s.db.Where("owner_id = ?", ownerID).Order("LOWER(name) ASC, id ASC").Find(&products).Error
+	return products, err
+}
+
+// LoadProduct loads one product of the owner.
+func (s *Store) LoadProduct(id, ownerID uint) (*Product, error) {
+	var p Product
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveProduct creates (ID 0) or updates a product. The name is required,
+// price and tax rate must not be negative.
+func (s *Store) SaveProduct(p *Product) error {
+	if p.OwnerID == 0 {
+		return errors.New("SaveProduct: OwnerID required")
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	p.DefaultUnit = strings.TrimSpace(p.DefaultUnit)
+	if p.Name == "" {
+		return errors.New("name required")
+	}
+	if p.DefaultNetPrice.IsNegative() {
+		return errors.New("price must not be negative")
+	}
+	if p.DefaultTaxRate.IsNegative() || p.DefaultTaxRate.GreaterThan(hundred) {
+		return errors.New("tax rate must be between 0 and 100")
+	}
+	if p.ID != 0 {
+		existing, err := s.LoadProduct(p.ID, p.OwnerID)
+		if err != nil {
+			return err
+		}
+		p.CreatedAt = existing.CreatedAt
+	}
+	return s.db.Save(p).Error
+}
+
+// DeleteProduct removes a product of the owner. Invoices are not affected.
+func (s *Store) DeleteProduct(id, ownerID uint) error {
+	res := s.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&Product{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SuggestProducts returns up to limit products of the owner whose name
+// contains q (case-insensitive), ordered by name. An empty q yields no
+// products.
+func (s *Store) SuggestProducts(ownerID uint, q string, limit int) ([]Product, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return []Product{}, nil
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	like := "%" + likeEscape(q) + "%"
+	query := s.db.Where("owner_id = ?", ownerID)
+	switch s.db.Dialector.Name() {
+	case "postgres":
+		query = query.Where("name ILIKE ? ESCAPE '\\'", like)
+	default: // sqlite, mysql/mariadb
+		query = query.Where("LOWER(name) LIKE LOWER(?) ESCAPE '\\'", like)
+	}
+	products := []Product{}
+	err := query.Order("LOWER(name) ASC, id ASC").Limit(limit).Find(&products).Error
+	return products, err
+}
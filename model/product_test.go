@@ -0,0 +1,70 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func TestProducts_SaveSuggestDelete(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+
+	for _, name := range []string{"Beratung vor Ort", "Remote-Beratung", "Lizenz 100%"} {
+		p := &model.Product{
+			OwnerID:         owner,
+			Name:            name,
+			DefaultUnit:     "HUR",
+			DefaultNetPrice: decimal.RequireFromString("95.5"),
+			DefaultTaxRate:  decimal.NewFromInt(19),
+		}
+		if err := store.SaveProduct(p); err != nil {
+			t.Fatalf("SaveProduct(%q) failed: %v", name, err)
+		}
+	}
+	other := &model.Product{OwnerID: owner + 1, Name: "Beratung (fremd)"}
+	if err := store.SaveProduct(other); err != nil {
+		t.Fatalf("SaveProduct failed: %v", err)
+	}
+	if err := store.SaveProduct(&model.Product{OwnerID: owner, Name: "  "}); err == nil {
+		t.Error("SaveProduct without name should fail")
+	}
+
+	got, err := store.SuggestProducts(owner, "BERATUNG", 10)
+	if err != nil {
+		t.Fatalf("SuggestProducts failed: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "Beratung vor Ort" || got[1].Name != "Remote-Beratung" {
+		t.Fatalf("SuggestProducts = %+v, want both Beratung products of the owner", got)
+	}
+	if !got[0].DefaultNetPrice.Equal(decimal.RequireFromString("95.5")) || got[0].DefaultUnit != "HUR" {
+		t.Errorf("product = %+v, want unit HUR and price 95.5", got[0])
+	}
+	// LIKE wildcards are matched literally
+	if got, _ := store.SuggestProducts(owner, "%", 10); len(got) != 1 || got[0].Name != "Lizenz 100%" {
+		t.Errorf("SuggestProducts(%%) = %+v, want only the Lizenz product", got)
+	}
+
+	// updating a product of another owner fails
+	other.OwnerID = owner
+	if err := store.SaveProduct(other); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("SaveProduct of foreign product: err = %v, want ErrRecordNotFound", err)
+	}
+	if err := store.DeleteProduct(got[0].ID, owner+1); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteProduct of foreign owner: err = %v, want ErrRecordNotFound", err)
+	}
+	if err := store.DeleteProduct(got[0].ID, owner); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	list, err := store.ListProducts(owner)
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("ListProducts returned %d products, want 2", len(list))
+	}
+}
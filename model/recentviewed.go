@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"sort"
 	"time"
 
@@ -17,27 +18,49 @@ const (
 	EntityPerson EntityType = "person"
 )
 
-// RecentView tracks recently viewed entities by users
+// RecentView tracks recently viewed entities by users. The controllers
+// record the views per owner, so UserID holds the owner ID.
 type RecentView struct {
-	UserID     uint       `gorm:"not null;index:idx_user_view,priority:1"`
-	EntityType EntityType `gorm:"type:text;not null;index:idx_user_view,priority:2"`
-	EntityID   uint       `gorm:"not null;index:idx_user_view,priority:3"`
+	UserID     uint       `gorm:"not null;uniqueIndex:idx_recent_view,priority:1"`
+	EntityType EntityType `gorm:"type:text;not null;uniqueIndex:idx_recent_view,priority:2"`
+	EntityID   uint       `gorm:"not null;uniqueIndex:idx_recent_view,priority:3"`
 	ViewedAt   time.Time  `gorm:"not null;index:idx_user_viewed_at,priority:2"`
 }
 
+// maxRecentViews is the number of recent views kept per owner; older ones
+// are dropped by TouchRecentView.
+const maxRecentViews = 50
+
 // TableName sets the table name for RecentView
 func (RecentView) TableName() string { return "recent_views" }
 
-// TouchRecentView updates or creates a recent view entry for the given user and entity
+// TouchRecentView updates or creates a recent view entry for the given user
+// and entity. Viewing an entity again only moves it to the top (the unique
+// index allows one entry per entity), and only the newest maxRecentViews
+// entries of the user are kept.
 func (s *Store) TouchRecentView(userID uint, et EntityType, entityID uint) error {
 	db := s.db
 	rv := RecentView{
 		UserID: userID, EntityType: et, EntityID: entityID, ViewedAt: time.Now(),
 	}
-	return db.Clauses(clause.OnConflict{
+	if err := db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "user_id"}, {Name: "entity_type"}, {Name: "entity_id"}},
 		DoUpdates: clause.AssignmentColumns([]string{"viewed_at"}),
-	}).Create(&rv).Error
+	}).Create(&rv).Error; err != nil {
+		return err
+	}
+	return db.Exec(`
+        DELETE FROM recent_views
+        WHERE user_id = ? AND viewed_at < (
+            SELECT viewed_at FROM recent_views
+            WHERE user_id = ?
+            ORDER BY viewed_at DESC
+            LIMIT 1 OFFSET ?)`, userID, userID, maxRecentViews-1).Error
+}
+
+// ClearRecentItems removes the recent views of the owner ("clear history").
+func (s *Store) ClearRecentItems(ownerID uint) error {
+	return s.db.Where("user_id = ?", ownerID).Delete(&RecentView{}).Error
 }
 
 // RecentItem represents a recently viewed item with its details
@@ -46,6 +69,7 @@ type RecentItem struct {
 	EntityID   uint
 	ViewedAt   time.Time
 	Name       string // Firmenname oder Personenname
+	URL        string // detail page of the item
 }
 
 // GetRecentItems retrieves the most recently viewed items for a user, limited by the specified number
@@ -57,7 +81,7 @@ func (s *Store) GetRecentItems(userID uint, limit int) ([]RecentItem, error) {
 	if err := db.Raw(`
         SELECT r.entity_type, r.entity_id, r.viewed_at, c.name
         FROM recent_views r
-        JOIN companies c ON c.id = r.entity_id
+        JOIN companies c ON c.id = r.entity_id AND c.deleted_at IS NULL
         WHERE r.user_id = ? AND r.entity_type = 'company'
         ORDER BY r.viewed_at DESC
         LIMIT ?`, userID, limit).Scan(&companies).Error; err != nil {
@@ -69,7 +93,7 @@ func (s *Store) GetRecentItems(userID uint, limit int) ([]RecentItem, error) {
         SELECT r.entity_type, r.entity_id, r.viewed_at,
                COALESCE(NULLIF(TRIM(p.name), ''), p.e_mail, 'Unbenannt') AS name
         FROM recent_views r
-        JOIN people p ON p.id = r.entity_id
+        JOIN people p ON p.id = r.entity_id AND p.deleted_at IS NULL
         WHERE r.user_id = ? AND r.entity_type = 'person'
         ORDER BY r.viewed_at DESC
         LIMIT ?`, userID, limit).Scan(&people).Error; err != nil {
@@ -82,5 +106,8 @@ func (s *Store) GetRecentItems(userID uint, limit int) ([]RecentItem, error) {
 	if len(items) > limit {
 		items = items[:limit]
 	}
+	for i := range items {
+		items[i].URL = fmt.Sprintf("/%s/%d", items[i].EntityType, items[i].EntityID)
+	}
 	return items, nil
 }
@@ -0,0 +1,87 @@
+package model_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestRecentItems(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	for _, v := range []struct {
+		et model.EntityType
+		id uint
+	}{
+		{model.EntityCompany, data.Company.ID},
+		{model.EntityPerson, data.Person.ID},
+		{model.EntityCompany, data.Company.ID}, // again: moves to the top
+	} {
+		if err := store.TouchRecentView(owner, v.et, v.id); err != nil {
+			t.Fatalf("TouchRecentView failed: %v", err)
+		}
+	}
+	items, err := store.GetRecentItems(owner, 10)
+	if err != nil {
+		t.Fatalf("GetRecentItems failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("items = %+v, want company and person once", items)
+	}
+	wantURL := fmt.Sprintf("/company/%d", data.Company.ID)
+	if items[0].EntityType != model.EntityCompany || items[0].URL != wantURL {
+		t.Errorf("first item = %s %q, want company %q", items[0].EntityType, items[0].URL, wantURL)
+	}
+	if items[1].EntityType != model.EntityPerson || items[1].URL != fmt.Sprintf("/person/%d", data.Person.ID) {
+		t.Errorf("second item = %s %q, want the person", items[1].EntityType, items[1].URL)
+	}
+
+	if err := store.ClearRecentItems(owner + 1); err != nil {
+		t.Fatalf("ClearRecentItems failed: %v", err)
+	}
+	if items, _ := store.GetRecentItems(owner, 10); len(items) != 2 {
+		t.Errorf("other owner cleared the history: %d items left", len(items))
+	}
+	if err := store.ClearRecentItems(owner); err != nil {
+		t.Fatalf("ClearRecentItems failed: %v", err)
+	}
+	if items, _ := store.GetRecentItems(owner, 10); len(items) != 0 {
+		t.Errorf("items after clear = %d, want 0", len(items))
+	}
+}
+
+func TestRecentItems_Capped(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	var first uint
+	for i := range 60 {
+		c := fixtures.Company(fixtures.WithCompanyName(fmt.Sprintf("Firma %02d", i)))
+		if err := store.SaveCompany(c, owner, nil); err != nil {
+			t.Fatalf("SaveCompany failed: %v", err)
+		}
+		if i == 0 {
+			first = c.ID
+		}
+		if err := store.TouchRecentView(owner, model.EntityCompany, c.ID); err != nil {
+			t.Fatalf("TouchRecentView failed: %v", err)
+		}
+	}
+	items, err := store.GetRecentItems(owner, 100)
+	if err != nil {
+		t.Fatalf("GetRecentItems failed: %v", err)
+	}
+	if len(items) != 50 {
+		t.Errorf("kept %d recent items, want 50", len(items))
+	}
+	for _, it := range items {
+		if it.EntityID == first {
+			t.Error("oldest view not dropped")
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package model
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/boxesandglue/bagme/document"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reminderPaymentDays is the grace period (in days from the reminder date)
+// printed on a reminder as the new payment deadline.
+const reminderPaymentDays = 7
+
+// ReminderTitle returns the German heading for a reminder level: level 1 is a
+// friendly "Zahlungserinnerung", every further level a numbered "Mahnung".
+func ReminderTitle(level int) string {
+	if level <= 1 {
+		return "Zahlungserinnerung"
+	}
+	return fmt.Sprintf("%d. Mahnung", level-1)
+}
+
+// FindOverdueInvoices returns the owner's issued (neither paid nor voided)
+// invoices whose due date lies before asOf, oldest due date first.
+func (s *Store) FindOverdueInvoices(ownerID uint, asOf time.Time) ([]Invoice, error) {
+	var out []Invoice
+	err := s.db.Preload("Company").
+		Where("owner_id = ? AND status = ? AND due_date < ?", ownerID, InvoiceStatusIssued, asOf).
+		Order("due_date ASC, id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// RecordReminder increments the reminder level of an overdue invoice and
+// returns the new level. Only the reminder level is touched; the invoice's
+// totals stay as they are.
+func (s *Store) RecordReminder(id, ownerID uint, asOf time.Time) (int, error) {
+	var level int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var inv Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", id, ownerID).
+			First(&inv).Error; err != nil {
+			return err
+		}
+		if inv.Status != InvoiceStatusIssued {
+			return fmt.Errorf("reminders can only be sent for issued invoices (status %q)", inv.Status)
+		}
+		if !inv.DueDate.Before(asOf) {
+			return fmt.Errorf("invoice %s is not overdue", inv.Number)
+		}
+		level = inv.ReminderLevel + 1
+		return tx.Model(&Invoice{}).
+			Where("id = ? AND owner_id = ?", id, ownerID).
+			Update("reminder_level", level).Error
+	})
+	return level, err
+}
+
+// CreateReminderPDF renders the reminder (dunning letter) for inv at its
+// current ReminderLevel to pdfpath. The letter uses the invoice's letterhead
+// template when one is set, otherwise the generic layout. Reminders are always
+// rendered with boxesandglue and carry no ZUGFeRD attachment, since they are
+// not invoices themselves.
+func (s *Store) CreateReminderPDF(inv *Invoice, ownerID uint, asOf time.Time, pdfpath string, logger *slog.Logger) error {
+	settings, err := s.LoadSettingsForCurrency(ownerID, inv.Currency)
+	if err != nil {
+		return fmt.Errorf("load settings: %w", err)
+	}
+	company, err := s.LoadCompany(inv.CompanyID, ownerID)
+	if err != nil {
+		return fmt.Errorf("load company %d: %w", inv.CompanyID, err)
+	}
+	payments, err := s.ListPayments(inv.ID, ownerID)
+	if err != nil {
+		return fmt.Errorf("load payments: %w", err)
+	}
+
+	d, err := document.New(pdfpath)
+	if err != nil {
+		return fmt.Errorf("create pdf document: %w", err)
+	}
+	d.Title = fmt.Sprintf("%s %s", ReminderTitle(inv.ReminderLevel), inv.Number)
+	d.Author = settings.CompanyName
+	d.Language = "de"
+
+	addressee := buildAddresseeInnerHTML(inv, company)
+	info := buildReminderInfoInnerHTML(inv, asOf)
+	body := buildReminderBodyHTML(inv, settings, PaymentsTotal(payments), asOf)
+
+	if inv.TemplateID != nil && inv.Template != nil {
+		err = s.renderLetterheadPages(d, inv.Template, ownerID, addressee, info, body, "")
+	} else {
+		err = s.renderGenericPages(d, buildGenericPageHTML(settings, addressee, info, body), inv.ID, ownerID, logger)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = d.Finish(); err != nil {
+		return fmt.Errorf("finish pdf: %w", err)
+	}
+	logger.Debug("generated reminder PDF", "invoice_id", inv.ID, "owner_id", ownerID,
+		"level", inv.ReminderLevel, "pdfpath", pdfpath)
+	return nil
+}
+
+// buildReminderInfoInnerHTML renders the info block of a reminder: reminder
+// date, title and the invoice it refers to.
+func buildReminderInfoInnerHTML(inv *Invoice, asOf time.Time) string {
+	var b strings.Builder
+	b.WriteString("Datum: " + esc(formatDateDE(asOf)) + "<br/>")
+	b.WriteString(esc(ReminderTitle(inv.ReminderLevel)) + "<br/>")
+	b.WriteString("zu Rechnung " + esc(inv.Number))
+	return b.String()
+}
+
+// buildReminderBodyHTML renders the reminder letter: a short text, the
+// overdue invoice with its amount, payments received so far, the reminder fee
+// and the resulting amount due. The invoice amounts are printed as stored; the
+// fee only appears on the reminder.
+func buildReminderBodyHTML(inv *Invoice, settings *Settings, paid decimal.Decimal, asOf time.Time) string {
+	currency := currencyCodeToText(inv.Currency)
+	deadline := asOf.AddDate(0, 0, reminderPaymentDays)
+	const ncols = 4
+
+	open := inv.GrossTotal.Sub(paid)
+	due := open.Add(settings.ReminderFee)
+
+	var b strings.Builder
+	b.WriteString(`<p class="opening"><b>` + esc(ReminderTitle(inv.ReminderLevel)) + `</b></p>`)
+	b.WriteString(`<p class="opening">Sehr geehrte Damen und Herren,<br/>`)
+	if inv.ReminderLevel <= 1 {
+		b.WriteString(`sicherlich ist Ihnen entgangen, dass die folgende Rechnung noch nicht vollständig beglichen wurde. `)
+	} else {
+		b.WriteString(`trotz unserer bisherigen Erinnerungen ist die folgende Rechnung noch nicht vollständig beglichen. `)
+	}
+	b.WriteString(`Bitte überweisen Sie den offenen Betrag bis zum ` + esc(formatDateDE(deadline)) + `.</p>`)
+
+	b.WriteString(`<table class="items"><thead><tr>`)
+	b.WriteString(`<th>Rechnung</th>`)
+	b.WriteString(`<th>Datum</th>`)
+	b.WriteString(`<th>Fällig am</th>`)
+	b.WriteString(`<th class="num">Betrag<br/>(` + esc(currency) + `)</th>`)
+	b.WriteString(`</tr></thead><tbody>`)
+	b.WriteString(`<tr>`)
+	b.WriteString(`<td>` + esc(inv.Number) + `</td>`)
+	b.WriteString(`<td>` + esc(formatDateDE(inv.Date)) + `</td>`)
+	b.WriteString(`<td>` + esc(formatDateDE(inv.DueDate)) + `</td>`)
+	b.WriteString(`<td class="num">` + esc(formatAmountDE(inv.GrossTotal)) + `</td>`)
+	b.WriteString(`</tr>`)
+
+	b.WriteString(sumRow("sumfirst", ncols, "Rechnungsbetrag", inv.GrossTotal))
+	if paid.IsPositive() {
+		b.WriteString(sumRow("", ncols, "Bereits bezahlt", paid.Neg()))
+	}
+	if settings.ReminderFee.IsPositive() {
+		b.WriteString(sumRow("", ncols, "Mahngebühr", settings.ReminderFee))
+	}
+	b.WriteString(sumRow("total", ncols, "Zu zahlender Betrag", due))
+	b.WriteString(`</tbody></table>`)
+
+	b.WriteString(`<p class="closing">`)
+	if settings.BankIBAN != "" {
+		b.WriteString(`Bankverbindung: ` + esc(formatIBAN(settings.BankIBAN)))
+		if settings.BankName != "" {
+			b.WriteString(` (` + esc(settings.BankName) + `)`)
+		}
+		b.WriteString(`<br/>`)
+	}
+	b.WriteString(`Sollten Sie die Zahlung inzwischen veranlasst haben, betrachten Sie dieses Schreiben bitte als gegenstandslos.</p>`)
+	return b.String()
+}
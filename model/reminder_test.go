@@ -0,0 +1,128 @@
+package model_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestFindOverdueInvoices(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	now := time.Now()
+	past := now.AddDate(0, 0, -30)
+
+	overdue := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-OVERDUE"),
+		fixtures.WithInvoiceDate(past),
+		fixtures.WithInvoiceDueDate(past.AddDate(0, 0, 14)),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	notDue := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-NOTDUE"),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	for _, inv := range []*model.Invoice{overdue, notDue} {
+		if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, inv.Date); err != nil {
+			t.Fatalf("MarkInvoiceIssued failed: %v", err)
+		}
+	}
+
+	// A paid invoice with a past due date is not overdue.
+	paid := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-PAID"),
+		fixtures.WithInvoiceDueDate(past),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(paid, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(paid.ID, fixtures.DefaultOwnerID, now); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if err := store.MarkInvoicePaid(paid.ID, fixtures.DefaultOwnerID, now); err != nil {
+		t.Fatalf("MarkInvoicePaid failed: %v", err)
+	}
+
+	got, err := store.FindOverdueInvoices(fixtures.DefaultOwnerID, now)
+	if err != nil {
+		t.Fatalf("FindOverdueInvoices failed: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != overdue.ID {
+		t.Fatalf("FindOverdueInvoices = %d invoices, want only %q", len(got), overdue.Number)
+	}
+}
+
+func TestRecordReminder_KeepsTotals(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	past := time.Now().AddDate(0, 0, -30)
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceDate(past),
+		fixtures.WithInvoiceDueDate(past.AddDate(0, 0, 14)),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, fixtures.DefaultOwnerID, past); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	before, _ := store.LoadInvoiceWithTemplate(inv.ID, fixtures.DefaultOwnerID)
+
+	for want := 1; want <= 2; want++ {
+		level, err := store.RecordReminder(inv.ID, fixtures.DefaultOwnerID, time.Now())
+		if err != nil {
+			t.Fatalf("RecordReminder failed: %v", err)
+		}
+		if level != want {
+			t.Errorf("RecordReminder level = %d, want %d", level, want)
+		}
+	}
+
+	after, _ := store.LoadInvoiceWithTemplate(inv.ID, fixtures.DefaultOwnerID)
+	if after.ReminderLevel != 2 {
+		t.Errorf("ReminderLevel = %d, want 2", after.ReminderLevel)
+	}
+	if !after.NetTotal.Equal(before.NetTotal) || !after.GrossTotal.Equal(before.GrossTotal) {
+		t.Errorf("totals changed: net %s -> %s, gross %s -> %s",
+			before.NetTotal, after.NetTotal, before.GrossTotal, after.GrossTotal)
+	}
+	if title := model.ReminderTitle(after.ReminderLevel); title != "1. Mahnung" {
+		t.Errorf("ReminderTitle(2) = %q, want %q", title, "1. Mahnung")
+	}
+
+	pdfPath := filepath.Join(t.TempDir(), "reminder.pdf")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := store.CreateReminderPDF(after, fixtures.DefaultOwnerID, time.Now(), pdfPath, logger); err != nil {
+		t.Fatalf("CreateReminderPDF failed: %v", err)
+	}
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF")
+	}
+
+	// A draft or not yet due invoice cannot be reminded.
+	if _, err := store.RecordReminder(data.Invoice.ID, fixtures.DefaultOwnerID, time.Now()); err == nil {
+		t.Error("expected error for reminder on a draft invoice")
+	}
+}
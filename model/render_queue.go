@@ -0,0 +1,145 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRenderQueueFull is returned by EnqueueInvoiceRender when the queue has
+// no room. The files are then rendered on the next download instead.
+var ErrRenderQueueFull = errors.New("render queue is full")
+
+// ErrRenderQueueNotStarted is returned by EnqueueInvoiceRender before
+// StartRenderWorkers was called.
+var ErrRenderQueueNotStarted = errors.New("render queue is not started")
+
+// renderQueueSize is the number of jobs that can wait for a worker.
+const renderQueueSize = 256
+
+// DefaultRenderWorkers is the number of render workers if Config.RenderWorkers
+// is not set.
+const DefaultRenderWorkers = 2
+
+// renderRetryDelays are the pauses between the attempts of a render job. A
+// job fails for good after len(renderRetryDelays)+1 attempts.
+var renderRetryDelays = []time.Duration{5 * time.Second, 30 * time.Second}
+
+// RenderJob asks for the XML and PDF of an invoice to be (re)generated.
+type RenderJob struct {
+	InvoiceID uint
+	OwnerID   uint
+	attempt   int // failed attempts so far
+}
+
+// RenderQueueStats is a snapshot of the render queue for the metrics.
+type RenderQueueStats struct {
+	Queued  int   // jobs waiting for a worker
+	Running int64 // jobs being rendered or waiting for a retry
+	Failed  int64 // jobs given up since the start
+}
+
+type renderQueue struct {
+	store   *Store
+	jobs    chan RenderJob
+	render  func(RenderJob) error
+	running atomic.Int64
+	failed  atomic.Int64
+}
+
+// StartRenderWorkers starts workers goroutines (DefaultRenderWorkers if not
+// positive) that call render for each job passed to EnqueueInvoiceRender.
+// A failing job is queued again after the delays in renderRetryDelays, the
+// worker is free for other jobs in the meantime. When it is given up, the
+// error is logged and stored in Invoice.RenderError; a successful rendering
+// clears it. Call it once, before the store is shared.
+func (s *Store) StartRenderWorkers(workers int, render func(RenderJob) error) {
+	if workers <= 0 {
+		workers = DefaultRenderWorkers
+	}
+	q := &renderQueue{store: s, jobs: make(chan RenderJob, renderQueueSize), render: render}
+	for range workers {
+		go q.work()
+	}
+	s.renders = q
+}
+
+// EnqueueInvoiceRender queues the rendering of the XML and PDF of an invoice.
+// It does not block: if all workers are busy and the queue is full, it
+// returns ErrRenderQueueFull.
+func (s *Store) EnqueueInvoiceRender(invoiceID, ownerID uint) error {
+	if s.renders == nil {
+		return ErrRenderQueueNotStarted
+	}
+	select {
+	case s.renders.jobs <- RenderJob{InvoiceID: invoiceID, OwnerID: ownerID}:
+		return nil
+	default:
+		return ErrRenderQueueFull
+	}
+}
+
+// RenderQueueStats returns the current state of the render queue (all zero
+// before StartRenderWorkers).
+func (s *Store) RenderQueueStats() RenderQueueStats {
+	q := s.renders
+	if q == nil {
+		return RenderQueueStats{}
+	}
+	return RenderQueueStats{Queued: len(q.jobs), Running: q.running.Load(), Failed: q.failed.Load()}
+}
+
+func (q *renderQueue) work() {
+	for job := range q.jobs {
+		q.running.Add(1)
+		q.run(job)
+		q.running.Add(-1)
+	}
+}
+
+// run renders job. A failed job is queued again after the next delay in
+// renderRetryDelays; it counts as running while it waits.
+func (q *renderQueue) run(job RenderJob) {
+	err := q.render(job)
+	if err == nil {
+		q.setError(job, "")
+		return
+	}
+	if job.attempt >= len(renderRetryDelays) {
+		q.failed.Add(1)
+		slog.Error("render invoice failed", "invoice_id", job.InvoiceID, "attempts", job.attempt+1, "err", err)
+		q.setError(job, err.Error())
+		return
+	}
+	slog.Warn("render invoice failed, retrying", "invoice_id", job.InvoiceID, "attempt", job.attempt+1, "err", err)
+	delay := renderRetryDelays[job.attempt]
+	job.attempt++
+	q.running.Add(1)
+	time.AfterFunc(delay, func() {
+		// Blocks only the timer's goroutine while the queue is full.
+		q.jobs <- job
+		q.running.Add(-1)
+	})
+}
+
+func (q *renderQueue) setError(job RenderJob, msg string) {
+	if err := q.store.SetInvoiceRenderError(job.InvoiceID, job.OwnerID, msg); err != nil {
+		slog.Error("store render error", "invoice_id", job.InvoiceID, "err", err)
+	}
+}
+
+// SetInvoiceRenderError stores msg as the render error of an invoice, or
+// clears it if msg is empty. The invoice does not count as changed (updated_at
+// is kept).
+func (s *Store) SetInvoiceRenderError(invoiceID, ownerID uint, msg string) error {
+	q := s.db.Model(&Invoice{}).Where("id = ? AND owner_id = ?", invoiceID, ownerID)
+	if msg == "" {
+		q = q.Where("render_error <> ''")
+	}
+	if err := q.UpdateColumn("render_error", truncateRunes(msg, 500)).Error; err != nil {
+		return fmt.Errorf("set render error of invoice %d: %w", invoiceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package model_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestRenderQueue_Retry(t *testing.T) {
+	defer model.SetRenderRetryDelays(time.Millisecond, time.Millisecond)()
+	store := fixtures.NewTestStore(t)
+
+	if err := store.EnqueueInvoiceRender(1, fixtures.DefaultOwnerID); !errors.Is(err, model.ErrRenderQueueNotStarted) {
+		t.Fatalf("enqueue before start: err = %v, want ErrRenderQueueNotStarted", err)
+	}
+
+	var mu sync.Mutex
+	calls := map[uint]int{}
+	done := make(chan uint, 2)
+	store.StartRenderWorkers(2, func(job model.RenderJob) error {
+		mu.Lock()
+		calls[job.InvoiceID]++
+		n := calls[job.InvoiceID]
+		mu.Unlock()
+		switch {
+		case job.InvoiceID == 1 && n < 2: // fails once
+			return errors.New("font not loaded")
+		case job.InvoiceID == 2 && n < 3: // fails for good
+			return errors.New("broken invoice")
+		}
+		done <- job.InvoiceID
+		if job.InvoiceID == 2 {
+			return errors.New("broken invoice")
+		}
+		return nil
+	})
+	for _, id := range []uint{1, 2} {
+		if err := store.EnqueueInvoiceRender(id, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("EnqueueInvoiceRender(%d) failed: %v", id, err)
+		}
+	}
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("render jobs did not finish")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for store.RenderQueueStats().Running > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls[1] != 2 || calls[2] != 3 {
+		t.Errorf("attempts = %v, want 2 for invoice 1 and 3 for invoice 2", calls)
+	}
+	if st := store.RenderQueueStats(); st.Failed != 1 || st.Queued != 0 || st.Running != 0 {
+		t.Errorf("stats = %+v, want one failed job", st)
+	}
+}
+
+func TestRenderQueue_RetryDoesNotBlockWorker(t *testing.T) {
+	defer model.SetRenderRetryDelays(time.Hour)()
+	store := fixtures.NewTestStore(t)
+
+	rendered := make(chan uint, 1)
+	store.StartRenderWorkers(1, func(job model.RenderJob) error {
+		if job.InvoiceID == 1 {
+			return errors.New("font not loaded")
+		}
+		rendered <- job.InvoiceID
+		return nil
+	})
+	for _, id := range []uint{1, 2} {
+		if err := store.EnqueueInvoiceRender(id, fixtures.DefaultOwnerID); err != nil {
+			t.Fatalf("EnqueueInvoiceRender(%d) failed: %v", id, err)
+		}
+	}
+	// The only worker renders invoice 2 while invoice 1 waits for its retry.
+	select {
+	case <-rendered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker blocked by the retry of another job")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for store.RenderQueueStats().Running > 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if st := store.RenderQueueStats(); st.Running != 1 || st.Failed != 0 {
+		t.Errorf("stats = %+v, want the waiting retry as running", st)
+	}
+}
+
+func TestRenderQueue_Full(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	store.StartRenderWorkers(1, func(model.RenderJob) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+
+	if err := store.EnqueueInvoiceRender(1, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("EnqueueInvoiceRender failed: %v", err)
+	}
+	<-started // the only worker is busy now
+	var err error
+	queued := 0
+	for ; queued < 10000; queued++ {
+		if err = store.EnqueueInvoiceRender(uint(queued+2), fixtures.DefaultOwnerID); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, model.ErrRenderQueueFull) {
+		t.Fatalf("err = %v, want ErrRenderQueueFull", err)
+	}
+	if st := store.RenderQueueStats(); st.Queued != queued || st.Running != 1 {
+		t.Errorf("stats = %+v, want %d queued and 1 running", st, queued)
+	}
+}
+
+func TestRenderQueue_RenderError(t *testing.T) {
+	defer model.SetRenderRetryDelays(time.Millisecond)()
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	id := data.Invoice.ID
+
+	var fail atomic.Bool
+	fail.Store(true)
+	store.StartRenderWorkers(1, func(model.RenderJob) error {
+		if fail.Load() {
+			return errors.New("font not loaded")
+		}
+		return nil
+	})
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			inv, err := store.LoadInvoice(id, fixtures.DefaultOwnerID)
+			if err != nil {
+				t.Fatalf("LoadInvoice failed: %v", err)
+			}
+			if inv.RenderError == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("RenderError = %q, want %q", inv.RenderError, want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := store.EnqueueInvoiceRender(id, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("EnqueueInvoiceRender failed: %v", err)
+	}
+	waitFor("font not loaded")
+
+	fail.Store(false)
+	if err := store.EnqueueInvoiceRender(id, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("EnqueueInvoiceRender failed: %v", err)
+	}
+	waitFor("")
+}
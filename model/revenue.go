@@ -0,0 +1,56 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MonthlyRevenue holds the invoiced amounts of one calendar month.
+type MonthlyRevenue struct {
+	Month time.Month
+	Net   decimal.Decimal
+	Gross decimal.Decimal
+}
+
+// RevenueByMonth sums net and gross totals of the owner's issued and paid
+// invoices (by invoice date) per month of year, converted to the base
+// currency with each invoice's exchange rate. Drafts and voided invoices are
+// left out; credit notes reduce the sums. The result always has twelve
+// entries, January first, with zero for months without invoices.
+func (s *Store) RevenueByMonth(ownerID uint, year int) ([]MonthlyRevenue, error) {
+	// The totals are stored as text, so they are converted and summed here
+	// instead of in SQL.
+	var rows []struct {
+		Date         time.Time
+		NetTotal     decimal.Decimal
+		GrossTotal   decimal.Decimal
+		ExchangeRate decimal.Decimal
+	}
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	err := s.db.Model(&Invoice{}).
+		Select("date, net_total, gross_total, exchange_rate").
+		Where("owner_id = ? AND status IN ? AND date >= ? AND date < ?",
+			ownerID, []InvoiceStatus{InvoiceStatusIssued, InvoiceStatusPaid}, start, start.AddDate(1, 0, 0)).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("revenue by month (owner %d, %d): %w", ownerID, year, err)
+	}
+
+	out := make([]MonthlyRevenue, 12)
+	for i := range out {
+		out[i] = MonthlyRevenue{Month: time.Month(i + 1)}
+	}
+	for _, r := range rows {
+		inv := Invoice{ExchangeRate: r.ExchangeRate}
+		m := r.Date.Month()
+		out[m-1].Net = out[m-1].Net.Add(inv.ToBaseCurrency(r.NetTotal))
+		out[m-1].Gross = out[m-1].Gross.Add(inv.ToBaseCurrency(r.GrossTotal))
+	}
+	for i := range out {
+		out[i].Net = out[i].Net.Round(2)
+		out[i].Gross = out[i].Gross.Round(2)
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package model_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func TestRevenueByMonth(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // data.Invoice stays a draft
+	owner := fixtures.DefaultOwnerID
+
+	create := func(number string, date time.Time, status model.InvoiceStatus) {
+		t.Helper()
+		inv := fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(data.Company.ID),
+			fixtures.WithInvoiceNumber(number),
+			fixtures.WithInvoiceDate(date),
+			fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+		)
+		if err := store.SaveInvoice(inv, owner); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		if err := store.MarkInvoiceIssued(inv.ID, owner, date); err != nil {
+			t.Fatalf("MarkInvoiceIssued failed: %v", err)
+		}
+		switch status {
+		case model.InvoiceStatusPaid:
+			if err := store.MarkInvoicePaid(inv.ID, owner, date); err != nil {
+				t.Fatalf("MarkInvoicePaid failed: %v", err)
+			}
+		case model.InvoiceStatusVoided:
+			if err := store.VoidInvoice(inv.ID, owner, date, false); err != nil {
+				t.Fatalf("VoidInvoice failed: %v", err)
+			}
+		}
+	}
+	create("RE-1", time.Date(2025, time.February, 3, 0, 0, 0, 0, time.UTC), model.InvoiceStatusIssued)
+	create("RE-2", time.Date(2025, time.February, 20, 0, 0, 0, 0, time.UTC), model.InvoiceStatusPaid)
+	create("RE-3", time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC), model.InvoiceStatusVoided)
+	create("RE-4", time.Date(2024, time.December, 30, 0, 0, 0, 0, time.UTC), model.InvoiceStatusIssued)
+
+	got, err := store.RevenueByMonth(owner, 2025)
+	if err != nil {
+		t.Fatalf("RevenueByMonth failed: %v", err)
+	}
+	if len(got) != 12 {
+		t.Fatalf("got %d months, want 12", len(got))
+	}
+	for _, m := range got {
+		wantNet, wantGross := decimal.Zero, decimal.Zero
+		if m.Month == time.February {
+			wantNet, wantGross = decimal.RequireFromString("3320"), decimal.RequireFromString("3950.80")
+		}
+		if !m.Net.Equal(wantNet) || !m.Gross.Equal(wantGross) {
+			t.Errorf("%s: net %s gross %s, want %s / %s", m.Month, m.Net, m.Gross, wantNet, wantGross)
+		}
+	}
+
+	// Other owners see nothing.
+	other, err := store.RevenueByMonth(owner+1, 2025)
+	if err != nil {
+		t.Fatalf("RevenueByMonth failed: %v", err)
+	}
+	if !other[time.February-1].Gross.IsZero() {
+		t.Errorf("foreign owner sees revenue %s", other[time.February-1].Gross)
+	}
+}
+
+func TestRevenueByMonth_ExchangeRate(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	date := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+	for i, rate := range []string{"0.9", ""} {
+		inv := fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(data.Company.ID),
+			fixtures.WithInvoiceNumber(fmt.Sprintf("RE-%d", i+1)),
+			fixtures.WithInvoiceDate(date),
+			fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+		)
+		if rate != "" {
+			inv.Currency = "USD"
+			inv.ExchangeRate = decimal.RequireFromString(rate)
+		}
+		if err := store.SaveInvoice(inv, owner); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		if err := store.MarkInvoiceIssued(inv.ID, owner, date); err != nil {
+			t.Fatalf("MarkInvoiceIssued failed: %v", err)
+		}
+	}
+
+	got, err := store.RevenueByMonth(owner, 2025)
+	if err != nil {
+		t.Fatalf("RevenueByMonth failed: %v", err)
+	}
+	// 1660 net / 1975.40 gross each, the USD invoice counts with 0.9.
+	april := got[time.April-1]
+	if want := decimal.RequireFromString("3154"); !april.Net.Equal(want) {
+		t.Errorf("net %s, want %s", april.Net, want)
+	}
+	if want := decimal.RequireFromString("3753.26"); !april.Gross.Equal(want) {
+		t.Errorf("gross %s, want %s", april.Gross, want)
+	}
+}
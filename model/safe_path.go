@@ -0,0 +1,40 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath is returned by SafeRelPath for paths that could leave the
+// base directory.
+var ErrUnsafePath = errors.New("unsafe path")
+
+// SafeRelPath joins base and rel, a slash separated path relative to base as
+// it comes from a form, a URL or a stored record. Empty and absolute paths,
+// ".." segments, backslashes and NUL bytes are rejected with ErrUnsafePath
+// instead of being cleaned, so that a manipulated path never silently names
+// another file. All file operations on user supplied names go through it.
+func SafeRelPath(base, rel string) (string, error) {
+	if rel == "" || strings.ContainsAny(rel, "\\\x00") || strings.HasPrefix(rel, "/") {
+		return "", fmt.Errorf("%q: %w", rel, ErrUnsafePath)
+	}
+	for _, seg := range strings.Split(rel, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("%q: %w", rel, ErrUnsafePath)
+		}
+	}
+	local := filepath.FromSlash(rel)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%q: %w", rel, ErrUnsafePath)
+	}
+	full := filepath.Join(base, local)
+	// IsLocal guarantees this already; checked again as the last line of
+	// defense.
+	if !strings.HasPrefix(full, filepath.Clean(base)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%q: %w", rel, ErrUnsafePath)
+	}
+	return full, nil
+}
@@ -0,0 +1,41 @@
+package model_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/billingcat/crm/model"
+)
+
+func TestSafeRelPath(t *testing.T) {
+	base := filepath.Join("srv", "assets", "owner1")
+	for _, tc := range []struct {
+		rel  string
+		want string // "" = rejected
+	}{
+		{"logo.png", filepath.Join(base, "logo.png")},
+		{"branding/briefbogen.pdf", filepath.Join(base, "branding", "briefbogen.pdf")},
+		{"./fonts/a.ttf", filepath.Join(base, "fonts", "a.ttf")},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"../../etc/passwd", ""},
+		{"fonts/../../owner2/logo.png", ""},
+		{"fonts/../logo.png", ""},
+		{"/etc/passwd", ""},
+		{"..\\..\\etc\\passwd", ""},
+		{"logo.png\x00.pdf", ""},
+	} {
+		got, err := model.SafeRelPath(base, tc.rel)
+		if tc.want == "" {
+			if !errors.Is(err, model.ErrUnsafePath) {
+				t.Errorf("SafeRelPath(%q) = %q, %v, want ErrUnsafePath", tc.rel, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("SafeRelPath(%q) = %q, %v, want %q", tc.rel, got, err, tc.want)
+		}
+	}
+}
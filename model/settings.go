@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -16,26 +18,118 @@ import (
 // enforce a UNIQUE owner_id so there is at most one settings row per owner.
 type Settings struct {
 	gorm.Model
-	OwnerID               uint   `gorm:"uniqueIndex;column:owner_id"` // One row per owner/tenant
-	CompanyName           string `gorm:"column:company_name"`
-	InvoiceContact        string `gorm:"column:invoice_contact"`
-	InvoiceEMail          string `gorm:"column:invoice_email"` // stored as invoice_email (not invoice_e_mail)
-	ZIP                   string `gorm:"column:zip"`
-	Address1              string `gorm:"column:address1"`
-	Address2              string `gorm:"column:address2"`
-	City                  string `gorm:"column:city"`
-	CountryCode           string `gorm:"column:country_code"` // ISO 3166-1 alpha-2 recommended
-	VATID                 string `gorm:"column:vat_id"`
-	TAXNumber             string `gorm:"column:tax_number"`
-	InvoiceNumberTemplate string `gorm:"column:invoice_number_template"` // e.g. "INV-{YYYY}-{NNNN}"
-	UseLocalCounter       bool   `gorm:"column:use_local_counter"`       // if true, number increments per owner locally
-	BankIBAN              string `gorm:"column:bank_iban"`
-	BankName              string `gorm:"column:bank_name"`
-	BankBIC               string `gorm:"column:bank_bic"`
-	CustomerNumberPrefix  string `gorm:"column:customer_number_prefix"`  // e.g. "K-"
-	CustomerNumberWidth   int    `gorm:"column:customer_number_width"`   // e.g. 5 -> K-00001
-	CustomerNumberCounter int64  `gorm:"column:customer_number_counter"` // current counter (e.g. 1000)
-	PDFEngine             string `gorm:"column:pdf_engine;default:auto"` // "auto" | "speedata" | "boxesandglue" (see PDFEngine type)
+	OwnerID                uint            `gorm:"uniqueIndex;column:owner_id"` // One row per owner/tenant
+	CompanyName            string          `gorm:"column:company_name"`
+	InvoiceContact         string          `gorm:"column:invoice_contact"`
+	InvoiceEMail           string          `gorm:"column:invoice_email"` // stored as invoice_email (not invoice_e_mail)
+	InvoicePhone           string          `gorm:"column:invoice_phone"` // seller contact phone (BT-42), required by XRechnung
+	ZIP                    string          `gorm:"column:zip"`
+	Address1               string          `gorm:"column:address1"`
+	Address2               string          `gorm:"column:address2"`
+	City                   string          `gorm:"column:city"`
+	CountryCode            string          `gorm:"column:country_code"` // ISO 3166-1 alpha-2 recommended
+	VATID                  string          `gorm:"column:vat_id"`
+	TAXNumber              string          `gorm:"column:tax_number"`
+	InvoiceNumberTemplate  string          `gorm:"column:invoice_number_template"` // e.g. "INV-{YYYY}-{NNNN}"
+	UseLocalCounter        bool            `gorm:"column:use_local_counter"`       // if true, number increments per owner locally
+	BankIBAN               string          `gorm:"column:bank_iban"`
+	BankName               string          `gorm:"column:bank_name"`
+	BankBIC                string          `gorm:"column:bank_bic"`
+	CustomerNumberPrefix   string          `gorm:"column:customer_number_prefix"`      // e.g. "K-"
+	CustomerNumberWidth    int             `gorm:"column:customer_number_width"`       // e.g. 5 -> K-00001
+	CustomerNumberCounter  int64           `gorm:"column:customer_number_counter"`     // current counter (e.g. 1000)
+	PDFEngine              string          `gorm:"column:pdf_engine;default:auto"`     // "auto" | "speedata" | "boxesandglue" (see PDFEngine type)
+	ReminderFee            decimal.Decimal `gorm:"column:reminder_fee;type:text"`      // fee added to each payment reminder
+	RoundingMode           string          `gorm:"column:rounding_mode;default:total"` // "total" | "line" (see RoundingMode type)
+	DefaultPaymentTermDays int             `gorm:"column:default_payment_term_days"`   // days until due; 0 = built-in default
+	Locale                 string          `gorm:"column:locale;default:de-DE"`        // "de-DE" | "en-US", used for CSV/XLSX exports and tax notes
+	// PaymentReferenceTemplate yields the payment reference of invoices, see
+	// FormatPaymentReference. Empty: no payment reference.
+	PaymentReferenceTemplate string `gorm:"column:payment_reference_template"`
+	// CustomerNumberMode is CustomerNumberNumeric (prefix + counter) or
+	// CustomerNumberFreeform (any unique text, entered by hand).
+	CustomerNumberMode string `gorm:"column:customer_number_mode;not null;default:numeric"`
+	// BaseCurrency is the currency reports are aggregated in. Invoices in
+	// other currencies are converted with their ExchangeRate.
+	BaseCurrency string `gorm:"column:base_currency;not null;default:EUR"`
+	// PriceDecimals is the number of decimals of unit prices (2 to 4). Line
+	// totals are always rounded to cents.
+	PriceDecimals int `gorm:"column:price_decimals;not null;default:2"`
+	// DeliveryNoteNumberTemplate yields the numbers of delivery notes, with
+	// the placeholders of FormatInvoiceNumber. DeliveryNoteCounter is the
+	// last number used; it is only changed by CreateDeliveryNote.
+	DeliveryNoteNumberTemplate string `gorm:"column:delivery_note_number_template;not null;default:''"`
+	DeliveryNoteCounter        int64  `gorm:"column:delivery_note_counter;not null;default:0"`
+	// InvoiceFilenameTemplate yields the file names of downloaded invoices,
+	// see InvoiceFilename. Empty: the invoice number.
+	InvoiceFilenameTemplate string `gorm:"column:invoice_filename_template;not null;default:''"`
+	// DATEV export: consultant and client number of the header, length of
+	// the ledger accounts, the collective debtor account and the revenue
+	// accounts per tax category and rate (see ParseDatevAccounts). Empty
+	// accounts fall back to DefaultDatevDebtorAccount and
+	// DefaultDatevAccounts.
+	DatevConsultantNumber string `gorm:"column:datev_consultant_number;not null;default:''"`
+	DatevClientNumber     string `gorm:"column:datev_client_number;not null;default:''"`
+	DatevAccountLength    int    `gorm:"column:datev_account_length;not null;default:4"`
+	DatevDebtorAccount    string `gorm:"column:datev_debtor_account;not null;default:''"`
+	DatevAccounts         string `gorm:"column:datev_accounts;not null;default:''"`
+	// Statutory notes on invoices with reverse charge (AE) and
+	// intra-community supplies (K) per language; empty means the built-in
+	// text, see TaxNote.
+	TaxNoteAEDE string `gorm:"column:tax_note_ae_de;not null;default:''"`
+	TaxNoteAEEN string `gorm:"column:tax_note_ae_en;not null;default:''"`
+	TaxNoteKDE  string `gorm:"column:tax_note_k_de;not null;default:''"`
+	TaxNoteKEN  string `gorm:"column:tax_note_k_en;not null;default:''"`
+}
+
+// Customer number modes, see Settings.CustomerNumberMode.
+const (
+	CustomerNumberNumeric  = "numeric"
+	CustomerNumberFreeform = "freeform"
+)
+
+// FreeformCustomerNumbers reports whether customer numbers are entered by
+// hand without format rules and without a counter.
+func (s *Settings) FreeformCustomerNumbers() bool {
+	return s.CustomerNumberMode == CustomerNumberFreeform
+}
+
+// Locales supported for exports.
+const (
+	LocaleDE = "de-DE"
+	LocaleEN = "en-US"
+)
+
+// NormalizeLocale maps s to one of the supported locales. Anything that is
+// not English falls back to LocaleDE.
+func NormalizeLocale(s string) string {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", "-")) {
+	case "en-us", "en":
+		return LocaleEN
+	default:
+		return LocaleDE
+	}
+}
+
+// ValidateSettingsForInvoicing returns the (German) names of the settings an
+// e-invoice cannot do without: seller name and address, a VAT ID or tax
+// number and the bank account. The result is empty if nothing is missing.
+// PDF and XML generation does not check this; it gates issuing an invoice.
+func ValidateSettingsForInvoicing(settings *Settings) []string {
+	var missing []string
+	check := func(value, label string) {
+		if strings.TrimSpace(value) == "" {
+			missing = append(missing, label)
+		}
+	}
+	check(settings.CompanyName, "Firmenname")
+	check(settings.Address1, "Adresse")
+	check(settings.ZIP, "PLZ")
+	check(settings.City, "Ort")
+	check(settings.CountryCode, "Land")
+	check(settings.VATID+settings.TAXNumber, "USt-IdNr. oder Steuernummer")
+	check(settings.BankIBAN, "IBAN")
+	return missing
 }
 
 // LoadSettings loads the settings row for a given owner.
@@ -77,33 +171,109 @@ func (s *Store) UpdateSettings(settings *Settings) error {
 		Model(&Settings{}).
 		Where("owner_id = ?", settings.OwnerID).
 		Updates(map[string]any{
-			"company_name":            settings.CompanyName,
-			"invoice_contact":         settings.InvoiceContact,
-			"invoice_email":           settings.InvoiceEMail,
-			"zip":                     settings.ZIP,
-			"address1":                settings.Address1,
-			"address2":                settings.Address2,
-			"city":                    settings.City,
-			"country_code":            settings.CountryCode,
-			"vat_id":                  settings.VATID,
-			"tax_number":              settings.TAXNumber,
-			"invoice_number_template": settings.InvoiceNumberTemplate,
-			"use_local_counter":       settings.UseLocalCounter,
-			"bank_iban":               settings.BankIBAN,
-			"bank_name":               settings.BankName,
-			"bank_bic":                settings.BankBIC,
-			"customer_number_prefix":  settings.CustomerNumberPrefix,
-			"customer_number_width":   settings.CustomerNumberWidth,
-			"customer_number_counter": settings.CustomerNumberCounter,
-			"pdf_engine":              settings.PDFEngine,
-			"updated_at":              gorm.Expr("NOW()"),
+			"company_name":                  settings.CompanyName,
+			"invoice_contact":               settings.InvoiceContact,
+			"invoice_email":                 settings.InvoiceEMail,
+			"invoice_phone":                 settings.InvoicePhone,
+			"zip":                           settings.ZIP,
+			"address1":                      settings.Address1,
+			"address2":                      settings.Address2,
+			"city":                          settings.City,
+			"country_code":                  settings.CountryCode,
+			"vat_id":                        settings.VATID,
+			"tax_number":                    settings.TAXNumber,
+			"invoice_number_template":       settings.InvoiceNumberTemplate,
+			"use_local_counter":             settings.UseLocalCounter,
+			"bank_iban":                     settings.BankIBAN,
+			"bank_name":                     settings.BankName,
+			"bank_bic":                      settings.BankBIC,
+			"customer_number_prefix":        settings.CustomerNumberPrefix,
+			"customer_number_width":         settings.CustomerNumberWidth,
+			"customer_number_counter":       settings.CustomerNumberCounter,
+			"pdf_engine":                    settings.PDFEngine,
+			"reminder_fee":                  settings.ReminderFee,
+			"rounding_mode":                 settings.RoundingMode,
+			"default_payment_term_days":     settings.DefaultPaymentTermDays,
+			"locale":                        settings.Locale,
+			"payment_reference_template":    settings.PaymentReferenceTemplate,
+			"customer_number_mode":          settings.CustomerNumberMode,
+			"base_currency":                 settings.BaseCurrency,
+			"price_decimals":                settings.PriceDecimals,
+			"delivery_note_number_template": settings.DeliveryNoteNumberTemplate,
+			"invoice_filename_template":     settings.InvoiceFilenameTemplate,
+			"datev_consultant_number":       settings.DatevConsultantNumber,
+			"datev_client_number":           settings.DatevClientNumber,
+			"datev_account_length":          settings.DatevAccountLength,
+			"datev_debtor_account":          settings.DatevDebtorAccount,
+			"datev_accounts":                settings.DatevAccounts,
+			"tax_note_ae_de":                settings.TaxNoteAEDE,
+			"tax_note_ae_en":                settings.TaxNoteAEEN,
+			"tax_note_k_de":                 settings.TaxNoteKDE,
+			"tax_note_k_en":                 settings.TaxNoteKEN,
+			"updated_at":                    gorm.Expr("NOW()"),
 		}).Error
 }
 
+// LoadBaseCurrency returns the owner's base currency for reports. Missing
+// settings yield EUR.
+func (s *Store) LoadBaseCurrency(ownerID uint) string {
+	var currencies []string
+	if err := s.db.Model(&Settings{}).Where("owner_id = ?", ownerID).Limit(1).Pluck("base_currency", &currencies).Error; err != nil || len(currencies) == 0 || currencies[0] == "" {
+		return "EUR"
+	}
+	return currencies[0]
+}
+
+// Bounds of Settings.PriceDecimals.
+const (
+	MinPriceDecimals = 2
+	MaxPriceDecimals = 4
+)
+
+// NormalizePriceDecimals clamps n to MinPriceDecimals..MaxPriceDecimals, so
+// that rows written before the setting existed (0) show cents.
+func NormalizePriceDecimals(n int) int {
+	if n < MinPriceDecimals {
+		return MinPriceDecimals
+	}
+	if n > MaxPriceDecimals {
+		return MaxPriceDecimals
+	}
+	return n
+}
+
+// LoadPriceDecimals returns the owner's number of unit price decimals.
+// Missing settings yield MinPriceDecimals.
+func (s *Store) LoadPriceDecimals(ownerID uint) int {
+	return s.loadPriceDecimals(s.db, ownerID)
+}
+
+func (s *Store) loadPriceDecimals(db *gorm.DB, ownerID uint) int {
+	var decimals []int
+	if err := db.Model(&Settings{}).Where("owner_id = ?", ownerID).Limit(1).Pluck("price_decimals", &decimals).Error; err != nil || len(decimals) == 0 {
+		return MinPriceDecimals
+	}
+	return NormalizePriceDecimals(decimals[0])
+}
+
+// loadRoundingMode returns the owner's rounding mode. It reads only that
+// column, so invoice loading does not pay for the full settings row. Missing
+// settings yield RoundingModeTotal.
+func (s *Store) loadRoundingMode(db *gorm.DB, ownerID uint) RoundingMode {
+	var modes []string
+	if err := db.Model(&Settings{}).Where("owner_id = ?", ownerID).Limit(1).Pluck("rounding_mode", &modes).Error; err != nil || len(modes) == 0 {
+		return RoundingModeTotal
+	}
+	return RoundingMode(modes[0])
+}
+
 // SaveSettings performs an upsert keyed by owner_id (ON CONFLICT DO UPDATE).
 // If a row for owner_id exists, the listed columns are updated; otherwise, a new
 // row is inserted.
 //
+// The bank columns are not updated: the settings page manages bank accounts
+// separately (see BankAccount), the columns only serve owners without any.
+//
 // Caveat: GORM translates ON CONFLICT per dialect. Ensure a unique index exists
 // on owner_id (declared on the struct) and that the target DB supports the clause.
 func (s *Store) SaveSettings(settings *Settings) error {
@@ -113,25 +283,42 @@ func (s *Store) SaveSettings(settings *Settings) error {
 	return s.db.Clauses(clause.OnConflict{
 		Columns: []clause.Column{{Name: "owner_id"}}, // conflict target
 		DoUpdates: clause.Assignments(map[string]any{
-			"company_name":            settings.CompanyName,
-			"invoice_contact":         settings.InvoiceContact,
-			"invoice_email":           settings.InvoiceEMail,
-			"zip":                     settings.ZIP,
-			"address1":                settings.Address1,
-			"address2":                settings.Address2,
-			"city":                    settings.City,
-			"country_code":            settings.CountryCode,
-			"vat_id":                  settings.VATID,
-			"tax_number":              settings.TAXNumber,
-			"invoice_number_template": settings.InvoiceNumberTemplate,
-			"use_local_counter":       settings.UseLocalCounter,
-			"bank_iban":               settings.BankIBAN,
-			"bank_name":               settings.BankName,
-			"bank_bic":                settings.BankBIC,
-			"customer_number_prefix":  settings.CustomerNumberPrefix,
-			"customer_number_width":   settings.CustomerNumberWidth,
-			"customer_number_counter": settings.CustomerNumberCounter,
-			"pdf_engine":              settings.PDFEngine,
+			"company_name":                  settings.CompanyName,
+			"invoice_contact":               settings.InvoiceContact,
+			"invoice_email":                 settings.InvoiceEMail,
+			"invoice_phone":                 settings.InvoicePhone,
+			"zip":                           settings.ZIP,
+			"address1":                      settings.Address1,
+			"address2":                      settings.Address2,
+			"city":                          settings.City,
+			"country_code":                  settings.CountryCode,
+			"vat_id":                        settings.VATID,
+			"tax_number":                    settings.TAXNumber,
+			"invoice_number_template":       settings.InvoiceNumberTemplate,
+			"use_local_counter":             settings.UseLocalCounter,
+			"customer_number_prefix":        settings.CustomerNumberPrefix,
+			"customer_number_width":         settings.CustomerNumberWidth,
+			"customer_number_counter":       settings.CustomerNumberCounter,
+			"pdf_engine":                    settings.PDFEngine,
+			"reminder_fee":                  settings.ReminderFee,
+			"rounding_mode":                 settings.RoundingMode,
+			"default_payment_term_days":     settings.DefaultPaymentTermDays,
+			"locale":                        settings.Locale,
+			"payment_reference_template":    settings.PaymentReferenceTemplate,
+			"customer_number_mode":          settings.CustomerNumberMode,
+			"base_currency":                 settings.BaseCurrency,
+			"price_decimals":                settings.PriceDecimals,
+			"delivery_note_number_template": settings.DeliveryNoteNumberTemplate,
+			"invoice_filename_template":     settings.InvoiceFilenameTemplate,
+			"datev_consultant_number":       settings.DatevConsultantNumber,
+			"datev_client_number":           settings.DatevClientNumber,
+			"datev_account_length":          settings.DatevAccountLength,
+			"datev_debtor_account":          settings.DatevDebtorAccount,
+			"datev_accounts":                settings.DatevAccounts,
+			"tax_note_ae_de":                settings.TaxNoteAEDE,
+			"tax_note_ae_en":                settings.TaxNoteAEEN,
+			"tax_note_k_de":                 settings.TaxNoteKDE,
+			"tax_note_k_en":                 settings.TaxNoteKEN,
 
 			// ensure updated_at changes on UPSERT
 			"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
@@ -139,6 +326,41 @@ func (s *Store) SaveSettings(settings *Settings) error {
 	}).Create(settings).Error
 }
 
+// Defaults of a new owner's settings row, see EnsureSettings.
+const (
+	DefaultCustomerNumberPrefix  = "K-"
+	DefaultCustomerNumberWidth   = 4
+	DefaultInvoiceNumberTemplate = "RE-%YYYY%-%04C%"
+)
+
+// EnsureSettings returns the settings of the owner and creates a row with
+// defaults first if there is none: customer numbers K-0001 and up, invoice
+// numbers RE-2025-0001 and up, automatic PDF engine and rounding on the
+// totals as EN 16931 calculates them. Calling it again leaves an existing row
+// untouched.
+func (s *Store) EnsureSettings(ownerID uint) (*Settings, error) {
+	if ownerID == 0 {
+		return nil, errors.New("EnsureSettings: owner ID must not be 0")
+	}
+	var settings Settings
+	err := s.db.Where(Settings{OwnerID: ownerID}).
+		Attrs(Settings{
+			CustomerNumberPrefix:  DefaultCustomerNumberPrefix,
+			CustomerNumberWidth:   DefaultCustomerNumberWidth,
+			InvoiceNumberTemplate: DefaultInvoiceNumberTemplate,
+			PDFEngine:             string(PDFEngineAuto),
+			RoundingMode:          string(RoundingModeTotal),
+			Locale:                LocaleDE,
+			CustomerNumberMode:    CustomerNumberNumeric,
+			PriceDecimals:         MinPriceDecimals,
+		}).
+		FirstOrCreate(&settings).Error
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
 // formatCustomerNumber builds the display string: prefix + zero-padded width + n (e.g. "K-" + 5 + 42 => "K-00042").
 func formatCustomerNumber(prefix string, width int, n int64) string {
 	if width < 0 {
@@ -147,12 +369,33 @@ func formatCustomerNumber(prefix string, width int, n int64) string {
 	return fmt.Sprintf("%s%0*d", prefix, width, n)
 }
 
-// ErrNoSettingsRow is returned when no settings row exists in the database.
+// MaxCustomerNumberWidth is the largest supported zero-padding width.
+const MaxCustomerNumberWidth = 12
+
+// PreviewCustomerNumber returns the customer number that follows counter
+// with the given prefix and width, as NextCustomerNumberTx would allocate it
+// if the number is still free. It does not touch the database.
+func PreviewCustomerNumber(prefix string, width int, counter int64) (string, error) {
+	if width < 0 || width > MaxCustomerNumberWidth {
+		return "", fmt.Errorf("width must be between 0 and %d", MaxCustomerNumberWidth)
+	}
+	if counter < 0 {
+		return "", errors.New("counter must not be negative")
+	}
+	return formatCustomerNumber(prefix, width, counter+1), nil
+}
+
+// ErrNoSettingsRow is returned when the owner has no settings row yet.
 var ErrNoSettingsRow = errors.New("no settings row found")
 
-// NextCustomerNumberTx allocates the next unique customer number in a transaction.
+// ErrCustomerNumberFreeform is returned by NextCustomerNumberTx when the owner
+// enters customer numbers by hand.
+var ErrCustomerNumberFreeform = errors.New("customer numbers are not allocated automatically in freeform mode")
+
+// NextCustomerNumberTx allocates the next customer number of the owner that
+// none of the owner's companies uses yet, in a transaction.
 // Returns the formatted string and the numeric value used.
-func (s *Store) NextCustomerNumberTx(ctx context.Context) (string, int64, error) {
+func (s *Store) NextCustomerNumberTx(ctx context.Context, ownerID uint) (string, int64, error) {
 	var result string
 	var numeric int64
 
@@ -160,12 +403,16 @@ func (s *Store) NextCustomerNumberTx(ctx context.Context) (string, int64, error)
 		// Lock settings row for update (Postgres/MySQL). SQLite ignores this clause.
 		var s Settings
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("owner_id = ?", ownerID).
 			First(&s).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return ErrNoSettingsRow
 			}
 			return err
 		}
+		if s.FreeformCustomerNumbers() {
+			return ErrCustomerNumberFreeform
+		}
 
 		// Try from counter+1 upwards until free.
 		tryVal := s.CustomerNumberCounter + 1
@@ -173,7 +420,7 @@ func (s *Store) NextCustomerNumberTx(ctx context.Context) (string, int64, error)
 			candidate := formatCustomerNumber(s.CustomerNumberPrefix, s.CustomerNumberWidth, tryVal)
 			var cnt int64
 			if err := tx.Model(&Company{}).
-				Where("customer_number = ?", candidate).
+				Where("owner_id = ? AND customer_number = ?", ownerID, candidate).
 				Count(&cnt).Error; err != nil {
 				return err
 			}
@@ -210,8 +457,8 @@ func parseNumericPart(prefix, s string) (int64, bool) {
 			return 0, false
 		}
 	}
-	var n int64
-	_, err := fmt.Sscan(tail, &n)
+	// Base 10: the tail is zero-padded, fmt.Sscan would read it as octal.
+	n, err := strconv.ParseInt(tail, 10, 64)
 	if err != nil {
 		return 0, false
 	}
@@ -220,10 +467,12 @@ func parseNumericPart(prefix, s string) (int64, bool) {
 
 // --- Public API ---
 
-// SuggestNextCustomerNumber returns a non-persistent suggestion (counter+1 formatted).
-func (s *Store) SuggestNextCustomerNumber(ctx context.Context) (string, error) {
+// SuggestNextCustomerNumber returns a non-persistent suggestion (counter+1
+// formatted) from the owner's settings. In freeform mode there is no
+// suggestion and the result is empty.
+func (s *Store) SuggestNextCustomerNumber(ctx context.Context, ownerID uint) (string, error) {
 	var settings Settings
-	err := s.db.WithContext(ctx).First(&settings).Error
+	err := s.db.WithContext(ctx).Where("owner_id = ?", ownerID).First(&settings).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			// domain specific error when no settings row exists
@@ -233,18 +482,23 @@ func (s *Store) SuggestNextCustomerNumber(ctx context.Context) (string, error) {
 		return "", err
 	}
 
+	if settings.FreeformCustomerNumbers() {
+		return "", nil
+	}
 	n := settings.CustomerNumberCounter + 1
 	return formatCustomerNumber(settings.CustomerNumberPrefix, settings.CustomerNumberWidth, n), nil
 }
 
 // CheckCustomerNumber validates whether a customer number is valid and available.
 //
-// It enforces format rules from settings (prefix and numeric width) and checks uniqueness.
+// It enforces format rules from the owner's settings (prefix and numeric width)
+// and checks uniqueness among the owner's companies. In freeform mode only
+// uniqueness is checked.
 // Returns:
 //
 //	ok=true  -> number is syntactically valid and available (or belongs to excludeID)
 //	ok=false -> invalid or taken; message gives human-readable reason
-func (s *Store) CheckCustomerNumber(ctx context.Context, num string, excludeID uint) (ok bool, message string, err error) {
+func (s *Store) CheckCustomerNumber(ctx context.Context, ownerID uint, num string, excludeID uint) (ok bool, message string, err error) {
 	// Empty -> treated as a neutral suggestion
 	if num == "" {
 		return true, "Vorschlag – kann überschrieben werden.", nil
@@ -252,61 +506,85 @@ func (s *Store) CheckCustomerNumber(ctx context.Context, num string, excludeID u
 
 	// Load settings for validation rules
 	var settings Settings
-	if err := s.db.WithContext(ctx).First(&settings).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("owner_id = ?", ownerID).First(&settings).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, "Bitte richte zunächst die Grundeinstellungen ein", ErrNoSettingsRow
+		}
 		return false, "Fehler beim Laden der Einstellungen", err
 	}
 
+	if msg := checkCustomerNumberFormat(&settings, num); msg != "" {
+		return false, msg, nil
+	}
+
+	// Uniqueness check
+	var comp Company
+	q := s.db.WithContext(ctx).Where("owner_id = ? AND customer_number = ?", ownerID, num)
+	if err := q.First(&comp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, "", nil
+		}
+		return false, "Datenbankfehler", err
+	}
+
+	// Allow if same company (excludeID)
+	if excludeID != 0 && comp.ID == excludeID {
+		return true, "", nil
+	}
+
+	// Taken by another record
+	return false, "Kundennummer bereits vergeben", nil
+}
+
+// checkCustomerNumberFormat returns why num does not match the numeric format
+// of settings, or "" if it does. Freeform numbers have no format.
+func checkCustomerNumberFormat(settings *Settings, num string) string {
+	if settings.FreeformCustomerNumbers() {
+		return ""
+	}
 	prefix := strings.TrimSpace(settings.CustomerNumberPrefix)
 	width := settings.CustomerNumberWidth
 
 	// Check prefix
 	if prefix != "" && !strings.HasPrefix(num, prefix) {
-		return false, fmt.Sprintf("Kundennummer muss mit „%s“ beginnen", prefix), nil
+		return fmt.Sprintf("Kundennummer muss mit „%s“ beginnen", prefix)
 	}
 
 	// Extract numeric tail after prefix
 	tail := strings.TrimPrefix(num, prefix)
 	if tail == "" {
-		return false, "Fehlende Zahl nach Präfix", nil
+		return "Fehlende Zahl nach Präfix"
 	}
 
 	for _, r := range tail {
 		if !unicode.IsDigit(r) {
-			return false, "Kundennummer darf nur Ziffern enthalten", nil
+			return "Kundennummer darf nur Ziffern enthalten"
 		}
 	}
 
 	// Check width (if defined)
 	if width > 0 && len(tail) != width {
-		return false, fmt.Sprintf("Kundennummer muss genau %d-stellig sein", width), nil
-	}
-
-	// Uniqueness check
-	var comp Company
-	q := s.db.WithContext(ctx).Where("customer_number = ?", num)
-	if err := q.First(&comp).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return true, "", nil
-		}
-		return false, "Datenbankfehler", err
-	}
-
-	// Allow if same company (excludeID)
-	if excludeID != 0 && comp.ID == excludeID {
-		return true, "", nil
+		return fmt.Sprintf("Kundennummer muss genau %d-stellig sein", width)
 	}
-
-	// Taken by another record
-	return false, "Kundennummer bereits vergeben", nil
+	return ""
 }
 
-// MaybeLiftCustomerCounterFor raises the settings counter if num's numeric part is ahead.
-func (s *Store) MaybeLiftCustomerCounterFor(ctx context.Context, num string) error {
+// MaybeLiftCustomerCounterFor raises the owner's settings counter if num's
+// numeric part is ahead. In freeform mode there is no counter to lift.
+func (s *Store) MaybeLiftCustomerCounterFor(ctx context.Context, ownerID uint, num string) error {
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var s Settings
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&s).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("owner_id = ?", ownerID).
+			First(&s).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoSettingsRow
+			}
 			return err
 		}
+		if s.FreeformCustomerNumbers() {
+			return nil
+		}
 		if n, ok := parseNumericPart(s.CustomerNumberPrefix, num); ok && n > s.CustomerNumberCounter {
 			return tx.Model(&Settings{}).Where("id = ?", s.ID).
 				Update("customer_number_counter", n).Error
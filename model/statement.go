@@ -0,0 +1,277 @@
+package model
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boxesandglue/bagme/document"
+	"github.com/shopspring/decimal"
+)
+
+// StatementEntryKind tells what a line of a customer statement stands for.
+type StatementEntryKind string
+
+const (
+	StatementEntryInvoice StatementEntryKind = "invoice"
+	StatementEntryPayment StatementEntryKind = "payment"
+	// StatementEntryVoided is a voided invoice. It is listed for completeness
+	// but does not change the balance.
+	StatementEntryVoided StatementEntryKind = "voided"
+)
+
+// StatementEntry is one line of a customer statement. Amount is positive for
+// invoices (the customer owes more) and negative for payments and credit
+// notes. Balance is the running balance after this line.
+type StatementEntry struct {
+	Date      time.Time
+	Kind      StatementEntryKind
+	InvoiceID uint
+	Number    string
+	Text      string
+	Amount    decimal.Decimal
+	Balance   decimal.Decimal
+	// BaseAmount is Amount converted to the base currency with the exchange
+	// rate of the invoice.
+	BaseAmount decimal.Decimal
+}
+
+// CompanyStatement is the account ledger of one company for a date range.
+// OpeningBalance sums everything before From, ClosingBalance is the balance
+// after the last entry.
+type CompanyStatement struct {
+	Company        *Company
+	From, To       time.Time
+	Currency       string
+	OpeningBalance decimal.Decimal
+	Entries        []StatementEntry
+	ClosingBalance decimal.Decimal
+	// BaseCurrency is the owner's reporting currency. The base balances
+	// convert every entry with the exchange rate of its invoice, so they
+	// match the revenue reports rather than today's rates.
+	BaseCurrency       string
+	OpeningBalanceBase decimal.Decimal
+	ClosingBalanceBase decimal.Decimal
+	// TemplateID is the letterhead of the most recent invoice in the
+	// statement, used for the PDF. Nil means generic layout.
+	TemplateID *uint
+}
+
+// BuildCompanyStatement collects the issued invoices and the payments of a
+// company between from and to (both days inclusive) in date order, together
+// with the running balance. Drafts are left out, voided invoices appear as
+// lines without effect on the balance. Invoices marked paid without recorded
+// payments (or with less than the gross total) get a payment line for the
+// rest on their paid date.
+func (s *Store) BuildCompanyStatement(ownerID, companyID uint, from, to time.Time) (*CompanyStatement, error) {
+	company, err := s.LoadCompany(companyID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	from = startOfDay(from)
+	end := startOfDay(to).AddDate(0, 0, 1)
+
+	var invoices []Invoice
+	if err := s.db.Where("owner_id = ? AND company_id = ? AND status <> ? AND date < ?",
+		ownerID, companyID, InvoiceStatusDraft, end).
+		Order("date ASC, id ASC").
+		Find(&invoices).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(invoices))
+	for i, inv := range invoices {
+		ids[i] = inv.ID
+	}
+	var payments []Payment
+	if len(ids) > 0 {
+		if err := s.db.Where("owner_id = ? AND invoice_id IN ? AND date < ?", ownerID, ids, end).
+			Order("date ASC, id ASC").
+			Find(&payments).Error; err != nil {
+			return nil, err
+		}
+	}
+	paidPerInvoice := make(map[uint]decimal.Decimal)
+	numbers := make(map[uint]string, len(invoices))
+	rates := make(map[uint]decimal.Decimal, len(invoices))
+	for _, inv := range invoices {
+		numbers[inv.ID] = inv.Number
+		rates[inv.ID] = inv.exchangeRate()
+	}
+
+	var all []StatementEntry
+	for _, p := range payments {
+		paidPerInvoice[p.InvoiceID] = paidPerInvoice[p.InvoiceID].Add(p.Amount)
+		text := "Zahlung"
+		if strings.TrimSpace(p.Note) != "" {
+			text += " – " + strings.TrimSpace(p.Note)
+		}
+		all = append(all, StatementEntry{
+			Date: p.Date, Kind: StatementEntryPayment, InvoiceID: p.InvoiceID,
+			Number: numbers[p.InvoiceID], Text: text, Amount: p.Amount.Neg(),
+		})
+	}
+
+	st := &CompanyStatement{Company: company, From: from, To: startOfDay(to), Currency: company.InvoiceCurrency,
+		BaseCurrency: s.LoadBaseCurrency(ownerID)}
+	for _, inv := range invoices {
+		if inv.Currency != "" {
+			st.Currency = inv.Currency
+		}
+		if inv.TemplateID != nil {
+			st.TemplateID = inv.TemplateID
+		}
+		e := StatementEntry{
+			Date: inv.Date, Kind: StatementEntryInvoice, InvoiceID: inv.ID,
+			Number: inv.Number, Text: inv.DocumentType.Title(), Amount: inv.GrossTotal,
+		}
+		if inv.Status == InvoiceStatusVoided {
+			e.Kind = StatementEntryVoided
+			e.Text += " (storniert, " + formatAmountDE(inv.GrossTotal) + ")"
+			e.Amount = decimal.Zero
+		}
+		all = append(all, e)
+
+		if inv.Status == InvoiceStatusPaid && inv.PaidAt != nil && inv.PaidAt.Before(end) {
+			if rest := inv.GrossTotal.Sub(paidPerInvoice[inv.ID]); rest.IsPositive() {
+				all = append(all, StatementEntry{
+					Date: *inv.PaidAt, Kind: StatementEntryPayment, InvoiceID: inv.ID,
+					Number: inv.Number, Text: "Als bezahlt markiert", Amount: rest.Neg(),
+				})
+			}
+		}
+	}
+	if st.Currency == "" {
+		st.Currency = "EUR"
+	}
+
+	// Invoices before payments on the same day.
+	sort.SliceStable(all, func(i, j int) bool {
+		di, dj := startOfDay(all[i].Date), startOfDay(all[j].Date)
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return all[i].Kind != StatementEntryPayment && all[j].Kind == StatementEntryPayment
+	})
+
+	balance, baseBalance := decimal.Zero, decimal.Zero
+	for _, e := range all {
+		e.BaseAmount = e.Amount.Mul(rates[e.InvoiceID])
+		if e.Date.Before(from) {
+			balance = balance.Add(e.Amount)
+			baseBalance = baseBalance.Add(e.BaseAmount)
+			continue
+		}
+		if len(st.Entries) == 0 {
+			st.OpeningBalance = balance
+			st.OpeningBalanceBase = baseBalance.Round(2)
+		}
+		balance = balance.Add(e.Amount)
+		baseBalance = baseBalance.Add(e.BaseAmount)
+		e.Balance = balance
+		st.Entries = append(st.Entries, e)
+	}
+	if len(st.Entries) == 0 {
+		st.OpeningBalance = balance
+		st.OpeningBalanceBase = baseBalance.Round(2)
+	}
+	st.ClosingBalance = balance
+	st.ClosingBalanceBase = baseBalance.Round(2)
+	return st, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// CreateStatementPDF renders the statement to pdfpath. Like reminders it uses
+// the letterhead of st.TemplateID when set, otherwise the generic layout, and
+// carries no ZUGFeRD data.
+func (s *Store) CreateStatementPDF(st *CompanyStatement, ownerID uint, pdfpath string, logger *slog.Logger) error {
+	settings, err := s.LoadSettingsForCurrency(ownerID, st.Currency)
+	if err != nil {
+		return fmt.Errorf("load settings: %w", err)
+	}
+	var tpl *LetterheadTemplate
+	if st.TemplateID != nil {
+		// A deleted template just falls back to the generic layout.
+		if tpl, err = s.LoadLetterheadTemplate(*st.TemplateID, ownerID); err != nil {
+			tpl = nil
+		}
+	}
+
+	d, err := document.New(pdfpath)
+	if err != nil {
+		return fmt.Errorf("create pdf document: %w", err)
+	}
+	d.Title = "Kontoauszug " + st.Company.Name
+	d.Author = settings.CompanyName
+	d.Language = "de"
+
+	addressee := buildAddresseeInnerHTML(&Invoice{ContactInvoice: st.Company.ContactInvoice}, st.Company)
+	info := buildStatementInfoInnerHTML(st, time.Now())
+	body := buildStatementBodyHTML(st)
+
+	if tpl != nil {
+		err = s.renderLetterheadPages(d, tpl, ownerID, addressee, info, body, "")
+	} else {
+		err = s.renderGenericPages(d, buildGenericPageHTML(settings, addressee, info, body), 0, ownerID, logger)
+	}
+	if err != nil {
+		return err
+	}
+	if err = d.Finish(); err != nil {
+		return fmt.Errorf("finish pdf: %w", err)
+	}
+	logger.Debug("generated statement PDF", "company_id", st.Company.ID, "owner_id", ownerID, "pdfpath", pdfpath)
+	return nil
+}
+
+// buildStatementInfoInnerHTML renders the info block: date, title, period
+// and customer number.
+func buildStatementInfoInnerHTML(st *CompanyStatement, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("Datum: " + esc(formatDateDE(now)) + "<br/>")
+	b.WriteString("Kontoauszug<br/>")
+	b.WriteString("Zeitraum: " + esc(formatDateDE(st.From)) + " – " + esc(formatDateDE(st.To)))
+	if st.Company.CustomerNumber != "" {
+		b.WriteString("<br/>Kundennummer: " + esc(st.Company.CustomerNumber))
+	}
+	return b.String()
+}
+
+// buildStatementBodyHTML renders the ledger table with opening and closing
+// balance.
+func buildStatementBodyHTML(st *CompanyStatement) string {
+	currency := currencyCodeToText(st.Currency)
+	const ncols = 5
+
+	var b strings.Builder
+	b.WriteString(`<p class="opening"><b>Kontoauszug</b></p>`)
+	b.WriteString(`<table class="items"><thead><tr>`)
+	b.WriteString(`<th>Datum</th>`)
+	b.WriteString(`<th>Beleg</th>`)
+	b.WriteString(`<th>Vorgang</th>`)
+	b.WriteString(`<th class="num">Betrag<br/>(` + esc(currency) + `)</th>`)
+	b.WriteString(`<th class="num">Saldo<br/>(` + esc(currency) + `)</th>`)
+	b.WriteString(`</tr></thead><tbody>`)
+	b.WriteString(sumRow("", ncols, "Anfangssaldo", st.OpeningBalance))
+	for _, e := range st.Entries {
+		b.WriteString(`<tr>`)
+		b.WriteString(`<td>` + esc(formatDateDE(e.Date)) + `</td>`)
+		b.WriteString(`<td>` + esc(e.Number) + `</td>`)
+		b.WriteString(`<td>` + esc(e.Text) + `</td>`)
+		b.WriteString(`<td class="num">` + esc(formatAmountDE(e.Amount)) + `</td>`)
+		b.WriteString(`<td class="num">` + esc(formatAmountDE(e.Balance)) + `</td>`)
+		b.WriteString(`</tr>`)
+	}
+	label := "Offener Betrag"
+	if st.ClosingBalance.IsNegative() {
+		label = "Guthaben"
+	}
+	b.WriteString(sumRow("sumfirst total", ncols, label, st.ClosingBalance))
+	b.WriteString(`</tbody></table>`)
+	return b.String()
+}
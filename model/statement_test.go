@@ -0,0 +1,160 @@
+package model_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func TestBuildCompanyStatement(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // data.Invoice stays a draft
+	owner := fixtures.DefaultOwnerID
+
+	day := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 0, 0, 0, 0, time.Local) }
+	issue := func(number string, date time.Time) *model.Invoice {
+		t.Helper()
+		inv := fixtures.Invoice(
+			fixtures.WithInvoiceCompanyID(data.Company.ID),
+			fixtures.WithInvoiceNumber(number),
+			fixtures.WithInvoiceDate(date),
+			fixtures.WithInvoiceDueDate(date.AddDate(0, 0, 14)),
+			fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+		)
+		if err := store.SaveInvoice(inv, owner); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		if err := store.MarkInvoiceIssued(inv.ID, owner, date); err != nil {
+			t.Fatalf("MarkInvoiceIssued failed: %v", err)
+		}
+		return inv
+	}
+	pay := func(inv *model.Invoice, amount int64, date time.Time) {
+		t.Helper()
+		if _, err := store.AddPayment(inv.ID, owner, decimal.NewFromInt(amount), date, ""); err != nil {
+			t.Fatalf("AddPayment failed: %v", err)
+		}
+	}
+
+	// Before the period: goes into the opening balance.
+	a := issue("RE-A", day(time.January, 10))
+	pay(a, 500, day(time.January, 20))
+	// In the period.
+	b := issue("RE-B", day(time.February, 5))
+	pay(b, 1000, day(time.February, 10))
+	c := issue("RE-C", day(time.February, 15))
+	if err := store.VoidInvoice(c.ID, owner, day(time.February, 20), false); err != nil {
+		t.Fatalf("VoidInvoice failed: %v", err)
+	}
+	e := issue("RE-E", day(time.March, 1))
+	if err := store.MarkInvoicePaid(e.ID, owner, day(time.March, 10)); err != nil {
+		t.Fatalf("MarkInvoicePaid failed: %v", err)
+	}
+	// After the period.
+	issue("RE-F", day(time.April, 5))
+
+	st, err := store.BuildCompanyStatement(owner, data.Company.ID, day(time.February, 1), day(time.March, 31))
+	if err != nil {
+		t.Fatalf("BuildCompanyStatement failed: %v", err)
+	}
+
+	gross := decimal.RequireFromString("1975.40")
+	if want := gross.Sub(decimal.NewFromInt(500)); !st.OpeningBalance.Equal(want) {
+		t.Errorf("OpeningBalance = %s, want %s", st.OpeningBalance, want)
+	}
+	want := []struct {
+		kind    model.StatementEntryKind
+		number  string
+		balance string
+	}{
+		{model.StatementEntryInvoice, "RE-B", "3450.8"},
+		{model.StatementEntryPayment, "RE-B", "2450.8"},
+		{model.StatementEntryVoided, "RE-C", "2450.8"},
+		{model.StatementEntryInvoice, "RE-E", "4426.2"},
+		{model.StatementEntryPayment, "RE-E", "2450.8"},
+	}
+	if len(st.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(st.Entries), len(want), st.Entries)
+	}
+	for i, w := range want {
+		got := st.Entries[i]
+		if got.Kind != w.kind || got.Number != w.number || !got.Balance.Equal(decimal.RequireFromString(w.balance)) {
+			t.Errorf("entry %d = %s %s balance %s, want %s %s balance %s",
+				i, got.Kind, got.Number, got.Balance, w.kind, w.number, w.balance)
+		}
+		if got.Number == data.Invoice.Number {
+			t.Errorf("draft invoice %s must not be listed", got.Number)
+		}
+	}
+	if !st.Entries[2].Amount.IsZero() {
+		t.Errorf("voided invoice amount = %s, want 0", st.Entries[2].Amount)
+	}
+	if !st.ClosingBalance.Equal(decimal.RequireFromString("2450.80")) {
+		t.Errorf("ClosingBalance = %s, want 2450.80", st.ClosingBalance)
+	}
+
+	pdfPath := filepath.Join(t.TempDir(), "statement.pdf")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := store.CreateStatementPDF(st, owner, pdfPath, logger); err != nil {
+		t.Fatalf("CreateStatementPDF failed: %v", err)
+	}
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF")
+	}
+
+	// Other owners cannot read the statement.
+	if _, err := store.BuildCompanyStatement(owner+1, data.Company.ID, day(time.January, 1), day(time.December, 31)); err == nil {
+		t.Error("expected error for foreign owner")
+	}
+}
+
+func TestBuildCompanyStatement_BaseCurrency(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	date := time.Date(2025, time.May, 2, 0, 0, 0, 0, time.Local)
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(data.Company.ID),
+		fixtures.WithInvoiceNumber("RE-USD"),
+		fixtures.WithInvoiceDate(date),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	inv.Currency = "USD"
+	inv.ExchangeRate = decimal.RequireFromString("0.9")
+	if err := store.SaveInvoice(inv, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(inv.ID, owner, date); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	if _, err := store.AddPayment(inv.ID, owner, decimal.NewFromInt(1000), date.AddDate(0, 0, 5), ""); err != nil {
+		t.Fatalf("AddPayment failed: %v", err)
+	}
+
+	st, err := store.BuildCompanyStatement(owner, data.Company.ID, date, date.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("BuildCompanyStatement failed: %v", err)
+	}
+	if st.Currency != "USD" || st.BaseCurrency != "EUR" {
+		t.Errorf("currencies %s / %s, want USD / EUR", st.Currency, st.BaseCurrency)
+	}
+	if want := decimal.RequireFromString("975.40"); !st.ClosingBalance.Equal(want) {
+		t.Errorf("closing balance %s, want %s", st.ClosingBalance, want)
+	}
+	if want := decimal.RequireFromString("877.86"); !st.ClosingBalanceBase.Equal(want) {
+		t.Errorf("closing balance in base currency %s, want %s", st.ClosingBalanceBase, want)
+	}
+}
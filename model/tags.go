@@ -2,6 +2,7 @@
 package model
 
 import (
+	"errors"
 	"strings"
 	"time"
 
@@ -146,7 +147,7 @@ func (s *Store) addTagsToParent(tx *gorm.DB, ownerID uint, parentType ParentType
 		},
 		DoUpdates: clause.Assignments(map[string]any{
 			"deleted_at": gorm.Expr("NULL"),
-			"updated_at": gorm.Expr("NOW()"),
+			"updated_at": time.Now(),
 		}),
 	}).Create(&links).Error
 }
@@ -319,6 +320,54 @@ func (s *Store) AddTagsToCompanyByName(companyID, ownerID uint, names []string)
 	})
 }
 
+// AddTagToCompanies adds the tag tagName to all given companies of the owner
+// in one transaction. Companies that already carry the tag, and IDs that do
+// not belong to the owner, are skipped. It returns the number of companies
+// the tag was actually added to.
+func (s *Store) AddTagToCompanies(ownerID uint, companyIDs []uint, tagName string) (int, error) {
+	if strings.TrimSpace(tagName) == "" {
+		return 0, errors.New("AddTagToCompanies: tag name required")
+	}
+	if len(companyIDs) == 0 {
+		return 0, nil
+	}
+	added := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		tags, err := s.ensureTags(tx, ownerID, []string{tagName})
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return errors.New("AddTagToCompanies: tag could not be created")
+		}
+		tag := tags[0]
+
+		var ownIDs []uint
+		if err := tx.Model(&Company{}).
+			Where("owner_id = ? AND id IN ?", ownerID, companyIDs).
+			Pluck("id", &ownIDs).Error; err != nil {
+			return err
+		}
+		var taggedIDs []uint
+		if err := tx.Model(&TagLink{}).
+			Where("owner_id = ? AND tag_id = ? AND parent_type = ? AND parent_id IN ?", ownerID, tag.ID, ParentTypeCompany, ownIDs).
+			Pluck("parent_id", &taggedIDs).Error; err != nil {
+			return err
+		}
+		for _, id := range diffUint(ownIDs, taggedIDs) {
+			if err := s.addTagsToParent(tx, ownerID, ParentTypeCompany, id, tags); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
 func (s *Store) ReplaceCompanyTagsByName(companyID, ownerID uint, names []string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		tags, err := s.ensureTags(tx, ownerID, names)
@@ -349,6 +398,71 @@ func (s *Store) ReplacePersonTagsByName(personID, ownerID uint, names []string)
 	})
 }
 
+// ErrTagNotFound is returned by RenameTag if the owner has no tag with the
+// given name.
+var ErrTagNotFound = errors.New("tag not found")
+
+// RenameTag renames the owner's tag oldName to newName everywhere it is used.
+// If another tag already has the name newName (compared case-insensitively),
+// the two are merged: all links are moved to the existing tag, links that
+// would be duplicates are dropped and the old tag is deleted.
+func (s *Store) RenameTag(ownerID uint, oldName, newName string) error {
+	oldNorm, newNorm := normalizeTag(oldName), normalizeTag(newName)
+	newName = strings.TrimSpace(newName)
+	if oldNorm == "" || newNorm == "" {
+		return errors.New("RenameTag: old and new name required")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var tag Tag
+		if err := tx.Where("owner_id = ? AND norm = ?", ownerID, oldNorm).First(&tag).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTagNotFound
+			}
+			return err
+		}
+
+		var target Tag
+		err := tx.Where("owner_id = ? AND norm = ? AND id <> ?", ownerID, newNorm, tag.ID).First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Plain rename (also covers a change of case only).
+			return tx.Model(&tag).Updates(map[string]any{"name": newName, "norm": newNorm}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// Merge into target. Soft-deleted links of the old tag carry no
+		// information.
+		if err := tx.Unscoped().Where("owner_id = ? AND tag_id = ? AND deleted_at IS NOT NULL", ownerID, tag.ID).
+			Delete(&TagLink{}).Error; err != nil {
+			return err
+		}
+		sameParent := "tag_links.parent_type = o.parent_type AND tag_links.parent_id = o.parent_id"
+		// A parent carrying both tags keeps the target link (revived if it
+		// was removed earlier) ...
+		if err := tx.Model(&TagLink{}).Unscoped().
+			Where("owner_id = ? AND tag_id = ? AND deleted_at IS NOT NULL", ownerID, target.ID).
+			Where("EXISTS (SELECT 1 FROM tag_links o WHERE o.tag_id = ? AND "+sameParent+")", tag.ID).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		// ... and loses the old one, which would otherwise violate the unique
+		// index when re-pointed.
+		if err := tx.Unscoped().
+			Where("owner_id = ? AND tag_id = ?", ownerID, tag.ID).
+			Where("EXISTS (SELECT 1 FROM tag_links o WHERE o.tag_id = ? AND "+sameParent+")", target.ID).
+			Delete(&TagLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&TagLink{}).Unscoped().
+			Where("owner_id = ? AND tag_id = ?", ownerID, tag.ID).
+			Update("tag_id", target.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+}
+
 // SuggestTags returns tags for an owner whose normalized form starts with the given prefix.
 // It filters out soft-deleted rows and orders by display name (Name) ascending.
 // If limit <= 0, a sensible default is used.
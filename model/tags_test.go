@@ -0,0 +1,140 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestAddTagToCompanies(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	second := fixtures.Company(fixtures.WithCompanyName("Zweite GmbH"))
+	if err := store.SaveCompany(second, fixtures.DefaultOwnerID, []string{"Premium"}); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	foreign := fixtures.Company(fixtures.WithCompanyName("Fremd AG"), fixtures.WithCompanyOwnerID(fixtures.DefaultOwnerID+1))
+	if err := store.SaveCompany(foreign, fixtures.DefaultOwnerID+1, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	ids := []uint{data.Company.ID, second.ID, foreign.ID}
+	added, err := store.AddTagToCompanies(fixtures.DefaultOwnerID, ids, "premium")
+	if err != nil {
+		t.Fatalf("AddTagToCompanies failed: %v", err)
+	}
+	if added != 1 {
+		t.Errorf("added = %d, want 1 (second company already tagged, foreign company skipped)", added)
+	}
+
+	// Running it again adds nothing.
+	if added, err = store.AddTagToCompanies(fixtures.DefaultOwnerID, ids, "Premium"); err != nil || added != 0 {
+		t.Errorf("second run: added = %d, err = %v, want 0, nil", added, err)
+	}
+
+	tags, err := store.ListTagsForParent(fixtures.DefaultOwnerID, model.ParentTypeCompany, data.Company.ID)
+	if err != nil {
+		t.Fatalf("ListTagsForParent failed: %v", err)
+	}
+	if len(tags) != 1 || tags[0].Name != "Premium" {
+		t.Errorf("tags = %v, want [Premium]", tags)
+	}
+	if tags, _ := store.ListTagsForParent(fixtures.DefaultOwnerID+1, model.ParentTypeCompany, foreign.ID); len(tags) != 0 {
+		t.Errorf("foreign company got tags %v", tags)
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+
+	companies := map[string][]string{
+		"A GmbH": {"Premum"},
+		"B GmbH": {"Premum", "Premium"},
+		"C GmbH": {"Premium"},
+	}
+	ids := map[string]uint{}
+	for name, tags := range companies {
+		c := fixtures.Company(fixtures.WithCompanyName(name))
+		if err := store.SaveCompany(c, fixtures.DefaultOwnerID, tags); err != nil {
+			t.Fatalf("SaveCompany failed: %v", err)
+		}
+		ids[name] = c.ID
+	}
+	tagNames := func(name string) []string {
+		tags, err := store.ListTagsForParent(fixtures.DefaultOwnerID, model.ParentTypeCompany, ids[name])
+		if err != nil {
+			t.Fatalf("ListTagsForParent failed: %v", err)
+		}
+		var out []string
+		for _, tag := range tags {
+			out = append(out, tag.Name)
+		}
+		return out
+	}
+
+	// Merge the misspelled tag into the existing one.
+	if err := store.RenameTag(fixtures.DefaultOwnerID, "premum", "PREMIUM"); err != nil {
+		t.Fatalf("RenameTag (merge) failed: %v", err)
+	}
+	for name := range companies {
+		if got := tagNames(name); len(got) != 1 || got[0] != "Premium" {
+			t.Errorf("%s: tags = %v, want [Premium]", name, got)
+		}
+	}
+	if err := store.RenameTag(fixtures.DefaultOwnerID, "Premum", "x"); !errors.Is(err, model.ErrTagNotFound) {
+		t.Errorf("old tag still exists: err = %v, want ErrTagNotFound", err)
+	}
+
+	// Plain rename.
+	if err := store.RenameTag(fixtures.DefaultOwnerID, "premium", "VIP"); err != nil {
+		t.Fatalf("RenameTag failed: %v", err)
+	}
+	if got := tagNames("B GmbH"); len(got) != 1 || got[0] != "VIP" {
+		t.Errorf("tags = %v, want [VIP]", got)
+	}
+
+	// Other owners cannot rename the tag.
+	if err := store.RenameTag(fixtures.DefaultOwnerID+1, "vip", "x"); !errors.Is(err, model.ErrTagNotFound) {
+		t.Errorf("other owner: err = %v, want ErrTagNotFound", err)
+	}
+}
+
+func TestTagUsageCounts(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+
+	for _, name := range []string{"A GmbH", "B GmbH"} {
+		c := fixtures.Company(fixtures.WithCompanyName(name))
+		if err := store.SaveCompany(c, fixtures.DefaultOwnerID, []string{"Kunde", "Messe"}); err != nil {
+			t.Fatalf("SaveCompany failed: %v", err)
+		}
+	}
+	if err := store.AddTagsToPersonByName(data.Person.ID, fixtures.DefaultOwnerID, []string{"Messe", "Presse"}); err != nil {
+		t.Fatalf("AddTagsToPersonByName failed: %v", err)
+	}
+	// Removing a tag from the person must not count any more.
+	if err := store.ReplacePersonTagsByName(data.Person.ID, fixtures.DefaultOwnerID, []string{"Messe"}); err != nil {
+		t.Fatalf("ReplacePersonTagsByName failed: %v", err)
+	}
+
+	got, err := store.TagUsageCounts(fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("TagUsageCounts failed: %v", err)
+	}
+	want := []model.TagUsage{
+		{Name: "Messe", Companies: 2, Persons: 1, Total: 3},
+		{Name: "Kunde", Companies: 2, Persons: 0, Total: 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("TagUsageCounts = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("TagUsageCounts[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package model
+
+import "strings"
+
+// Default statutory notes for invoices without tax, per tax category and
+// language ("de", "en"). Settings can replace them, see Settings.TaxNote.
+var defaultTaxNotes = map[string]map[string]string{
+	"AE": {
+		"de": "Steuerschuldnerschaft des Leistungsempfängers",
+		"en": "Reverse charge: VAT to be accounted for by the recipient",
+	},
+	"K": {
+		"de": "Steuerfreie innergemeinschaftliche Lieferung",
+		"en": "VAT exempt intra-community supply",
+	},
+}
+
+// DefaultTaxNote returns the built-in note for invoices of taxType in lang
+// ("de" or "en"), or "" if the category needs none.
+func DefaultTaxNote(taxType, lang string) string {
+	return defaultTaxNotes[taxType][lang]
+}
+
+// taxNoteSubjectCode is the subject code (BT-21, UNTDID 4451) of the tax
+// note: "Tax declaration (value added tax)".
+const taxNoteSubjectCode = "TXD"
+
+// TaxNote returns the statutory sentence invoices of taxType (AE for reverse
+// charge, K for intra-community supplies) must show, in the language of the
+// owner's locale. The texts from the settings win over the built-in ones.
+// Other tax categories get "".
+func (s *Settings) TaxNote(taxType string) string {
+	lang := "de"
+	if NormalizeLocale(s.Locale) == LocaleEN {
+		lang = "en"
+	}
+	var custom string
+	switch taxType + "/" + lang {
+	case "AE/de":
+		custom = s.TaxNoteAEDE
+	case "AE/en":
+		custom = s.TaxNoteAEEN
+	case "K/de":
+		custom = s.TaxNoteKDE
+	case "K/en":
+		custom = s.TaxNoteKEN
+	}
+	if custom = strings.TrimSpace(custom); custom != "" {
+		return custom
+	}
+	return DefaultTaxNote(taxType, lang)
+}
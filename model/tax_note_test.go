@@ -0,0 +1,61 @@
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestSettingsTaxNote(t *testing.T) {
+	s := &model.Settings{Locale: model.LocaleDE}
+	if got := s.TaxNote("AE"); got != "Steuerschuldnerschaft des Leistungsempfängers" {
+		t.Errorf("AE/de = %q", got)
+	}
+	if got := s.TaxNote("S"); got != "" {
+		t.Errorf("S = %q, want none", got)
+	}
+	s.Locale = model.LocaleEN
+	s.TaxNoteKEN = "Tax-free intra-community supply (Art. 138 VAT Directive)"
+	if got := s.TaxNote("K"); got != s.TaxNoteKEN {
+		t.Errorf("K/en = %q, want the configured text", got)
+	}
+	if got := s.TaxNote("AE"); got != model.DefaultTaxNote("AE", "en") {
+		t.Errorf("AE/en = %q", got)
+	}
+}
+
+func TestZUGFeRDXML_ReverseChargeNote(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	inv := fixtures.Invoice(fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber("RE-AE"),
+		fixtures.WithInvoiceTaxType("AE"), fixtures.WithInvoicePositions(fixtures.ZeroTaxPositions()...))
+	if err := store.SaveInvoice(inv, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	inv, err := store.LoadInvoice(inv.ID, owner)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "invoice.xml")
+	if err := store.WriteZUGFeRDXML(inv, owner, path); err != nil {
+		t.Fatalf("WriteZUGFeRDXML failed: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(b)
+	note := model.DefaultTaxNote("AE", "de")
+	if !strings.Contains(xml, "<ram:SubjectCode>TXD</ram:SubjectCode>") || !strings.Contains(xml, "<ram:Content>"+note+"</ram:Content>") {
+		t.Errorf("XML lacks the tax note:\n%s", xml)
+	}
+	if !strings.Contains(xml, "<ram:ExemptionReason>"+note+"</ram:ExemptionReason>") {
+		t.Errorf("XML lacks the exemption reason:\n%s", xml)
+	}
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TaxReportRow holds the net amounts and the tax of one tax category and
+// rate in a period.
+type TaxReportRow struct {
+	Category string // tax category code of the invoices, e.g. S, AE, E
+	Rate     decimal.Decimal
+	Net      decimal.Decimal
+	Tax      decimal.Decimal
+	Invoices int // number of invoices with positions in this row
+}
+
+// Label returns the name of the row's tax category, see TaxCategoryLabel.
+func (r TaxReportRow) Label() string { return TaxCategoryLabel(r.Category) }
+
+// ReverseCharge reports whether the tax of the row is owed by the customer.
+func (r TaxReportRow) ReverseCharge() bool { return r.Category == "AE" }
+
+// Exempt reports whether the row's turnover is exempt from tax.
+func (r TaxReportRow) Exempt() bool { return r.Category == "E" }
+
+// TaxCategoryLabel returns the German name of a tax category code.
+func TaxCategoryLabel(code string) string {
+	switch code {
+	case "S":
+		return "Regelsteuersatz"
+	case "AE":
+		return "Steuerschuldnerschaft des Leistungsempfängers"
+	case "E":
+		return "Steuerbefreit"
+	case "K":
+		return "Innergemeinschaftliche Lieferung"
+	case "G":
+		return "Ausfuhr"
+	case "Z":
+		return "Nullsatz"
+	case "O":
+		return "Nicht steuerbar"
+	default:
+		return code
+	}
+}
+
+// TaxReport sums the net amounts and the tax of the owner's issued and paid
+// invoices with an invoice date in [from, to) per tax category and rate, in
+// the base currency. The sums come from the stored positions; the tax of each
+// invoice is rounded per line or per rate, following the rounding mode
+// frozen with it. Drafts and voided invoices are left out, credit notes reduce the
+// sums. The standard category comes first, the others follow by code; within
+// a category the highest rate comes first.
+func (s *Store) TaxReport(ownerID uint, from, to time.Time) ([]TaxReportRow, error) {
+	var invs []Invoice
+	err := s.db.
+		Where("owner_id = ? AND status IN ? AND date >= ? AND date < ?",
+			ownerID, []InvoiceStatus{InvoiceStatusIssued, InvoiceStatusPaid}, from, to).
+		Preload("InvoicePositions", "owner_id = ?", ownerID).
+		Find(&invs).Error
+	if err != nil {
+		return nil, fmt.Errorf("tax report (owner %d): %w", ownerID, err)
+	}
+
+	type rowKey struct{ category, rate string }
+	rows := map[rowKey]*TaxReportRow{}
+	for i := range invs {
+		inv := &invs[i]
+		category := cmp.Or(inv.TaxType, "S")
+		for _, t := range invoiceRateTotals(inv) {
+			key := rowKey{category, t.Rate.String()}
+			row, ok := rows[key]
+			if !ok {
+				row = &TaxReportRow{Category: category, Rate: t.Rate}
+				rows[key] = row
+			}
+			row.Net = row.Net.Add(inv.ToBaseCurrency(t.Net))
+			row.Tax = row.Tax.Add(inv.ToBaseCurrency(t.Tax))
+			row.Invoices++
+		}
+	}
+
+	out := make([]TaxReportRow, 0, len(rows))
+	for _, row := range rows {
+		row.Net = row.Net.Round(2)
+		row.Tax = row.Tax.Round(2)
+		out = append(out, *row)
+	}
+	slices.SortFunc(out, func(a, b TaxReportRow) int {
+		if (a.Category == "S") != (b.Category == "S") {
+			if a.Category == "S" {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(a.Category, b.Category); c != 0 {
+			return c
+		}
+		return b.Rate.Cmp(a.Rate)
+	})
+	return out, nil
+}
+
+// rateTotal is the net amount and the tax of an invoice at one tax rate.
+type rateTotal struct {
+	Rate, Net, Tax decimal.Decimal
+}
+
+// invoiceRateTotals returns the net amount and the tax of inv per tax rate
+// of its positions, highest rate first. The tax is rounded per line or per
+// rate depending on the invoice's rounding mode, like RecomputeTotals does.
+func invoiceRateTotals(inv *Invoice) []rateTotal {
+	var out []rateTotal
+	for _, p := range inv.InvoicePositions {
+		idx := slices.IndexFunc(out, func(t rateTotal) bool { return t.Rate.Equal(p.TaxRate) })
+		if idx < 0 {
+			idx = len(out)
+			out = append(out, rateTotal{Rate: p.TaxRate})
+		}
+		out[idx].Net = out[idx].Net.Add(p.LineTotal)
+		if inv.RoundingMode == RoundingModeLine {
+			out[idx].Tax = out[idx].Tax.Add(lineTax(p.LineTotal, p.TaxRate))
+		}
+	}
+	if inv.RoundingMode != RoundingModeLine {
+		for i := range out {
+			out[i].Tax = lineTax(out[i].Net, out[i].Rate)
+		}
+	}
+	slices.SortFunc(out, func(a, b rateTotal) int { return b.Rate.Cmp(a.Rate) })
+	return out
+}
@@ -0,0 +1,62 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestTaxReport(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store) // data.Invoice stays a draft
+	owner := fixtures.DefaultOwnerID
+
+	date := time.Date(2025, time.May, 10, 0, 0, 0, 0, time.UTC)
+	issue := func(number string, d time.Time, opts ...fixtures.InvoiceOption) {
+		t.Helper()
+		opts = append(opts, fixtures.WithInvoiceCompanyID(data.Company.ID), fixtures.WithInvoiceNumber(number), fixtures.WithInvoiceDate(d))
+		inv := fixtures.Invoice(opts...)
+		if err := store.SaveInvoice(inv, owner); err != nil {
+			t.Fatalf("SaveInvoice failed: %v", err)
+		}
+		if err := store.MarkInvoiceIssued(inv.ID, owner, d); err != nil {
+			t.Fatalf("MarkInvoiceIssued failed: %v", err)
+		}
+	}
+	issue("RE-1", date, fixtures.WithInvoicePositions(fixtures.SamplePositions()...)) // 1660 net at 19 %
+	issue("RE-2", date, fixtures.WithInvoicePositions(fixtures.Position(1, "Buch", 2, 50, 7)))
+	issue("RE-3", date, fixtures.WithInvoiceTaxType("AE"), fixtures.WithInvoicePositions(fixtures.ZeroTaxPositions()...)) // 2500 net
+	issue("RE-4", date.AddDate(0, 3, 0), fixtures.WithInvoicePositions(fixtures.SamplePositions()...))                    // next quarter
+
+	from := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)
+	rows, err := store.TaxReport(owner, from, from.AddDate(0, 3, 0))
+	if err != nil {
+		t.Fatalf("TaxReport failed: %v", err)
+	}
+	want := []struct {
+		category, rate, net, tax string
+		invoices                 int
+	}{
+		{"S", "19", "1660", "315.4", 1},
+		{"S", "7", "100", "7", 1},
+		{"AE", "0", "2500", "0", 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.Category != w.category || r.Rate.String() != w.rate || r.Net.String() != w.net || r.Tax.String() != w.tax || r.Invoices != w.invoices {
+			t.Errorf("row %d = %s %s%% net %s tax %s (%d), want %s %s%% net %s tax %s (%d)",
+				i, r.Category, r.Rate, r.Net, r.Tax, r.Invoices, w.category, w.rate, w.net, w.tax, w.invoices)
+		}
+	}
+	if !rows[2].ReverseCharge() || rows[0].ReverseCharge() {
+		t.Error("ReverseCharge wrong")
+	}
+	if got := model.TaxCategoryLabel("E"); got != "Steuerbefreit" {
+		t.Errorf("TaxCategoryLabel(E) = %q", got)
+	}
+}
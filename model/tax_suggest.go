@@ -0,0 +1,90 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/biter777/countries"
+	"github.com/shopspring/decimal"
+)
+
+// euStandardRates holds the member states of the European Union with their
+// standard VAT rate in percent (as of 2025).
+var euStandardRates = map[countries.CountryCode]string{
+	countries.AUT: "20",
+	countries.BEL: "21",
+	countries.BGR: "20",
+	countries.HRV: "25",
+	countries.CYP: "19",
+	countries.CZE: "21",
+	countries.DNK: "25",
+	countries.EST: "24",
+	countries.FIN: "25.5",
+	countries.FRA: "20",
+	countries.DEU: "19",
+	countries.GRC: "24",
+	countries.HUN: "27",
+	countries.IRL: "23",
+	countries.ITA: "22",
+	countries.LVA: "21",
+	countries.LTU: "21",
+	countries.LUX: "17",
+	countries.MLT: "18",
+	countries.NLD: "21",
+	countries.POL: "23",
+	countries.PRT: "23",
+	countries.ROU: "21",
+	countries.SVK: "23",
+	countries.SVN: "22",
+	countries.ESP: "21",
+	countries.SWE: "25",
+}
+
+// IsEUCountry reports whether country (a name in English or German or an
+// ISO code) is a member state of the European Union.
+func IsEUCountry(country string) bool {
+	_, ok := euStandardRates[countries.ByName(strings.TrimSpace(country))]
+	return ok
+}
+
+// SuggestTaxTypeAndRate returns the tax category and rate an invoice from a
+// seller in sellerCountry to a buyer in buyerCountry usually has:
+//
+//   - same country, or no or an unknown buyer country: S with the seller's
+//     standard rate
+//   - buyer in another EU state with a VAT ID: AE (reverse charge), 0 %
+//   - buyer in another EU state without a VAT ID: S with the seller's rate
+//   - buyer outside the EU: G (export), 0 %
+//
+// An empty sellerCountry counts as Germany. The result is a suggestion for
+// new invoices only: intra-community supplies of goods (K), exempt turnover
+// and the OSS thresholds for consumers are left to the user. The rate is zero
+// for sellers outside the EU, whose standard rate is not known.
+func SuggestTaxTypeAndRate(sellerCountry, buyerCountry string, buyerHasVATID bool) (string, decimal.Decimal) {
+	seller := countries.DEU
+	if s := strings.TrimSpace(sellerCountry); s != "" {
+		seller = countries.ByName(s)
+	}
+	standard := decimal.Zero
+	if rate, ok := euStandardRates[seller]; ok {
+		standard = decimal.RequireFromString(rate)
+	}
+
+	b := strings.TrimSpace(buyerCountry)
+	if b == "" {
+		return "S", standard
+	}
+	buyer := countries.ByName(b)
+	if buyer == seller || buyer == countries.Unknown {
+		return "S", standard
+	}
+	_, sellerEU := euStandardRates[seller]
+	_, buyerEU := euStandardRates[buyer]
+	switch {
+	case sellerEU && buyerEU && buyerHasVATID:
+		return "AE", decimal.Zero
+	case sellerEU && buyerEU:
+		return "S", standard
+	default:
+		return "G", decimal.Zero
+	}
+}
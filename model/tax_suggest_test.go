@@ -0,0 +1,37 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/billingcat/crm/model"
+)
+
+func TestSuggestTaxTypeAndRate(t *testing.T) {
+	tests := []struct {
+		seller, buyer string
+		vatID         bool
+		wantType      string
+		wantRate      string
+	}{
+		{"DE", "Deutschland", false, "S", "19"},
+		{"", "", true, "S", "19"},
+		{"DE", "Frankreich", true, "AE", "0"},
+		{"DE", "France", false, "S", "19"},
+		{"DE", "Schweiz", true, "G", "0"},
+		{"DE", "USA", false, "G", "0"},
+		{"AT", "Österreich", true, "S", "20"},
+		{"AT", "Deutschland", true, "AE", "0"},
+		{"DE", "Atlantis", false, "S", "19"},
+		{"CH", "Deutschland", true, "G", "0"},
+	}
+	for _, tt := range tests {
+		gotType, gotRate := model.SuggestTaxTypeAndRate(tt.seller, tt.buyer, tt.vatID)
+		if gotType != tt.wantType || gotRate.String() != tt.wantRate {
+			t.Errorf("SuggestTaxTypeAndRate(%q, %q, %v) = %s %s, want %s %s",
+				tt.seller, tt.buyer, tt.vatID, gotType, gotRate, tt.wantType, tt.wantRate)
+		}
+	}
+	if !model.IsEUCountry("Niederlande") || model.IsEUCountry("Norwegen") {
+		t.Error("IsEUCountry wrong for NL or NO")
+	}
+}
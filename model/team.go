@@ -0,0 +1,158 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User roles. The user who signed up owns the data of the owner (tenant) and
+// manages the team; invited colleagues are members with the same data access
+// but without team management. An admin is an owner who additionally
+// administers the whole installation (users, invitation codes, all
+// letterhead templates).
+const (
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+// IsAdmin reports whether u administers the installation.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// CanManageTeam reports whether u may invite and remove team members.
+func (u *User) CanManageTeam() bool {
+	return u.Role == RoleOwner || u.Role == RoleAdmin
+}
+
+// TeamInvitation invites someone by email to join an owner as RoleMember.
+// Only the hash of the token in the invitation link is stored.
+type TeamInvitation struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"not null"`
+	OwnerID    uint      `gorm:"not null;index"`
+	InvitedBy  uint      `gorm:"not null"` // user ID
+	Email      string    `gorm:"not null"` // lowercase
+	TokenHash  []byte    `gorm:"not null;uniqueIndex"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	AcceptedAt *time.Time
+}
+
+func (TeamInvitation) TableName() string { return "team_invitations" }
+
+// ErrInvitationInvalid is returned for unknown, expired or used invitations.
+var ErrInvitationInvalid = errors.New("invitation invalid or expired")
+
+// CreateTeamInvitation stores an invitation of email to ownerID, valid for
+// ttl. tokenHash is the sha256 of the token sent in the link.
+func (s *Store) CreateTeamInvitation(ownerID, invitedBy uint, email string, tokenHash []byte, ttl time.Duration) (*TeamInvitation, error) {
+	inv := &TeamInvitation{
+		OwnerID:   ownerID,
+		InvitedBy: invitedBy,
+		Email:     NormalizeEmail(email),
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	if err := s.db.Create(inv).Error; err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// ListOpenTeamInvitations returns the owner's invitations that were not
+// accepted yet, newest first. Expired ones are included so they can be
+// deleted or sent again.
+func (s *Store) ListOpenTeamInvitations(ownerID uint) ([]TeamInvitation, error) {
+	var invs []TeamInvitation
+	err := s.db.Where("owner_id = ? AND accepted_at IS NULL", ownerID).
+		Order("created_at DESC").Find(&invs).Error
+	return invs, err
+}
+
+// DeleteTeamInvitation withdraws an invitation of the owner.
+func (s *Store) DeleteTeamInvitation(id, ownerID uint) error {
+	res := s.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&TeamInvitation{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindTeamInvitation returns the usable (not expired, not accepted)
+// invitation whose token hashes to tokenHash, else ErrInvitationInvalid.
+func (s *Store) FindTeamInvitation(tokenHash []byte) (*TeamInvitation, error) {
+	return findTeamInvitation(s.db, tokenHash)
+}
+
+func findTeamInvitation(db *gorm.DB, tokenHash []byte) (*TeamInvitation, error) {
+	var inv TeamInvitation
+	err := db.Where("token_hash = ? AND accepted_at IS NULL", tokenHash).First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(inv.ExpiresAt) {
+		return nil, ErrInvitationInvalid
+	}
+	return &inv, nil
+}
+
+// AcceptTeamInvitation creates the invited user as RoleMember of the
+// inviting owner and marks the invitation as used. The invitation email
+// becomes the login; it has been verified by opening the link. An address
+// that already has an account yields ErrEmailTaken.
+func (s *Store) AcceptTeamInvitation(tokenHash []byte, fullName, password string) (*User, error) {
+	var u *User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		inv, err := findTeamInvitation(tx, tokenHash)
+		if err != nil {
+			return err
+		}
+		var n int64
+		if err := tx.Unscoped().Model(&User{}).Where("email = ?", inv.Email).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrEmailTaken
+		}
+		u = &User{
+			Email:    inv.Email,
+			FullName: fullName,
+			Verified: true,
+			OwnerID:  inv.OwnerID,
+			Role:     RoleMember,
+		}
+		if err := s.SetPassword(u, password); err != nil {
+			return err
+		}
+		if err := tx.Create(u).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+		now := time.Now().UTC()
+		return tx.Model(inv).Update("accepted_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ListTeamMembers returns the users of the owner, the managing roles first.
+func (s *Store) ListTeamMembers(ownerID uint) ([]User, error) {
+	var users []User
+	err := s.db.Where("owner_id = ?", ownerID).
+		Order("CASE WHEN role = 'member' THEN 1 ELSE 0 END, created_at ASC").
+		Find(&users).Error
+	return users, err
+}
@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestAcceptTeamInvitation(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+
+	hash := sha256.Sum256([]byte("invite-token"))
+	if _, err := store.CreateTeamInvitation(owner, data.User.ID, " Colleague@Example.com ", hash[:], time.Hour); err != nil {
+		t.Fatalf("CreateTeamInvitation failed: %v", err)
+	}
+	invs, err := store.ListOpenTeamInvitations(owner)
+	if err != nil || len(invs) != 1 || invs[0].Email != "colleague@example.com" {
+		t.Fatalf("ListOpenTeamInvitations = %+v, %v", invs, err)
+	}
+
+	u, err := store.AcceptTeamInvitation(hash[:], "Colleague", "secret")
+	if err != nil {
+		t.Fatalf("AcceptTeamInvitation failed: %v", err)
+	}
+	if u.OwnerID != owner || u.Role != model.RoleMember || !u.Verified {
+		t.Errorf("new user: owner %d, role %q, verified %v", u.OwnerID, u.Role, u.Verified)
+	}
+	if u.CanManageTeam() {
+		t.Errorf("member must not manage the team")
+	}
+	if !store.CheckPassword(u, "secret") {
+		t.Errorf("password not set")
+	}
+
+	// The link works only once.
+	if _, err := store.AcceptTeamInvitation(hash[:], "Again", "secret"); !errors.Is(err, model.ErrInvitationInvalid) {
+		t.Errorf("second accept: got %v, want ErrInvitationInvalid", err)
+	}
+	if invs, _ := store.ListOpenTeamInvitations(owner); len(invs) != 0 {
+		t.Errorf("accepted invitation still open")
+	}
+
+	members, err := store.ListTeamMembers(owner)
+	if err != nil {
+		t.Fatalf("ListTeamMembers failed: %v", err)
+	}
+	if len(members) != 2 || members[0].Role != model.RoleOwner {
+		t.Errorf("members = %+v", members)
+	}
+
+	// Existing accounts cannot be invited again, expired links do not work.
+	taken := sha256.Sum256([]byte("taken"))
+	if _, err := store.CreateTeamInvitation(owner, data.User.ID, data.User.Email, taken[:], time.Hour); err != nil {
+		t.Fatalf("CreateTeamInvitation failed: %v", err)
+	}
+	if _, err := store.AcceptTeamInvitation(taken[:], "", "secret"); !errors.Is(err, model.ErrEmailTaken) {
+		t.Errorf("taken email: got %v, want ErrEmailTaken", err)
+	}
+	expired := sha256.Sum256([]byte("expired"))
+	if _, err := store.CreateTeamInvitation(owner, data.User.ID, "late@example.com", expired[:], -time.Minute); err != nil {
+		t.Fatalf("CreateTeamInvitation failed: %v", err)
+	}
+	if _, err := store.FindTeamInvitation(expired[:]); !errors.Is(err, model.ErrInvitationInvalid) {
+		t.Errorf("expired invitation: got %v, want ErrInvitationInvalid", err)
+	}
+}
@@ -0,0 +1,821 @@
+package model
+
+import (
+	"archive/zip"
+	"cmp"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// The types below mirror the XML written by the full export on the settings
+// page (see controller.settingsExportXML). Only the fields needed to
+// recreate the records are read, IDs are the ones of the exporting owner.
+
+type tenantImportNote struct {
+	Title  string `xml:"title"`
+	Body   string `xml:"body"`
+	Tags   string `xml:"tags"`
+	Pinned bool   `xml:"pinned"`
+}
+
+type tenantImportContactInfo struct {
+	Type  string `xml:"type"`
+	Label string `xml:"label"`
+	Value string `xml:"value"`
+}
+
+type tenantImportCustomers struct {
+	Customers []struct {
+		ID                     uint                      `xml:"id,attr"`
+		Name                   string                    `xml:"name"`
+		CustomerNumber         string                    `xml:"customer_number"`
+		Address1               string                    `xml:"address1"`
+		Address2               string                    `xml:"address2"`
+		Zip                    string                    `xml:"zip"`
+		City                   string                    `xml:"city"`
+		Country                string                    `xml:"country"`
+		InvoiceEmail           string                    `xml:"invoice_email"`
+		ContactInvoice         string                    `xml:"contact_invoice"`
+		SupplierNumber         string                    `xml:"supplier_number"`
+		VATID                  string                    `xml:"vat_id"`
+		Background             string                    `xml:"background"`
+		Notes                  []tenantImportNote        `xml:"notes>note"`
+		ContactInfos           []tenantImportContactInfo `xml:"contact_infos>contact_info"`
+		DefaultTaxRate         string                    `xml:"default_tax_rate"`
+		InvoiceCurrency        string                    `xml:"invoice_currency"`
+		InvoiceTaxType         string                    `xml:"invoice_tax_type"`
+		InvoiceOpening         string                    `xml:"invoice_opening"`
+		InvoiceFooter          string                    `xml:"invoice_footer"`
+		InvoiceExemptionReason string                    `xml:"invoice_exemption_reason"`
+	} `xml:"customer"`
+}
+
+type tenantImportPersons struct {
+	Persons []struct {
+		Name         string                    `xml:"name"`
+		Position     string                    `xml:"position"`
+		Email        string                    `xml:"email"`
+		CompanyID    uint                      `xml:"company_id"`
+		ContactInfos []tenantImportContactInfo `xml:"contact_infos>contact_info"`
+		Notes        []tenantImportNote        `xml:"notes>note"`
+	} `xml:"person"`
+}
+
+type tenantImportInvoices struct {
+	Invoices []struct {
+		ID               uint       `xml:"id,attr"`
+		Number           string     `xml:"number"`
+		Status           string     `xml:"status"`
+		DocumentType     string     `xml:"document_type"`
+		ReferencedNumber string     `xml:"referenced_invoice_number"`
+		Currency         string     `xml:"currency"`
+		NetTotal         string     `xml:"net_total"`
+		GrossTotal       string     `xml:"gross_total"`
+		Date             time.Time  `xml:"date"`
+		DueDate          time.Time  `xml:"due_date"`
+		CompanyID        uint       `xml:"company_id"`
+		ContactInvoice   string     `xml:"contact_invoice"`
+		Counter          uint       `xml:"counter"`
+		ExemptionReason  string     `xml:"exemption_reason"`
+		Footer           string     `xml:"footer"`
+		Opening          string     `xml:"opening"`
+		OccurrenceDate   time.Time  `xml:"occurrence_date"`
+		OrderNumber      string     `xml:"order_number"`
+		BuyerReference   string     `xml:"buyer_reference"`
+		SupplierNumber   string     `xml:"supplier_number"`
+		TaxNumber        string     `xml:"tax_number"`
+		TaxType          string     `xml:"tax_type"`
+		TemplateID       *uint      `xml:"template_id"`
+		IssuedAt         *time.Time `xml:"issued_at"`
+		PaidAt           *time.Time `xml:"paid_at"`
+		VoidedAt         *time.Time `xml:"voided_at"`
+		ExchangeRate     string     `xml:"exchange_rate"`
+		ZugferdProfile   string     `xml:"zugferd_profile"`
+		SkontoPercent    string     `xml:"skonto_percent"`
+		SkontoDays       int        `xml:"skonto_days"`
+		PaymentReference string     `xml:"payment_reference"`
+		PriceDecimals    int        `xml:"price_decimals"`
+		RoundingMode     string     `xml:"rounding_mode"`
+		Positions        []struct {
+			Position        int    `xml:"position"`
+			UnitCode        string `xml:"unit_code"`
+			Text            string `xml:"text"`
+			Quantity        string `xml:"quantity"`
+			TaxRate         string `xml:"tax_rate"`
+			NetPrice        string `xml:"net_price"`
+			GrossPrice      string `xml:"gross_price"`
+			LineTotal       string `xml:"line_total"`
+			DiscountPercent string `xml:"discount_percent"`
+			CostPrice       string `xml:"cost_price"`
+		} `xml:"invoice_positions>position"`
+	} `xml:"invoice"`
+}
+
+type tenantImportSettings struct {
+	Setting struct {
+		CompanyName           string `xml:"company_name"`
+		InvoiceContact        string `xml:"invoice_contact"`
+		InvoiceEMail          string `xml:"invoice_email"`
+		ZIP                   string `xml:"zip"`
+		Address1              string `xml:"address1"`
+		Address2              string `xml:"address2"`
+		City                  string `xml:"city"`
+		CountryCode           string `xml:"country_code"`
+		VATID                 string `xml:"vat_id"`
+		TAXNumber             string `xml:"tax_number"`
+		InvoiceNumberTemplate string `xml:"invoice_number_template"`
+		UseLocalCounter       bool   `xml:"use_local_counter"`
+		BankIBAN              string `xml:"bank_iban"`
+		BankName              string `xml:"bank_name"`
+		BankBIC               string `xml:"bank_bic"`
+		CustomerNumberPrefix  string `xml:"customer_number_prefix"`
+		CustomerNumberWidth   int    `xml:"customer_number_width"`
+		CustomerNumberCounter int64  `xml:"customer_number_counter"`
+
+		InvoicePhone               string `xml:"invoice_phone"`
+		PDFEngine                  string `xml:"pdf_engine"`
+		ReminderFee                string `xml:"reminder_fee"`
+		RoundingMode               string `xml:"rounding_mode"`
+		DefaultPaymentTermDays     int    `xml:"default_payment_term_days"`
+		Locale                     string `xml:"locale"`
+		PaymentReferenceTemplate   string `xml:"payment_reference_template"`
+		CustomerNumberMode         string `xml:"customer_number_mode"`
+		BaseCurrency               string `xml:"base_currency"`
+		PriceDecimals              int    `xml:"price_decimals"`
+		DeliveryNoteNumberTemplate string `xml:"delivery_note_number_template"`
+		DeliveryNoteCounter        int64  `xml:"delivery_note_counter"`
+		InvoiceFilenameTemplate    string `xml:"invoice_filename_template"`
+		DatevConsultantNumber      string `xml:"datev_consultant_number"`
+		DatevClientNumber          string `xml:"datev_client_number"`
+		DatevAccountLength         int    `xml:"datev_account_length"`
+		DatevDebtorAccount         string `xml:"datev_debtor_account"`
+		DatevAccounts              string `xml:"datev_accounts"`
+		TaxNoteAEDE                string `xml:"tax_note_ae_de"`
+		TaxNoteAEEN                string `xml:"tax_note_ae_en"`
+		TaxNoteKDE                 string `xml:"tax_note_k_de"`
+		TaxNoteKEN                 string `xml:"tax_note_k_en"`
+	} `xml:"setting"`
+}
+
+type tenantImportLetterheads struct {
+	Templates []struct {
+		ID           uint    `xml:"id,attr"`
+		Name         string  `xml:"name"`
+		PageWidthCm  float64 `xml:"page_width_cm"`
+		PageHeightCm float64 `xml:"page_height_cm"`
+		PDFPath      string  `xml:"pdf_path"`
+		FontNormal   string  `xml:"font_normal"`
+		FontBold     string  `xml:"font_bold"`
+		FontItalic   string  `xml:"font_italic"`
+		Regions      []struct {
+			Kind        string  `xml:"kind"`
+			Page        int     `xml:"page"`
+			XCm         float64 `xml:"x_cm"`
+			YCm         float64 `xml:"y_cm"`
+			WidthCm     float64 `xml:"width_cm"`
+			HeightCm    float64 `xml:"height_cm"`
+			HAlign      string  `xml:"h_align"`
+			VAlign      string  `xml:"v_align"`
+			FontName    string  `xml:"font_name"`
+			FontSizePt  float64 `xml:"font_size_pt"`
+			LineSpacing float64 `xml:"line_spacing"`
+			HasPage2    bool    `xml:"has_page2"`
+			X2Cm        float64 `xml:"x2_cm"`
+			Y2Cm        float64 `xml:"y2_cm"`
+			Width2Cm    float64 `xml:"width2_cm"`
+			Height2Cm   float64 `xml:"height2_cm"`
+		} `xml:"regions>region"`
+	} `xml:"template"`
+}
+
+// TenantImportCollision is an imported customer whose customer number is
+// already used by a company of the target owner (or by an earlier customer
+// of the same archive). The customer is imported without a customer number.
+type TenantImportCollision struct {
+	CustomerNumber string
+	ImportedName   string
+	ExistingName   string
+}
+
+// TenantImportInvoiceCollision is an imported invoice whose number is
+// already used by an invoice of the target owner (or by an earlier invoice
+// of the same archive). Invoice numbers must be unique, so the invoice is
+// not imported.
+type TenantImportInvoiceCollision struct {
+	Number       string
+	ImportedDate time.Time
+}
+
+// TenantImportReport summarizes an ImportTenantArchive run. In a dry run
+// the counts are what a real import would create.
+type TenantImportReport struct {
+	DryRun              bool
+	Companies           int
+	Persons             int
+	Invoices            int
+	LetterheadTemplates int
+	Notes               int
+	ContactInfos        int
+	Files               int
+	SettingsImported    bool
+	Collisions          []TenantImportCollision
+	InvoiceCollisions   []TenantImportInvoiceCollision
+	Warnings            []string
+}
+
+func (r *TenantImportReport) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// errTenantImportDryRun rolls back the transaction of a dry run.
+var errTenantImportDryRun = errors.New("dry run")
+
+// ImportTenantArchive recreates the data of a full export ZIP (settings
+// page) under ownerID: customers with their contact infos and notes,
+// persons, invoices with their positions, letterhead templates, the
+// settings and the files (user assets and invoice PDF/XML). All records get
+// new IDs, references between them (person → company, invoice → company,
+// invoice → letterhead template) are remapped. Invoice numbers, counters
+// and status are kept as they are.
+//
+// Existing data is never overwritten: a customer number that is already in
+// use is reported in Collisions and the customer is imported without one,
+// an issued invoice whose number is already in use is reported in
+// InvoiceCollisions and not imported, the settings are only imported if the owner has none yet, and existing
+// files are kept. User assets of a type the file manager does not accept
+// (see CheckUserAssetType) are skipped with a warning, and every file is
+// subject to the size limits of maxTenantImportFile and maxTenantImportTotal.
+// With dryRun nothing is written, the report tells what would be created.
+func (s *Store) ImportTenantArchive(ownerID uint, zr *zip.Reader, dryRun bool) (*TenantImportReport, error) {
+	if ownerID == 0 {
+		return nil, errors.New("ImportTenantArchive: ownerID required")
+	}
+	var (
+		customers   tenantImportCustomers
+		persons     tenantImportPersons
+		invoices    tenantImportInvoices
+		settings    tenantImportSettings
+		letterheads tenantImportLetterheads
+	)
+	files := map[string]any{
+		"customers.xml":            &customers,
+		"persons.xml":              &persons,
+		"invoices.xml":             &invoices,
+		"settings.xml":             &settings,
+		"letterhead_templates.xml": &letterheads,
+	}
+	found := map[string]bool{}
+	budget := int64(maxTenantImportTotal)
+	for _, f := range zr.File {
+		v, ok := files[f.Name]
+		if !ok {
+			continue
+		}
+		if err := readZipXML(f, v, &budget); err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		found[f.Name] = true
+	}
+	if !found["customers.xml"] && !found["invoices.xml"] {
+		return nil, errors.New("archive contains neither customers.xml nor invoices.xml")
+	}
+
+	report := &TenantImportReport{DryRun: dryRun}
+	invoiceIDs := map[uint]uint{} // archive invoice ID -> new ID
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		templateIDs := map[uint]uint{}
+		for _, t := range letterheads.Templates {
+			tpl := LetterheadTemplate{
+				OwnerID:      ownerID,
+				Name:         t.Name,
+				PageWidthCm:  t.PageWidthCm,
+				PageHeightCm: t.PageHeightCm,
+				PDFPath:      t.PDFPath, // relative to the owner's asset directory
+				FontNormal:   t.FontNormal,
+				FontBold:     t.FontBold,
+				FontItalic:   t.FontItalic,
+			}
+			for _, r := range t.Regions {
+				tpl.Regions = append(tpl.Regions, PlacedRegion{
+					OwnerID:     ownerID,
+					Kind:        FieldKind(r.Kind),
+					Page:        r.Page,
+					XCm:         r.XCm,
+					YCm:         r.YCm,
+					WidthCm:     r.WidthCm,
+					HeightCm:    r.HeightCm,
+					HAlign:      r.HAlign,
+					VAlign:      r.VAlign,
+					FontName:    r.FontName,
+					FontSizePt:  r.FontSizePt,
+					LineSpacing: r.LineSpacing,
+					HasPage2:    r.HasPage2,
+					X2Cm:        r.X2Cm,
+					Y2Cm:        r.Y2Cm,
+					Width2Cm:    r.Width2Cm,
+					Height2Cm:   r.Height2Cm,
+				})
+			}
+			if err := tx.Create(&tpl).Error; err != nil {
+				return fmt.Errorf("letterhead template %q: %w", t.Name, err)
+			}
+			templateIDs[t.ID] = tpl.ID
+			report.LetterheadTemplates++
+		}
+
+		// Customer numbers in use, to report collisions instead of
+		// creating a second company with the same number.
+		var existing []Company
+		if err := tx.Select("name", "customer_number").
+			Where("owner_id = ? AND customer_number <> ''", ownerID).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		numberOwner := make(map[string]string, len(existing))
+		for _, c := range existing {
+			numberOwner[c.CustomerNumber] = c.Name
+		}
+
+		companyIDs := map[uint]uint{}
+		for _, cu := range customers.Customers {
+			c := Company{
+				OwnerID:                ownerID,
+				Name:                   cu.Name,
+				CustomerNumber:         strings.TrimSpace(cu.CustomerNumber),
+				Address1:               cu.Address1,
+				Address2:               cu.Address2,
+				Zip:                    cu.Zip,
+				City:                   cu.City,
+				Country:                cu.Country,
+				InvoiceEmail:           cu.InvoiceEmail,
+				ContactInvoice:         cu.ContactInvoice,
+				SupplierNumber:         cu.SupplierNumber,
+				VATID:                  cu.VATID,
+				Background:             cu.Background,
+				InvoiceCurrency:        cu.InvoiceCurrency,
+				InvoiceTaxType:         cu.InvoiceTaxType,
+				InvoiceOpening:         cu.InvoiceOpening,
+				InvoiceFooter:          cu.InvoiceFooter,
+				InvoiceExemptionReason: cu.InvoiceExemptionReason,
+			}
+			var err error
+			if c.DefaultTaxRate, err = parseImportDecimal(cu.DefaultTaxRate); err != nil {
+				return fmt.Errorf("customer %q: default tax rate: %w", cu.Name, err)
+			}
+			if c.CustomerNumber != "" {
+				if name, taken := numberOwner[c.CustomerNumber]; taken {
+					report.Collisions = append(report.Collisions, TenantImportCollision{
+						CustomerNumber: c.CustomerNumber,
+						ImportedName:   cu.Name,
+						ExistingName:   name,
+					})
+					c.CustomerNumber = ""
+				} else {
+					numberOwner[c.CustomerNumber] = cu.Name
+				}
+			}
+			if err := tx.Omit("Invoices", "ContactInfos", "Notes").Create(&c).Error; err != nil {
+				return fmt.Errorf("customer %q: %w", cu.Name, err)
+			}
+			companyIDs[cu.ID] = c.ID
+			report.Companies++
+			if err := importContactInfosAndNotes(tx, report, ownerID, c.ID, ParentTypeCompany, cu.ContactInfos, cu.Notes); err != nil {
+				return fmt.Errorf("customer %q: %w", cu.Name, err)
+			}
+		}
+
+		for _, pe := range persons.Persons {
+			p := Person{
+				OwnerID:  ownerID,
+				Name:     pe.Name,
+				Position: pe.Position,
+				EMail:    pe.Email,
+			}
+			if pe.CompanyID != 0 {
+				if id, ok := companyIDs[pe.CompanyID]; ok {
+					p.CompanyID = int(id)
+				} else {
+					report.warnf("Person %q: Firma %d fehlt im Archiv, ohne Firma importiert", pe.Name, pe.CompanyID)
+				}
+			}
+			if err := tx.Omit("Company", "ContactInfos", "Notes").Create(&p).Error; err != nil {
+				return fmt.Errorf("person %q: %w", pe.Name, err)
+			}
+			report.Persons++
+			if err := importContactInfosAndNotes(tx, report, ownerID, p.ID, ParentTypePerson, pe.ContactInfos, pe.Notes); err != nil {
+				return fmt.Errorf("person %q: %w", pe.Name, err)
+			}
+		}
+
+		// Invoice numbers in use, including invoices in the trash. Drafts
+		// get a new number when they are issued and are not checked.
+		var numbers []string
+		if err := tx.Unscoped().Model(&Invoice{}).
+			Where("owner_id = ? AND status <> ?", ownerID, InvoiceStatusDraft).
+			Pluck("number", &numbers).Error; err != nil {
+			return err
+		}
+		numberTaken := make(map[string]bool, len(numbers))
+		for _, n := range numbers {
+			numberTaken[n] = true
+		}
+
+		for _, in := range invoices.Invoices {
+			companyID, ok := companyIDs[in.CompanyID]
+			if !ok {
+				report.warnf("Rechnung %s: Firma %d fehlt im Archiv, übersprungen", in.Number, in.CompanyID)
+				continue
+			}
+			inv := Invoice{
+				OwnerID:                 ownerID,
+				CompanyID:               companyID,
+				Number:                  in.Number,
+				Counter:                 in.Counter,
+				Status:                  InvoiceStatus(in.Status),
+				DocumentType:            DocumentType(in.DocumentType).orDefault(),
+				ReferencedInvoiceNumber: in.ReferencedNumber,
+				Currency:                in.Currency,
+				Date:                    in.Date,
+				DueDate:                 in.DueDate,
+				OccurrenceDate:          in.OccurrenceDate,
+				ContactInvoice:          in.ContactInvoice,
+				ExemptionReason:         in.ExemptionReason,
+				Footer:                  in.Footer,
+				Opening:                 in.Opening,
+				OrderNumber:             in.OrderNumber,
+				BuyerReference:          in.BuyerReference,
+				SupplierNumber:          in.SupplierNumber,
+				TaxNumber:               in.TaxNumber,
+				TaxType:                 in.TaxType,
+				IssuedAt:                in.IssuedAt,
+				PaidAt:                  in.PaidAt,
+				VoidedAt:                in.VoidedAt,
+				ZugferdProfile:          ZugferdProfile(in.ZugferdProfile).orDefault(),
+				SkontoDays:              in.SkontoDays,
+				PaymentReference:        in.PaymentReference,
+				PriceDecimals:           NormalizePriceDecimals(in.PriceDecimals),
+				RoundingMode:            RoundingModeTotal,
+			}
+			if RoundingMode(in.RoundingMode) == RoundingModeLine {
+				inv.RoundingMode = RoundingModeLine
+			}
+			switch inv.Status {
+			case InvoiceStatusDraft, InvoiceStatusIssued, InvoiceStatusPaid, InvoiceStatusVoided:
+			case "":
+				inv.Status = InvoiceStatusDraft
+			default:
+				return fmt.Errorf("invoice %s: unknown status %q", in.Number, in.Status)
+			}
+			inv.CounterAllocated = inv.Status != InvoiceStatusDraft
+			if inv.Status != InvoiceStatusDraft {
+				if numberTaken[in.Number] {
+					report.InvoiceCollisions = append(report.InvoiceCollisions, TenantImportInvoiceCollision{
+						Number:       in.Number,
+						ImportedDate: in.Date,
+					})
+					continue
+				}
+				numberTaken[in.Number] = true
+			}
+			if in.TemplateID != nil {
+				if id, ok := templateIDs[*in.TemplateID]; ok {
+					inv.TemplateID = &id
+				}
+			}
+			var err error
+			if inv.NetTotal, err = parseImportDecimal(in.NetTotal); err != nil {
+				return fmt.Errorf("invoice %s: net total: %w", in.Number, err)
+			}
+			if inv.GrossTotal, err = parseImportDecimal(in.GrossTotal); err != nil {
+				return fmt.Errorf("invoice %s: gross total: %w", in.Number, err)
+			}
+			// Archives written before the rate was exported have none.
+			if inv.ExchangeRate, err = parseImportDecimal(in.ExchangeRate); err != nil {
+				return fmt.Errorf("invoice %s: exchange rate: %w", in.Number, err)
+			}
+			if !inv.ExchangeRate.IsPositive() {
+				inv.ExchangeRate = decimal.NewFromInt(1)
+			}
+			if inv.SkontoPercent, err = parseImportDecimal(in.SkontoPercent); err != nil {
+				return fmt.Errorf("invoice %s: skonto percent: %w", in.Number, err)
+			}
+			for _, po := range in.Positions {
+				pos := InvoicePosition{
+					OwnerID:  ownerID,
+					Position: po.Position,
+					UnitCode: po.UnitCode,
+					Text:     po.Text,
+				}
+				for _, f := range []struct {
+					dst *decimal.Decimal
+					src string
+				}{
+					{&pos.Quantity, po.Quantity},
+					{&pos.TaxRate, po.TaxRate},
+					{&pos.NetPrice, po.NetPrice},
+					{&pos.GrossPrice, po.GrossPrice},
+					{&pos.LineTotal, po.LineTotal},
+					{&pos.DiscountPercent, po.DiscountPercent},
+					{&pos.CostPrice, po.CostPrice},
+				} {
+					if *f.dst, err = parseImportDecimal(f.src); err != nil {
+						return fmt.Errorf("invoice %s, position %d: %w", in.Number, po.Position, err)
+					}
+				}
+				inv.InvoicePositions = append(inv.InvoicePositions, pos)
+			}
+			// Created directly instead of with saveInvoice: the stored number
+			// and counter must not be allocated anew.
+			if err := tx.Omit("Company", "Template").Create(&inv).Error; err != nil {
+				return fmt.Errorf("invoice %s: %w", in.Number, err)
+			}
+			invoiceIDs[in.ID] = inv.ID
+			report.Invoices++
+		}
+
+		if found["settings.xml"] {
+			var count int64
+			if err := tx.Model(&Settings{}).Where("owner_id = ?", ownerID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				report.warnf("Einstellungen nicht übernommen, es gibt bereits welche")
+			} else {
+				st := settings.Setting
+				reminderFee, err := parseImportDecimal(st.ReminderFee)
+				if err != nil {
+					return fmt.Errorf("settings: reminder fee: %w", err)
+				}
+				if err := tx.Create(&Settings{
+					OwnerID:               ownerID,
+					CompanyName:           st.CompanyName,
+					InvoiceContact:        st.InvoiceContact,
+					InvoiceEMail:          st.InvoiceEMail,
+					ZIP:                   st.ZIP,
+					Address1:              st.Address1,
+					Address2:              st.Address2,
+					City:                  st.City,
+					CountryCode:           st.CountryCode,
+					VATID:                 st.VATID,
+					TAXNumber:             st.TAXNumber,
+					InvoiceNumberTemplate: st.InvoiceNumberTemplate,
+					UseLocalCounter:       st.UseLocalCounter,
+					BankIBAN:              st.BankIBAN,
+					BankName:              st.BankName,
+					BankBIC:               st.BankBIC,
+					CustomerNumberPrefix:  st.CustomerNumberPrefix,
+					CustomerNumberWidth:   st.CustomerNumberWidth,
+					CustomerNumberCounter: st.CustomerNumberCounter,
+
+					InvoicePhone:               st.InvoicePhone,
+					PDFEngine:                  st.PDFEngine,
+					ReminderFee:                reminderFee,
+					RoundingMode:               st.RoundingMode,
+					DefaultPaymentTermDays:     st.DefaultPaymentTermDays,
+					Locale:                     st.Locale,
+					PaymentReferenceTemplate:   st.PaymentReferenceTemplate,
+					CustomerNumberMode:         st.CustomerNumberMode,
+					BaseCurrency:               st.BaseCurrency,
+					PriceDecimals:              NormalizePriceDecimals(st.PriceDecimals),
+					DeliveryNoteNumberTemplate: st.DeliveryNoteNumberTemplate,
+					DeliveryNoteCounter:        st.DeliveryNoteCounter,
+					InvoiceFilenameTemplate:    st.InvoiceFilenameTemplate,
+					DatevConsultantNumber:      st.DatevConsultantNumber,
+					DatevClientNumber:          st.DatevClientNumber,
+					DatevAccountLength:         st.DatevAccountLength,
+					DatevDebtorAccount:         st.DatevDebtorAccount,
+					DatevAccounts:              st.DatevAccounts,
+					TaxNoteAEDE:                st.TaxNoteAEDE,
+					TaxNoteAEEN:                st.TaxNoteAEEN,
+					TaxNoteKDE:                 st.TaxNoteKDE,
+					TaxNoteKEN:                 st.TaxNoteKEN,
+				}).Error; err != nil {
+					return fmt.Errorf("settings: %w", err)
+				}
+				report.SettingsImported = true
+			}
+		}
+
+		if dryRun {
+			return errTenantImportDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTenantImportDryRun) {
+		return nil, fmt.Errorf("import tenant archive: %w", err)
+	}
+
+	// Files are copied after the commit, a failed copy leaves the records
+	// in place and is reported as a warning.
+	for _, f := range zr.File {
+		dst, ok := s.tenantImportFilePath(ownerID, f.Name, invoiceIDs)
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(dst); err == nil {
+			report.warnf("Datei %s existiert bereits, nicht überschrieben", f.Name)
+			continue
+		}
+		if strings.HasPrefix(f.Name, "assets/") {
+			if err := checkZipAssetType(f); err != nil {
+				report.warnf("Datei %s: %v", f.Name, err)
+				continue
+			}
+		}
+		if !dryRun {
+			if err := copyZipFile(f, dst, &budget); err != nil {
+				report.warnf("Datei %s: %v", f.Name, err)
+				continue
+			}
+		}
+		report.Files++
+	}
+	return report, nil
+}
+
+// importContactInfosAndNotes creates the contact infos and notes of an
+// imported company or person. The owner becomes the author of the notes.
+func importContactInfosAndNotes(tx *gorm.DB, report *TenantImportReport, ownerID, parentID uint, parentType ParentType, infos []tenantImportContactInfo, notes []tenantImportNote) error {
+	for _, ci := range infos {
+		if err := tx.Create(&ContactInfo{
+			OwnerID:    ownerID,
+			ParentID:   parentID,
+			ParentType: parentType,
+			Type:       ci.Type,
+			Label:      ci.Label,
+			Value:      ci.Value,
+		}).Error; err != nil {
+			return fmt.Errorf("contact info: %w", err)
+		}
+		report.ContactInfos++
+	}
+	for _, n := range notes {
+		if err := tx.Create(&Note{
+			OwnerID:    ownerID,
+			AuthorID:   ownerID,
+			ParentID:   parentID,
+			ParentType: parentType,
+			Title:      n.Title,
+			Body:       n.Body,
+			Tags:       n.Tags,
+			Pinned:     n.Pinned,
+		}).Error; err != nil {
+			return fmt.Errorf("note: %w", err)
+		}
+		report.Notes++
+	}
+	return nil
+}
+
+// tenantImportFilePath returns where the archive file name is stored for
+// ownerID: user assets (assets/userassets/ownerN/...) go to the owner's
+// asset directory, invoice files (invoices/pdf/ID.pdf, invoices/xml/ID.xml)
+// to the owner's XML directory under the new invoice ID. Other names, and
+// invoice files of invoices that were not imported, yield false.
+func (s *Store) tenantImportFilePath(ownerID uint, name string, invoiceIDs map[uint]uint) (string, bool) {
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) > 3 && parts[0] == "assets" && parts[1] == "userassets" && strings.HasPrefix(parts[2], "owner"):
+		p, err := SafeRelPath(filepath.Join(s.Config.Basedir, "assets", "userassets", fmt.Sprintf("owner%d", ownerID)), strings.Join(parts[3:], "/"))
+		if err != nil {
+			return "", false
+		}
+		return p, true
+	case len(parts) == 3 && parts[0] == "invoices" && (parts[1] == "pdf" || parts[1] == "xml"):
+		ext := "." + parts[1]
+		if path.Ext(parts[2]) != ext {
+			return "", false
+		}
+		oldID, err := strconv.ParseUint(strings.TrimSuffix(parts[2], ext), 10, 64)
+		if err != nil {
+			return "", false
+		}
+		newID, ok := invoiceIDs[uint(oldID)]
+		if !ok {
+			return "", false
+		}
+		return filepath.Join(s.Config.XMLDir, fmt.Sprintf("owner%d", ownerID), fmt.Sprintf("%d%s", newID, ext)), true
+	}
+	return "", false
+}
+
+// Limits of a tenant archive: the size of each file and of all files
+// together after decompression. They keep a small ZIP from filling the disk
+// or the memory with data that compresses well.
+const (
+	maxTenantImportFile  = 64 << 20
+	maxTenantImportTotal = 1 << 30
+)
+
+// ErrTenantImportTooLarge is returned for a file of a tenant archive that
+// exceeds the limits.
+var ErrTenantImportTooLarge = errors.New("file in archive too large")
+
+// zipFileReader reads one file of a tenant archive, see openZipFile.
+type zipFileReader struct {
+	io.LimitedReader
+	rc    io.Closer
+	name  string
+	limit int64
+}
+
+// openZipFile opens f for reading at most maxTenantImportFile bytes and what
+// is left of *budget, the bytes all files of the archive may still take up.
+// A file that declares a larger size is rejected before it is read.
+func openZipFile(f *zip.File, budget int64) (*zipFileReader, error) {
+	limit := min(int64(maxTenantImportFile), budget)
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%s: %w", f.Name, ErrTenantImportTooLarge)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	// One byte past the limit tells a file over the limit from one that
+	// fills it exactly.
+	return &zipFileReader{LimitedReader: io.LimitedReader{R: rc, N: limit + 1}, rc: rc, name: f.Name, limit: limit}, nil
+}
+
+// close closes the file and takes the bytes read from *budget. It fails if
+// more than the limit was read.
+func (z *zipFileReader) close(budget *int64) error {
+	z.rc.Close()
+	*budget -= z.limit + 1 - z.N
+	if z.N == 0 {
+		return fmt.Errorf("%s: %w", z.name, ErrTenantImportTooLarge)
+	}
+	return nil
+}
+
+// readZipXML decodes the XML file f into v, counting it against *budget.
+func readZipXML(f *zip.File, v any, budget *int64) error {
+	z, err := openZipFile(f, *budget)
+	if err != nil {
+		return err
+	}
+	decErr := xml.NewDecoder(z).Decode(v)
+	if err := z.close(budget); err != nil {
+		return err
+	}
+	return decErr
+}
+
+// checkZipAssetType checks a user asset of the archive like an upload to the
+// file manager, see CheckUserAssetType.
+func checkZipAssetType(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return CheckUserAssetType(path.Base(f.Name), head[:n])
+}
+
+// copyZipFile writes the contents of f to dst, creating the directories and
+// counting f against *budget. A file over the limit is removed again.
+func copyZipFile(f *zip.File, dst string, budget *int64) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	z, err := openZipFile(f, *budget)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		z.close(budget)
+		return err
+	}
+	_, copyErr := io.Copy(out, z)
+	closeErr := out.Close()
+	if err := cmp.Or(z.close(budget), copyErr, closeErr); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// parseImportDecimal parses a decimal of the export, empty means zero.
+func parseImportDecimal(s string) (decimal.Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return decimal.Zero, nil
+	}
+	return decimal.NewFromString(s)
+}
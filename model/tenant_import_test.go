@@ -0,0 +1,280 @@
+package model_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+// tenantArchive returns a ZIP in the layout of the full export with the
+// given files.
+func tenantArchive(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestImportTenantArchive(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+	store.Config.XMLDir = t.TempDir()
+	store.Config.Basedir = t.TempDir()
+	owner := fixtures.DefaultOwnerID
+
+	existing := fixtures.Company(fixtures.WithCompanyName("Alt GmbH"), fixtures.WithCompanyCustomerNumber("K-100"))
+	if err := store.SaveCompany(existing, owner, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+	before, err := store.LoadAllCompanies(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := fixtures.Invoice(fixtures.WithInvoiceCompanyID(existing.ID), fixtures.WithInvoicePositions(fixtures.SamplePositions()...))
+	if err := store.SaveInvoice(issued, owner); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	if err := store.MarkInvoiceIssued(issued.ID, owner, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+	issued, err = store.LoadInvoice(issued.ID, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"customers.xml": `<customers>
+  <customer id="7"><name>Neu AG</name><customer_number>K-200</customer_number><default_tax_rate>19</default_tax_rate>
+    <contact_infos><contact_info><type>phone</type><label>Zentrale</label><value>040 123</value></contact_info></contact_infos>
+    <notes><note><title>Notiz</title><body>Text</body></note></notes>
+  </customer>
+  <customer id="8"><name>Kollision KG</name><customer_number>K-100</customer_number></customer>
+</customers>`,
+		"persons.xml": `<persons><person id="3"><name>Anna Muster</name><company_id>7</company_id></person></persons>`,
+		"invoices.xml": `<invoices>
+  <invoice id="42"><number>R-2024-0042</number><status>paid</status><document_type>invoice</document_type>
+    <currency>USD</currency><exchange_rate>0.92</exchange_rate><net_total>100</net_total><gross_total>119</gross_total>
+    <date>2024-03-01T00:00:00Z</date><due_date>2024-03-15T00:00:00Z</due_date><company_id>7</company_id><counter>42</counter>
+    <zugferd_profile>extended</zugferd_profile><skonto_percent>2</skonto_percent><skonto_days>10</skonto_days>
+    <payment_reference>RF42</payment_reference><price_decimals>4</price_decimals><rounding_mode>line</rounding_mode>
+    <invoice_positions><position><position>1</position><unit_code>C62</unit_code><text>Beratung</text>
+      <quantity>1</quantity><tax_rate>19</tax_rate><net_price>100</net_price><gross_price>119</gross_price><line_total>100</line_total>
+      <discount_percent>10</discount_percent><cost_price>55.5</cost_price></position></invoice_positions>
+  </invoice>
+  <invoice id="43"><number>` + issued.Number + `</number><status>issued</status><currency>EUR</currency>
+    <date>2024-04-01T00:00:00Z</date><company_id>7</company_id></invoice>
+</invoices>`,
+		"settings.xml":                        `<settings><setting><company_name>Alte Firma</company_name></setting></settings>`,
+		"invoices/pdf/42.pdf":                 "%PDF-1.7",
+		"invoices/pdf/99.pdf":                 "%PDF-1.7", // unknown invoice
+		"assets/userassets/owner5/logo.png":   "\x89PNG\r\n\x1a\n",
+		"assets/userassets/owner5/tool.pdf":   "MZ\x90\x00", // renamed executable
+		"assets/userassets/owner5/run.sh":     "#!/bin/sh",
+		"assets/userassets/owner5/../../evil": "x",
+	}
+
+	// Dry run: report only, nothing written.
+	report, err := store.ImportTenantArchive(owner, tenantArchive(t, files), true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if report.Companies != 2 || report.Persons != 1 || report.Invoices != 1 || report.Files != 2 {
+		t.Errorf("dry run report = %+v", report)
+	}
+	after, err := store.LoadAllCompanies(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("dry run created companies: %d, want %d", len(after), len(before))
+	}
+	if _, err := os.Stat(filepath.Join(store.Config.Basedir, "assets", "userassets", "owner1", "logo.png")); err == nil {
+		t.Error("dry run copied a file")
+	}
+
+	report, err = store.ImportTenantArchive(owner, tenantArchive(t, files), false)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if report.Companies != 2 || report.Persons != 1 || report.Invoices != 1 || report.Notes != 1 || report.ContactInfos != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.SettingsImported {
+		t.Error("settings overwritten, want existing settings kept")
+	}
+	if len(report.Collisions) != 1 || report.Collisions[0].CustomerNumber != "K-100" || report.Collisions[0].ExistingName != "Alt GmbH" {
+		t.Errorf("collisions = %+v", report.Collisions)
+	}
+	if len(report.InvoiceCollisions) != 1 || report.InvoiceCollisions[0].Number != issued.Number {
+		t.Errorf("invoice collisions = %+v, want %s", report.InvoiceCollisions, issued.Number)
+	}
+
+	companies, err := store.LoadAllCompanies(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*model.Company{}
+	for _, c := range companies {
+		byName[c.Name] = c
+	}
+	neu, kollision := byName["Neu AG"], byName["Kollision KG"]
+	if neu == nil || kollision == nil {
+		t.Fatalf("imported companies missing: %v", byName)
+	}
+	if neu.CustomerNumber != "K-200" || kollision.CustomerNumber != "" {
+		t.Errorf("customer numbers = %q/%q, want K-200 and empty", neu.CustomerNumber, kollision.CustomerNumber)
+	}
+	if byName["Alt GmbH"].CustomerNumber != "K-100" {
+		t.Error("existing company changed")
+	}
+
+	invoices, err := store.ListInvoicesForExport(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imported *model.Invoice
+	sameNumber := 0
+	for i := range invoices {
+		switch invoices[i].Number {
+		case "R-2024-0042":
+			imported = &invoices[i]
+		case issued.Number:
+			if invoices[i].Status != model.InvoiceStatusDraft {
+				sameNumber++
+			}
+		}
+	}
+	if sameNumber != 1 {
+		t.Errorf("%d issued invoices numbered %s, want 1", sameNumber, issued.Number)
+	}
+	if imported == nil {
+		t.Fatal("imported invoice missing")
+	}
+	if imported.CompanyID != neu.ID || imported.Status != model.InvoiceStatusPaid || imported.Counter != 42 {
+		t.Errorf("invoice company/status/counter = %d/%s/%d, want %d/paid/42", imported.CompanyID, imported.Status, imported.Counter, neu.ID)
+	}
+	if imported.ExchangeRate.String() != "0.92" {
+		t.Errorf("ExchangeRate = %s, want 0.92", imported.ExchangeRate)
+	}
+	if imported.ZugferdProfile != model.ZugferdProfileExtended || imported.SkontoPercent.String() != "2" || imported.SkontoDays != 10 ||
+		imported.PaymentReference != "RF42" || imported.PriceDecimals != 4 || imported.RoundingMode != model.RoundingModeLine {
+		t.Errorf("invoice profile/skonto/reference/decimals/rounding = %s/%s/%d/%s/%d/%s",
+			imported.ZugferdProfile, imported.SkontoPercent, imported.SkontoDays, imported.PaymentReference, imported.PriceDecimals, imported.RoundingMode)
+	}
+	if len(imported.InvoicePositions) != 1 || imported.InvoicePositions[0].NetPrice.String() != "100" {
+		t.Fatalf("positions = %+v", imported.InvoicePositions)
+	}
+	if pos := imported.InvoicePositions[0]; pos.DiscountPercent.String() != "10" || pos.CostPrice.String() != "55.5" {
+		t.Errorf("position discount/cost = %s/%s, want 10/55.5", pos.DiscountPercent, pos.CostPrice)
+	}
+
+	pdf := filepath.Join(store.Config.XMLDir, "owner1", fmt.Sprintf("%d.pdf", imported.ID))
+	if _, err := os.Stat(pdf); err != nil {
+		t.Errorf("invoice PDF not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Config.Basedir, "assets", "userassets", "owner1", "logo.png")); err != nil {
+		t.Errorf("asset not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Config.Basedir, "assets", "evil")); err == nil {
+		t.Error("file outside the asset directory written")
+	}
+	for _, name := range []string{"tool.pdf", "run.sh"} {
+		if _, err := os.Stat(filepath.Join(store.Config.Basedir, "assets", "userassets", "owner1", name)); err == nil {
+			t.Errorf("asset %s of a type not allowed copied", name)
+		}
+	}
+}
+
+func TestImportTenantArchive_TooLarge(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+
+	// The header claims a file far beyond the limit; it is rejected before
+	// anything is decompressed.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "invoices.xml",
+		Method:             zip.Store,
+		CompressedSize64:   10,
+		UncompressedSize64: 1 << 40,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("<invoices>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ImportTenantArchive(fixtures.DefaultOwnerID, zr, true); !errors.Is(err, model.ErrTenantImportTooLarge) {
+		t.Errorf("ImportTenantArchive error = %v, want ErrTenantImportTooLarge", err)
+	}
+}
+
+func TestImportTenantArchive_Settings(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	const owner = 7 // no settings yet
+
+	files := map[string]string{
+		"customers.xml": `<customers></customers>`,
+		"settings.xml": `<settings><setting><company_name>Neue Firma</company_name>
+  <invoice_phone>040 123</invoice_phone><reminder_fee>5.50</reminder_fee><rounding_mode>line</rounding_mode>
+  <default_payment_term_days>30</default_payment_term_days><locale>en-US</locale>
+  <payment_reference_template>{NUMBER}</payment_reference_template><customer_number_mode>freeform</customer_number_mode>
+  <base_currency>CHF</base_currency><price_decimals>3</price_decimals>
+  <delivery_note_number_template>LS-{NNNN}</delivery_note_number_template><delivery_note_counter>12</delivery_note_counter>
+  <invoice_filename_template>Rechnung-{NUMBER}</invoice_filename_template>
+  <datev_consultant_number>1001</datev_consultant_number><datev_account_length>5</datev_account_length>
+  <tax_note_ae_de>Steuerschuldnerschaft</tax_note_ae_de>
+</setting></settings>`,
+	}
+	report, err := store.ImportTenantArchive(owner, tenantArchive(t, files), false)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if !report.SettingsImported {
+		t.Fatal("settings not imported")
+	}
+	st, err := store.LoadSettings(uint(owner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.CompanyName != "Neue Firma" || st.InvoicePhone != "040 123" || st.ReminderFee.String() != "5.5" ||
+		st.RoundingMode != "line" || st.DefaultPaymentTermDays != 30 || st.Locale != "en-US" ||
+		st.PaymentReferenceTemplate != "{NUMBER}" || st.CustomerNumberMode != model.CustomerNumberFreeform ||
+		st.BaseCurrency != "CHF" || st.PriceDecimals != 3 || st.DeliveryNoteNumberTemplate != "LS-{NNNN}" ||
+		st.DeliveryNoteCounter != 12 || st.InvoiceFilenameTemplate != "Rechnung-{NUMBER}" ||
+		st.DatevConsultantNumber != "1001" || st.DatevAccountLength != 5 || st.TaxNoteAEDE != "Steuerschuldnerschaft" {
+		t.Errorf("settings = %+v", st)
+	}
+}
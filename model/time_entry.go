@@ -0,0 +1,284 @@
+package model
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// TimeEntry is a block of billable hours worked for a customer. Unbilled
+// entries can be turned into invoice positions with
+// BuildInvoiceFromTimeEntries, which marks them as billed. Billed entries
+// cannot be changed or deleted any more. Deleting the invoice makes them
+// unbilled again (see unbillTimeEntries).
+type TimeEntry struct {
+	ID          uint            `gorm:"primaryKey"`
+	CreatedAt   time.Time       `gorm:"not null"`
+	UpdatedAt   time.Time       `gorm:"not null"`
+	OwnerID     uint            `gorm:"not null;index"`
+	CompanyID   uint            `gorm:"not null;index"`
+	Date        time.Time       `gorm:"not null"`
+	Hours       decimal.Decimal `gorm:"type:text;not null;default:'0'"`
+	Description string          `gorm:"not null;default:''"`
+	HourlyRate  decimal.Decimal `gorm:"type:text;not null;default:'0'"` // net price per hour
+	Billed      bool            `gorm:"not null;default:false"`
+	InvoiceID   *uint           // invoice the entry was (last) billed with
+}
+
+func (TimeEntry) TableName() string { return "time_entries" }
+
+// Amount returns hours times hourly rate.
+func (t *TimeEntry) Amount() decimal.Decimal {
+	return t.Hours.Mul(t.HourlyRate)
+}
+
+// ErrTimeEntryBilled is returned when a billed time entry is changed,
+// deleted or billed again.
+var ErrTimeEntryBilled = errors.New("time entry already billed")
+
+// ListTimeEntries returns the owner's time entries, newest first. A
+// companyID of 0 lists the entries of all companies.
+func (s *Store) ListTimeEntries(ownerID, companyID uint, unbilledOnly bool) ([]TimeEntry, error) {
+	q := s.db.Where("owner_id = ?", ownerID)
+	if companyID != 0 {
+		q = q.Where("company_id = ?", companyID)
+	}
+	if unbilledOnly {
+		q = q.Where("billed = ?", false)
+	}
+	var entries []TimeEntry
+	err := q.Order("date DESC, id DESC").Find(&entries).Error
+	return entries, err
+}
+
+// LoadTimeEntry loads one time entry of the owner.
+func (s *Store) LoadTimeEntry(id, ownerID uint) (*TimeEntry, error) {
+	var t TimeEntry
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveTimeEntry creates (ID 0) or updates an unbilled time entry. The
+// company must belong to the owner, hours must be positive and the hourly
+// rate must not be negative. Billed and InvoiceID are never taken from t.
+func (s *Store) SaveTimeEntry(t *TimeEntry) error {
+	if t.OwnerID == 0 {
+		return errors.New("SaveTimeEntry: OwnerID required")
+	}
+	t.Description = strings.TrimSpace(t.Description)
+	if t.Date.IsZero() {
+		return errors.New("date required")
+	}
+	if !t.Hours.IsPositive() {
+		return errors.New("hours must be positive")
+	}
+	if t.HourlyRate.IsNegative() {
+		return errors.New("hourly rate must not be negative")
+	}
+	var companies int64
+	if err := s.db.Model(&Company{}).Where("id = ? AND owner_id = ?", t.CompanyID, t.OwnerID).Count(&companies).Error; err != nil {
+		return err
+	}
+	if companies == 0 {
+		return fmt.Errorf("company %d: %w", t.CompanyID, gorm.ErrRecordNotFound)
+	}
+
+	if t.ID == 0 {
+		t.Billed = false
+		t.InvoiceID = nil
+		return s.db.Create(t).Error
+	}
+	// The billed condition keeps an entry that is billed concurrently from
+	// being changed afterwards.
+	res := s.db.Model(&TimeEntry{}).
+		Where("id = ? AND owner_id = ? AND billed = ?", t.ID, t.OwnerID, false).
+		Updates(map[string]any{
+			"company_id":  t.CompanyID,
+			"date":        t.Date,
+			"hours":       t.Hours,
+			"description": t.Description,
+			"hourly_rate": t.HourlyRate,
+			"updated_at":  time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return s.timeEntryUnchangeable(t.ID, t.OwnerID)
+	}
+	return nil
+}
+
+// DeleteTimeEntry removes an unbilled time entry of the owner.
+func (s *Store) DeleteTimeEntry(id, ownerID uint) error {
+	res := s.db.Where("id = ? AND owner_id = ? AND billed = ?", id, ownerID, false).Delete(&TimeEntry{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return s.timeEntryUnchangeable(id, ownerID)
+	}
+	return nil
+}
+
+// timeEntryUnchangeable explains why a conditional update or delete of an
+// unbilled entry did not match: the entry is billed or does not exist.
+func (s *Store) timeEntryUnchangeable(id, ownerID uint) error {
+	if _, err := s.LoadTimeEntry(id, ownerID); err != nil {
+		return err
+	}
+	return ErrTimeEntryBilled
+}
+
+// BuildInvoiceFromTimeEntries creates a draft invoice for the company from
+// the given unbilled time entries and marks them as billed. Entries with the
+// same description and hourly rate are summed up into one position with the
+// unit "HUR". All entries must belong to the owner and the company and must
+// not be billed yet, otherwise nothing is changed and the error wraps
+// ErrTimeEntryBilled.
+//
+// The entries are marked as billed with a conditional update before the
+// invoice is written, all in one transaction. Of two concurrent calls for
+// the same entry only one can match the unbilled row, the other one fails,
+// so no entry is billed twice.
+func (s *Store) BuildInvoiceFromTimeEntries(ownerID, companyID uint, entryIDs []uint) (*Invoice, error) {
+	ids := slices.Clone(entryIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) == 0 {
+		return nil, errors.New("no time entries selected")
+	}
+
+	var inv *Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&TimeEntry{}).
+			Where("id IN ? AND owner_id = ? AND company_id = ? AND billed = ?", ids, ownerID, companyID, false).
+			Updates(map[string]any{"billed": true, "updated_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != int64(len(ids)) {
+			return fmt.Errorf("%d of %d time entries are billed or unknown: %w", int64(len(ids))-res.RowsAffected, len(ids), ErrTimeEntryBilled)
+		}
+
+		var entries []TimeEntry
+		if err := tx.Where("id IN ? AND owner_id = ?", ids, ownerID).Order("date ASC, id ASC").Find(&entries).Error; err != nil {
+			return err
+		}
+		var company Company
+		if err := tx.Where("id = ? AND owner_id = ?", companyID, ownerID).First(&company).Error; err != nil {
+			return err
+		}
+		var settings Settings
+		if err := tx.Where("owner_id = ?", ownerID).Limit(1).Find(&settings).Error; err != nil {
+			return err
+		}
+
+		inv = invoiceFromTimeEntries(entries, &company, &settings)
+		inv.OwnerID = ownerID
+		inv.RoundingMode = s.loadRoundingMode(tx, ownerID)
+		inv.PriceDecimals = s.loadPriceDecimals(tx, ownerID)
+		var templates []LetterheadTemplate
+		if err := tx.Where("owner_id = ?", ownerID).Order("updated_at DESC").Limit(1).Find(&templates).Error; err != nil {
+			return err
+		}
+		if len(templates) > 0 {
+			inv.TemplateID = &templates[0].ID // like a new invoice in the editor
+		}
+		for i := range inv.InvoicePositions {
+			p := &inv.InvoicePositions[i]
+			p.NetPrice = p.NetPrice.Round(int32(inv.PriceDecimals))
+			p.GrossPrice = p.NetPrice.Copy()
+			p.LineTotal = p.Quantity.Mul(p.NetPrice).Round(2)
+		}
+		inv.RecomputeTotals()
+
+		if err := s.saveInvoice(tx, inv, ownerID); err != nil {
+			return err
+		}
+		return tx.Model(&TimeEntry{}).
+			Where("id IN ? AND owner_id = ?", ids, ownerID).
+			Update("invoice_id", inv.ID).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build invoice from time entries: %w", err)
+	}
+	return inv, nil
+}
+
+// invoiceFromTimeEntries returns an unsaved draft invoice with one position
+// per description and hourly rate of entries (sorted by date). The
+// occurrence date is the date of the last entry.
+func invoiceFromTimeEntries(entries []TimeEntry, company *Company, settings *Settings) *Invoice {
+	now := time.Now()
+	inv := &Invoice{
+		CompanyID:       company.ID,
+		Status:          InvoiceStatusDraft,
+		Date:            now,
+		OccurrenceDate:  now,
+		DueDate:         ComputeDueDate(now, company, settings),
+		Currency:        cmp.Or(company.InvoiceCurrency, "EUR"),
+		ExchangeRate:    decimal.NewFromInt(1),
+		ContactInvoice:  company.ContactInvoice,
+		SupplierNumber:  company.SupplierNumber,
+		Opening:         company.InvoiceOpening,
+		Footer:          company.InvoiceFooter,
+		ExemptionReason: company.InvoiceExemptionReason,
+		TaxType:         company.InvoiceTaxType,
+		// saveInvoice replaces the suggested number with the one for the
+		// allocated counter.
+		Number: FormatInvoiceNumber(settings.InvoiceNumberTemplate, company.CustomerNumber, 0, now),
+	}
+	if len(entries) > 0 {
+		inv.OccurrenceDate = entries[len(entries)-1].Date
+	}
+
+	type groupKey struct{ text, rate string }
+	index := map[groupKey]int{}
+	for _, e := range entries {
+		text := cmp.Or(e.Description, "Arbeitszeit")
+		key := groupKey{text, e.HourlyRate.String()}
+		if i, ok := index[key]; ok {
+			p := &inv.InvoicePositions[i]
+			p.Quantity = p.Quantity.Add(e.Hours)
+			continue
+		}
+		index[key] = len(inv.InvoicePositions)
+		inv.InvoicePositions = append(inv.InvoicePositions, InvoicePosition{
+			Position: len(inv.InvoicePositions) + 1,
+			UnitCode: "HUR",
+			Text:     text,
+			Quantity: e.Hours,
+			NetPrice: e.HourlyRate,
+			TaxRate:  company.DefaultTaxRate,
+		})
+	}
+	return inv
+}
+
+// unbillTimeEntries marks the time entries billed with the given invoices
+// as unbilled, within tx, when the invoices are moved to the trash.
+// InvoiceID is kept, so that restoring an invoice bills the entries again
+// (rebillTimeEntries) unless they were billed with another invoice in the
+// meantime.
+func unbillTimeEntries(tx *gorm.DB, ownerID uint, invoiceIDs []uint) error {
+	return tx.Model(&TimeEntry{}).
+		Where("owner_id = ? AND invoice_id IN ? AND billed = ?", ownerID, invoiceIDs, true).
+		Updates(map[string]any{"billed": false, "updated_at": time.Now()}).Error
+}
+
+// rebillTimeEntries marks the unbilled time entries that still refer to the
+// restored invoice as billed again, within tx.
+func rebillTimeEntries(tx *gorm.DB, ownerID, invoiceID uint) error {
+	return tx.Model(&TimeEntry{}).
+		Where("owner_id = ? AND invoice_id = ? AND billed = ?", ownerID, invoiceID, false).
+		Updates(map[string]any{"billed": true, "updated_at": time.Now()}).Error
+}
@@ -0,0 +1,200 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/shopspring/decimal"
+)
+
+func saveTimeEntry(t *testing.T, store *model.Store, companyID uint, day int, hours, rate, text string) *model.TimeEntry {
+	t.Helper()
+	e := &model.TimeEntry{
+		OwnerID:     fixtures.DefaultOwnerID,
+		CompanyID:   companyID,
+		Date:        time.Date(2025, 5, day, 0, 0, 0, 0, time.UTC),
+		Hours:       decimal.RequireFromString(hours),
+		HourlyRate:  decimal.RequireFromString(rate),
+		Description: text,
+	}
+	if err := store.SaveTimeEntry(e); err != nil {
+		t.Fatalf("SaveTimeEntry failed: %v", err)
+	}
+	return e
+}
+
+func TestBuildInvoiceFromTimeEntries(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	companyID := data.Company.ID
+
+	a := saveTimeEntry(t, store, companyID, 2, "2.5", "90", "Beratung")
+	b := saveTimeEntry(t, store, companyID, 3, "1.5", "90", "Beratung")
+	c := saveTimeEntry(t, store, companyID, 5, "3", "75", "Entwicklung")
+	left := saveTimeEntry(t, store, companyID, 6, "1", "75", "Entwicklung")
+
+	inv, err := store.BuildInvoiceFromTimeEntries(fixtures.DefaultOwnerID, companyID, []uint{c.ID, a.ID, b.ID})
+	if err != nil {
+		t.Fatalf("BuildInvoiceFromTimeEntries failed: %v", err)
+	}
+	if inv.Status != model.InvoiceStatusDraft || inv.CompanyID != companyID {
+		t.Errorf("invoice status %q company %d, want draft for company %d", inv.Status, inv.CompanyID, companyID)
+	}
+	if !inv.OccurrenceDate.Equal(c.Date) {
+		t.Errorf("OccurrenceDate = %s, want %s", inv.OccurrenceDate, c.Date)
+	}
+
+	stored, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+	want := []struct{ text, qty, price string }{
+		{"Beratung", "4", "90"},
+		{"Entwicklung", "3", "75"},
+	}
+	if len(stored.InvoicePositions) != len(want) {
+		t.Fatalf("got %d positions, want %d", len(stored.InvoicePositions), len(want))
+	}
+	for i, w := range want {
+		p := stored.InvoicePositions[i]
+		if p.Text != w.text || p.UnitCode != "HUR" ||
+			!p.Quantity.Equal(decimal.RequireFromString(w.qty)) ||
+			!p.NetPrice.Equal(decimal.RequireFromString(w.price)) {
+			t.Errorf("position %d = %s %s %s x %s, want %s HUR %s x %s",
+				i+1, p.Text, p.UnitCode, p.Quantity, p.NetPrice, w.text, w.qty, w.price)
+		}
+	}
+	if !stored.NetTotal.Equal(decimal.NewFromInt(585)) {
+		t.Errorf("NetTotal = %s, want 585", stored.NetTotal)
+	}
+
+	entries, err := store.ListTimeEntries(fixtures.DefaultOwnerID, companyID, true)
+	if err != nil {
+		t.Fatalf("ListTimeEntries failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != left.ID {
+		t.Errorf("unbilled entries = %+v, want only %d", entries, left.ID)
+	}
+	billed, _ := store.LoadTimeEntry(a.ID, fixtures.DefaultOwnerID)
+	if !billed.Billed || billed.InvoiceID == nil || *billed.InvoiceID != inv.ID {
+		t.Errorf("entry %d: billed=%v invoice=%v, want billed with invoice %d", a.ID, billed.Billed, billed.InvoiceID, inv.ID)
+	}
+
+	// Billed entries are frozen and cannot be billed again; a failed call
+	// leaves the other entries alone.
+	billed.Hours = decimal.NewFromInt(10)
+	if err := store.SaveTimeEntry(billed); !errors.Is(err, model.ErrTimeEntryBilled) {
+		t.Errorf("SaveTimeEntry on billed entry: err = %v, want ErrTimeEntryBilled", err)
+	}
+	if err := store.DeleteTimeEntry(a.ID, fixtures.DefaultOwnerID); !errors.Is(err, model.ErrTimeEntryBilled) {
+		t.Errorf("DeleteTimeEntry on billed entry: err = %v, want ErrTimeEntryBilled", err)
+	}
+	if _, err := store.BuildInvoiceFromTimeEntries(fixtures.DefaultOwnerID, companyID, []uint{a.ID, left.ID}); !errors.Is(err, model.ErrTimeEntryBilled) {
+		t.Errorf("billing again: err = %v, want ErrTimeEntryBilled", err)
+	}
+	if reloaded, _ := store.LoadTimeEntry(left.ID, fixtures.DefaultOwnerID); reloaded.Billed {
+		t.Error("failed billing marked the remaining entry as billed")
+	}
+}
+
+func TestDeleteInvoice_UnbillsTimeEntries(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner, companyID := fixtures.DefaultOwnerID, data.Company.ID
+
+	billed := func(e *model.TimeEntry) (bool, *uint) {
+		t.Helper()
+		r, err := store.LoadTimeEntry(e.ID, owner)
+		if err != nil {
+			t.Fatalf("LoadTimeEntry failed: %v", err)
+		}
+		return r.Billed, r.InvoiceID
+	}
+
+	a := saveTimeEntry(t, store, companyID, 2, "2", "90", "Beratung")
+	inv, err := store.BuildInvoiceFromTimeEntries(owner, companyID, []uint{a.ID})
+	if err != nil {
+		t.Fatalf("BuildInvoiceFromTimeEntries failed: %v", err)
+	}
+	if err := store.DeleteInvoice(inv, owner); err != nil {
+		t.Fatalf("DeleteInvoice failed: %v", err)
+	}
+	if ok, _ := billed(a); ok {
+		t.Error("entry of the deleted draft still billed")
+	}
+	if err := store.RestoreInvoice(inv.ID, owner); err != nil {
+		t.Fatalf("RestoreInvoice failed: %v", err)
+	}
+	if ok, id := billed(a); !ok || id == nil || *id != inv.ID {
+		t.Errorf("after restore: billed=%v invoice=%v, want billed with %d", ok, id, inv.ID)
+	}
+
+	// Billed with another invoice while the first one was in the trash: the
+	// entry stays with the new invoice.
+	if err := store.DeleteInvoice(inv, owner); err != nil {
+		t.Fatalf("DeleteInvoice failed: %v", err)
+	}
+	other, err := store.BuildInvoiceFromTimeEntries(owner, companyID, []uint{a.ID})
+	if err != nil {
+		t.Fatalf("billing the unbilled entry again failed: %v", err)
+	}
+	if err := store.RestoreInvoice(inv.ID, owner); err != nil {
+		t.Fatalf("RestoreInvoice failed: %v", err)
+	}
+	if ok, id := billed(a); !ok || id == nil || *id != other.ID {
+		t.Errorf("after restore of the old draft: billed=%v invoice=%v, want billed with %d", ok, id, other.ID)
+	}
+
+	// Deleting all drafts of the company unbills as well.
+	if _, err := store.DeleteDraftInvoicesForCompany(owner, companyID); err != nil {
+		t.Fatalf("DeleteDraftInvoicesForCompany failed: %v", err)
+	}
+	if ok, _ := billed(a); ok {
+		t.Error("entry still billed after DeleteDraftInvoicesForCompany")
+	}
+
+	// Purging the trash drops the reference.
+	if err := model.PurgeInvoiceTrash(context.Background(), store, -time.Hour); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if ok, id := billed(a); ok || id != nil {
+		t.Errorf("after purge: billed=%v invoice=%v, want unbilled without invoice", ok, id)
+	}
+}
+
+func TestBuildInvoiceFromTimeEntries_Concurrent(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	e := saveTimeEntry(t, store, data.Company.ID, 2, "8", "100", "Workshop")
+
+	const n = 4
+	invoices := make([]*model.Invoice, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			invoices[i], errs[i] = store.BuildInvoiceFromTimeEntries(fixtures.DefaultOwnerID, data.Company.ID, []uint{e.ID})
+		}(i)
+	}
+	wg.Wait()
+
+	built := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			built++
+		case !errors.Is(err, model.ErrTimeEntryBilled):
+			t.Errorf("call %d: unexpected error %v", i, err)
+		}
+	}
+	if built != 1 {
+		t.Fatalf("%d invoices built from one entry, want 1", built)
+	}
+}
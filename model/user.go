@@ -30,6 +30,7 @@ var (
 	ErrTokenNotFound       = fmt.Errorf("token not found")
 	ErrTokenDisabled       = fmt.Errorf("token disabled")
 	ErrUnauthorized        = fmt.Errorf("unauthorized")
+	ErrEmailTaken          = fmt.Errorf("email already in use")
 )
 
 // ===== User =====
@@ -45,6 +46,16 @@ type User struct {
 	Verified            bool `gorm:"not null;default:false"`
 	LastLoginAt         *time.Time
 	OwnerID             uint
+	// SessionVersion is stored in the session cookie at login. Incrementing
+	// it (BumpSessionVersion) ends all sessions that carry an older value.
+	SessionVersion uint `gorm:"not null;default:0"`
+	// PendingEmail is the new address of a requested email change; it
+	// replaces Email when the link sent there is opened (ConfirmEmailChange).
+	PendingEmail      string `gorm:"not null;default:''"`
+	EmailChangeToken  []byte // sha256 of the token in the link
+	EmailChangeExpiry *time.Time
+	// Role of the user: RoleAdmin, RoleOwner or RoleMember (see team.go).
+	Role string `gorm:"not null;default:'owner'"`
 }
 
 // Normalize email before saving
@@ -59,6 +70,104 @@ func (s *Store) TouchLastLogin(u *User) error {
 	return s.db.Model(u).Update("last_login_at", now).Error
 }
 
+// UserSessionState returns the session version and the role of the user,
+// the two things authMiddleware checks on every request. Deleted users yield
+// gorm.ErrRecordNotFound.
+func (s *Store) UserSessionState(userID uint) (version uint, role string, err error) {
+	var u User
+	if err := s.db.Select("id", "session_version", "role").First(&u, userID).Error; err != nil {
+		return 0, "", err
+	}
+	return u.SessionVersion, u.Role, nil
+}
+
+// BumpSessionVersion increments the user's session version, which logs the
+// user out of every session, and returns the new version.
+func (s *Store) BumpSessionVersion(userID uint) (uint, error) {
+	if err := bumpSessionVersion(s.db, userID); err != nil {
+		return 0, err
+	}
+	version, _, err := s.UserSessionState(userID)
+	return version, err
+}
+
+func bumpSessionVersion(db *gorm.DB, userID uint) error {
+	return db.Model(&User{}).Where("id = ?", userID).
+		Update("session_version", gorm.Expr("session_version + 1")).Error
+}
+
+// RequestEmailChange stores newEmail as pending address of the user together
+// with the hash of the confirmation token, valid for ttl. A new request
+// replaces an older one.
+func (s *Store) RequestEmailChange(userID uint, newEmail string, tokenHash []byte, ttl time.Duration) error {
+	exp := time.Now().UTC().Add(ttl)
+	return s.db.Model(&User{}).Where("id = ?", userID).Updates(map[string]any{
+		"pending_email":       NormalizeEmail(newEmail),
+		"email_change_token":  tokenHash,
+		"email_change_expiry": exp,
+	}).Error
+}
+
+// EmailInUse reports whether an account other than exceptUserID uses email.
+// Soft-deleted accounts count, they keep their address until purged.
+func (s *Store) EmailInUse(email string, exceptUserID uint) (bool, error) {
+	var n int64
+	err := s.db.Unscoped().Model(&User{}).
+		Where("email = ? AND id <> ?", NormalizeEmail(email), exceptUserID).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// ConfirmEmailChange completes the email change whose token hashes to
+// tokenHash and returns the user with the old address in PendingEmail (for a
+// notice). Unknown or expired tokens yield ErrTokenInvalid, an address taken
+// in the meantime ErrEmailTaken; the request is dropped in both cases.
+func (s *Store) ConfirmEmailChange(tokenHash []byte) (*User, error) {
+	var u User
+	err := s.db.Where("email_change_token = ?", tokenHash).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	reset := map[string]any{"pending_email": "", "email_change_token": nil, "email_change_expiry": nil}
+	if u.EmailChangeExpiry == nil || time.Now().After(*u.EmailChangeExpiry) || u.PendingEmail == "" {
+		_ = s.db.Model(&u).Updates(reset).Error
+		return nil, ErrTokenInvalid
+	}
+	taken, err := s.EmailInUse(u.PendingEmail, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		_ = s.db.Model(&u).Updates(reset).Error
+		return nil, ErrEmailTaken
+	}
+
+	oldEmail, newEmail := u.Email, u.PendingEmail
+	reset["email"] = newEmail
+	if err := s.db.Model(&u).Updates(reset).Error; err != nil {
+		// Lost a race against a signup with the same address.
+		if isUniqueViolation(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+	u.Email, u.PendingEmail = newEmail, oldEmail
+	u.EmailChangeToken, u.EmailChangeExpiry = nil, nil
+	return &u, nil
+}
+
+// isUniqueViolation recognizes unique index violations of SQLite and
+// Postgres (SQLSTATE 23505).
+func isUniqueViolation(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "duplicate key value") ||
+		strings.Contains(msg, "SQLSTATE 23505")
+}
+
 // ===== Pending Signup (separate table) =====
 // Holds pending signups until the email is confirmed.
 // Optionally stores a password hash during signup (or ask again after verification).
@@ -121,6 +230,19 @@ func (s *Store) CheckPassword(u *User, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
 }
 
+// VerifyUserPassword checks password against the stored hash of the user. It
+// returns ErrInvalidPassword on a mismatch.
+func (s *Store) VerifyUserPassword(userID uint, password string) error {
+	u, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if password == "" || !s.CheckPassword(u, password) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
 func (s *Store) GetUserByEMail(email string) (*User, error) {
 	email = NormalizeEmail(email)
 	var user User
@@ -311,6 +433,7 @@ func (s *Store) ConsumeSignupToken(tokenPlain string) (*User, error) {
 		u = &User{
 			Email:    st.Email,
 			Verified: true,
+			Role:     RoleOwner,
 		}
 		if st.PasswordHash != "" {
 			u.Password = st.PasswordHash
@@ -321,6 +444,11 @@ func (s *Store) ConsumeSignupToken(tokenPlain string) (*User, error) {
 		if err := s.CreateUser(u); err != nil {
 			return nil, err
 		}
+		// The new user owns its data (see login); give the owner settings
+		// so that companies can be created right away.
+		if _, err := s.EnsureSettings(u.ID); err != nil {
+			return nil, err
+		}
 	} else {
 		if !u.Verified {
 			u.Verified = true
@@ -336,15 +464,14 @@ func (s *Store) ConsumeSignupToken(tokenPlain string) (*User, error) {
 // RevokeUserAccessImmediate invalidates all access vectors for a user immediately.
 // Strategy:
 //  1. Delete API tokens (or mark revoked).
-//     2a) If you store sessions server-side: delete them.
-//     2b) If you use cookie-only sessions: bump SessionVersion so middleware rejects old cookies.
+//  2. Sessions are cookie-only: bump SessionVersion so authMiddleware rejects old cookies.
 func (s *Store) RevokeUserAccessImmediate(ctx context.Context, userID uint) error {
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// API tokens: hard-delete for immediate effect.
 		if err := tx.Where("user_id = ?", userID).Delete(&APIToken{}).Error; err != nil {
 			return err
 		}
-		return nil
+		return bumpSessionVersion(tx, userID)
 	})
 }
 
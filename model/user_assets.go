@@ -0,0 +1,63 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrUserAssetType is returned by CheckUserAssetType for files that may not
+// be stored in the file manager.
+var ErrUserAssetType = errors.New("file type not allowed")
+
+// UserAssetTypes maps the extensions of the files that may be uploaded to the
+// file manager (letterheads, logos, fonts, layout and CSS files) to the
+// content type their first bytes must be sniffed as (see
+// http.DetectContentType). A prefix ending in "/" matches a whole group.
+var UserAssetTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".svg":  "text/",
+	".ttf":  "font/ttf",
+	".otf":  "font/otf",
+	".css":  "text/",
+	".xml":  "text/",
+	".txt":  "text/",
+}
+
+// UserAssetExtensions returns the allowed extensions of UserAssetTypes,
+// sorted and separated by commas, e.g. for the accept attribute of a file
+// input.
+func UserAssetExtensions() string {
+	exts := make([]string, 0, len(UserAssetTypes))
+	for ext := range UserAssetTypes {
+		exts = append(exts, ext)
+	}
+	slices.Sort(exts)
+	return strings.Join(exts, ",")
+}
+
+// CheckUserAssetType checks the extension of filename and the content type
+// of head, the start of the file (up to 512 bytes), against UserAssetTypes.
+// A file whose content does not match its extension, e.g. an executable
+// renamed to .pdf, is rejected as well.
+func CheckUserAssetType(filename string, head []byte) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	want, ok := UserAssetTypes[ext]
+	if !ok {
+		return fmt.Errorf("%q: %w", filename, ErrUserAssetType)
+	}
+	got := http.DetectContentType(head)
+	if strings.HasSuffix(want, "/") && strings.HasPrefix(got, want) {
+		return nil
+	}
+	if mt, _, _ := strings.Cut(got, ";"); mt == want {
+		return nil
+	}
+	return fmt.Errorf("%q has content %s: %w", filename, got, ErrUserAssetType)
+}
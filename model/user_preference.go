@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// UserPreference is a setting a user chose in the UI, e.g. the page size of
+// a list, stored as key/value per owner and user so that it survives
+// navigation.
+type UserPreference struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	OwnerID   uint      `gorm:"not null;uniqueIndex:idx_user_pref,priority:1"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_user_pref,priority:2"`
+	Key       string    `gorm:"not null;uniqueIndex:idx_user_pref,priority:3"`
+	Value     string    `gorm:"not null;default:''"`
+}
+
+func (UserPreference) TableName() string { return "user_preferences" }
+
+// Keys of the user preferences.
+const (
+	PrefInvoicePageSize = "invoices.page_size"
+	PrefInvoiceSort     = "invoices.sort"
+	PrefCompanyPageSize = "companies.page_size"
+)
+
+// GetUserPref returns the user's value for key, or "" if none is stored.
+func (s *Store) GetUserPref(ownerID, userID uint, key string) (string, error) {
+	var prefs []UserPreference
+	if err := s.db.Where("owner_id = ? AND user_id = ? AND key = ?", ownerID, userID, key).
+		Limit(1).Find(&prefs).Error; err != nil {
+		return "", err
+	}
+	if len(prefs) == 0 {
+		return "", nil
+	}
+	return prefs[0].Value, nil
+}
+
+// SetUserPref stores value for key, replacing the previous value.
+func (s *Store) SetUserPref(ownerID, userID uint, key, value string) error {
+	if ownerID == 0 || userID == 0 || key == "" {
+		return errors.New("SetUserPref: owner, user and key required")
+	}
+	p := UserPreference{OwnerID: ownerID, UserID: userID, Key: key, Value: value}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "owner_id"}, {Name: "user_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&p).Error
+}
@@ -0,0 +1,37 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestUserPref(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+
+	if v, err := store.GetUserPref(owner, 1, model.PrefInvoicePageSize); err != nil || v != "" {
+		t.Fatalf("GetUserPref without value = %q, %v; want empty", v, err)
+	}
+	if err := store.SetUserPref(owner, 1, model.PrefInvoicePageSize, "100"); err != nil {
+		t.Fatalf("SetUserPref failed: %v", err)
+	}
+	if err := store.SetUserPref(owner, 1, model.PrefInvoicePageSize, "25"); err != nil {
+		t.Fatalf("SetUserPref (overwrite) failed: %v", err)
+	}
+	if v, _ := store.GetUserPref(owner, 1, model.PrefInvoicePageSize); v != "25" {
+		t.Errorf("page size = %q, want 25", v)
+	}
+
+	// Other users and owners keep their own values.
+	if v, _ := store.GetUserPref(owner, 2, model.PrefInvoicePageSize); v != "" {
+		t.Errorf("other user sees %q", v)
+	}
+	if v, _ := store.GetUserPref(owner+1, 1, model.PrefInvoicePageSize); v != "" {
+		t.Errorf("other owner sees %q", v)
+	}
+	if v, _ := store.GetUserPref(owner, 1, model.PrefInvoiceSort); v != "" {
+		t.Errorf("other key sees %q", v)
+	}
+}
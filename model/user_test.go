@@ -0,0 +1,101 @@
+package model_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestConfirmEmailChange(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	td := fixtures.SeedTestData(t, store)
+	other := fixtures.User(fixtures.WithUserEmail("taken@example.com"))
+	if err := store.CreateUser(other); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	hash := func(token string) []byte {
+		sum := sha256.Sum256([]byte(token))
+		return sum[:]
+	}
+
+	if err := store.RequestEmailChange(td.User.ID, " New@Example.com ", hash("a"), time.Hour); err != nil {
+		t.Fatalf("RequestEmailChange failed: %v", err)
+	}
+	if _, err := store.ConfirmEmailChange(hash("wrong")); !errors.Is(err, model.ErrTokenInvalid) {
+		t.Errorf("wrong token: got %v, want ErrTokenInvalid", err)
+	}
+	u, err := store.ConfirmEmailChange(hash("a"))
+	if err != nil {
+		t.Fatalf("ConfirmEmailChange failed: %v", err)
+	}
+	if u.Email != "new@example.com" || u.PendingEmail != "test@example.com" {
+		t.Errorf("got email %q, old %q", u.Email, u.PendingEmail)
+	}
+	if _, err := store.ConfirmEmailChange(hash("a")); !errors.Is(err, model.ErrTokenInvalid) {
+		t.Errorf("token reused: got %v, want ErrTokenInvalid", err)
+	}
+
+	// The address was free when requested but is taken on confirmation.
+	if err := store.RequestEmailChange(td.User.ID, "Taken@example.com", hash("b"), time.Hour); err != nil {
+		t.Fatalf("RequestEmailChange failed: %v", err)
+	}
+	if _, err := store.ConfirmEmailChange(hash("b")); !errors.Is(err, model.ErrEmailTaken) {
+		t.Errorf("taken address: got %v, want ErrEmailTaken", err)
+	}
+
+	if err := store.RequestEmailChange(td.User.ID, "late@example.com", hash("c"), -time.Minute); err != nil {
+		t.Fatalf("RequestEmailChange failed: %v", err)
+	}
+	if _, err := store.ConfirmEmailChange(hash("c")); !errors.Is(err, model.ErrTokenInvalid) {
+		t.Errorf("expired token: got %v, want ErrTokenInvalid", err)
+	}
+	reloaded, err := store.GetUserByID(td.User.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if reloaded.Email != "new@example.com" || reloaded.PendingEmail != "" {
+		t.Errorf("after failed changes: email %q, pending %q", reloaded.Email, reloaded.PendingEmail)
+	}
+}
+
+func TestSignupCreatesSettings(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	ctx := context.Background()
+
+	if _, err := store.CreateSignupToken("new@example.com", "", time.Hour, "signup-token"); err != nil {
+		t.Fatalf("CreateSignupToken failed: %v", err)
+	}
+	u, err := store.ConsumeSignupToken("signup-token")
+	if err != nil {
+		t.Fatalf("ConsumeSignupToken failed: %v", err)
+	}
+	got, err := store.SuggestNextCustomerNumber(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("SuggestNextCustomerNumber failed: %v", err)
+	}
+	if got != "K-0001" {
+		t.Errorf("first customer number = %q, want K-0001", got)
+	}
+
+	// EnsureSettings does not reset an existing row.
+	settings, err := store.LoadSettings(u.ID)
+	if err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	settings.CustomerNumberPrefix = "C"
+	if err := store.SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	again, err := store.EnsureSettings(u.ID)
+	if err != nil {
+		t.Fatalf("EnsureSettings failed: %v", err)
+	}
+	if again.ID != settings.ID || again.CustomerNumberPrefix != "C" {
+		t.Errorf("EnsureSettings changed the row: %+v", again)
+	}
+}
@@ -0,0 +1,450 @@
+package model
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Webhook events sent on invoice status changes.
+const (
+	WebhookEventInvoiceIssued = "invoice.issued"
+	WebhookEventInvoicePaid   = "invoice.paid"
+	WebhookEventInvoiceVoided = "invoice.voided"
+)
+
+// WebhookEvents lists all events a webhook can subscribe to.
+var WebhookEvents = []string{WebhookEventInvoiceIssued, WebhookEventInvoicePaid, WebhookEventInvoiceVoided}
+
+// Webhook is an URL of the owner that is notified about invoice status
+// changes. Each request carries the HMAC-SHA256 of the body, keyed with
+// Secret, in the X-Billingcat-Signature header ("sha256=<hex>").
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	OwnerID   uint      `gorm:"not null;index"`
+	URL       string    `gorm:"column:url;type:text;not null"`
+	Secret    string    `gorm:"type:text;not null"`
+	Events    string    `gorm:"type:text;not null"` // comma-separated, empty = all events
+}
+
+func (Webhook) TableName() string { return "webhooks" }
+
+// EventList returns the subscribed events.
+func (w Webhook) EventList() []string {
+	if w.Events == "" {
+		return WebhookEvents
+	}
+	return SplitTags(w.Events)
+}
+
+// Subscribes reports whether the webhook is sent for event.
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery states.
+const (
+	WebhookDeliveryRetrying  = "retrying"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery records one event sent to a webhook, including the
+// retries. NextAttemptAt is set while the delivery is retrying, so that
+// ResumeWebhookDeliveries can continue after a restart.
+type WebhookDelivery struct {
+	ID            uint      `gorm:"primaryKey"`
+	CreatedAt     time.Time `gorm:"not null;index"`
+	UpdatedAt     time.Time `gorm:"not null"`
+	OwnerID       uint      `gorm:"not null;index"`
+	WebhookID     uint      `gorm:"not null;index"`
+	Event         string    `gorm:"type:text;not null"`
+	InvoiceID     uint      `gorm:"not null"`
+	Payload       string    `gorm:"type:text;not null"`
+	Status        string    `gorm:"type:text;not null"`
+	Attempts      int       `gorm:"not null;default:0"`
+	ResponseCode  int       `gorm:"not null;default:0"` // HTTP status of the last attempt, 0 = no response
+	Error         string    `gorm:"type:text;not null;default:''"`
+	DeliveredAt   *time.Time
+	NextAttemptAt *time.Time
+}
+
+func (WebhookDelivery) TableName() string { return "webhook_deliveries" }
+
+// webhookRetryDelays are the pauses between the attempts of a delivery. A
+// delivery fails for good after len(webhookRetryDelays)+1 attempts.
+var webhookRetryDelays = []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute, time.Hour}
+
+// ErrWebhookTarget is returned when a webhook request would go to an
+// address of the server's own network (loopback, private, shared CGNAT,
+// link-local or unspecified), which tenants must not reach.
+var ErrWebhookTarget = errors.New("webhook target address not allowed")
+
+// webhookAllowLocal disables the address check of webhookDialControl. Only
+// tests set it, their receivers run on localhost.
+var webhookAllowLocal = false
+
+// webhookClient sends the webhook requests. The target address is checked
+// after name resolution on every connection, and redirects are not followed,
+// so that a webhook cannot be pointed at internal services.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy: nil, // a proxy would connect on our behalf and skip the check
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: webhookDialControl,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return errors.New("webhook redirects are not followed")
+	},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598. Cloud
+// providers use it for internal endpoints, so it counts as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// webhookDialControl rejects connections to addresses that are not public,
+// see ErrWebhookTarget. address is the resolved IP and port.
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	if webhookAllowLocal {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%s: %w", host, ErrWebhookTarget)
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%s: %w", ip, ErrWebhookTarget)
+	}
+	return nil
+}
+
+// normalizeWebhook checks and cleans w before it is saved.
+func normalizeWebhook(w *Webhook) error {
+	w.URL = strings.TrimSpace(w.URL)
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", w.URL)
+	}
+	events := SplitTags(w.Events)
+	for _, e := range events {
+		found := false
+		for _, known := range WebhookEvents {
+			found = found || e == known
+		}
+		if !found {
+			return fmt.Errorf("unknown webhook event %q", e)
+		}
+	}
+	if len(events) == len(WebhookEvents) {
+		events = nil
+	}
+	w.Events = JoinTags(events)
+	w.Secret = strings.TrimSpace(w.Secret)
+	if w.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(b)
+	}
+	return nil
+}
+
+// ListWebhooks returns the webhooks of the owner, oldest first.
+func (s *Store) ListWebhooks(ownerID uint) ([]Webhook, error) {
+	var hooks []Webhook
+	err := s.db.Where("owner_id = ?", ownerID).Order("id ASC").Find(&hooks).Error
+	return hooks, err
+}
+
+// LoadWebhook loads one webhook of the owner.
+func (s *Store) LoadWebhook(id, ownerID uint) (*Webhook, error) {
+	var w Webhook
+	if err := s.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&w).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// SaveWebhook creates (ID 0) or updates a webhook. The URL must be an
+// absolute http(s) URL, the events must be known. A missing secret is
+// generated.
+func (s *Store) SaveWebhook(w *Webhook) error {
+	if w.OwnerID == 0 {
+		return errors.New("SaveWebhook: OwnerID required")
+	}
+	if err := normalizeWebhook(w); err != nil {
+		return err
+	}
+	if w.ID != 0 {
+		existing, err := s.LoadWebhook(w.ID, w.OwnerID)
+		if err != nil {
+			return err
+		}
+		w.CreatedAt = existing.CreatedAt
+	}
+	return s.db.Save(w).Error
+}
+
+// DeleteWebhook removes a webhook and its deliveries. Retries still pending
+// for it are dropped when they are due.
+func (s *Store) DeleteWebhook(id, ownerID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&Webhook{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("webhook_id = ? AND owner_id = ?", id, ownerID).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the owner, newest
+// first.
+func (s *Store) ListWebhookDeliveries(ownerID uint, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	var deliveries []WebhookDelivery
+	err := s.db.Where("owner_id = ?", ownerID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// webhookInvoice is the invoice as sent in webhook payloads.
+type webhookInvoice struct {
+	ID         uint            `json:"id"`
+	Number     string          `json:"number"`
+	Status     InvoiceStatus   `json:"status"`
+	CompanyID  uint            `json:"company_id"`
+	Currency   string          `json:"currency"`
+	Date       time.Time       `json:"date"`
+	DueDate    time.Time       `json:"due_date"`
+	NetTotal   decimal.Decimal `json:"net_total"`
+	GrossTotal decimal.Decimal `json:"gross_total"`
+	IssuedAt   *time.Time      `json:"issued_at,omitempty"`
+	PaidAt     *time.Time      `json:"paid_at,omitempty"`
+	VoidedAt   *time.Time      `json:"voided_at,omitempty"`
+}
+
+type webhookPayload struct {
+	Event      string         `json:"event"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Invoice    webhookInvoice `json:"invoice"`
+}
+
+// dispatchInvoiceWebhooks sends event for the invoice to all webhooks of the
+// owner that subscribe to it. The requests are made in the background;
+// errors are recorded in the deliveries or logged.
+func (s *Store) dispatchInvoiceWebhooks(invoiceID, ownerID uint, event string) {
+	hooks, err := s.ListWebhooks(ownerID)
+	if err != nil {
+		slog.Error("list webhooks", "owner_id", ownerID, "err", err)
+		return
+	}
+	var targets []Webhook
+	for _, h := range hooks {
+		if h.Subscribes(event) {
+			targets = append(targets, h)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	var inv Invoice
+	if err := s.db.Where("id = ? AND owner_id = ?", invoiceID, ownerID).First(&inv).Error; err != nil {
+		slog.Error("load invoice for webhook", "invoice_id", invoiceID, "err", err)
+		return
+	}
+	body, err := json.Marshal(webhookPayload{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Invoice: webhookInvoice{
+			ID:         inv.ID,
+			Number:     inv.Number,
+			Status:     inv.Status,
+			CompanyID:  inv.CompanyID,
+			Currency:   inv.Currency,
+			Date:       inv.Date,
+			DueDate:    inv.DueDate,
+			NetTotal:   inv.NetTotal,
+			GrossTotal: inv.GrossTotal,
+			IssuedAt:   inv.IssuedAt,
+			PaidAt:     inv.PaidAt,
+			VoidedAt:   inv.VoidedAt,
+		},
+	})
+	if err != nil {
+		slog.Error("marshal webhook payload", "invoice_id", invoiceID, "err", err)
+		return
+	}
+
+	for _, h := range targets {
+		d := &WebhookDelivery{
+			OwnerID:   ownerID,
+			WebhookID: h.ID,
+			Event:     event,
+			InvoiceID: invoiceID,
+			Payload:   string(body),
+			Status:    WebhookDeliveryRetrying,
+		}
+		if err := s.db.Create(d).Error; err != nil {
+			slog.Error("create webhook delivery", "webhook_id", h.ID, "err", err)
+			continue
+		}
+		go s.deliverWebhook(h, d)
+	}
+}
+
+// deliverWebhook makes one attempt to post the payload of d to the webhook.
+// If it is not accepted (2xx), the next attempt is scheduled after the
+// matching entry of webhookRetryDelays and stored in NextAttemptAt; when the
+// retries are used up, the delivery fails.
+func (s *Store) deliverWebhook(h Webhook, d *WebhookDelivery) {
+	code, err := postWebhook(h, d)
+	d.Attempts++
+	d.ResponseCode = code
+	d.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		now := time.Now()
+		d.Status = WebhookDeliveryDelivered
+		d.DeliveredAt = &now
+		d.Error = ""
+	case d.Attempts > len(webhookRetryDelays):
+		d.Status = WebhookDeliveryFailed
+		d.Error = truncateRunes(err.Error(), 500)
+	default:
+		next := time.Now().Add(webhookRetryDelays[d.Attempts-1])
+		d.NextAttemptAt = &next
+		d.Error = truncateRunes(err.Error(), 500)
+	}
+	res := s.db.Model(d).
+		Select("Status", "Attempts", "ResponseCode", "Error", "DeliveredAt", "NextAttemptAt", "UpdatedAt").
+		Updates(d)
+	if res.Error != nil {
+		slog.Error("update webhook delivery", "delivery_id", d.ID, "err", res.Error)
+	}
+	if d.Status == WebhookDeliveryRetrying && res.RowsAffected > 0 {
+		s.scheduleWebhookRetry(d.ID, d.OwnerID, time.Until(*d.NextAttemptAt))
+	}
+}
+
+// scheduleWebhookRetry makes the next attempt of a delivery after delay. The
+// delivery and its webhook are loaded again then; nothing is sent if either
+// was deleted or the delivery is no longer retrying.
+func (s *Store) scheduleWebhookRetry(deliveryID, ownerID uint, delay time.Duration) {
+	if delay < 0 {
+		delay = 0
+	}
+	time.AfterFunc(delay, func() {
+		var d WebhookDelivery
+		err := s.db.Where("id = ? AND owner_id = ? AND status = ?", deliveryID, ownerID, WebhookDeliveryRetrying).
+			First(&d).Error
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				slog.Error("load webhook delivery", "delivery_id", deliveryID, "err", err)
+			}
+			return
+		}
+		h, err := s.LoadWebhook(d.WebhookID, ownerID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				slog.Error("load webhook", "webhook_id", d.WebhookID, "err", err)
+			}
+			return
+		}
+		s.deliverWebhook(*h, &d)
+	})
+}
+
+// ResumeWebhookDeliveries schedules the deliveries that were still retrying
+// when the server stopped, at their stored NextAttemptAt or right away if it
+// has passed (or was never set because the first attempt did not happen).
+// It is called once at startup.
+func (s *Store) ResumeWebhookDeliveries() error {
+	var pending []WebhookDelivery
+	if err := s.db.Where("status = ?", WebhookDeliveryRetrying).Find(&pending).Error; err != nil {
+		return fmt.Errorf("load pending webhook deliveries: %w", err)
+	}
+	for _, d := range pending {
+		var delay time.Duration
+		if d.NextAttemptAt != nil {
+			delay = time.Until(*d.NextAttemptAt)
+		}
+		s.scheduleWebhookRetry(d.ID, d.OwnerID, delay)
+	}
+	return nil
+}
+
+// postWebhook makes one delivery attempt and returns the HTTP status code
+// (0 without response). Any status other than 2xx is an error.
+func postWebhook(h Webhook, d *WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "billingcat-webhook/1")
+	req.Header.Set("X-Billingcat-Event", d.Event)
+	req.Header.Set("X-Billingcat-Delivery", fmt.Sprint(d.ID))
+	req.Header.Set("X-Billingcat-Signature", "sha256="+WebhookSignature(h.Secret, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// WebhookSignature returns the hex encoded HMAC-SHA256 of body keyed with
+// secret, as sent in the X-Billingcat-Signature header. Receivers should
+// compare it in constant time (hmac.Equal).
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
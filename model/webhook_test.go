@@ -0,0 +1,235 @@
+package model_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+)
+
+func TestSaveWebhook_Validation(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+
+	for _, w := range []model.Webhook{
+		{OwnerID: owner, URL: "ftp://example.com/hook"},
+		{OwnerID: owner, URL: "/relative"},
+		{OwnerID: owner, URL: "https://example.com/hook", Events: "invoice.deleted"},
+	} {
+		if err := store.SaveWebhook(&w); err == nil {
+			t.Errorf("SaveWebhook(%q, %q): expected error", w.URL, w.Events)
+		}
+	}
+
+	w := &model.Webhook{OwnerID: owner, URL: " https://example.com/hook ", Events: "invoice.paid, invoice.issued, invoice.voided"}
+	if err := store.SaveWebhook(w); err != nil {
+		t.Fatalf("SaveWebhook failed: %v", err)
+	}
+	if w.URL != "https://example.com/hook" || w.Events != "" || len(w.Secret) != 64 {
+		t.Errorf("webhook not normalized: %+v", w)
+	}
+	if err := store.DeleteWebhook(w.ID, owner+1); err == nil {
+		t.Errorf("DeleteWebhook for another owner succeeded")
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	data := fixtures.SeedTestData(t, store)
+	owner := fixtures.DefaultOwnerID
+	defer model.SetWebhookRetryDelays(10 * time.Millisecond)()
+	defer model.AllowLocalWebhooks()()
+
+	type request struct {
+		event, signature string
+		body             []byte
+	}
+	var (
+		mu       sync.Mutex
+		requests []request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{r.Header.Get("X-Billingcat-Event"), r.Header.Get("X-Billingcat-Signature"), body})
+		first := len(requests) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	hook := &model.Webhook{OwnerID: owner, URL: srv.URL, Secret: "s3cret", Events: model.WebhookEventInvoiceIssued}
+	if err := store.SaveWebhook(hook); err != nil {
+		t.Fatalf("SaveWebhook failed: %v", err)
+	}
+	// Subscribed to another event only, must not be called.
+	if err := store.SaveWebhook(&model.Webhook{OwnerID: owner, URL: srv.URL + "/paid", Events: model.WebhookEventInvoicePaid}); err != nil {
+		t.Fatalf("SaveWebhook failed: %v", err)
+	}
+
+	if err := store.MarkInvoiceIssued(data.Invoice.ID, owner, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceIssued failed: %v", err)
+	}
+
+	d := waitWebhookDelivery(t, store, owner)
+	if d.Status != model.WebhookDeliveryDelivered || d.Attempts != 2 || d.ResponseCode != http.StatusOK || d.WebhookID != hook.ID {
+		t.Errorf("delivery = %+v, want delivered on the second attempt", d)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	req := requests[1]
+	if req.event != model.WebhookEventInvoiceIssued {
+		t.Errorf("event header = %q", req.event)
+	}
+	if want := "sha256=" + model.WebhookSignature("s3cret", req.body); req.signature != want {
+		t.Errorf("signature = %q, want %q", req.signature, want)
+	}
+	var payload struct {
+		Event   string `json:"event"`
+		Invoice struct {
+			ID     uint   `json:"id"`
+			Status string `json:"status"`
+		} `json:"invoice"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("payload is no JSON: %v", err)
+	}
+	if payload.Event != model.WebhookEventInvoiceIssued || payload.Invoice.ID != data.Invoice.ID || payload.Invoice.Status != "issued" {
+		t.Errorf("payload = %s", req.body)
+	}
+}
+
+// waitWebhookDelivery waits until the only delivery of the owner is no
+// longer retrying and returns it.
+func waitWebhookDelivery(t *testing.T, store *model.Store, owner uint) model.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := store.ListWebhookDeliveries(owner, 10)
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries failed: %v", err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status != model.WebhookDeliveryRetrying {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery not finished: %+v", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDelivery_InternalTargets(t *testing.T) {
+	defer model.SetWebhookRetryDelays()()
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer srv.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(srv.URL, http.StatusFound))
+	defer redirect.Close()
+
+	for _, tc := range []struct {
+		name, url  string
+		allowLocal bool
+		wantErr    string
+	}{
+		{"loopback", srv.URL, false, "not allowed"},
+		{"redirect", redirect.URL, true, "redirects are not followed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.allowLocal {
+				defer model.AllowLocalWebhooks()()
+			}
+			store := fixtures.NewTestStore(t)
+			data := fixtures.SeedTestData(t, store)
+			owner := fixtures.DefaultOwnerID
+			if err := store.SaveWebhook(&model.Webhook{OwnerID: owner, URL: tc.url}); err != nil {
+				t.Fatalf("SaveWebhook failed: %v", err)
+			}
+			if err := store.MarkInvoiceIssued(data.Invoice.ID, owner, time.Now()); err != nil {
+				t.Fatalf("MarkInvoiceIssued failed: %v", err)
+			}
+			d := waitWebhookDelivery(t, store, owner)
+			if d.Status != model.WebhookDeliveryFailed || !strings.Contains(d.Error, tc.wantErr) {
+				t.Errorf("delivery = %+v, want failed with %q", d, tc.wantErr)
+			}
+			if called.Load() {
+				t.Errorf("internal receiver was called")
+			}
+		})
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"100.63.255.255:443", true},
+		{"100.128.0.1:443", true},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"192.168.0.10:80", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:80", false},
+		{"100.100.100.200:80", false},
+		{"[::ffff:100.64.0.1]:80", false},
+		{"[::1]:80", false},
+		{"[fd00::1]:80", false},
+	} {
+		err := model.WebhookDialControl("tcp", tc.address, nil)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: %v, want allowed", tc.address, err)
+		}
+		if !tc.allowed && !errors.Is(err, model.ErrWebhookTarget) {
+			t.Errorf("%s: err = %v, want ErrWebhookTarget", tc.address, err)
+		}
+	}
+}
+
+func TestResumeWebhookDeliveries(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	owner := fixtures.DefaultOwnerID
+	defer model.AllowLocalWebhooks()()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	hook := &model.Webhook{OwnerID: owner, URL: srv.URL}
+	if err := store.SaveWebhook(hook); err != nil {
+		t.Fatalf("SaveWebhook failed: %v", err)
+	}
+	// A delivery left retrying by a previous run of the server.
+	due := time.Now().Add(-time.Minute)
+	d := &model.WebhookDelivery{
+		OwnerID: owner, WebhookID: hook.ID, Event: model.WebhookEventInvoicePaid, InvoiceID: 1,
+		Payload: "{}", Status: model.WebhookDeliveryRetrying, Attempts: 1, NextAttemptAt: &due,
+	}
+	if err := store.CreateWebhookDeliveryForTest(d); err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+
+	if err := store.ResumeWebhookDeliveries(); err != nil {
+		t.Fatalf("ResumeWebhookDeliveries failed: %v", err)
+	}
+	got := waitWebhookDelivery(t, store, owner)
+	if got.Status != model.WebhookDeliveryDelivered || got.Attempts != 2 || got.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want delivered on the second attempt", got)
+	}
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"os"
+	"strings"
+
+	"github.com/speedata/einvoice"
+)
+
+// xrechnungBusinessProcess is the business process identifier (BT-23)
+// XRechnung 3.0 expects for invoices exchanged via PEPPOL.
+const xrechnungBusinessProcess = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+
+// createXRechnungXML builds the CII invoice with the XRechnung guideline. The
+// content is the same as for ZUGFeRD; only the profile and business process
+// differ. The Leitweg-ID is taken from the invoice's BuyerReference (BT-10).
+func createXRechnungXML(inv *Invoice, settings *Settings, company *Company) einvoice.Invoice {
+	zi := createZUGFerdXML(inv, settings, company)
+	zi.Profile = einvoice.CProfileXRechnung
+	zi.BPSpecifiedDocumentContextParameter = xrechnungBusinessProcess
+	return zi
+}
+
+// WriteXRechnungXML writes the standalone XRechnung file (CII syntax) to path.
+func (s *Store) WriteXRechnungXML(inv *Invoice, ownerID uint, path string) error {
+	settings, err := s.LoadSettingsForCurrency(ownerID, inv.Currency)
+	if err != nil {
+		return err
+	}
+	company, err := s.LoadCompany(inv.CompanyID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	zi := createXRechnungXML(inv, settings, company)
+	docs, err := s.attachmentDocuments(inv.ID, ownerID)
+	if err != nil {
+		return err
+	}
+	zi.AdditionalReferencedDocument = append(zi.AdditionalReferencedDocument, docs...)
+	cii, err := writeCII(&zi, inv.PriceDecimals)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(insertPaymentReference(cii, zi.PaymentReference)), 0644)
+}
+
+// xrechnungViolations checks the German national rules (BR-DE-*) that
+// einvoice does not implement. Only the rules that depend on data entered in
+// billingcat are covered.
+func xrechnungViolations(zi *einvoice.Invoice) []einvoice.SemanticError {
+	var out []einvoice.SemanticError
+	add := func(rule, field, text string) {
+		out = append(out, einvoice.SemanticError{Rule: rule, InvFields: []string{field}, Text: text})
+	}
+
+	if strings.TrimSpace(zi.BuyerReference) == "" {
+		add("BR-DE-15", "BT-10", "Eine Rechnung muss eine Leitweg-ID (Käuferreferenz) enthalten.")
+	}
+	if addr := zi.Seller.PostalAddress; addr == nil || strings.TrimSpace(addr.City) == "" {
+		add("BR-DE-3", "BT-37", "Der Ort des Verkäufers muss angegeben werden.")
+	}
+	if addr := zi.Seller.PostalAddress; addr == nil || strings.TrimSpace(addr.PostcodeCode) == "" {
+		add("BR-DE-4", "BT-38", "Die Postleitzahl des Verkäufers muss angegeben werden.")
+	}
+
+	var contact einvoice.DefinedTradeContact
+	if len(zi.Seller.DefinedTradeContact) > 0 {
+		contact = zi.Seller.DefinedTradeContact[0]
+	}
+	if strings.TrimSpace(contact.PersonName) == "" {
+		add("BR-DE-5", "BT-41", "Der Ansprechpartner des Verkäufers muss angegeben werden.")
+	}
+	if strings.TrimSpace(contact.PhoneNumber) == "" {
+		add("BR-DE-6", "BT-42", "Die Telefonnummer des Verkäufers muss angegeben werden.")
+	}
+	if strings.TrimSpace(contact.EMail) == "" {
+		add("BR-DE-7", "BT-43", "Die E-Mail-Adresse des Verkäufers muss angegeben werden.")
+	}
+
+	if addr := zi.Buyer.PostalAddress; addr == nil || strings.TrimSpace(addr.City) == "" {
+		add("BR-DE-8", "BT-52", "Der Ort des Käufers muss angegeben werden.")
+	}
+	if addr := zi.Buyer.PostalAddress; addr == nil || strings.TrimSpace(addr.PostcodeCode) == "" {
+		add("BR-DE-9", "BT-53", "Die Postleitzahl des Käufers muss angegeben werden.")
+	}
+
+	// BR-DE-23: credit transfer requires the payee's IBAN.
+	for _, pm := range zi.PaymentMeans {
+		if pm.TypeCode == 30 && strings.TrimSpace(pm.PayeePartyCreditorFinancialAccountIBAN) == "" {
+			add("BR-DE-23", "BT-84", "Bei Überweisung muss eine IBAN angegeben werden.")
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billingcat/crm/fixtures"
+	"github.com/billingcat/crm/model"
+	"github.com/speedata/einvoice"
+)
+
+func hasRule(violations []einvoice.SemanticError, rule string) bool {
+	for _, v := range violations {
+		if v.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestXRechnung_BuyerReference(t *testing.T) {
+	store := fixtures.NewTestStore(t)
+	fixtures.SeedTestData(t, store)
+
+	company := fixtures.Company(
+		fixtures.WithCompanyName("Stadtverwaltung Musterstadt"),
+		fixtures.WithCompanyEInvoiceProfile(model.EInvoiceProfileXRechnung),
+	)
+	if err := store.SaveCompany(company, fixtures.DefaultOwnerID, nil); err != nil {
+		t.Fatalf("SaveCompany failed: %v", err)
+	}
+
+	inv := fixtures.Invoice(
+		fixtures.WithInvoiceCompanyID(company.ID),
+		fixtures.WithInvoicePositions(fixtures.SamplePositions()...),
+	)
+	inv.BuyerReference = "04011000-12345-67"
+	if err := store.SaveInvoice(inv, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("SaveInvoice failed: %v", err)
+	}
+	loaded, err := store.LoadInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadInvoice failed: %v", err)
+	}
+
+	xmlPath := filepath.Join(t.TempDir(), "xrechnung.xml")
+	if err := store.WriteXRechnungXML(loaded, fixtures.DefaultOwnerID, xmlPath); err != nil {
+		t.Fatalf("WriteXRechnungXML failed: %v", err)
+	}
+	b, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("read xml: %v", err)
+	}
+	xml := string(b)
+	if !strings.Contains(xml, "urn:xeinkauf.de:kosit:xrechnung_3.0") {
+		t.Error("XRechnung XML should carry the XRechnung guideline ID")
+	}
+	if !strings.Contains(xml, "04011000-12345-67") {
+		t.Error("XRechnung XML should contain the Leitweg-ID as buyer reference")
+	}
+
+	// The test settings have no seller phone, which XRechnung requires.
+	_, violations, err := store.LoadAndVerifyInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadAndVerifyInvoice failed: %v", err)
+	}
+	if !hasRule(violations, "BR-DE-6") {
+		t.Error("expected BR-DE-6 for missing seller phone")
+	}
+	if hasRule(violations, "BR-DE-15") {
+		t.Error("unexpected BR-DE-15 with Leitweg-ID set")
+	}
+
+	loaded.BuyerReference = ""
+	if err := store.UpdateInvoice(loaded, fixtures.DefaultOwnerID); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+	_, violations, err = store.LoadAndVerifyInvoice(inv.ID, fixtures.DefaultOwnerID)
+	if err != nil {
+		t.Fatalf("LoadAndVerifyInvoice failed: %v", err)
+	}
+	if !hasRule(violations, "BR-DE-15") {
+		t.Error("expected BR-DE-15 for missing Leitweg-ID")
+	}
+}
@@ -12,6 +12,13 @@ function updateSearchResults(ai) {
         link.href = `${result.action}`;
         link.textContent = `${result.text}`;
         listItem.appendChild(link);
+        // matched through a phone number, e-mail address, city etc.: show the value
+        if (result.source !== "name" && result.detail) {
+            const detail = document.createElement("span");
+            detail.className = "ml-2 text-xs text-gray-500";
+            detail.textContent = result.detail;
+            listItem.appendChild(detail);
+        }
         resultsContainer.appendChild(listItem);
     });
     // if there are no results, show "No results found"
@@ -116,6 +123,56 @@ function searchhandler(e) {
     updateSearchResults(jsonActiveItem);
 }
 
+// companyPicker is the company typeahead of the person form. It searches
+// /company/suggest while typing and keeps the chosen company's id for the
+// hidden form field. id and name preset the field (strings, may be empty).
+function companyPicker({ id, name }) {
+  return {
+    id: id || '',
+    query: name || '',
+    results: [],
+    open: false,
+    active: 0,
+    timer: null,
+
+    search() {
+      this.id = ''; // the typed text no longer names the chosen company
+      clearTimeout(this.timer);
+      const q = this.query.trim();
+      if (q === '') {
+        this.results = [];
+        this.open = false;
+        return;
+      }
+      this.timer = setTimeout(async () => {
+        const res = await fetch('/company/suggest?q=' + encodeURIComponent(q));
+        if (!res.ok) return;
+        this.results = await res.json();
+        this.active = 0;
+        this.open = true;
+      }, 200);
+    },
+
+    move(delta) {
+      if (!this.open) return;
+      const next = this.active + delta;
+      if (next >= 0 && next < this.results.length) this.active = next;
+    },
+
+    enter(e) {
+      if (!this.open) return;
+      e.preventDefault(); // do not submit the form while choosing
+      if (this.results[this.active]) this.choose(this.results[this.active]);
+    },
+
+    choose(c) {
+      this.id = String(c.id);
+      this.query = c.name;
+      this.open = false;
+    },
+  };
+}
+
 function invoiceStatusPanel({ id, status, csrf }) {
   return {
     id,